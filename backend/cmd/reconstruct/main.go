@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/database"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/repository"
+	"github.com/joho/godotenv"
+)
+
+// reconstruct prints the order book of a symbol as it stood at a past moment,
+// rebuilt by replaying persisted orders and cancels through a fresh engine.
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+
+	dbURL := flag.String("db", getEnv("DATABASE_URL", "sqlite://./hft_exchange.db"), "database URL")
+	symbol := flag.String("symbol", "BTC-USD", "symbol to reconstruct")
+	atStr := flag.String("at", "", "RFC3339 timestamp to reconstruct (default: now)")
+	window := flag.Duration("window", engine.DefaultReplayWindow, "how far back before -at to replay")
+	depth := flag.Int("depth", 20, "number of levels per side")
+	flag.Parse()
+
+	at := time.Now()
+	if *atStr != "" {
+		parsed, err := time.Parse(time.RFC3339, *atStr)
+		if err != nil {
+			log.Fatalf("Invalid -at timestamp: %v", err)
+		}
+		at = parsed
+	}
+
+	db, err := database.NewDB(*dbURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	orderRepo := repository.NewOrderRepository(db.DB)
+
+	orderBook, err := engine.ReconstructOrderBook(context.Background(), orderRepo, *symbol, at, *window, *depth)
+	if err != nil {
+		log.Fatalf("Reconstruction failed: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(orderBook); err != nil {
+		log.Fatalf("Failed to encode order book: %v", err)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
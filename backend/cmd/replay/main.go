@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/hft-exchange/backend/internal/database"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/repository"
+	"github.com/joho/godotenv"
+)
+
+// report is what a replay found
+type report struct {
+	Symbol      string   `json:"symbol"`
+	FromSeq     uint64   `json:"from_seq"`
+	SnapshotSeq uint64   `json:"snapshot_seq"`
+	Trades      int      `json:"trades"`
+	Orders      int      `json:"orders"`
+	Mismatches  []string `json:"mismatches"`
+}
+
+var errFound = errors.New("found")
+
+// replay rebuilds a symbol's book from its journal on a fresh engine and
+// checks it against a recorded snapshot. By default the records between the
+// last two snapshots are replayed; it exits non-zero on any difference.
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+
+	dbURL := flag.String("db", getEnv("DATABASE_URL", "sqlite://./hft_exchange.db"), "database URL")
+	symbol := flag.String("symbol", "BTC-USD", "symbol to replay")
+	snapshotSeq := flag.Uint64("snapshot", 0, "sequence of the snapshot to check against (default: the latest)")
+	fromSeq := flag.Int64("from", -1, "sequence to replay from: 0 for the start of the journal (default: the previous snapshot)")
+	flag.Parse()
+
+	db, err := database.NewDB(*dbURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	store := &journalStore{repo: repository.NewJournalRepository(db.DB)}
+	snapshots, err := store.SnapshotSeqs(ctx, *symbol)
+	if err != nil {
+		log.Fatalf("Failed to list snapshots: %v", err)
+	}
+
+	target := *snapshotSeq
+	if target == 0 && len(snapshots) > 0 {
+		target = snapshots[len(snapshots)-1]
+	}
+	var previous uint64
+	for _, seq := range snapshots {
+		if seq < target {
+			previous = seq
+		}
+	}
+	if target == 0 {
+		log.Fatalf("%s has no snapshot to check against", *symbol)
+	}
+	from := previous
+	if *fromSeq >= 0 {
+		from = uint64(*fromSeq)
+	}
+
+	var snapshot *engine.JournalRecord
+	err = store.ReadJournal(ctx, *symbol, target, func(record *engine.JournalRecord) error {
+		snapshot = record
+		return errFound
+	})
+	if err != nil && !errors.Is(err, errFound) {
+		log.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if snapshot == nil || snapshot.Seq != target || snapshot.Kind != engine.JournalSnapshot {
+		log.Fatalf("Record %d of %s is not a snapshot", target, *symbol)
+	}
+
+	replayed, err := engine.ReplayJournal(ctx, store, *symbol, from, target)
+	if err != nil {
+		log.Fatalf("Replay failed: %v", err)
+	}
+
+	result := report{
+		Symbol:      *symbol,
+		FromSeq:     from,
+		SnapshotSeq: target,
+		Trades:      replayed.Trades,
+		Orders:      len(replayed.Orders),
+		Mismatches:  compareBooks(snapshot, replayed),
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatalf("Failed to encode report: %v", err)
+	}
+	if len(result.Mismatches) > 0 {
+		os.Exit(1)
+	}
+}
+
+// compareBooks describes every difference between a snapshot and a replay
+func compareBooks(snapshot *engine.JournalRecord, replayed *engine.JournalReplay) []string {
+	mismatches := make([]string, 0)
+	if snapshot.Halted != replayed.Halted {
+		mismatches = append(mismatches, fmt.Sprintf("halted: snapshot %t, replay %t", snapshot.Halted, replayed.Halted))
+	}
+
+	got := make(map[string]*domain.Order, len(replayed.Orders))
+	for _, order := range replayed.Orders {
+		got[order.ID] = order
+	}
+	for _, want := range snapshot.Orders {
+		order, ok := got[want.ID]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("order %s: missing from replay", want.ID))
+			continue
+		}
+		delete(got, want.ID)
+		if diff := diffOrder(want, order); diff != "" {
+			mismatches = append(mismatches, fmt.Sprintf("order %s: %s", want.ID, diff))
+		}
+	}
+	extra := make([]string, 0, len(got))
+	for id := range got {
+		extra = append(extra, id)
+	}
+	sort.Strings(extra)
+	for _, id := range extra {
+		mismatches = append(mismatches, fmt.Sprintf("order %s: not in snapshot", id))
+	}
+	return mismatches
+}
+
+func diffOrder(want, got *domain.Order) string {
+	type field struct {
+		name      string
+		want, got interface{}
+	}
+	for _, f := range []field{
+		{"user_id", want.UserID, got.UserID},
+		{"side", want.Side, got.Side},
+		{"type", want.Type, got.Type},
+		{"status", want.Status, got.Status},
+		{"price", want.Price, got.Price},
+		{"stop_price", want.StopPrice, got.StopPrice},
+		{"quantity", want.Quantity, got.Quantity},
+		{"filled_quantity", want.FilledQuantity, got.FilledQuantity},
+		{"remaining_qty", want.RemainingQty, got.RemainingQty},
+	} {
+		if f.want != f.got {
+			return fmt.Sprintf("%s is %v in the snapshot, %v in the replay", f.name, f.want, f.got)
+		}
+	}
+	return ""
+}
+
+// journalStore adapts JournalRepository to engine.JournalStore; replay only
+// reads
+type journalStore struct {
+	repo *repository.JournalRepository
+}
+
+func (s *journalStore) AppendJournal(ctx context.Context, records []*engine.JournalRecord) error {
+	return errors.New("replay does not write the journal")
+}
+
+func (s *journalStore) ReadJournal(ctx context.Context, symbol string, fromSeq uint64, fn func(*engine.JournalRecord) error) error {
+	return s.repo.ReadJournal(ctx, symbol, fromSeq, func(record *repository.JournalRecord) error {
+		return fn((*engine.JournalRecord)(record))
+	})
+}
+
+func (s *journalStore) SnapshotSeqs(ctx context.Context, symbol string) ([]uint64, error) {
+	return s.repo.SnapshotSeqs(ctx, symbol)
+}
+
+func (s *journalStore) LastJournalSeq(ctx context.Context, symbol string) (uint64, error) {
+	return s.repo.LastJournalSeq(ctx, symbol)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -2,23 +2,36 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/hft-exchange/backend/internal/accounts"
 	"github.com/hft-exchange/backend/internal/api"
 	"github.com/hft-exchange/backend/internal/bot"
 	"github.com/hft-exchange/backend/internal/cache"
+	"github.com/hft-exchange/backend/internal/candles"
+	"github.com/hft-exchange/backend/internal/capacity"
 	"github.com/hft-exchange/backend/internal/database"
 	"github.com/hft-exchange/backend/internal/domain"
 	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/idempotency"
+	"github.com/hft-exchange/backend/internal/notify"
+	"github.com/hft-exchange/backend/internal/orderfeed"
 	"github.com/hft-exchange/backend/internal/pricefeed"
+	"github.com/hft-exchange/backend/internal/replication"
 	"github.com/hft-exchange/backend/internal/repository"
+	"github.com/hft-exchange/backend/internal/subsystem"
+	"github.com/hft-exchange/backend/internal/tickerstats"
 	"github.com/hft-exchange/backend/internal/websocket"
 )
 
@@ -27,74 +40,444 @@ type balanceStoreAdapter struct {
 	repo *repository.BalanceRepository
 }
 
-func (a *balanceStoreAdapter) GetBalance(userID, asset string) (available, locked float64, err error) {
-	balance, err := a.repo.GetBalance(userID, asset)
+func (a *balanceStoreAdapter) GetBalance(ctx context.Context, userID, asset string) (available, locked float64, err error) {
+	balance, err := a.repo.GetBalance(ctx, userID, asset)
 	if err != nil {
 		return 0, 0, err
 	}
 	return balance.Available, balance.Locked, nil
 }
 
-func (a *balanceStoreAdapter) UpdateBalance(userID, asset string, available, locked float64) error {
-	return a.repo.UpdateBalance(userID, asset, available, locked)
+func (a *balanceStoreAdapter) SettleTrade(ctx context.Context, tradeID string, deltas []engine.BalanceDelta, fills []engine.PositionFill) ([]*domain.Position, error) {
+	repoDeltas := make([]repository.BalanceDelta, len(deltas))
+	for i, delta := range deltas {
+		repoDeltas[i] = repository.BalanceDelta(delta)
+	}
+	repoFills := make([]repository.PositionFill, len(fills))
+	for i, fill := range fills {
+		repoFills[i] = repository.PositionFill(fill)
+	}
+	positions, err := a.repo.Settle(ctx, tradeID, repoDeltas, repoFills)
+	if errors.Is(err, repository.ErrAlreadySettled) {
+		return nil, engine.ErrAlreadySettled
+	}
+	return positions, err
+}
+
+func (a *balanceStoreAdapter) LockBalance(ctx context.Context, userID, asset string, amount float64) error {
+	if err := a.repo.LockBalance(ctx, userID, asset, amount); err != nil {
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			return engine.ErrInsufficientBalance
+		}
+		return err
+	}
+	return nil
+}
+
+func (a *balanceStoreAdapter) UnlockBalance(ctx context.Context, userID, asset string, amount float64) error {
+	return a.repo.UnlockBalance(ctx, userID, asset, amount)
+}
+
+// ledgerStoreAdapter adapts BalanceRepository to engine.LedgerStore
+type ledgerStoreAdapter struct {
+	repo *repository.BalanceRepository
+}
+
+func (a *ledgerStoreAdapter) AdjustBalance(ctx context.Context, userID, asset string, delta float64, reason string) (*engine.LedgerEntry, error) {
+	entry, err := a.repo.AdjustBalance(ctx, userID, asset, delta, reason)
+	if err != nil {
+		return nil, ledgerError(err)
+	}
+	return (*engine.LedgerEntry)(entry), nil
+}
+
+func (a *ledgerStoreAdapter) Transfer(ctx context.Context, fromUser, toUser, asset string, amount float64, reason string) ([]*engine.LedgerEntry, error) {
+	stored, err := a.repo.Transfer(ctx, fromUser, toUser, asset, amount, reason)
+	if err != nil {
+		return nil, ledgerError(err)
+	}
+	entries := make([]*engine.LedgerEntry, len(stored))
+	for i, entry := range stored {
+		entries[i] = (*engine.LedgerEntry)(entry)
+	}
+	return entries, nil
+}
+
+func (a *ledgerStoreAdapter) Fund(ctx context.Context, userID, asset, kind string, amount, dailyLimit float64) (*engine.Funding, error) {
+	funding, err := a.repo.Fund(ctx, userID, asset, kind, amount, dailyLimit)
+	if err != nil {
+		return nil, ledgerError(err)
+	}
+	return (*engine.Funding)(funding), nil
+}
+
+func ledgerError(err error) error {
+	if errors.Is(err, repository.ErrInsufficientBalance) {
+		return engine.ErrInsufficientBalance
+	}
+	if errors.Is(err, repository.ErrWithdrawalLimit) {
+		return fmt.Errorf("%w%s", engine.ErrWithdrawalLimit, strings.TrimPrefix(err.Error(), repository.ErrWithdrawalLimit.Error()))
+	}
+	return err
+}
+
+// reconciliationStoreAdapter adapts ReconciliationRepository to
+// engine.ReconciliationStore
+type reconciliationStoreAdapter struct {
+	repo *repository.ReconciliationRepository
+}
+
+func (a *reconciliationStoreAdapter) AssetTotals(ctx context.Context) ([]*engine.AssetTotal, error) {
+	stored, err := a.repo.AssetTotals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	totals := make([]*engine.AssetTotal, len(stored))
+	for i, total := range stored {
+		totals[i] = (*engine.AssetTotal)(total)
+	}
+	return totals, nil
+}
+
+func (a *reconciliationStoreAdapter) SaveBalanceSnapshot(ctx context.Context, reconciliation *engine.Reconciliation) error {
+	snapshots := make([]*repository.BalanceSnapshot, len(reconciliation.Assets))
+	for i, asset := range reconciliation.Assets {
+		snapshots[i] = &repository.BalanceSnapshot{
+			TakenAt:   reconciliation.TakenAt,
+			Asset:     asset.Asset,
+			Available: asset.Available,
+			Locked:    asset.Locked,
+			Expected:  asset.Expected,
+			Drift:     asset.Drift,
+		}
+	}
+	return a.repo.SaveBalanceSnapshot(ctx, snapshots)
+}
+
+// hedgeStoreAdapter adapts HedgeRepository to bot.HedgeStore
+type hedgeStoreAdapter struct {
+	repo *repository.HedgeRepository
+}
+
+func (a *hedgeStoreAdapter) SaveHedge(ctx context.Context, hedge *bot.Hedge) error {
+	return a.repo.SaveHedge(ctx, (*repository.Hedge)(hedge))
+}
+
+// settlementStoreAdapter adapts SettlementRepository to engine.SettlementStore
+type settlementStoreAdapter struct {
+	repo *repository.SettlementRepository
+}
+
+func (a *settlementStoreAdapter) SavePendingSettlement(ctx context.Context, pending *engine.PendingSettlement) error {
+	return a.repo.SavePendingSettlement(ctx, &repository.PendingSettlement{
+		Trade:         pending.Trade,
+		Saved:         pending.Saved,
+		Attempts:      pending.Attempts,
+		LastError:     pending.LastError,
+		FirstFailedAt: pending.FirstFailedAt,
+	})
+}
+
+func (a *settlementStoreAdapter) DeletePendingSettlement(ctx context.Context, tradeID string) error {
+	return a.repo.DeletePendingSettlement(ctx, tradeID)
+}
+
+func (a *settlementStoreAdapter) GetPendingSettlements(ctx context.Context) ([]*engine.PendingSettlement, error) {
+	stored, err := a.repo.GetPendingSettlements(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]*engine.PendingSettlement, len(stored))
+	for i, p := range stored {
+		// Retry straight away; the outage may be long over
+		pending[i] = &engine.PendingSettlement{
+			Trade:         p.Trade,
+			Saved:         p.Saved,
+			Attempts:      p.Attempts,
+			LastError:     p.LastError,
+			FirstFailedAt: p.FirstFailedAt,
+		}
+	}
+	return pending, nil
+}
+
+// notificationStoreAdapter adapts NotificationRepository to
+// notify.SettingsStore
+type notificationStoreAdapter struct {
+	repo *repository.NotificationRepository
+}
+
+func (a *notificationStoreAdapter) GetSettings(ctx context.Context, userID string) (*notify.Settings, error) {
+	settings, err := a.repo.GetSettings(ctx, userID)
+	if err != nil || settings == nil {
+		return nil, err
+	}
+	return (*notify.Settings)(settings), nil
+}
+
+func (a *notificationStoreAdapter) SaveSettings(ctx context.Context, settings *notify.Settings) error {
+	return a.repo.SaveSettings(ctx, (*repository.NotificationSettings)(settings))
+}
+
+// riskProfileStoreAdapter adapts RiskProfileRepository to
+// engine.RiskProfileStore
+type riskProfileStoreAdapter struct {
+	repo *repository.RiskProfileRepository
+}
+
+func (a *riskProfileStoreAdapter) GetRiskProfiles(ctx context.Context) ([]*engine.RiskProfile, error) {
+	stored, err := a.repo.GetRiskProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]*engine.RiskProfile, len(stored))
+	for i, p := range stored {
+		profiles[i] = (*engine.RiskProfile)(p)
+	}
+	return profiles, nil
+}
+
+func (a *riskProfileStoreAdapter) SaveRiskProfile(ctx context.Context, profile *engine.RiskProfile) error {
+	return a.repo.SaveRiskProfile(ctx, (*repository.RiskProfile)(profile))
+}
+
+func (a *riskProfileStoreAdapter) DeleteRiskProfile(ctx context.Context, userID string) error {
+	return a.repo.DeleteRiskProfile(ctx, userID)
+}
+
+// tradingStatusStoreAdapter adapts TradingStatusRepository to
+// engine.TradingStatusStore
+type tradingStatusStoreAdapter struct {
+	repo *repository.TradingStatusRepository
+}
+
+func (a *tradingStatusStoreAdapter) GetTradingStatus(ctx context.Context) (*engine.TradingStatus, error) {
+	status, err := a.repo.GetTradingStatus(ctx)
+	if err != nil || status == nil {
+		return nil, err
+	}
+	return (*engine.TradingStatus)(status), nil
+}
+
+func (a *tradingStatusStoreAdapter) SaveTradingStatus(ctx context.Context, status *engine.TradingStatus) error {
+	return a.repo.SaveTradingStatus(ctx, (*repository.TradingStatus)(status))
+}
+
+// journalStoreAdapter adapts JournalRepository to engine.JournalStore
+type journalStoreAdapter struct {
+	repo *repository.JournalRepository
+}
+
+func (a *journalStoreAdapter) AppendJournal(ctx context.Context, records []*engine.JournalRecord) error {
+	stored := make([]*repository.JournalRecord, len(records))
+	for i, record := range records {
+		stored[i] = (*repository.JournalRecord)(record)
+	}
+	return a.repo.AppendJournal(ctx, stored)
+}
+
+func (a *journalStoreAdapter) ReadJournal(ctx context.Context, symbol string, fromSeq uint64, fn func(*engine.JournalRecord) error) error {
+	return a.repo.ReadJournal(ctx, symbol, fromSeq, func(record *repository.JournalRecord) error {
+		return fn((*engine.JournalRecord)(record))
+	})
+}
+
+func (a *journalStoreAdapter) SnapshotSeqs(ctx context.Context, symbol string) ([]uint64, error) {
+	return a.repo.SnapshotSeqs(ctx, symbol)
+}
+
+func (a *journalStoreAdapter) LastJournalSeq(ctx context.Context, symbol string) (uint64, error) {
+	return a.repo.LastJournalSeq(ctx, symbol)
+}
+
+// marketDataSource computes market data for cache misses and priming
+type marketDataSource struct {
+	exchange   *engine.Exchange
+	tickerRepo *repository.TickerRepository
+	tradeRepo  *repository.TradeRepository
+}
+
+func (s *marketDataSource) OrderBook(ctx context.Context, symbol string) (*domain.OrderBook, error) {
+	return s.exchange.GetOrderBook(symbol, cache.OrderBookDepth), nil
+}
+
+func (s *marketDataSource) Ticker(ctx context.Context, symbol string) (*domain.Ticker, error) {
+	return s.tickerRepo.GetTicker(ctx, symbol)
+}
+
+func (s *marketDataSource) RecentTrades(ctx context.Context, symbol string) ([]*domain.Trade, error) {
+	return s.tradeRepo.GetRecentTrades(ctx, symbol, cache.RecentTradesDepth, repository.TradeFilter{})
+}
+
+// broadcastRelay shares the hub's broadcasts with the other instances
+// through Redis pub/sub, and relays theirs to this instance's clients.
+// Broadcasts are published in order from one goroutine, so the trade and
+// order paths never wait on Redis.
+type broadcastRelay struct {
+	cache  *cache.RedisCache
+	hub    *websocket.Hub
+	origin string // tags this instance's broadcasts so it skips them
+	queue  chan websocket.Event
+}
+
+func newBroadcastRelay(redisCache *cache.RedisCache, hub *websocket.Hub) *broadcastRelay {
+	host, _ := os.Hostname()
+	return &broadcastRelay{
+		cache:  redisCache,
+		hub:    hub,
+		origin: fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano()),
+		queue:  make(chan websocket.Event, 4096),
+	}
+}
+
+// Publish queues a broadcast for the other instances, dropping it if Redis
+// has fallen that far behind
+func (r *broadcastRelay) Publish(event websocket.Event) {
+	select {
+	case r.queue <- event:
+	default:
+		log.Printf("❌ Broadcast relay queue full, %s not shared with other instances", event.Type)
+	}
 }
 
-// corsMiddleware adds CORS headers to responses
-func corsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			origin := r.Header.Get("Origin")
-			
-			// Check if origin is allowed
-			allowed := false
-			for _, allowedOrigin := range allowedOrigins {
-				if origin == allowedOrigin || allowedOrigin == "*" {
-					allowed = true
-					break
+// Run publishes queued broadcasts and relays other instances' ones until
+// ctx is done
+func (r *broadcastRelay) Run(ctx context.Context) {
+	go func() {
+		for {
+			err := r.cache.SubscribeBroadcasts(ctx, func(message *cache.BroadcastMessage) {
+				if message.Origin == r.origin {
+					return
 				}
+				r.hub.Relay(websocket.Event{Type: message.Type, Symbol: message.Symbol, Interval: message.Interval, UserID: message.UserID, Payload: message.Payload})
+			})
+			if ctx.Err() != nil {
+				return
 			}
-			
-			if allowed {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
+			log.Printf("❌ Broadcast relay subscription ended: %v; retrying", err)
+			time.Sleep(time.Second)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-r.queue:
+			message := &cache.BroadcastMessage{
+				Origin:   r.origin,
+				Type:     event.Type,
+				Symbol:   event.Symbol,
+				Interval: event.Interval,
+				UserID:   event.UserID,
+				Payload:  event.Payload,
 			}
-			
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Max-Age", "3600")
-			
-			// Handle preflight requests
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusNoContent)
-				return
+			if err := r.cache.PublishBroadcast(websocket.EventChannel(event.Type), message); err != nil {
+				log.Printf("❌ Failed to share %s broadcast: %v", event.Type, err)
 			}
-			
-			next.ServeHTTP(w, r)
-		})
+		}
 	}
 }
 
-// getAllowedOrigins returns a list of allowed CORS origins
-func getAllowedOrigins() []string {
-	origins := []string{
-		"http://localhost:3000",
-		"http://localhost:5173",
-		"http://localhost:8080",
-		"https://hft-exchange.example.com"	}
-	
-	// Add frontend URL from environment variable if set
-	if frontendURL := os.Getenv("FRONTEND_URL"); frontendURL != "" {
-		// Handle multiple URLs separated by comma
-		urls := strings.Split(frontendURL, ",")
-		for _, url := range urls {
-			trimmed := strings.TrimSpace(url)
-			if trimmed != "" {
-				origins = append(origins, trimmed)
-			}
+// recoverySource reads the state books are recovered from
+type recoverySource struct {
+	orderRepo *repository.OrderRepository
+	tradeRepo *repository.TradeRepository
+}
+
+func (s *recoverySource) GetOpenOrders(ctx context.Context, symbol string) ([]*domain.Order, error) {
+	return s.orderRepo.GetOpenOrders(ctx, symbol)
+}
+
+func (s *recoverySource) GetOpenOrderFills(ctx context.Context, symbol string) (map[string]domain.OrderFills, error) {
+	return s.tradeRepo.GetOpenOrderFills(ctx, symbol)
+}
+
+func (s *recoverySource) CountTradesSince(ctx context.Context, symbol string, since time.Time) (int, error) {
+	return s.tradeRepo.CountTradesSince(ctx, symbol, since)
+}
+
+// symbolManager lists and delists trading pairs across the exchange, the
+// database, the price feed and the market maker
+type symbolManager struct {
+	exchange       *engine.Exchange
+	symbolRepo     *repository.SymbolRepository
+	tickerRepo     *repository.TickerRepository
+	priceSimulator *pricefeed.PriceSimulator
+	marketMaker    *bot.MarketMaker
+}
+
+func (m *symbolManager) ListSymbol(ctx context.Context, config domain.SymbolConfig, initialPrice float64, marketMaker bool) error {
+	if err := m.exchange.ListSymbol(config); err != nil {
+		return err
+	}
+	if err := m.symbolRepo.SaveSymbol(ctx, config); err != nil {
+		return fmt.Errorf("%s is listed but won't survive a restart: %w", config.Symbol, err)
+	}
+
+	now := time.Now()
+	ticker := &domain.Ticker{
+		Symbol:    config.Symbol,
+		Price:     initialPrice,
+		High24h:   initialPrice,
+		Low24h:    initialPrice,
+		UpdatedAt: now,
+	}
+	if err := m.tickerRepo.CreateTicker(ctx, ticker); err != nil {
+		return err
+	}
+
+	m.priceSimulator.AddSymbol(config.Symbol, initialPrice)
+	if marketMaker {
+		m.marketMaker.AddSymbol(config.Symbol)
+	}
+	return nil
+}
+
+func (m *symbolManager) DelistSymbol(ctx context.Context, symbol string) (int, error) {
+	cancelled, err := m.exchange.DelistSymbol(symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	m.marketMaker.RemoveSymbol(symbol)
+	m.priceSimulator.RemoveSymbol(symbol)
+	if err := m.symbolRepo.DeleteSymbol(ctx, symbol); err != nil {
+		return cancelled, fmt.Errorf("%s is delisted but will return after a restart: %w", symbol, err)
+	}
+	return cancelled, nil
+}
+
+// getCORSConfig reads the CORS policy from CORS_ALLOWED_ORIGINS,
+// CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS and CORS_ADMIN_ORIGINS, each a
+// comma-separated list. Origins from FRONTEND_URL are allowed as well. In
+// production one of them must name the frontend: the localhost defaults
+// would turn away every browser, including on WebSocket upgrades.
+func getCORSConfig() (api.CORSConfig, error) {
+	config := api.DefaultCORSConfig()
+	origins, frontends := splitEnvList("CORS_ALLOWED_ORIGINS"), splitEnvList("FRONTEND_URL")
+	if len(origins) == 0 && len(frontends) == 0 && getEnv("ENVIRONMENT", "development") == "production" {
+		return config, fmt.Errorf("ENVIRONMENT=production needs CORS_ALLOWED_ORIGINS or FRONTEND_URL")
+	}
+	if len(origins) > 0 {
+		config.AllowedOrigins = origins
+	}
+	config.AllowedOrigins = append(config.AllowedOrigins, frontends...)
+	config.AllowedMethods = splitEnvList("CORS_ALLOWED_METHODS")
+	config.AllowedHeaders = splitEnvList("CORS_ALLOWED_HEADERS")
+	config.AdminOrigins = splitEnvList("CORS_ADMIN_ORIGINS")
+	return config, nil
+}
+
+// splitEnvList reads a comma-separated environment variable
+func splitEnvList(key string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			items = append(items, trimmed)
 		}
 	}
-	
-	return origins
+	return items
 }
 
 func main() {
@@ -102,8 +485,12 @@ func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using system environment variables")
 	}
+	// Startup and callbacks outside any request query with this; handlers
+	// use their request's context
+	ctx := context.Background()
 
 	// Database connection
+	repository.SetQueryTimeout(getQueryTimeout())
 	dbURL := getEnv("DATABASE_URL", "sqlite://./hft_exchange.db")
 	db, err := database.NewDB(dbURL)
 	if err != nil {
@@ -137,73 +524,387 @@ func main() {
 	tradeRepo := repository.NewTradeRepository(db.DB)
 	balanceRepo := repository.NewBalanceRepository(db.DB)
 	tickerRepo := repository.NewTickerRepository(db.DB)
+	positionRepo := repository.NewPositionRepository(db.DB)
+	candleRepo := repository.NewCandleRepository(db.DB)
+	symbolRepo := repository.NewSymbolRepository(db.DB)
+	settlementRepo := repository.NewSettlementRepository(db.DB)
+	notificationRepo := repository.NewNotificationRepository(db.DB)
+	capacityRepo := repository.NewCapacityRepository(db.DB)
+	riskProfileRepo := repository.NewRiskProfileRepository(db.DB)
+	journalRepo := repository.NewJournalRepository(db.DB)
+	hedgeRepo := repository.NewHedgeRepository(db.DB)
+	userRepo := repository.NewUserRepository(db.DB)
 
 	// Create balance store adapter
 	balanceStore := &balanceStoreAdapter{repo: balanceRepo}
 
 	// Initialize exchange
 	exchange := engine.NewExchange(tradeRepo, orderRepo, balanceStore)
+	exchange.SetRiskLimits(getRiskLimits())
+	if err := exchange.SetRiskProfileStore(&riskProfileStoreAdapter{repo: riskProfileRepo}); err != nil {
+		log.Fatalf("Failed to load risk profiles: %v", err)
+	}
+	exchange.SetSettlementStore(&settlementStoreAdapter{repo: settlementRepo})
+	exchange.SetJournalStore(&journalStoreAdapter{repo: journalRepo})
+	exchange.SetLedgerStore(&ledgerStoreAdapter{repo: balanceRepo})
+	exchange.SetWithdrawalLimits(getWithdrawalLimits())
+	exchange.SetReconciliationStore(&reconciliationStoreAdapter{repo: repository.NewReconciliationRepository(db.DB)})
+	if err := exchange.SetTradingStatusStore(&tradingStatusStoreAdapter{repo: repository.NewTradingStatusRepository(db.DB)}); err != nil {
+		log.Fatalf("Failed to load trading status: %v", err)
+	}
+	if err := exchange.SetDisabledUserStore(userRepo); err != nil {
+		log.Fatalf("Failed to load disabled users: %v", err)
+	}
+	exchange.SetOpenOrderSource(orderRepo)
+	exchange.SetStaleOrderPolicy(getStaleOrderPolicy())
+	exchange.SetVerifiedUserStore(userRepo)
+	symbolConfigs, err := loadSymbolConfigs(ctx, symbolRepo)
+	if err != nil {
+		log.Fatalf("Failed to load symbol configs: %v", err)
+	}
+	for _, config := range symbolConfigs {
+		if err := exchange.AddSymbol(config); err != nil {
+			log.Fatalf("Invalid symbol config: %v", err)
+		}
+	}
 	exchange.Start()
-	defer exchange.Stop()
+
+	// Rebuild books from the journal, busiest symbols first
+	exchange.Recover(&recoverySource{orderRepo: orderRepo, tradeRepo: tradeRepo}, getRecoveryParallelism())
+
+	// Optional warm-standby replication over Redis streams
+	var replicationController api.ReplicationController
+	switch role := getEnv("REPLICATION_ROLE", ""); role {
+	case "primary", "standby":
+		if redisCache == nil {
+			log.Fatalf("REPLICATION_ROLE=%s requires Redis", role)
+		}
+		leadership := replication.NewLeadership(redisCache)
+		if role == "primary" {
+			if _, err := leadership.Acquire(); err != nil {
+				log.Fatalf("Failed to acquire leadership: %v", err)
+			}
+			exchange.SetWriteFence(leadership.Check)
+			exchange.SetReplicator(replication.NewPublisher(redisCache, leadership))
+			replicationController = replication.NewPrimary(exchange, leadership)
+		} else {
+			standby := replication.NewStandby(redisCache, exchange, leadership)
+			standby.Start()
+			replicationController = standby
+		}
+	case "":
+	default:
+		log.Fatalf("Unknown REPLICATION_ROLE: %s", role)
+	}
 
 	// Initialize WebSocket hub (moved up to use in trade callback)
 	hub := websocket.NewHub()
+	hub.SetKeepalive(getPingInterval())
+	hub.SetCompression(getEnv("WS_COMPRESSION", "true") == "true")
+	hub.SetInboundLimits(getInboundLimits())
+	hub.SetConnectionLimits(getConnectionLimits())
+	hub.SetSymbolValidator(func(symbol string) bool {
+		_, listed := exchange.SymbolConfig(symbol)
+		return listed
+	})
 	go hub.Run()
+	// With Redis, every instance's clients see every instance's broadcasts,
+	// so the API can run behind a load balancer
+	if redisCache != nil {
+		relay := newBroadcastRelay(redisCache, hub)
+		hub.SetRelay(relay.Publish)
+		go relay.Run(ctx)
+	}
+
+	// Rolling 24h volume, price range and change for the tickers
+	tickerStats := tickerstats.NewTracker(tickerRepo, tradeRepo)
+	for _, config := range symbolConfigs {
+		if err := tickerStats.Load(ctx, config.Symbol); err != nil {
+			log.Printf("Failed to load 24h volume for %s: %v", config.Symbol, err)
+		}
+	}
+	tickerStats.Start()
+	defer tickerStats.Stop()
+
+	// Paper hedging of the market maker's inventory against the price feed
+	hedger := bot.NewHedger("market_maker", "user-3", &hedgeStoreAdapter{repo: hedgeRepo})
+	hedger.SetHedging(getFloatEnv("MM_HEDGE_NOTIONAL", 0), getFloatEnv("MM_HEDGE_SLIPPAGE_BPS", 5))
+
+	// Keep candles and daily stats in step with trades, streaming the
+	// forming klines to their subscribers
+	candleService := candles.NewService(candleRepo, exchange.GetAllSymbols)
+	candleService.SetOnKlineCallback(func(update candles.KlineUpdate) {
+		hub.BroadcastKline(&update.Kline, update.Correction)
+	})
+	hub.SetKlineIntervals(candles.Intervals)
+	candleService.Start()
+	defer candleService.Stop()
 
 	// Set up trade broadcasting callback
+	// Hot market data is read through Redis when it's available
+	var marketData *cache.MarketData
+	if redisCache != nil {
+		marketData = cache.NewMarketData(redisCache, &marketDataSource{
+			exchange:   exchange,
+			tickerRepo: tickerRepo,
+			tradeRepo:  tradeRepo,
+		})
+	}
+
+	// Subscribing to market data sends its current state straight away
+	// rather than leaving the client blank until the next tick
+	hub.SetSnapshot(websocket.ChannelOrderBook, func(symbol string) (interface{}, error) {
+		return exchange.PublishedOrderBook(symbol)
+	})
+	hub.SetSnapshot(websocket.ChannelBookTicker, func(symbol string) (interface{}, error) {
+		return exchange.BookTicker(symbol)
+	})
+	exchange.SetOnBookTickerCallback(hub.BroadcastBookTicker)
+	// Books are streamed, and cached, as trades and cancels move them
+	exchange.SetOnOrderBookCallback(func(diff *domain.OrderBookDiff) {
+		if redisCache != nil {
+			redisCache.CacheOrderBook(diff.Symbol, exchange.GetOrderBook(diff.Symbol, 20))
+		}
+		hub.BroadcastOrderBookDiff(diff)
+	})
+	hub.SetSnapshot(websocket.ChannelTicker, func(symbol string) (interface{}, error) {
+		if marketData != nil {
+			return marketData.Ticker(ctx, symbol)
+		}
+		return tickerRepo.GetTicker(ctx, symbol)
+	})
+	hub.SetSnapshot(websocket.ChannelTrades, func(symbol string) (interface{}, error) {
+		if marketData != nil {
+			if trades, ok := marketData.RecentTrades(symbol, websocket.SnapshotTrades); ok {
+				return trades, nil
+			}
+		}
+		return tradeRepo.GetRecentTrades(ctx, symbol, websocket.SnapshotTrades, repository.TradeFilter{})
+	})
+
 	exchange.SetOnTradeCallback(func(trade *domain.Trade) {
-		hub.BroadcastTrade(trade)
+		tickerStats.RecordTrade(trade)
+		hedger.RecordTrade(trade)
+		if marketData != nil {
+			marketData.RecordTrade(trade)
+		}
+		candleService.RecordTrade(trade)
+		hub.BroadcastTrade(trade.Symbol, trade)
+		hub.SendToUser(trade.BuyerID, "fill", domain.FillOf(trade, trade.BuyOrderID))
+		hub.SendToUser(trade.SellerID, "fill", domain.FillOf(trade, trade.SellOrderID))
+	})
+	exchange.SetOnPositionUpdateCallback(func(position *domain.Position) {
+		hub.SendToUser(position.UserID, "position", position)
+	})
+	// Fill and system-cancel alerts for users who opted in
+	notifications := newNotificationDispatcher(notificationRepo)
+	notifications.SetActivityStore(repository.NewActivityRepository(db.DB))
+	notifications.Start()
+	defer notifications.Stop()
+
+	// Numbers each user's order changes for long polling; published first so
+	// WebSocket updates carry the same user_seq
+	orderFeed := orderfeed.NewFeed()
+
+	// Each user's own updates go only to their authenticated connections
+	exchange.SetOnOrderUpdateCallback(func(order *domain.Order) {
+		orderFeed.Publish(order)
+		hub.SendToUser(order.UserID, "order_update", order)
+		notifications.NotifyOrderUpdate(order)
+	})
+	exchange.SetOnBalanceUpdateCallback(func(update *engine.BalanceUpdate) {
+		hub.SendToUser(update.UserID, "balance", update)
+	})
+	exchange.SetOnRiskWarningCallback(func(warning *engine.RiskWarning) {
+		hub.SendToUser(warning.UserID, "risk_warning", warning)
+	})
+	exchange.SetOnTradingStatusCallback(func(status *engine.TradingStatus) {
+		hub.BroadcastStatus(status)
+	})
+	exchange.SetOnSymbolStatusCallback(func(status *engine.SymbolStatus) {
+		hub.BroadcastSymbolStatus(status.Symbol, status)
+	})
+	hub.BroadcastStatus(exchange.TradingStatus())
+	// Halts, listings and maintenance go to everyone and are kept for
+	// clients that connect later; a user's own notices only to that user
+	exchange.SetNotificationStore(repository.NewSystemNotificationRepository(db.DB))
+	exchange.SetOnNotificationCallback(func(notification *domain.Notification) {
+		if notification.UserID != "" {
+			hub.SendToUser(notification.UserID, "notification", notification)
+			notifications.RecordActivity(notification)
+			return
+		}
+		hub.BroadcastNotification(notification)
 	})
 
 	// Initialize price simulator
 	priceSimulator := pricefeed.NewPriceSimulator(tickerRepo)
+	simulationSeed, seeded := getSimulationSeed()
+	if seeded {
+		priceSimulator.SetSeed(simulationSeed)
+	}
+	for _, config := range symbolConfigs {
+		priceSimulator.AddSymbol(config.Symbol, 0)
+	}
 	priceSimulator.Start()
-	defer priceSimulator.Stop()
 
 	// Connect price updates to exchange and websocket
 	priceSimulator.AddUpdateHandler(func(symbol string, price float64) {
 		exchange.UpdatePrice(symbol, price)
 		
 		// Get ticker and broadcast (DB is already updated by simulator)
-		if ticker, err := tickerRepo.GetTicker(symbol); err == nil {
+		if ticker, err := tickerRepo.GetTicker(ctx, symbol); err == nil {
 			hub.BroadcastTicker(ticker)
 		} else {
 			log.Printf("❌ Failed to get ticker %s: %v", symbol, err)
 		}
-		
-		// Cache and broadcast order book
-		orderBook := exchange.GetOrderBook(symbol, 20)
-		if redisCache != nil {
-			redisCache.CacheOrderBook(symbol, orderBook)
-		}
-		hub.BroadcastOrderBook(symbol, orderBook)
 	})
 
+	priceSimulator.AddUpdateHandler(hedger.UpdateReferencePrice)
+	priceSimulator.AddUpdateHandler(tickerStats.RecordPrice)
+
 	// Start market maker bot
 	marketMaker := bot.NewMarketMaker("user-3", exchange, priceSimulator)
+	if seeded {
+		marketMaker.SetSeed(simulationSeed + 1)
+	}
+	for _, config := range symbolConfigs {
+		marketMaker.AddSymbol(config.Symbol)
+	}
 	marketMaker.Start()
-	defer marketMaker.Stop()
 
 	// Trade broadcasting is now handled by the matching engine directly
 	// This polling approach was causing duplicate broadcasts
 
 	// Initialize API handlers
-	handler := api.NewHandler(exchange, orderRepo, tradeRepo, balanceRepo, tickerRepo)
-	router := api.NewRouter(handler, hub)
+	handler := api.NewHandler(exchange, orderRepo, tradeRepo, balanceRepo, tickerRepo, positionRepo)
+	if replicationController != nil {
+		handler.SetReplication(replicationController)
+	}
+	handler.SetCandles(candleService)
+	handler.SetHealthDependencies(db.DB, redisCache)
+	handler.SetBodyLimits(getByteLimit("MAX_ORDER_BODY_BYTES"), getByteLimit("MAX_BODY_BYTES"))
+	handler.SetSymbolManager(&symbolManager{
+		exchange:       exchange,
+		symbolRepo:     symbolRepo,
+		tickerRepo:     tickerRepo,
+		priceSimulator: priceSimulator,
+		marketMaker:    marketMaker,
+	})
 
-	// Get allowed origins and apply CORS middleware
-	allowedOrigins := getAllowedOrigins()
-	corsRouter := corsMiddleware(allowedOrigins)(router)
+	// Per-symbol resource usage, sampled daily for the capacity report
+	capacityPlanner := capacity.NewPlanner(capacityRepo, tradeRepo, exchange.SymbolUsage)
+	capacityPlanner.SetSubscribers(hub.SymbolSubscribers)
+	capacityPlanner.SetStaleOrders(exchange.StaleOrderStats)
+	handler.SetCapacity(capacityPlanner)
+
+	// Background components operators can stop and start while debugging
+	subsystems := subsystem.NewRegistry()
+	subsystems.Register("price_feed", "Simulated price updates for every symbol", priceSimulator)
+	subsystems.Register("market_maker", "Liquidity bot quoting as user-3", marketMaker)
+	subsystems.Register("candles", "Candle and daily stats rollover", candleService)
+	subsystems.Register("ticker_stats", "24h ticker stats written to tickers; trades and prices still counted while stopped", tickerStats)
+	subsystems.Register("broadcaster", "WebSocket broadcasts; dropped while stopped", subsystem.Funcs{
+		StartFunc: hub.Resume,
+		StopFunc:  hub.Pause,
+		StatsFunc: func() interface{} {
+			return map[string]interface{}{
+				"dropped":            hub.Dropped(),
+				"conflated":          hub.Conflated(),
+				"conflated_by_type":  hub.ConflatedByType(),
+				"overflowed":         hub.Overflowed(),
+				"slow_clients":       hub.SlowClients(),
+				"unrouted":           hub.Unrouted(),
+				"inbound_violations": hub.Violations(),
+				"limited_clients":    hub.LimitedClients(),
+				"throughput":         hub.Throughput(),
+				"connections":        hub.Connections(),
+			}
+		},
+	})
+	subsystems.Register("capacity_sampler", "Daily per-symbol capacity samples", capacityPlanner)
+	subsystems.Register("notifications", "Fill and cancellation alerts; queued while stopped", notifications)
+	handler.SetSubsystems(subsystems)
+	handler.SetNotifications(notifications)
+	handler.SetOrderFeed(orderFeed)
+	handler.SetBot("market_maker", hedger)
+
+	if window, err := time.ParseDuration(getEnv("ORDERBOOK_REPLAY_WINDOW", "24h")); err == nil {
+		handler.SetReplayWindow(window)
+	} else {
+		log.Printf("Warning: invalid ORDERBOOK_REPLAY_WINDOW: %v", err)
+	}
+	// Warm the market data cache before accepting traffic so the first wave of
+	// clients doesn't stampede the engine and database
+	if marketData != nil {
+		marketData.Prime(ctx, exchange.GetAllSymbols())
+		handler.SetMarketData(marketData)
+		if value := os.Getenv("ORDERBOOK_CACHE_MAX_AGE"); value != "" {
+			if maxAge, err := time.ParseDuration(value); err == nil && maxAge >= 0 {
+				handler.SetOrderBookMaxAge(maxAge)
+			} else {
+				log.Printf("Warning: invalid ORDERBOOK_CACHE_MAX_AGE %q, using %s", value, api.DefaultOrderBookMaxAge)
+			}
+		}
+		capacityPlanner.SetCacheHitRate(marketData.SymbolHitRate)
+	}
+	capacityPlanner.Start()
+	defer capacityPlanner.Stop()
+	auth, err := getAuth()
+	if err != nil {
+		log.Fatalf("Invalid auth config: %v", err)
+	}
+	accountService, err := accounts.NewService(userRepo, os.Getenv("JWT_SECRET"))
+	if err != nil {
+		log.Fatalf("Failed to set up accounts: %v", err)
+	}
+	if value := os.Getenv("JWT_TTL"); value != "" {
+		if ttl, err := time.ParseDuration(value); err == nil && ttl > 0 {
+			accountService.SetTokenTTL(ttl)
+		} else {
+			log.Printf("Warning: invalid JWT_TTL %q, using %s", value, accounts.DefaultTokenTTL)
+		}
+	}
+	auth.SetTokens(accountService)
+	hub.SetTokenVerifier(accountService.Verify)
+	handler.SetAccounts(accountService)
+	handler.SetUsers(userRepo)
+	if redisCache != nil {
+		handler.SetIdempotency(idempotency.NewRedisStore(redisCache, idempotency.DefaultTTL))
+	} else {
+		// Without Redis, keys are only remembered by this server, and only
+		// the most recent ones
+		handler.SetIdempotency(idempotency.NewMemoryStore(10000, idempotency.DefaultTTL))
+	}
+	if value := os.Getenv("SLOW_REQUEST_THRESHOLD"); value != "" {
+		if threshold, err := time.ParseDuration(value); err == nil && threshold > 0 {
+			handler.SetSlowRequestThreshold(threshold)
+		} else {
+			log.Printf("Warning: invalid SLOW_REQUEST_THRESHOLD %q, using %s", value, api.DefaultSlowRequest)
+		}
+	}
+	handler.SetAuth(auth)
+	corsConfig, err := getCORSConfig()
+	if err != nil {
+		log.Fatalf("Invalid CORS config: %v", err)
+	}
+	handler.SetCORS(corsConfig)
+	// The proxy's header for client addresses, e.g. X-Forwarded-For
+	handler.SetTrustedProxyHeader(os.Getenv("TRUSTED_PROXY_HEADER"))
+	router := api.NewRouter(handler, hub)
 
 	// HTTP server
 	port := getEnv("PORT", "8080")
 	server := &http.Server{
 		Addr:         ":" + port,
-		Handler:      corsRouter,
+		Handler:      router,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	// Event streams lift their own write deadline and would otherwise hold
+	// shutdown open until it times out
+	server.RegisterOnShutdown(hub.CloseSubscribers)
 
 	// Start server
 	go func() {
@@ -219,12 +920,25 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	// Exiting here would skip the exchange's drain of unpersisted trades
+	// and the deferred Stops of the services it feeds
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
 	}
+	// WebSocket connections are hijacked, so server.Shutdown leaves them to
+	// the hub, which closes them before the exchange stops
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		log.Printf("WebSocket clients forced to close: %v", err)
+	}
+	// Stop what feeds the exchange orders and prices, then drain it while
+	// the candle, 24h stats and notification services it hands trades to
+	// are still running; their deferred Stops come after
+	marketMaker.Stop()
+	priceSimulator.Stop()
+	exchange.Stop()
 
 	log.Println("Server exited")
 }
@@ -234,4 +948,281 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// getSimulationSeed reads SIMULATION_SEED, which makes the simulated price
+// path and market maker quotes repeat across restarts
+func getSimulationSeed() (int64, bool) {
+	value := os.Getenv("SIMULATION_SEED")
+	if value == "" {
+		return 0, false
+	}
+	seed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Printf("Warning: invalid SIMULATION_SEED %q: %v", value, err)
+		return 0, false
+	}
+	return seed, true
+}
+
+// loadSymbolConfigs reads the listed trading pairs from the JSON file named by
+// SYMBOLS_CONFIG, or from the symbols table when it is unset
+func loadSymbolConfigs(ctx context.Context, repo *repository.SymbolRepository) ([]domain.SymbolConfig, error) {
+	path := os.Getenv("SYMBOLS_CONFIG")
+	if path == "" {
+		return repo.GetAllSymbols(ctx)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []domain.SymbolConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return configs, nil
+}
+
+// newNotificationDispatcher sets up the notification sinks. The console sink
+// is always available; file and e-mail delivery are enabled by env config.
+func newNotificationDispatcher(repo *repository.NotificationRepository) *notify.Dispatcher {
+	dispatcher := notify.NewDispatcher(&notificationStoreAdapter{repo: repo})
+	dispatcher.AddSink("console", notify.ConsoleSink{})
+	if path := getEnv("NOTIFY_FILE_PATH", ""); path != "" {
+		dispatcher.AddSink("file", notify.NewFileSink(path))
+	}
+	if host := getEnv("NOTIFY_SMTP_HOST", ""); host != "" {
+		dispatcher.AddSink("email", notify.NewSMTPSink(notify.SMTPConfig{
+			Host:     host,
+			Port:     getEnv("NOTIFY_SMTP_PORT", "587"),
+			Username: getEnv("NOTIFY_SMTP_USERNAME", ""),
+			Password: getEnv("NOTIFY_SMTP_PASSWORD", ""),
+			From:     getEnv("NOTIFY_SMTP_FROM", "alerts@hft-exchange.local"),
+		}))
+	}
+	log.Printf("Notification sinks: %v", dispatcher.Sinks())
+	return dispatcher
+}
+
+// getAuth builds API key checking from API_KEYS. Callers without a key get
+// ANONYMOUS_SCOPE, which defaults to market data. AUTH_DEV_MODE=true raises
+// the default to admin and lets anonymous callers name their user with
+// ?user_id=, for the demo frontend run locally; it is refused in production.
+func getAuth() (*api.Auth, error) {
+	keys, err := api.ParseAPIKeys(os.Getenv("API_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+	devMode := getEnv("AUTH_DEV_MODE", "false") == "true"
+	defaultScope := api.ScopeMarketData
+	if devMode {
+		if getEnv("ENVIRONMENT", "development") == "production" {
+			return nil, fmt.Errorf("AUTH_DEV_MODE=true lets anonymous callers act for any user; it is refused with ENVIRONMENT=production")
+		}
+		defaultScope = api.ScopeAdmin
+	}
+	anonymous, err := api.ParseScope(getEnv("ANONYMOUS_SCOPE", string(defaultScope)))
+	if err != nil {
+		return nil, fmt.Errorf("ANONYMOUS_SCOPE: %w", err)
+	}
+	auth := api.NewAuth(keys, anonymous, getFloatEnv("ANONYMOUS_RATE_LIMIT", 0))
+	auth.SetDevMode(devMode)
+	return auth, nil
+}
+
+// getFloatEnv reads a non-negative number, falling back to defaultValue
+func getFloatEnv(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		log.Printf("Warning: invalid %s %q, using %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getByteLimit reads a request body cap; unset or invalid keeps the default
+func getByteLimit(key string) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		log.Printf("Warning: invalid %s %q, using the default", key, value)
+		return 0
+	}
+	return n
+}
+
+// getRecoveryParallelism reads how many symbols may load from the database at
+// once during recovery
+func getRecoveryParallelism() int {
+	value := os.Getenv("RECOVERY_PARALLELISM")
+	if value == "" {
+		return 4
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("Warning: invalid RECOVERY_PARALLELISM %q, using 4", value)
+		return 4
+	}
+	return n
+}
+
+// getQueryTimeout reads the default database query timeout from
+// DB_QUERY_TIMEOUT (default 10s, 0 for none). Queries whose caller set a
+// deadline keep it.
+func getQueryTimeout() time.Duration {
+	value := os.Getenv("DB_QUERY_TIMEOUT")
+	if value == "" {
+		return 10 * time.Second
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		log.Printf("Warning: invalid DB_QUERY_TIMEOUT %q, using 10s", value)
+		return 10 * time.Second
+	}
+	return timeout
+}
+
+// getPingInterval reads how often WebSocket clients are pinged
+// (WS_PING_INTERVAL, default 30s)
+func getPingInterval() time.Duration {
+	value := os.Getenv("WS_PING_INTERVAL")
+	if value == "" {
+		return websocket.DefaultPingInterval
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("Warning: invalid WS_PING_INTERVAL %q, using %s", value, websocket.DefaultPingInterval)
+		return websocket.DefaultPingInterval
+	}
+	return interval
+}
+
+// getInboundLimits reads what one WebSocket client may send: messages of up
+// to WS_MAX_MESSAGE_BYTES, WS_MESSAGE_RATE a second (0 = unlimited) in bursts
+// of WS_MESSAGE_BURST, and WS_MAX_VIOLATIONS messages over that rate before
+// it is disconnected (0 = never)
+func getInboundLimits() websocket.InboundLimits {
+	limits := websocket.DefaultInboundLimits
+	if n := getByteLimit("WS_MAX_MESSAGE_BYTES"); n > 0 {
+		limits.MaxMessageSize = n
+	}
+	limits.Rate = getFloatEnv("WS_MESSAGE_RATE", limits.Rate)
+	limits.Burst = getFloatEnv("WS_MESSAGE_BURST", limits.Burst)
+	limits.MaxViolations = int(getFloatEnv("WS_MAX_VIOLATIONS", float64(limits.MaxViolations)))
+	return limits
+}
+
+// getConnectionLimits reads how many WebSocket clients may connect
+// (WS_MAX_CONNECTIONS), how many from one address
+// (WS_MAX_CONNECTIONS_PER_IP) and how many new ones a second are accepted
+// (WS_ACCEPT_RATE, in bursts of WS_ACCEPT_BURST); 0 lifts a limit
+func getConnectionLimits() websocket.ConnectionLimits {
+	limits := websocket.DefaultConnectionLimits
+	limits.MaxConnections = int(getFloatEnv("WS_MAX_CONNECTIONS", float64(limits.MaxConnections)))
+	limits.MaxPerAddress = int(getFloatEnv("WS_MAX_CONNECTIONS_PER_IP", float64(limits.MaxPerAddress)))
+	limits.AcceptRate = getFloatEnv("WS_ACCEPT_RATE", limits.AcceptRate)
+	limits.AcceptBurst = getFloatEnv("WS_ACCEPT_BURST", limits.AcceptBurst)
+	return limits
+}
+
+// getStaleOrderPolicy reads how many days a GTC order may rest untouched
+// (STALE_ORDER_DAYS, default 30, 0 to keep orders forever)
+func getStaleOrderPolicy() engine.StaleOrderPolicy {
+	days := 30
+	if value := os.Getenv("STALE_ORDER_DAYS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			days = n
+		} else {
+			log.Printf("Warning: invalid STALE_ORDER_DAYS %q, using %d", value, days)
+		}
+	}
+	return engine.StaleOrderPolicy{MaxAge: time.Duration(days) * 24 * time.Hour}
+}
+
+// getWithdrawalLimits reads per-asset daily withdrawal caps from
+// WITHDRAWAL_DAILY_LIMITS, e.g. "BTC=2,USDT=100000". Assets left out are
+// unlimited.
+func getWithdrawalLimits() map[string]float64 {
+	limits := make(map[string]float64)
+	for _, pair := range strings.Split(os.Getenv("WITHDRAWAL_DAILY_LIMITS"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		asset, value, _ := strings.Cut(pair, "=")
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || n <= 0 {
+			log.Printf("Warning: invalid WITHDRAWAL_DAILY_LIMITS entry %q, ignoring it", pair)
+			continue
+		}
+		limits[strings.ToUpper(strings.TrimSpace(asset))] = n
+	}
+	return limits
+}
+
+// getRiskLimits reads the default per-user limits. Notional caps default to
+// retail-sized values; other unset or invalid values leave a limit off, and 0
+// turns any limit off.
+func getRiskLimits() engine.RiskLimits {
+	limits := engine.RiskLimits{
+		MaxOrderNotional: 50000,
+		MaxOpenNotional:  100000,
+	}
+	if value := os.Getenv("RISK_MAX_OPEN_ORDERS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			limits.MaxOpenOrders = n
+		} else {
+			log.Printf("Warning: invalid RISK_MAX_OPEN_ORDERS %q: %v", value, err)
+		}
+	}
+	if value := os.Getenv("RISK_MAX_POSITION"); value != "" {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			limits.MaxPosition = n
+		} else {
+			log.Printf("Warning: invalid RISK_MAX_POSITION %q: %v", value, err)
+		}
+	}
+	if value := os.Getenv("RISK_MAX_DAILY_ORDERS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			limits.MaxDailyOrders = n
+		} else {
+			log.Printf("Warning: invalid RISK_MAX_DAILY_ORDERS %q: %v", value, err)
+		}
+	}
+	if value := os.Getenv("RISK_MAX_ORDER_NOTIONAL"); value != "" {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			limits.MaxOrderNotional = n
+		} else {
+			log.Printf("Warning: invalid RISK_MAX_ORDER_NOTIONAL %q: %v", value, err)
+		}
+	}
+	if value := os.Getenv("RISK_MAX_OPEN_NOTIONAL"); value != "" {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			limits.MaxOpenNotional = n
+		} else {
+			log.Printf("Warning: invalid RISK_MAX_OPEN_NOTIONAL %q: %v", value, err)
+		}
+	}
+	if value := os.Getenv("RISK_SOFT_FRACTION"); value != "" {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			limits.SoftFraction = n
+		} else {
+			log.Printf("Warning: invalid RISK_SOFT_FRACTION %q: %v", value, err)
+		}
+	}
+	if value := os.Getenv("RISK_WARNING_INTERVAL"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			limits.WarningInterval = d
+		} else {
+			log.Printf("Warning: invalid RISK_WARNING_INTERVAL %q: %v", value, err)
+		}
+	}
+	return limits
+}
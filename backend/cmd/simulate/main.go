@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hft-exchange/backend/internal/bot"
+	"github.com/hft-exchange/backend/internal/clock"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/pricefeed"
+)
+
+// simulationStart is the virtual instant every run begins at
+var simulationStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// simulate runs the exchange, price feed and market maker against a virtual
+// clock and in-memory stores, writing every trade to stdout as a JSON line.
+// The same seed and duration always produce byte-identical output.
+func main() {
+	seed := flag.Int64("seed", 1, "seed for every random source")
+	duration := flag.Duration("duration", time.Hour, "virtual time to simulate")
+	takerInterval := flag.Duration("taker-interval", 5*time.Second, "how often the taker sends a market order (0 disables it)")
+	flag.Parse()
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	started := time.Now()
+	trades := simulate(out, *seed, *duration, *takerInterval)
+	log.Printf("Simulated %s in %s: %d trades", *duration, time.Since(started), trades)
+}
+
+// simulate runs one simulation, writing its trades to w, and returns how
+// many there were
+func simulate(w io.Writer, seed int64, duration, takerInterval time.Duration) int {
+	vclock := clock.NewVirtual(simulationStart)
+	domain.Now = vclock.Now
+	domain.NewID = seededIDs(seed)
+
+	store := newMemoryStore()
+	for _, user := range []string{"user-1", "user-3"} {
+		store.Deposit(user, "USD", 100000000.0)
+		store.Deposit(user, "BTC", 1000.0)
+		store.Deposit(user, "ETH", 10000.0)
+		store.Deposit(user, "SOL", 100000.0)
+		store.Deposit(user, "USDC", 50000000.0)
+	}
+	for symbol, price := range map[string]float64{"BTC-USD": 45000.0, "ETH-USD": 2500.0, "SOL-USD": 100.0, "USDC-USD": 1.0} {
+		store.UpdateTicker(context.Background(), &domain.Ticker{Symbol: symbol, Price: price, High24h: price, Low24h: price, UpdatedAt: simulationStart})
+	}
+
+	encoder := json.NewEncoder(w)
+
+	exchange := engine.NewExchange(store, store, store)
+	exchange.SetClock(vclock)
+	exchange.SetOnTradeCallback(func(trade *domain.Trade) {
+		if err := encoder.Encode(trade); err != nil {
+			log.Fatalf("Failed to write trade: %v", err)
+		}
+	})
+	for _, config := range domain.DefaultSymbolConfigs() {
+		if err := exchange.AddSymbol(config); err != nil {
+			log.Fatalf("Failed to list %s: %v", config.Symbol, err)
+		}
+	}
+	exchange.Start()
+	defer exchange.Stop()
+
+	priceSimulator := pricefeed.NewPriceSimulator(store)
+	priceSimulator.SetClock(vclock)
+	priceSimulator.SetSeed(seed)
+	priceSimulator.AddUpdateHandler(exchange.UpdatePrice)
+	for _, symbol := range exchange.GetAllSymbols() {
+		priceSimulator.AddSymbol(symbol, 0)
+	}
+	priceSimulator.Start()
+	defer priceSimulator.Stop()
+
+	marketMaker := bot.NewMarketMaker("user-3", exchange, priceSimulator)
+	marketMaker.SetClock(vclock)
+	marketMaker.SetSeed(seed + 1)
+	for _, symbol := range exchange.GetAllSymbols() {
+		marketMaker.AddSymbol(symbol)
+	}
+	marketMaker.Start()
+	defer marketMaker.Stop()
+
+	if takerInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		rng := rand.New(rand.NewSource(seed + 2))
+		vclock.Every(ctx, takerInterval, func() { takeLiquidity(exchange, rng) })
+	}
+
+	vclock.Advance(duration)
+	return len(store.trades)
+}
+
+// takeLiquidity sends a small market order on a random side of a random symbol
+func takeLiquidity(exchange *engine.Exchange, rng *rand.Rand) {
+	symbols := []string{"BTC-USD", "ETH-USD", "SOL-USD"}
+	symbol := symbols[rng.Intn(len(symbols))]
+	side := domain.OrderSideBuy
+	if rng.Intn(2) == 1 {
+		side = domain.OrderSideSell
+	}
+
+	config, _ := exchange.SymbolConfig(symbol)
+	quantity := math.Max(config.RoundQuantity(0.005*(1+rng.Float64())), config.LotSize)
+	order := domain.NewOrder("user-1", symbol, side, domain.OrderTypeMarket, quantity, 0)
+	if err := exchange.SubmitOrder(context.Background(), order); err != nil {
+		log.Printf("Taker order rejected: %v", err)
+	}
+}
+
+// seededIDs returns an ID generator producing the same UUID sequence for a seed
+func seededIDs(seed int64) func() string {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+	return func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return uuid.Must(uuid.NewRandomFromReader(rng)).String()
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// Running the same seed twice writes byte-identical trades, and another
+// seed writes different ones
+func TestSimulationIsRepeatable(t *testing.T) {
+	now, newID := domain.Now, domain.NewID
+	t.Cleanup(func() { domain.Now, domain.NewID = now, newID })
+
+	run := func(seed int64) []byte {
+		var out bytes.Buffer
+		if trades := simulate(&out, seed, 10*time.Minute, 5*time.Second); trades == 0 {
+			t.Fatalf("seed %d: no trades", seed)
+		}
+		return out.Bytes()
+	}
+
+	first := run(7)
+	if second := run(7); !bytes.Equal(first, second) {
+		t.Fatalf("seed 7 wrote %d bytes, then %d different ones", len(first), len(second))
+	}
+	if other := run(8); bytes.Equal(first, other) {
+		t.Error("seeds 7 and 8 wrote the same trades")
+	}
+}
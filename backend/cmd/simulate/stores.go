@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// memoryStore keeps orders, trades, balances and tickers in memory so a
+// simulation needs no database and starts from the same state every run
+type memoryStore struct {
+	mu        sync.Mutex
+	orders    map[string]*domain.Order
+	trades    map[string]bool
+	settled   map[string]bool
+	balances  map[string]*[2]float64 // available, locked
+	positions map[string]*domain.Position
+	tickers   map[string]*domain.Ticker
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		orders:    make(map[string]*domain.Order),
+		trades:    make(map[string]bool),
+		settled:   make(map[string]bool),
+		balances:  make(map[string]*[2]float64),
+		positions: make(map[string]*domain.Position),
+		tickers:   make(map[string]*domain.Ticker),
+	}
+}
+
+func (s *memoryStore) balance(userID, asset string) *[2]float64 {
+	key := userID + "/" + asset
+	b, ok := s.balances[key]
+	if !ok {
+		b = &[2]float64{}
+		s.balances[key] = b
+	}
+	return b
+}
+
+func (s *memoryStore) Deposit(userID, asset string, amount float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balance(userID, asset)[0] += amount
+}
+
+func (s *memoryStore) SaveTrade(_ context.Context, trade *domain.Trade) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.trades[trade.ID] {
+		return false, nil
+	}
+	s.trades[trade.ID] = true
+	return true, nil
+}
+
+func (s *memoryStore) SaveOrder(_ context.Context, order *domain.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *order
+	s.orders[order.ID] = &copied
+	return nil
+}
+
+func (s *memoryStore) UpdateOrder(ctx context.Context, order *domain.Order) error {
+	return s.SaveOrder(ctx, order)
+}
+
+func (s *memoryStore) GetOrderByID(_ context.Context, orderID string) (*domain.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, ok := s.orders[orderID]
+	if !ok {
+		return nil, fmt.Errorf("order not found: %s", orderID)
+	}
+	copied := *order
+	return &copied, nil
+}
+
+func (s *memoryStore) GetBalance(_ context.Context, userID, asset string) (available, locked float64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.balance(userID, asset)
+	return b[0], b[1], nil
+}
+
+func (s *memoryStore) SettleTrade(_ context.Context, tradeID string, deltas []engine.BalanceDelta, fills []engine.PositionFill) ([]*domain.Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.settled[tradeID] {
+		return nil, engine.ErrAlreadySettled
+	}
+	s.settled[tradeID] = true
+	for _, delta := range deltas {
+		b := s.balance(delta.UserID, delta.Asset)
+		b[0] += delta.Available
+		b[1] += delta.Locked
+	}
+
+	positions := make([]*domain.Position, 0, len(fills))
+	for _, fill := range fills {
+		key := fill.UserID + "/" + fill.Symbol
+		position, ok := s.positions[key]
+		if !ok {
+			position = &domain.Position{UserID: fill.UserID, Symbol: fill.Symbol}
+			s.positions[key] = position
+		}
+		position.ApplyFill(fill.Quantity, fill.Price)
+		position.UpdatedAt = domain.Now()
+		copied := *position
+		positions = append(positions, &copied)
+	}
+	return positions, nil
+}
+
+func (s *memoryStore) LockBalance(_ context.Context, userID, asset string, amount float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.balance(userID, asset)
+	if b[0] < amount {
+		return engine.ErrInsufficientBalance
+	}
+	b[0] -= amount
+	b[1] += amount
+	return nil
+}
+
+func (s *memoryStore) UnlockBalance(_ context.Context, userID, asset string, amount float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.balance(userID, asset)
+	b[0] += amount
+	b[1] -= amount
+	return nil
+}
+
+func (s *memoryStore) GetTicker(_ context.Context, symbol string) (*domain.Ticker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ticker, ok := s.tickers[symbol]
+	if !ok {
+		return nil, fmt.Errorf("ticker not found: %s", symbol)
+	}
+	copied := *ticker
+	return &copied, nil
+}
+
+func (s *memoryStore) UpdateTicker(_ context.Context, ticker *domain.Ticker) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *ticker
+	s.tickers[ticker.Symbol] = &copied
+	return nil
+}
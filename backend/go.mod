@@ -3,6 +3,7 @@ module github.com/hft-exchange/backend
 go 1.21
 
 require (
+	github.com/golang-jwt/jwt/v5 v5.2.3
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.1
 	github.com/gorilla/websocket v1.5.1
@@ -10,6 +11,7 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/redis/go-redis/v9 v9.5.1
 	github.com/rs/cors v1.11.1
+	golang.org/x/crypto v0.18.0
 	modernc.org/sqlite v1.28.0
 )
 
@@ -0,0 +1,123 @@
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidCredentials is returned for a wrong username or password;
+	// which of the two is deliberately not said
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrInvalidToken is returned for session tokens that are malformed,
+	// forged or expired
+	ErrInvalidToken = errors.New("invalid or expired token")
+)
+
+// DefaultTokenTTL is how long a login's token is valid by default
+const DefaultTokenTTL = 24 * time.Hour
+
+// Service registers users and issues and verifies their session tokens,
+// HS256 JWTs whose subject is the user ID
+type Service struct {
+	users  *repository.UserRepository
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewService signs tokens with secret. Without one, a random secret is
+// generated, so tokens don't outlive the process.
+func NewService(users *repository.UserRepository, secret string) (*Service, error) {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate token secret: %w", err)
+		}
+		log.Println("Warning: JWT_SECRET is not set; sessions end when the server restarts")
+	}
+	return &Service{users: users, secret: key, ttl: DefaultTokenTTL}, nil
+}
+
+// SetTokenTTL sets how long new tokens are valid
+func (s *Service) SetTokenTTL(ttl time.Duration) {
+	if ttl > 0 {
+		s.ttl = ttl
+	}
+}
+
+// Register creates a user with a hashed password and the starter balances.
+// It returns repository.ErrUserExists if the username or email is taken.
+func (s *Service) Register(ctx context.Context, username, email, password string) (*domain.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &domain.User{
+		ID:        uuid.New().String(),
+		Username:  username,
+		Email:     email,
+		CreatedAt: domain.Now(),
+	}
+	if err := s.users.CreateUser(ctx, user, string(hash), domain.StarterBalances); err != nil {
+		return nil, err
+	}
+	log.Printf("Registered user %s (%s)", user.Username, user.ID)
+	return user, nil
+}
+
+// Session is a login's token and when it expires
+type Session struct {
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	User      *domain.User `json:"user"`
+}
+
+// Login checks a username and password and issues a token for the user
+func (s *Service) Login(ctx context.Context, username, password string) (*Session, error) {
+	user, hash, err := s.users.GetCredentials(ctx, username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := domain.Now()
+	expires := now.Add(s.ttl)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   user.ID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expires),
+	}).SignedString(s.secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign token: %w", err)
+	}
+	return &Session{Token: token, ExpiresAt: expires, User: user}, nil
+}
+
+// Verify returns the user ID a token was issued to and when it expires
+func (s *Service) Verify(token string) (string, time.Time, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithTimeFunc(domain.Now))
+	if err != nil || claims.Subject == "" || claims.ExpiresAt == nil {
+		return "", time.Time{}, ErrInvalidToken
+	}
+	return claims.Subject, claims.ExpiresAt.Time, nil
+}
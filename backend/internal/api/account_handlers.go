@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/hft-exchange/backend/internal/accounts"
+	"github.com/hft-exchange/backend/internal/apierror"
+)
+
+// SetAccounts enables registration and login
+func (h *Handler) SetAccounts(service *accounts.Service) {
+	h.accounts = service
+}
+
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Register creates a user, who starts with the same balances as the demo
+// users
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+	if h.accounts == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Registration is not enabled"))
+		return
+	}
+
+	var req RegisterRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+	if errs := req.Validate(); len(errs) > 0 {
+		respondInvalid(w, errs)
+		return
+	}
+
+	user, err := h.accounts.Register(r.Context(), req.Username, req.Email, req.Password)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, Response{Success: true, Data: user})
+}
+
+// Login exchanges a username and password for a session token
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	if h.accounts == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Login is not enabled"))
+		return
+	}
+
+	var req LoginRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+
+	session, err := h.accounts.Login(r.Context(), req.Username, req.Password)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: session})
+}
@@ -0,0 +1,532 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/bot"
+	"github.com/hft-exchange/backend/internal/candles"
+	"github.com/hft-exchange/backend/internal/capacity"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/subsystem"
+)
+
+func (h *Handler) RunEngineSelfCheck(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	symbol := vars["symbol"]
+
+	report, ok := h.exchange.RunSelfCheck(symbol)
+	if !ok {
+		respondError(w, apierror.New(apierror.UnknownSymbol, "Unknown symbol: %s", symbol))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: report})
+}
+
+// GetPendingSettlements lists trades whose persistence or settlement is
+// still being retried, with the retry queue's counters
+func (h *Handler) GetPendingSettlements(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: map[string]interface{}{
+		"stats":   h.exchange.SettlementStats(),
+		"pending": h.exchange.PendingSettlements(),
+	}})
+}
+
+// GetOpenOrderIndex reports the open-orders index's size and how often
+// sampled users' indexed orders disagreed with the database
+func (h *Handler) GetOpenOrderIndex(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: h.exchange.OpenOrderIndexStats()})
+}
+
+// GetRiskProfiles lists the default limits and every user's own profile
+func (h *Handler) GetRiskProfiles(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: map[string]interface{}{
+		"defaults": h.exchange.DefaultRiskProfile(),
+		"profiles": h.exchange.RiskProfiles(),
+	}})
+}
+
+// GetRiskProfile returns the limits a user's orders are checked against
+func (h *Handler) GetRiskProfile(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: h.exchange.EffectiveRiskProfile(mux.Vars(r)["userId"])})
+}
+
+// UpdateRiskProfile gives a user their own limits, replacing the defaults.
+// Zero leaves a limit off for that user.
+func (h *Handler) UpdateRiskProfile(w http.ResponseWriter, r *http.Request) {
+	var profile engine.RiskProfile
+	if !decodeBody(w, r, &profile, h.bodyLimit) {
+		return
+	}
+	profile.UserID = mux.Vars(r)["userId"]
+
+	if err := h.exchange.SetRiskProfile(r.Context(), profile); err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("AUDIT: risk profile for %s set by %s: %+v", profile.UserID, r.RemoteAddr, profile)
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: profile})
+}
+
+// DeleteRiskProfile returns a user to the default limits
+func (h *Handler) DeleteRiskProfile(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	if err := h.exchange.DeleteRiskProfile(r.Context(), userID); err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("AUDIT: risk profile for %s removed by %s", userID, r.RemoteAddr)
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: h.exchange.EffectiveRiskProfile(userID)})
+}
+
+// BotReporter reports a trading bot's PnL
+type BotReporter interface {
+	PnL() *bot.PnLReport
+}
+
+// SetBot makes a bot's PnL available under its name
+func (h *Handler) SetBot(name string, reporter BotReporter) {
+	if h.bots == nil {
+		h.bots = make(map[string]BotReporter)
+	}
+	h.bots[name] = reporter
+}
+
+// GetBotPnL reports a bot's PnL split into spread capture, inventory and
+// hedge slippage
+func (h *Handler) GetBotPnL(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	reporter, ok := h.bots[name]
+	if !ok {
+		respondError(w, apierror.New(apierror.NotFound, "Unknown bot: %s", name))
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: reporter.PnL()})
+}
+
+// SetCapacity enables the capacity-planning report
+func (h *Handler) SetCapacity(planner *capacity.Planner) {
+	h.capacity = planner
+}
+
+// GetCapacity reports each symbol's resting orders, memory, activity and
+// delivery health, with daily samples of the last ?days= days (default 30)
+func (h *Handler) GetCapacity(w http.ResponseWriter, r *http.Request) {
+	if h.capacity == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Capacity reporting is not enabled"))
+		return
+	}
+
+	days := 30
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		d, err := strconv.Atoi(daysStr)
+		if err != nil || d < 0 || d > 365 {
+			respondError(w, apierror.New(apierror.InvalidRequest, "days must be between 0 and 365"))
+			return
+		}
+		days = d
+	}
+
+	report, err := h.capacity.Report(r.Context(), days)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: report})
+}
+
+func (h *Handler) GetHistoricalOrderBook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	symbol := vars["symbol"]
+
+	at := time.Now()
+	if atStr := r.URL.Query().Get("at"); atStr != "" {
+		parsed, err := time.Parse(time.RFC3339, atStr)
+		if err != nil {
+			respondError(w, apierror.New(apierror.InvalidRequest, "at must be an RFC3339 timestamp"))
+			return
+		}
+		at = parsed
+	}
+	if at.Before(time.Now().Add(-h.replayWindow)) {
+		respondError(w, apierror.New(apierror.InvalidRequest, "at is outside the replay window of %s", h.replayWindow))
+		return
+	}
+
+	depth, err := parseLimit(r, "depth", DefaultOrderBookDepth, MaxOrderBookDepth)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	orderBook, err := engine.ReconstructOrderBook(r.Context(), h.orderRepo, symbol, at, h.replayWindow, depth)
+	if err != nil {
+		log.Printf("ERROR reconstructing %s book: %v", symbol, err)
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: orderBook})
+}
+
+// ReplicationController is implemented by the primary and standby roles when
+// warm-standby replication is enabled
+type ReplicationController interface {
+	Status() interface{}
+	Promote() (int64, error)
+}
+
+// SetReplication enables the replication admin endpoints
+func (h *Handler) SetReplication(controller ReplicationController) {
+	h.replication = controller
+}
+
+func (h *Handler) GetReplicationStatus(w http.ResponseWriter, r *http.Request) {
+	if h.replication == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Replication is not enabled"))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: h.replication.Status()})
+}
+
+func (h *Handler) PromoteStandby(w http.ResponseWriter, r *http.Request) {
+	if h.replication == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Replication is not enabled"))
+		return
+	}
+
+	epoch, err := h.replication.Promote()
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: map[string]int64{"epoch": epoch}})
+}
+
+func (h *Handler) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	if h.marketData == nil {
+		respondError(w, apierror.New(apierror.NotFound, "market data cache is not enabled"))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: h.marketData.Stats()})
+}
+
+// SetCandles enables the candle recomputation admin endpoint
+func (h *Handler) SetCandles(service *candles.Service) {
+	h.candles = service
+}
+
+type InvalidateCandlesRequest struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// InvalidateCandles queues a symbol's candles over a time range for
+// recomputation, e.g. after trades in it were busted or backfilled
+func (h *Handler) InvalidateCandles(w http.ResponseWriter, r *http.Request) {
+	if h.candles == nil {
+		respondError(w, apierror.New(apierror.NotFound, "candle service is not enabled"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	symbol := vars["symbol"]
+
+	var req InvalidateCandlesRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+
+	invalidation, err := h.candles.Invalidate(r.Context(), symbol, req.From, req.To)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, Response{Success: true, Data: invalidation})
+}
+
+// SymbolManager lists and delists trading pairs together with everything
+// that follows a symbol: its stored config, ticker, price feed and market
+// maker quotes
+type SymbolManager interface {
+	ListSymbol(ctx context.Context, config domain.SymbolConfig, initialPrice float64, marketMaker bool) error
+	DelistSymbol(ctx context.Context, symbol string) (int, error)
+}
+
+// SetSymbolManager enables the symbol listing admin endpoints
+func (h *Handler) SetSymbolManager(manager SymbolManager) {
+	h.symbolManager = manager
+}
+
+type ListSymbolRequest struct {
+	domain.SymbolConfig
+	InitialPrice float64 `json:"initial_price"`
+	MarketMaker  bool    `json:"market_maker"`
+}
+
+func (h *Handler) ListSymbol(w http.ResponseWriter, r *http.Request) {
+	if h.symbolManager == nil {
+		respondError(w, apierror.New(apierror.NotFound, "symbol management is not enabled"))
+		return
+	}
+
+	var req ListSymbolRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+	if req.InitialPrice <= 0 {
+		respondError(w, apierror.New(apierror.InvalidRequest, "initial_price must be positive"))
+		return
+	}
+
+	if err := h.symbolManager.ListSymbol(r.Context(), req.SymbolConfig, req.InitialPrice, req.MarketMaker); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, Response{Success: true, Data: req.SymbolConfig})
+}
+
+func (h *Handler) DelistSymbol(w http.ResponseWriter, r *http.Request) {
+	if h.symbolManager == nil {
+		respondError(w, apierror.New(apierror.NotFound, "symbol management is not enabled"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	symbol := vars["symbol"]
+
+	cancelled, err := h.symbolManager.DelistSymbol(r.Context(), symbol)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: map[string]interface{}{
+		"symbol":           symbol,
+		"cancelled_orders": cancelled,
+	}})
+}
+
+// CancelSymbolOrders cancels every user's open orders on a symbol, e.g. as a
+// kill switch ahead of delisting
+func (h *Handler) CancelSymbolOrders(w http.ResponseWriter, r *http.Request) {
+	h.cancelAll(w, "", mux.Vars(r)["symbol"])
+}
+
+// SetSubsystems enables runtime control of background components
+func (h *Handler) SetSubsystems(registry *subsystem.Registry) {
+	h.subsystems = registry
+}
+
+func (h *Handler) GetSubsystems(w http.ResponseWriter, r *http.Request) {
+	if h.subsystems == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Subsystem control is not enabled"))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: h.subsystems.List()})
+}
+
+// ControlSubsystem stops or starts one background component. The caller's
+// address is recorded with the change.
+func (h *Handler) ControlSubsystem(w http.ResponseWriter, r *http.Request) {
+	if h.subsystems == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Subsystem control is not enabled"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	var status subsystem.Status
+	var err error
+	switch vars["action"] {
+	case "start":
+		status, err = h.subsystems.Start(vars["name"], r.RemoteAddr)
+	case "stop":
+		status, err = h.subsystems.Stop(vars["name"], r.RemoteAddr)
+	default:
+		respondError(w, apierror.New(apierror.InvalidRequest, "action must be start or stop"))
+		return
+	}
+
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: status})
+}
+
+// BalanceAdjustmentRequest credits (positive delta) or debits a user's
+// available balance
+type BalanceAdjustmentRequest struct {
+	UserID string  `json:"user_id"`
+	Asset  string  `json:"asset"`
+	Delta  float64 `json:"delta"`
+	Reason string  `json:"reason"`
+}
+
+// TransferRequest moves funds between two users' available balances
+type TransferRequest struct {
+	FromUserID string  `json:"from_user_id"`
+	ToUserID   string  `json:"to_user_id"`
+	Asset      string  `json:"asset"`
+	Amount     float64 `json:"amount"`
+	Reason     string  `json:"reason"`
+}
+
+// AdjustBalance tops up or debits a user's available balance, recording it
+// in the ledger
+func (h *Handler) AdjustBalance(w http.ResponseWriter, r *http.Request) {
+	var req BalanceAdjustmentRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+	if req.Reason == "" {
+		respondError(w, apierror.New(apierror.InvalidRequest, "reason is required"))
+		return
+	}
+
+	entry, err := h.exchange.AdjustBalance(r.Context(), req.UserID, req.Asset, req.Delta, req.Reason)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("AUDIT: %s balance of %s adjusted by %+v by %s (%s): ledger %s",
+		req.Asset, req.UserID, req.Delta, r.RemoteAddr, req.Reason, entry.ID)
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: entry})
+}
+
+// CreateTransfer moves funds from one user's available balance to another's
+func (h *Handler) CreateTransfer(w http.ResponseWriter, r *http.Request) {
+	var req TransferRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+	if req.Reason == "" {
+		respondError(w, apierror.New(apierror.InvalidRequest, "reason is required"))
+		return
+	}
+
+	entries, err := h.exchange.Transfer(r.Context(), req.FromUserID, req.ToUserID, req.Asset, req.Amount, req.Reason)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("AUDIT: %v %s transferred from %s to %s by %s (%s): reference %s",
+		req.Amount, req.Asset, req.FromUserID, req.ToUserID, r.RemoteAddr, req.Reason, entries[0].Reference)
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: entries})
+}
+
+// GetBalanceLedger lists a user's most recent adjustments and transfers,
+// newest first, up to balanceLedgerResource's limit
+func (h *Handler) GetBalanceLedger(w http.ResponseWriter, r *http.Request) {
+	query, err := balanceLedgerResource.Parse(r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	stored, err := h.balanceRepo.GetLedger(r.Context(), mux.Vars(r)["userId"], query.Limit)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	entries := make([]engine.LedgerEntry, len(stored))
+	for i, entry := range stored {
+		entries[i] = engine.LedgerEntry(*entry)
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: entries, Pagination: &Pagination{Limit: query.Limit, MaxLimit: query.MaxLimit}})
+}
+
+// PauseTradingRequest explains a trading pause to users
+type PauseTradingRequest struct {
+	Reason string `json:"reason"`
+	// ResumeAt resumes trading by itself at that time
+	ResumeAt *time.Time `json:"resume_at,omitempty"`
+}
+
+// PauseTrading rejects every new order until trading is resumed. Cancels and
+// reads keep working, and the pause survives a restart.
+func (h *Handler) PauseTrading(w http.ResponseWriter, r *http.Request) {
+	var req PauseTradingRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+	if req.Reason == "" {
+		respondError(w, apierror.New(apierror.InvalidRequest, "reason is required"))
+		return
+	}
+	if req.ResumeAt != nil && !req.ResumeAt.After(domain.Now()) {
+		respondError(w, apierror.New(apierror.InvalidRequest, "resume_at must be in the future"))
+		return
+	}
+
+	status, err := h.exchange.PauseTradingUntil(r.Context(), req.Reason, req.ResumeAt)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("AUDIT: trading paused by %s (%s)", r.RemoteAddr, req.Reason)
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: status})
+}
+
+// ResumeTrading accepts new orders again after PauseTrading
+func (h *Handler) ResumeTrading(w http.ResponseWriter, r *http.Request) {
+	status, err := h.exchange.ResumeTrading(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("AUDIT: trading resumed by %s", r.RemoteAddr)
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: status})
+}
+
+// GetReconciliation reconciles balances against the ledger now and returns
+// each asset's drift. The result is stored as a snapshot like the nightly
+// run's.
+func (h *Handler) GetReconciliation(w http.ResponseWriter, r *http.Request) {
+	result, err := h.exchange.Reconcile(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: result})
+}
+
+// GetEngineStats reports a symbol's matching engine internals: book sizes,
+// top of book, channel backlog, sequences and whether it is halted
+func (h *Handler) GetEngineStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.exchange.EngineStats(mux.Vars(r)["symbol"])
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: stats})
+}
+
+// PurgeOrder force-removes a stuck order from a symbol's book, emitting it
+// as cancelled whatever its state
+func (h *Handler) PurgeOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	order, err := h.exchange.PurgeOrder(vars["symbol"], vars["id"])
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	log.Printf("AUDIT: order %s purged from %s book by %s", order.ID, order.Symbol, r.RemoteAddr)
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: order})
+}
@@ -0,0 +1,443 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/hft-exchange/backend/internal/apierror"
+)
+
+// Scope is what a route requires of its caller. Scopes are ordered; holding
+// one grants every scope below it, so an admin key can also trade.
+type Scope string
+
+const (
+	// ScopePublic routes (health checks) are never checked or limited
+	ScopePublic Scope = "public"
+	// ScopeMarketData covers tickers, books, public trades and symbol info:
+	// nothing user-scoped and nothing that changes state
+	ScopeMarketData Scope = "market_data"
+	// ScopeRead covers a user's orders, balances and other account data
+	ScopeRead Scope = "read"
+	// ScopeTrade covers placing and cancelling orders and account settings
+	ScopeTrade Scope = "trade"
+	// ScopeAdmin covers everything under /admin
+	ScopeAdmin Scope = "admin"
+)
+
+var scopeLevels = map[Scope]int{
+	ScopePublic:     0,
+	ScopeMarketData: 1,
+	ScopeRead:       2,
+	ScopeTrade:      3,
+	ScopeAdmin:      4,
+}
+
+// ParseScope accepts any scope but public, which is only for routes
+func ParseScope(value string) (Scope, error) {
+	scope := Scope(value)
+	if level, ok := scopeLevels[scope]; !ok || level == 0 {
+		return "", fmt.Errorf("unknown scope %q", value)
+	}
+	return scope, nil
+}
+
+// APIKey grants its holder a set of scopes, with its own rate limit
+type APIKey struct {
+	Name   string
+	Secret string
+	Scopes []Scope
+	// RateLimit is requests per second; 0 is unlimited
+	RateLimit float64
+}
+
+func (k *APIKey) allows(required Scope) bool {
+	for _, scope := range k.Scopes {
+		if scopeLevels[scope] >= scopeLevels[required] {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAPIKeys reads keys as comma-separated name:secret:scopes[:rate]
+// entries, with scopes joined by "+", e.g.
+// "site:3f9c0e:market_data:50,ops:a81d2b:admin"
+func ParseAPIKeys(value string) ([]*APIKey, error) {
+	keys := make([]*APIKey, 0)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ":")
+		if len(fields) < 3 || len(fields) > 4 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("invalid API key entry %q, want name:secret:scopes[:rate]", entry)
+		}
+		key := &APIKey{Name: fields[0], Secret: fields[1]}
+		for _, value := range strings.Split(fields[2], "+") {
+			scope, err := ParseScope(value)
+			if err != nil {
+				return nil, fmt.Errorf("API key %s: %w", key.Name, err)
+			}
+			key.Scopes = append(key.Scopes, scope)
+		}
+		if len(fields) == 4 {
+			rate, err := strconv.ParseFloat(fields[3], 64)
+			if err != nil || rate < 0 {
+				return nil, fmt.Errorf("API key %s: invalid rate %q", key.Name, fields[3])
+			}
+			key.RateLimit = rate
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Auth checks every request against the scope its route declares. Requests
+// without a key are anonymous and get AnonymousScope, rate limited per
+// client address.
+type Auth struct {
+	keys           map[string]*APIKey
+	tokens         TokenVerifier
+	anonymousScope Scope
+	anonymousRate  float64
+	// devMode trusts anonymous callers to name themselves with ?user_id=
+	devMode bool
+	// scopes holds what each registered route requires
+	scopes map[*mux.Route]Scope
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewAuth builds an Auth that grants anonymous callers anonymousScope at up
+// to anonymousRate requests per second per address (0 is unlimited)
+func NewAuth(keys []*APIKey, anonymousScope Scope, anonymousRate float64) *Auth {
+	auth := &Auth{
+		keys:           make(map[string]*APIKey, len(keys)),
+		anonymousScope: anonymousScope,
+		anonymousRate:  anonymousRate,
+		scopes:         make(map[*mux.Route]Scope),
+		buckets:        make(map[string]*tokenBucket),
+	}
+	for _, key := range keys {
+		auth.keys[key.Secret] = key
+	}
+	return auth
+}
+
+// TokenVerifier checks a user's session token and returns the user ID it
+// was issued to and when it expires
+type TokenVerifier interface {
+	Verify(token string) (string, time.Time, error)
+}
+
+// SetTokens accepts user session tokens, sent as "Authorization: Bearer",
+// alongside API keys. A token grants the trade scope, but only over its own
+// user: routes with a {userId} must name the token's user.
+func (a *Auth) SetTokens(tokens TokenVerifier) {
+	a.tokens = tokens
+}
+
+// SetDevMode lets anonymous callers act on the orders of whichever user
+// they name with ?user_id=, as the demo frontend does without logging in.
+// Otherwise routes that check whose order it is need a session token or the
+// admin scope, since nothing ties a named user to a key or an address.
+func (a *Auth) SetDevMode(devMode bool) {
+	a.devMode = devMode
+}
+
+// SetAuth replaces the default of full anonymous access
+func (h *Handler) SetAuth(auth *Auth) {
+	h.auth = auth
+}
+
+type apiKeyContextKey struct{}
+
+type userContextKey struct{}
+
+type sessionExpiryContextKey struct{}
+
+type rateLimitContextKey struct{}
+
+// rateLimit is the bucket a request was charged to, kept so handlers of
+// requests that count as several can charge the rest
+type rateLimit struct {
+	auth   *Auth
+	client string
+	rate   float64
+}
+
+// chargeRequests spends n more of the caller's rate limit on a request that
+// counts as several, such as a batch, returning how long to wait instead if
+// the caller's bucket can't cover them
+func chargeRequests(r *http.Request, n int) time.Duration {
+	limit, ok := r.Context().Value(rateLimitContextKey{}).(*rateLimit)
+	if !ok || n <= 0 {
+		return 0
+	}
+	return limit.auth.take(limit.client, limit.rate, float64(n), 1)
+}
+
+// chargeEndpoint spends one of the caller's requests to an expensive
+// endpoint, which has a limit of rate per second per caller on top of the
+// caller's own, returning how long to wait instead if it is used up
+func chargeEndpoint(r *http.Request, endpoint string, rate float64) time.Duration {
+	limit, ok := r.Context().Value(rateLimitContextKey{}).(*rateLimit)
+	if !ok {
+		return 0
+	}
+	return limit.auth.take(endpoint+" "+limit.client, rate, 1, 0)
+}
+
+// respondRateLimited refuses a request over its caller's rate limit, telling
+// it when to retry
+func respondRateLimited(w http.ResponseWriter, wait time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondError(w, apierror.New(apierror.RateLimited, "%s", message))
+}
+
+// CallerUser returns the user a request's session token was issued to, or
+// "" if it had none
+func CallerUser(r *http.Request) string {
+	userID, _ := r.Context().Value(userContextKey{}).(string)
+	return userID
+}
+
+// callerSessionExpiry returns when a request's session token expires, or
+// the zero time if it had none
+func callerSessionExpiry(r *http.Request) time.Time {
+	expiresAt, _ := r.Context().Value(sessionExpiryContextKey{}).(time.Time)
+	return expiresAt
+}
+
+// CallerKey returns the API key a request was made with, or nil if it was
+// anonymous
+func CallerKey(r *http.Request) *APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
+
+// callerHolds reports whether a request's caller holds scope, through its
+// session token, its key or, without either, the anonymous scope
+func (h *Handler) callerHolds(r *http.Request, scope Scope) bool {
+	if CallerUser(r) != "" {
+		return scopeLevels[ScopeTrade] >= scopeLevels[scope]
+	}
+	if key := CallerKey(r); key != nil {
+		return key.allows(scope)
+	}
+	anonymous := ScopeAdmin
+	if h.auth != nil {
+		anonymous = h.auth.anonymousScope
+	}
+	return scopeLevels[anonymous] >= scopeLevels[scope]
+}
+
+// orderOwner returns the user whose orders a request may act on: its
+// session token's user, "" for anyone's if the caller is an admin, or in dev
+// mode, the user an anonymous caller names as claimed. Any other caller is
+// refused with 403, as its claim can't be checked.
+func (h *Handler) orderOwner(w http.ResponseWriter, r *http.Request, claimed string) (string, bool) {
+	if caller := CallerUser(r); caller != "" {
+		return caller, true
+	}
+	if h.callerHolds(r, ScopeAdmin) {
+		return "", true
+	}
+	if !h.mayNameUser(w, r) {
+		return "", false
+	}
+	if claimed == "" {
+		respondError(w, apierror.New(apierror.InvalidRequest, "user_id is required"))
+		return "", false
+	}
+	return claimed, true
+}
+
+// mayNameUser rejects with 403 a request that names the user it acts for
+// when nothing ties the caller to that user. Session tokens are held to
+// their own user by actsFor and the middleware, admins may act for anyone,
+// and anonymous callers in dev mode for whomever they name. Keys and other
+// anonymous callers are refused.
+func (h *Handler) mayNameUser(w http.ResponseWriter, r *http.Request) bool {
+	if CallerUser(r) != "" || h.callerHolds(r, ScopeAdmin) {
+		return true
+	}
+	if CallerKey(r) == nil && h.auth.devMode {
+		return true
+	}
+	respondError(w, apierror.New(apierror.Forbidden, "acting for a user needs a session token or the admin scope"))
+	return false
+}
+
+// actsFor rejects with 403 a request made with another user's session
+// token on behalf of userID. Routes with a {userId} are checked by the
+// middleware; this covers users named in a body.
+func actsFor(w http.ResponseWriter, r *http.Request, userID string) bool {
+	if caller := CallerUser(r); caller != "" && caller != userID {
+		respondError(w, apierror.New(apierror.Forbidden, "this token is not valid for user %s", userID))
+		return false
+	}
+	return true
+}
+
+// handle registers a route along with the scope it requires
+func (a *Auth) handle(router *mux.Router, scope Scope, method, path string, fn http.HandlerFunc) {
+	route := router.HandleFunc(path, fn)
+	if method != "" {
+		route.Methods(method)
+	}
+	a.scopes[route] = scope
+}
+
+// checkRoutes panics if any route with a handler was registered without a
+// scope, so an endpoint can't ship unprotected
+func (a *Auth) checkRoutes(router *mux.Router) {
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		if _, ok := a.scopes[route]; !ok {
+			path, _ := route.GetPathTemplate()
+			methods, _ := route.GetMethods()
+			return fmt.Errorf("route %v %s declares no scope", methods, path)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// middleware enforces the matched route's scope and the caller's rate limit
+func (a *Auth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required, ok := a.scopes[mux.CurrentRoute(r)]
+		if !ok {
+			// checkRoutes guarantees this can't happen; fail closed regardless
+			respondError(w, apierror.New(apierror.Forbidden, "route declares no scope"))
+			return
+		}
+		if required == ScopePublic {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client, rate := clientAddress(r), a.anonymousRate
+		var allowed bool
+		bearer, hasToken := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !hasToken && websocket.IsWebSocketUpgrade(r) {
+			// Nor an Authorization header, so a WebSocket may bring its
+			// session token in the query string
+			bearer = r.URL.Query().Get("token")
+			hasToken = bearer != ""
+		}
+		secret := r.Header.Get("X-API-Key")
+		if secret == "" {
+			// Browsers can't set headers on a WebSocket handshake
+			secret = r.URL.Query().Get("api_key")
+		}
+		if hasToken && a.tokens != nil {
+			userID, expiresAt, err := a.tokens.Verify(bearer)
+			if err != nil {
+				respondError(w, err)
+				return
+			}
+			if pathUser, ok := mux.Vars(r)["userId"]; ok && pathUser != userID {
+				respondError(w, apierror.New(apierror.Forbidden, "this token is not valid for user %s", pathUser))
+				return
+			}
+			client = "user:" + userID
+			allowed = scopeLevels[ScopeTrade] >= scopeLevels[required]
+			ctx := context.WithValue(r.Context(), userContextKey{}, userID)
+			r = r.WithContext(context.WithValue(ctx, sessionExpiryContextKey{}, expiresAt))
+		} else if secret != "" {
+			key, found := a.keys[secret]
+			if !found {
+				respondError(w, apierror.New(apierror.Unauthorized, "unknown API key"))
+				return
+			}
+			client, rate = "key:"+key.Name, key.RateLimit
+			allowed = key.allows(required)
+			r = r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key))
+		} else {
+			allowed = scopeLevels[a.anonymousScope] >= scopeLevels[required]
+		}
+		noteCaller(r, client)
+		if !allowed {
+			respondError(w, apierror.New(apierror.Forbidden, "this endpoint requires the %s scope", required))
+			return
+		}
+
+		if wait := a.take(client, rate, 1, 0); wait > 0 {
+			respondRateLimited(w, wait, "rate limit exceeded")
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), rateLimitContextKey{}, &rateLimit{auth: a, client: client, rate: rate}))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maxBuckets bounds the rate limit state kept; past it, buckets idle for a
+// minute are dropped
+const maxBuckets = 10000
+
+// tokenBucket allows rate requests per second with bursts of up to one
+// second's worth
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take spends n tokens from client's bucket, returning how long to wait
+// instead if it holds too few. More tokens than a full bucket holds are
+// taken from a full one, leaving it in debt. spent is how many the same
+// request already took, which count towards that.
+func (a *Auth) take(client string, rate, n, spent float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	burst := math.Max(rate, 1)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	bucket, ok := a.buckets[client]
+	if !ok && len(a.buckets) >= maxBuckets {
+		for name, idle := range a.buckets {
+			if now.Sub(idle.last) > time.Minute {
+				delete(a.buckets, name)
+			}
+		}
+	}
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		a.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+	if need := math.Min(n+spent, burst) - spent; bucket.tokens < need {
+		return time.Duration((need - bucket.tokens) / rate * float64(time.Second))
+	}
+	bucket.tokens -= n
+	return 0
+}
+
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
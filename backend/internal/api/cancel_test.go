@@ -0,0 +1,138 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/api"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/wstest"
+)
+
+// cancel sends DELETE /api/v1/orders/{id} as the holder of token, or
+// anonymously when it is empty, naming userID as the caller if it is set
+func cancel(t *testing.T, baseURL, token string, order *domain.Order, userID string) (int, api.Response) {
+	t.Helper()
+	path := baseURL + "/api/v1/orders/" + order.ID + "?symbol=" + order.Symbol
+	if userID != "" {
+		path += "&user_id=" + userID
+	}
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return send(t, http.MethodDelete, path, "", header)
+}
+
+// send makes a request with body and header and decodes the response
+// envelope
+func send(t *testing.T, method, path, body string, header http.Header) (int, api.Response) {
+	t.Helper()
+	request, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header = header
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var envelope api.Response
+	if err := json.NewDecoder(response.Body).Decode(&envelope); err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, envelope
+}
+
+// A user can't cancel another user's order, even by naming them as user_id,
+// and the order stays on the book. The owner and an admin can.
+func TestCancelOnlyOwnOrdersUnlessAdmin(t *testing.T) {
+	server, _ := startServer(t)
+	ctx, stop := context.WithTimeout(context.Background(), time.Minute)
+	defer stop()
+	user1, token1, err := server.User(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user2, _, err := server.User(ctx, "user-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	theirs, err := server.Rest(ctx, user2, "BTC-USD", domain.OrderSideBuy, 0.01, 44000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, claimed := range []string{"", user2} {
+		status, response := cancel(t, server.BaseURL, token1, theirs, claimed)
+		if status != http.StatusForbidden || response.Success || response.ErrorCode != "forbidden" {
+			t.Errorf("user-1 cancelling user-2's order (user_id %q): %d %+v, want 403 forbidden", claimed, status, response)
+		}
+	}
+	if open, err := server.Exchange.GetOpenOrders(user2, "BTC-USD"); err != nil || len(open.Orders) != 1 || open.Orders[0].ID != theirs.ID {
+		t.Fatalf("user-2's open orders after the refused cancels = %+v, %v, want the order still open", open, err)
+	}
+
+	own, err := server.Rest(ctx, user1, "BTC-USD", domain.OrderSideBuy, 0.01, 43900)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, response := cancel(t, server.BaseURL, token1, own, ""); status != http.StatusOK || !response.Success {
+		t.Errorf("user-1 cancelling their own order: %d %+v, want 200", status, response)
+	}
+
+	// Anonymous callers hold the admin scope on the test server
+	if status, response := cancel(t, server.BaseURL, "", theirs, ""); status != http.StatusOK || !response.Success {
+		t.Fatalf("admin cancelling user-2's order: %d %+v, want 200", status, response)
+	}
+	if status, response := cancel(t, server.BaseURL, "", theirs, ""); status != http.StatusNotFound || response.Error != engine.ErrOrderNotFound.Error() {
+		t.Errorf("cancelling it again: %d %+v, want 404 order not found", status, response)
+	}
+}
+
+// A trade key that isn't tied to a user can't place, cancel or read the
+// fills of orders by naming a user as user_id, even the right one
+func TestSpoofedUserIDRefused(t *testing.T) {
+	server, _ := startServer(t)
+	ctx, stop := context.WithTimeout(context.Background(), time.Minute)
+	defer stop()
+	owner, _, err := server.User(ctx, "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := server.Rest(ctx, owner, "BTC-USD", domain.OrderSideBuy, 0.01, 44000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := http.Header{}
+	header.Set("X-API-Key", wstest.TradeKey)
+	placed := `{"user_id":"` + owner + `","symbol":"BTC-USD","side":"BUY","type":"LIMIT","quantity":0.01,"price":43000}`
+	requests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodDelete, "/api/v1/orders/" + order.ID + "?symbol=BTC-USD&user_id=" + owner, ""},
+		{http.MethodGet, "/api/v1/orders/" + order.ID + "/fills?user_id=" + owner, ""},
+		{http.MethodDelete, "/api/v1/users/" + owner + "/orders", ""},
+		{http.MethodPost, "/api/v1/orders/cancel-batch", `{"user_id":"` + owner + `","orders":[{"order_id":"` + order.ID + `","symbol":"BTC-USD"}]}`},
+		{http.MethodPost, "/api/v1/orders", placed},
+		{http.MethodPost, "/api/v1/orders/batch", `{"orders":[` + placed + `]}`},
+	}
+	for _, request := range requests {
+		status, response := send(t, request.method, server.BaseURL+request.path, request.body, header)
+		if status != http.StatusForbidden || response.Success || response.ErrorCode != "forbidden" {
+			t.Errorf("%s %s with a trade key: %d %+v, want 403 forbidden", request.method, request.path, status, response)
+		}
+	}
+	if open, err := server.Exchange.GetOpenOrders(owner, "BTC-USD"); err != nil || len(open.Orders) != 1 || open.Orders[0].ID != order.ID {
+		t.Fatalf("open orders after the refused requests = %+v, %v, want only the one order, still open", open, err)
+	}
+}
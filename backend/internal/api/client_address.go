@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// SetTrustedProxyHeader names the header, such as X-Forwarded-For, in which
+// the proxy in front of the server reports each client's address. Per-address
+// limits and logs then see the client rather than the proxy. Only set it when
+// every request comes through that proxy, since a client reaching the server
+// directly could send any address in it.
+func (h *Handler) SetTrustedProxyHeader(header string) {
+	h.proxyHeader = http.CanonicalHeaderKey(strings.TrimSpace(header))
+}
+
+// trustProxy replaces each request's RemoteAddr with the last address in the
+// trusted proxy header, which is the one the proxy added itself; addresses
+// before it were sent by the client. Requests without a usable address in
+// the header keep the proxy's.
+func (h *Handler) trustProxy(next http.Handler) http.Handler {
+	if h.proxyHeader == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		values := r.Header.Values(h.proxyHeader)
+		if len(values) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		forwarded := strings.Split(values[len(values)-1], ",")
+		address := net.ParseIP(strings.TrimSpace(forwarded[len(forwarded)-1]))
+		if address == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r = r.WithContext(r.Context())
+		r.RemoteAddr = net.JoinHostPort(address.String(), "0")
+		next.ServeHTTP(w, r)
+	})
+}
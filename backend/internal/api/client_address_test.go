@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// The trusted header's last address is the client, since the proxy appends
+// the address it saw to whatever the client sent
+func TestTrustedProxyHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		values  []string
+		address string
+	}{
+		{"no header configured", "", []string{"203.0.113.7"}, "10.0.0.1"},
+		{"single address", "X-Forwarded-For", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed addresses before the proxy's", "X-Forwarded-For", []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"repeated header", "X-Forwarded-For", []string{"198.51.100.1", "203.0.113.7"}, "203.0.113.7"},
+		{"IPv6", "X-Forwarded-For", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"other header", "cf-connecting-ip", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"missing", "X-Forwarded-For", nil, "10.0.0.1"},
+		{"not an address", "X-Forwarded-For", []string{"unknown"}, "10.0.0.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &Handler{}
+			h.SetTrustedProxyHeader(test.header)
+			var got string
+			handler := h.trustProxy(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientAddress(r)
+			}))
+
+			r := httptest.NewRequest("GET", "/api/v1/symbols", nil)
+			r.RemoteAddr = "10.0.0.1:43210"
+			for _, value := range test.values {
+				r.Header.Add("X-Forwarded-For", value)
+				r.Header.Add("CF-Connecting-IP", value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			if got != test.address {
+				t.Errorf("client address = %q, want %q", got, test.address)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// CompressionThreshold is the size in bytes a response must reach before it
+// is gzipped; smaller ones gain little and cost a gzip header
+const CompressionThreshold = 1024
+
+// gzipWriters are reset onto each response rather than allocated per request
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// compressResponses gzips responses of at least CompressionThreshold bytes
+// for clients that accept it. Upgrades, event streams and content that is
+// already compressed pass through untouched.
+func compressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		compressed := &compressedResponse{ResponseWriter: w, status: http.StatusOK}
+		defer compressed.close()
+		next.ServeHTTP(compressed, r)
+	})
+}
+
+// acceptsGzip reports whether Accept-Encoding allows gzip, honoring q=0
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.TrimSpace(name)
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// compressedResponse holds a response back until it has seen enough of the
+// body to know whether compressing is worth it, then either gzips it or
+// writes it as is
+type compressedResponse struct {
+	http.ResponseWriter
+	status  int
+	pending []byte
+	started bool
+	gz      *gzip.Writer
+}
+
+func (c *compressedResponse) WriteHeader(status int) {
+	if !c.started {
+		c.status = status
+	}
+}
+
+func (c *compressedResponse) Write(data []byte) (int, error) {
+	if c.started {
+		if c.gz != nil {
+			return c.gz.Write(data)
+		}
+		return c.ResponseWriter.Write(data)
+	}
+
+	c.pending = append(c.pending, data...)
+	if len(c.pending) >= CompressionThreshold {
+		if err := c.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// Flush sends what has been written so far; a response flushed before it
+// reached the threshold is streaming and goes out uncompressed
+func (c *compressedResponse) Flush() {
+	if !c.started {
+		c.start(false)
+	}
+	if c.gz != nil {
+		c.gz.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (c *compressedResponse) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// start writes the headers and any pending body, compressing from here on if
+// compress is set and the response is one worth compressing
+func (c *compressedResponse) start(compress bool) error {
+	c.started = true
+	header := c.Header()
+	if compress && c.compressible() {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		// The gzipped bytes differ, so a strong tag no longer describes them
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		c.gz = gzipWriters.Get().(*gzip.Writer)
+		c.gz.Reset(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+
+	pending := c.pending
+	c.pending = nil
+	if len(pending) == 0 {
+		return nil
+	}
+	var err error
+	if c.gz != nil {
+		_, err = c.gz.Write(pending)
+	} else {
+		_, err = c.ResponseWriter.Write(pending)
+	}
+	return err
+}
+
+func (c *compressedResponse) compressible() bool {
+	header := c.Header()
+	if header.Get("Content-Encoding") != "" || c.status < http.StatusOK ||
+		c.status == http.StatusNoContent || c.status == http.StatusNotModified {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "text/event-stream"),
+		strings.HasPrefix(contentType, "image/"),
+		strings.HasPrefix(contentType, "video/"),
+		strings.HasPrefix(contentType, "application/gzip"),
+		strings.HasPrefix(contentType, "application/zip"):
+		return false
+	}
+	return true
+}
+
+// close finishes the response: one that never reached the threshold is
+// written as is, and a gzipped one has its trailer written and its writer
+// returned to the pool
+func (c *compressedResponse) close() {
+	if !c.started {
+		c.start(false)
+	}
+	if c.gz == nil {
+		return
+	}
+	if err := c.gz.Close(); err != nil {
+		log.Printf("Failed to finish compressed response: %v", err)
+	}
+	c.gz.Reset(io.Discard)
+	gzipWriters.Put(c.gz)
+	c.gz = nil
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// deepBook is a book depth levels a side, as GET /orderbook/{symbol} serves it
+func deepBook(depth int) Response {
+	book := &domain.OrderBook{Symbol: "BTC-USD", Timestamp: time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC), Seq: 123456}
+	for i := 0; i < depth; i++ {
+		book.Bids = append(book.Bids, domain.OrderBookLevel{Price: 44999.5 - float64(i)*0.5, Quantity: 0.125 + float64(i%7)*0.031, Orders: 1 + i%4})
+		book.Asks = append(book.Asks, domain.OrderBookLevel{Price: 45000.5 + float64(i)*0.5, Quantity: 0.25 + float64(i%5)*0.047, Orders: 1 + i%3})
+	}
+	return Response{Success: true, Data: OrderBookResponse{OrderBook: book, Source: OrderBookFromEngine, AsOf: book.Timestamp, Depth: depth, MaxDepth: MaxOrderBookDepth}}
+}
+
+// serveCompressed serves data through compressResponses, as a client sending
+// acceptEncoding asks for it
+func serveCompressed(acceptEncoding string, contentType string, data interface{}) *httptest.ResponseRecorder {
+	handler := compressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType == "" {
+			respondJSON(w, http.StatusOK, data)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		json.NewEncoder(w).Encode(data)
+	}))
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/orderbook/BTC-USD?depth=200", nil)
+	if acceptEncoding != "" {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCompressResponses(t *testing.T) {
+	book := deepBook(200)
+	plain := serveCompressed("", "", book)
+	small := Response{Success: true, Data: "ok"}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		data           interface{}
+		gzipped        bool
+	}{
+		{"large to a gzip client", "gzip, deflate, br", "", book, true},
+		{"large to a client without gzip", "", "", book, false},
+		{"large to a client refusing gzip", "gzip;q=0, identity", "", book, false},
+		{"large to a client taking anything", "*", "", book, true},
+		{"below the threshold", "gzip", "", small, false},
+		{"event stream", "gzip", "text/event-stream", book, false},
+		{"already compressed", "gzip", "application/gzip", book, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := serveCompressed(test.acceptEncoding, test.contentType, test.data)
+			if vary := response.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", vary)
+			}
+			encoding := response.Header().Get("Content-Encoding")
+			if !test.gzipped {
+				if encoding != "" {
+					t.Errorf("Content-Encoding = %q, want none", encoding)
+				}
+				return
+			}
+			if encoding != "gzip" {
+				t.Fatalf("Content-Encoding = %q, want gzip", encoding)
+			}
+			reader, err := gzip.NewReader(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(body, plain.Body.Bytes()) {
+				t.Errorf("the gzipped body doesn't decompress to the plain one")
+			}
+		})
+	}
+}
+
+// A flushed response is streaming and goes out as it is written
+func TestCompressResponsesLeavesFlushedResponses(t *testing.T) {
+	handler := compressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, strings.Repeat("x", 2*CompressionThreshold))
+	}))
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if encoding := recorder.Header().Get("Content-Encoding"); encoding != "" {
+		t.Errorf("Content-Encoding = %q, want none", encoding)
+	}
+	if !strings.HasPrefix(recorder.Body.String(), "first\n") {
+		t.Errorf("body = %.20q..., want it as written", recorder.Body.String())
+	}
+}
+
+// BenchmarkDepth200OrderBook compares the bytes on the wire for a depth-200
+// order book served with and without gzip
+func BenchmarkDepth200OrderBook(b *testing.B) {
+	book := deepBook(200)
+	for _, bench := range []struct {
+		name           string
+		acceptEncoding string
+	}{
+		{"plain", ""},
+		{"gzip", "gzip"},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var wire int
+			for i := 0; i < b.N; i++ {
+				wire = serveCompressed(bench.acceptEncoding, "", book).Body.Len()
+			}
+			b.ReportMetric(float64(wire), "wire-bytes")
+		})
+	}
+}
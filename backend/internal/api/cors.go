@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rs/cors"
+)
+
+// CORSConfig is which browser origins may call the API and how
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// AdminOrigins may call /api/v1/admin from a browser. Empty keeps the
+	// admin API same-origin only.
+	AdminOrigins []string
+}
+
+// DefaultCORSConfig allows the local development frontends
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"http://localhost:3000", "http://localhost:5173", "http://localhost:8080"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{
+			"Content-Type", "Authorization", "X-API-Key", "X-Request-ID", "Idempotency-Key",
+			"X-Number-Format", "If-None-Match", "Last-Event-ID",
+		},
+	}
+}
+
+// exposedHeaders are the response headers browser clients may read
+var exposedHeaders = []string{"X-Request-ID", "X-Response-Time-Ms", "ETag", "Retry-After", "Idempotent-Replayed"}
+
+// SetCORS replaces the CORS policy. Empty methods or headers keep the
+// defaults.
+func (h *Handler) SetCORS(config CORSConfig) {
+	defaults := DefaultCORSConfig()
+	if len(config.AllowedMethods) == 0 {
+		config.AllowedMethods = defaults.AllowedMethods
+	}
+	if len(config.AllowedHeaders) == 0 {
+		config.AllowedHeaders = defaults.AllowedHeaders
+	}
+	h.cors = config
+}
+
+// corsPolicy applies the configured policy, and the stricter admin one to the
+// admin API
+type corsPolicy struct {
+	public *cors.Cors
+	admin  *cors.Cors
+}
+
+func newCORSPolicy(config CORSConfig) *corsPolicy {
+	policy := &corsPolicy{
+		public: cors.New(cors.Options{
+			AllowedOrigins: config.AllowedOrigins,
+			AllowedMethods: config.AllowedMethods,
+			AllowedHeaders: config.AllowedHeaders,
+			ExposedHeaders: exposedHeaders,
+			// Browsers refuse credentials with a wildcard origin, and a
+			// wildcard that sent them would let any site act as the user
+			AllowCredentials: !slices.Contains(config.AllowedOrigins, "*"),
+			MaxAge:           3600,
+		}),
+	}
+
+	// Admin origins must be named; a wildcard is ignored
+	adminOrigins := slices.DeleteFunc(slices.Clone(config.AdminOrigins), func(origin string) bool {
+		return origin == "*"
+	})
+	if len(adminOrigins) == 0 {
+		// rs/cors reads no origins as any origin
+		policy.admin = cors.New(cors.Options{AllowOriginFunc: func(string) bool { return false }})
+	} else {
+		policy.admin = cors.New(cors.Options{
+			AllowedOrigins:   adminOrigins,
+			AllowedMethods:   config.AllowedMethods,
+			AllowedHeaders:   []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID"},
+			ExposedHeaders:   exposedHeaders,
+			AllowCredentials: true,
+			MaxAge:           600,
+		})
+	}
+	return policy
+}
+
+func (p *corsPolicy) handler(next http.Handler) http.Handler {
+	public := p.public.Handler(next)
+	admin := p.admin.Handler(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v1/admin/") || r.URL.Path == "/api/v1/admin" {
+			admin.ServeHTTP(w, r)
+			return
+		}
+		public.ServeHTTP(w, r)
+	})
+}
+
+// checkOrigin lets a WebSocket upgrade through when it comes from an allowed
+// origin, the server's own, or a client that isn't a browser and sends none
+func (p *corsPolicy) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || p.public.OriginAllowed(r) {
+		return true
+	}
+	host, found := strings.CutPrefix(origin, "http://")
+	if !found {
+		host, found = strings.CutPrefix(origin, "https://")
+	}
+	return found && strings.EqualFold(host, r.Host)
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	frontend = "https://app.example.com"
+	stranger = "https://evil.example.net"
+	console  = "https://admin.example.com"
+)
+
+func corsHandler(config CORSConfig) http.Handler {
+	h := &Handler{}
+	h.SetCORS(config)
+	return newCORSPolicy(h.cors).handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+// corsRequest sends a request from origin, as a preflight for method when
+// preflight is set, and returns the response headers
+func corsRequest(handler http.Handler, path, origin string, preflight bool, requestHeaders string) http.Header {
+	method := "GET"
+	if preflight {
+		method = "OPTIONS"
+	}
+	r := httptest.NewRequest(method, path, nil)
+	r.Header.Set("Origin", origin)
+	if preflight {
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		if requestHeaders != "" {
+			r.Header.Set("Access-Control-Request-Headers", requestHeaders)
+		}
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w.Header()
+}
+
+func TestCORSOrigins(t *testing.T) {
+	handler := corsHandler(CORSConfig{AllowedOrigins: []string{frontend}, AdminOrigins: []string{console, "*"}})
+	tests := []struct {
+		name      string
+		path      string
+		origin    string
+		preflight bool
+		allowed   bool
+	}{
+		{"allowed origin", "/api/v1/tickers", frontend, false, true},
+		{"allowed origin preflight", "/api/v1/orders", frontend, true, true},
+		{"disallowed origin", "/api/v1/tickers", stranger, false, false},
+		{"disallowed origin preflight", "/api/v1/orders", stranger, true, false},
+		{"public origin on the admin API", "/api/v1/admin/users", frontend, false, false},
+		{"public origin preflight on the admin API", "/api/v1/admin/users", frontend, true, false},
+		{"admin origin on the admin API", "/api/v1/admin/users", console, true, true},
+		{"wildcard admin origin is ignored", "/api/v1/admin", stranger, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := corsRequest(handler, test.path, test.origin, test.preflight, "")
+			got := header.Get("Access-Control-Allow-Origin")
+			if test.allowed && got != test.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, test.origin)
+			}
+			if !test.allowed {
+				for key := range header {
+					if strings.HasPrefix(key, "Access-Control-") {
+						t.Errorf("disallowed origin got %s: %q", key, header.Get(key))
+					}
+				}
+			}
+		})
+	}
+}
+
+// Credentials are allowed for named origins but never with a wildcard
+func TestCORSCredentials(t *testing.T) {
+	named := corsRequest(corsHandler(CORSConfig{AllowedOrigins: []string{frontend}}), "/api/v1/tickers", frontend, false, "")
+	if got := named.Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("named origin: Access-Control-Allow-Credentials = %q, want true", got)
+	}
+	wildcard := corsRequest(corsHandler(CORSConfig{AllowedOrigins: []string{"*"}}), "/api/v1/tickers", stranger, false, "")
+	if got := wildcard.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("wildcard: Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := wildcard.Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("wildcard: Access-Control-Allow-Credentials = %q, want none", got)
+	}
+}
+
+// Leaving the headers unset keeps every header the API reads, and a
+// configured list replaces them. Browsers send the requested headers
+// lowercased and sorted.
+func TestCORSAllowedHeaders(t *testing.T) {
+	defaults := corsHandler(CORSConfig{AllowedOrigins: []string{frontend}})
+	for _, requested := range []string{"x-api-key", "idempotency-key", "authorization,content-type,x-request-id"} {
+		if got := corsRequest(defaults, "/api/v1/orders", frontend, true, requested).Get("Access-Control-Allow-Origin"); got != frontend {
+			t.Errorf("default headers: preflight for %s got Access-Control-Allow-Origin %q", requested, got)
+		}
+	}
+	narrowed := corsHandler(CORSConfig{AllowedOrigins: []string{frontend}, AllowedHeaders: []string{"Content-Type"}})
+	if got := corsRequest(narrowed, "/api/v1/orders", frontend, true, "x-api-key").Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("narrowed headers: preflight for X-API-Key got Access-Control-Allow-Origin %q", got)
+	}
+}
+
+// WebSocket upgrades are checked against the same origins
+func TestCORSCheckOrigin(t *testing.T) {
+	h := &Handler{}
+	h.SetCORS(CORSConfig{AllowedOrigins: []string{frontend}})
+	policy := newCORSPolicy(h.cors)
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{frontend, true},
+		{"https://exchange.example.com", true},
+		{stranger, false},
+		{"null", false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "http://exchange.example.com/ws", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if got := policy.checkOrigin(r); got != test.want {
+			t.Errorf("checkOrigin(%q) = %v, want %v", test.origin, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/apierror"
+)
+
+// ErrValidation prefixes every request body that can't be decoded as the
+// endpoint's request type
+var ErrValidation = errors.New("VALIDATION_ERROR")
+
+// Default request body caps. Orders are a few hundred bytes, so their cap is
+// tight; everything else gets room for larger configs.
+const (
+	DefaultOrderBodyLimit int64 = 4 << 10
+	DefaultBodyLimit      int64 = 64 << 10
+)
+
+// SetBodyLimits caps request body sizes for order placement and for every
+// other endpoint; non-positive values keep the current cap
+func (h *Handler) SetBodyLimits(orderLimit, limit int64) {
+	if orderLimit > 0 {
+		h.orderBodyLimit = orderLimit
+	}
+	if limit > 0 {
+		h.bodyLimit = limit
+	}
+}
+
+// decodeBody strictly decodes a request body of at most limit bytes into dst.
+// Unknown fields, out of range numbers, trailing data and oversized bodies
+// are rejected with a VALIDATION_ERROR response, in which case it returns
+// false.
+func decodeBody(w http.ResponseWriter, r *http.Request, dst interface{}, limit int64) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	var maxBytesErr *http.MaxBytesError
+	err := decoder.Decode(dst)
+	if err == nil {
+		// A second value after the object is as suspect as an unknown field,
+		// unless reading on ran past the cap, which is reported as such
+		switch extra := decoder.Decode(&json.RawMessage{}); {
+		case extra == io.EOF:
+		case errors.As(extra, &maxBytesErr):
+			err = extra
+		default:
+			err = errors.New("body must contain a single JSON object")
+		}
+	}
+	if err == nil {
+		return true
+	}
+
+	status := http.StatusBadRequest
+	if errors.As(err, &maxBytesErr) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	respondError(w, &apierror.Error{
+		Code:    apierror.InvalidRequest,
+		Status:  status,
+		Message: fmt.Sprintf("%s: %s", ErrValidation, describeDecodeError(err)),
+	})
+	return false
+}
+
+// describeDecodeError names the field or limit a decode error is about
+func describeDecodeError(err error) string {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit)
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("malformed JSON at byte %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return fmt.Sprintf("body must be a JSON object, not %s", typeErr.Value)
+		}
+		// Also how out of range numbers are reported, e.g. 1e400 for a float64
+		return fmt.Sprintf("field %q: cannot use %s as %s", typeErr.Field, typeErr.Value, typeErr.Type)
+	case errors.As(err, &timeErr):
+		return fmt.Sprintf("%q is not an RFC3339 timestamp", timeErr.Value)
+	case errors.Is(err, io.EOF):
+		return "request body is empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "request body is truncated"
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for this one
+		return "unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")
+	default:
+		return strings.TrimPrefix(err.Error(), "json: ")
+	}
+}
@@ -0,0 +1,57 @@
+package api_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Bodies that aren't exactly one order object are refused with a
+// VALIDATION_ERROR naming what is wrong: unknown fields, junk nested where a
+// value belongs, trailing data and bodies over the size cap
+func TestPlaceOrderRejectsMalformedBodies(t *testing.T) {
+	server, userID := startServer(t)
+	order := func(extra string) string {
+		return `{"user_id":"` + userID + `","symbol":"BTC-USD","side":"BUY","type":"LIMIT","quantity":0.1,"price":44000` + extra + `}`
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   string
+	}{
+		{"misspelled field", strings.Replace(order(""), `"quantity"`, `"qty"`, 1), http.StatusBadRequest, `unknown field "qty"`},
+		{"extra field", order(`,"leverage":100`), http.StatusBadRequest, `unknown field "leverage"`},
+		{"unknown nested object", order(`,"meta":{"tags":["a",{"b":[1,2,{"c":null}]}]}`), http.StatusBadRequest, `unknown field "meta"`},
+		{"object for a number", strings.Replace(order(""), `"quantity":0.1`, `"quantity":{"value":0.1,"junk":[1,2]}`, 1), http.StatusBadRequest, `field "quantity": cannot use object`},
+		{"array for a string", strings.Replace(order(""), `"symbol":"BTC-USD"`, `"symbol":["BTC-USD",["ETH-USD"]]`, 1), http.StatusBadRequest, `field "symbol": cannot use array`},
+		{"number out of range", strings.Replace(order(""), `"price":44000`, `"price":1e400`, 1), http.StatusBadRequest, `field "price"`},
+		{"array body", `[` + order("") + `]`, http.StatusBadRequest, "body must be a JSON object"},
+		{"trailing object", order("") + order(""), http.StatusBadRequest, "single JSON object"},
+		{"trailing garbage", order("") + `}}}`, http.StatusBadRequest, "single JSON object"},
+		{"truncated", order("")[:40], http.StatusBadRequest, "truncated"},
+		{"empty", ``, http.StatusBadRequest, "empty"},
+		{"oversized", order(`,"client_order_id":"` + strings.Repeat("x", 5000) + `"`), http.StatusRequestEntityTooLarge, "exceeds 4096 bytes"},
+		{"oversized by whitespace", order("") + strings.Repeat(" ", 5000), http.StatusRequestEntityTooLarge, "exceeds 4096 bytes"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, response, _ := post(t, server, "/api/v1/orders", test.body)
+			if status != test.status {
+				t.Fatalf("status = %d, want %d: %+v", status, test.status, response)
+			}
+			if !strings.HasPrefix(response.Error, "VALIDATION_ERROR: ") || !strings.Contains(response.Error, test.want) {
+				t.Errorf("error = %q, want VALIDATION_ERROR naming %q", response.Error, test.want)
+			}
+			if response.Success || response.ErrorCode != "invalid_request" {
+				t.Errorf("response = %+v, want a failure coded invalid_request", response)
+			}
+		})
+	}
+
+	book := server.Exchange.GetOrderBook("BTC-USD", 10)
+	if len(book.Bids)+len(book.Asks) != 0 {
+		t.Errorf("refused bodies reached the book: %+v", book)
+	}
+}
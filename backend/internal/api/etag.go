@@ -0,0 +1,81 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// etagEpoch keeps ETags from one run of the server from matching the next,
+// whose engine sequences start over
+var etagEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// bookETag tags a book read by the engine sequence it was taken at, so it
+// changes exactly when the book does. It is weak because the timestamps in
+// two reads of the same book differ.
+func bookETag(book *domain.OrderBook, depth int) string {
+	return fmt.Sprintf(`W/"%s-%s-%d-%d"`, etagEpoch, book.Symbol, book.Seq, depth)
+}
+
+// respondCacheable is respondJSON for resources clients poll. The response
+// carries etag, or a hash of its body when etag is empty, and a request whose
+// If-None-Match already names it gets an empty 304 instead. Cache-Control:
+// no-cache makes intermediaries revalidate rather than serve a stored copy.
+func respondCacheable(w http.ResponseWriter, r *http.Request, etag string, data interface{}) {
+	var body []byte
+	if etag == "" {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		sum := sha256.Sum256(encoded)
+		etag = `"` + hex.EncodeToString(sum[:12]) + `"`
+		body = append(encoded, '\n')
+	}
+	// The legacy number format is a different representation of the same data
+	if wantsLegacyNumbers(r) {
+		etag = strings.TrimSuffix(etag, `"`) + `-legacy"`
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if body == nil {
+		respondJSON(w, http.StatusOK, data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header names etag, comparing
+// weakly as RFC 9110 requires for GETs
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fetch GETs url, naming etag in If-None-Match if it isn't empty, and returns
+// the response with its body read
+func fetch(t *testing.T, url, etag string) (*http.Response, []byte) {
+	t.Helper()
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, body
+}
+
+// A poll naming the ETag it last got is answered with an empty 304 until the
+// resource changes
+func TestConditionalGets(t *testing.T) {
+	server, _ := startServer(t)
+
+	for _, path := range []string{"/api/v1/tickers", "/api/v1/tickers/BTC-USD", "/api/v1/orderbook/BTC-USD", "/api/v1/orderbook/BTC-USD?number_format=float"} {
+		t.Run(path, func(t *testing.T) {
+			first, body := fetch(t, server.BaseURL+path, "")
+			etag := first.Header.Get("ETag")
+			if first.StatusCode != http.StatusOK || etag == "" || len(body) == 0 {
+				t.Fatalf("first GET: %d with ETag %q and %d bytes", first.StatusCode, etag, len(body))
+			}
+			if cacheControl := first.Header.Get("Cache-Control"); cacheControl != "no-cache" {
+				t.Errorf("Cache-Control = %q, want no-cache", cacheControl)
+			}
+
+			for _, header := range []string{etag, "W/" + strings.TrimPrefix(etag, "W/"), `"other", ` + etag, "*"} {
+				again, body := fetch(t, server.BaseURL+path, header)
+				if again.StatusCode != http.StatusNotModified {
+					t.Errorf("If-None-Match: %s got %d, want 304", header, again.StatusCode)
+				}
+				if len(body) != 0 {
+					t.Errorf("If-None-Match: %s got a %d byte body, want none", header, len(body))
+				}
+				if again.Header.Get("ETag") != etag {
+					t.Errorf("304 ETag = %q, want %q", again.Header.Get("ETag"), etag)
+				}
+			}
+			t.Logf("a poll that hasn't changed costs 0 bytes instead of %d", len(body))
+
+			if stale, _ := fetch(t, server.BaseURL+path, `"stale"`); stale.StatusCode != http.StatusOK {
+				t.Errorf("If-None-Match naming another ETag got %d, want 200", stale.StatusCode)
+			}
+		})
+	}
+}
+
+// The order book's ETag changes with the book and with its representation
+func TestOrderBookETagChangesWithBook(t *testing.T) {
+	server, userID := startServer(t)
+	url := server.BaseURL + "/api/v1/orderbook/BTC-USD"
+
+	before, _ := fetch(t, url, "")
+	etag := before.Header.Get("ETag")
+	if legacy, _ := fetch(t, url+"?number_format=float", ""); legacy.Header.Get("ETag") == etag {
+		t.Errorf("legacy numbers share the ETag %s", etag)
+	}
+	if deeper, _ := fetch(t, url+"?depth=50", ""); deeper.Header.Get("ETag") == etag {
+		t.Errorf("another depth shares the ETag %s", etag)
+	}
+
+	status, response, _ := post(t, server, "/api/v1/orders",
+		`{"user_id":"`+userID+`","symbol":"BTC-USD","side":"BUY","type":"LIMIT","quantity":0.1,"price":44000}`)
+	if status != http.StatusOK {
+		t.Fatalf("placing an order: %d %+v", status, response)
+	}
+
+	after, body := fetch(t, url, etag)
+	if after.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Fatalf("after the book changed, If-None-Match: %s got %d with %d bytes, want 200 with the book", etag, after.StatusCode, len(body))
+	}
+	if after.Header.Get("ETag") == etag {
+		t.Errorf("ETag %s didn't change with the book", etag)
+	}
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	ws "github.com/hft-exchange/backend/internal/websocket"
+)
+
+// Example is one request against the API and the response it produced. A
+// WebSocket example has the method WS: Request is the message the client
+// sends, if any, and Response the first message of type Expect after it.
+type Example struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Request     interface{}       `json:"request,omitempty"`
+	Status      int               `json:"status"`
+	Response    interface{}       `json:"response"`
+
+	// Expect is the type of message a WebSocket example waits for
+	Expect string `json:"-"`
+	// Capture names the orders the response reports, in order, so later
+	// examples can refer to them as {name}
+	Capture []string `json:"-"`
+}
+
+// ExampleFlow groups the examples for one task, successes first
+type ExampleFlow struct {
+	Flow        string    `json:"flow"`
+	Description string    `json:"description"`
+	Examples    []Example `json:"examples"`
+
+	// Setup is run before the examples but not published: requests that put
+	// the exchange in the state they need
+	Setup []Example `json:"-"`
+}
+
+// examplesJSON is what the example fixtures produced when last run against
+// an in-process exchange. TestDocExamples runs them again and fails if
+// anything changed; -update records the new output here.
+//
+//go:embed examples.json
+var examplesJSON []byte
+
+// Session tokens of the example users. The recorder swaps in real ones.
+const (
+	exampleToken           = "<user-1 token>"
+	exampleOtherToken      = "<user-2 token>"
+	exampleShortLivedToken = "<short-lived user-1 token>"
+)
+
+var (
+	userHeaders  = map[string]string{"Authorization": "Bearer " + exampleToken}
+	otherHeaders = map[string]string{"Authorization": "Bearer " + exampleOtherToken, "Content-Type": "application/json"}
+	jsonHeaders  = map[string]string{"Authorization": "Bearer " + exampleToken, "Content-Type": "application/json"}
+)
+
+// misspelledOrder is an order request with "qty" for "quantity"
+const misspelledOrder = `{"user_id":"user-1","symbol":"BTC-USD","side":"BUY","type":"LIMIT","qty":0.5,"price":45000}`
+
+func limitOrder(userID string, side domain.OrderSide, quantity, price float64) PlaceOrderRequest {
+	return PlaceOrderRequest{
+		UserID: userID, Symbol: "BTC-USD", Side: string(side),
+		Type: string(domain.OrderTypeLimit), Quantity: quantity, Price: price,
+	}
+}
+
+func marketBuy(quantity float64) PlaceOrderRequest {
+	return PlaceOrderRequest{
+		UserID: "user-1", Symbol: "BTC-USD", Side: string(domain.OrderSideBuy),
+		Type: string(domain.OrderTypeMarket), Quantity: quantity, Sync: true,
+	}
+}
+
+// ExampleFixtures are the requests the published examples are recorded
+// from, run in order against one exchange listing the default symbols. The
+// users "user-1" and "user-2" hold the starter balances, and the tokens
+// above are theirs; the short-lived one expires a second after it is
+// issued. Responses are left for the recorder to fill in.
+func ExampleFixtures() []ExampleFlow {
+	return []ExampleFlow{
+		{
+			Flow:        "place_limit_order",
+			Description: "Rest a limit order on the book; funds are locked until it fills or is cancelled",
+			Examples: []Example{
+				{
+					Name:        "limit buy",
+					Description: "Buy 0.5 BTC at 45000 or better",
+					Method:      http.MethodPost,
+					Path:        "/api/v1/orders?include_account=false",
+					Headers:     jsonHeaders,
+					Request:     limitOrder("user-1", domain.OrderSideBuy, 0.5, 45000),
+					Capture:     []string{"resting-buy"},
+				},
+				{
+					Name:        "off-tick price",
+					Description: "Prices must be multiples of the symbol's tick size from /api/v1/exchangeInfo",
+					Method:      http.MethodPost,
+					Path:        "/api/v1/orders",
+					Headers:     jsonHeaders,
+					Request:     limitOrder("user-1", domain.OrderSideBuy, 0.5, 45000.005),
+				},
+				{
+					Name:        "insufficient balance",
+					Description: "The order's full cost must be available to lock",
+					Method:      http.MethodPost,
+					Path:        "/api/v1/orders",
+					Headers:     jsonHeaders,
+					Request:     limitOrder("user-1", domain.OrderSideBuy, 10, 45000),
+				},
+				{
+					Name:        "misspelled field",
+					Description: "Unknown fields are rejected rather than ignored, so a typo can't place a zero-quantity order",
+					Method:      http.MethodPost,
+					Path:        "/api/v1/orders",
+					Headers:     jsonHeaders,
+					Request:     json.RawMessage(misspelledOrder),
+				},
+				{
+					Name:        "batch",
+					Description: "Place up to 50 orders at once; each result sits at its order's index, and orders that fail don't stop the rest",
+					Method:      http.MethodPost,
+					Path:        "/api/v1/orders/batch?include_account=false",
+					Headers:     jsonHeaders,
+					Request: PlaceOrderBatchRequest{Orders: []PlaceOrderRequest{
+						limitOrder("user-1", domain.OrderSideBuy, 0.5, 44990),
+						limitOrder("user-1", domain.OrderSideSell, 0.5, 45100),
+						limitOrder("user-1", domain.OrderSideBuy, 10, 44900),
+					}},
+					Capture: []string{"batch-buy", "batch-sell"},
+				},
+			},
+		},
+		{
+			Flow:        "place_market_order",
+			Description: "Take liquidity immediately; sync=true waits for the fills. Quantities are in the base asset.",
+			Setup: []Example{
+				{
+					Method:  http.MethodPost,
+					Path:    "/api/v1/orders?include_account=false",
+					Headers: otherHeaders,
+					Request: limitOrder("user-2", domain.OrderSideSell, 0.5, 45010),
+					Capture: []string{"other-sell"},
+				},
+			},
+			Examples: []Example{
+				{
+					Name:        "synchronous market buy",
+					Description: "Buy 0.25 BTC at the best available prices and return the fills",
+					Method:      http.MethodPost,
+					Path:        "/api/v1/orders?include_account=false",
+					Headers:     jsonHeaders,
+					Request:     marketBuy(0.25),
+					Capture:     []string{"market-buy"},
+				},
+				{
+					Name:        "unknown symbol",
+					Description: "Only symbols listed in /api/v1/exchangeInfo trade",
+					Method:      http.MethodPost,
+					Path:        "/api/v1/orders",
+					Headers:     jsonHeaders,
+					Request: PlaceOrderRequest{
+						UserID: "user-1", Symbol: "DOGE-USD", Side: string(domain.OrderSideBuy),
+						Type: string(domain.OrderTypeMarket), Quantity: 100,
+					},
+				},
+				{
+					Name:        "malformed order",
+					Description: "Every invalid field is reported with a machine-readable code",
+					Method:      http.MethodPost,
+					Path:        "/api/v1/orders",
+					Headers:     jsonHeaders,
+					Request: PlaceOrderRequest{
+						UserID: "user-1", Symbol: "BTC-USD", Side: "HOLD",
+						Type: string(domain.OrderTypeMarket), Quantity: -5, Price: 45000,
+					},
+				},
+			},
+		},
+		{
+			Flow:        "cancel_order",
+			Description: "Cancel a resting order; its locked funds are released once the cancellation is processed",
+			Examples: []Example{
+				{
+					Name:    "cancel",
+					Method:  http.MethodDelete,
+					Path:    "/api/v1/orders/{resting-buy}?symbol=BTC-USD&user_id=user-1",
+					Headers: userHeaders,
+				},
+				{
+					Name:        "already filled or cancelled",
+					Description: "Only resting orders can be cancelled",
+					Method:      http.MethodDelete,
+					Path:        "/api/v1/orders/{market-buy}?symbol=BTC-USD&user_id=user-1",
+					Headers:     userHeaders,
+				},
+				{
+					Name:        "another user's order",
+					Description: "Only admins may cancel orders of users other than user_id",
+					Method:      http.MethodDelete,
+					Path:        "/api/v1/orders/{other-sell}?symbol=BTC-USD&user_id=user-1",
+					Headers:     userHeaders,
+				},
+				{
+					Name:        "batch",
+					Description: "Cancel up to 100 orders at once; each gets its own outcome and the request succeeds even if some don't cancel",
+					Method:      http.MethodPost,
+					Path:        "/api/v1/orders/cancel-batch",
+					Headers:     jsonHeaders,
+					Request: CancelBatchRequest{UserID: "user-1", Orders: []engine.CancelTarget{
+						{OrderID: "{batch-buy}", Symbol: "BTC-USD"},
+						{OrderID: "{market-buy}"},
+						{OrderID: "{resting-buy}"},
+					}},
+				},
+			},
+		},
+		{
+			Flow:        "stream_order_book",
+			Description: "Connect to /ws and subscribe to the channels and symbols wanted; nothing else is sent",
+			Examples: []Example{
+				{
+					Name:        "welcome",
+					Description: "Sent by the server first on every connection, with the protocol version in use",
+					Method:      "WS",
+					Path:        "/ws",
+					Expect:      "welcome",
+				},
+				{
+					Name:        "subscribe",
+					Description: "Sent by the client; acknowledged, with any id it sent, before any of the channel's messages",
+					Method:      "WS",
+					Path:        "/ws",
+					Request:     ws.ClientMessage{Op: ws.OpSubscribe, Channel: ws.ChannelOrderBook, Symbol: "BTC-USD", ID: json.RawMessage(`1`)},
+					Expect:      "ack",
+				},
+				{
+					Name:        "book snapshot",
+					Description: "Sent after the ack, and again whenever the client subscribes again: the book the next diff applies to",
+					Method:      "WS",
+					Path:        "/ws",
+					Expect:      "orderbook",
+				},
+				{
+					Name:        "order placed while subscribed",
+					Description: "Any change to the book's top levels is streamed to its subscribers",
+					Method:      http.MethodPost,
+					Path:        "/api/v1/orders?include_account=false",
+					Headers:     jsonHeaders,
+					Request:     limitOrder("user-1", domain.OrderSideBuy, 0.1, 44950),
+				},
+				{
+					Name:        "book diff",
+					Description: "Applies to the book at prev_seq; a quantity of 0 removes the level",
+					Method:      "WS",
+					Path:        "/ws",
+					Expect:      "orderbook_diff",
+				},
+				{
+					Name:        "unknown channel",
+					Description: "Messages that can't be acted on are answered with an error and a code, and change nothing",
+					Method:      "WS",
+					Path:        "/ws",
+					Request:     ws.ClientMessage{Op: ws.OpSubscribe, Channel: "trade", Symbol: "BTC-USD", ID: json.RawMessage(`2`)},
+					Expect:      "error",
+				},
+			},
+		},
+		{
+			Flow:        "authenticate_stream",
+			Description: "Authenticate a /ws connection for the user channel within 10 seconds of connecting, and renew before the token expires",
+			Examples: []Example{
+				{
+					Name:        "auth",
+					Description: "Sent by the client with a token from POST /api/v1/auth/login; the ack says when it expires",
+					Method:      "WS",
+					Path:        "/ws",
+					Request:     ws.ClientMessage{Op: ws.OpAuth, Token: exampleToken},
+					Expect:      "ack",
+				},
+				{
+					Name:        "bad token",
+					Description: "The connection stays open for public channels",
+					Method:      "WS",
+					Path:        "/ws",
+					Request:     ws.ClientMessage{Op: ws.OpAuth, Token: "not-a-token"},
+					Expect:      "error",
+				},
+				{
+					Name:        "token expired",
+					Description: "Sent when the token runs out; the user's messages stop until an auth op with a new token",
+					Method:      "WS",
+					Path:        "/ws",
+					Request:     ws.ClientMessage{Op: ws.OpAuth, Token: exampleShortLivedToken},
+					Expect:      "auth_expired",
+				},
+			},
+		},
+		{
+			Flow:        "stream_klines",
+			Description: "Subscribe to a symbol's klines of one interval; the forming kline is sent on every trade and once more when it closes",
+			Examples: []Example{
+				{
+					Name:        "subscribe",
+					Description: "Sent by the client with one of the intervals GET /api/v1/klines serves",
+					Method:      "WS",
+					Path:        "/ws",
+					Request:     ws.ClientMessage{Op: ws.OpSubscribe, Channel: ws.ChannelKline, Symbol: "BTC-USD", Interval: "1d"},
+					Expect:      "ack",
+				},
+				{
+					Name:        "trade while subscribed",
+					Description: "Buy 0.1 BTC from the book",
+					Method:      http.MethodPost,
+					Path:        "/api/v1/orders?include_account=false",
+					Headers:     jsonHeaders,
+					Request:     marketBuy(0.1),
+				},
+				{
+					Name:        "forming kline",
+					Description: "Sent on every trade; when the interval ends it is sent once more with closed set, and a late trade re-sends it with correction set",
+					Method:      "WS",
+					Path:        "/ws",
+					Expect:      "kline",
+				},
+				{
+					Name:        "unsupported interval",
+					Description: "Intervals other than 1m, 5m, 1h and 1d are answered with an error",
+					Method:      "WS",
+					Path:        "/ws",
+					Request:     ws.ClientMessage{Op: ws.OpSubscribe, Channel: ws.ChannelKline, Symbol: "BTC-USD", Interval: "3m"},
+					Expect:      "error",
+				},
+			},
+		},
+		{
+			Flow:        "read_fills",
+			Description: "List a user's executed trades, newest first",
+			Examples: []Example{
+				{
+					Name:    "recent fills",
+					Method:  http.MethodGet,
+					Path:    "/api/v1/users/user-1/trades?symbol=BTC-USD&limit=1",
+					Headers: userHeaders,
+				},
+				{
+					Name:        "invalid limit",
+					Description: "limit is capped at the resource's max_limit from /api/v1/meta/resources",
+					Method:      http.MethodGet,
+					Path:        "/api/v1/users/user-1/trades?limit=0",
+					Headers:     userHeaders,
+				},
+			},
+		},
+	}
+}
+
+// GetDocExamples serves request/response examples for the core trading flows
+func (h *Handler) GetDocExamples(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: json.RawMessage(examplesJSON)})
+}
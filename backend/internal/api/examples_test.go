@@ -0,0 +1,355 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/api"
+	"github.com/hft-exchange/backend/internal/repository"
+	ws "github.com/hft-exchange/backend/internal/websocket"
+	"github.com/hft-exchange/backend/internal/wstest"
+)
+
+var update = flag.Bool("update", false, "record the examples served at /api/v1/docs/examples again")
+
+// The examples served at /api/v1/docs/examples are what their fixtures get
+// from a running exchange, so they can't drift from the API. A change in any
+// response fails here; -update records the new ones.
+func TestDocExamples(t *testing.T) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+		t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	server, err := wstest.Start()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	defer server.Close()
+
+	r := newRecorder(ctx, t, server)
+	flows := api.ExampleFixtures()
+	for i := range flows {
+		r.flow(&flows[i])
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(flows); err != nil {
+		t.Fatal(err)
+	}
+	recorded := buf.Bytes()
+
+	if *update {
+		if err := os.WriteFile("examples.json", recorded, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	} else if stored, err := os.ReadFile("examples.json"); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(recorded, stored) {
+		t.Errorf("the examples' responses changed; check the diff of go test ./internal/api -run TestDocExamples -update\ngot:\n%s", recorded)
+	}
+
+	// The endpoint serves what was recorded
+	var served struct {
+		Data interface{} `json:"data"`
+	}
+	r.get("/api/v1/docs/examples", &served)
+	var want interface{}
+	if err := json.Unmarshal(recorded, &want); err != nil {
+		t.Fatal(err)
+	}
+	if !*update && !reflect.DeepEqual(served.Data, want) {
+		t.Errorf("/api/v1/docs/examples serves something other than examples.json")
+	}
+}
+
+// recorder runs examples against a server, filling in what they got. Users,
+// tokens and orders the fixtures name are swapped for the real ones on the
+// way out and back again on the way in; identifiers and times that differ
+// from run to run are replaced by stable stand-ins.
+type recorder struct {
+	ctx    context.Context
+	t      *testing.T
+	server *wstest.Server
+	conn   *wstest.Conn
+
+	// real maps what fixtures say to what the server knows it as, and
+	// shown the other way round. labels numbers the other identifiers, and
+	// streams the first seq seen on each WebSocket stream.
+	real    map[string]string
+	shown   map[string]string
+	labels  map[string]string
+	streams map[string]uint64
+}
+
+func newRecorder(ctx context.Context, t *testing.T, server *wstest.Server) *recorder {
+	r := &recorder{
+		ctx:     ctx,
+		t:       t,
+		server:  server,
+		real:    make(map[string]string),
+		shown:   make(map[string]string),
+		labels:  make(map[string]string),
+		streams: make(map[string]uint64),
+	}
+	for _, name := range []string{"user-1", "user-2"} {
+		userID, token, err := server.User(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.alias(name, userID)
+		r.alias("<"+name+" token>", token)
+	}
+	return r
+}
+
+func (r *recorder) alias(fixture, real string) {
+	r.real[fixture] = real
+	r.shown[real] = fixture
+}
+
+// flow runs a flow's setup and examples on a connection of its own
+func (r *recorder) flow(flow *api.ExampleFlow) {
+	defer func() {
+		if r.conn != nil {
+			r.conn.Close()
+			r.conn = nil
+		}
+	}()
+	for i := range flow.Setup {
+		r.run(&flow.Setup[i])
+	}
+	for i := range flow.Examples {
+		r.run(&flow.Examples[i])
+	}
+}
+
+func (r *recorder) run(example *api.Example) {
+	r.t.Helper()
+	var body []byte
+	if example.Request != nil {
+		var data bytes.Buffer
+		encoder := json.NewEncoder(&data)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(example.Request); err != nil {
+			r.t.Fatal(err)
+		}
+		body = []byte(r.toReal(strings.TrimSpace(data.String())))
+		example.Request = json.RawMessage(r.toShown(string(body)))
+	}
+	path := r.toReal(example.Path)
+	example.Path = r.toShown(path)
+
+	if example.Method == "WS" {
+		example.Status = http.StatusSwitchingProtocols
+		example.Response = json.RawMessage(r.toShown(string(r.message(example.Expect, body))))
+		return
+	}
+
+	request, err := http.NewRequestWithContext(r.ctx, example.Method, r.server.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	for name, value := range example.Headers {
+		request.Header.Set(name, r.toReal(value))
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		r.t.Fatalf("%s %s: %v", example.Method, example.Path, err)
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	example.Status = response.StatusCode
+
+	// Wait for what the request set off to finish, so the next example
+	// sees the exchange as it left it
+	var envelope struct {
+		Data interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		r.t.Fatalf("%s %s answered %s: %v", example.Method, example.Path, data, err)
+	}
+	orders, trades := reported(envelope.Data)
+	if len(orders) < len(example.Capture) {
+		r.t.Fatalf("%s %s reported %d orders, want %d: %s", example.Method, example.Path, len(orders), len(example.Capture), data)
+	}
+	for i, name := range example.Capture {
+		r.real["{"+name+"}"] = orders[i]
+	}
+	if err := r.server.Await(r.ctx, append(orders, trades...)...); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := r.server.AwaitBook(r.ctx, "BTC-USD"); err != nil {
+		r.t.Fatal(err)
+	}
+	example.Response = json.RawMessage(r.toShown(string(data)))
+}
+
+// message sends a WebSocket example's message, if any, and returns the
+// first message of type expect that follows
+func (r *recorder) message(expect string, body []byte) json.RawMessage {
+	r.t.Helper()
+	if r.conn == nil {
+		conn, err := wstest.Dial(r.ctx, r.server.URL, "")
+		if err != nil {
+			r.t.Fatal(err)
+		}
+		r.conn = conn
+	}
+	if body != nil {
+		var message ws.ClientMessage
+		if err := json.Unmarshal(body, &message); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := r.conn.Send(message); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	message, err := r.conn.ExpectType(expect, 5*time.Second)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	if message.Seq == 0 {
+		return message.Raw
+	}
+	// Streams are numbered from a base that differs from hub to hub, so
+	// they're shown counting from 1. Their seq comes before their data's.
+	stream := message.Type + "/" + message.Symbol + "/" + message.Interval
+	first, ok := r.streams[stream]
+	if !ok {
+		first = message.Seq
+		r.streams[stream] = first
+	}
+	seq := `"seq":` + strconv.FormatUint(message.Seq, 10)
+	return json.RawMessage(strings.Replace(string(message.Raw), seq, `"seq":`+strconv.FormatUint(message.Seq-first+1, 10), 1))
+}
+
+func (r *recorder) get(path string, v interface{}) {
+	r.t.Helper()
+	response, err := http.Get(r.server.BaseURL + path)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// toReal swaps the users, tokens and orders fixtures name for the server's.
+// A short-lived token is issued as it's needed, since it wouldn't last
+// otherwise.
+func (r *recorder) toReal(s string) string {
+	if strings.Contains(s, "<short-lived user-1 token>") {
+		token, err := r.server.Login(r.ctx, "user-1", time.Second)
+		if err != nil {
+			r.t.Fatal(err)
+		}
+		r.alias("<short-lived user-1 token>", token)
+	}
+	return replace(s, r.real)
+}
+
+// replace swaps each key of names in s for its value, longest first so
+// "<user-1 token>" isn't taken for "user-1"
+func replace(s string, names map[string]string) string {
+	keys := make([]string, 0, len(names))
+	for key := range names {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	for _, key := range keys {
+		s = strings.ReplaceAll(s, key, names[key])
+	}
+	return s
+}
+
+var (
+	uuidPattern      = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	timestampPattern = regexp.MustCompile(`"\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:\d\d)"`)
+	millisPattern    = regexp.MustCompile(`"ts":\d+`)
+	cursorPattern    = regexp.MustCompile(`"next_cursor":"([^"]+)"`)
+)
+
+// exampleTime stands in for every time in a response
+var exampleTime = time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)
+
+// toShown swaps the server's users and tokens back for the fixtures' names,
+// numbers every other identifier in order of appearance, and sets every
+// time to exampleTime, including those inside pagination cursors
+func (r *recorder) toShown(s string) string {
+	s = replace(s, r.shown)
+	s = cursorPattern.ReplaceAllStringFunc(s, func(match string) string {
+		cursor, err := repository.ParseCursor(cursorPattern.FindStringSubmatch(match)[1])
+		if err != nil {
+			r.t.Fatalf("%s: %v", match, err)
+		}
+		return `"next_cursor":"` + repository.NewCursor(exampleTime, r.label(cursor.ID)).Encode() + `"`
+	})
+	s = uuidPattern.ReplaceAllStringFunc(s, r.label)
+	s = timestampPattern.ReplaceAllString(s, `"`+exampleTime.Format(time.RFC3339)+`"`)
+	return millisPattern.ReplaceAllString(s, `"ts":`+strconv.FormatInt(exampleTime.UnixMilli(), 10))
+}
+
+// label numbers an identifier the first time it is shown
+func (r *recorder) label(id string) string {
+	label, ok := r.labels[id]
+	if !ok {
+		label = fmt.Sprintf("00000000-0000-4000-8000-%012d", len(r.labels)+1)
+		r.labels[id] = label
+	}
+	return label
+}
+
+// reported returns the IDs of the orders a response's data reports, as a
+// placed order or a batch of them, and of the trades they filled with
+func reported(data interface{}) (orders, trades []string) {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, entry := range v {
+			o, t := reported(entry)
+			orders, trades = append(orders, o...), append(trades, t...)
+		}
+	case map[string]interface{}:
+		if order, ok := v["order"]; ok {
+			return reported(order)
+		}
+		id, ok := v["id"].(string)
+		if !ok || v["side"] == nil || v["status"] == nil {
+			return nil, nil
+		}
+		orders = append(orders, id)
+		if execution, ok := v["execution"].(map[string]interface{}); ok {
+			fills, _ := execution["fills"].([]interface{})
+			for _, fill := range fills {
+				if fill, ok := fill.(map[string]interface{}); ok {
+					if id, ok := fill["id"].(string); ok {
+						trades = append(trades, id)
+					}
+				}
+			}
+		}
+	}
+	return orders, trades
+}
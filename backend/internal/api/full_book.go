@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// FullOrderBookRate is how many full books a caller may read per second,
+// on top of what they count towards their overall rate limit
+const FullOrderBookRate = 0.2
+
+// fullBookFlushLevels is how many levels are written between flushes, so a
+// deep book reaches the client as it is written rather than all at the end
+const fullBookFlushLevels = 1000
+
+// fullBookHeader is the first line of an NDJSON full book; the levels follow
+// it, bids then asks, one per line
+type fullBookHeader struct {
+	Symbol    string    `json:"symbol"`
+	Seq       uint64    `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	BidLevels int       `json:"bid_levels"`
+	AskLevels int       `json:"ask_levels"`
+}
+
+// GetFullOrderBook streams every level of a symbol's book, as one JSON
+// response or, with ?format=ndjson, a header line and then a line per level.
+// The book is a single engine snapshot, so every level is as of its seq. It
+// is expensive for deep books, so it needs an API key or the admin scope and
+// has a rate limit of its own.
+func (h *Handler) GetFullOrderBook(w http.ResponseWriter, r *http.Request) {
+	if CallerKey(r) == nil && !h.callerHolds(r, ScopeAdmin) {
+		respondError(w, apierror.New(apierror.Forbidden, "the full order book requires an API key or the admin scope"))
+		return
+	}
+	ndjson, err := fullBookFormat(r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if wait := chargeEndpoint(r, "orderbook/full", FullOrderBookRate); wait > 0 {
+		respondRateLimited(w, wait, "full order book rate limit exceeded")
+		return
+	}
+	book, err := h.exchange.FullOrderBook(mux.Vars(r)["symbol"])
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	header, err := json.Marshal(fullBookHeader{
+		Symbol:    book.Symbol,
+		Seq:       book.Seq,
+		Timestamp: book.Timestamp,
+		BidLevels: len(book.Bids),
+		AskLevels: len(book.Asks),
+	})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// Writing a deep book to a slow client can outlast the write timeout
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Failed to lift write deadline for full order book: %v", err)
+	}
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	out := bufio.NewWriter(w)
+	writer := &bookWriter{out: out, controller: controller, precision: domain.SymbolPrecision(book.Symbol), legacy: wantsLegacyNumbers(r)}
+	if ndjson {
+		err = writer.ndjson(book, header)
+	} else {
+		err = writer.json(book, header)
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		log.Printf("Full order book for %s cut off: %v", book.Symbol, err)
+	}
+}
+
+// fullBookFormat reads ?format=, falling back to NDJSON when it is the only
+// thing the client accepts
+func fullBookFormat(r *http.Request) (bool, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "json":
+		return false, nil
+	case "ndjson":
+		return true, nil
+	case "":
+		return strings.TrimSpace(r.Header.Get("Accept")) == "application/x-ndjson", nil
+	default:
+		return false, apierror.New(apierror.InvalidRequest, "format must be json or ndjson, got %q", format)
+	}
+}
+
+// bookWriter writes a book's levels one at a time, flushing as it goes
+type bookWriter struct {
+	out        *bufio.Writer
+	controller *http.ResponseController
+	precision  domain.Precision
+	// legacy rewrites each level's numbers as floats, which the
+	// response-wide rewrite can't do for a body of many documents or one
+	// flushed as it goes
+	legacy  bool
+	written int
+}
+
+func (b *bookWriter) json(book *domain.OrderBook, header []byte) error {
+	b.out.WriteString(`{"success":true,"data":`)
+	b.out.Write(header[:len(header)-1])
+	b.out.WriteString(`,"bids":[`)
+	if err := b.levels(book.Bids, ",", ""); err != nil {
+		return err
+	}
+	b.out.WriteString(`],"asks":[`)
+	if err := b.levels(book.Asks, ",", ""); err != nil {
+		return err
+	}
+	_, err := b.out.WriteString("]}}\n")
+	return err
+}
+
+func (b *bookWriter) ndjson(book *domain.OrderBook, header []byte) error {
+	b.out.Write(header)
+	b.out.WriteByte('\n')
+	if err := b.levels(book.Bids, "\n", "bid"); err != nil {
+		return err
+	}
+	if len(book.Bids) > 0 {
+		b.out.WriteByte('\n')
+	}
+	if err := b.levels(book.Asks, "\n", "ask"); err != nil {
+		return err
+	}
+	if len(book.Asks) > 0 {
+		b.out.WriteByte('\n')
+	}
+	return nil
+}
+
+// levels writes levels with sep between them. A side, when given, is added
+// to each level so an NDJSON line stands on its own.
+func (b *bookWriter) levels(levels []domain.OrderBookLevel, sep, side string) error {
+	for i, level := range levels {
+		encoded, err := domain.MarshalBookLevel(level, b.precision)
+		if err != nil {
+			return err
+		}
+		if side != "" {
+			encoded = append([]byte(`{"side":"`+side+`",`), encoded[1:]...)
+		}
+		if b.legacy {
+			if rewritten, err := domain.LegacyNumbers(encoded); err == nil {
+				encoded = rewritten
+			}
+		}
+		if i > 0 {
+			b.out.WriteString(sep)
+		}
+		if _, err := b.out.Write(encoded); err != nil {
+			return err
+		}
+
+		b.written++
+		if b.written%fullBookFlushLevels == 0 {
+			if err := b.out.Flush(); err != nil {
+				return err
+			}
+			// Writers that can't flush send the response whole at the end
+			if err := b.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// FundingRequest deposits or withdraws an amount of one asset
+type FundingRequest struct {
+	Asset  string  `json:"asset"`
+	Amount float64 `json:"amount"`
+}
+
+// CreateDeposit credits funds to a user's available balance, e.g. from the
+// demo faucet
+func (h *Handler) CreateDeposit(w http.ResponseWriter, r *http.Request) {
+	h.fund(w, r, engine.FundingDeposit)
+}
+
+// CreateWithdrawal debits funds from a user's available balance. Funds
+// locked by open orders can't be withdrawn.
+func (h *Handler) CreateWithdrawal(w http.ResponseWriter, r *http.Request) {
+	h.fund(w, r, engine.FundingWithdrawal)
+}
+
+func (h *Handler) fund(w http.ResponseWriter, r *http.Request, kind string) {
+	var req FundingRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+	if errs := req.Validate(); len(errs) > 0 {
+		respondInvalid(w, errs)
+		return
+	}
+
+	userID := mux.Vars(r)["userId"]
+	move := h.exchange.Deposit
+	if kind == engine.FundingWithdrawal {
+		move = h.exchange.Withdraw
+	}
+	funding, err := move(r.Context(), userID, req.Asset, req.Amount)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("AUDIT: %s of %v %s for %s by %s: ledger %s",
+		strings.ToLower(kind), req.Amount, req.Asset, userID, r.RemoteAddr, funding.LedgerID)
+	respondJSON(w, http.StatusCreated, Response{Success: true, Data: funding})
+}
@@ -1,23 +1,62 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/hft-exchange/backend/internal/accounts"
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/cache"
+	"github.com/hft-exchange/backend/internal/candles"
+	"github.com/hft-exchange/backend/internal/capacity"
 	"github.com/hft-exchange/backend/internal/domain"
 	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/idempotency"
+	"github.com/hft-exchange/backend/internal/notify"
+	"github.com/hft-exchange/backend/internal/orderfeed"
 	"github.com/hft-exchange/backend/internal/repository"
+	"github.com/hft-exchange/backend/internal/subsystem"
 )
 
 type Handler struct {
 	exchange     *engine.Exchange
+	db           *sql.DB
+	redis        *cache.RedisCache
 	orderRepo    *repository.OrderRepository
 	tradeRepo    *repository.TradeRepository
 	balanceRepo  *repository.BalanceRepository
 	tickerRepo   *repository.TickerRepository
+	positionRepo *repository.PositionRepository
+	replayWindow time.Duration
+	replication  ReplicationController
+	marketData   *cache.MarketData
+	candles      *candles.Service
+	symbolManager SymbolManager
+	subsystems   *subsystem.Registry
+	notifications *notify.Dispatcher
+	accounts     *accounts.Service
+	users        *repository.UserRepository
+	idempotency  idempotency.Store
+	capacity     *capacity.Planner
+	orderFeed    *orderfeed.Feed
+	bots         map[string]BotReporter
+	orderBookMaxAge time.Duration
+	auth         *Auth
+	orderBodyLimit int64
+	bodyLimit      int64
+	slowRequest    time.Duration
+	cors           CORSConfig
+	proxyHeader    string
 }
 
 func NewHandler(
@@ -26,16 +65,36 @@ func NewHandler(
 	tradeRepo *repository.TradeRepository,
 	balanceRepo *repository.BalanceRepository,
 	tickerRepo *repository.TickerRepository,
+	positionRepo *repository.PositionRepository,
 ) *Handler {
 	return &Handler{
-		exchange:    exchange,
-		orderRepo:   orderRepo,
-		tradeRepo:   tradeRepo,
-		balanceRepo: balanceRepo,
-		tickerRepo:  tickerRepo,
+		exchange:     exchange,
+		orderRepo:    orderRepo,
+		tradeRepo:    tradeRepo,
+		balanceRepo:  balanceRepo,
+		tickerRepo:   tickerRepo,
+		positionRepo: positionRepo,
+		replayWindow: engine.DefaultReplayWindow,
+		orderBodyLimit: DefaultOrderBodyLimit,
+		bodyLimit:      DefaultBodyLimit,
+		slowRequest:    DefaultSlowRequest,
+		orderBookMaxAge: DefaultOrderBookMaxAge,
+		cors:            DefaultCORSConfig(),
 	}
 }
 
+// SetReplayWindow bounds how far back historical book reconstruction may reach
+func (h *Handler) SetReplayWindow(window time.Duration) {
+	if window > 0 {
+		h.replayWindow = window
+	}
+}
+
+// SetMarketData serves books, tickers and recent trades through the cache
+func (h *Handler) SetMarketData(marketData *cache.MarketData) {
+	h.marketData = marketData
+}
+
 type PlaceOrderRequest struct {
 	UserID    string  `json:"user_id"`
 	Symbol    string  `json:"symbol"`
@@ -44,18 +103,77 @@ type PlaceOrderRequest struct {
 	Quantity  float64 `json:"quantity"`
 	Price     float64 `json:"price"`
 	StopPrice float64 `json:"stop_price,omitempty"`
+	// Sync waits for initial matching and returns the resulting fills
+	Sync bool `json:"sync,omitempty"`
+}
+
+// syncOrderTimeout bounds how long a synchronous submission waits for matching
+const syncOrderTimeout = 2 * time.Second
+
+// PendingOrder answers a synchronous submission still matching when
+// syncOrderTimeout runs out. The order was accepted, and what becomes of it
+// arrives as order updates.
+type PendingOrder struct {
+	ID string `json:"id"`
+	// Status is always "accepted"
+	Status string `json:"status"`
+}
+
+// PlacedOrder is an accepted order along with the caller's resulting exposure
+// and, for synchronous submissions, what it executed immediately
+type PlacedOrder struct {
+	*domain.Order
+	Execution *ExecutionResult       `json:"execution,omitempty"`
+	Account   *engine.AccountSummary `json:"account,omitempty"`
+	// Warnings lists the soft risk limits this order took the caller past
+	Warnings []engine.RiskWarning `json:"warnings,omitempty"`
+}
+
+// MarshalJSON keeps the order's fields at the top level next to the extras;
+// without it the embedded order's own MarshalJSON would drop them
+func (p PlacedOrder) MarshalJSON() ([]byte, error) {
+	order, err := json.Marshal(p.Order)
+	if err != nil {
+		return nil, err
+	}
+	extras, err := json.Marshal(struct {
+		Execution *ExecutionResult       `json:"execution,omitempty"`
+		Account   *engine.AccountSummary `json:"account,omitempty"`
+		Warnings  []engine.RiskWarning   `json:"warnings,omitempty"`
+	}{p.Execution, p.Account, p.Warnings})
+	if err != nil {
+		return nil, err
+	}
+	if len(extras) == len("{}") {
+		return order, nil
+	}
+	return append(append(order[:len(order)-1], ','), extras[1:]...), nil
+}
+
+type ExecutionResult struct {
+	AvgPrice float64         `json:"avg_price"`
+	Fills    []*domain.Trade `json:"fills"`
 }
 
 type Response struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	// ErrorCode classifies Error; see the apierror package for the codes
+	ErrorCode  apierror.Code `json:"error_code,omitempty"`
+	Pagination *Pagination   `json:"pagination,omitempty"`
 }
 
 func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 	var req PlaceOrderRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondJSON(w, http.StatusBadRequest, Response{Success: false, Error: "Invalid request body"})
+	if !decodeBody(w, r, &req, h.orderBodyLimit) {
+		return
+	}
+	if errs := req.Validate(h.isListed); len(errs) > 0 {
+		respondInvalid(w, errs)
+		return
+	}
+	if !h.mayNameUser(w, r) || !actsFor(w, r, req.UserID) {
 		return
 	}
 
@@ -71,157 +189,724 @@ func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 	if req.StopPrice > 0 {
 		order.StopPrice = req.StopPrice
 	}
+	order.RequestID = RequestID(r)
+
+	placed := PlacedOrder{Order: order}
+	var err error
+	if req.Sync || r.URL.Query().Get("sync") == "true" {
+		ctx, cancel := context.WithTimeout(r.Context(), syncOrderTimeout)
+		var report *engine.ExecutionReport
+		report, err = h.exchange.SubmitOrderSync(ctx, order)
+		cancel()
+		if errors.Is(err, engine.ErrExecutionTimeout) {
+			respondJSON(w, http.StatusAccepted, Response{Success: true, Data: PendingOrder{ID: order.ID, Status: "accepted"}})
+			return
+		}
+		if err == nil {
+			placed.Order = &report.Order
+			placed.Execution = &ExecutionResult{AvgPrice: report.AvgPrice, Fills: report.Fills}
+			placed.Warnings = report.Warnings
+		}
+	} else {
+		placed.Warnings, err = h.exchange.SubmitOrderWithWarnings(r.Context(), order)
+	}
+
+	if err != nil {
+		var limitErr *engine.RiskLimitError
+		if errors.As(err, &limitErr) {
+			respondErrorData(w, err, limitErr)
+			return
+		}
+		respondError(w, err)
+		return
+	}
 
-	if err := h.exchange.SubmitOrder(order); err != nil {
-		respondJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+	if r.URL.Query().Get("include_account") != "false" {
+		account, err := h.exchange.AccountSummary(r.Context(), order.UserID, order.Symbol)
+		if err != nil {
+			log.Printf("Failed to build account summary for %s: %v request_id=%s", order.UserID, err, order.RequestID)
+		} else {
+			placed.Account = account
+		}
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: placed})
+}
+
+// PlaceOrderBatchRequest places up to engine.MaxOrderBatch orders at once.
+// Each entry is checked on its own; with AllOrNothing, one malformed entry
+// rejects the whole batch and none are placed.
+type PlaceOrderBatchRequest struct {
+	Orders       []PlaceOrderRequest `json:"orders"`
+	AllOrNothing bool                `json:"all_or_nothing,omitempty"`
+}
+
+// BatchOrderResult is what became of the order at Index of a batch: the
+// order as accepted, or why it wasn't. Fields lists what was wrong with an
+// entry that failed validation.
+type BatchOrderResult struct {
+	Index     int           `json:"index"`
+	Success   bool          `json:"success"`
+	Order     *PlacedOrder  `json:"order,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	ErrorCode apierror.Code `json:"error_code,omitempty"`
+	Fields    []FieldError  `json:"fields,omitempty"`
+}
+
+// PlaceOrderBatch places several orders and reports each one's outcome at
+// its position in the request. Entries that fail are a normal, successful
+// response unless all_or_nothing is set and one was malformed. The batch
+// counts as one request per order against the caller's rate limit.
+func (h *Handler) PlaceOrderBatch(w http.ResponseWriter, r *http.Request) {
+	var req PlaceOrderBatchRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+	if errs := req.Validate(); len(errs) > 0 {
+		respondInvalid(w, errs)
+		return
+	}
+	if !h.mayNameUser(w, r) {
+		return
+	}
+	// The middleware already charged the request itself
+	if wait := chargeRequests(r, len(req.Orders)-1); wait > 0 {
+		respondRateLimited(w, wait, fmt.Sprintf("rate limit exceeded: a batch of %d orders counts as %d requests", len(req.Orders), len(req.Orders)))
 		return
 	}
 
-	respondJSON(w, http.StatusOK, Response{Success: true, Data: order})
+	results := make([]BatchOrderResult, len(req.Orders))
+	orders := make([]*domain.Order, 0, len(req.Orders))
+	positions := make([]int, 0, len(req.Orders))
+	malformed := false
+	for i := range req.Orders {
+		entry := &req.Orders[i]
+		results[i].Index = i
+		if errs := entry.Validate(h.isListed); len(errs) > 0 {
+			results[i].fail(invalid(errs))
+			results[i].Fields = errs
+			malformed = true
+			continue
+		}
+		if caller := CallerUser(r); caller != "" && caller != entry.UserID {
+			results[i].fail(apierror.New(apierror.Forbidden, "this token is not valid for user %s", entry.UserID))
+			malformed = true
+			continue
+		}
+
+		order := domain.NewOrder(
+			entry.UserID,
+			entry.Symbol,
+			domain.OrderSide(entry.Side),
+			domain.OrderType(entry.Type),
+			entry.Quantity,
+			entry.Price,
+		)
+		if entry.StopPrice > 0 {
+			order.StopPrice = entry.StopPrice
+		}
+		order.RequestID = RequestID(r)
+		orders = append(orders, order)
+		positions = append(positions, i)
+	}
+	if malformed && req.AllOrNothing {
+		respondErrorData(w, &apierror.Error{
+			Code:    apierror.InvalidRequest,
+			Status:  http.StatusUnprocessableEntity,
+			Message: "all_or_nothing batch has invalid orders; none were placed",
+		}, results)
+		return
+	}
+
+	submitted, err := h.exchange.SubmitOrders(r.Context(), orders)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	for i, outcome := range submitted {
+		result := &results[positions[i]]
+		if outcome.Err != nil {
+			result.fail(outcome.Err)
+			continue
+		}
+		order := outcome.Order
+		result.Success = true
+		result.Order = &PlacedOrder{Order: &order, Warnings: outcome.Warnings}
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: results})
 }
 
+// fail records why an entry of a batch wasn't placed
+func (result *BatchOrderResult) fail(err error) {
+	apiErr := apierror.From(err)
+	result.Error, result.ErrorCode = apiErr.Message, apiErr.Code
+}
+
+// isListed reports whether the exchange trades symbol
+func (h *Handler) isListed(symbol string) bool {
+	_, ok := h.exchange.SymbolConfig(symbol)
+	return ok
+}
+
+// CancelOrder cancels one resting order. Callers may only cancel their
+// session token's user's orders or, in dev mode without a token, those of
+// ?user_id=. Admins may cancel anyone's.
 func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	orderID := vars["id"]
 	symbol := r.URL.Query().Get("symbol")
 
-	success := h.exchange.CancelOrder(orderID, symbol)
-	if !success {
-		respondJSON(w, http.StatusNotFound, Response{Success: false, Error: "Order not found"})
+	userID, ok := h.orderOwner(w, r, r.URL.Query().Get("user_id"))
+	if !ok {
+		return
+	}
+
+	if err := h.exchange.CancelOrder(r.Context(), orderID, symbol, userID); err != nil {
+		respondError(w, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, Response{Success: true})
 }
 
+// GetOrderFills lists the executions of one order, oldest first. Like
+// cancels, callers may only see their session token's user's orders or, in
+// dev mode without a token, those of ?user_id=. Admins may see anyone's.
+func (h *Handler) GetOrderFills(w http.ResponseWriter, r *http.Request) {
+	orderID := mux.Vars(r)["id"]
+	query, err := orderFillsResource.Parse(r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	userID, ok := h.orderOwner(w, r, query.Filters["user_id"])
+	if !ok {
+		return
+	}
+
+	order, err := h.orderRepo.GetOrderByID(r.Context(), orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, apierror.New(apierror.OrderNotFound, "order %s not found", orderID))
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if userID != "" && order.UserID != userID {
+		respondError(w, apierror.New(apierror.Forbidden, "order %s belongs to another user", orderID))
+		return
+	}
+
+	trades, err := h.tradeRepo.GetTradesByOrderID(r.Context(), orderID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	// Fills aren't paged by cursor; the oldest up to the limit are returned
+	page := &Pagination{Limit: query.Limit, MaxLimit: query.MaxLimit, HasMore: len(trades) > query.Limit}
+	if page.HasMore {
+		trades = trades[:query.Limit]
+	}
+	fills := make([]domain.Fill, len(trades))
+	for i, trade := range trades {
+		fills[i] = domain.FillOf(trade, orderID)
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: fills, Pagination: page})
+}
+
+// CancelBatchRequest names up to engine.MaxCancelBatch orders of one user to
+// cancel. Giving each order's symbol saves looking it up.
+type CancelBatchRequest struct {
+	UserID string                `json:"user_id"`
+	Orders []engine.CancelTarget `json:"orders"`
+}
+
+// CancelOrderBatch cancels several of a user's orders and reports each one's
+// outcome. Some orders failing to cancel is a normal, successful response.
+func (h *Handler) CancelOrderBatch(w http.ResponseWriter, r *http.Request) {
+	var req CancelBatchRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+	if errs := req.Validate(); len(errs) > 0 {
+		respondInvalid(w, errs)
+		return
+	}
+	if _, ok := h.orderOwner(w, r, req.UserID); !ok {
+		return
+	}
+	if !actsFor(w, r, req.UserID) {
+		return
+	}
+
+	results, err := h.exchange.CancelOrders(r.Context(), req.UserID, req.Orders)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: results})
+}
+
+// CancelUserOrders cancels all of a user's open orders, optionally only on
+// one symbol
+func (h *Handler) CancelUserOrders(w http.ResponseWriter, r *http.Request) {
+	if !h.mayNameUser(w, r) {
+		return
+	}
+	userID := mux.Vars(r)["userId"]
+	h.cancelAll(w, userID, r.URL.Query().Get("symbol"))
+}
+
+func (h *Handler) cancelAll(w http.ResponseWriter, userID, symbol string) {
+	cancelled, err := h.exchange.CancelAll(userID, symbol)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: map[string]int{"cancelled": cancelled}})
+}
+
+// Where an OrderBookResponse was read from
+const (
+	OrderBookFromCache  = "cache"
+	OrderBookFromEngine = "engine"
+)
+
+// OrderBookResponse is a book along with where it came from and when it was
+// taken
+type OrderBookResponse struct {
+	*domain.OrderBook
+	Source   string    `json:"source"`
+	AsOf     time.Time `json:"as_of"`
+	Depth    int       `json:"depth"`
+	MaxDepth int       `json:"max_depth"`
+}
+
+// MarshalJSON appends the response fields to the book's own encoding, which
+// would otherwise be promoted from the embedded book and leave them out
+func (o OrderBookResponse) MarshalJSON() ([]byte, error) {
+	book, err := json.Marshal(o.OrderBook)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := json.Marshal(struct {
+		Source   string    `json:"source"`
+		AsOf     time.Time `json:"as_of"`
+		Depth    int       `json:"depth"`
+		MaxDepth int       `json:"max_depth"`
+	}{o.Source, o.AsOf, o.Depth, o.MaxDepth})
+	if err != nil {
+		return nil, err
+	}
+	merged := append(bytes.TrimSuffix(book, []byte("}")), ',')
+	return append(merged, fields[1:]...), nil
+}
+
+// Levels per side a book read returns by default, and at most
+const (
+	DefaultOrderBookDepth = 20
+	MaxOrderBookDepth     = 500
+)
+
+// DefaultOrderBookMaxAge is how old a cached book may be by default
+const DefaultOrderBookMaxAge = 500 * time.Millisecond
+
+// SetOrderBookMaxAge sets how old a cached book may be and still be served;
+// older ones are rebuilt from the engine. 0 serves any cached book.
+func (h *Handler) SetOrderBookMaxAge(maxAge time.Duration) {
+	h.orderBookMaxAge = maxAge
+}
+
 func (h *Handler) GetOrderBook(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	symbol := vars["symbol"]
 	
-	depthStr := r.URL.Query().Get("depth")
-	depth := 20
-	if depthStr != "" {
-		if d, err := strconv.Atoi(depthStr); err == nil {
-			depth = d
+	depth, err := parseLimit(r, "depth", DefaultOrderBookDepth, MaxOrderBookDepth)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// The cache holds OrderBookDepth levels; deeper reads go to the engine
+	if h.marketData != nil && depth <= cache.OrderBookDepth {
+		orderBook, cached, err := h.marketData.OrderBook(r.Context(), symbol, h.orderBookMaxAge)
+		if err == nil {
+			truncated := *orderBook
+			if len(truncated.Bids) > depth {
+				truncated.Bids = truncated.Bids[:depth]
+			}
+			if len(truncated.Asks) > depth {
+				truncated.Asks = truncated.Asks[:depth]
+			}
+			source := OrderBookFromEngine
+			if cached {
+				source = OrderBookFromCache
+			}
+			respondCacheable(w, r, bookETag(&truncated, depth), Response{Success: true, Data: OrderBookResponse{
+				OrderBook: &truncated,
+				Source:    source,
+				AsOf:      truncated.Timestamp,
+				Depth:     depth,
+				MaxDepth:  MaxOrderBookDepth,
+			}})
+			return
 		}
+		log.Printf("Cached order book read failed for %s: %v", symbol, err)
 	}
 
 	orderBook := h.exchange.GetOrderBook(symbol, depth)
-	respondJSON(w, http.StatusOK, Response{Success: true, Data: orderBook})
+	respondCacheable(w, r, bookETag(orderBook, depth), Response{Success: true, Data: OrderBookResponse{
+		OrderBook: orderBook,
+		Source:    OrderBookFromEngine,
+		AsOf:      orderBook.Timestamp,
+		Depth:     depth,
+		MaxDepth:  MaxOrderBookDepth,
+	}})
+}
+
+// GetDepth returns a symbol's book grouped into buckets ?step= wide (default
+// the tick size), up to ?depth= buckets a side. Grouping needs every level,
+// so it reads the engine rather than the cached top of the book.
+func (h *Handler) GetDepth(w http.ResponseWriter, r *http.Request) {
+	symbol := mux.Vars(r)["symbol"]
+	config, ok := h.exchange.SymbolConfig(symbol)
+	if !ok {
+		respondError(w, apierror.New(apierror.UnknownSymbol, "unknown symbol: %s", symbol))
+		return
+	}
+
+	step := config.TickSize
+	if value := r.URL.Query().Get("step"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			respondError(w, apierror.New(apierror.InvalidRequest, "step must be a positive number"))
+			return
+		}
+		step = parsed
+	}
+	depth, err := parseLimit(r, "depth", DefaultOrderBookDepth, MaxOrderBookDepth)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	grouped, err := domain.GroupOrderBook(h.exchange.GetOrderBook(symbol, math.MaxInt), step, depth)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: grouped})
 }
 
 func (h *Handler) GetRecentTrades(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	symbol := vars["symbol"]
-	
-	limitStr := r.URL.Query().Get("limit")
-	limit := 20 // Default to 20 trades (was 50)
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil {
-			limit = l
-			// Cap at 20 max to prevent UI overflow
-			if limit > 20 {
-				limit = 20
-			}
+
+	query, err := recentTradesResource.Parse(r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	filter := repository.TradeFilter{
+		After:  query.Time("after"),
+		Before: query.Time("before"),
+		Cursor: query.Cursor,
+	}
+	if query.Bool("aggregate") {
+		h.getAggregatedTrades(w, r, symbol, query, filter)
+		return
+	}
+
+	// One extra trade is read to tell whether another page follows. Only
+	// unfiltered first pages within the cached list can come from the cache.
+	var trades []*domain.Trade
+	cached := false
+	if h.marketData != nil && filter == (repository.TradeFilter{}) && query.Limit < cache.RecentTradesDepth {
+		trades, cached = h.marketData.RecentTrades(symbol, query.Limit+1)
+	}
+	if !cached {
+		trades, err = h.tradeRepo.GetRecentTrades(r.Context(), symbol, query.Limit+1, filter)
+		if err != nil {
+			respondError(w, err)
+			return
 		}
 	}
 
-	trades, err := h.tradeRepo.GetRecentTrades(symbol, limit)
+	n, page := paginate(query, len(trades), func(i int) *repository.Cursor {
+		return repository.NewCursor(trades[i].ExecutedAt, trades[i].ID)
+	})
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: trades[:n], Pagination: page})
+}
+
+// getAggregatedTrades serves the tape with each taker order's consecutive
+// trades summed into one print. Trades are read from the database a batch
+// at a time until a print past the limit has begun, so the last print
+// returned is complete, and pages continue from its oldest trade.
+func (h *Handler) getAggregatedTrades(w http.ResponseWriter, r *http.Request, symbol string, query *ListQuery, filter repository.TradeFilter) {
+	batch := recentTradesResource.MaxLimit
+	prints := make([]*domain.AggregatedTrade, 0)
+	for {
+		trades, err := h.tradeRepo.GetRecentTrades(r.Context(), symbol, batch, filter)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		prints = domain.AppendAggregatedTrades(prints, trades)
+		if len(trades) < batch || len(prints) > query.Limit {
+			break
+		}
+		oldest := trades[len(trades)-1]
+		filter.Cursor = repository.NewCursor(oldest.ExecutedAt, oldest.ID)
+	}
+
+	n, page := paginate(query, len(prints), func(i int) *repository.Cursor {
+		return repository.NewCursor(prints[i].FirstExecutedAt, prints[i].FirstTradeID)
+	})
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: prints[:n], Pagination: page})
+}
+
+// GetKlines returns a symbol's OHLCV candles, oldest first
+func (h *Handler) GetKlines(w http.ResponseWriter, r *http.Request) {
+	if h.candles == nil {
+		respondError(w, apierror.New(apierror.NotFound, "candle service is not enabled"))
+		return
+	}
+
+	symbol := mux.Vars(r)["symbol"]
+	if !h.isListed(symbol) {
+		respondError(w, apierror.New(apierror.UnknownSymbol, "unknown symbol: %s", symbol))
+		return
+	}
+
+	query, err := klinesResource.Parse(r)
 	if err != nil {
-		respondJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		respondError(w, err)
 		return
 	}
+	interval := query.Filters["interval"]
+	if interval == "" {
+		interval = candles.Intervals[0]
+	}
 
-	respondJSON(w, http.StatusOK, Response{Success: true, Data: trades})
+	klines, err := h.candles.Klines(r.Context(), symbol, interval, query.Time("start"), query.Time("end"), query.Limit)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// Klines aren't paged by cursor, but report their limit like other lists
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: klines, Pagination: &Pagination{Limit: query.Limit, MaxLimit: query.MaxLimit}})
 }
 
 func (h *Handler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["userId"]
-	
-	limitStr := r.URL.Query().Get("limit")
-	limit := 50
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil {
-			limit = l
-		}
+
+	query, err := userOrdersResource.Parse(r)
+	if err != nil {
+		respondError(w, err)
+		return
 	}
 
-	orders, err := h.orderRepo.GetOrdersByUser(userID, limit)
+	orders, err := h.orderRepo.GetOrdersByUser(r.Context(), userID, query.Limit+1, repository.OrderFilter{
+		Symbol:   query.Filters["symbol"],
+		Side:     query.Filters["side"],
+		Statuses: query.Values("status"),
+		Start:    query.Time("start"),
+		End:      query.Time("end"),
+		Before:   query.Cursor,
+	})
 	if err != nil {
-		log.Printf("ERROR getting orders: %v", err)
-		respondJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, Response{Success: true, Data: orders})
+	n, page := paginate(query, len(orders), func(i int) *repository.Cursor {
+		return repository.NewCursor(orders[i].CreatedAt, orders[i].ID)
+	})
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: orders[:n], Pagination: page})
 }
 
-func (h *Handler) GetUserTrades(w http.ResponseWriter, r *http.Request) {
+// GetUserOpenOrders returns a user's open orders from the engine's index,
+// with live remaining quantities. While symbols are still recovering it
+// falls back to the database.
+func (h *Handler) GetUserOpenOrders(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["userId"]
-	
-	limitStr := r.URL.Query().Get("limit")
-	limit := 50
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil {
-			limit = l
+	symbol := r.URL.Query().Get("symbol")
+
+	open, err := h.exchange.GetOpenOrders(userID, symbol)
+	if errors.Is(err, engine.ErrExchangeStarting) {
+		open, err = h.storedOpenOrders(r.Context(), userID, symbol)
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: open})
+}
+
+// storedOpenOrders reads a user's open orders from the database, which may
+// trail the engines slightly
+func (h *Handler) storedOpenOrders(ctx context.Context, userID, symbol string) (*engine.OpenOrders, error) {
+	stored, err := h.orderRepo.GetUserOpenOrders(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	open := &engine.OpenOrders{
+		Orders:    make([]*domain.Order, 0, len(stored)),
+		Sequences: make(map[string]uint64),
+		Source:    engine.OpenOrdersFromDatabase,
+	}
+	for _, order := range stored {
+		if symbol == "" || order.Symbol == symbol {
+			open.Orders = append(open.Orders, order)
 		}
 	}
+	return open, nil
+}
 
-	trades, err := h.tradeRepo.GetUserTrades(userID, limit)
+func (h *Handler) GetUserTrades(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["userId"]
+
+	query, err := userTradesResource.Parse(r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	trades, err := h.tradeRepo.GetUserTrades(r.Context(), userID, query.Limit+1, query.Filters["symbol"], query.Cursor)
 	if err != nil {
-		respondJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, Response{Success: true, Data: trades})
+	n, page := paginate(query, len(trades), func(i int) *repository.Cursor {
+		return repository.NewCursor(trades[i].ExecutedAt, trades[i].ID)
+	})
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: trades[:n], Pagination: page})
 }
 
 func (h *Handler) GetUserBalances(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["userId"]
 
-	balances, err := h.balanceRepo.GetAllBalances(userID)
+	balances, err := h.balanceRepo.GetAllBalances(r.Context(), userID)
 	if err != nil {
-		log.Printf("ERROR getting balances: %v", err)
-		respondJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, Response{Success: true, Data: balances})
 }
 
+func (h *Handler) GetUserPositions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["userId"]
+
+	positions, err := h.positionRepo.GetUserPositions(r.Context(), userID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// Unrealized PnL is marked against the latest price
+	for _, position := range positions {
+		if price, ok := h.markPrice(r.Context(), position.Symbol); ok {
+			position.MarkToMarket(price)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: positions})
+}
+
+// GetUserStats reports a user's exposure and risk limit utilization on one
+// symbol, or on every symbol when none is given
+func (h *Handler) GetUserStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["userId"]
+
+	symbols := h.exchange.GetAllSymbols()
+	if symbol := r.URL.Query().Get("symbol"); symbol != "" {
+		symbols = []string{symbol}
+	}
+
+	summaries := make([]*engine.AccountSummary, 0, len(symbols))
+	for _, symbol := range symbols {
+		summary, err := h.exchange.AccountSummary(r.Context(), userID, symbol)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		summaries = append(summaries, summary)
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: summaries})
+}
+
 func (h *Handler) GetTicker(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	symbol := vars["symbol"]
 
-	ticker, err := h.tickerRepo.GetTicker(symbol)
+	var ticker *domain.Ticker
+	var err error
+	if h.marketData != nil {
+		ticker, err = h.marketData.Ticker(r.Context(), symbol)
+	} else {
+		ticker, err = h.tickerRepo.GetTicker(r.Context(), symbol)
+	}
 	if err != nil {
-		respondJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, Response{Success: true, Data: ticker})
+	respondCacheable(w, r, "", Response{Success: true, Data: ticker})
 }
 
 func (h *Handler) GetAllTickers(w http.ResponseWriter, r *http.Request) {
-	tickers, err := h.tickerRepo.GetAllTickers()
+	tickers, err := h.tickerRepo.GetAllTickers(r.Context())
 	if err != nil {
-		respondJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		respondError(w, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, Response{Success: true, Data: tickers})
+	respondCacheable(w, r, "", Response{Success: true, Data: tickers})
 }
 
 func (h *Handler) GetSymbols(w http.ResponseWriter, r *http.Request) {
-	symbols := h.exchange.GetAllSymbols()
-	respondJSON(w, http.StatusOK, Response{Success: true, Data: symbols})
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: h.exchange.SymbolStatuses()})
+}
+
+// GetSymbolStatuses reports every symbol's trading state, delisted ones
+// included
+func (h *Handler) GetSymbolStatuses(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: h.exchange.AllSymbolStatuses()})
 }
 
-func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, Response{Success: true, Data: map[string]string{"status": "healthy"}})
+// GetSymbolStatus reports a symbol's trading state, why it is in it, since
+// when, and the next scheduled change if there is one
+func (h *Handler) GetSymbolStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.exchange.SymbolStatus(mux.Vars(r)["symbol"])
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: status})
+}
+
+// GetExchangeInfo lists every trading pair with its assets, increments,
+// minimums and fees
+func (h *Handler) GetExchangeInfo(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: map[string]interface{}{
+		"symbols":     h.exchange.SymbolConfigs(),
+		"server_time": domain.Now().UnixMilli(),
+	}})
 }
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -231,3 +916,19 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 		log.Printf("Failed to encode response: %v", err)
 	}
 }
+
+// respondError reports err with the code and status apierror classifies it
+// under. Internal errors are logged here; the client only learns that one
+// happened.
+func respondError(w http.ResponseWriter, err error) {
+	respondErrorData(w, err, nil)
+}
+
+// respondErrorData is respondError with details for the client under data
+func respondErrorData(w http.ResponseWriter, err error, data interface{}) {
+	apiErr := apierror.From(err)
+	if apiErr.Code == apierror.Internal {
+		log.Printf("ERROR: %v", err)
+	}
+	respondJSON(w, apiErr.Status, Response{Success: false, Data: data, Error: apiErr.Message, ErrorCode: apiErr.Code})
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/cache"
+)
+
+const (
+	// healthCheckTimeout bounds each dependency ping
+	healthCheckTimeout = 2 * time.Second
+	// maxPendingSettlements is how many trades may wait on settlement
+	// retries before the instance is considered broken
+	maxPendingSettlements = 1000
+)
+
+// Readiness states, of one component or the instance as a whole
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+)
+
+// ComponentHealth is one dependency's state. A critical component that is
+// unavailable fails the readiness check; anything else only degrades it.
+type ComponentHealth struct {
+	Status    string      `json:"status"`
+	Critical  bool        `json:"critical"`
+	LatencyMs float64     `json:"latency_ms,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// Readiness is the state of the instance and each of its dependencies
+type Readiness struct {
+	Status     string                      `json:"status"`
+	Components map[string]*ComponentHealth `json:"components"`
+}
+
+// SetHealthDependencies lets the readiness check ping the database and, if
+// configured, Redis
+func (h *Handler) SetHealthDependencies(db *sql.DB, redis *cache.RedisCache) {
+	h.db = db
+	h.redis = redis
+}
+
+// HealthCheck reports the process healthy; a trading pause is included so
+// UIs can show a banner, but doesn't fail the check. It checks no
+// dependencies, like LivenessCheck.
+func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: map[string]interface{}{
+		"status":  "healthy",
+		"trading": h.exchange.TradingStatus(),
+	}})
+}
+
+// LivenessCheck reports the process is up and serving requests
+func (h *Handler) LivenessCheck(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: map[string]string{"status": "live"}})
+}
+
+// ReadinessCheck reports whether the instance should receive traffic. It
+// fails with 503 while a critical component is unavailable: the database,
+// book recovery (ready symbols already trade) or an overflowing settlement
+// retry queue. Redis being missing only degrades it.
+func (h *Handler) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	readiness := &Readiness{Status: HealthOK, Components: map[string]*ComponentHealth{
+		"database":    h.databaseHealth(r.Context()),
+		"redis":       h.redisHealth(r.Context()),
+		"recovery":    h.recoveryHealth(),
+		"settlements": h.settlementHealth(),
+	}}
+
+	for _, component := range readiness.Components {
+		switch {
+		case component.Status == HealthOK:
+		case component.Critical && component.Status == HealthUnavailable:
+			readiness.Status = HealthUnavailable
+		case readiness.Status == HealthOK:
+			readiness.Status = HealthDegraded
+		}
+	}
+
+	status := http.StatusOK
+	if readiness.Status == HealthUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	respondJSON(w, status, Response{Success: status == http.StatusOK, Data: readiness})
+}
+
+func (h *Handler) databaseHealth(ctx context.Context) *ComponentHealth {
+	health := &ComponentHealth{Status: HealthOK, Critical: true}
+	if h.db == nil {
+		health.Status, health.Error = HealthUnavailable, "not configured"
+		return health
+	}
+	ping(ctx, health, h.db.PingContext)
+	return health
+}
+
+func (h *Handler) redisHealth(ctx context.Context) *ComponentHealth {
+	health := &ComponentHealth{Status: HealthOK}
+	if h.redis == nil {
+		health.Status, health.Error = HealthDegraded, "not configured; caching and replication are off"
+		return health
+	}
+	ping(ctx, health, h.redis.Ping)
+	return health
+}
+
+// ping times check, marking health unavailable if it fails or times out
+func ping(ctx context.Context, health *ComponentHealth, check func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	health.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		health.Status, health.Error = HealthUnavailable, err.Error()
+	}
+}
+
+func (h *Handler) recoveryHealth() *ComponentHealth {
+	health := &ComponentHealth{Status: HealthOK, Critical: true}
+	statuses := h.exchange.SymbolStatuses()
+	health.Details = statuses
+	for _, symbol := range statuses {
+		if !symbol.Ready {
+			health.Status, health.Error = HealthUnavailable, "books are still recovering"
+			break
+		}
+	}
+	return health
+}
+
+func (h *Handler) settlementHealth() *ComponentHealth {
+	health := &ComponentHealth{Status: HealthOK, Critical: true}
+	stats := h.exchange.SettlementStats()
+	health.Details = stats
+	switch {
+	case stats.Pending > maxPendingSettlements:
+		health.Status = HealthUnavailable
+		health.Error = fmt.Sprintf("%d trades are waiting on settlement retries, over the limit of %d", stats.Pending, maxPendingSettlements)
+	case stats.Pending > 0:
+		health.Status = HealthDegraded
+		health.Error = fmt.Sprintf("%d trades are waiting on settlement retries", stats.Pending)
+	}
+	return health
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/idempotency"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// SetIdempotency enables the Idempotency-Key header on order placement
+func (h *Handler) SetIdempotency(store idempotency.Store) {
+	h.idempotency = store
+}
+
+// idempotent makes next replay its first response to requests repeating an
+// Idempotency-Key instead of handling them again. Keys are per caller, and a
+// key reused with a different request is refused with 422. Server errors
+// aren't remembered, so the client can retry them.
+func (h *Handler) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || h.idempotency == nil {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			respondError(w, apierror.New(apierror.InvalidRequest, "Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, h.orderBodyLimit+1))
+		if err != nil {
+			respondError(w, apierror.New(apierror.InvalidRequest, "failed to read body: %v", err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if int64(len(body)) > h.orderBodyLimit {
+			// Refused as too large without being handled, so nothing to remember
+			next(w, r)
+			return
+		}
+
+		sum := sha256.New()
+		io.WriteString(sum, r.Method+" "+r.URL.RequestURI()+"\n")
+		sum.Write(body)
+		fingerprint := hex.EncodeToString(sum.Sum(nil))
+
+		scoped := idempotencyScope(r) + ":" + key
+		held, claimed, err := h.idempotency.Claim(scoped, fingerprint)
+		if err != nil {
+			log.Printf("Failed to claim idempotency key: %v", err)
+			respondError(w, apierror.New(apierror.Unavailable, "idempotency keys are unavailable, retry later"))
+			return
+		}
+		if !claimed {
+			switch {
+			case held.Fingerprint != fingerprint:
+				respondError(w, &apierror.Error{
+					Code:    apierror.InvalidRequest,
+					Status:  http.StatusUnprocessableEntity,
+					Message: "Idempotency-Key was already used with a different request",
+				})
+			case held.Pending:
+				respondError(w, apierror.New(apierror.Conflict, "a request with this Idempotency-Key is still in progress"))
+			default:
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(held.Status)
+				w.Write(held.Body)
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		if recorder.status >= http.StatusInternalServerError {
+			err = h.idempotency.Release(scoped)
+		} else {
+			err = h.idempotency.Complete(scoped, &idempotency.Record{
+				Fingerprint: fingerprint,
+				Status:      recorder.status,
+				Body:        recorder.body.Bytes(),
+			})
+		}
+		if err != nil {
+			log.Printf("Failed to store idempotency key: %v", err)
+		}
+	}
+}
+
+// idempotencyScope keeps callers' keys apart: by session token user, API
+// key or, for anonymous callers, one shared scope
+func idempotencyScope(r *http.Request) string {
+	if userID := CallerUser(r); userID != "" {
+		return "user:" + userID
+	}
+	if key := CallerKey(r); key != nil {
+		return "key:" + key.Name
+	}
+	return "anonymous"
+}
+
+// responseRecorder passes a response through while keeping a copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,82 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/api"
+)
+
+// Every list endpoint refuses a limit that isn't a positive integer and caps
+// one too large to its maximum, which the response reports
+func TestListLimits(t *testing.T) {
+	server, userID := startServer(t)
+
+	endpoints := []struct {
+		path  string
+		param string
+		max   int
+		// limits returns the limit applied and its maximum, as the response
+		// reports them
+		limits func(response listResponse) (int, int)
+	}{
+		{"/api/v1/trades/BTC-USD", "limit", 1000, paginationLimits},
+		{"/api/v1/klines/BTC-USD", "limit", 1000, paginationLimits},
+		{"/api/v1/users/" + userID + "/orders", "limit", 500, paginationLimits},
+		{"/api/v1/users/" + userID + "/trades", "limit", 500, paginationLimits},
+		{"/api/v1/orderbook/BTC-USD", "depth", api.MaxOrderBookDepth, func(response listResponse) (int, int) {
+			var book api.OrderBookResponse
+			if err := json.Unmarshal(response.Data, &book); err != nil {
+				t.Fatal(err)
+			}
+			return book.Depth, book.MaxDepth
+		}},
+	}
+	for _, endpoint := range endpoints {
+		for _, value := range []string{"0", "-1", "abc", "1.5"} {
+			t.Run(endpoint.path+"?"+endpoint.param+"="+value, func(t *testing.T) {
+				status, response := getList(t, server.BaseURL+endpoint.path+"?"+endpoint.param+"="+value)
+				if status != http.StatusBadRequest || response.ErrorCode != "invalid_request" {
+					t.Errorf("got %d %q, want 400 invalid_request", status, response.ErrorCode)
+				}
+			})
+		}
+		t.Run(endpoint.path+"?"+endpoint.param+"=1000000000", func(t *testing.T) {
+			status, response := getList(t, server.BaseURL+endpoint.path+"?"+endpoint.param+"=1000000000")
+			if status != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", status, response.Error)
+			}
+			limit, max := endpoint.limits(response)
+			if limit != endpoint.max || max != endpoint.max {
+				t.Errorf("limit %d of at most %d, want it capped to %d", limit, max, endpoint.max)
+			}
+		})
+	}
+}
+
+type listResponse struct {
+	api.Response
+	Data json.RawMessage `json:"data"`
+}
+
+func paginationLimits(response listResponse) (int, int) {
+	if response.Pagination == nil {
+		return 0, 0
+	}
+	return response.Pagination.Limit, response.Pagination.MaxLimit
+}
+
+func getList(t *testing.T, url string) (int, listResponse) {
+	t.Helper()
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var decoded listResponse
+	if err := json.NewDecoder(response.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, decoded
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	ws "github.com/hft-exchange/backend/internal/websocket"
+)
+
+// metricsContentType is the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// getWebSocketStats serves the hub's counters as JSON, for a quick look
+// without a Prometheus server
+func (h *Handler) getWebSocketStats(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, http.StatusOK, Response{Success: true, Data: hub.Stats()})
+	}
+}
+
+// serveMetrics serves the hub's counters in the Prometheus text format for
+// scraping. Each scrape reads them fresh; nothing is kept between scrapes.
+func (h *Handler) serveMetrics(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := hub.Stats()
+		w.Header().Set("Content-Type", metricsContentType)
+		m := &metricsWriter{w: bufio.NewWriter(w)}
+
+		m.family("hft_ws_clients", "gauge", "WebSocket clients connected")
+		m.sample("hft_ws_clients", nil, float64(stats.Clients))
+
+		m.family("hft_ws_connections", "gauge", "WebSocket connections admitted, including any still upgrading")
+		m.sample("hft_ws_connections", nil, float64(stats.Connections.Open))
+		m.family("hft_ws_connection_limit", "gauge", "Most WebSocket connections admitted at once, 0 for no limit")
+		m.sample("hft_ws_connection_limit", nil, float64(stats.Connections.MaxConnections))
+		m.family("hft_ws_connections_rejected_total", "counter", "WebSocket connections turned away before upgrading, by reason")
+		for _, reason := range sortedKeys(stats.Connections.Rejected) {
+			m.sample("hft_ws_connections_rejected_total", []string{"reason", reason}, float64(stats.Connections.Rejected[reason]))
+		}
+
+		m.family("hft_ws_subscribers", "gauge", "WebSocket clients subscribed, by channel and symbol")
+		for _, channel := range sortedKeys(stats.Subscribers) {
+			for _, symbol := range sortedKeys(stats.Subscribers[channel]) {
+				m.sample("hft_ws_subscribers", []string{"channel", channel, "symbol", symbol}, float64(stats.Subscribers[channel][symbol]))
+			}
+		}
+
+		m.family("hft_ws_broadcast_total", "counter", "Messages broadcast, by channel")
+		for _, channel := range sortedKeys(stats.Broadcast) {
+			m.sample("hft_ws_broadcast_total", []string{"channel", channel}, float64(stats.Broadcast[channel]))
+		}
+
+		m.family("hft_ws_conflated_total", "counter", "Queued messages replaced by a newer one for the same symbol, by type")
+		for _, kind := range sortedKeys(stats.ConflatedByType) {
+			m.sample("hft_ws_conflated_total", []string{"type", kind}, float64(stats.ConflatedByType[kind]))
+		}
+
+		m.counter("hft_ws_backpressure_dropped_total", "Messages dropped from full client queues", stats.Overflowed)
+		m.counter("hft_ws_slow_clients_total", "Clients disconnected for falling behind", stats.SlowClients)
+		m.counter("hft_ws_paused_dropped_total", "Messages discarded while broadcasting was paused or stopped", stats.Dropped)
+		m.counter("hft_ws_unrouted_total", "User messages with no connection to deliver to", stats.Unrouted)
+		m.counter("hft_ws_auth_failures_total", "Rejected auth ops", stats.AuthFailures)
+		m.counter("hft_ws_inbound_violations_total", "Client messages over the inbound rate limit", stats.InboundViolations)
+		m.counter("hft_ws_limited_clients_total", "Clients disconnected for exceeding the inbound rate limit", stats.LimitedClients)
+		m.counter("hft_ws_written_bytes_total", "Bytes written to WebSocket connections, after compression", stats.BytesWritten)
+
+		m.family("hft_ws_queue_depth_average", "gauge", "Average messages waiting in a client's queue, sampled every second")
+		m.sample("hft_ws_queue_depth_average", nil, stats.QueueDepth.Average)
+		m.family("hft_ws_queue_depth_max", "gauge", "Most messages waiting in any client's queue, sampled every second")
+		m.sample("hft_ws_queue_depth_max", nil, float64(stats.QueueDepth.Max))
+
+		m.w.Flush()
+	}
+}
+
+// metricsWriter writes metric families one line at a time
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+func (m *metricsWriter) family(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (m *metricsWriter) counter(name, help string, value uint64) {
+	m.family(name, "counter", help)
+	m.sample(name, nil, float64(value))
+}
+
+// sample writes one value of a family; labels alternate names and values
+func (m *metricsWriter) sample(name string, labels []string, value float64) {
+	m.w.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+		}
+		m.w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	m.w.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/notify"
+)
+
+// SetNotifications enables per-user fill and cancellation alerts
+func (h *Handler) SetNotifications(dispatcher *notify.Dispatcher) {
+	h.notifications = dispatcher
+}
+
+type NotificationSettingsRequest struct {
+	Sink          string   `json:"sink"`
+	Address       string   `json:"address"`
+	Events        []string `json:"events"`
+	DigestMinutes int      `json:"digest_minutes"`
+}
+
+// GetNotificationSettings returns a user's settings. Users who never saved
+// any get notifications disabled, shown as no events.
+func (h *Handler) GetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	if h.notifications == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Notifications are not enabled"))
+		return
+	}
+
+	userID := mux.Vars(r)["userId"]
+	settings, err := h.notifications.GetSettings(r.Context(), userID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if settings == nil {
+		settings = &notify.Settings{UserID: userID, Sink: "console", Events: []string{}}
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: map[string]interface{}{
+		"settings": settings,
+		"sinks":    h.notifications.Sinks(),
+	}})
+}
+
+func (h *Handler) UpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	if h.notifications == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Notifications are not enabled"))
+		return
+	}
+
+	var req NotificationSettingsRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+	if req.Events == nil {
+		req.Events = []string{}
+	}
+
+	settings := &notify.Settings{
+		UserID:        mux.Vars(r)["userId"],
+		Sink:          req.Sink,
+		Address:       req.Address,
+		Events:        req.Events,
+		DigestMinutes: req.DigestMinutes,
+	}
+	if err := h.notifications.UpdateSettings(r.Context(), settings); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: settings})
+}
+
+// GetNotificationLog lists a user's recent deliveries, newest first, with
+// the status and last error of any that failed
+func (h *Handler) GetNotificationLog(w http.ResponseWriter, r *http.Request) {
+	if h.notifications == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Notifications are not enabled"))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: h.notifications.Log(mux.Vars(r)["userId"])})
+}
+
+// GetSystemNotifications lists the latest notices sent to every WebSocket
+// client, newest first, for clients that connected after them
+func (h *Handler) GetSystemNotifications(w http.ResponseWriter, r *http.Request) {
+	query, err := systemNotificationsResource.Parse(r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	notifications, err := h.exchange.RecentNotifications(r.Context(), query.Limit)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: notifications})
+}
+
+// GetUserActivity lists a user's own notifications, newest first, such as
+// the orders the exchange cancelled for them
+func (h *Handler) GetUserActivity(w http.ResponseWriter, r *http.Request) {
+	if h.notifications == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Notifications are not enabled"))
+		return
+	}
+	query, err := userActivityResource.Parse(r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	activity, err := h.notifications.Activity(r.Context(), mux.Vars(r)["userId"], query.Limit)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: activity})
+}
+
+// AnnounceRequest is an operator's notice to every client
+type AnnounceRequest struct {
+	Category domain.NotificationCategory `json:"category"`
+	Severity domain.NotificationSeverity `json:"severity"`
+	Symbol   string                      `json:"symbol,omitempty"`
+	Message  string                      `json:"message"`
+}
+
+var announceCategories = map[domain.NotificationCategory]bool{
+	domain.CategoryTrading:     true,
+	domain.CategoryMaintenance: true,
+	domain.CategoryListing:     true,
+}
+
+var notificationSeverities = map[domain.NotificationSeverity]bool{
+	domain.SeverityInfo:     true,
+	domain.SeverityWarning:  true,
+	domain.SeverityCritical: true,
+}
+
+// Announce sends an operator's notice, such as upcoming maintenance, to
+// every client on the notifications channel and keeps it with the others
+func (h *Handler) Announce(w http.ResponseWriter, r *http.Request) {
+	var req AnnounceRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+	if req.Category == "" {
+		req.Category = domain.CategoryMaintenance
+	}
+	if req.Severity == "" {
+		req.Severity = domain.SeverityInfo
+	}
+	switch {
+	case req.Message == "":
+		respondError(w, apierror.New(apierror.InvalidRequest, "message is required"))
+		return
+	case !announceCategories[req.Category]:
+		respondError(w, apierror.New(apierror.InvalidRequest, "category must be trading, maintenance or listing"))
+		return
+	case !notificationSeverities[req.Severity]:
+		respondError(w, apierror.New(apierror.InvalidRequest, "severity must be info, warning or critical"))
+		return
+	case req.Symbol != "" && !h.isListed(req.Symbol):
+		respondError(w, apierror.New(apierror.UnknownSymbol, "unknown symbol: %s", req.Symbol))
+		return
+	}
+
+	notification := &domain.Notification{
+		Symbol:   req.Symbol,
+		Category: req.Category,
+		Severity: req.Severity,
+		Message:  req.Message,
+	}
+	h.exchange.Announce(notification)
+	log.Printf("AUDIT: %s notification sent by %s: %s", notification.Category, r.RemoteAddr, notification.Message)
+	respondJSON(w, http.StatusCreated, Response{Success: true, Data: notification})
+}
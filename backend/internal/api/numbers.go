@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// wantsLegacyNumbers reports whether a client asked for prices and quantities
+// as JSON numbers instead of decimal strings, via ?number_format=float or the
+// X-Number-Format: float header
+func wantsLegacyNumbers(r *http.Request) bool {
+	return r.URL.Query().Get("number_format") == "float" || r.Header.Get("X-Number-Format") == "float"
+}
+
+// legacyNumbers rewrites the responses of clients that opted into float
+// output while they migrate to decimal strings. A response its handler
+// flushes is streaming and goes out as written; such handlers rewrite their
+// own numbers.
+func legacyNumbers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !wantsLegacyNumbers(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buffered := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(buffered, r)
+		if buffered.streaming {
+			return
+		}
+
+		body := buffered.body.Bytes()
+		// An NDJSON body is many documents, which its handler rewrites one by
+		// one; rewriting it here would keep only the first
+		if buffered.Header().Get("Content-Type") != "application/x-ndjson" {
+			if rewritten, err := domain.LegacyNumbers(body); err == nil {
+				body = append(rewritten, '\n')
+			}
+		}
+		w.WriteHeader(buffered.status)
+		w.Write(body)
+	})
+}
+
+// bufferedResponse holds a response back so it can be rewritten, until it
+// is flushed
+type bufferedResponse struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.streaming {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	if b.streaming {
+		return b.ResponseWriter.Write(data)
+	}
+	return b.body.Write(data)
+}
+
+// Flush sends what has been held back and passes everything after it
+// straight through
+func (b *bufferedResponse) Flush() {
+	if !b.streaming {
+		b.streaming = true
+		b.ResponseWriter.WriteHeader(b.status)
+		b.ResponseWriter.Write(b.body.Bytes())
+		b.body.Reset()
+	}
+	if flusher, ok := b.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (b *bufferedResponse) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A float-numbers client is sent a flushed response as it is written, not
+// once its handler returns, while an unflushed one is still rewritten whole
+func TestLegacyNumbersStreamsFlushedResponses(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(legacyNumbers(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/whole" {
+			io.WriteString(w, `{"price":"45000.50"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, "{\"price\":45000.5}\n")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flushing: %v", err)
+		}
+		<-release
+		io.WriteString(w, "{\"price\":45001}\n")
+	})))
+	defer server.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	// The request runs alongside, as a response held back whole has no
+	// headers to return until the handler does
+	var status int
+	var contentType string
+	lines := make(chan string, 2)
+	go func() {
+		defer close(lines)
+		response, err := http.Get(server.URL + "/stream?number_format=float")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer response.Body.Close()
+		status, contentType = response.StatusCode, response.Header.Get("Content-Type")
+		reader := bufio.NewReader(response.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+	select {
+	case line := <-lines:
+		if line != "{\"price\":45000.5}\n" {
+			t.Errorf("first line %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first line held back until the handler returns")
+	}
+	close(release)
+	if line := <-lines; line != "{\"price\":45001}\n" {
+		t.Errorf("second line %q", line)
+	}
+	for range lines {
+	}
+	if status != http.StatusAccepted || contentType != "application/x-ndjson" {
+		t.Errorf("status %d and Content-Type %q, want the handler's", status, contentType)
+	}
+
+	response, err := http.Get(server.URL + "/whole?number_format=float")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if strings.TrimSpace(string(body)) != `{"price":45000.50}` {
+		t.Errorf("unflushed body %s, want its price as a number", body)
+	}
+}
@@ -0,0 +1,488 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// Operation documents one route for the OpenAPI document. Request and
+// Response are values of the types the handler decodes and returns under
+// data; their schemas are reflected from the types, so they follow the structs.
+type Operation struct {
+	Summary     string
+	Description string
+	Request     interface{}
+	Response    interface{}
+	// Status is the success status; 200 if unset
+	Status int
+	// Accepted is the data of a 202 the operation answers instead when it
+	// can't finish in time
+	Accepted interface{}
+	Params   []QueryParam
+	// Resource is a list endpoint's declaration, whose parameters and
+	// pagination it takes
+	Resource *ListResource
+	Errors   []apierror.Code
+	// ContentType is the success response's type when it isn't a JSON
+	// Response
+	ContentType string
+}
+
+// schema is one node of an OpenAPI schema
+type schema map[string]interface{}
+
+// openAPIDocument is the spec the router serves, built once every route is
+// registered
+type openAPIDocument struct {
+	spec []byte
+}
+
+// ServeHTTP serves the spec
+func (d *openAPIDocument) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(d.spec)
+}
+
+// build describes every route on router. Like checkRoutes it panics on a
+// route without an entry in operations, or an entry naming no route, so the
+// spec can't silently drift from the router.
+func (d *openAPIDocument) build(router *mux.Router, auth *Auth) {
+	builder := &schemaBuilder{components: make(map[string]schema), names: make(map[reflect.Type]string)}
+	paths := make(map[string]map[string]interface{})
+	documented := make(map[string]bool)
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Routes without a method, like the WebSocket upgrade, are GETs
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			key := method + " " + path
+			op, ok := operations[key]
+			if !ok {
+				return fmt.Errorf("route %s has no OpenAPI operation", key)
+			}
+			documented[key] = true
+			if paths[path] == nil {
+				paths[path] = make(map[string]interface{})
+			}
+			paths[path][strings.ToLower(method)] = builder.operation(key, path, op, auth.scopes[route])
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	for key := range operations {
+		if !documented[key] {
+			panic(fmt.Sprintf("OpenAPI operation %s matches no route", key))
+		}
+	}
+
+	builder.components["Response"] = builder.envelope()
+	builder.components["Pagination"] = builder.schema(reflect.TypeOf(Pagination{}), false)
+	spec, err := json.Marshal(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "HFT Exchange API",
+			"version": "v1",
+			"description": "Every JSON response is a Response envelope with the endpoint's result under data. " +
+				"Prices and quantities are decimal strings with the symbol's precision; send " +
+				"X-Number-Format: float or ?number_format=float for numbers instead.",
+		},
+		"servers": []schema{{"url": "/"}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": builder.components,
+			"securitySchemes": map[string]schema{
+				"apiKey": {"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": {"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	d.spec = spec
+}
+
+// schemaBuilder reflects Go types into schemas, registering named structs as
+// components
+type schemaBuilder struct {
+	components map[string]schema
+	names      map[reflect.Type]string
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	rawType      = reflect.TypeOf(json.RawMessage{})
+	decimalType  = reflect.TypeOf(domain.Decimal{})
+	marshaler    = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func (b *schemaBuilder) operation(key, path string, op Operation, scope Scope) schema {
+	out := schema{
+		"operationId": operationID(key),
+		"summary":     op.Summary,
+		"tags":        []string{operationTag(path)},
+		"x-scope":     string(scope),
+	}
+	if op.Description != "" {
+		out["description"] = op.Description
+	}
+	if scope != ScopePublic {
+		out["security"] = []schema{{"apiKey": []string{}}, {"bearer": []string{}}}
+	}
+
+	parameters := make([]schema, 0)
+	for _, name := range pathVariables(path) {
+		parameters = append(parameters, schema{"name": name, "in": "path", "required": true, "schema": schema{"type": "string"}})
+	}
+	params := op.Params
+	if op.Resource != nil {
+		params = append(append([]QueryParam{}, op.Resource.Params...), params...)
+	}
+	for _, param := range params {
+		parameters = append(parameters, queryParameter(param))
+	}
+	if len(parameters) > 0 {
+		out["parameters"] = parameters
+	}
+
+	if op.Request != nil {
+		out["requestBody"] = schema{
+			"required": true,
+			"content":  schema{"application/json": schema{"schema": b.schemaOf(op.Request)}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	responses := schema{strconv.Itoa(status): b.success(op)}
+	if op.Accepted != nil {
+		accepted := b.success(Operation{Response: op.Accepted})
+		accepted["description"] = "accepted, still being processed"
+		responses[strconv.Itoa(http.StatusAccepted)] = accepted
+	}
+	for code, errorResponse := range b.errors(op, scope) {
+		responses[code] = errorResponse
+	}
+	out["responses"] = responses
+	return out
+}
+
+// success describes the success response: data of the operation's type
+// inside the envelope, with pagination for list endpoints
+func (b *schemaBuilder) success(op Operation) schema {
+	if op.ContentType != "" {
+		return schema{"description": op.Summary, "content": schema{op.ContentType: schema{"schema": schema{"type": "string"}}}}
+	}
+	properties := schema{}
+	if op.Response != nil {
+		properties["data"] = b.schemaOf(op.Response)
+	}
+	if op.Resource != nil {
+		properties["pagination"] = schema{"$ref": "#/components/schemas/Pagination"}
+	}
+	body := schema{"$ref": "#/components/schemas/Response"}
+	if len(properties) > 0 {
+		body = schema{"allOf": []schema{body, {"type": "object", "properties": properties}}}
+	}
+	return schema{"description": "success", "content": schema{"application/json": schema{"schema": body}}}
+}
+
+// errors groups the codes an operation can fail with by status. Scoped
+// routes can also be refused by auth, and any route can fail internally.
+func (b *schemaBuilder) errors(op Operation, scope Scope) map[string]schema {
+	codes := append([]apierror.Code{}, op.Errors...)
+	if scope != ScopePublic {
+		codes = append(codes, apierror.Unauthorized, apierror.Forbidden, apierror.RateLimited)
+	}
+	codes = append(codes, apierror.Internal)
+
+	byStatus := make(map[string][]string)
+	for _, code := range codes {
+		status := strconv.Itoa(code.Status())
+		if !slices.Contains(byStatus[status], string(code)) {
+			byStatus[status] = append(byStatus[status], string(code))
+		}
+	}
+	out := make(map[string]schema)
+	for status, names := range byStatus {
+		out[status] = schema{
+			"description": strings.Join(names, ", "),
+			"content":     schema{"application/json": schema{"schema": schema{"$ref": "#/components/schemas/Response"}}},
+		}
+	}
+	return out
+}
+
+// envelope is the Response schema every JSON endpoint answers with
+func (b *schemaBuilder) envelope() schema {
+	codes := make([]string, 0)
+	for _, code := range apierror.Codes() {
+		codes = append(codes, string(code))
+	}
+	return schema{
+		"type":     "object",
+		"required": []string{"success"},
+		"properties": schema{
+			"success":    schema{"type": "boolean"},
+			"data":       schema{"description": "the endpoint's result"},
+			"error":      schema{"type": "string"},
+			"error_code": schema{"type": "string", "enum": codes},
+			"pagination": schema{"$ref": "#/components/schemas/Pagination"},
+		},
+	}
+}
+
+func (b *schemaBuilder) schemaOf(value interface{}) schema {
+	return b.schema(reflect.TypeOf(value), false)
+}
+
+// schema reflects t. decimal is set inside types whose MarshalJSON writes
+// their float fields as decimal strings.
+func (b *schemaBuilder) schema(t reflect.Type, decimal bool) schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return schema{"type": "string", "format": "date-time"}
+	case durationType:
+		return schema{"type": "integer", "description": "nanoseconds"}
+	case rawType:
+		return schema{}
+	case decimalType:
+		return schema{"type": "string", "format": "decimal"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		if decimal {
+			return schema{"type": "string", "format": "decimal"}
+		}
+		return schema{"type": "number"}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return schema{"type": "string", "format": "byte"}
+		}
+		return schema{"type": "array", "items": b.schema(t.Elem(), decimal)}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": b.schema(t.Elem(), decimal)}
+	case reflect.Struct:
+		return b.structRef(t, decimal)
+	}
+	return schema{}
+}
+
+// structRef registers a named struct as a component and refers to it;
+// anonymous structs are described inline
+func (b *schemaBuilder) structRef(t reflect.Type, decimal bool) schema {
+	decimal = decimal || writesDecimals(t)
+	if t.Name() == "" {
+		return b.object(t, decimal)
+	}
+
+	name, ok := b.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := b.components[name]; taken {
+			// Another package's type of the same name got there first
+			pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+			name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+		}
+		b.names[t] = name
+		b.components[name] = schema{} // placeholder so recursive types terminate
+		b.components[name] = b.object(t, decimal)
+	}
+	return schema{"$ref": "#/components/schemas/" + name}
+}
+
+// object describes a struct's fields as encoding/json writes them
+func (b *schemaBuilder) object(t reflect.Type, decimal bool) schema {
+	properties := schema{}
+	required := make([]string, 0)
+	b.fields(t, decimal, properties, &required)
+	out := schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		out["required"] = required
+	}
+	return out
+}
+
+func (b *schemaBuilder) fields(t reflect.Type, decimal bool, properties schema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			b.fields(fieldType, decimal || writesDecimals(fieldType), properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := b.schema(field.Type, decimal)
+		if strings.Contains(options, "string") {
+			property = schema{"type": "string"}
+		}
+		properties[name] = property
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// writesDecimals reports whether t is a domain type whose MarshalJSON writes
+// its prices and quantities as decimal strings
+func writesDecimals(t reflect.Type) bool {
+	return t.PkgPath() == decimalType.PkgPath() &&
+		(t.Implements(marshaler) || reflect.PointerTo(t).Implements(marshaler))
+}
+
+// queryParameter describes a query parameter as QueryParam declares it
+func queryParameter(param QueryParam) schema {
+	types := map[string]schema{
+		"integer":   {"type": "integer"},
+		"number":    {"type": "number"},
+		"boolean":   {"type": "boolean"},
+		"timestamp": {"type": "string", "format": "date-time"},
+		"duration":  {"type": "string", "format": "duration"},
+	}
+	value, ok := types[param.Type]
+	if !ok {
+		value = schema{"type": "string"}
+	}
+	if len(param.Enum) > 0 && !param.Multiple {
+		value["enum"] = param.Enum
+	}
+	if param.Default != "" {
+		value["default"] = typedValue(param.Type, param.Default)
+	}
+	out := schema{"name": param.Name, "in": "query", "description": param.Description, "schema": value}
+	if param.Example != "" {
+		out["example"] = typedValue(param.Type, param.Example)
+	}
+	return out
+}
+
+// typedValue writes a numeric parameter's default or example as a number
+func typedValue(kind, value string) interface{} {
+	switch kind {
+	case "integer":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// pathVariables lists a mux path template's {variables}
+func pathVariables(path string) []string {
+	variables := make([]string, 0)
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			name, _, _ := strings.Cut(part[1:len(part)-1], ":")
+			variables = append(variables, name)
+		}
+	}
+	return variables
+}
+
+// operationID turns "GET /api/v1/users/{userId}/orders" into
+// "get_users_userId_orders" for generated clients
+func operationID(key string) string {
+	method, path, _ := strings.Cut(key, " ")
+	path = strings.TrimPrefix(path, "/api/v1")
+	id := strings.ToLower(method)
+	for _, part := range strings.Split(path, "/") {
+		part = strings.Trim(part, "{}")
+		part = strings.NewReplacer("-", "_", ".", "_").Replace(part)
+		if part != "" {
+			id += "_" + part
+		}
+	}
+	return id
+}
+
+// operationTag groups operations by their first path segment under /api/v1
+func operationTag(path string) string {
+	rest := strings.TrimPrefix(path, "/api/v1/")
+	if rest == path {
+		rest = strings.TrimPrefix(path, "/")
+	}
+	tag, _, _ := strings.Cut(rest, "/")
+	return tag
+}
+
+// swaggerUI loads Swagger UI from its CDN and points it at the spec
+const swaggerUI = `<!DOCTYPE html>
+<html>
+<head>
+  <title>HFT Exchange API</title>
+  <meta charset="utf-8">
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/api/v1/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// GetDocsUI serves Swagger UI for the OpenAPI document
+func (h *Handler) GetDocsUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUI))
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	ws "github.com/hft-exchange/backend/internal/websocket"
+)
+
+// Every route the router serves is an operation of the spec it serves, and
+// the spec has nothing else
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	r, _ := newMux(&Handler{}, ws.NewHub())
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/openapi.json: %d", recorder.Code)
+	}
+	var spec struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want a 3.x document", spec.OpenAPI)
+	}
+	for _, name := range []string{"Response", "Pagination"} {
+		if spec.Components.Schemas[name] == nil {
+			t.Errorf("no %s schema", name)
+		}
+	}
+
+	routes := 0
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			routes++
+			operation := spec.Paths[path][strings.ToLower(method)]
+			if operation == nil {
+				t.Errorf("%s %s isn't in the spec", method, path)
+				continue
+			}
+			var described struct {
+				Summary   string                     `json:"summary"`
+				Responses map[string]json.RawMessage `json:"responses"`
+			}
+			if err := json.Unmarshal(operation, &described); err != nil {
+				return err
+			}
+			if described.Summary == "" || len(described.Responses) == 0 {
+				t.Errorf("%s %s has no summary or responses", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	operations := 0
+	for _, methods := range spec.Paths {
+		operations += len(methods)
+	}
+	if operations != routes {
+		t.Errorf("the spec has %d operations for %d routes", operations, routes)
+	}
+}
+
+// /docs serves a Swagger UI pointed at the spec
+func TestDocsUI(t *testing.T) {
+	r, _ := newMux(&Handler{}, ws.NewHub())
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("GET /docs: %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(recorder.Body.String(), "/api/v1/openapi.json") {
+		t.Errorf("the docs page doesn't load /api/v1/openapi.json")
+	}
+}
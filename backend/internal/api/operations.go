@@ -0,0 +1,466 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/hft-exchange/backend/internal/accounts"
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/bot"
+	"github.com/hft-exchange/backend/internal/cache"
+	"github.com/hft-exchange/backend/internal/capacity"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/notify"
+	"github.com/hft-exchange/backend/internal/orderfeed"
+	"github.com/hft-exchange/backend/internal/repository"
+	"github.com/hft-exchange/backend/internal/subsystem"
+	ws "github.com/hft-exchange/backend/internal/websocket"
+)
+
+var (
+	symbolParam  = QueryParam{Name: "symbol", Type: "string", Description: "only this symbol", Example: "BTC-USD"}
+	userIDParam  = QueryParam{Name: "user_id", Type: "string", Description: "the order's owner, unless a session token names it", Example: "user-1"}
+	depthParam   = QueryParam{Name: "depth", Type: "integer", Description: "levels per side, capped at 500", Default: "20", Example: "50"}
+	bookNotFound = []apierror.Code{apierror.InvalidRequest, apierror.UnknownSymbol}
+)
+
+// cancelledCount is what the bulk cancel endpoints return
+var cancelledCount = struct {
+	Cancelled int `json:"cancelled"`
+}{}
+
+// operations documents every route, keyed by method and path template. The
+// router won't build while a route is missing here; see openAPIDocument.build.
+var operations = map[string]Operation{
+	// Health
+	"GET /health": {
+		Summary: "Report that the server is up, with the trading status",
+		Response: struct {
+			Status  string               `json:"status"`
+			Trading engine.TradingStatus `json:"trading"`
+		}{},
+	},
+	"GET /health/live":  {Summary: "Liveness probe", Response: map[string]string{}},
+	"GET /health/ready": {Summary: "Readiness probe: 503 until every dependency and symbol is ready", Response: Readiness{}, Errors: []apierror.Code{apierror.Unavailable}},
+	"GET /metrics": {
+		Summary:     "WebSocket metrics for Prometheus to scrape",
+		Description: "The counters of GET /api/v1/admin/ws/stats as hft_ws_* metrics, labelled by channel, symbol or message type.",
+		ContentType: "text/plain",
+	},
+
+	// Documentation and streams
+	"GET /docs":                  {Summary: "Swagger UI for this document", ContentType: "text/html"},
+	"GET /api/v1/openapi.json":   {Summary: "This OpenAPI document", ContentType: "application/json"},
+	"GET /api/v1/meta/resources": {Summary: "How each list endpoint is queried", Response: []*ListResource{}},
+	"GET /api/v1/docs/examples":  {Summary: "Request and response examples for the core trading flows", Response: []ExampleFlow{}},
+	"GET /api/v1/stream": {
+		Summary:     "Market data as Server-Sent Events",
+		Description: "Each event's id is its sequence; reconnect with Last-Event-ID to resume. The orderbook channel starts with a snapshot per symbol, then sends orderbook_diff events.",
+		Params: []QueryParam{
+			{Name: "channels", Type: "string", Description: "comma-separated channels", Enum: streamChannels, Multiple: true, Example: "ticker,trade"},
+			{Name: "symbols", Type: "string", Description: "comma-separated symbols, default all", Multiple: true, Example: "BTC-USD"},
+			{Name: "last_event_id", Type: "integer", Description: "resume after this event, when Last-Event-ID can't be sent", Example: "42"},
+		},
+		Errors:      []apierror.Code{apierror.InvalidRequest, apierror.UnknownSymbol},
+		ContentType: "text/event-stream",
+	},
+	"GET /ws": {
+		Summary:     "WebSocket feed of tickers, trades, books and order updates",
+		Description: `Every connection starts with a welcome message carrying the protocol_version; ?protocol_version= asks for one of its supported_versions. Send {"op":"subscribe","channel":"trades","symbol":"BTC-USD"} (or "unsubscribe") for each channel wanted; each is answered with an ack ("ok": true) or an error with a code (bad_json, unknown_op, unknown_channel, unknown_symbol, invalid_request, auth_required, unauthorized or rate_limited), both echoing any "id" sent. The channels are ticker, trades, orderbook, bookTicker, symbolStatus and kline, per symbol, and status, user and notifications, without one. notifications sends trading pauses and resumes, scheduled maintenance, listings and delistings to everyone, and to an authenticated user the orders the exchange rejected or cancelled for them after accepting them; GET /api/v1/notifications lists the latest system ones, and GET /api/v1/users/{userId}/activity a user's own. kline also takes an "interval" of 1m, 5m, 1h or 1d and sends the forming kline on every trade, then once more with closed set when the interval ends; a closed kline a late trade changed is sent again with "correction": true. The user channel needs a session token, as ?token= or, within 10 seconds of connecting, {"op":"auth","token":"..."}, whose ack carries the token's expires_at, and so the read scope a token carries. A failed auth gets an error with a code and leaves the connection public. When the token expires the user's messages stop and an auth_expired message is sent; an auth op with a new token for the same user resumes them. Subscribing to ticker, trades, orderbook or bookTicker first sends its current state: the ticker, a trades message with the last 20 trades, an orderbook snapshot with its seq, or the best bid and ask. bookTicker then sends the best bid and ask with the quantity at each as soon as any of them changes; a slow client gets only the latest, and its seq only increases. The orderbook channel then sends orderbook_diff messages of the changed levels, each applying to the book at its prev_seq; subscribe again for a fresh snapshot after a gap. Add "format":"compact" to an orderbook subscribe to get levels as [price, quantity] pairs; clients offering permessage-deflate get messages of 256 bytes or more compressed. A ticker, bookTicker or orderbook_diff still waiting to be sent to a client is replaced by the next one for the symbol; diffs are merged into one spanning both. Every message's envelope is {type, symbol, seq, ts, data}, with ts the server's time in epoch milliseconds. Every broadcast message carries a seq, numbered per channel and symbol (per user on the user channel); after reconnecting, subscribe with "last_sequence" to receive the messages missed since, out of the last 1,000 kept (100 per user), before live ones, or a resync message followed by the usual snapshot when they are no longer kept. A connection over the server's limits is refused before upgrading, with a Retry-After: 429 when its address has too many connections open, and 503 when the server is full or accepting new connections too fast.`,
+		Params: []QueryParam{
+			{Name: "protocol_version", Type: "integer", Description: "message format version, one of the welcome message's supported_versions", Default: "1", Example: "1"},
+		},
+		Status:      http.StatusSwitchingProtocols,
+		ContentType: "application/octet-stream",
+		Errors:      []apierror.Code{apierror.InvalidRequest, apierror.RateLimited, apierror.Unavailable},
+	},
+
+	// Accounts
+	"POST /api/v1/users": {
+		Summary:  "Register a user",
+		Request:  RegisterRequest{},
+		Response: domain.User{},
+		Status:   http.StatusCreated,
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.Conflict},
+	},
+	"POST /api/v1/auth/login": {
+		Summary:  "Log in for a session token",
+		Request:  LoginRequest{},
+		Response: accounts.Session{},
+		Errors:   []apierror.Code{apierror.InvalidRequest},
+	},
+
+	// Orders
+	"POST /api/v1/orders": {
+		Summary:     "Place an order",
+		Description: "Send an Idempotency-Key header to make retries safe. A request that fails validation gets 422 with every problem under data. With sync, the response waits up to 2s for matching and carries the immediate fills; an order still matching then gets 202 with its id and status accepted.",
+		Request:     PlaceOrderRequest{},
+		Response:    PlacedOrder{},
+		Accepted:    PendingOrder{},
+		Errors: []apierror.Code{apierror.InvalidRequest, apierror.UnknownSymbol, apierror.InsufficientBalance,
+			apierror.RiskLimit, apierror.Conflict, apierror.Unavailable},
+	},
+	"POST /api/v1/orders/batch": {
+		Summary:     "Place several orders, reporting each one's outcome at its index",
+		Description: "Up to 50 orders, counted as that many requests against the rate limit. With all_or_nothing, one invalid order gets 422 and none are placed.",
+		Request:     PlaceOrderBatchRequest{},
+		Response:    []BatchOrderResult{},
+		Errors:      []apierror.Code{apierror.InvalidRequest, apierror.Unavailable},
+	},
+	"POST /api/v1/orders/cancel-batch": {
+		Summary:  "Cancel several orders, reporting each one's outcome",
+		Request:  CancelBatchRequest{},
+		Response: []engine.CancelResult{},
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.Unavailable},
+	},
+	"DELETE /api/v1/orders/{id}": {
+		Summary: "Cancel an order",
+		Params:  []QueryParam{userIDParam},
+		Errors:  []apierror.Code{apierror.InvalidRequest, apierror.OrderNotFound, apierror.Unavailable},
+	},
+	"GET /api/v1/orders/{id}/fills": {
+		Summary:  "List an order's executions, oldest first",
+		Resource: orderFillsResource,
+		Response: []domain.Fill{},
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.OrderNotFound},
+	},
+	"GET /api/v1/users/{userId}/orders": {
+		Summary:  "List a user's orders, newest first",
+		Resource: userOrdersResource,
+		Response: []*domain.Order{},
+		Errors:   []apierror.Code{apierror.InvalidRequest},
+	},
+	"DELETE /api/v1/users/{userId}/orders": {
+		Summary:  "Cancel all of a user's open orders",
+		Params:   []QueryParam{symbolParam},
+		Response: cancelledCount,
+		Errors:   []apierror.Code{apierror.Unavailable},
+	},
+	"GET /api/v1/users/{userId}/open-orders": {
+		Summary:  "List a user's open orders from the in-memory index",
+		Params:   []QueryParam{symbolParam},
+		Response: engine.OpenOrders{},
+	},
+	"GET /api/v1/users/{userId}/orders/changes": {
+		Summary: "Long-poll for changes to a user's orders",
+		Params: []QueryParam{
+			{Name: "since_seq", Type: "integer", Description: "return changes after this user sequence", Example: "0"},
+			{Name: "timeout", Type: "duration", Description: "how long to wait, at most 60s", Default: "30s", Example: "30s"},
+		},
+		Response: orderfeed.Changes{},
+		Errors:   []apierror.Code{apierror.InvalidRequest},
+	},
+
+	// Trades
+	"GET /api/v1/trades/{symbol}": {
+		Summary:     "List a symbol's recent trades, newest first",
+		Description: "With ?aggregate=true, each item is a print summing one taker order's consecutive trades, with its volume-weighted price and first and last trade.",
+		Resource:    recentTradesResource,
+		Response:    []*domain.Trade{},
+		Errors:      bookNotFound,
+	},
+	"GET /api/v1/klines/{symbol}": {
+		Summary:  "OHLCV candles, oldest first",
+		Resource: klinesResource,
+		Response: []*domain.Candle{},
+		Errors:   bookNotFound,
+	},
+	"GET /api/v1/users/{userId}/trades": {
+		Summary:  "List a user's trades, newest first",
+		Resource: userTradesResource,
+		Response: []*domain.Trade{},
+		Errors:   []apierror.Code{apierror.InvalidRequest},
+	},
+
+	// Order book
+	"GET /api/v1/orderbook/{symbol}": {
+		Summary:     "A symbol's order book",
+		Description: "Sends an ETag; send it back as If-None-Match for a 304 while the book is unchanged.",
+		Params:      []QueryParam{depthParam},
+		Response:    OrderBookResponse{},
+		Errors:      bookNotFound,
+	},
+	"GET /api/v1/orderbook/{symbol}/full": {
+		Summary:     "Every level of a symbol's book, streamed",
+		Description: "Taken as one engine snapshot at seq. Needs an API key or the admin scope, and each caller may read one every 5 seconds. With ?format=ndjson, a header line is followed by one line per level, bids then asks.",
+		Params: []QueryParam{
+			{Name: "format", Type: "string", Description: "json, or ndjson for a line per level", Enum: []string{"json", "ndjson"}, Default: "json", Example: "ndjson"},
+		},
+		Response: struct {
+			domain.OrderBook
+			BidLevels int `json:"bid_levels"`
+			AskLevels int `json:"ask_levels"`
+		}{},
+		Errors: []apierror.Code{apierror.InvalidRequest, apierror.UnknownSymbol, apierror.Unavailable},
+	},
+	"GET /api/v1/depth/{symbol}": {
+		Summary: "A symbol's book grouped into price buckets",
+		Params: []QueryParam{
+			depthParam,
+			{Name: "step", Type: "number", Description: "bucket width, default the tick size", Example: "10"},
+		},
+		Response: domain.Depth{},
+		Errors:   bookNotFound,
+	},
+
+	// Balances and positions
+	"GET /api/v1/users/{userId}/balances": {Summary: "A user's balances", Response: []*repository.Balance{}},
+	"POST /api/v1/users/{userId}/deposits": {
+		Summary:  "Deposit funds",
+		Request:  FundingRequest{},
+		Response: engine.Funding{},
+		Status:   http.StatusCreated,
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.Unavailable},
+	},
+	"POST /api/v1/users/{userId}/withdrawals": {
+		Summary:  "Withdraw funds",
+		Request:  FundingRequest{},
+		Response: engine.Funding{},
+		Status:   http.StatusCreated,
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.InsufficientBalance, apierror.RiskLimit, apierror.Unavailable},
+	},
+	"GET /api/v1/users/{userId}/positions": {Summary: "A user's positions, marked to market", Response: []*domain.Position{}},
+	"GET /api/v1/users/{userId}/pnl": {
+		Summary: "A user's realized and unrealized profit and loss",
+		Params: []QueryParam{
+			{Name: "from", Type: "timestamp", Description: "start of the period", Example: "2024-01-01T00:00:00Z"},
+			{Name: "to", Type: "timestamp", Description: "end of the period, default now", Example: "2024-01-02T00:00:00Z"},
+		},
+		Response: PnLReport{},
+		Errors:   []apierror.Code{apierror.InvalidRequest},
+	},
+	"GET /api/v1/users/{userId}/stats": {
+		Summary:  "A user's exposure against their risk limits, per symbol",
+		Params:   []QueryParam{symbolParam},
+		Response: []*engine.AccountSummary{},
+		Errors:   []apierror.Code{apierror.UnknownSymbol},
+	},
+
+	// Notifications
+	"GET /api/v1/users/{userId}/notifications/settings": {
+		Summary: "A user's notification settings and the available sinks",
+		Response: struct {
+			Settings notify.Settings `json:"settings"`
+			Sinks    []string        `json:"sinks"`
+		}{},
+		Errors: []apierror.Code{apierror.NotFound},
+	},
+	"PUT /api/v1/users/{userId}/notifications/settings": {
+		Summary:  "Replace a user's notification settings",
+		Request:  NotificationSettingsRequest{},
+		Response: notify.Settings{},
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.NotFound},
+	},
+	"GET /api/v1/users/{userId}/notifications/log": {
+		Summary:  "A user's recent notifications",
+		Response: []notify.LogEntry{},
+		Errors:   []apierror.Code{apierror.NotFound},
+	},
+	"GET /api/v1/notifications": {
+		Summary:     "The latest notices sent to every client, newest first",
+		Description: "Trading pauses and resumes, scheduled maintenance, listings and delistings, as sent on the WebSocket notifications channel. A user's own notifications are listed in their activity feed.",
+		Resource:    systemNotificationsResource,
+		Response:    []*domain.Notification{},
+		Errors:      []apierror.Code{apierror.InvalidRequest},
+	},
+	"GET /api/v1/users/{userId}/activity": {
+		Summary:     "A user's activity feed, newest first",
+		Description: "The notifications sent to the user alone on the WebSocket notifications channel: orders the exchange rejected or cancelled for them after accepting them, e.g. with cancel reason STALE_CANCEL. The last 100 are kept.",
+		Resource:    userActivityResource,
+		Response:    []*domain.Notification{},
+		Errors:      []apierror.Code{apierror.InvalidRequest},
+	},
+
+	// Market data
+	"GET /api/v1/tickers": {
+		Summary:     "Every symbol's ticker",
+		Description: "Sends an ETag; send it back as If-None-Match for a 304 while nothing changed.",
+		Response:    []*domain.Ticker{},
+	},
+	"GET /api/v1/tickers/{symbol}": {
+		Summary:     "A symbol's ticker",
+		Description: "Sends an ETag; send it back as If-None-Match for a 304 while nothing changed.",
+		Response:    domain.Ticker{},
+		Errors:      bookNotFound,
+	},
+	"GET /api/v1/symbols": {Summary: "Every listed symbol with its trading state", Response: []engine.SymbolStatus{}},
+	"GET /api/v1/symbols/status": {
+		Summary:     "Every symbol's trading state, delisted ones included",
+		Description: "States are RECOVERING, TRADING, PAUSED and HALTED. Changes are also pushed as symbolStatus WebSocket messages.",
+		Response:    []engine.SymbolStatus{},
+	},
+	"GET /api/v1/symbols/{symbol}/status": {
+		Summary:     "A symbol's trading state, why and since when",
+		Description: "A timed pause reports when trading resumes as next_transition_at.",
+		Response:    engine.SymbolStatus{},
+		Errors:      []apierror.Code{apierror.UnknownSymbol},
+	},
+	"GET /api/v1/exchangeInfo": {
+		Summary: "Every trading pair's rules, with the server time",
+		Response: struct {
+			Symbols    []domain.SymbolConfig `json:"symbols"`
+			ServerTime int64                 `json:"server_time"`
+		}{},
+	},
+	"GET /api/v1/time": {Summary: "The server's clock", Response: ServerTime{}},
+
+	// Admin
+	"POST /api/v1/admin/engine/{symbol}/self-check": {
+		Summary:  "Check an engine's book for inconsistencies",
+		Response: engine.SelfCheckReport{},
+		Errors:   []apierror.Code{apierror.UnknownSymbol},
+	},
+	"GET /api/v1/admin/engine/{symbol}": {
+		Summary:  "An engine's book sizes, top of book, channel backlog and sequences",
+		Response: engine.EngineStats{},
+		Errors:   []apierror.Code{apierror.UnknownSymbol},
+	},
+	"POST /api/v1/admin/engine/{symbol}/purge-order/{id}": {
+		Summary:  "Force an order out of a book, whatever its state",
+		Response: domain.Order{},
+		Errors:   []apierror.Code{apierror.UnknownSymbol, apierror.OrderNotFound, apierror.Unavailable},
+	},
+	"GET /api/v1/admin/orderbook/{symbol}/history": {
+		Summary: "Reconstruct a book as of a past time",
+		Params: []QueryParam{
+			{Name: "at", Type: "timestamp", Description: "when to reconstruct the book as of", Example: "2024-01-01T00:00:00Z"},
+			depthParam,
+		},
+		Response: domain.OrderBook{},
+		Errors:   []apierror.Code{apierror.InvalidRequest},
+	},
+	"GET /api/v1/admin/replication":          {Summary: "Replication role and lag", Response: map[string]interface{}{}, Errors: []apierror.Code{apierror.NotFound}},
+	"POST /api/v1/admin/replication/promote": {Summary: "Promote this standby to primary", Response: map[string]int64{}, Errors: []apierror.Code{apierror.NotFound, apierror.Conflict}},
+	"GET /api/v1/admin/cache":                {Summary: "Market data cache hit rates", Response: cache.MarketDataStats{}, Errors: []apierror.Code{apierror.NotFound}},
+	"GET /api/v1/admin/settlements": {
+		Summary: "Trades whose settlement is still being retried",
+		Response: struct {
+			Stats   engine.SettlementStats     `json:"stats"`
+			Pending []engine.PendingSettlement `json:"pending"`
+		}{},
+	},
+	"GET /api/v1/admin/open-orders-index": {Summary: "Open orders index size and consistency", Response: engine.OpenOrderIndexStats{}},
+	"GET /api/v1/admin/capacity": {
+		Summary:  "Storage and throughput growth projections",
+		Params:   []QueryParam{{Name: "days", Type: "integer", Description: "how far ahead to project", Default: "30", Example: "90"}},
+		Response: capacity.Report{},
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.NotFound},
+	},
+	"GET /api/v1/admin/risk-profiles": {
+		Summary: "The default risk limits and every user's own profile",
+		Response: struct {
+			Defaults engine.RiskProfile   `json:"defaults"`
+			Profiles []engine.RiskProfile `json:"profiles"`
+		}{},
+	},
+	"GET /api/v1/admin/risk-profiles/{userId}": {Summary: "The limits a user's orders are checked against", Response: engine.RiskProfile{}},
+	"PUT /api/v1/admin/risk-profiles/{userId}": {
+		Summary:  "Set a user's risk limits",
+		Request:  engine.RiskProfile{},
+		Response: engine.RiskProfile{},
+		Errors:   []apierror.Code{apierror.InvalidRequest},
+	},
+	"DELETE /api/v1/admin/risk-profiles/{userId}": {Summary: "Return a user to the default limits", Response: engine.RiskProfile{}},
+	"GET /api/v1/admin/users": {
+		Summary:  "List users in ID order with their balances and open order counts",
+		Resource: adminUsersResource,
+		Response: []AdminUser{},
+		Errors:   []apierror.Code{apierror.InvalidRequest},
+	},
+	"GET /api/v1/admin/users/{userId}": {
+		Summary:  "A user with their balances and open order counts",
+		Response: AdminUser{},
+		Errors:   []apierror.Code{apierror.NotFound},
+	},
+	"POST /api/v1/admin/users/{userId}/disable": {
+		Summary:     "Stop a user placing orders, optionally cancelling their resting ones",
+		Description: "The user's new orders get forbidden until they are enabled again, across restarts.",
+		Request:     DisableUserRequest{},
+		Response:    DisabledUser{},
+		Errors:      []apierror.Code{apierror.InvalidRequest, apierror.NotFound, apierror.Unavailable},
+	},
+	"POST /api/v1/admin/users/{userId}/enable": {
+		Summary:  "Let a disabled user place orders again",
+		Response: AdminUser{},
+		Errors:   []apierror.Code{apierror.NotFound, apierror.Unavailable},
+	},
+	"POST /api/v1/admin/users/{userId}/verify": {
+		Summary:     "Mark a user verified",
+		Description: "Verified users' orders are never cancelled by the stale order sweeper.",
+		Response:    AdminUser{},
+		Errors:      []apierror.Code{apierror.NotFound},
+	},
+	"POST /api/v1/admin/users/{userId}/unverify": {
+		Summary:  "Clear a user's verification",
+		Response: AdminUser{},
+		Errors:   []apierror.Code{apierror.NotFound},
+	},
+	"POST /api/v1/admin/balances/adjust": {
+		Summary:  "Credit or debit a user's available balance",
+		Request:  BalanceAdjustmentRequest{},
+		Response: engine.LedgerEntry{},
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.InsufficientBalance},
+	},
+	"GET /api/v1/admin/balances/{userId}/ledger": {
+		Summary:  "A user's recent adjustments and transfers, newest first",
+		Resource: balanceLedgerResource,
+		Response: []engine.LedgerEntry{},
+		Errors:   []apierror.Code{apierror.InvalidRequest},
+	},
+	"GET /api/v1/admin/reconciliation": {Summary: "Compare balances with locked funds and open orders", Response: engine.Reconciliation{}},
+	"POST /api/v1/admin/transfers": {
+		Summary:  "Move funds between two users",
+		Request:  TransferRequest{},
+		Response: []engine.LedgerEntry{},
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.InsufficientBalance},
+	},
+	"GET /api/v1/admin/bots/{name}/pnl": {Summary: "A bot's profit and loss", Response: bot.PnLReport{}, Errors: []apierror.Code{apierror.NotFound}},
+	"POST /api/v1/admin/trading/pause": {
+		Summary:  "Reject new orders until trading resumes",
+		Request:  PauseTradingRequest{},
+		Response: engine.TradingStatus{},
+		Errors:   []apierror.Code{apierror.InvalidRequest},
+	},
+	"POST /api/v1/admin/trading/resume": {Summary: "Accept orders again", Response: engine.TradingStatus{}},
+	"POST /api/v1/admin/notifications": {
+		Summary:  "Send a notice, such as upcoming maintenance, to every client",
+		Request:  AnnounceRequest{},
+		Response: domain.Notification{},
+		Status:   http.StatusCreated,
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.UnknownSymbol},
+	},
+	"GET /api/v1/admin/subsystems": {Summary: "Background components and their state", Response: []subsystem.Status{}, Errors: []apierror.Code{apierror.NotFound}},
+	"GET /api/v1/admin/ws/stats":   {Summary: "WebSocket clients, subscriptions, queues and message counters", Response: ws.Stats{}},
+	"POST /api/v1/admin/subsystems/{name}/{action}": {
+		Summary:  "Start or stop a background component",
+		Response: subsystem.Status{},
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.NotFound},
+	},
+	"POST /api/v1/admin/candles/{symbol}/invalidate": {
+		Summary:  "Queue a range of candles for recomputation",
+		Request:  InvalidateCandlesRequest{},
+		Response: repository.CandleInvalidation{},
+		Status:   http.StatusAccepted,
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.NotFound},
+	},
+	"POST /api/v1/admin/symbols": {
+		Summary:  "List a symbol",
+		Request:  ListSymbolRequest{},
+		Response: domain.SymbolConfig{},
+		Status:   http.StatusCreated,
+		Errors:   []apierror.Code{apierror.InvalidRequest, apierror.NotFound},
+	},
+	"DELETE /api/v1/admin/symbols/{symbol}": {
+		Summary: "Delist a symbol, cancelling its orders",
+		Response: struct {
+			Symbol          string `json:"symbol"`
+			CancelledOrders int    `json:"cancelled_orders"`
+		}{},
+		Errors: []apierror.Code{apierror.UnknownSymbol, apierror.NotFound},
+	},
+	"DELETE /api/v1/admin/symbols/{symbol}/orders": {
+		Summary:  "Cancel every user's orders on a symbol",
+		Response: cancelledCount,
+		Errors:   []apierror.Code{apierror.Unavailable},
+	},
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/orderfeed"
+)
+
+const (
+	// Long polls wait this long by default and at most maxChangesTimeout
+	defaultChangesTimeout = 30 * time.Second
+	maxChangesTimeout     = 60 * time.Second
+	// changesWriteSlack is added to a poll's timeout for writing the reply
+	changesWriteSlack = 5 * time.Second
+)
+
+// SetOrderFeed enables long polling for order changes
+func (h *Handler) SetOrderFeed(feed *orderfeed.Feed) {
+	h.orderFeed = feed
+}
+
+// GetUserOrderChanges long-polls a user's order changes. It returns as soon
+// as any order changes after since_seq, or with no orders once timeout
+// elapses. The returned cursor is the user_seq carried by WebSocket order
+// updates, so clients can switch between the two.
+func (h *Handler) GetUserOrderChanges(w http.ResponseWriter, r *http.Request) {
+	if h.orderFeed == nil {
+		respondError(w, apierror.New(apierror.NotFound, "Order change polling is not enabled"))
+		return
+	}
+	userID := mux.Vars(r)["userId"]
+
+	var since uint64
+	if value := r.URL.Query().Get("since_seq"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			respondError(w, apierror.New(apierror.InvalidRequest, "invalid since_seq %q", value))
+			return
+		}
+		since = parsed
+	}
+
+	timeout := defaultChangesTimeout
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			respondError(w, apierror.New(apierror.InvalidRequest, "invalid timeout %q, e.g. 30s", value))
+			return
+		}
+		timeout = parsed
+		if timeout > maxChangesTimeout {
+			timeout = maxChangesTimeout
+		}
+	}
+
+	// The server's write timeout is shorter than a long poll
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + changesWriteSlack)); err != nil {
+		log.Printf("Failed to extend write deadline for order changes poll: %v", err)
+	}
+
+	changes, err := h.orderFeed.Wait(r.Context(), userID, since, timeout)
+	switch {
+	case errors.Is(err, orderfeed.ErrTooManyWaiters):
+		respondError(w, err)
+		return
+	case err != nil:
+		// The client went away; there is no one to answer
+		return
+	}
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: changes})
+}
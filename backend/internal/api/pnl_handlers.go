@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// SymbolPnL is a user's PnL on one symbol, in its quote asset
+type SymbolPnL struct {
+	Symbol        string  `json:"symbol"`
+	QuoteAsset    string  `json:"quote_asset"`
+	Quantity      float64 `json:"quantity"`
+	AvgEntryPrice float64 `json:"avg_entry_price"`
+	MarkPrice     float64 `json:"mark_price"`
+	RealizedPnL   float64 `json:"realized_pnl"`
+	UnrealizedPnL float64 `json:"unrealized_pnl"`
+	TotalPnL      float64 `json:"total_pnl"`
+}
+
+// PnLTotal sums the PnL of every symbol quoted in one asset
+type PnLTotal struct {
+	QuoteAsset    string  `json:"quote_asset"`
+	RealizedPnL   float64 `json:"realized_pnl"`
+	UnrealizedPnL float64 `json:"unrealized_pnl"`
+	TotalPnL      float64 `json:"total_pnl"`
+}
+
+// PnLReport is a user's PnL by symbol. With a window, realized PnL is what
+// trades in it realized; unrealized PnL is always the open position's now.
+type PnLReport struct {
+	UserID  string      `json:"user_id"`
+	From    *time.Time  `json:"from,omitempty"`
+	To      *time.Time  `json:"to,omitempty"`
+	Symbols []SymbolPnL `json:"symbols"`
+	Totals  []PnLTotal  `json:"totals"`
+}
+
+// GetUserPnL reports a user's realized and unrealized PnL by symbol, marked
+// against the engine's latest prices. ?from= and ?to= (RFC3339) recompute
+// realized PnL from the trades executed in [from, to).
+func (h *Handler) GetUserPnL(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	from, err := optionalTime(r, "from")
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	to, err := optionalTime(r, "to")
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		respondError(w, apierror.New(apierror.InvalidRequest, "from must be before to"))
+		return
+	}
+
+	positions, err := h.positionRepo.GetUserPositions(r.Context(), userID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	report := &PnLReport{UserID: userID, From: from, To: to, Symbols: make([]SymbolPnL, 0, len(positions))}
+	bySymbol := make(map[string]*SymbolPnL)
+	entry := func(symbol string) *SymbolPnL {
+		if pnl, ok := bySymbol[symbol]; ok {
+			return pnl
+		}
+		pnl := &SymbolPnL{Symbol: symbol}
+		if config, ok := h.exchange.SymbolConfig(symbol); ok {
+			pnl.QuoteAsset = config.QuoteAsset
+		}
+		bySymbol[symbol] = pnl
+		return pnl
+	}
+
+	for _, position := range positions {
+		if price, ok := h.markPrice(r.Context(), position.Symbol); ok {
+			position.MarkToMarket(price)
+		}
+		pnl := entry(position.Symbol)
+		pnl.Quantity = position.Quantity
+		pnl.AvgEntryPrice = position.AvgEntryPrice
+		pnl.MarkPrice = position.CurrentPrice
+		pnl.RealizedPnL = position.RealizedPnL
+		pnl.UnrealizedPnL = position.UnrealizedPnL
+	}
+
+	if from != nil || to != nil {
+		start, end := time.Time{}, time.Now()
+		if from != nil {
+			start = *from
+		}
+		if to != nil {
+			end = *to
+		}
+		trades, err := h.tradeRepo.GetUserTradesBefore(r.Context(), userID, end)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		for _, pnl := range bySymbol {
+			pnl.RealizedPnL = 0
+		}
+		for symbol, realized := range domain.RealizedPnLSince(userID, trades, start) {
+			entry(symbol).RealizedPnL = realized
+		}
+	}
+
+	totals := make(map[string]*PnLTotal)
+	for _, pnl := range bySymbol {
+		pnl.TotalPnL = pnl.RealizedPnL + pnl.UnrealizedPnL
+		report.Symbols = append(report.Symbols, *pnl)
+
+		total, ok := totals[pnl.QuoteAsset]
+		if !ok {
+			total = &PnLTotal{QuoteAsset: pnl.QuoteAsset}
+			totals[pnl.QuoteAsset] = total
+		}
+		total.RealizedPnL += pnl.RealizedPnL
+		total.UnrealizedPnL += pnl.UnrealizedPnL
+		total.TotalPnL += pnl.TotalPnL
+	}
+	sort.Slice(report.Symbols, func(i, j int) bool { return report.Symbols[i].Symbol < report.Symbols[j].Symbol })
+	report.Totals = make([]PnLTotal, 0, len(totals))
+	for _, total := range totals {
+		report.Totals = append(report.Totals, *total)
+	}
+	sort.Slice(report.Totals, func(i, j int) bool { return report.Totals[i].QuoteAsset < report.Totals[j].QuoteAsset })
+
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: report})
+}
+
+// optionalTime parses an RFC3339 query parameter, returning nil if unset
+func optionalTime(r *http.Request, name string) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, apierror.New(apierror.InvalidRequest, "%s must be an RFC3339 timestamp", name)
+	}
+	return &t, nil
+}
+
+// markPrice is the price positions on a symbol are marked against: the
+// engine's latest, or the stored ticker's before the price feed has run
+func (h *Handler) markPrice(ctx context.Context, symbol string) (float64, bool) {
+	if price, ok := h.exchange.LastPrice(symbol); ok {
+		return price, true
+	}
+	ticker, err := h.tickerRepo.GetTicker(ctx, symbol)
+	if err != nil {
+		return 0, false
+	}
+	return ticker.Price, true
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+// QueryParam describes one query string parameter a list endpoint accepts
+type QueryParam struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Default     string   `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Multiple    bool     `json:"multiple,omitempty"` // comma-separated list of values
+	Example     string   `json:"example"`
+}
+
+// ListResource declares how a list endpoint is queried. Handlers parse
+// requests with it and the meta endpoint publishes it, so the two can't drift.
+type ListResource struct {
+	Name         string       `json:"name"`
+	Path         string       `json:"path"`
+	DefaultLimit int          `json:"default_limit"`
+	MaxLimit     int          `json:"max_limit"`
+	DefaultSort  string       `json:"default_sort"`
+	SortFields   []string     `json:"sortable_fields"`
+	Cursor       string       `json:"cursor_format,omitempty"`
+	Params       []QueryParam `json:"params"`
+}
+
+// ListQuery is a parsed list request
+type ListQuery struct {
+	Limit    int
+	MaxLimit int
+	Cursor   *repository.Cursor
+	Filters  map[string]string
+}
+
+// Pagination describes a page of a cursor-paginated list. Pass NextCursor
+// back as ?cursor= to fetch the following page.
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	MaxLimit   int    `json:"max_limit"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// cursorFormat is what the meta endpoint reports for cursor-paginated lists
+const cursorFormat = "opaque; pass pagination.next_cursor back as ?cursor="
+
+// cursorParam is the continuation parameter of cursor-paginated resources
+var cursorParam = QueryParam{
+	Name:        "cursor",
+	Type:        "cursor",
+	Description: "continue after the last item of a previous page, from its pagination.next_cursor",
+	Example:     "MjAyNC0wMS0wMVQwMDowMDowMFp8b3JkLTE",
+}
+
+// paginate trims a page fetched with one row more than the query's limit and
+// describes it. cursor returns the position after the i'th row.
+func paginate(query *ListQuery, fetched int, cursor func(i int) *repository.Cursor) (int, *Pagination) {
+	limit := query.Limit
+	page := &Pagination{Limit: limit, MaxLimit: query.MaxLimit}
+	if fetched <= limit {
+		return fetched, page
+	}
+	page.HasMore = true
+	page.NextCursor = cursor(limit - 1).Encode()
+	return limit, page
+}
+
+// parseLimit reads a page size or depth parameter. Without one it is
+// defaultValue, and values above maxValue are capped to it. Anything but a
+// positive integer is rejected.
+func parseLimit(r *http.Request, name string, defaultValue, maxValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, apierror.New(apierror.InvalidRequest, "%s must be a positive integer", name)
+	}
+	if n > maxValue {
+		n = maxValue
+	}
+	return n, nil
+}
+
+// limitParam is the page size parameter every list resource accepts
+func limitParam(defaultLimit, maxLimit int) QueryParam {
+	return QueryParam{
+		Name:        "limit",
+		Type:        "integer",
+		Description: fmt.Sprintf("number of items to return, capped at %d", maxLimit),
+		Default:     strconv.Itoa(defaultLimit),
+		Example:     strconv.Itoa(defaultLimit),
+	}
+}
+
+// Parse validates r's query string against the resource's parameters
+func (res *ListResource) Parse(r *http.Request) (*ListQuery, error) {
+	values := r.URL.Query()
+	limit, err := parseLimit(r, "limit", res.DefaultLimit, res.MaxLimit)
+	if err != nil {
+		return nil, err
+	}
+	query := &ListQuery{Limit: limit, MaxLimit: res.MaxLimit, Filters: make(map[string]string)}
+
+	for _, param := range res.Params {
+		value := values.Get(param.Name)
+		if value == "" || param.Name == "limit" {
+			continue
+		}
+		if err := param.validate(value); err != nil {
+			return nil, err
+		}
+
+		if param.Type == "cursor" {
+			query.Cursor, _ = repository.ParseCursor(value)
+			continue
+		}
+		query.Filters[param.Name] = value
+	}
+
+	return query, nil
+}
+
+// Values splits a list parameter's value into its items
+func (q *ListQuery) Values(name string) []string {
+	value := q.Filters[name]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// Time returns a timestamp parameter's value, or the zero time if unset
+func (q *ListQuery) Time(name string) time.Time {
+	t, _ := time.Parse(time.RFC3339, q.Filters[name])
+	return t
+}
+
+// Bool returns a boolean parameter's value, or false if unset
+func (q *ListQuery) Bool(name string) bool {
+	b, _ := strconv.ParseBool(q.Filters[name])
+	return b
+}
+
+func (p *QueryParam) validate(value string) error {
+	if p.Multiple {
+		for _, item := range strings.Split(value, ",") {
+			if err := p.validateOne(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return p.validateOne(value)
+}
+
+func (p *QueryParam) validateOne(value string) error {
+	switch p.Type {
+	case "integer":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return apierror.New(apierror.InvalidRequest, "%s must be a positive integer", p.Name)
+		}
+	case "cursor":
+		if _, err := repository.ParseCursor(value); err != nil {
+			return apierror.New(apierror.InvalidRequest, "%s must be a next_cursor returned by this endpoint", p.Name)
+		}
+	case "timestamp":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return apierror.New(apierror.InvalidRequest, "%s must be an RFC3339 timestamp", p.Name)
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return apierror.New(apierror.InvalidRequest, "%s must be true or false", p.Name)
+		}
+	}
+
+	if len(p.Enum) > 0 {
+		for _, allowed := range p.Enum {
+			if value == allowed {
+				return nil
+			}
+		}
+		return apierror.New(apierror.InvalidRequest, "%s must be one of %v", p.Name, p.Enum)
+	}
+	return nil
+}
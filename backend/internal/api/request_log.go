@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultSlowRequest is how long a request may take before it is logged as a
+// warning
+const DefaultSlowRequest = 500 * time.Millisecond
+
+// maxRequestIDLength bounds an X-Request-ID accepted from a client
+const maxRequestIDLength = 128
+
+type requestContextKey struct{}
+
+// requestInfo is what the request log knows about a request. It is shared
+// through the context so middleware further in, like auth, can fill it in.
+type requestInfo struct {
+	id     string
+	caller string
+}
+
+// RequestID returns the ID the request log assigned to r, or "" outside it
+func RequestID(r *http.Request) string {
+	if info, ok := r.Context().Value(requestContextKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// noteCaller records who made the request for its log line
+func noteCaller(r *http.Request, caller string) {
+	if info, ok := r.Context().Value(requestContextKey{}).(*requestInfo); ok {
+		info.caller = caller
+	}
+}
+
+// SetSlowRequestThreshold sets how long a request may take before its log
+// line is a warning
+func (h *Handler) SetSlowRequestThreshold(threshold time.Duration) {
+	if threshold > 0 {
+		h.slowRequest = threshold
+	}
+}
+
+// requestLog gives every request an ID, taken from X-Request-ID when the
+// client sent a usable one, echoes it back and logs the request once it
+// completes
+func (h *Handler) requestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{id: r.Header.Get("X-Request-ID"), caller: clientAddress(r)}
+		if !validRequestID(info.id) {
+			info.id = uuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", info.id)
+
+		logged := &loggedResponse{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(logged, r.WithContext(context.WithValue(r.Context(), requestContextKey{}, info)))
+
+		elapsed := time.Since(start)
+		format := "%s %s caller=%s status=%d bytes=%d duration=%s request_id=%s"
+		streamed := logged.hijacked || logged.Header().Get("Content-Type") == "text/event-stream"
+		if elapsed > h.slowRequest && !streamed {
+			format = "WARN slow request: " + format
+		}
+		log.Printf(format, r.Method, r.URL.Path, info.caller, logged.status, logged.bytes, elapsed.Round(time.Microsecond), info.id)
+	})
+}
+
+// validRequestID accepts short IDs of letters, digits and -_.: so a client's
+// ID can't break up a log line
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// loggedResponse counts what a handler writes. It passes hijacking through
+// so WebSocket upgrades still work, and marks the connection as hijacked
+// since its duration is then the connection's lifetime. Unwrap lets an
+// http.ResponseController reach the connection beneath.
+type loggedResponse struct {
+	http.ResponseWriter
+	status   int
+	bytes    int
+	hijacked bool
+}
+
+func (l *loggedResponse) WriteHeader(status int) {
+	l.status = status
+	l.ResponseWriter.WriteHeader(status)
+}
+
+func (l *loggedResponse) Write(data []byte) (int, error) {
+	n, err := l.ResponseWriter.Write(data)
+	l.bytes += n
+	return n, err
+}
+
+func (l *loggedResponse) Unwrap() http.ResponseWriter {
+	return l.ResponseWriter
+}
+
+func (l *loggedResponse) Flush() {
+	if flusher, ok := l.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (l *loggedResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := l.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	l.hijacked = true
+	l.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
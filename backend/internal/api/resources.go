@@ -0,0 +1,177 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/hft-exchange/backend/internal/candles"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/notify"
+)
+
+var orderStatuses = []string{
+	string(domain.OrderStatusPending),
+	string(domain.OrderStatusPartial),
+	string(domain.OrderStatusFilled),
+	string(domain.OrderStatusCancelled),
+	string(domain.OrderStatusRejected),
+}
+
+var orderSides = []string{
+	string(domain.OrderSideBuy),
+	string(domain.OrderSideSell),
+}
+
+var userOrdersResource = &ListResource{
+	Name:         "orders",
+	Path:         "/api/v1/users/{userId}/orders",
+	DefaultLimit: 50,
+	MaxLimit:     500,
+	DefaultSort:  "-created_at",
+	SortFields:   []string{"created_at"},
+	Cursor:       cursorFormat,
+	Params: []QueryParam{
+		limitParam(50, 500),
+		cursorParam,
+		{Name: "symbol", Type: "string", Description: "only orders on this symbol", Example: "BTC-USD"},
+		{Name: "status", Type: "string", Description: "only orders in one of these comma-separated statuses", Enum: orderStatuses, Multiple: true, Example: "PENDING,PARTIAL"},
+		{Name: "side", Type: "string", Description: "only orders on this side", Enum: orderSides, Example: "SELL"},
+		{Name: "start", Type: "timestamp", Description: "only orders created at or after this time", Example: "2024-01-01T00:00:00Z"},
+		{Name: "end", Type: "timestamp", Description: "only orders created before this time", Example: "2024-01-02T00:00:00Z"},
+	},
+}
+
+var userTradesResource = &ListResource{
+	Name:         "trades",
+	Path:         "/api/v1/users/{userId}/trades",
+	DefaultLimit: 50,
+	MaxLimit:     500,
+	DefaultSort:  "-executed_at",
+	SortFields:   []string{"executed_at"},
+	Cursor:       cursorFormat,
+	Params: []QueryParam{
+		limitParam(50, 500),
+		cursorParam,
+		{Name: "symbol", Type: "string", Description: "only trades on this symbol", Example: "BTC-USD"},
+	},
+}
+
+var recentTradesResource = &ListResource{
+	Name:         "recent_trades",
+	Path:         "/api/v1/trades/{symbol}",
+	DefaultLimit: 20,
+	MaxLimit:     1000,
+	DefaultSort:  "-executed_at",
+	SortFields:   []string{"executed_at"},
+	Cursor:       cursorFormat,
+	Params: []QueryParam{
+		limitParam(20, 1000),
+		cursorParam,
+		{Name: "after", Type: "timestamp", Description: "only trades executed after this time", Example: "2024-01-01T00:00:00Z"},
+		{Name: "before", Type: "timestamp", Description: "only trades executed before this time", Example: "2024-01-02T00:00:00Z"},
+		{Name: "aggregate", Type: "boolean", Description: "sum consecutive trades of the same taker order into one print", Default: "false", Example: "true"},
+	},
+}
+
+var klinesResource = &ListResource{
+	Name:         "klines",
+	Path:         "/api/v1/klines/{symbol}",
+	DefaultLimit: 100,
+	MaxLimit:     1000,
+	DefaultSort:  "bucket_start",
+	SortFields:   []string{"bucket_start"},
+	Params: []QueryParam{
+		limitParam(100, 1000),
+		{Name: "interval", Type: "string", Description: "candle width", Default: "1m", Enum: candles.Intervals, Example: "5m"},
+		{Name: "start", Type: "timestamp", Description: "first candle to return; without it the latest candles are returned", Example: "2024-01-01T00:00:00Z"},
+		{Name: "end", Type: "timestamp", Description: "return candles before this time, default now", Example: "2024-01-02T00:00:00Z"},
+	},
+}
+
+var userKinds = []string{
+	string(domain.UserKindUser),
+	string(domain.UserKindBot),
+	string(domain.UserKindSystem),
+}
+
+var adminUsersResource = &ListResource{
+	Name:         "users",
+	Path:         "/api/v1/admin/users",
+	DefaultLimit: 50,
+	MaxLimit:     200,
+	DefaultSort:  "id",
+	SortFields:   []string{"id"},
+	Cursor:       cursorFormat,
+	Params: []QueryParam{
+		limitParam(50, 200),
+		cursorParam,
+		{Name: "kind", Type: "string", Description: "only users of this kind", Enum: userKinds, Example: "bot"},
+		{Name: "status", Type: "string", Description: "only active or only disabled users", Enum: []string{"active", "disabled"}, Example: "disabled"},
+	},
+}
+
+var systemNotificationsResource = &ListResource{
+	Name:         "notifications",
+	Path:         "/api/v1/notifications",
+	DefaultLimit: 20,
+	MaxLimit:     engine.NotificationsKept,
+	DefaultSort:  "-timestamp",
+	SortFields:   []string{"timestamp"},
+	Params: []QueryParam{
+		limitParam(20, engine.NotificationsKept),
+	},
+}
+
+var userActivityResource = &ListResource{
+	Name:         "activity",
+	Path:         "/api/v1/users/{userId}/activity",
+	DefaultLimit: 20,
+	MaxLimit:     notify.ActivityKept,
+	DefaultSort:  "-timestamp",
+	SortFields:   []string{"timestamp"},
+	Params: []QueryParam{
+		limitParam(20, notify.ActivityKept),
+	},
+}
+
+var orderFillsResource = &ListResource{
+	Name:         "fills",
+	Path:         "/api/v1/orders/{id}/fills",
+	DefaultLimit: 1000,
+	MaxLimit:     1000,
+	DefaultSort:  "executed_at",
+	SortFields:   []string{"executed_at"},
+	Params: []QueryParam{
+		limitParam(1000, 1000),
+		userIDParam,
+	},
+}
+
+var balanceLedgerResource = &ListResource{
+	Name:         "ledger",
+	Path:         "/api/v1/admin/balances/{userId}/ledger",
+	DefaultLimit: 100,
+	MaxLimit:     1000,
+	DefaultSort:  "-created_at",
+	SortFields:   []string{"created_at"},
+	Params: []QueryParam{
+		limitParam(100, 1000),
+	},
+}
+
+// listResources is every list endpoint, as published by the meta endpoint
+var listResources = []*ListResource{
+	userOrdersResource,
+	userTradesResource,
+	recentTradesResource,
+	klinesResource,
+	orderFillsResource,
+	adminUsersResource,
+	balanceLedgerResource,
+	systemNotificationsResource,
+	userActivityResource,
+}
+
+func (h *Handler) GetResourceMeta(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: listResources})
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// unpagedLists are the GET routes answering with a list that is bounded by
+// what exists rather than by history, so they take no limit
+var unpagedLists = map[string]bool{
+	"GET /api/v1/admin/subsystems":                 true,
+	"GET /api/v1/docs/examples":                    true,
+	"GET /api/v1/meta/resources":                   true,
+	"GET /api/v1/symbols":                          true,
+	"GET /api/v1/symbols/status":                   true,
+	"GET /api/v1/tickers":                          true,
+	"GET /api/v1/users/{userId}/balances":          true,
+	"GET /api/v1/users/{userId}/notifications/log": true,
+	"GET /api/v1/users/{userId}/positions":         true,
+	"GET /api/v1/users/{userId}/stats":             true,
+}
+
+// Every GET route answering with a list is declared by a ListResource
+// published in listResources, unless it is one of unpagedLists, and no
+// route takes a limit or cursor outside one
+func TestListRoutesHaveResources(t *testing.T) {
+	published := make(map[*ListResource]bool)
+	for _, res := range listResources {
+		published[res] = true
+	}
+
+	declared := make(map[*ListResource]bool)
+	for key, op := range operations {
+		for _, param := range op.Params {
+			if param.Name == "limit" || param.Type == "cursor" {
+				t.Errorf("%s takes %s outside a ListResource", key, param.Name)
+			}
+		}
+		if op.Resource != nil {
+			declared[op.Resource] = true
+			if !published[op.Resource] {
+				t.Errorf("%s's resource %s isn't in listResources", key, op.Resource.Name)
+			}
+			if want := "GET " + op.Resource.Path; key != want {
+				t.Errorf("resource %s is declared by %s, want %s", op.Resource.Name, key, want)
+			}
+			continue
+		}
+		if !strings.HasPrefix(key, "GET ") || op.Response == nil || reflect.TypeOf(op.Response).Kind() != reflect.Slice {
+			continue
+		}
+		if !unpagedLists[key] {
+			t.Errorf("%s lists %T without a ListResource", key, op.Response)
+		}
+	}
+	for _, res := range listResources {
+		if !declared[res] {
+			t.Errorf("resource %s is published but no route declares it", res.Name)
+		}
+	}
+}
+
+// Every resource's documented defaults and examples pass its own
+// validation, and it sorts by a field it says is sortable
+func TestResourceExamplesValidate(t *testing.T) {
+	for _, res := range listResources {
+		if len(res.SortFields) == 0 {
+			t.Errorf("%s: no sortable_fields", res.Name)
+		}
+		sortField := strings.TrimPrefix(res.DefaultSort, "-")
+		found := false
+		for _, field := range res.SortFields {
+			found = found || field == sortField
+		}
+		if !found {
+			t.Errorf("%s: default_sort %s isn't among sortable_fields %v", res.Name, res.DefaultSort, res.SortFields)
+		}
+		if res.DefaultLimit <= 0 || res.DefaultLimit > res.MaxLimit {
+			t.Errorf("%s: default_limit %d outside 1..%d", res.Name, res.DefaultLimit, res.MaxLimit)
+		}
+
+		examples := url.Values{}
+		for _, param := range res.Params {
+			if param.Example == "" {
+				t.Errorf("%s: %s has no example", res.Name, param.Name)
+				continue
+			}
+			if err := param.validate(param.Example); err != nil {
+				t.Errorf("%s: %s's example %q: %v", res.Name, param.Name, param.Example, err)
+			}
+			if param.Default != "" {
+				if err := param.validate(param.Default); err != nil {
+					t.Errorf("%s: %s's default %q: %v", res.Name, param.Name, param.Default, err)
+				}
+			}
+			examples.Set(param.Name, param.Example)
+		}
+
+		request := httptest.NewRequest(http.MethodGet, res.Path+"?"+examples.Encode(), nil)
+		query, err := res.Parse(request)
+		if err != nil {
+			t.Errorf("%s: every example at once: %v", res.Name, err)
+			continue
+		}
+		if query.Limit <= 0 || query.Limit > res.MaxLimit {
+			t.Errorf("%s: the example limit parsed as %d", res.Name, query.Limit)
+		}
+	}
+}
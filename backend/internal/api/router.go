@@ -1,77 +1,207 @@
 package api
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
-	"github.com/rs/cors"
+	"github.com/hft-exchange/backend/internal/apierror"
 	ws "github.com/hft-exchange/backend/internal/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for development
-	},
-}
 
+// NewRouter registers every route with the scope it requires; see auth.go
 func NewRouter(handler *Handler, hub *ws.Hub) http.Handler {
+	r, policy := newMux(handler, hub)
+	return handler.trustProxy(handler.requestLog(policy.handler(r)))
+}
+
+// newMux registers the routes NewRouter serves behind its outer middleware,
+// and returns them with the CORS policy that middleware applies
+func newMux(handler *Handler, hub *ws.Hub) (*mux.Router, *corsPolicy) {
 	r := mux.NewRouter()
+	auth := handler.auth
+	if auth == nil {
+		auth = NewAuth(nil, ScopeAdmin, 0)
+	}
+	r.Use(auth.middleware)
+	openAPI := &openAPIDocument{}
+	policy := newCORSPolicy(handler.cors)
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		CheckOrigin:       policy.checkOrigin,
+		EnableCompression: hub.Compression(),
+	}
 
 	// Health check
-	r.HandleFunc("/health", handler.HealthCheck).Methods("GET")
+	auth.handle(r, ScopePublic, "GET", "/health", handler.HealthCheck)
+	auth.handle(r, ScopePublic, "GET", "/health/live", handler.LivenessCheck)
+	auth.handle(r, ScopePublic, "GET", "/health/ready", handler.ReadinessCheck)
+
+	// Prometheus scrapes; outside /api/v1 so the response is written as is
+	auth.handle(r, ScopeAdmin, "GET", "/metrics", handler.serveMetrics(hub))
+
+	// Server-Sent Events fallback for clients that can't open a WebSocket.
+	// Registered ahead of the API subrouter, whose legacy number rewriting
+	// buffers whole responses.
+	auth.handle(r, ScopeMarketData, "GET", "/api/v1/stream", handler.streamMarketData(hub))
 
 	// API routes
 	api := r.PathPrefix("/api/v1").Subrouter()
+	api.Use(compressResponses)
+	api.Use(responseTime)
+	api.Use(legacyNumbers)
+
+	// Accounts; anyone who may read market data may sign up and log in
+	auth.handle(api, ScopeMarketData, "POST", "/users", handler.Register)
+	auth.handle(api, ScopeMarketData, "POST", "/auth/login", handler.Login)
 
 	// Orders
-	api.HandleFunc("/orders", handler.PlaceOrder).Methods("POST")
-	api.HandleFunc("/orders/{id}", handler.CancelOrder).Methods("DELETE")
-	api.HandleFunc("/users/{userId}/orders", handler.GetUserOrders).Methods("GET")
+	auth.handle(api, ScopeTrade, "POST", "/orders", handler.idempotent(handler.PlaceOrder))
+	auth.handle(api, ScopeTrade, "POST", "/orders/batch", handler.PlaceOrderBatch)
+	auth.handle(api, ScopeTrade, "POST", "/orders/cancel-batch", handler.CancelOrderBatch)
+	auth.handle(api, ScopeTrade, "DELETE", "/orders/{id}", handler.CancelOrder)
+	auth.handle(api, ScopeRead, "GET", "/orders/{id}/fills", handler.GetOrderFills)
+	auth.handle(api, ScopeRead, "GET", "/users/{userId}/orders", handler.GetUserOrders)
+	auth.handle(api, ScopeTrade, "DELETE", "/users/{userId}/orders", handler.CancelUserOrders)
+	auth.handle(api, ScopeRead, "GET", "/users/{userId}/open-orders", handler.GetUserOpenOrders)
+	auth.handle(api, ScopeRead, "GET", "/users/{userId}/orders/changes", handler.GetUserOrderChanges)
 
 	// Trades
-	api.HandleFunc("/trades/{symbol}", handler.GetRecentTrades).Methods("GET")
-	api.HandleFunc("/users/{userId}/trades", handler.GetUserTrades).Methods("GET")
+	auth.handle(api, ScopeMarketData, "GET", "/trades/{symbol}", handler.GetRecentTrades)
+	auth.handle(api, ScopeMarketData, "GET", "/klines/{symbol}", handler.GetKlines)
+	auth.handle(api, ScopeRead, "GET", "/users/{userId}/trades", handler.GetUserTrades)
 
 	// Order book
-	api.HandleFunc("/orderbook/{symbol}", handler.GetOrderBook).Methods("GET")
+	auth.handle(api, ScopeMarketData, "GET", "/orderbook/{symbol}", handler.GetOrderBook)
+	auth.handle(api, ScopeMarketData, "GET", "/orderbook/{symbol}/full", handler.GetFullOrderBook)
+	auth.handle(api, ScopeMarketData, "GET", "/depth/{symbol}", handler.GetDepth)
 
 	// Balances
-	api.HandleFunc("/users/{userId}/balances", handler.GetUserBalances).Methods("GET")
+	auth.handle(api, ScopeRead, "GET", "/users/{userId}/balances", handler.GetUserBalances)
+	auth.handle(api, ScopeTrade, "POST", "/users/{userId}/deposits", handler.CreateDeposit)
+	auth.handle(api, ScopeTrade, "POST", "/users/{userId}/withdrawals", handler.CreateWithdrawal)
 
-	// Tickers
-	api.HandleFunc("/tickers", handler.GetAllTickers).Methods("GET")
-	api.HandleFunc("/tickers/{symbol}", handler.GetTicker).Methods("GET")
+	// Positions
+	auth.handle(api, ScopeRead, "GET", "/users/{userId}/positions", handler.GetUserPositions)
+	auth.handle(api, ScopeRead, "GET", "/users/{userId}/pnl", handler.GetUserPnL)
 
-	// Symbols
-	api.HandleFunc("/symbols", handler.GetSymbols).Methods("GET")
+	// Risk
+	auth.handle(api, ScopeRead, "GET", "/users/{userId}/stats", handler.GetUserStats)
 
-	// WebSocket
-	r.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		handleWebSocket(hub, w, r)
-	})
+	// Notifications
+	auth.handle(api, ScopeRead, "GET", "/users/{userId}/notifications/settings", handler.GetNotificationSettings)
+	auth.handle(api, ScopeTrade, "PUT", "/users/{userId}/notifications/settings", handler.UpdateNotificationSettings)
+	auth.handle(api, ScopeRead, "GET", "/users/{userId}/notifications/log", handler.GetNotificationLog)
+	auth.handle(api, ScopeMarketData, "GET", "/notifications", handler.GetSystemNotifications)
+	auth.handle(api, ScopeRead, "GET", "/users/{userId}/activity", handler.GetUserActivity)
+
+	// Tickers
+	auth.handle(api, ScopeMarketData, "GET", "/tickers", handler.GetAllTickers)
+	auth.handle(api, ScopeMarketData, "GET", "/tickers/{symbol}", handler.GetTicker)
 
-	// CORS
-	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"*"},
-		AllowCredentials: true,
+	// Symbols
+	auth.handle(api, ScopeMarketData, "GET", "/symbols", handler.GetSymbols)
+	auth.handle(api, ScopeMarketData, "GET", "/symbols/status", handler.GetSymbolStatuses)
+	auth.handle(api, ScopeMarketData, "GET", "/symbols/{symbol}/status", handler.GetSymbolStatus)
+	auth.handle(api, ScopeMarketData, "GET", "/exchangeInfo", handler.GetExchangeInfo)
+	auth.handle(api, ScopePublic, "GET", "/time", handler.GetServerTime)
+
+	// Meta
+	auth.handle(api, ScopeMarketData, "GET", "/meta/resources", handler.GetResourceMeta)
+	auth.handle(api, ScopeMarketData, "GET", "/docs/examples", handler.GetDocExamples)
+	auth.handle(api, ScopePublic, "GET", "/openapi.json", openAPI.ServeHTTP)
+	auth.handle(r, ScopePublic, "GET", "/docs", handler.GetDocsUI)
+
+	// Admin
+	admin := api.PathPrefix("/admin").Subrouter()
+	auth.handle(admin, ScopeAdmin, "POST", "/engine/{symbol}/self-check", handler.RunEngineSelfCheck)
+	auth.handle(admin, ScopeAdmin, "GET", "/engine/{symbol}", handler.GetEngineStats)
+	auth.handle(admin, ScopeAdmin, "POST", "/engine/{symbol}/purge-order/{id}", handler.PurgeOrder)
+	auth.handle(admin, ScopeAdmin, "GET", "/orderbook/{symbol}/history", handler.GetHistoricalOrderBook)
+	auth.handle(admin, ScopeAdmin, "GET", "/replication", handler.GetReplicationStatus)
+	auth.handle(admin, ScopeAdmin, "POST", "/replication/promote", handler.PromoteStandby)
+	auth.handle(admin, ScopeAdmin, "GET", "/cache", handler.GetCacheStats)
+	auth.handle(admin, ScopeAdmin, "GET", "/settlements", handler.GetPendingSettlements)
+	auth.handle(admin, ScopeAdmin, "GET", "/open-orders-index", handler.GetOpenOrderIndex)
+	auth.handle(admin, ScopeAdmin, "GET", "/capacity", handler.GetCapacity)
+	auth.handle(admin, ScopeAdmin, "GET", "/risk-profiles", handler.GetRiskProfiles)
+	auth.handle(admin, ScopeAdmin, "GET", "/risk-profiles/{userId}", handler.GetRiskProfile)
+	auth.handle(admin, ScopeAdmin, "PUT", "/risk-profiles/{userId}", handler.UpdateRiskProfile)
+	auth.handle(admin, ScopeAdmin, "DELETE", "/risk-profiles/{userId}", handler.DeleteRiskProfile)
+	auth.handle(admin, ScopeAdmin, "GET", "/users", handler.GetUsers)
+	auth.handle(admin, ScopeAdmin, "GET", "/users/{userId}", handler.GetUser)
+	auth.handle(admin, ScopeAdmin, "POST", "/users/{userId}/disable", handler.DisableUser)
+	auth.handle(admin, ScopeAdmin, "POST", "/users/{userId}/enable", handler.EnableUser)
+	auth.handle(admin, ScopeAdmin, "POST", "/users/{userId}/verify", handler.VerifyUser)
+	auth.handle(admin, ScopeAdmin, "POST", "/users/{userId}/unverify", handler.UnverifyUser)
+	auth.handle(admin, ScopeAdmin, "POST", "/balances/adjust", handler.AdjustBalance)
+	auth.handle(admin, ScopeAdmin, "GET", "/balances/{userId}/ledger", handler.GetBalanceLedger)
+	auth.handle(admin, ScopeAdmin, "GET", "/reconciliation", handler.GetReconciliation)
+	auth.handle(admin, ScopeAdmin, "POST", "/transfers", handler.CreateTransfer)
+	auth.handle(admin, ScopeAdmin, "GET", "/bots/{name}/pnl", handler.GetBotPnL)
+	auth.handle(admin, ScopeAdmin, "POST", "/trading/pause", handler.PauseTrading)
+	auth.handle(admin, ScopeAdmin, "POST", "/trading/resume", handler.ResumeTrading)
+	auth.handle(admin, ScopeAdmin, "POST", "/notifications", handler.Announce)
+	auth.handle(admin, ScopeAdmin, "GET", "/subsystems", handler.GetSubsystems)
+	auth.handle(admin, ScopeAdmin, "POST", "/subsystems/{name}/{action}", handler.ControlSubsystem)
+	auth.handle(admin, ScopeAdmin, "GET", "/ws/stats", handler.getWebSocketStats(hub))
+	auth.handle(admin, ScopeAdmin, "POST", "/candles/{symbol}/invalidate", handler.InvalidateCandles)
+	auth.handle(admin, ScopeAdmin, "POST", "/symbols", handler.ListSymbol)
+	auth.handle(admin, ScopeAdmin, "DELETE", "/symbols/{symbol}", handler.DelistSymbol)
+	auth.handle(admin, ScopeAdmin, "DELETE", "/symbols/{symbol}/orders", handler.CancelSymbolOrders)
+
+	// WebSocket. Public channels are market data; the user channel checks
+	// for read scope when it is subscribed to.
+	auth.handle(r, ScopeMarketData, "", "/ws", func(w http.ResponseWriter, r *http.Request) {
+		handler.handleWebSocket(hub, upgrader, w, r)
 	})
+	auth.checkRoutes(r)
+	openAPI.build(r, auth)
 
-	return c.Handler(r)
+	return r, policy
 }
 
-func handleWebSocket(hub *ws.Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+func (h *Handler) handleWebSocket(hub *ws.Hub, upgrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request) {
+	version, err := ws.ParseProtocolVersion(r.URL.Query().Get("protocol_version"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	client, err := hub.Upgrade(upgrader, w, r, clientAddress(r))
+	var rejected *ws.RejectedError
+	if errors.As(err, &rejected) {
+		respondConnectionRejected(w, rejected)
+		return
+	}
 	if err != nil {
 		return
 	}
 
-	client := ws.NewClient(hub, conn)
-	hub.Register <- client
+	client.SetLegacyNumbers(wantsLegacyNumbers(r))
+	client.SetProtocolVersion(version)
+	client.SetUser(CallerUser(r), callerSessionExpiry(r))
+	client.SetReadScope(h.callerHolds(r, ScopeRead))
+	if !hub.Connect(client) {
+		client.Close()
+		return
+	}
 
 	client.Start()
 }
+
+// respondConnectionRejected turns away a WebSocket connection over the hub's
+// limits before it is upgraded: with 429 when its address has too many
+// already, and otherwise with 503. Either way it is told when to retry.
+func respondConnectionRejected(w http.ResponseWriter, rejected *ws.RejectedError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rejected.RetryAfter.Seconds()))))
+	code := apierror.Unavailable
+	if rejected.Reason == ws.RejectedAddress {
+		code = apierror.RateLimited
+	}
+	respondError(w, apierror.New(code, "%s", rejected.Error()))
+}
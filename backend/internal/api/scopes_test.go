@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	ws "github.com/hft-exchange/backend/internal/websocket"
+)
+
+// routeScopes is the scope every route requires. A route added without an
+// entry here, or registered with another scope, fails TestRouteScopes.
+var routeScopes = []struct {
+	method string
+	path   string
+	scope  Scope
+}{
+	{"GET", "/health", ScopePublic},
+	{"GET", "/health/live", ScopePublic},
+	{"GET", "/health/ready", ScopePublic},
+	{"GET", "/metrics", ScopeAdmin},
+	{"GET", "/api/v1/stream", ScopeMarketData},
+	{"POST", "/api/v1/users", ScopeMarketData},
+	{"POST", "/api/v1/auth/login", ScopeMarketData},
+	{"POST", "/api/v1/orders", ScopeTrade},
+	{"POST", "/api/v1/orders/batch", ScopeTrade},
+	{"POST", "/api/v1/orders/cancel-batch", ScopeTrade},
+	{"DELETE", "/api/v1/orders/{id}", ScopeTrade},
+	{"GET", "/api/v1/orders/{id}/fills", ScopeRead},
+	{"GET", "/api/v1/users/{userId}/orders", ScopeRead},
+	{"DELETE", "/api/v1/users/{userId}/orders", ScopeTrade},
+	{"GET", "/api/v1/users/{userId}/open-orders", ScopeRead},
+	{"GET", "/api/v1/users/{userId}/orders/changes", ScopeRead},
+	{"GET", "/api/v1/trades/{symbol}", ScopeMarketData},
+	{"GET", "/api/v1/klines/{symbol}", ScopeMarketData},
+	{"GET", "/api/v1/users/{userId}/trades", ScopeRead},
+	{"GET", "/api/v1/orderbook/{symbol}", ScopeMarketData},
+	{"GET", "/api/v1/orderbook/{symbol}/full", ScopeMarketData},
+	{"GET", "/api/v1/depth/{symbol}", ScopeMarketData},
+	{"GET", "/api/v1/users/{userId}/balances", ScopeRead},
+	{"POST", "/api/v1/users/{userId}/deposits", ScopeTrade},
+	{"POST", "/api/v1/users/{userId}/withdrawals", ScopeTrade},
+	{"GET", "/api/v1/users/{userId}/positions", ScopeRead},
+	{"GET", "/api/v1/users/{userId}/pnl", ScopeRead},
+	{"GET", "/api/v1/users/{userId}/stats", ScopeRead},
+	{"GET", "/api/v1/users/{userId}/notifications/settings", ScopeRead},
+	{"PUT", "/api/v1/users/{userId}/notifications/settings", ScopeTrade},
+	{"GET", "/api/v1/users/{userId}/notifications/log", ScopeRead},
+	{"GET", "/api/v1/notifications", ScopeMarketData},
+	{"GET", "/api/v1/users/{userId}/activity", ScopeRead},
+	{"GET", "/api/v1/tickers", ScopeMarketData},
+	{"GET", "/api/v1/tickers/{symbol}", ScopeMarketData},
+	{"GET", "/api/v1/symbols", ScopeMarketData},
+	{"GET", "/api/v1/symbols/status", ScopeMarketData},
+	{"GET", "/api/v1/symbols/{symbol}/status", ScopeMarketData},
+	{"GET", "/api/v1/exchangeInfo", ScopeMarketData},
+	{"GET", "/api/v1/time", ScopePublic},
+	{"GET", "/api/v1/meta/resources", ScopeMarketData},
+	{"GET", "/api/v1/docs/examples", ScopeMarketData},
+	{"GET", "/api/v1/openapi.json", ScopePublic},
+	{"POST", "/api/v1/admin/engine/{symbol}/self-check", ScopeAdmin},
+	{"GET", "/api/v1/admin/engine/{symbol}", ScopeAdmin},
+	{"POST", "/api/v1/admin/engine/{symbol}/purge-order/{id}", ScopeAdmin},
+	{"GET", "/api/v1/admin/orderbook/{symbol}/history", ScopeAdmin},
+	{"GET", "/api/v1/admin/replication", ScopeAdmin},
+	{"POST", "/api/v1/admin/replication/promote", ScopeAdmin},
+	{"GET", "/api/v1/admin/cache", ScopeAdmin},
+	{"GET", "/api/v1/admin/settlements", ScopeAdmin},
+	{"GET", "/api/v1/admin/open-orders-index", ScopeAdmin},
+	{"GET", "/api/v1/admin/capacity", ScopeAdmin},
+	{"GET", "/api/v1/admin/risk-profiles", ScopeAdmin},
+	{"GET", "/api/v1/admin/risk-profiles/{userId}", ScopeAdmin},
+	{"PUT", "/api/v1/admin/risk-profiles/{userId}", ScopeAdmin},
+	{"DELETE", "/api/v1/admin/risk-profiles/{userId}", ScopeAdmin},
+	{"GET", "/api/v1/admin/users", ScopeAdmin},
+	{"GET", "/api/v1/admin/users/{userId}", ScopeAdmin},
+	{"POST", "/api/v1/admin/users/{userId}/disable", ScopeAdmin},
+	{"POST", "/api/v1/admin/users/{userId}/enable", ScopeAdmin},
+	{"POST", "/api/v1/admin/users/{userId}/verify", ScopeAdmin},
+	{"POST", "/api/v1/admin/users/{userId}/unverify", ScopeAdmin},
+	{"POST", "/api/v1/admin/balances/adjust", ScopeAdmin},
+	{"GET", "/api/v1/admin/balances/{userId}/ledger", ScopeAdmin},
+	{"GET", "/api/v1/admin/reconciliation", ScopeAdmin},
+	{"POST", "/api/v1/admin/transfers", ScopeAdmin},
+	{"GET", "/api/v1/admin/bots/{name}/pnl", ScopeAdmin},
+	{"POST", "/api/v1/admin/trading/pause", ScopeAdmin},
+	{"POST", "/api/v1/admin/trading/resume", ScopeAdmin},
+	{"POST", "/api/v1/admin/notifications", ScopeAdmin},
+	{"GET", "/api/v1/admin/subsystems", ScopeAdmin},
+	{"POST", "/api/v1/admin/subsystems/{name}/{action}", ScopeAdmin},
+	{"GET", "/api/v1/admin/ws/stats", ScopeAdmin},
+	{"POST", "/api/v1/admin/candles/{symbol}/invalidate", ScopeAdmin},
+	{"POST", "/api/v1/admin/symbols", ScopeAdmin},
+	{"DELETE", "/api/v1/admin/symbols/{symbol}", ScopeAdmin},
+	{"DELETE", "/api/v1/admin/symbols/{symbol}/orders", ScopeAdmin},
+	{"GET", "/docs", ScopePublic},
+	{"GET", "/ws", ScopeMarketData},
+}
+
+// Every registered route requires the scope routeScopes lists for it
+func TestRouteScopes(t *testing.T) {
+	h := &Handler{}
+	h.SetAuth(NewAuth(nil, ScopeMarketData, 0))
+	r, _ := newMux(h, ws.NewHub())
+
+	registered := make(map[string]Scope)
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			registered[method+" "+path] = h.auth.scopes[route]
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range routeScopes {
+		key := want.method + " " + want.path
+		scope, ok := registered[key]
+		if !ok {
+			t.Errorf("%s isn't registered", key)
+			continue
+		}
+		delete(registered, key)
+		if scope != want.scope {
+			t.Errorf("%s requires %s, want %s", key, scope, want.scope)
+		}
+		if strings.HasPrefix(want.path, "/api/v1/admin/") && want.scope != ScopeAdmin {
+			t.Errorf("%s is under /admin but requires %s", key, want.scope)
+		}
+	}
+	for key, scope := range registered {
+		t.Errorf("%s requires %s but has no entry in routeScopes", key, scope)
+	}
+}
+
+// A market_data key, and an anonymous caller by default, are refused every
+// route that needs more, without reaching its handler
+func TestMarketDataCallersRefused(t *testing.T) {
+	keys, err := ParseAPIKeys("site:md-secret:market_data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{}
+	h.SetAuth(NewAuth(keys, ScopeMarketData, 0))
+	r, _ := newMux(h, ws.NewHub())
+
+	refused := 0
+	for _, route := range routeScopes {
+		if scopeLevels[route.scope] <= scopeLevels[ScopeMarketData] {
+			continue
+		}
+		path := strings.NewReplacer("{userId}", "user-1", "{id}", "order-1", "{symbol}", "BTC-USD", "{name}", "market_maker", "{action}", "stop").Replace(route.path)
+		for _, key := range []string{"md-secret", ""} {
+			request := httptest.NewRequest(route.method, path, strings.NewReader("{}"))
+			if key != "" {
+				request.Header.Set("X-API-Key", key)
+			}
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, request)
+			if recorder.Code != http.StatusForbidden {
+				t.Errorf("%s %s with key %q: %d, want 403", route.method, path, key, recorder.Code)
+			}
+		}
+		refused++
+	}
+
+	// The routes most worth refusing are among them
+	for _, path := range []string{"/api/v1/admin/trading/pause", "/api/v1/orders"} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}"))
+		request.Header.Set("X-API-Key", "md-secret")
+		r.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf("POST %s with a market_data key: %d, want 403", path, recorder.Code)
+		}
+	}
+	if refused == 0 {
+		t.Fatal("no route needs more than market_data")
+	}
+}
+
+// A market_data key may stream the public channels over /ws, while the
+// user channel stays closed to it
+func TestMarketDataWebSocket(t *testing.T) {
+	keys, err := ParseAPIKeys("site:md-secret:market_data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{}
+	h.SetAuth(NewAuth(keys, ScopeMarketData, 0))
+	hub := ws.NewHub()
+	go hub.Run()
+	r, _ := newMux(h, hub)
+	server := httptest.NewServer(r)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		hub.Shutdown(ctx)
+		server.Close()
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?api_key=md-secret", nil)
+	if err != nil {
+		t.Fatalf("dialing /ws with a market_data key: %v", err)
+	}
+	defer conn.Close()
+	subscribe := func(channel, symbol string) (string, ws.Reply) {
+		t.Helper()
+		if err := conn.WriteJSON(ws.ClientMessage{Op: ws.OpSubscribe, Channel: channel, Symbol: symbol}); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var message struct {
+				Type string   `json:"type"`
+				Data ws.Reply `json:"data"`
+			}
+			if err := conn.ReadJSON(&message); err != nil {
+				t.Fatalf("waiting for the answer to subscribing to %s: %v", channel, err)
+			}
+			if (message.Type == "ack" || message.Type == "error") && message.Data.Channel == channel {
+				return message.Type, message.Data
+			}
+		}
+	}
+
+	if kind, reply := subscribe(ws.ChannelTrades, "BTC-USD"); kind != "ack" {
+		t.Errorf("subscribing to trades: %s %s %q, want an ack", kind, reply.Code, reply.Error)
+	}
+	if kind, reply := subscribe(ws.ChannelUser, ""); kind != "error" || reply.Code != ws.CodeAuthRequired {
+		t.Errorf("subscribing to user: %s %s, want an error coded %s", kind, reply.Code, ws.CodeAuthRequired)
+	}
+}
+
+// Whose orders a caller may act on: a session's own user's, anyone's for an
+// admin, and the user an anonymous caller names only in dev mode. A key's
+// named user is never trusted.
+func TestOrderOwner(t *testing.T) {
+	tradeKey := &APIKey{Name: "bot", Secret: "bot-secret", Scopes: []Scope{ScopeTrade}}
+	adminKey := &APIKey{Name: "ops", Secret: "ops-secret", Scopes: []Scope{ScopeAdmin}}
+	tests := []struct {
+		name    string
+		devMode bool
+		user    string
+		key     *APIKey
+		claimed string
+		want    string
+		status  int
+	}{
+		{name: "session", user: "user-1", claimed: "user-2", want: "user-1", status: http.StatusOK},
+		{name: "admin key", key: adminKey, claimed: "user-2", want: "", status: http.StatusOK},
+		{name: "trade key", key: tradeKey, claimed: "user-2", status: http.StatusForbidden},
+		{name: "trade key in dev mode", devMode: true, key: tradeKey, claimed: "user-2", status: http.StatusForbidden},
+		{name: "anonymous", claimed: "user-2", status: http.StatusForbidden},
+		{name: "anonymous in dev mode", devMode: true, claimed: "user-2", want: "user-2", status: http.StatusOK},
+		{name: "anonymous in dev mode unnamed", devMode: true, status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		auth := NewAuth(nil, ScopeTrade, 0)
+		auth.SetDevMode(test.devMode)
+		h := &Handler{auth: auth}
+
+		request := httptest.NewRequest(http.MethodDelete, "/api/v1/orders/order-1", nil)
+		ctx := request.Context()
+		if test.user != "" {
+			ctx = context.WithValue(ctx, userContextKey{}, test.user)
+		}
+		if test.key != nil {
+			ctx = context.WithValue(ctx, apiKeyContextKey{}, test.key)
+		}
+		recorder := httptest.NewRecorder()
+		got, ok := h.orderOwner(recorder, request.WithContext(ctx), test.claimed)
+		if ok != (test.status == http.StatusOK) || recorder.Code != test.status || got != test.want {
+			t.Errorf("%s: %q, %v with status %d, want %q with status %d", test.name, got, ok, recorder.Code, test.want, test.status)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/domain"
+	ws "github.com/hft-exchange/backend/internal/websocket"
+)
+
+// streamChannels are the hub events the market data stream carries
+var streamChannels = []string{"ticker", "trade", "orderbook"}
+
+// streamHeartbeat is how often an idle stream sends a comment so proxies
+// don't close it
+const streamHeartbeat = 15 * time.Second
+
+// streamFilter selects the events one stream wants. Empty sets match
+// everything.
+type streamFilter struct {
+	channels map[string]bool
+	symbols  map[string]bool
+}
+
+func (f *streamFilter) wants(event *ws.Event) bool {
+	channel := event.Type
+	if channel == "orderbook_diff" {
+		channel = "orderbook"
+	}
+	if !f.channels[channel] {
+		return false
+	}
+	return len(f.symbols) == 0 || f.symbols[event.Symbol]
+}
+
+// streamMarketData serves the hub's ticker, trade and order book events as
+// Server-Sent Events, for clients that can't open a WebSocket. Each event's
+// id is its hub sequence, so a reconnect with Last-Event-ID picks up the
+// events it missed while they are still kept. Order books are sent as a
+// snapshot, without an id, on every connect and then as diffs.
+func (h *Handler) streamMarketData(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, after, err := h.parseStream(r)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		// The server's write timeout would otherwise cut the stream off
+		controller := http.NewResponseController(w)
+		if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+			log.Printf("Failed to lift write deadline for stream: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.Header().Set("X-Response-Time-Ms", strconv.FormatInt(domain.Now().UnixMilli(), 10))
+		w.WriteHeader(http.StatusOK)
+
+		subscriber, missed := hub.Subscribe(after)
+		defer hub.Unsubscribe(subscriber)
+
+		legacy := wantsLegacyNumbers(r)
+		write := func(event *ws.Event) error {
+			if !filter.wants(event) {
+				return nil
+			}
+			payload := event.Payload
+			if legacy {
+				if rewritten, err := domain.LegacyNumbers(payload); err == nil {
+					payload = rewritten
+				}
+			}
+			_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, payload)
+			return err
+		}
+
+		if filter.channels["orderbook"] {
+			if h.writeBookSnapshots(w, hub, filter, legacy) != nil {
+				return
+			}
+		}
+		for _, event := range missed {
+			if write(event) != nil {
+				return
+			}
+		}
+		if controller.Flush() != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-subscriber.Events():
+				if !ok {
+					// Dropped for falling behind; the client reconnects and
+					// resumes from its last event
+					return
+				}
+				if write(event) != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			}
+			if controller.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeBookSnapshots sends the books of the symbols a stream wants, which
+// its orderbook_diff events apply to
+func (h *Handler) writeBookSnapshots(w http.ResponseWriter, hub *ws.Hub, filter *streamFilter, legacy bool) error {
+	symbols := h.exchange.GetAllSymbols()
+	if len(filter.symbols) > 0 {
+		symbols = make([]string, 0, len(filter.symbols))
+		for symbol := range filter.symbols {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+	}
+	for _, symbol := range symbols {
+		snapshot, err := hub.Snapshot(ws.ChannelOrderBook, symbol)
+		if err != nil || snapshot == nil {
+			continue
+		}
+		if legacy {
+			if rewritten, err := domain.LegacyNumbers(snapshot); err == nil {
+				snapshot = rewritten
+			}
+		}
+		if _, err := fmt.Fprintf(w, "event: orderbook\ndata: %s\n\n", snapshot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseStream reads a stream's ?channels= and ?symbols= filters and the
+// sequence to resume after, from Last-Event-ID or ?last_event_id=
+func (h *Handler) parseStream(r *http.Request) (*streamFilter, uint64, error) {
+	filter := &streamFilter{channels: make(map[string]bool), symbols: make(map[string]bool)}
+	query := r.URL.Query()
+
+	for _, channel := range splitList(query.Get("channels")) {
+		if !slices.Contains(streamChannels, channel) {
+			return nil, 0, apierror.New(apierror.InvalidRequest, "channels must be some of %v", streamChannels)
+		}
+		filter.channels[channel] = true
+	}
+	if len(filter.channels) == 0 {
+		for _, channel := range streamChannels {
+			filter.channels[channel] = true
+		}
+	}
+
+	for _, symbol := range splitList(query.Get("symbols")) {
+		symbol = strings.ToUpper(symbol)
+		if !h.isListed(symbol) {
+			return nil, 0, apierror.New(apierror.UnknownSymbol, "unknown symbol: %s", symbol)
+		}
+		filter.symbols[symbol] = true
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = query.Get("last_event_id")
+	}
+	var after uint64
+	if lastID != "" {
+		parsed, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			return nil, 0, apierror.New(apierror.InvalidRequest, "Last-Event-ID must be an event id from this stream")
+		}
+		after = parsed
+	}
+	return filter, after, nil
+}
+
+// splitList splits a comma-separated parameter, skipping empty items
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// ServerTime is the server's clock, for signing requests and measuring
+// latency
+type ServerTime struct {
+	ServerTime int64  `json:"server_time"` // epoch milliseconds
+	ISO        string `json:"iso"`
+}
+
+func serverTimeAt(now time.Time) ServerTime {
+	return ServerTime{ServerTime: now.UnixMilli(), ISO: now.UTC().Format(time.RFC3339Nano)}
+}
+
+// GetServerTime returns the server's current time
+func (h *Handler) GetServerTime(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: serverTimeAt(domain.Now())})
+}
+
+// responseTime stamps every API response with the server's time in epoch
+// milliseconds as it is written, in X-Response-Time-Ms
+func responseTime(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&stampedResponse{ResponseWriter: w}, r)
+	})
+}
+
+// stampedResponse sets X-Response-Time-Ms just before the headers go out
+type stampedResponse struct {
+	http.ResponseWriter
+	stamped bool
+}
+
+func (s *stampedResponse) WriteHeader(status int) {
+	s.stamp()
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *stampedResponse) Write(data []byte) (int, error) {
+	s.stamp()
+	return s.ResponseWriter.Write(data)
+}
+
+func (s *stampedResponse) Flush() {
+	s.stamp()
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *stampedResponse) stamp() {
+	if !s.stamped {
+		s.stamped = true
+		s.Header().Set("X-Response-Time-Ms", strconv.FormatInt(domain.Now().UnixMilli(), 10))
+	}
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+// SetUsers enables the user management admin endpoints
+func (h *Handler) SetUsers(users *repository.UserRepository) {
+	h.users = users
+}
+
+// AdminUser is a user as admins see it, with what they hold and how many
+// orders they have open
+type AdminUser struct {
+	*domain.User
+	Balances   []*repository.Balance   `json:"balances"`
+	OpenOrders engine.OpenOrderSummary `json:"open_orders"`
+}
+
+// DisableUserRequest says why a user is disabled and whether their resting
+// orders go too
+type DisableUserRequest struct {
+	Reason       string `json:"reason"`
+	CancelOrders bool   `json:"cancel_orders,omitempty"`
+}
+
+// DisabledUser is a user just disabled and how many of their orders were
+// cancelled with it
+type DisabledUser struct {
+	AdminUser
+	CancelledOrders int `json:"cancelled_orders"`
+}
+
+// GetUsers lists users in ID order with their balances and open orders
+func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	if h.users == nil {
+		respondError(w, apierror.New(apierror.NotFound, "user management is not enabled"))
+		return
+	}
+	query, err := adminUsersResource.Parse(r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	filter := repository.UserFilter{Kind: query.Filters["kind"], After: query.Cursor}
+	if status := query.Filters["status"]; status != "" {
+		disabled := status == "disabled"
+		filter.Disabled = &disabled
+	}
+	users, err := h.users.ListUsers(r.Context(), query.Limit+1, filter)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	n, page := paginate(query, len(users), func(i int) *repository.Cursor {
+		return repository.NewCursor(users[i].CreatedAt, users[i].ID)
+	})
+	summaries, err := h.summarizeUsers(r.Context(), users[:n])
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: summaries, Pagination: page})
+}
+
+// GetUser returns one user with their balances and open orders
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	if h.users == nil {
+		respondError(w, apierror.New(apierror.NotFound, "user management is not enabled"))
+		return
+	}
+	summary, err := h.summarizeUser(r.Context(), mux.Vars(r)["userId"])
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: summary})
+}
+
+// DisableUser stops a user placing orders, optionally cancelling their
+// resting ones. The user stays disabled across restarts until enabled.
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	if h.users == nil {
+		respondError(w, apierror.New(apierror.NotFound, "user management is not enabled"))
+		return
+	}
+	var req DisableUserRequest
+	if !decodeBody(w, r, &req, h.bodyLimit) {
+		return
+	}
+	if req.Reason == "" {
+		respondError(w, apierror.New(apierror.InvalidRequest, "reason is required"))
+		return
+	}
+
+	userID := mux.Vars(r)["userId"]
+	cancelled, err := h.exchange.DisableUser(r.Context(), userID, req.Reason, req.CancelOrders)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("AUDIT: user %s disabled by %s (%s), %d orders cancelled", userID, r.RemoteAddr, req.Reason, cancelled)
+
+	summary, err := h.summarizeUser(r.Context(), userID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: DisabledUser{AdminUser: *summary, CancelledOrders: cancelled}})
+}
+
+// EnableUser lets a disabled user place orders again
+func (h *Handler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	if h.users == nil {
+		respondError(w, apierror.New(apierror.NotFound, "user management is not enabled"))
+		return
+	}
+	userID := mux.Vars(r)["userId"]
+	if err := h.exchange.EnableUser(r.Context(), userID); err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("AUDIT: user %s enabled by %s", userID, r.RemoteAddr)
+
+	summary, err := h.summarizeUser(r.Context(), userID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: summary})
+}
+
+func (h *Handler) summarizeUser(ctx context.Context, userID string) (*AdminUser, error) {
+	user, err := h.users.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := h.summarizeUsers(ctx, []*domain.User{user})
+	if err != nil {
+		return nil, err
+	}
+	return &summaries[0], nil
+}
+
+// summarizeUsers adds balances, read in one query, and open order counts
+// from the engine's index
+func (h *Handler) summarizeUsers(ctx context.Context, users []*domain.User) ([]AdminUser, error) {
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	balances, err := h.balanceRepo.GetBalancesForUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]AdminUser, len(users))
+	for i, user := range users {
+		summaries[i] = AdminUser{
+			User:       user,
+			Balances:   balances[user.ID],
+			OpenOrders: h.exchange.OpenOrderSummary(user.ID),
+		}
+		if summaries[i].Balances == nil {
+			summaries[i].Balances = []*repository.Balance{}
+		}
+	}
+	return summaries, nil
+}
+
+// VerifyUser marks a user verified, which exempts their orders from the
+// stale order sweeper from its next run
+func (h *Handler) VerifyUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserVerified(w, r, true)
+}
+
+// UnverifyUser clears a user's verification
+func (h *Handler) UnverifyUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserVerified(w, r, false)
+}
+
+func (h *Handler) setUserVerified(w http.ResponseWriter, r *http.Request, verified bool) {
+	if h.users == nil {
+		respondError(w, apierror.New(apierror.NotFound, "user management is not enabled"))
+		return
+	}
+	userID := mux.Vars(r)["userId"]
+	if err := h.users.SetUserVerified(r.Context(), userID, verified, domain.Now()); err != nil {
+		respondError(w, err)
+		return
+	}
+	if verified {
+		log.Printf("AUDIT: user %s verified by %s", userID, r.RemoteAddr)
+	} else {
+		log.Printf("AUDIT: user %s unverified by %s", userID, r.RemoteAddr)
+	}
+
+	summary, err := h.summarizeUser(r.Context(), userID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Response{Success: true, Data: summary})
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// Field error codes
+const (
+	CodeRequired      = "required"
+	CodeInvalidValue  = "invalid_value"
+	CodeNotPositive   = "not_positive"
+	CodeNotAllowed    = "not_allowed"
+	CodeUnknownSymbol = "unknown_symbol"
+)
+
+// FieldError is one problem with one field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+var orderTypes = []string{
+	string(domain.OrderTypeLimit),
+	string(domain.OrderTypeMarket),
+	string(domain.OrderTypeStopLimit),
+}
+
+// Validate normalizes the side and type to their upper case constants and
+// checks the request is a well-formed order on a listed symbol. It returns
+// every problem found rather than stopping at the first. The symbol's
+// trading rules (tick and lot size, minimum notional) are left to the
+// engine.
+func (req *PlaceOrderRequest) Validate(listed func(symbol string) bool) []FieldError {
+	var errs []FieldError
+	fail := func(field, code, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if req.UserID == "" {
+		fail("user_id", CodeRequired, "user_id is required")
+	}
+
+	switch {
+	case req.Symbol == "":
+		fail("symbol", CodeRequired, "symbol is required")
+	case !listed(req.Symbol):
+		fail("symbol", CodeUnknownSymbol, "%s is not a listed symbol", req.Symbol)
+	}
+
+	req.Side = strings.ToUpper(req.Side)
+	switch domain.OrderSide(req.Side) {
+	case domain.OrderSideBuy, domain.OrderSideSell:
+	case "":
+		fail("side", CodeRequired, "side is required")
+	default:
+		fail("side", CodeInvalidValue, "side must be one of %v", orderSides)
+	}
+
+	req.Type = strings.ToUpper(req.Type)
+	orderType := domain.OrderType(req.Type)
+	switch orderType {
+	case domain.OrderTypeLimit, domain.OrderTypeMarket, domain.OrderTypeStopLimit:
+	case "":
+		fail("type", CodeRequired, "type is required")
+	default:
+		fail("type", CodeInvalidValue, "type must be one of %v", orderTypes)
+	}
+
+	if req.Quantity <= 0 {
+		fail("quantity", CodeNotPositive, "quantity must be greater than 0")
+	}
+
+	switch orderType {
+	case domain.OrderTypeLimit, domain.OrderTypeStopLimit:
+		if req.Price <= 0 {
+			fail("price", CodeNotPositive, "price must be greater than 0 for %s orders", orderType)
+		}
+	case domain.OrderTypeMarket:
+		if req.Price != 0 {
+			fail("price", CodeNotAllowed, "price must be omitted for MARKET orders")
+		}
+	}
+
+	if orderType == domain.OrderTypeStopLimit {
+		if req.StopPrice <= 0 {
+			fail("stop_price", CodeNotPositive, "stop_price must be greater than 0 for STOP_LIMIT orders")
+		}
+	} else if req.StopPrice != 0 && (orderType == domain.OrderTypeLimit || orderType == domain.OrderTypeMarket) {
+		fail("stop_price", CodeNotAllowed, "stop_price is only allowed on STOP_LIMIT orders")
+	}
+
+	return errs
+}
+
+// Validate checks a batch cancel names its user and between one and
+// engine.MaxCancelBatch orders, each with an ID
+func (req *CancelBatchRequest) Validate() []FieldError {
+	var errs []FieldError
+	fail := func(field, code, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if req.UserID == "" {
+		fail("user_id", CodeRequired, "user_id is required")
+	}
+	switch {
+	case len(req.Orders) == 0:
+		fail("orders", CodeRequired, "orders must name at least one order")
+	case len(req.Orders) > engine.MaxCancelBatch:
+		fail("orders", CodeInvalidValue, "orders may name at most %d orders, got %d", engine.MaxCancelBatch, len(req.Orders))
+	}
+	for i, order := range req.Orders {
+		if order.OrderID == "" {
+			fail(fmt.Sprintf("orders[%d].order_id", i), CodeRequired, "orders[%d].order_id is required", i)
+		}
+	}
+	return errs
+}
+
+// Validate checks a batch places between one and engine.MaxOrderBatch
+// orders, none of them synchronously. The orders themselves are checked one
+// by one when the batch is placed.
+func (req *PlaceOrderBatchRequest) Validate() []FieldError {
+	var errs []FieldError
+	fail := func(field, code, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case len(req.Orders) == 0:
+		fail("orders", CodeRequired, "orders must hold at least one order")
+	case len(req.Orders) > engine.MaxOrderBatch:
+		fail("orders", CodeInvalidValue, "orders may hold at most %d orders, got %d", engine.MaxOrderBatch, len(req.Orders))
+	}
+	for i, order := range req.Orders {
+		if order.Sync {
+			fail(fmt.Sprintf("orders[%d].sync", i), CodeNotAllowed, "orders[%d].sync is not supported in a batch", i)
+		}
+	}
+	return errs
+}
+
+// Validate normalizes the asset to upper case and checks a deposit or
+// withdrawal names one and a positive amount
+func (req *FundingRequest) Validate() []FieldError {
+	var errs []FieldError
+	fail := func(field, code, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	req.Asset = strings.ToUpper(req.Asset)
+	if req.Asset == "" {
+		fail("asset", CodeRequired, "asset is required")
+	}
+	if req.Amount <= 0 {
+		fail("amount", CodeNotPositive, "amount must be greater than 0")
+	}
+	return errs
+}
+
+// usernamePattern is what usernames may contain
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+// minPasswordLength is the shortest password accepted at registration
+const minPasswordLength = 8
+
+// Validate checks a registration's username, email and password
+func (req *RegisterRequest) Validate() []FieldError {
+	var errs []FieldError
+	fail := func(field, code, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case req.Username == "":
+		fail("username", CodeRequired, "username is required")
+	case !usernamePattern.MatchString(req.Username):
+		fail("username", CodeInvalidValue, "username must be 3 to 32 letters, digits, '_', '.' or '-'")
+	}
+	switch {
+	case req.Email == "":
+		fail("email", CodeRequired, "email is required")
+	case !strings.Contains(strings.TrimPrefix(req.Email, "@"), "@"):
+		fail("email", CodeInvalidValue, "email must be an e-mail address")
+	}
+	if len(req.Password) < minPasswordLength {
+		fail("password", CodeInvalidValue, "password must be at least %d characters", minPasswordLength)
+	}
+	return errs
+}
+
+// respondInvalid rejects a request body that failed validation with 422 and
+// the list of field errors
+func respondInvalid(w http.ResponseWriter, errs []FieldError) {
+	respondErrorData(w, invalid(errs), errs)
+}
+
+// invalid is the error for a request body with field errors errs
+func invalid(errs []FieldError) *apierror.Error {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Message
+	}
+	return &apierror.Error{
+		Code:    apierror.InvalidRequest,
+		Status:  http.StatusUnprocessableEntity,
+		Message: fmt.Sprintf("%s: %s", ErrValidation, strings.Join(messages, "; ")),
+	}
+}
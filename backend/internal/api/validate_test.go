@@ -0,0 +1,133 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/api"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/wstest"
+)
+
+// startServer runs an exchange serving the API for the test, with one user
+// holding the starter balances
+func startServer(t *testing.T) (server *wstest.Server, userID string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	server, err := wstest.Start()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	userID, _, err = server.User(ctx, "trader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, userID
+}
+
+// post sends body to path and decodes the response envelope
+func post(t *testing.T, server *wstest.Server, path, body string) (int, api.Response, json.RawMessage) {
+	t.Helper()
+	response, err := http.Post(server.BaseURL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var envelope struct {
+		api.Response
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&envelope); err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, envelope.Response, envelope.Data
+}
+
+// Malformed orders are refused with 422 and every field at fault, and none
+// reaches the book
+func TestPlaceOrderRejectsMalformedOrders(t *testing.T) {
+	server, userID := startServer(t)
+
+	tests := []struct {
+		name string
+		// body has USER for the user's ID
+		body string
+		want []string // field/code
+	}{
+		{"unknown type", `{"user_id":"USER","symbol":"BTC-USD","side":"BUY","type":"banana","quantity":1,"price":45000}`, []string{"type/invalid_value"}},
+		{"unknown side", `{"user_id":"USER","symbol":"BTC-USD","side":"hold","type":"LIMIT","quantity":1,"price":45000}`, []string{"side/invalid_value"}},
+		{"negative quantity", `{"user_id":"USER","symbol":"BTC-USD","side":"BUY","type":"LIMIT","quantity":-5,"price":45000}`, []string{"quantity/not_positive"}},
+		{"zero quantity", `{"user_id":"USER","symbol":"BTC-USD","side":"SELL","type":"MARKET","quantity":0}`, []string{"quantity/not_positive"}},
+		{"limit without price", `{"user_id":"USER","symbol":"BTC-USD","side":"BUY","type":"LIMIT","quantity":1,"price":0}`, []string{"price/not_positive"}},
+		{"limit with negative price", `{"user_id":"USER","symbol":"BTC-USD","side":"BUY","type":"limit","quantity":1,"price":-1}`, []string{"price/not_positive"}},
+		{"market with price", `{"user_id":"USER","symbol":"BTC-USD","side":"BUY","type":"MARKET","quantity":1,"price":45000}`, []string{"price/not_allowed"}},
+		{"stop limit without stop price", `{"user_id":"USER","symbol":"BTC-USD","side":"SELL","type":"STOP_LIMIT","quantity":1,"price":44000}`, []string{"stop_price/not_positive"}},
+		{"stop limit without price", `{"user_id":"USER","symbol":"BTC-USD","side":"SELL","type":"stop_limit","quantity":1,"stop_price":44500}`, []string{"price/not_positive"}},
+		{"limit with stop price", `{"user_id":"USER","symbol":"BTC-USD","side":"BUY","type":"LIMIT","quantity":1,"price":45000,"stop_price":44000}`, []string{"stop_price/not_allowed"}},
+		{"unlisted symbol", `{"user_id":"USER","symbol":"DOGE-USD","side":"BUY","type":"LIMIT","quantity":1,"price":1}`, []string{"symbol/unknown_symbol"}},
+		{"no symbol", `{"user_id":"USER","side":"BUY","type":"LIMIT","quantity":1,"price":45000}`, []string{"symbol/required"}},
+		{"no side", `{"user_id":"USER","symbol":"BTC-USD","type":"LIMIT","quantity":1,"price":45000}`, []string{"side/required"}},
+		{"no type", `{"user_id":"USER","symbol":"BTC-USD","side":"BUY","quantity":1,"price":45000}`, []string{"type/required"}},
+		{"no user", `{"symbol":"BTC-USD","side":"BUY","type":"LIMIT","quantity":1,"price":45000}`, []string{"user_id/required"}},
+		{"everything wrong", `{"user_id":"USER","symbol":"","side":"up","type":"MARKET","quantity":-1,"price":5,"stop_price":4}`,
+			[]string{"symbol/required", "side/invalid_value", "quantity/not_positive", "price/not_allowed", "stop_price/not_allowed"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, response, data := post(t, server, "/api/v1/orders", strings.ReplaceAll(test.body, "USER", userID))
+			if status != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want 422: %+v", status, response)
+			}
+			var fields []api.FieldError
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatalf("data isn't a list of field errors: %s", data)
+			}
+			got := make([]string, len(fields))
+			for i, field := range fields {
+				got[i] = field.Field + "/" + field.Code
+				if field.Message == "" {
+					t.Errorf("%s has no message", got[i])
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("field errors = %v, want %v", got, test.want)
+			}
+			if response.Success || response.ErrorCode != "invalid_request" {
+				t.Errorf("response = %+v, want a failure coded invalid_request", response)
+			}
+		})
+	}
+
+	book := server.Exchange.GetOrderBook("BTC-USD", 10)
+	if len(book.Bids)+len(book.Asks) != 0 {
+		t.Errorf("refused orders reached the book: %+v", book)
+	}
+}
+
+// Side and type are matched case-insensitively and stored in upper case
+func TestPlaceOrderNormalizesSideAndType(t *testing.T) {
+	server, userID := startServer(t)
+
+	status, response, data := post(t, server, "/api/v1/orders?include_account=false",
+		`{"user_id":"`+userID+`","symbol":"BTC-USD","side":"buy","type":"Limit","quantity":0.1,"price":44000}`)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %+v", status, response)
+	}
+	var order struct {
+		Side domain.OrderSide `json:"side"`
+		Type domain.OrderType `json:"type"`
+	}
+	if err := json.Unmarshal(data, &order); err != nil {
+		t.Fatal(err)
+	}
+	if order.Side != domain.OrderSideBuy || order.Type != domain.OrderTypeLimit {
+		t.Errorf("order placed as %s %s, want BUY LIMIT", order.Side, order.Type)
+	}
+}
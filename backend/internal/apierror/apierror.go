@@ -0,0 +1,134 @@
+// Package apierror classifies errors into the codes and HTTP statuses the
+// API reports, so clients can tell what went wrong without parsing messages.
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hft-exchange/backend/internal/accounts"
+	"github.com/hft-exchange/backend/internal/candles"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/notify"
+	"github.com/hft-exchange/backend/internal/orderfeed"
+	"github.com/hft-exchange/backend/internal/replication"
+	"github.com/hft-exchange/backend/internal/repository"
+	"github.com/hft-exchange/backend/internal/subsystem"
+)
+
+// Code is a machine-readable error class
+type Code string
+
+const (
+	InvalidRequest      Code = "invalid_request"
+	Unauthorized        Code = "unauthorized"
+	Forbidden           Code = "forbidden"
+	NotFound            Code = "not_found"
+	UnknownSymbol       Code = "unknown_symbol"
+	OrderNotFound       Code = "order_not_found"
+	InsufficientBalance Code = "insufficient_balance"
+	RiskLimit           Code = "risk_limit"
+	Conflict            Code = "conflict"
+	RateLimited         Code = "rate_limited"
+	Unavailable         Code = "unavailable"
+	Internal            Code = "internal"
+)
+
+// statuses is the HTTP status each code is reported with
+var statuses = map[Code]int{
+	InvalidRequest:      http.StatusBadRequest,
+	Unauthorized:        http.StatusUnauthorized,
+	Forbidden:           http.StatusForbidden,
+	NotFound:            http.StatusNotFound,
+	UnknownSymbol:       http.StatusBadRequest,
+	OrderNotFound:       http.StatusNotFound,
+	InsufficientBalance: http.StatusBadRequest,
+	RiskLimit:           http.StatusUnprocessableEntity,
+	Conflict:            http.StatusConflict,
+	RateLimited:         http.StatusTooManyRequests,
+	Unavailable:         http.StatusServiceUnavailable,
+	Internal:            http.StatusInternalServerError,
+}
+
+// Status is the HTTP status errors of this code are reported with
+func (c Code) Status() int {
+	return statuses[c]
+}
+
+// Codes lists every code, in the order declared
+func Codes() []Code {
+	return []Code{
+		InvalidRequest, Unauthorized, Forbidden, NotFound, UnknownSymbol, OrderNotFound,
+		InsufficientBalance, RiskLimit, Conflict, RateLimited, Unavailable, Internal,
+	}
+}
+
+// known maps the errors other packages return to codes. The first match
+// wins, and errors matching none are internal.
+var known = []struct {
+	err  error
+	code Code
+}{
+	{engine.ErrUnknownSymbol, UnknownSymbol},
+	{engine.ErrOrderNotFound, OrderNotFound},
+	{engine.ErrNotOwner, Forbidden},
+	{engine.ErrUserDisabled, Forbidden},
+	{repository.ErrUserNotFound, NotFound},
+	{accounts.ErrInvalidCredentials, Unauthorized},
+	{accounts.ErrInvalidToken, Unauthorized},
+	{repository.ErrUserExists, Conflict},
+	{engine.ErrInsufficientBalance, InsufficientBalance},
+	{repository.ErrInsufficientBalance, InsufficientBalance},
+	{engine.ErrRiskLimit, RiskLimit},
+	{engine.ErrWithdrawalLimit, RiskLimit},
+	{engine.ErrInvalidOrder, InvalidRequest},
+	{engine.ErrNoReferencePrice, InvalidRequest},
+	{engine.ErrInvalidRiskProfile, InvalidRequest},
+	{engine.ErrInvalidTransfer, InvalidRequest},
+	{domain.ErrInvalidSymbolConfig, InvalidRequest},
+	{domain.ErrInvalidStep, InvalidRequest},
+	{notify.ErrInvalidSettings, InvalidRequest},
+	{repository.ErrInvalidCursor, InvalidRequest},
+	{candles.ErrInvalidRange, InvalidRequest},
+	{candles.ErrInvalidInterval, InvalidRequest},
+	{subsystem.ErrUnknownSubsystem, NotFound},
+	{replication.ErrAlreadyPrimary, Conflict},
+	{orderfeed.ErrTooManyWaiters, RateLimited},
+	{engine.ErrStandby, Unavailable},
+	{engine.ErrFenced, Unavailable},
+	{engine.ErrExchangeStarting, Unavailable},
+	{engine.ErrExchangeStopping, Unavailable},
+	{engine.ErrTradingPaused, Unavailable},
+}
+
+// Error is an error as reported to API clients
+type Error struct {
+	Code    Code
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// New returns an error of the given code, reported with the code's status
+func New(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Status: statuses[code], Message: fmt.Sprintf(format, args...)}
+}
+
+// From classifies err. Errors that are already an *Error are returned as
+// they are. Errors matching nothing in the taxonomy are internal, and their
+// text, which may carry SQL or driver details, is replaced.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	for _, k := range known {
+		if errors.Is(err, k.err) {
+			return &Error{Code: k.code, Status: statuses[k.code], Message: err.Error()}
+		}
+	}
+	return &Error{Code: Internal, Status: statuses[Internal], Message: "internal error"}
+}
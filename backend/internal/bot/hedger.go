@@ -0,0 +1,271 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hft-exchange/backend/internal/clock"
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// Hedge is a simulated trade against the reference venue. Nothing is sent
+// anywhere; it only moves the bot's tracked exposure.
+type Hedge struct {
+	ID             string  `json:"id"`
+	Bot            string  `json:"bot"`
+	Symbol         string  `json:"symbol"`
+	Side           string  `json:"side"`
+	Quantity       float64 `json:"quantity"`
+	ReferencePrice float64 `json:"reference_price"`
+	Price          float64 `json:"price"`
+	// Slippage is what executing at Price rather than ReferencePrice cost
+	Slippage   float64   `json:"slippage"`
+	ExecutedAt time.Time `json:"executed_at"`
+}
+
+// HedgeStore keeps the hedge ledger
+type HedgeStore interface {
+	SaveHedge(ctx context.Context, hedge *Hedge) error
+}
+
+// PnLBreakdown splits profit and loss, in quote currency, by where it came
+// from. SpreadCapture, Inventory and HedgeSlippage always add up to Total.
+type PnLBreakdown struct {
+	Total float64 `json:"total"`
+	// SpreadCapture is each fill's edge over the reference price at the time
+	SpreadCapture float64 `json:"spread_capture"`
+	// Inventory is the mark-to-market of the position held as the reference
+	// price moved
+	Inventory float64 `json:"inventory"`
+	// HedgeSlippage is what hedges cost against the reference price
+	HedgeSlippage float64 `json:"hedge_slippage"`
+}
+
+// SymbolPnL is a bot's exposure and PnL in one symbol
+type SymbolPnL struct {
+	Symbol string `json:"symbol"`
+	PnLBreakdown
+	// Position is the net base quantity from fills and hedges
+	Position       float64 `json:"position"`
+	ReferencePrice float64 `json:"reference_price"`
+	Fills          int     `json:"fills"`
+	Hedges         int     `json:"hedges"`
+	HedgedQuantity float64 `json:"hedged_quantity"`
+}
+
+// PnLReport is a bot's PnL since the server started
+type PnLReport struct {
+	Bot string `json:"bot"`
+	PnLBreakdown
+	// HedgeThreshold is the position notional that triggers a hedge; 0 means
+	// hedging is off
+	HedgeThreshold float64     `json:"hedge_threshold"`
+	Since          time.Time   `json:"since"`
+	Symbols        []SymbolPnL `json:"symbols"`
+}
+
+// inventory is a bot's running state in one symbol
+type inventory struct {
+	position  float64
+	cash      float64 // quote received minus paid, from fills and hedges
+	reference float64
+	breakdown PnLBreakdown
+	fills     int
+	hedges    int
+	hedgedQty float64
+}
+
+// Hedger tracks a bot's net inventory from its fills and marks it to the
+// reference price. Once a symbol's position is worth more than the threshold
+// it is hedged flat in paper mode: a hedge is recorded at the reference price
+// less slippage, and no order is sent.
+type Hedger struct {
+	name        string
+	userID      string
+	store       HedgeStore
+	clock       clock.Clock
+	threshold   float64 // position notional that triggers a hedge; 0 disables hedging
+	slippageBps float64
+	since       time.Time
+
+	mu      sync.Mutex
+	symbols map[string]*inventory
+}
+
+func NewHedger(name, userID string, store HedgeStore) *Hedger {
+	return &Hedger{
+		name:    name,
+		userID:  userID,
+		store:   store,
+		clock:   clock.Real{},
+		since:   time.Now(),
+		symbols: make(map[string]*inventory),
+	}
+}
+
+// SetClock replaces the wall clock used to time hedges. It must be called
+// before any trade or price is recorded.
+func (h *Hedger) SetClock(c clock.Clock) {
+	h.clock = c
+	h.since = c.Now()
+}
+
+// SetHedging hedges a symbol flat once its position is worth more than
+// threshold at the reference price, executing slippageBps worse than it. A
+// zero threshold leaves hedging off and only tracks PnL.
+func (h *Hedger) SetHedging(threshold, slippageBps float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.threshold = threshold
+	h.slippageBps = slippageBps
+}
+
+func (h *Hedger) inventory(symbol string) *inventory {
+	inv, ok := h.symbols[symbol]
+	if !ok {
+		inv = &inventory{}
+		h.symbols[symbol] = inv
+	}
+	return inv
+}
+
+// RecordTrade folds the bot's side of a trade into its inventory. Trades the
+// bot isn't in, or is on both sides of, change nothing.
+func (h *Hedger) RecordTrade(trade *domain.Trade) {
+	var side float64
+	switch {
+	case trade.BuyerID == trade.SellerID:
+		return
+	case trade.BuyerID == h.userID:
+		side = 1
+	case trade.SellerID == h.userID:
+		side = -1
+	default:
+		return
+	}
+
+	h.mu.Lock()
+	inv := h.inventory(trade.Symbol)
+	if inv.reference == 0 {
+		inv.reference = trade.Price
+	}
+	inv.position += side * trade.Quantity
+	inv.cash -= side * trade.Quantity * trade.Price
+	inv.breakdown.SpreadCapture += side * trade.Quantity * (inv.reference - trade.Price)
+	inv.fills++
+	hedge := h.maybeHedge(trade.Symbol, inv)
+	h.mu.Unlock()
+
+	h.save(hedge)
+}
+
+// UpdateReferencePrice marks a symbol's position to a new reference price,
+// hedging it if it has grown past the threshold. Its signature matches the
+// price feed's update handlers.
+func (h *Hedger) UpdateReferencePrice(symbol string, price float64) {
+	if price <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	inv := h.inventory(symbol)
+	if inv.reference > 0 {
+		inv.breakdown.Inventory += inv.position * (price - inv.reference)
+	}
+	inv.reference = price
+	hedge := h.maybeHedge(symbol, inv)
+	h.mu.Unlock()
+
+	h.save(hedge)
+}
+
+// maybeHedge flattens inv if its position is over the threshold. It must be
+// called with h.mu held.
+func (h *Hedger) maybeHedge(symbol string, inv *inventory) *Hedge {
+	if h.threshold <= 0 || math.Abs(inv.position)*inv.reference <= h.threshold {
+		return nil
+	}
+
+	// Selling a long position, or buying back a short one, at a worse price
+	quantity := -inv.position
+	side := domain.OrderSideBuy
+	price := inv.reference * (1 + h.slippageBps/10000)
+	if quantity < 0 {
+		side = domain.OrderSideSell
+		price = inv.reference * (1 - h.slippageBps/10000)
+	}
+	slippage := quantity * (inv.reference - price)
+
+	inv.position = 0
+	inv.cash -= quantity * price
+	inv.breakdown.HedgeSlippage += slippage
+	inv.hedges++
+	inv.hedgedQty += math.Abs(quantity)
+
+	return &Hedge{
+		ID:             uuid.New().String(),
+		Bot:            h.name,
+		Symbol:         symbol,
+		Side:           string(side),
+		Quantity:       math.Abs(quantity),
+		ReferencePrice: inv.reference,
+		Price:          price,
+		Slippage:       slippage,
+		ExecutedAt:     h.clock.Now(),
+	}
+}
+
+func (h *Hedger) save(hedge *Hedge) {
+	if hedge == nil {
+		return
+	}
+	log.Printf("🛡️ %s hedged %s %v %s at %v (reference %v)",
+		h.name, hedge.Side, hedge.Quantity, hedge.Symbol, hedge.Price, hedge.ReferencePrice)
+	if h.store == nil {
+		return
+	}
+	if err := h.store.SaveHedge(context.Background(), hedge); err != nil {
+		log.Printf("Failed to record hedge %s: %v", hedge.ID, err)
+	}
+}
+
+// PnL reports the bot's PnL since the server started, per symbol and in
+// total
+func (h *Hedger) PnL() *PnLReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	report := &PnLReport{
+		Bot:            h.name,
+		HedgeThreshold: h.threshold,
+		Since:          h.since,
+		Symbols:        make([]SymbolPnL, 0, len(h.symbols)),
+	}
+	for symbol, inv := range h.symbols {
+		if inv.fills == 0 && inv.hedges == 0 {
+			continue
+		}
+		breakdown := inv.breakdown
+		breakdown.Total = inv.cash + inv.position*inv.reference
+		report.Symbols = append(report.Symbols, SymbolPnL{
+			Symbol:         symbol,
+			PnLBreakdown:   breakdown,
+			Position:       inv.position,
+			ReferencePrice: inv.reference,
+			Fills:          inv.fills,
+			Hedges:         inv.hedges,
+			HedgedQuantity: inv.hedgedQty,
+		})
+		report.Total += breakdown.Total
+		report.SpreadCapture += breakdown.SpreadCapture
+		report.Inventory += breakdown.Inventory
+		report.HedgeSlippage += breakdown.HedgeSlippage
+	}
+	sort.Slice(report.Symbols, func(i, j int) bool { return report.Symbols[i].Symbol < report.Symbols[j].Symbol })
+	return report
+}
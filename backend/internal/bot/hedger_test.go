@@ -0,0 +1,113 @@
+package bot_test
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/bot"
+	"github.com/hft-exchange/backend/internal/clock"
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// hedgeLedger keeps recorded hedges in memory
+type hedgeLedger struct {
+	mu     sync.Mutex
+	hedges []*bot.Hedge
+}
+
+func (l *hedgeLedger) SaveHedge(_ context.Context, hedge *bot.Hedge) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hedges = append(l.hedges, hedge)
+	return nil
+}
+
+func (l *hedgeLedger) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.hedges)
+}
+
+func (l *hedgeLedger) last() *bot.Hedge {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.hedges[len(l.hedges)-1]
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// As the price trends up and buyers keep lifting the bot's ask, its short
+// grows until it is worth more than the threshold, and is hedged flat at
+// exactly that point. Throughout, spread capture, inventory and hedge
+// slippage add up to the PnL of the fills and hedges actually made.
+func TestHedgeAtThresholdAndPnLDecomposition(t *testing.T) {
+	const (
+		threshold   = 10000
+		slippageBps = 5
+		lot         = 0.05
+		halfSpread  = 10
+	)
+	ledger := &hedgeLedger{}
+	hedger := bot.NewHedger("market_maker", "maker", ledger)
+	hedger.SetClock(clock.NewVirtual(time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)))
+	hedger.SetHedging(threshold, slippageBps)
+
+	// The test's own books: what the fills and hedges paid and left open
+	var position, cash float64
+	for tick := 0; tick < 40; tick++ {
+		reference := 45000 + 20*float64(tick)
+		hedger.UpdateReferencePrice("BTC-USD", reference)
+
+		price := reference + halfSpread
+		hedges := ledger.count()
+		hedger.RecordTrade(domain.NewTrade("BTC-USD", domain.NewID(), domain.NewID(), "taker", "maker", price, lot, domain.NewID(), domain.NewID()))
+		position -= lot
+		cash += lot * price
+
+		if math.Abs(position)*reference > threshold {
+			if ledger.count() != hedges+1 {
+				t.Fatalf("tick %d: short of %g worth %g past the %d threshold, but no hedge", tick, -position, -position*reference, threshold)
+			}
+			hedge := ledger.last()
+			wantPrice := reference * (1 + slippageBps/10000.0)
+			if hedge.Side != string(domain.OrderSideBuy) || !near(hedge.Quantity, -position) || !near(hedge.ReferencePrice, reference) || !near(hedge.Price, wantPrice) {
+				t.Fatalf("tick %d: hedge %+v, want a buy of %g at %g against %g", tick, hedge, -position, wantPrice, reference)
+			}
+			cash -= hedge.Quantity * hedge.Price
+			position = 0
+		} else if ledger.count() != hedges {
+			t.Fatalf("tick %d: hedged a short of %g worth only %g", tick, -position, -position*reference)
+		}
+
+		report := hedger.PnL()
+		if len(report.Symbols) != 1 {
+			t.Fatalf("tick %d: report covers %d symbols, want BTC-USD", tick, len(report.Symbols))
+		}
+		symbol := report.Symbols[0]
+		if !near(symbol.Position, position) {
+			t.Fatalf("tick %d: tracked position %g, want %g", tick, symbol.Position, position)
+		}
+		if want := cash + position*reference; !near(report.Total, want) {
+			t.Fatalf("tick %d: total PnL %g, want %g from the fills and hedges", tick, report.Total, want)
+		}
+		if sum := report.SpreadCapture + report.Inventory + report.HedgeSlippage; !near(sum, report.Total) {
+			t.Fatalf("tick %d: spread %g + inventory %g + slippage %g = %g, want the total %g",
+				tick, report.SpreadCapture, report.Inventory, report.HedgeSlippage, sum, report.Total)
+		}
+	}
+
+	report := hedger.PnL()
+	if ledger.count() < 2 || report.Symbols[0].Hedges != ledger.count() {
+		t.Errorf("%d hedges recorded and %d reported over the trend, want the same and at least 2", ledger.count(), report.Symbols[0].Hedges)
+	}
+	// Selling into a rally earns the spread and loses on the short and on
+	// buying it back
+	if !near(report.SpreadCapture, 40*lot*halfSpread) || report.Inventory >= 0 || report.HedgeSlippage >= 0 {
+		t.Errorf("breakdown %+v, want %g of spread capture and inventory and slippage losses", report.PnLBreakdown, 40*lot*halfSpread)
+	}
+}
@@ -4,22 +4,37 @@ import (
 	"context"
 	"log"
 	"math/rand"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/hft-exchange/backend/internal/clock"
 	"github.com/hft-exchange/backend/internal/domain"
 )
 
+// quoteInterval is how often fresh quotes are placed for each symbol
+const quoteInterval = 15 * time.Second // Slower market making for demo (was 5s)
+
 type MarketMaker struct {
 	userID         string
 	exchange       ExchangeInterface
 	priceSimulator PriceSimulator
 	ctx            context.Context
 	cancel         context.CancelFunc
+	clock          clock.Clock
+	rng            *rand.Rand
+	rngMu          sync.Mutex
+	// quoting stops each symbol's quotes; nil until the market maker starts
+	quoting        map[string]context.CancelFunc
+	started        bool
+	mu             sync.Mutex
 }
 
 type ExchangeInterface interface {
-	SubmitOrder(order *domain.Order) error
+	SubmitOrder(ctx context.Context, order *domain.Order) error
 	GetOrderBook(symbol string, depth int) *domain.OrderBook
+	SymbolConfig(symbol string) (domain.SymbolConfig, bool)
+	TradingPaused() bool
 }
 
 type PriceSimulator interface {
@@ -34,38 +49,91 @@ func NewMarketMaker(userID string, exchange ExchangeInterface, priceSimulator Pr
 		priceSimulator: priceSimulator,
 		ctx:            ctx,
 		cancel:         cancel,
+		clock:          clock.Real{},
+		rng:            rand.New(rand.NewSource(time.Now().UnixNano())),
+		quoting:        make(map[string]context.CancelFunc),
 	}
 }
 
+// SetClock replaces the wall clock driving quote placement. It must be called
+// before Start.
+func (mm *MarketMaker) SetClock(c clock.Clock) {
+	mm.clock = c
+}
+
+// SetSeed makes the generated quote sizes reproducible
+func (mm *MarketMaker) SetSeed(seed int64) {
+	mm.rngMu.Lock()
+	mm.rng = rand.New(rand.NewSource(seed))
+	mm.rngMu.Unlock()
+}
+
+// Start begins quoting every symbol added so far; symbols added later are
+// quoted right away
 func (mm *MarketMaker) Start() {
-	symbols := []string{"BTC-USD", "ETH-USD", "SOL-USD"}
-	
+	mm.mu.Lock()
+	mm.started = true
+	// Quoting starts in symbol order so simulated runs replay identically
+	symbols := make([]string, 0, len(mm.quoting))
+	for symbol := range mm.quoting {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
 	for _, symbol := range symbols {
-		go mm.makeMarket(symbol)
+		mm.startQuoting(symbol)
 	}
+	mm.mu.Unlock()
 	
 	log.Printf("Market maker started for user: %s", mm.userID)
 }
 
-func (mm *MarketMaker) makeMarket(symbol string) {
-	ticker := time.NewTicker(15 * time.Second) // Slower market making for demo (was 5s)
-	defer ticker.Stop()
-	
-	for {
-		select {
-		case <-mm.ctx.Done():
-			return
-		case <-ticker.C:
-			mm.placeOrders(symbol)
-		}
+// AddSymbol enrolls a symbol for quoting
+func (mm *MarketMaker) AddSymbol(symbol string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if _, exists := mm.quoting[symbol]; exists {
+		return
+	}
+	mm.quoting[symbol] = nil
+	if mm.started {
+		mm.startQuoting(symbol)
 	}
 }
 
-func (mm *MarketMaker) placeOrders(symbol string) {
+// RemoveSymbol stops quoting a symbol. Quotes already resting are left to
+// the exchange.
+func (mm *MarketMaker) RemoveSymbol(symbol string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if stop := mm.quoting[symbol]; stop != nil {
+		stop()
+	}
+	delete(mm.quoting, symbol)
+}
+
+// startQuoting must be called with mm.mu held
+func (mm *MarketMaker) startQuoting(symbol string) {
+	ctx, cancel := context.WithCancel(mm.ctx)
+	mm.quoting[symbol] = cancel
+	mm.clock.Every(ctx, quoteInterval, func() { mm.placeOrders(ctx, symbol) })
+}
+
+func (mm *MarketMaker) placeOrders(ctx context.Context, symbol string) {
+	// Quotes would only be rejected; resting ones stay on the book
+	if mm.exchange.TradingPaused() {
+		return
+	}
 	currentPrice := mm.priceSimulator.GetCurrentPrice(symbol)
 	if currentPrice == 0 {
 		return
 	}
+	config, ok := mm.exchange.SymbolConfig(symbol)
+	if !ok {
+		log.Printf("MM skipping unlisted symbol %s", symbol)
+		return
+	}
 	
 	// Place orders with spread around current price
 	spread := mm.getSpread(symbol)
@@ -75,7 +143,7 @@ func (mm *MarketMaker) placeOrders(symbol string) {
 		// Buy orders (below current price)
 		buyPriceOffset := spread * float64(i+1)
 		buyPrice := currentPrice * (1 - buyPriceOffset)
-		buyQuantity := mm.getRandomQuantity(symbol)
+		buyQuantity := config.RoundQuantity(mm.getRandomQuantity(symbol))
 		
 		buyOrder := domain.NewOrder(
 			mm.userID,
@@ -83,17 +151,17 @@ func (mm *MarketMaker) placeOrders(symbol string) {
 			domain.OrderSideBuy,
 			domain.OrderTypeLimit,
 			buyQuantity,
-			mm.roundPrice(buyPrice, symbol),
+			config.RoundPrice(buyPrice),
 		)
 		
-		if err := mm.exchange.SubmitOrder(buyOrder); err != nil {
+		if err := mm.exchange.SubmitOrder(ctx, buyOrder); err != nil {
 			log.Printf("MM failed to place buy order: %v", err)
 		}
 		
 		// Sell orders (above current price)
 		sellPriceOffset := spread * float64(i+1)
 		sellPrice := currentPrice * (1 + sellPriceOffset)
-		sellQuantity := mm.getRandomQuantity(symbol)
+		sellQuantity := config.RoundQuantity(mm.getRandomQuantity(symbol))
 		
 		sellOrder := domain.NewOrder(
 			mm.userID,
@@ -101,10 +169,10 @@ func (mm *MarketMaker) placeOrders(symbol string) {
 			domain.OrderSideSell,
 			domain.OrderTypeLimit,
 			sellQuantity,
-			mm.roundPrice(sellPrice, symbol),
+			config.RoundPrice(sellPrice),
 		)
 		
-		if err := mm.exchange.SubmitOrder(sellOrder); err != nil {
+		if err := mm.exchange.SubmitOrder(ctx, sellOrder); err != nil {
 			log.Printf("MM failed to place sell order: %v", err)
 		}
 	}
@@ -128,22 +196,21 @@ func (mm *MarketMaker) getRandomQuantity(symbol string) float64 {
 	if symbol == "SOL-USD" {
 		base = 0.1
 	}
-	return base * (1 + rand.Float64())
-}
-
-func (mm *MarketMaker) roundPrice(price float64, symbol string) float64 {
-	precision := 2.0
-	if symbol == "BTC-USD" || symbol == "ETH-USD" {
-		precision = 2.0
-	}
-	multiplier := 1.0
-	for i := 0; i < int(precision); i++ {
-		multiplier *= 10
-	}
-	return float64(int(price*multiplier)) / multiplier
+	mm.rngMu.Lock()
+	defer mm.rngMu.Unlock()
+	return base * (1 + mm.rng.Float64())
 }
 
+// Stop halts quoting; Start resumes it. Quotes already resting are left to
+// the exchange.
 func (mm *MarketMaker) Stop() {
+	mm.mu.Lock()
 	mm.cancel()
+	mm.ctx, mm.cancel = context.WithCancel(context.Background())
+	mm.started = false
+	for symbol := range mm.quoting {
+		mm.quoting[symbol] = nil
+	}
+	mm.mu.Unlock()
 	log.Printf("Market maker stopped for user: %s", mm.userID)
 }
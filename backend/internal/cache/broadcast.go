@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// broadcastPrefix starts the pub/sub channels WebSocket broadcasts are
+// shared on, named hft:broadcast:{channel}:{symbol}, or without the symbol
+// for channels that have none
+const broadcastPrefix = "hft:broadcast:"
+
+// BroadcastMessage is one WebSocket broadcast shared between instances.
+// Origin is the instance that published it, which has already sent it to
+// its own clients.
+type BroadcastMessage struct {
+	Origin   string          `json:"origin"`
+	Type     string          `json:"type"`
+	Symbol   string          `json:"symbol,omitempty"`
+	Interval string          `json:"interval,omitempty"`
+	UserID   string          `json:"user_id,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// PublishBroadcast shares a broadcast with every instance on channel's
+// pub/sub channel
+func (r *RedisCache) PublishBroadcast(channel string, message *BroadcastMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal broadcast: %w", err)
+	}
+	name := broadcastPrefix + channel
+	if message.Symbol != "" {
+		name += ":" + message.Symbol
+	}
+	return r.client.Publish(r.ctx, name, data).Err()
+}
+
+// SubscribeBroadcasts passes handle every broadcast published by any
+// instance, this one included, until ctx is done. The subscription is
+// re-established after Redis drops it; broadcasts published meanwhile are
+// missed.
+func (r *RedisCache) SubscribeBroadcasts(ctx context.Context, handle func(*BroadcastMessage)) error {
+	pubsub := r.client.PSubscribe(ctx, broadcastPrefix+"*")
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to broadcasts: %w", err)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case received, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var message BroadcastMessage
+			if err := json.Unmarshal([]byte(received.Payload), &message); err != nil {
+				log.Printf("Failed to unmarshal broadcast from %s: %v", received.Channel, err)
+				continue
+			}
+			handle(&message)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const idempotencyPrefix = "hft:idempotency:"
+
+// ClaimIdempotencyKey stores value under key unless the key is already held,
+// in which case it returns the value held and false
+func (r *RedisCache) ClaimIdempotencyKey(key string, value []byte, ttl time.Duration) ([]byte, bool, error) {
+	claimed, err := r.client.SetNX(r.ctx, idempotencyPrefix+key, value, ttl).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if claimed {
+		return nil, true, nil
+	}
+
+	held, err := r.client.Get(r.ctx, idempotencyPrefix+key).Bytes()
+	if err == redis.Nil {
+		// Expired between the two calls
+		return r.ClaimIdempotencyKey(key, value, ttl)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return held, false, nil
+}
+
+// SetIdempotencyKey replaces the value held under key
+func (r *RedisCache) SetIdempotencyKey(key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(r.ctx, idempotencyPrefix+key, value, ttl).Err()
+}
+
+// DeleteIdempotencyKey frees key to be claimed again
+func (r *RedisCache) DeleteIdempotencyKey(key string) error {
+	return r.client.Del(r.ctx, idempotencyPrefix+key).Err()
+}
@@ -0,0 +1,391 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// RecentTradesDepth is how many trades each symbol's cached recent list keeps
+const RecentTradesDepth = 1000
+
+// OrderBookDepth is how many levels per side the cached book holds
+const OrderBookDepth = 20
+
+func recentTradesKey(symbol string) string {
+	return "trades:recent:" + symbol
+}
+
+// recentTradesCompleteKey marks a list rebuilt from the database, which holds
+// every trade of the symbol when it is shorter than RecentTradesDepth
+func recentTradesCompleteKey(symbol string) string {
+	return "trades:recent:" + symbol + ":complete"
+}
+
+// ReplaceRecentTrades replaces a symbol's cached recent list with trades,
+// newest first, and marks it complete
+func (r *RedisCache) ReplaceRecentTrades(symbol string, trades []*domain.Trade) error {
+	values := make([]interface{}, len(trades))
+	for i, trade := range trades {
+		data, err := json.Marshal(trade)
+		if err != nil {
+			return fmt.Errorf("failed to marshal trade: %w", err)
+		}
+		values[i] = data
+	}
+
+	_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(r.ctx, recentTradesKey(symbol), recentTradesCompleteKey(symbol))
+		if len(values) > 0 {
+			pipe.RPush(r.ctx, recentTradesKey(symbol), values...)
+		}
+		pipe.Set(r.ctx, recentTradesCompleteKey(symbol), 1, 0)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replace recent trades: %w", err)
+	}
+	return nil
+}
+
+// PushRecentTrade adds a trade to the front of its symbol's cached recent
+// list, dropping the oldest past RecentTradesDepth
+func (r *RedisCache) PushRecentTrade(trade *domain.Trade) error {
+	data, err := json.Marshal(trade)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trade: %w", err)
+	}
+
+	_, err = r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(r.ctx, recentTradesKey(trade.Symbol), data)
+		pipe.LTrim(r.ctx, recentTradesKey(trade.Symbol), 0, RecentTradesDepth-1)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to push recent trade: %w", err)
+	}
+	return nil
+}
+
+// DropRecentTrades deletes a symbol's cached recent list
+func (r *RedisCache) DropRecentTrades(symbol string) error {
+	return r.client.Del(r.ctx, recentTradesKey(symbol), recentTradesCompleteKey(symbol)).Err()
+}
+
+// GetRecentTrades returns up to n of a symbol's cached trades, newest first,
+// and whether the list is complete
+func (r *RedisCache) GetRecentTrades(symbol string, n int) ([]*domain.Trade, bool, error) {
+	var values *redis.StringSliceCmd
+	var complete *redis.IntCmd
+	_, err := r.client.Pipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.LRange(r.ctx, recentTradesKey(symbol), 0, int64(n-1))
+		complete = pipe.Exists(r.ctx, recentTradesCompleteKey(symbol))
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get recent trades: %w", err)
+	}
+
+	trades := make([]*domain.Trade, 0, len(values.Val()))
+	for _, value := range values.Val() {
+		trade := &domain.Trade{}
+		if err := json.Unmarshal([]byte(value), trade); err != nil {
+			return nil, false, fmt.Errorf("failed to unmarshal recent trade: %w", err)
+		}
+		trades = append(trades, trade)
+	}
+	return trades, complete.Val() > 0, nil
+}
+
+// MarketDataSource computes market data when the cache has none
+type MarketDataSource interface {
+	OrderBook(ctx context.Context, symbol string) (*domain.OrderBook, error)
+	Ticker(ctx context.Context, symbol string) (*domain.Ticker, error)
+	RecentTrades(ctx context.Context, symbol string) ([]*domain.Trade, error)
+}
+
+// MarketDataStats counts how reads were served
+type MarketDataStats struct {
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	Suppressed uint64 `json:"stampede_suppressed"`
+	Primed     uint64 `json:"primed"`
+}
+
+// MarketData is a cache-aside reader for hot market data. Concurrent misses
+// on the same key share a single upstream computation.
+type MarketData struct {
+	cache  *RedisCache
+	source MarketDataSource
+	flight singleFlight
+
+	hits       uint64
+	misses     uint64
+	suppressed uint64
+	primed     uint64
+
+	symbolMu    sync.Mutex
+	symbolStats map[string]*symbolHits
+
+	// recentMu orders pushes to the recent trades lists with their rebuilds
+	recentMu sync.Mutex
+	// rebuilt holds the IDs each symbol's list was last rebuilt with, so a
+	// trade already in it isn't pushed twice
+	rebuilt map[string]map[string]bool
+	// broken holds symbols whose list missed a trade and must be dropped
+	// before it is pushed to again
+	broken map[string]bool
+}
+
+// symbolHits counts one symbol's cache reads
+type symbolHits struct {
+	hits   uint64
+	misses uint64
+}
+
+func NewMarketData(redisCache *RedisCache, source MarketDataSource) *MarketData {
+	return &MarketData{
+		cache:  redisCache,
+		source: source,
+		flight: singleFlight{calls: make(map[string]*flightCall)},
+
+		symbolStats: make(map[string]*symbolHits),
+		rebuilt:     make(map[string]map[string]bool),
+		broken:      make(map[string]bool),
+	}
+}
+
+// Prime computes and caches the book, ticker and recent trades of every
+// symbol so the first clients after a restart don't all miss at once
+func (m *MarketData) Prime(ctx context.Context, symbols []string) {
+	for _, symbol := range symbols {
+		if book, err := m.source.OrderBook(ctx, symbol); err == nil {
+			m.store("orderbook:"+symbol, func() error { return m.cache.CacheOrderBook(symbol, book) })
+		}
+		if ticker, err := m.source.Ticker(ctx, symbol); err == nil {
+			m.store("ticker:"+symbol, func() error { return m.cache.CacheTicker(symbol, ticker) })
+		} else {
+			log.Printf("Failed to prime ticker %s: %v", symbol, err)
+		}
+		m.rebuildRecentTrades(ctx, symbol)
+	}
+	log.Printf("Primed market data cache for %d symbols", len(symbols))
+}
+
+func (m *MarketData) store(key string, write func() error) {
+	if err := write(); err != nil {
+		log.Printf("Failed to cache %s: %v", key, err)
+		return
+	}
+	atomic.AddUint64(&m.primed, 1)
+}
+
+// OrderBook returns the cached book if it was taken within maxAge (any age
+// when maxAge is 0), and otherwise computes and caches a fresh one. cached
+// reports which of the two was returned.
+func (m *MarketData) OrderBook(ctx context.Context, symbol string, maxAge time.Duration) (book *domain.OrderBook, cached bool, err error) {
+	if book, err := m.cache.GetOrderBook(symbol); err == nil && book != nil &&
+		(maxAge <= 0 || domain.Now().Sub(book.Timestamp) <= maxAge) {
+		m.hit(symbol)
+		return book, true, nil
+	}
+	m.miss(symbol)
+
+	value, err := m.load(ctx, "orderbook:"+symbol, func(ctx context.Context) (interface{}, error) {
+		book, err := m.source.OrderBook(ctx, symbol)
+		if err == nil {
+			m.cache.CacheOrderBook(symbol, book)
+		}
+		return book, err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return value.(*domain.OrderBook), false, nil
+}
+
+func (m *MarketData) Ticker(ctx context.Context, symbol string) (*domain.Ticker, error) {
+	if ticker, err := m.cache.GetTicker(symbol); err == nil && ticker != nil {
+		m.hit(symbol)
+		return ticker, nil
+	}
+	m.miss(symbol)
+
+	value, err := m.load(ctx, "ticker:"+symbol, func(ctx context.Context) (interface{}, error) {
+		ticker, err := m.source.Ticker(ctx, symbol)
+		if err == nil {
+			m.cache.CacheTicker(symbol, ticker)
+		}
+		return ticker, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*domain.Ticker), nil
+}
+
+// RecentTrades returns a symbol's limit most recent trades, newest first, and
+// false if the cached list can't tell what they are and the database must be
+// read instead. A list rebuilt from the database can answer any limit; one
+// only pushed to since can answer limits it holds enough trades for.
+func (m *MarketData) RecentTrades(symbol string, limit int) ([]*domain.Trade, bool) {
+	trades, complete, err := m.cache.GetRecentTrades(symbol, limit)
+	if err != nil || (len(trades) < limit && !complete) {
+		m.miss(symbol)
+		return nil, false
+	}
+	m.hit(symbol)
+	return trades, true
+}
+
+// RecordTrade pushes a trade to its symbol's recent list. Trades must be
+// recorded in the order they executed. A list that misses a trade is
+// dropped, so it never has a gap.
+func (m *MarketData) RecordTrade(trade *domain.Trade) {
+	m.recentMu.Lock()
+	defer m.recentMu.Unlock()
+
+	if m.rebuilt[trade.Symbol][trade.ID] {
+		return
+	}
+	if m.broken[trade.Symbol] {
+		if err := m.cache.DropRecentTrades(trade.Symbol); err != nil {
+			return
+		}
+		delete(m.broken, trade.Symbol)
+	}
+	if err := m.cache.PushRecentTrade(trade); err != nil {
+		log.Printf("Failed to cache trade %s: %v", trade.ID, err)
+		if m.cache.DropRecentTrades(trade.Symbol) != nil {
+			m.broken[trade.Symbol] = true
+		}
+	}
+}
+
+// rebuildRecentTrades replaces a symbol's recent list with the latest trades
+// in the database. Pushes wait meanwhile, so none falls between the read and
+// the write.
+func (m *MarketData) rebuildRecentTrades(ctx context.Context, symbol string) {
+	m.recentMu.Lock()
+	defer m.recentMu.Unlock()
+
+	trades, err := m.source.RecentTrades(ctx, symbol)
+	if err != nil {
+		log.Printf("Failed to prime recent trades %s: %v", symbol, err)
+		return
+	}
+	ids := make(map[string]bool, len(trades))
+	for _, trade := range trades {
+		ids[trade.ID] = true
+	}
+	if err := m.cache.ReplaceRecentTrades(symbol, trades); err != nil {
+		log.Printf("Failed to cache %s: %v", recentTradesKey(symbol), err)
+		m.broken[symbol] = true
+		return
+	}
+	atomic.AddUint64(&m.primed, 1)
+	m.rebuilt[symbol] = ids
+	delete(m.broken, symbol)
+}
+
+func (m *MarketData) hit(symbol string) {
+	atomic.AddUint64(&m.hits, 1)
+	m.symbolMu.Lock()
+	m.symbolHits(symbol).hits++
+	m.symbolMu.Unlock()
+}
+
+func (m *MarketData) miss(symbol string) {
+	atomic.AddUint64(&m.misses, 1)
+	m.symbolMu.Lock()
+	m.symbolHits(symbol).misses++
+	m.symbolMu.Unlock()
+}
+
+func (m *MarketData) symbolHits(symbol string) *symbolHits {
+	counts, ok := m.symbolStats[symbol]
+	if !ok {
+		counts = &symbolHits{}
+		m.symbolStats[symbol] = counts
+	}
+	return counts
+}
+
+// SymbolHitRate is the fraction of a symbol's reads served from the cache.
+// It reports false for a symbol that hasn't been read yet.
+func (m *MarketData) SymbolHitRate(symbol string) (float64, bool) {
+	m.symbolMu.Lock()
+	defer m.symbolMu.Unlock()
+
+	counts, ok := m.symbolStats[symbol]
+	if !ok || counts.hits+counts.misses == 0 {
+		return 0, false
+	}
+	return float64(counts.hits) / float64(counts.hits+counts.misses), true
+}
+
+// load runs fn for a missed key, coalescing concurrent misses. Other callers
+// may be waiting on the same load, so it doesn't stop when the first one's
+// ctx is cancelled.
+func (m *MarketData) load(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	value, err, shared := m.flight.Do(key, func() (interface{}, error) {
+		return fn(context.WithoutCancel(ctx))
+	})
+	if shared {
+		atomic.AddUint64(&m.suppressed, 1)
+	}
+	return value, err
+}
+
+func (m *MarketData) Stats() MarketDataStats {
+	return MarketDataStats{
+		Hits:       atomic.LoadUint64(&m.hits),
+		Misses:     atomic.LoadUint64(&m.misses),
+		Suppressed: atomic.LoadUint64(&m.suppressed),
+		Primed:     atomic.LoadUint64(&m.primed),
+	}
+}
+
+// flightCall is one in-progress computation that later callers wait on
+type flightCall struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+// singleFlight runs at most one computation per key at a time
+type singleFlight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// Do runs fn unless a call for key is already in flight, in which case it
+// waits for that call's result; shared reports whether the result was reused
+func (g *singleFlight) Do(key string, fn func() (interface{}, error)) (value interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.value, call.err, true
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.value, call.err = fn()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return call.value, call.err, false
+}
@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// fakeRedis serves GET, SET and PING over RESP2 from memory, enough for
+// the market data cache, and returns its URL
+func fakeRedis(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	values := make(map[string]string)
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			args, err := readCommand(reader)
+			if err != nil {
+				return
+			}
+			var reply string
+			mu.Lock()
+			switch strings.ToUpper(args[0]) {
+			case "PING":
+				reply = "+PONG\r\n"
+			case "GET":
+				if value, ok := values[args[1]]; ok {
+					reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+				} else {
+					reply = "$-1\r\n"
+				}
+			case "SET":
+				values[args[1]] = args[2]
+				reply = "+OK\r\n"
+			default:
+				reply = fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+			}
+			mu.Unlock()
+			if _, err := io.WriteString(conn, reply); err != nil {
+				return
+			}
+		}
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return "redis://" + listener.Addr().String()
+}
+
+// readCommand reads one RESP array of bulk strings
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	readLine := func(prefix byte) (int, error) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		if len(line) < 3 || line[0] != prefix {
+			return 0, fmt.Errorf("unexpected %q", line)
+		}
+		return strconv.Atoi(strings.TrimSpace(line[1:]))
+	}
+	count, err := readLine('*')
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		size, err := readLine('$')
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+// countingSource counts the snapshots taken of each key, holding every one
+// until release is closed
+type countingSource struct {
+	release   chan struct{}
+	snapshots sync.Map // key -> *atomic.Int64
+}
+
+func (s *countingSource) count(key string) int64 {
+	counter, _ := s.snapshots.LoadOrStore(key, new(atomic.Int64))
+	return counter.(*atomic.Int64).Load()
+}
+
+func (s *countingSource) take(key string) {
+	counter, _ := s.snapshots.LoadOrStore(key, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(1)
+	<-s.release
+}
+
+func (s *countingSource) OrderBook(_ context.Context, symbol string) (*domain.OrderBook, error) {
+	s.take("orderbook:" + symbol)
+	return &domain.OrderBook{Symbol: symbol, Bids: []domain.OrderBookLevel{}, Asks: []domain.OrderBookLevel{}, Timestamp: domain.Now()}, nil
+}
+
+func (s *countingSource) Ticker(_ context.Context, symbol string) (*domain.Ticker, error) {
+	s.take("ticker:" + symbol)
+	return &domain.Ticker{Symbol: symbol, Price: 45000, UpdatedAt: domain.Now()}, nil
+}
+
+func (s *countingSource) RecentTrades(context.Context, string) ([]*domain.Trade, error) {
+	return nil, nil
+}
+
+// Concurrent cold reads of a key take one snapshot between them, and the
+// reads after it are served from the cache
+func TestColdReadsTakeOneSnapshotPerKey(t *testing.T) {
+	redisCache, err := NewRedisCache(fakeRedis(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &countingSource{release: make(chan struct{})}
+	marketData := NewMarketData(redisCache, source)
+
+	const readers = 20
+	symbols := []string{"BTC-USD", "ETH-USD"}
+	var wg sync.WaitGroup
+	for _, symbol := range symbols {
+		for i := 0; i < readers; i++ {
+			wg.Add(2)
+			go func(symbol string) {
+				defer wg.Done()
+				if _, _, err := marketData.OrderBook(context.Background(), symbol, 0); err != nil {
+					t.Error(err)
+				}
+			}(symbol)
+			go func(symbol string) {
+				defer wg.Done()
+				if _, err := marketData.Ticker(context.Background(), symbol); err != nil {
+					t.Error(err)
+				}
+			}(symbol)
+		}
+	}
+
+	// Every reader has missed before the first snapshot is let through
+	deadline := time.Now().Add(5 * time.Second)
+	for marketData.Stats().Misses < uint64(2*readers*len(symbols)) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d misses, want %d", marketData.Stats().Misses, 2*readers*len(symbols))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(source.release)
+	wg.Wait()
+
+	for _, symbol := range symbols {
+		for _, key := range []string{"orderbook:" + symbol, "ticker:" + symbol} {
+			if got := source.count(key); got != 1 {
+				t.Errorf("%s: %d snapshots, want 1", key, got)
+			}
+		}
+	}
+	if got, want := marketData.Stats().Suppressed, uint64(2*(readers-1)*len(symbols)); got != want {
+		t.Errorf("%d misses suppressed, want %d", got, want)
+	}
+
+	for _, symbol := range symbols {
+		if _, cached, err := marketData.OrderBook(context.Background(), symbol, 0); err != nil || !cached {
+			t.Errorf("warm read of %s's book: cached %v, err %v", symbol, cached, err)
+		}
+		if _, err := marketData.Ticker(context.Background(), symbol); err != nil {
+			t.Error(err)
+		}
+		if got := source.count("orderbook:"+symbol) + source.count("ticker:"+symbol); got != 2 {
+			t.Errorf("%s: %d snapshots after warm reads, want 2", symbol, got)
+		}
+	}
+}
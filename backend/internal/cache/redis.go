@@ -90,21 +90,11 @@ func (r *RedisCache) GetTicker(symbol string) (*domain.Ticker, error) {
 	return &ticker, nil
 }
 
-func (r *RedisCache) PublishTrade(trade *domain.Trade) error {
-	data, err := json.Marshal(trade)
-	if err != nil {
-		return fmt.Errorf("failed to marshal trade: %w", err)
-	}
-
-	channel := fmt.Sprintf("trades:%s", trade.Symbol)
-	return r.client.Publish(r.ctx, channel, data).Err()
-}
-
-func (r *RedisCache) SubscribeTrades(symbol string) *redis.PubSub {
-	channel := fmt.Sprintf("trades:%s", symbol)
-	return r.client.Subscribe(r.ctx, channel)
-}
-
 func (r *RedisCache) Close() error {
 	return r.client.Close()
 }
+
+// Ping checks Redis answers
+func (r *RedisCache) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	replicationStream = "hft:replication"
+	leaderEpochKey    = "hft:leader:epoch"
+
+	// replicationMaxLen caps the stream so it can't grow without bound; a
+	// standby that falls further behind than this must be rebuilt
+	replicationMaxLen = 100000
+)
+
+// ReplicationMessage is one raw entry read back from the replication stream
+type ReplicationMessage struct {
+	ID   string
+	Data []byte
+}
+
+// AppendReplicationEvent adds an encoded event to the replication stream
+func (r *RedisCache) AppendReplicationEvent(data []byte) error {
+	return r.client.XAdd(r.ctx, &redis.XAddArgs{
+		Stream: replicationStream,
+		MaxLen: replicationMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"event": data},
+	}).Err()
+}
+
+// ReadReplicationEvents returns entries after lastID, waiting up to block for
+// new ones to arrive. An empty result means the wait timed out.
+func (r *RedisCache) ReadReplicationEvents(ctx context.Context, lastID string, block time.Duration) ([]ReplicationMessage, error) {
+	streams, err := r.client.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{replicationStream, lastID},
+		Count:   500,
+		Block:   block,
+	}).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read replication stream: %w", err)
+	}
+
+	messages := make([]ReplicationMessage, 0)
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			data, ok := msg.Values["event"].(string)
+			if !ok {
+				continue
+			}
+			messages = append(messages, ReplicationMessage{ID: msg.ID, Data: []byte(data)})
+		}
+	}
+	return messages, nil
+}
+
+// IncrLeaderEpoch claims leadership by bumping the shared epoch
+func (r *RedisCache) IncrLeaderEpoch() (int64, error) {
+	epoch, err := r.client.Incr(r.ctx, leaderEpochKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment leader epoch: %w", err)
+	}
+	return epoch, nil
+}
+
+// LeaderEpoch returns the current leadership epoch
+func (r *RedisCache) LeaderEpoch() (int64, error) {
+	epoch, err := r.client.Get(r.ctx, leaderEpochKey).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get leader epoch: %w", err)
+	}
+	return epoch, nil
+}
@@ -0,0 +1,136 @@
+package candles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+// ErrInvalidInterval is returned for kline intervals other than Intervals
+var ErrInvalidInterval = errors.New("invalid kline interval")
+
+// Intervals lists the kline intervals, finest first
+var Intervals = []string{"1m", "5m", "1h", "1d"}
+
+// interval is a kline width and the stored resolution it is rolled up from
+type interval struct {
+	step time.Duration
+	base string
+}
+
+var intervals = map[string]interval{
+	"1m": {time.Minute, repository.ResolutionMinute},
+	"5m": {5 * time.Minute, repository.ResolutionMinute},
+	"1h": {time.Hour, repository.ResolutionHour},
+	"1d": {24 * time.Hour, repository.ResolutionHour},
+}
+
+// Klines returns up to limit OHLCV candles of a symbol, oldest first, in UTC
+// buckets of the given interval. With a start, candles run forward from it;
+// without one, they are the last limit candles up to end (default now), so
+// the last is usually still forming.
+//
+// Closed minutes and hours come from the stored candles. Minutes since the
+// last rollover haven't been stored yet and are aggregated from trades on
+// the fly. Intervals without trades repeat the previous close with zero
+// volume; those before the symbol's first trade are left out.
+func (s *Service) Klines(ctx context.Context, symbol, name string, start, end time.Time, limit int) ([]*domain.Candle, error) {
+	iv, ok := intervals[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, want one of %v", ErrInvalidInterval, name, Intervals)
+	}
+
+	now := s.clock.Now().UTC()
+	if end.IsZero() || end.After(now) {
+		end = now
+	}
+	to := end.UTC().Truncate(iv.step)
+	if to.Before(end) {
+		to = to.Add(iv.step)
+	}
+	span := time.Duration(limit) * iv.step
+	from := to.Add(-span)
+	if !start.IsZero() {
+		from = start.UTC().Truncate(iv.step)
+		if to.After(from.Add(span)) {
+			to = from.Add(span)
+		}
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w %s - %s", ErrInvalidRange, from, to)
+	}
+
+	pieces, err := s.klinePieces(ctx, symbol, iv, from, to, now)
+	if err != nil {
+		return nil, err
+	}
+	last, seen, err := s.repo.LastClose(ctx, symbol, from)
+	if err != nil {
+		return nil, err
+	}
+
+	klines := make([]*domain.Candle, 0, limit)
+	i := 0
+	for ; i < len(pieces) && pieces[i].BucketStart.Before(from); i++ {
+		last, seen = pieces[i].Close, true
+	}
+	for bucket := from; bucket.Before(to) && !bucket.After(now); bucket = bucket.Add(iv.step) {
+		next := bucket.Add(iv.step)
+		kline := &domain.Candle{Symbol: symbol, Resolution: name, BucketStart: bucket, Closed: !next.After(now)}
+		for ; i < len(pieces) && pieces[i].BucketStart.Before(next); i++ {
+			kline.Merge(pieces[i])
+		}
+		if kline.TradeCount == 0 {
+			if !seen {
+				continue
+			}
+			kline.Open, kline.High, kline.Low, kline.Close = last, last, last, last
+		}
+		last, seen = kline.Close, true
+		klines = append(klines, kline)
+	}
+	return klines, nil
+}
+
+// klinePieces returns the stored and live candles covering [from, to) in
+// time order, starting earlier if the live part reaches back before from.
+// Hour intervals use stored hours up to the hour of the last rollover, then
+// stored minutes.
+func (s *Service) klinePieces(ctx context.Context, symbol string, iv interval, from, to, now time.Time) ([]*domain.Candle, error) {
+	s.mu.Lock()
+	rolled := s.lastRollover
+	s.mu.Unlock()
+	if rolled.IsZero() || rolled.After(to) {
+		rolled = to
+	}
+	if to.After(now) {
+		to = now
+	}
+
+	var pieces []*domain.Candle
+	minutesFrom := from
+	if iv.base == repository.ResolutionHour {
+		minutesFrom = rolled.Truncate(time.Hour)
+		hours, err := s.repo.GetCandles(ctx, symbol, repository.ResolutionHour, from, minutesFrom)
+		if err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, hours...)
+	}
+	if minutesFrom.Before(from) {
+		minutesFrom = from
+	}
+	minutes, err := s.repo.GetCandles(ctx, symbol, repository.ResolutionMinute, minutesFrom, rolled)
+	if err != nil {
+		return nil, err
+	}
+	live, err := s.repo.AggregateTrades(ctx, symbol, rolled, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(pieces, minutes...), live...), nil
+}
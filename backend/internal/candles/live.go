@@ -0,0 +1,139 @@
+package candles
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// closeInterval is how often forming klines are checked for having closed
+const closeInterval = time.Second
+
+// liveKey is one symbol's klines of one interval
+type liveKey struct {
+	symbol   string
+	interval string
+}
+
+// KlineUpdate is a kline that changed. Correction marks a closed kline sent
+// again because a trade that arrived late changed it.
+type KlineUpdate struct {
+	Kline      domain.Candle
+	Correction bool
+}
+
+// SetOnKlineCallback sets the callback to be called with every kline a
+// trade changes, and with each forming kline once more as it closes
+func (s *Service) SetOnKlineCallback(callback func(update KlineUpdate)) {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	s.onKline = callback
+}
+
+// RecordTrade folds a saved trade into its symbol's forming kline of every
+// interval. A symbol's first trade reads its forming klines as Klines serves
+// them, which already count the trade, so the two agree from the start. A
+// trade from before the forming kline opened re-reads the kline it belongs
+// to, sent as a correction.
+func (s *Service) RecordTrade(trade *domain.Trade) {
+	s.liveMu.Lock()
+	if s.onKline == nil {
+		s.liveMu.Unlock()
+		return
+	}
+	now := s.clock.Now().UTC()
+	var updates []KlineUpdate
+	for _, name := range Intervals {
+		updates = append(updates, s.recordTrade(trade, name, now)...)
+	}
+	onKline := s.onKline
+	s.liveMu.Unlock()
+
+	for _, update := range updates {
+		onKline(update)
+	}
+}
+
+// recordTrade folds a trade into one interval's forming kline. The caller
+// holds s.liveMu.
+func (s *Service) recordTrade(trade *domain.Trade, name string, now time.Time) []KlineUpdate {
+	key := liveKey{symbol: trade.Symbol, interval: name}
+	executed := trade.ExecutedAt.UTC()
+	forming := s.live[key]
+	if forming == nil {
+		klines, err := s.Klines(context.Background(), trade.Symbol, name, time.Time{}, now, 1)
+		if err != nil || len(klines) == 0 {
+			log.Printf("Failed to read the forming %s kline of %s, starting it from this trade: %v", name, trade.Symbol, err)
+			forming = &domain.Candle{Symbol: trade.Symbol, Resolution: name, BucketStart: executed.Truncate(intervals[name].step)}
+			forming.AddTrade(trade.Price, trade.Quantity)
+		} else {
+			forming = klines[0]
+		}
+		s.live[key] = forming
+		if !executed.Before(forming.BucketStart) {
+			return []KlineUpdate{{Kline: *forming}}
+		}
+		return s.correct(trade, name)
+	}
+
+	updates := s.closeKline(key, now)
+	forming = s.live[key]
+	if executed.Before(forming.BucketStart) {
+		return append(updates, s.correct(trade, name)...)
+	}
+	forming.AddTrade(trade.Price, trade.Quantity)
+	return append(updates, KlineUpdate{Kline: *forming})
+}
+
+// correct re-reads the closed kline a late trade belongs to
+func (s *Service) correct(trade *domain.Trade, name string) []KlineUpdate {
+	klines, err := s.Klines(context.Background(), trade.Symbol, name, trade.ExecutedAt, time.Time{}, 1)
+	if err != nil || len(klines) == 0 {
+		log.Printf("Failed to correct the %s kline of %s for late trade %s: %v", name, trade.Symbol, trade.ID, err)
+		return nil
+	}
+	return []KlineUpdate{{Kline: *klines[0], Correction: true}}
+}
+
+// closeKlines closes every forming kline whose interval has ended
+func (s *Service) closeKlines() {
+	s.liveMu.Lock()
+	now := s.clock.Now().UTC()
+	var updates []KlineUpdate
+	for key := range s.live {
+		updates = append(updates, s.closeKline(key, now)...)
+	}
+	onKline := s.onKline
+	s.liveMu.Unlock()
+
+	for _, update := range updates {
+		onKline(update)
+	}
+}
+
+// closeKline sends the forming kline as closed once its interval has ended
+// and opens the one now forming at its close, as Klines shows intervals
+// without trades. The caller holds s.liveMu.
+func (s *Service) closeKline(key liveKey, now time.Time) []KlineUpdate {
+	forming := s.live[key]
+	step := intervals[key.interval].step
+	if now.Before(forming.BucketStart.Add(step)) {
+		return nil
+	}
+	forming.Closed = true
+	closed := *forming
+
+	last := closed.Close
+	s.live[key] = &domain.Candle{
+		Symbol:      key.symbol,
+		Resolution:  key.interval,
+		BucketStart: now.Truncate(step),
+		Open:        last,
+		High:        last,
+		Low:         last,
+		Close:       last,
+	}
+	return []KlineUpdate{{Kline: closed}}
+}
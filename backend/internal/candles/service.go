@@ -0,0 +1,168 @@
+package candles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/clock"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+const (
+	// batchSize is how much trade history one recomputation step covers
+	batchSize = time.Hour
+	// workInterval is how often the queue of invalidations is checked
+	workInterval = time.Second
+	// rolloverInterval is how often freshly closed minutes are queued
+	rolloverInterval = time.Minute
+)
+
+// Service keeps candles and daily stats in step with the trades table. Live
+// trading is folded in by queueing each closed minute; busts and backfills
+// queue the range they changed. Either way only the queued buckets are
+// recomputed, in resumable batches.
+type Service struct {
+	repo    *repository.CandleRepository
+	clock   clock.Clock
+	symbols func() []string
+	// mu serializes queue changes with recomputation steps, so a merge never
+	// races a batch of the invalidation it replaces. It also guards
+	// lastRollover, which only rollover writes once started.
+	mu           sync.Mutex
+	lastRollover time.Time
+	runMu        sync.Mutex // guards ctx and cancel across Stop and Start
+	ctx          context.Context
+	cancel       context.CancelFunc
+	// liveMu guards the forming klines streamed to clients, by symbol and
+	// interval
+	liveMu  sync.Mutex
+	live    map[liveKey]*domain.Candle
+	onKline func(update KlineUpdate)
+}
+
+func NewService(repo *repository.CandleRepository, symbols func() []string) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		repo:    repo,
+		clock:   clock.Real{},
+		symbols: symbols,
+		live:    make(map[liveKey]*domain.Candle),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// SetClock replaces the wall clock driving rollover and the worker. It must
+// be called before Start.
+func (s *Service) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Start resumes any interrupted recomputation and begins rolling live trades
+// into candles from the start of the current hour. After a Stop, rollover
+// catches up on the minutes that closed in between. While running, forming
+// klines are closed as their interval ends.
+func (s *Service) Start() {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	s.mu.Lock()
+	if s.lastRollover.IsZero() {
+		s.lastRollover = s.clock.Now().UTC().Truncate(time.Hour)
+	}
+	s.mu.Unlock()
+	ctx := s.ctx
+	s.clock.Every(ctx, workInterval, func() { s.work(ctx) })
+	s.clock.Every(ctx, rolloverInterval, func() { s.rollover(ctx) })
+	s.clock.Every(ctx, closeInterval, s.closeKlines)
+	log.Println("Candle service started")
+}
+
+// Stop halts rollover and recomputation; unfinished work resumes on Start or
+// restart
+func (s *Service) Stop() {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	s.cancel()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+}
+
+// ErrInvalidRange is returned for candle ranges that end before they start
+var ErrInvalidRange = errors.New("invalid candle range")
+
+// Invalidate queues a symbol's candles over [from, to) for recomputation,
+// widened to whole minutes
+func (s *Service) Invalidate(ctx context.Context, symbol string, from, to time.Time) (*repository.CandleInvalidation, error) {
+	from = from.UTC().Truncate(time.Minute)
+	to = to.UTC()
+	if aligned := to.Truncate(time.Minute); !aligned.Equal(to) {
+		to = aligned.Add(time.Minute)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w %s - %s", ErrInvalidRange, from, to)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.repo.Invalidate(ctx, symbol, from, to)
+}
+
+// rollover queues every minute that closed since the last rollover
+func (s *Service) rollover(ctx context.Context) {
+	now := s.clock.Now().UTC().Truncate(time.Minute)
+	if !now.After(s.lastRollover) {
+		return
+	}
+
+	for _, symbol := range s.symbols() {
+		if _, err := s.Invalidate(ctx, symbol, s.lastRollover, now); err != nil {
+			log.Printf("Failed to queue candle rollover for %s: %v", symbol, err)
+			return
+		}
+	}
+	s.mu.Lock()
+	s.lastRollover = now
+	s.mu.Unlock()
+}
+
+// work drains the invalidation queue one batch at a time
+func (s *Service) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		done, err := s.step(ctx)
+		if err != nil {
+			log.Printf("Candle recomputation failed: %v", err)
+			return
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// step recomputes one batch of the oldest invalidation, or finishes it. It
+// reports true once the queue is empty.
+func (s *Service) step(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, err := s.repo.NextInvalidation(ctx)
+	if err != nil || inv == nil {
+		return true, err
+	}
+
+	if !inv.Cursor.Before(inv.RangeEnd) {
+		return false, s.repo.FinishInvalidation(ctx, inv)
+	}
+
+	batchEnd := inv.Cursor.Add(batchSize)
+	if batchEnd.After(inv.RangeEnd) {
+		batchEnd = inv.RangeEnd
+	}
+	return false, s.repo.RecomputeBatch(ctx, inv, batchEnd)
+}
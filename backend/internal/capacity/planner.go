@@ -0,0 +1,155 @@
+package capacity
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/clock"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+const (
+	// sampleInterval is how often today's sample is refreshed; the last
+	// refresh of a day is the one kept
+	sampleInterval = time.Hour
+	dayFormat      = "2006-01-02"
+)
+
+// Report is the current resource usage of every symbol
+type Report struct {
+	GeneratedAt time.Time                               `json:"generated_at"`
+	Symbols     []*repository.CapacitySample            `json:"symbols"`
+	History     map[string][]*repository.CapacitySample `json:"history"`
+	// StaleOrders is what the stale order sweeper has cancelled
+	StaleOrders *engine.StaleOrderStats `json:"stale_orders,omitempty"`
+}
+
+// Planner assembles per-symbol usage from the engine, the trades table, the
+// websocket hub and the market data cache, and keeps a daily history of it
+type Planner struct {
+	samples     *repository.CapacityRepository
+	trades      *repository.TradeRepository
+	usage       func() []engine.SymbolUsage
+	subscribers func(symbol string) int
+	hitRate     func(symbol string) (float64, bool)
+	staleOrders func() engine.StaleOrderStats
+	clock       clock.Clock
+
+	runMu  sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewPlanner(samples *repository.CapacityRepository, trades *repository.TradeRepository, usage func() []engine.SymbolUsage) *Planner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Planner{
+		samples: samples,
+		trades:  trades,
+		usage:   usage,
+		clock:   clock.Real{},
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// SetSubscribers reports how many websocket clients subscribe to each
+// symbol
+func (p *Planner) SetSubscribers(subscribers func(symbol string) int) {
+	p.subscribers = subscribers
+}
+
+// SetCacheHitRate reports the market data cache's per-symbol hit rate.
+// Without it cache_hit_rate is null.
+func (p *Planner) SetCacheHitRate(hitRate func(symbol string) (float64, bool)) {
+	p.hitRate = hitRate
+}
+
+// SetStaleOrders adds the stale order sweeper's counts to reports
+func (p *Planner) SetStaleOrders(stats func() engine.StaleOrderStats) {
+	p.staleOrders = stats
+}
+
+// Start samples straight away, then refreshes today's sample every hour
+func (p *Planner) Start() {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+
+	ctx := p.ctx
+	p.clock.Go(func() { p.sample(ctx) })
+	p.clock.Every(ctx, sampleInterval, func() { p.sample(ctx) })
+	log.Println("Capacity sampler started")
+}
+
+func (p *Planner) Stop() {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+
+	p.cancel()
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+}
+
+// Current measures every symbol now
+func (p *Planner) Current(ctx context.Context) []*repository.CapacitySample {
+	now := p.clock.Now()
+	usages := p.usage()
+	samples := make([]*repository.CapacitySample, 0, len(usages))
+	for _, usage := range usages {
+		sample := &repository.CapacitySample{
+			Symbol:             usage.Symbol,
+			RestingOrders:      usage.RestingOrders,
+			MemoryBytes:        usage.MemoryBytes,
+			OrderEventsPerHour: int64(usage.OrderEventsPerHour),
+			PersistLagP95Ms:    float64(usage.PersistLagP95) / float64(time.Millisecond),
+		}
+		if p.subscribers != nil {
+			sample.WebsocketSubscribers = p.subscribers(usage.Symbol)
+		}
+		if count, err := p.trades.CountTradesSince(ctx, usage.Symbol, now.Add(-time.Hour)); err == nil {
+			sample.TradesPerHour = count
+		} else {
+			log.Printf("Failed to count trades for %s: %v", usage.Symbol, err)
+		}
+		if p.hitRate != nil {
+			if rate, ok := p.hitRate(usage.Symbol); ok {
+				sample.CacheHitRate = &rate
+			}
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// Report returns current usage with the daily samples of the last days days,
+// grouped by symbol
+func (p *Planner) Report(ctx context.Context, days int) (*Report, error) {
+	now := p.clock.Now()
+	since := now.UTC().AddDate(0, 0, -days).Format(dayFormat)
+	stored, err := p.samples.GetSamples(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make(map[string][]*repository.CapacitySample)
+	for _, sample := range stored {
+		history[sample.Symbol] = append(history[sample.Symbol], sample)
+	}
+	report := &Report{GeneratedAt: now, Symbols: p.Current(ctx), History: history}
+	if p.staleOrders != nil {
+		stats := p.staleOrders()
+		report.StaleOrders = &stats
+	}
+	return report, nil
+}
+
+func (p *Planner) sample(ctx context.Context) {
+	day := p.clock.Now().UTC().Format(dayFormat)
+	for _, sample := range p.Current(ctx) {
+		sample.Day = day
+		if err := p.samples.SaveSample(ctx, sample); err != nil {
+			log.Printf("Failed to store capacity sample for %s: %v", sample.Symbol, err)
+		}
+	}
+}
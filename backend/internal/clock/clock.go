@@ -0,0 +1,149 @@
+package clock
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time and scheduling for every time-driven component.
+// Production uses Real; simulations and tests use Virtual, which only moves
+// when told to and runs scheduled work synchronously so results are
+// reproducible.
+type Clock interface {
+	Now() time.Time
+	// Every calls fn once per interval until ctx is done
+	Every(ctx context.Context, interval time.Duration, fn func())
+	// Go runs fn in the background (Real) or inline (Virtual)
+	Go(fn func())
+}
+
+// Real is the wall clock
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+func (Real) Every(ctx context.Context, interval time.Duration, fn func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+}
+
+func (Real) Go(fn func()) {
+	go fn()
+}
+
+// job is a periodic callback registered with a Virtual clock
+type job struct {
+	ctx      context.Context
+	interval time.Duration
+	next     time.Time
+	order    int
+	fn       func()
+}
+
+// Virtual is a manually advanced clock. Jobs due at the same instant run in
+// registration order, so a given sequence of Advance calls always produces
+// the same sequence of callbacks.
+type Virtual struct {
+	mu      sync.Mutex
+	now     time.Time
+	jobs    []*job
+	counter int
+}
+
+func NewVirtual(start time.Time) *Virtual {
+	return &Virtual{now: start}
+}
+
+func (v *Virtual) Now() time.Time {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.now
+}
+
+func (v *Virtual) Every(ctx context.Context, interval time.Duration, fn func()) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.counter++
+	v.jobs = append(v.jobs, &job{
+		ctx:      ctx,
+		interval: interval,
+		next:     v.now.Add(interval),
+		order:    v.counter,
+		fn:       fn,
+	})
+}
+
+func (v *Virtual) Go(fn func()) {
+	fn()
+}
+
+// Advance moves time forward by d, running every job that falls due along the
+// way at its scheduled instant. It returns once all of them have completed.
+func (v *Virtual) Advance(d time.Duration) {
+	v.mu.Lock()
+	target := v.now.Add(d)
+	v.mu.Unlock()
+
+	for {
+		next := v.nextDue(target)
+		if next == nil {
+			break
+		}
+		next.fn()
+	}
+
+	v.mu.Lock()
+	v.now = target
+	v.mu.Unlock()
+}
+
+// nextDue pops the earliest job due at or before target, moving the clock to
+// its deadline and rescheduling it
+func (v *Virtual) nextDue(target time.Time) *job {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	live := v.jobs[:0]
+	for _, j := range v.jobs {
+		if j.ctx.Err() == nil {
+			live = append(live, j)
+		}
+	}
+	v.jobs = live
+
+	if len(v.jobs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(v.jobs, func(i, j int) bool {
+		if !v.jobs[i].next.Equal(v.jobs[j].next) {
+			return v.jobs[i].next.Before(v.jobs[j].next)
+		}
+		return v.jobs[i].order < v.jobs[j].order
+	})
+
+	due := v.jobs[0]
+	if due.next.After(target) {
+		return nil
+	}
+
+	v.now = due.next
+	due.next = due.next.Add(due.interval)
+	return due
+}
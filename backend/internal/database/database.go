@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hft-exchange/backend/internal/domain"
 	_ "github.com/lib/pq" // PostgreSQL driver
 	_ "modernc.org/sqlite" // SQLite driver (keep for local dev)
 )
@@ -74,7 +75,17 @@ func (db *DB) InitSchema() error {
 			id TEXT PRIMARY KEY,
 			username TEXT UNIQUE NOT NULL,
 			email TEXT UNIQUE NOT NULL,
-			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+			kind TEXT NOT NULL DEFAULT 'user',
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			disabled_at TIMESTAMP,
+			disabled_reason TEXT,
+			verified_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS user_credentials (
+			user_id TEXT PRIMARY KEY REFERENCES users(id),
+			password_hash TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL
 		);
 
 		CREATE TABLE IF NOT EXISTS orders (
@@ -92,6 +103,8 @@ func (db *DB) InitSchema() error {
 			time_in_force TEXT DEFAULT 'GTC',
 			created_at TIMESTAMP NOT NULL,
 			updated_at TIMESTAMP NOT NULL,
+			request_id TEXT,
+			budget DOUBLE PRECISION,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		);
 
@@ -146,6 +159,18 @@ func (db *DB) InitSchema() error {
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		);
 
+		CREATE TABLE IF NOT EXISTS symbols (
+			symbol TEXT PRIMARY KEY,
+			base_asset TEXT NOT NULL,
+			quote_asset TEXT NOT NULL,
+			tick_size DOUBLE PRECISION NOT NULL,
+			lot_size DOUBLE PRECISION NOT NULL,
+			min_notional DOUBLE PRECISION NOT NULL DEFAULT 0,
+			maker_fee_bps DOUBLE PRECISION NOT NULL DEFAULT 0,
+			taker_fee_bps DOUBLE PRECISION NOT NULL DEFAULT 0,
+			price_band_pct DOUBLE PRECISION NOT NULL DEFAULT 0
+		);
+
 		CREATE TABLE IF NOT EXISTS tickers (
 			symbol TEXT PRIMARY KEY,
 			price DOUBLE PRECISION NOT NULL,
@@ -155,6 +180,188 @@ func (db *DB) InitSchema() error {
 			change_24h DOUBLE PRECISION NOT NULL DEFAULT 0,
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 		);
+
+		CREATE TABLE IF NOT EXISTS candles (
+			symbol TEXT NOT NULL,
+			resolution TEXT NOT NULL,
+			bucket_start TIMESTAMP NOT NULL,
+			open DOUBLE PRECISION NOT NULL,
+			high DOUBLE PRECISION NOT NULL,
+			low DOUBLE PRECISION NOT NULL,
+			close DOUBLE PRECISION NOT NULL,
+			volume DOUBLE PRECISION NOT NULL,
+			vwap DOUBLE PRECISION NOT NULL,
+			trade_count INTEGER NOT NULL,
+			dirty BOOLEAN NOT NULL DEFAULT FALSE,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (symbol, resolution, bucket_start)
+		);
+
+		CREATE TABLE IF NOT EXISTS daily_stats (
+			symbol TEXT NOT NULL,
+			day TEXT NOT NULL,
+			open DOUBLE PRECISION NOT NULL,
+			high DOUBLE PRECISION NOT NULL,
+			low DOUBLE PRECISION NOT NULL,
+			close DOUBLE PRECISION NOT NULL,
+			volume DOUBLE PRECISION NOT NULL,
+			vwap DOUBLE PRECISION NOT NULL,
+			trade_count INTEGER NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (symbol, day)
+		);
+
+		CREATE TABLE IF NOT EXISTS candle_invalidations (
+			id TEXT PRIMARY KEY,
+			symbol TEXT NOT NULL,
+			range_start TIMESTAMP NOT NULL,
+			range_end TIMESTAMP NOT NULL,
+			cursor_at TIMESTAMP NOT NULL,
+			status TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_candle_invalidations_status ON candle_invalidations(status, symbol);
+
+		CREATE TABLE IF NOT EXISTS settlements (
+			trade_id TEXT PRIMARY KEY,
+			settled_at TIMESTAMP NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS pending_settlements (
+			trade_id TEXT PRIMARY KEY,
+			trade TEXT NOT NULL,
+			saved BOOLEAN NOT NULL,
+			attempts INTEGER NOT NULL,
+			last_error TEXT NOT NULL,
+			first_failed_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS notification_settings (
+			user_id TEXT PRIMARY KEY,
+			sink TEXT NOT NULL,
+			address TEXT NOT NULL,
+			events TEXT NOT NULL,
+			digest_minutes INTEGER NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS capacity_samples (
+			day TEXT NOT NULL,
+			symbol TEXT NOT NULL,
+			resting_orders INTEGER NOT NULL,
+			memory_bytes BIGINT NOT NULL,
+			trades_per_hour INTEGER NOT NULL,
+			order_events_per_hour BIGINT NOT NULL,
+			websocket_subscribers INTEGER NOT NULL,
+			persist_lag_p95_ms DOUBLE PRECISION NOT NULL,
+			cache_hit_rate DOUBLE PRECISION,
+			sampled_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (day, symbol)
+		);
+
+		CREATE TABLE IF NOT EXISTS risk_profiles (
+			user_id TEXT PRIMARY KEY,
+			max_open_orders INTEGER NOT NULL,
+			max_position DOUBLE PRECISION NOT NULL,
+			max_daily_orders INTEGER NOT NULL,
+			max_order_notional DOUBLE PRECISION NOT NULL,
+			max_open_notional DOUBLE PRECISION NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS journal (
+			symbol TEXT NOT NULL,
+			seq BIGINT NOT NULL,
+			kind TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			recorded_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (symbol, seq)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_journal_kind ON journal(symbol, kind, seq);
+
+		CREATE TABLE IF NOT EXISTS balance_ledger (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			asset TEXT NOT NULL,
+			delta DOUBLE PRECISION NOT NULL,
+			available DOUBLE PRECISION NOT NULL,
+			reason TEXT NOT NULL,
+			reference TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_balance_ledger_user ON balance_ledger(user_id, created_at);
+
+		CREATE TABLE IF NOT EXISTS funding_transfers (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			asset TEXT NOT NULL,
+			type TEXT NOT NULL,
+			amount DOUBLE PRECISION NOT NULL,
+			available DOUBLE PRECISION NOT NULL,
+			ledger_id TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_funding_transfers_user ON funding_transfers(user_id, asset, type, created_at);
+
+		CREATE TABLE IF NOT EXISTS hedges (
+			id TEXT PRIMARY KEY,
+			bot TEXT NOT NULL,
+			symbol TEXT NOT NULL,
+			side TEXT NOT NULL,
+			quantity DOUBLE PRECISION NOT NULL,
+			reference_price DOUBLE PRECISION NOT NULL,
+			price DOUBLE PRECISION NOT NULL,
+			slippage DOUBLE PRECISION NOT NULL,
+			executed_at TIMESTAMP NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_hedges_bot ON hedges(bot, executed_at);
+
+		CREATE TABLE IF NOT EXISTS balance_snapshots (
+			taken_at TIMESTAMP NOT NULL,
+			asset TEXT NOT NULL,
+			available DOUBLE PRECISION NOT NULL,
+			locked DOUBLE PRECISION NOT NULL,
+			expected DOUBLE PRECISION NOT NULL,
+			drift DOUBLE PRECISION NOT NULL,
+			PRIMARY KEY (asset, taken_at)
+		);
+
+		CREATE TABLE IF NOT EXISTS trading_status (
+			id INTEGER PRIMARY KEY,
+			paused BOOLEAN NOT NULL,
+			reason TEXT NOT NULL,
+			since TIMESTAMP NOT NULL,
+			resume_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS system_notifications (
+			id TEXT PRIMARY KEY,
+			symbol TEXT NOT NULL,
+			category TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			message TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_system_notifications_created_at ON system_notifications(created_at DESC);
+
+		CREATE TABLE IF NOT EXISTS user_activity (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			symbol TEXT NOT NULL,
+			order_id TEXT NOT NULL,
+			category TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			message TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_activity_user_created ON user_activity(user_id, created_at DESC);
 		`
 	} else {
 		// SQLite schema (original)
@@ -163,7 +370,17 @@ func (db *DB) InitSchema() error {
 			id TEXT PRIMARY KEY,
 			username TEXT UNIQUE NOT NULL,
 			email TEXT UNIQUE NOT NULL,
-			created_at TEXT NOT NULL DEFAULT (datetime('now'))
+			kind TEXT NOT NULL DEFAULT 'user',
+			created_at TEXT NOT NULL DEFAULT (datetime('now')),
+			disabled_at TEXT,
+			disabled_reason TEXT,
+			verified_at TEXT
+		);
+
+		CREATE TABLE IF NOT EXISTS user_credentials (
+			user_id TEXT PRIMARY KEY REFERENCES users(id),
+			password_hash TEXT NOT NULL,
+			updated_at TEXT NOT NULL
 		);
 
 		CREATE TABLE IF NOT EXISTS orders (
@@ -181,6 +398,8 @@ func (db *DB) InitSchema() error {
 			time_in_force TEXT DEFAULT 'GTC',
 			created_at TEXT NOT NULL,
 			updated_at TEXT NOT NULL,
+			request_id TEXT,
+			budget REAL,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		);
 
@@ -235,6 +454,18 @@ func (db *DB) InitSchema() error {
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		);
 
+		CREATE TABLE IF NOT EXISTS symbols (
+			symbol TEXT PRIMARY KEY,
+			base_asset TEXT NOT NULL,
+			quote_asset TEXT NOT NULL,
+			tick_size REAL NOT NULL,
+			lot_size REAL NOT NULL,
+			min_notional REAL NOT NULL DEFAULT 0,
+			maker_fee_bps REAL NOT NULL DEFAULT 0,
+			taker_fee_bps REAL NOT NULL DEFAULT 0,
+			price_band_pct REAL NOT NULL DEFAULT 0
+		);
+
 		CREATE TABLE IF NOT EXISTS tickers (
 			symbol TEXT PRIMARY KEY,
 			price REAL NOT NULL,
@@ -244,6 +475,188 @@ func (db *DB) InitSchema() error {
 			change_24h REAL NOT NULL DEFAULT 0,
 			updated_at TEXT NOT NULL DEFAULT (datetime('now'))
 		);
+
+		CREATE TABLE IF NOT EXISTS candles (
+			symbol TEXT NOT NULL,
+			resolution TEXT NOT NULL,
+			bucket_start TEXT NOT NULL,
+			open REAL NOT NULL,
+			high REAL NOT NULL,
+			low REAL NOT NULL,
+			close REAL NOT NULL,
+			volume REAL NOT NULL,
+			vwap REAL NOT NULL,
+			trade_count INTEGER NOT NULL,
+			dirty INTEGER NOT NULL DEFAULT 0,
+			updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+			PRIMARY KEY (symbol, resolution, bucket_start)
+		);
+
+		CREATE TABLE IF NOT EXISTS daily_stats (
+			symbol TEXT NOT NULL,
+			day TEXT NOT NULL,
+			open REAL NOT NULL,
+			high REAL NOT NULL,
+			low REAL NOT NULL,
+			close REAL NOT NULL,
+			volume REAL NOT NULL,
+			vwap REAL NOT NULL,
+			trade_count INTEGER NOT NULL,
+			updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+			PRIMARY KEY (symbol, day)
+		);
+
+		CREATE TABLE IF NOT EXISTS candle_invalidations (
+			id TEXT PRIMARY KEY,
+			symbol TEXT NOT NULL,
+			range_start TEXT NOT NULL,
+			range_end TEXT NOT NULL,
+			cursor_at TEXT NOT NULL,
+			status TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_candle_invalidations_status ON candle_invalidations(status, symbol);
+
+		CREATE TABLE IF NOT EXISTS settlements (
+			trade_id TEXT PRIMARY KEY,
+			settled_at TEXT NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS pending_settlements (
+			trade_id TEXT PRIMARY KEY,
+			trade TEXT NOT NULL,
+			saved INTEGER NOT NULL,
+			attempts INTEGER NOT NULL,
+			last_error TEXT NOT NULL,
+			first_failed_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS notification_settings (
+			user_id TEXT PRIMARY KEY,
+			sink TEXT NOT NULL,
+			address TEXT NOT NULL,
+			events TEXT NOT NULL,
+			digest_minutes INTEGER NOT NULL,
+			updated_at TEXT NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS capacity_samples (
+			day TEXT NOT NULL,
+			symbol TEXT NOT NULL,
+			resting_orders INTEGER NOT NULL,
+			memory_bytes BIGINT NOT NULL,
+			trades_per_hour INTEGER NOT NULL,
+			order_events_per_hour BIGINT NOT NULL,
+			websocket_subscribers INTEGER NOT NULL,
+			persist_lag_p95_ms REAL NOT NULL,
+			cache_hit_rate REAL,
+			sampled_at TEXT NOT NULL,
+			PRIMARY KEY (day, symbol)
+		);
+
+		CREATE TABLE IF NOT EXISTS risk_profiles (
+			user_id TEXT PRIMARY KEY,
+			max_open_orders INTEGER NOT NULL,
+			max_position REAL NOT NULL,
+			max_daily_orders INTEGER NOT NULL,
+			max_order_notional REAL NOT NULL,
+			max_open_notional REAL NOT NULL,
+			updated_at TEXT NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS journal (
+			symbol TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			recorded_at TEXT NOT NULL,
+			PRIMARY KEY (symbol, seq)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_journal_kind ON journal(symbol, kind, seq);
+
+		CREATE TABLE IF NOT EXISTS balance_ledger (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			asset TEXT NOT NULL,
+			delta REAL NOT NULL,
+			available REAL NOT NULL,
+			reason TEXT NOT NULL,
+			reference TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_balance_ledger_user ON balance_ledger(user_id, created_at);
+
+		CREATE TABLE IF NOT EXISTS funding_transfers (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			asset TEXT NOT NULL,
+			type TEXT NOT NULL,
+			amount REAL NOT NULL,
+			available REAL NOT NULL,
+			ledger_id TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_funding_transfers_user ON funding_transfers(user_id, asset, type, created_at);
+
+		CREATE TABLE IF NOT EXISTS hedges (
+			id TEXT PRIMARY KEY,
+			bot TEXT NOT NULL,
+			symbol TEXT NOT NULL,
+			side TEXT NOT NULL,
+			quantity REAL NOT NULL,
+			reference_price REAL NOT NULL,
+			price REAL NOT NULL,
+			slippage REAL NOT NULL,
+			executed_at TEXT NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_hedges_bot ON hedges(bot, executed_at);
+
+		CREATE TABLE IF NOT EXISTS balance_snapshots (
+			taken_at TEXT NOT NULL,
+			asset TEXT NOT NULL,
+			available REAL NOT NULL,
+			locked REAL NOT NULL,
+			expected REAL NOT NULL,
+			drift REAL NOT NULL,
+			PRIMARY KEY (asset, taken_at)
+		);
+
+		CREATE TABLE IF NOT EXISTS trading_status (
+			id INTEGER PRIMARY KEY,
+			paused INTEGER NOT NULL,
+			reason TEXT NOT NULL,
+			since TEXT NOT NULL,
+			resume_at TEXT
+		);
+
+		CREATE TABLE IF NOT EXISTS system_notifications (
+			id TEXT PRIMARY KEY,
+			symbol TEXT NOT NULL,
+			category TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			message TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_system_notifications_created_at ON system_notifications(created_at DESC);
+
+		CREATE TABLE IF NOT EXISTS user_activity (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			symbol TEXT NOT NULL,
+			order_id TEXT NOT NULL,
+			category TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			message TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_activity_user_created ON user_activity(user_id, created_at DESC);
 		`
 	}
 
@@ -252,56 +665,118 @@ func (db *DB) InitSchema() error {
 		return fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
+	if err := db.ensureTradeFillIndex(); err != nil {
+		return fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	if err := db.ensureColumn("orders", "request_id", "TEXT", "TEXT"); err != nil {
+		return fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	if err := db.ensureColumn("orders", "budget", "DOUBLE PRECISION", "REAL"); err != nil {
+		return fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	if err := db.ensureColumn("trading_status", "resume_at", "TIMESTAMP", "TEXT"); err != nil {
+		return fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	for _, column := range []struct{ name, postgresType, sqliteType string }{
+		{"kind", "TEXT", "TEXT"},
+		{"disabled_at", "TIMESTAMP", "TEXT"},
+		{"disabled_reason", "TEXT", "TEXT"},
+		{"verified_at", "TIMESTAMP", "TEXT"},
+	} {
+		if err := db.ensureColumn("users", column.name, column.postgresType, column.sqliteType); err != nil {
+			return fmt.Errorf("failed to initialize schema: %w", err)
+		}
+	}
+
 	log.Println("Database schema initialized")
 	return nil
 }
 
+// ensureTradeFillIndex makes each taker/maker fill unique; the engine matches
+// a taker against a given maker at most once. Duplicates stored before the
+// key existed would make creating it fail, so they are reported instead and
+// the key is added once they have been reconciled.
+func (db *DB) ensureTradeFillIndex() error {
+	var duplicates int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM (
+			SELECT 1 FROM trades
+			GROUP BY taker_order_id, maker_order_id
+			HAVING COUNT(*) > 1
+		) duplicated
+	`).Scan(&duplicates)
+	if err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		log.Printf("Warning: %d fills are stored more than once; trades are not unique until they are removed", duplicates)
+		return nil
+	}
+
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_trades_fill ON trades(taker_order_id, maker_order_id)`)
+	return err
+}
+
+// ensureColumn adds a column to tables created before it existed. Columns
+// added this way are nullable, since existing rows have no value for them.
+//   - orders.request_id: the HTTP request that placed the order
+//   - orders.budget: the quote funds locked for a market buy
+//   - trading_status.resume_at: when a timed pause ends
+//   - users.kind, users.disabled_at, users.disabled_reason: what the account
+//     is for and whether an admin disabled it; rows without a kind are users
+//   - users.verified_at: when an admin verified the user
+func (db *DB) ensureColumn(table, column, postgresType, sqliteType string) error {
+	if db.driver == "postgres" {
+		_, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s`, table, column, postgresType))
+		return err
+	}
+
+	var columns int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info($1) WHERE name = $2`, table, column).Scan(&columns)
+	if err != nil || columns > 0 {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, sqliteType))
+	return err
+}
+
 func (db *DB) SeedData() error {
 	// Create demo users
 	demoUsers := []struct {
 		id       string
 		username string
 		email    string
+		kind     domain.UserKind
 	}{
-		{"user-1", "trader1", "trader1@hft.com"},
-		{"user-2", "trader2", "trader2@hft.com"},
-		{"user-3", "marketmaker", "mm@hft.com"},
+		{"user-1", "trader1", "trader1@hft.com", domain.UserKindUser},
+		{"user-2", "trader2", "trader2@hft.com", domain.UserKindUser},
+		{"user-3", "marketmaker", "mm@hft.com", domain.UserKindBot},
 	}
 
 	for _, user := range demoUsers {
+		// Users seeded before kinds existed get theirs; nothing else changes
 		var query string
 		if db.driver == "postgres" {
 			query = `
-				INSERT INTO users (id, username, email, created_at)
-				VALUES ($1, $2, $3, NOW())
-				ON CONFLICT (id) DO NOTHING
+				INSERT INTO users (id, username, email, kind, created_at)
+				VALUES ($1, $2, $3, $4, NOW())
+				ON CONFLICT (id) DO UPDATE SET kind = excluded.kind WHERE users.kind IS NULL
 			`
 		} else {
 			query = `
-				INSERT INTO users (id, username, email, created_at)
-				VALUES ($1, $2, $3, datetime('now'))
-				ON CONFLICT (id) DO NOTHING
+				INSERT INTO users (id, username, email, kind, created_at)
+				VALUES ($1, $2, $3, $4, datetime('now'))
+				ON CONFLICT (id) DO UPDATE SET kind = excluded.kind WHERE users.kind IS NULL
 			`
 		}
 
-		_, err := db.Exec(query, user.id, user.username, user.email)
+		_, err := db.Exec(query, user.id, user.username, user.email, user.kind)
 		if err != nil {
 			return fmt.Errorf("failed to seed user %s: %w", user.username, err)
 		}
 
 		// Give each user initial balances
-		assets := []struct {
-			asset  string
-			amount float64
-		}{
-			{"USD", 100000.0},
-			{"BTC", 1.0},
-			{"ETH", 10.0},
-			{"SOL", 100.0},
-			{"USDC", 50000.0},
-		}
-
-		for _, asset := range assets {
+		for _, asset := range domain.StarterBalances {
 			var balanceQuery string
 			if db.driver == "postgres" {
 				balanceQuery = `
@@ -317,10 +792,47 @@ func (db *DB) SeedData() error {
 				`
 			}
 
-			_, err := db.Exec(balanceQuery, user.id, asset.asset, asset.amount)
+			_, err := db.Exec(balanceQuery, user.id, asset.Asset, asset.Amount)
 			if err != nil {
 				return fmt.Errorf("failed to seed balance for %s: %w", user.username, err)
 			}
+
+			// Reconciliation expects every unit held to come from the ledger.
+			// The fixed ID also covers databases seeded before it existed.
+			_, err = db.Exec(`
+				INSERT INTO balance_ledger (id, user_id, asset, delta, available, reason, reference, created_at)
+				VALUES ($1, $2, $3, $4, $4, 'seed', '', $5)
+				ON CONFLICT (id) DO NOTHING
+			`, fmt.Sprintf("seed:%s:%s", user.id, asset.Asset), user.id, asset.Asset, asset.Amount, time.Now())
+			if err != nil {
+				return fmt.Errorf("failed to record seeded balance for %s: %w", user.username, err)
+			}
+		}
+	}
+
+	// The market maker quotes every symbol around the clock, so it gets no
+	// per-user caps rather than the retail defaults; existing rows are kept
+	_, err := db.Exec(`
+		INSERT INTO risk_profiles (user_id, max_open_orders, max_position, max_daily_orders,
+			max_order_notional, max_open_notional, updated_at)
+		VALUES ($1, 0, 0, 0, 0, 0, $2)
+		ON CONFLICT (user_id) DO NOTHING
+	`, "user-3", time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to seed market maker risk profile: %w", err)
+	}
+
+	// List the default trading pairs; existing rows keep their settings
+	for _, config := range domain.DefaultSymbolConfigs() {
+		_, err := db.Exec(`
+			INSERT INTO symbols (symbol, base_asset, quote_asset, tick_size, lot_size, min_notional,
+				maker_fee_bps, taker_fee_bps, price_band_pct)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (symbol) DO NOTHING
+		`, config.Symbol, config.BaseAsset, config.QuoteAsset, config.TickSize, config.LotSize,
+			config.MinNotional, config.MakerFeeBps, config.TakerFeeBps, config.PriceBandPct)
+		if err != nil {
+			return fmt.Errorf("failed to seed symbol %s: %w", config.Symbol, err)
 		}
 	}
 
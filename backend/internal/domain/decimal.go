@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Decimal places used for symbols and assets with no configured precision
+const (
+	DefaultPriceDecimals    = 2
+	DefaultQuantityDecimals = 8
+	DefaultAssetDecimals    = 8
+)
+
+// Precision is how many decimal places a symbol's prices and quantities are
+// written with
+type Precision struct {
+	Price    int
+	Quantity int
+}
+
+var (
+	precisionMu     sync.RWMutex
+	symbolPrecision = make(map[string]Precision)
+	assetPrecision  = make(map[string]int)
+)
+
+// SetSymbolPrecision registers the decimal places used to serialize a
+// symbol's prices and quantities
+func SetSymbolPrecision(symbol string, precision Precision) {
+	precisionMu.Lock()
+	symbolPrecision[symbol] = precision
+	precisionMu.Unlock()
+}
+
+// SetAssetPrecision registers the decimal places used to serialize balances
+// of an asset
+func SetAssetPrecision(asset string, decimals int) {
+	precisionMu.Lock()
+	assetPrecision[asset] = decimals
+	precisionMu.Unlock()
+}
+
+// SymbolPrecision returns a symbol's registered precision or the defaults
+func SymbolPrecision(symbol string) Precision {
+	precisionMu.RLock()
+	defer precisionMu.RUnlock()
+	if precision, ok := symbolPrecision[symbol]; ok {
+		return precision
+	}
+	return Precision{Price: DefaultPriceDecimals, Quantity: DefaultQuantityDecimals}
+}
+
+// AssetPrecision returns an asset's registered decimal places or the default
+func AssetPrecision(asset string) int {
+	precisionMu.RLock()
+	defer precisionMu.RUnlock()
+	if decimals, ok := assetPrecision[asset]; ok {
+		return decimals
+	}
+	return DefaultAssetDecimals
+}
+
+// Decimal serializes a float64 as a JSON string with a fixed number of
+// decimal places, e.g. "45000.00", so clients never see binary artifacts
+type Decimal struct {
+	Value  float64
+	Places int
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strconv.FormatFloat(d.Value, 'f', d.Places, 64) + `"`), nil
+}
+
+// flexFloat reads a number written either as a decimal string or, by older
+// writers such as cached entries from before a deploy, as a JSON number
+type flexFloat float64
+
+func (f *flexFloat) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "" || text == "null" {
+		*f = 0
+		return nil
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("invalid decimal %s: %w", data, err)
+	}
+	*f = flexFloat(value)
+	return nil
+}
+
+// DecimalFields are the JSON keys whose values are written as Decimal strings
+var DecimalFields = map[string]bool{
+	"price":           true,
+	"quantity":        true,
+	"stop_price":      true,
+	"filled_quantity": true,
+	"remaining_qty":   true,
+	"high_24h":        true,
+	"low_24h":         true,
+	"volume_24h":      true,
+	"Available":       true,
+	"Locked":          true,
+}
+
+// LegacyNumbers rewrites a JSON document so that every DecimalFields value
+// is a plain JSON number again, for clients that have not migrated to
+// decimal strings yet
+func LegacyNumbers(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(legacyValue(doc))
+}
+
+func legacyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if text, ok := field.(string); ok && DecimalFields[key] {
+				if _, err := strconv.ParseFloat(text, 64); err == nil {
+					v[key] = json.Number(text)
+					continue
+				}
+			}
+			v[key] = legacyValue(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = legacyValue(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidStep is returned for depth grouping steps that aren't positive
+var ErrInvalidStep = errors.New("invalid price step")
+
+// Depth is an order book with its levels grouped into price buckets. BestBid
+// and BestAsk are the ungrouped top of the book, 0 when a side is empty, so
+// the true spread is still known.
+type Depth struct {
+	Symbol    string           `json:"symbol"`
+	Step      float64          `json:"step"`
+	BestBid   float64          `json:"best_bid"`
+	BestAsk   float64          `json:"best_ask"`
+	Bids      []OrderBookLevel `json:"bids"`
+	Asks      []OrderBookLevel `json:"asks"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// GroupOrderBook sums a book's levels into buckets step wide and keeps the
+// best depth buckets of each side. Bids round down and asks round up to a
+// multiple of step, so a bucket never looks better than the orders in it;
+// step needn't be a multiple of the tick size.
+func GroupOrderBook(book *OrderBook, step float64, depth int) (*Depth, error) {
+	if !(step > 0) || math.IsInf(step, 0) {
+		return nil, fmt.Errorf("%w %v, want a positive number", ErrInvalidStep, step)
+	}
+
+	grouped := &Depth{Symbol: book.Symbol, Step: step, Timestamp: book.Timestamp}
+	for _, level := range book.Bids {
+		if level.Price > grouped.BestBid {
+			grouped.BestBid = level.Price
+		}
+	}
+	for _, level := range book.Asks {
+		if grouped.BestAsk == 0 || level.Price < grouped.BestAsk {
+			grouped.BestAsk = level.Price
+		}
+	}
+
+	grouped.Bids = groupLevels(book.Bids, step, true, depth)
+	grouped.Asks = groupLevels(book.Asks, step, false, depth)
+	return grouped, nil
+}
+
+// groupLevels buckets one side's levels by price rounded to step, best
+// first: bids rounded down and descending, asks rounded up and ascending
+func groupLevels(levels []OrderBookLevel, step float64, bids bool, depth int) []OrderBookLevel {
+	round := math.Ceil
+	if bids {
+		round = math.Floor
+	}
+	decimals := stepDecimals(step)
+	buckets := make(map[float64]*OrderBookLevel)
+	for _, level := range levels {
+		// Nudge prices already on a bucket edge so float error doesn't
+		// push them into the next one
+		steps := level.Price / step
+		if isStep(level.Price, step) {
+			steps = math.Round(steps)
+		}
+		price, _ := strconv.ParseFloat(strconv.FormatFloat(round(steps)*step, 'f', decimals, 64), 64)
+
+		bucket, ok := buckets[price]
+		if !ok {
+			bucket = &OrderBookLevel{Price: price}
+			buckets[price] = bucket
+		}
+		bucket.Quantity += level.Quantity
+		bucket.Orders += level.Orders
+	}
+
+	grouped := make([]OrderBookLevel, 0, len(buckets))
+	for _, bucket := range buckets {
+		grouped = append(grouped, *bucket)
+	}
+	sort.Slice(grouped, func(i, j int) bool {
+		if bids {
+			return grouped[i].Price > grouped[j].Price
+		}
+		return grouped[i].Price < grouped[j].Price
+	})
+	if len(grouped) > depth {
+		grouped = grouped[:depth]
+	}
+	return grouped
+}
@@ -0,0 +1,53 @@
+package domain
+
+import "time"
+
+// Liquidity roles a fill can take
+const (
+	LiquidityMaker = "MAKER"
+	LiquidityTaker = "TAKER"
+)
+
+// Fill is one execution of an order, seen from that order's side of the trade
+type Fill struct {
+	TradeID        string    `json:"trade_id"`
+	OrderID        string    `json:"order_id"`
+	Symbol         string    `json:"symbol"`
+	Side           OrderSide `json:"side"`
+	Price          float64   `json:"price"`
+	Quantity       float64   `json:"quantity"`
+	CounterOrderID string    `json:"counter_order_id"`
+	Liquidity      string    `json:"liquidity"`
+	ExecutedAt     time.Time `json:"executed_at"`
+}
+
+// FillOf describes trade as a fill of orderID, which must be its buy or
+// sell order
+func FillOf(trade *Trade, orderID string) Fill {
+	fill := Fill{
+		TradeID:        trade.ID,
+		OrderID:        orderID,
+		Symbol:         trade.Symbol,
+		Side:           OrderSideBuy,
+		Price:          trade.Price,
+		Quantity:       trade.Quantity,
+		CounterOrderID: trade.SellOrderID,
+		Liquidity:      LiquidityTaker,
+		ExecutedAt:     trade.ExecutedAt,
+	}
+	if trade.SellOrderID == orderID {
+		fill.Side = OrderSideSell
+		fill.CounterOrderID = trade.BuyOrderID
+	}
+	if trade.MakerOrderID == orderID {
+		fill.Liquidity = LiquidityMaker
+	}
+	return fill
+}
+
+// OrderFills is what an order has traded so far, summed over its trades:
+// the quantity filled and what it cost or raised in the quote asset
+type OrderFills struct {
+	Quantity float64
+	Notional float64
+}
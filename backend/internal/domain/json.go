@@ -0,0 +1,259 @@
+package domain
+
+import "encoding/json"
+
+// Prices and quantities are written as Decimal strings with the symbol's
+// precision. Each type shadows its float fields in an anonymous struct that
+// embeds the plain type, so every other field keeps its default encoding.
+
+func (o Order) MarshalJSON() ([]byte, error) {
+	type plain Order
+	precision := SymbolPrecision(o.Symbol)
+	out := struct {
+		plain
+		Quantity       Decimal  `json:"quantity"`
+		Price          Decimal  `json:"price"`
+		StopPrice      *Decimal `json:"stop_price,omitempty"`
+		FilledQuantity Decimal  `json:"filled_quantity"`
+		RemainingQty   Decimal  `json:"remaining_qty"`
+		Budget         *Decimal `json:"budget,omitempty"`
+	}{
+		plain:          plain(o),
+		Quantity:       Decimal{o.Quantity, precision.Quantity},
+		Price:          Decimal{o.Price, precision.Price},
+		FilledQuantity: Decimal{o.FilledQuantity, precision.Quantity},
+		RemainingQty:   Decimal{o.RemainingQty, precision.Quantity},
+	}
+	if o.StopPrice != 0 {
+		out.StopPrice = &Decimal{o.StopPrice, precision.Price}
+	}
+	if o.Budget != 0 {
+		out.Budget = &Decimal{o.Budget, precision.Price}
+	}
+	return json.Marshal(out)
+}
+
+func (o *Order) UnmarshalJSON(data []byte) error {
+	type plain Order
+	in := struct {
+		*plain
+		Quantity       flexFloat `json:"quantity"`
+		Price          flexFloat `json:"price"`
+		StopPrice      flexFloat `json:"stop_price"`
+		FilledQuantity flexFloat `json:"filled_quantity"`
+		RemainingQty   flexFloat `json:"remaining_qty"`
+		Budget         flexFloat `json:"budget"`
+	}{plain: (*plain)(o)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	o.Quantity = float64(in.Quantity)
+	o.Price = float64(in.Price)
+	o.StopPrice = float64(in.StopPrice)
+	o.FilledQuantity = float64(in.FilledQuantity)
+	o.RemainingQty = float64(in.RemainingQty)
+	o.Budget = float64(in.Budget)
+	return nil
+}
+
+func (t Trade) MarshalJSON() ([]byte, error) {
+	type plain Trade
+	precision := SymbolPrecision(t.Symbol)
+	return json.Marshal(struct {
+		plain
+		Price    Decimal `json:"price"`
+		Quantity Decimal `json:"quantity"`
+	}{
+		plain:    plain(t),
+		Price:    Decimal{t.Price, precision.Price},
+		Quantity: Decimal{t.Quantity, precision.Quantity},
+	})
+}
+
+// An average price is rarely on a tick, so it keeps averagePriceExtraPlaces
+// more decimals than the symbol's prices
+const averagePriceExtraPlaces = 4
+
+func (a AggregatedTrade) MarshalJSON() ([]byte, error) {
+	type plain AggregatedTrade
+	precision := SymbolPrecision(a.Symbol)
+	return json.Marshal(struct {
+		plain
+		Price    Decimal `json:"price"`
+		Quantity Decimal `json:"quantity"`
+	}{
+		plain:    plain(a),
+		Price:    Decimal{a.Price, precision.Price + averagePriceExtraPlaces},
+		Quantity: Decimal{a.Quantity, precision.Quantity},
+	})
+}
+
+func (t *Trade) UnmarshalJSON(data []byte) error {
+	type plain Trade
+	in := struct {
+		*plain
+		Price    flexFloat `json:"price"`
+		Quantity flexFloat `json:"quantity"`
+	}{plain: (*plain)(t)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	t.Price = float64(in.Price)
+	t.Quantity = float64(in.Quantity)
+	return nil
+}
+
+func (t Ticker) MarshalJSON() ([]byte, error) {
+	type plain Ticker
+	precision := SymbolPrecision(t.Symbol)
+	return json.Marshal(struct {
+		plain
+		Price     Decimal `json:"price"`
+		High24h   Decimal `json:"high_24h"`
+		Low24h    Decimal `json:"low_24h"`
+		Volume24h Decimal `json:"volume_24h"`
+	}{
+		plain:     plain(t),
+		Price:     Decimal{t.Price, precision.Price},
+		High24h:   Decimal{t.High24h, precision.Price},
+		Low24h:    Decimal{t.Low24h, precision.Price},
+		Volume24h: Decimal{t.Volume24h, precision.Quantity},
+	})
+}
+
+func (t *Ticker) UnmarshalJSON(data []byte) error {
+	type plain Ticker
+	in := struct {
+		*plain
+		Price     flexFloat `json:"price"`
+		High24h   flexFloat `json:"high_24h"`
+		Low24h    flexFloat `json:"low_24h"`
+		Volume24h flexFloat `json:"volume_24h"`
+	}{plain: (*plain)(t)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	t.Price = float64(in.Price)
+	t.High24h = float64(in.High24h)
+	t.Low24h = float64(in.Low24h)
+	t.Volume24h = float64(in.Volume24h)
+	return nil
+}
+
+// Book levels don't know their symbol, so the book formats them
+
+func (b OrderBook) MarshalJSON() ([]byte, error) {
+	type plain OrderBook
+	precision := SymbolPrecision(b.Symbol)
+	return json.Marshal(struct {
+		plain
+		Bids []bookLevelJSON `json:"bids"`
+		Asks []bookLevelJSON `json:"asks"`
+	}{
+		plain: plain(b),
+		Bids:  formatLevels(b.Bids, precision),
+		Asks:  formatLevels(b.Asks, precision),
+	})
+}
+
+func (d OrderBookDiff) MarshalJSON() ([]byte, error) {
+	type plain OrderBookDiff
+	precision := SymbolPrecision(d.Symbol)
+	return json.Marshal(struct {
+		plain
+		Bids []bookLevelJSON `json:"bids"`
+		Asks []bookLevelJSON `json:"asks"`
+	}{
+		plain: plain(d),
+		Bids:  formatLevels(d.Bids, precision),
+		Asks:  formatLevels(d.Asks, precision),
+	})
+}
+
+func (t BookTicker) MarshalJSON() ([]byte, error) {
+	type plain BookTicker
+	precision := SymbolPrecision(t.Symbol)
+	return json.Marshal(struct {
+		plain
+		BidPrice Decimal `json:"bid_price"`
+		BidQty   Decimal `json:"bid_qty"`
+		AskPrice Decimal `json:"ask_price"`
+		AskQty   Decimal `json:"ask_qty"`
+	}{
+		plain:    plain(t),
+		BidPrice: Decimal{t.BidPrice, precision.Price},
+		BidQty:   Decimal{t.BidQty, precision.Quantity},
+		AskPrice: Decimal{t.AskPrice, precision.Price},
+		AskQty:   Decimal{t.AskQty, precision.Quantity},
+	})
+}
+
+// Grouped prices may need more decimals than the symbol's tick size when the
+// step has more
+
+func (d Depth) MarshalJSON() ([]byte, error) {
+	type plain Depth
+	precision := SymbolPrecision(d.Symbol)
+	if decimals := stepDecimals(d.Step); decimals > precision.Price {
+		precision.Price = decimals
+	}
+	return json.Marshal(struct {
+		plain
+		BestBid Decimal         `json:"best_bid"`
+		BestAsk Decimal         `json:"best_ask"`
+		Bids    []bookLevelJSON `json:"bids"`
+		Asks    []bookLevelJSON `json:"asks"`
+	}{
+		plain:   plain(d),
+		BestBid: Decimal{d.BestBid, SymbolPrecision(d.Symbol).Price},
+		BestAsk: Decimal{d.BestAsk, SymbolPrecision(d.Symbol).Price},
+		Bids:    formatLevels(d.Bids, precision),
+		Asks:    formatLevels(d.Asks, precision),
+	})
+}
+
+type bookLevelJSON struct {
+	Price    Decimal `json:"price"`
+	Quantity Decimal `json:"quantity"`
+	Orders   int     `json:"orders"`
+}
+
+// MarshalBookLevel encodes one level as a book with the given precision
+// encodes its levels, for books written out a level at a time
+func MarshalBookLevel(level OrderBookLevel, precision Precision) ([]byte, error) {
+	return json.Marshal(bookLevelJSON{
+		Price:    Decimal{level.Price, precision.Price},
+		Quantity: Decimal{level.Quantity, precision.Quantity},
+		Orders:   level.Orders,
+	})
+}
+
+func formatLevels(levels []OrderBookLevel, precision Precision) []bookLevelJSON {
+	if levels == nil {
+		return nil
+	}
+	out := make([]bookLevelJSON, len(levels))
+	for i, level := range levels {
+		out[i] = bookLevelJSON{
+			Price:    Decimal{level.Price, precision.Price},
+			Quantity: Decimal{level.Quantity, precision.Quantity},
+			Orders:   level.Orders,
+		}
+	}
+	return out
+}
+
+func (l *OrderBookLevel) UnmarshalJSON(data []byte) error {
+	var in struct {
+		Price    flexFloat `json:"price"`
+		Quantity flexFloat `json:"quantity"`
+		Orders   int       `json:"orders"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	l.Price = float64(in.Price)
+	l.Quantity = float64(in.Quantity)
+	l.Orders = in.Orders
+	return nil
+}
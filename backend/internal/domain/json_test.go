@@ -0,0 +1,140 @@
+package domain_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files from the current output")
+
+// at is when every value below was taken, so the golden files don't change
+// from run to run
+var at = time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC)
+
+// A symbol with a precision of its own, next to BTC-USD on the defaults
+const custom = "GOLDEN-USD"
+
+func init() {
+	domain.SetSymbolPrecision(custom, domain.Precision{Price: 4, Quantity: 3})
+}
+
+// The JSON of every type with prices and quantities is pinned, so a change
+// to how they are written can't go out unnoticed. Values carry the binary
+// artifacts of float arithmetic, which must never reach clients. Run with
+// -update to accept a deliberate change.
+func TestJSONGolden(t *testing.T) {
+	book := domain.OrderBook{
+		Symbol:    "BTC-USD",
+		Bids:      []domain.OrderBookLevel{{Price: 44999.99, Quantity: 0.1 + 0.2, Orders: 2}, {Price: 44990, Quantity: 1e-8, Orders: 1}},
+		Asks:      []domain.OrderBookLevel{{Price: 45000.01, Quantity: 1.23456789, Orders: 1}},
+		Timestamp: at,
+		Seq:       42,
+	}
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"order", domain.Order{
+			ID: "order-1", UserID: "user-1", Symbol: "BTC-USD", Side: domain.OrderSideBuy, Type: domain.OrderTypeStopLimit,
+			Quantity: 0.3, Price: 45000.1 + 0.2, StopPrice: 44999.5, FilledQuantity: 0.1 + 0.2 - 0.2, RemainingQty: 0.3 - (0.1 + 0.2 - 0.2),
+			Status: domain.OrderStatusPartial, CreatedAt: at, UpdatedAt: at, TimeInForce: "GTC", Seq: 7,
+		}},
+		{"market_buy", domain.Order{
+			ID: "order-2", UserID: "user-1", Symbol: "BTC-USD", Side: domain.OrderSideBuy, Type: domain.OrderTypeMarket,
+			Quantity: 1, RemainingQty: 0, FilledQuantity: 1, Budget: 47250.000000001, Status: domain.OrderStatusCancelled,
+			CancelReason: domain.CancelReasonBudget, CreatedAt: at, UpdatedAt: at, TimeInForce: "GTC",
+		}},
+		{"order_custom_precision", domain.Order{
+			ID: "order-3", UserID: "user-2", Symbol: custom, Side: domain.OrderSideSell, Type: domain.OrderTypeLimit,
+			Quantity: 12.5, Price: 1.23456, RemainingQty: 12.5, Status: domain.OrderStatusPending, CreatedAt: at, UpdatedAt: at, TimeInForce: "GTC",
+		}},
+		{"trade", domain.Trade{
+			ID: "trade-1", Symbol: "BTC-USD", BuyOrderID: "order-1", SellOrderID: "order-4", BuyerID: "user-1", SellerID: "user-3",
+			Price: 45000.1 + 0.2, Quantity: 0.1 + 0.2, ExecutedAt: at, MakerOrderID: "order-4", TakerOrderID: "order-1", RequestID: "not published",
+		}},
+		{"aggregated_trade", domain.AggregatedTrade{
+			Symbol: "BTC-USD", TakerOrderID: "order-1", TakerSide: domain.OrderSideBuy, Price: 45000.123456789, Quantity: 0.3,
+			Trades: 3, FirstTradeID: "trade-1", LastTradeID: "trade-3", FirstExecutedAt: at, LastExecutedAt: at,
+		}},
+		{"ticker", domain.Ticker{
+			Symbol: "BTC-USD", Price: 45000.1 + 0.2, High24h: 46000, Low24h: 44000.005, Volume24h: 123.456789012, Change24h: 1.5, UpdatedAt: at,
+		}},
+		{"ticker_custom_precision", domain.Ticker{Symbol: custom, Price: 1.23456, High24h: 2, Low24h: 1, Volume24h: 1000.0005, UpdatedAt: at}},
+		{"order_book", book},
+		{"order_book_diff", domain.OrderBookDiff{
+			Symbol: "BTC-USD", Bids: []domain.OrderBookLevel{{Price: 44999.99, Quantity: 0, Orders: 0}}, Asks: []domain.OrderBookLevel{},
+			Timestamp: at, PrevSeq: 42, Seq: 43,
+		}},
+		{"book_ticker", domain.BookTicker{
+			Symbol: "BTC-USD", BidPrice: 44999.99, BidQty: 0.1 + 0.2, AskPrice: 45000.01, AskQty: 1.23456789, Timestamp: at, Seq: 42,
+		}},
+		{"depth", domain.Depth{
+			Symbol: "BTC-USD", Step: 0.5, BestBid: 44999.99, BestAsk: 45000.01,
+			Bids: []domain.OrderBookLevel{{Price: 44999.5, Quantity: 0.3, Orders: 2}}, Asks: []domain.OrderBookLevel{{Price: 45000.5, Quantity: 1.23456789, Orders: 1}},
+			Timestamp: at,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, test.name, data)
+
+			legacy, err := domain.LegacyNumbers(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, test.name+"_legacy", legacy)
+		})
+	}
+}
+
+// Books written a level at a time format their levels as whole books do
+func TestMarshalBookLevelMatchesBook(t *testing.T) {
+	level := domain.OrderBookLevel{Price: 44999.99, Quantity: 0.1 + 0.2, Orders: 2}
+	whole, err := json.Marshal(domain.OrderBook{Symbol: "BTC-USD", Bids: []domain.OrderBookLevel{level}, Asks: []domain.OrderBookLevel{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, err := domain.MarshalBookLevel(level, domain.SymbolPrecision("BTC-USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(whole, append(append([]byte(`"bids":[`), single...), ']')) {
+		t.Errorf("level written alone as %s, but in a book as %s", single, whole)
+	}
+}
+
+// golden compares data, indented, with testdata/name.json
+func golden(t *testing.T, name string, data []byte) {
+	t.Helper()
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	indented.WriteByte('\n')
+
+	path := filepath.Join("testdata", name+".json")
+	if *update {
+		if err := os.WriteFile(path, indented.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run with -update to create it", err)
+	}
+	if !bytes.Equal(indented.Bytes(), want) {
+		t.Errorf("%s changed; run with -update if that's intended\ngot:\n%s\nwant:\n%s", path, indented.Bytes(), want)
+	}
+}
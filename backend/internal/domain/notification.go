@@ -0,0 +1,42 @@
+package domain
+
+import "time"
+
+// NotificationSeverity is how much a notification needs the reader's
+// attention
+type NotificationSeverity string
+
+const (
+	SeverityInfo     NotificationSeverity = "info"
+	SeverityWarning  NotificationSeverity = "warning"
+	SeverityCritical NotificationSeverity = "critical"
+)
+
+// NotificationCategory is what a notification is about
+type NotificationCategory string
+
+const (
+	// CategoryTrading is trading pausing or resuming
+	CategoryTrading NotificationCategory = "trading"
+	// CategoryMaintenance is a pause with a scheduled end
+	CategoryMaintenance NotificationCategory = "maintenance"
+	// CategoryListing is a symbol being listed or delisted
+	CategoryListing NotificationCategory = "listing"
+	// CategoryOrder is one of a user's orders ended by the exchange rather
+	// than by its owner, after it was accepted
+	CategoryOrder NotificationCategory = "order"
+)
+
+// Notification is an operational notice for clients. System notifications,
+// without a UserID, go to everyone and the most recent are kept; a user's
+// own go only to that user.
+type Notification struct {
+	ID        string               `json:"id"`
+	UserID    string               `json:"user_id,omitempty"`
+	Symbol    string               `json:"symbol,omitempty"`
+	OrderID   string               `json:"order_id,omitempty"`
+	Category  NotificationCategory `json:"category"`
+	Severity  NotificationSeverity `json:"severity"`
+	Message   string               `json:"message"`
+	Timestamp time.Time            `json:"timestamp"`
+}
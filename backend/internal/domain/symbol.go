@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SymbolConfig describes a trading pair: which assets it exchanges and the
+// increments, minimums and fees its orders are held to
+type SymbolConfig struct {
+	Symbol      string  `json:"symbol"`
+	BaseAsset   string  `json:"base_asset"`
+	QuoteAsset  string  `json:"quote_asset"`
+	TickSize    float64 `json:"tick_size"`
+	LotSize     float64 `json:"lot_size"`
+	MinNotional float64 `json:"min_notional"`
+	MakerFeeBps float64 `json:"maker_fee_bps"`
+	TakerFeeBps float64 `json:"taker_fee_bps"`
+	// PriceBandPct is how far, in percent of the last price, a limit price may
+	// stray; zero disables the band
+	PriceBandPct float64 `json:"price_band_pct"`
+}
+
+// ErrInvalidSymbolConfig is returned for configs that cannot be traded on
+var ErrInvalidSymbolConfig = errors.New("invalid symbol config")
+
+// Validate checks that a config is complete enough to trade on
+func (c SymbolConfig) Validate() error {
+	switch {
+	case c.Symbol == "":
+		return fmt.Errorf("%w: no symbol", ErrInvalidSymbolConfig)
+	case c.BaseAsset == "" || c.QuoteAsset == "":
+		return fmt.Errorf("%w: %s needs both a base and a quote asset", ErrInvalidSymbolConfig, c.Symbol)
+	case c.TickSize <= 0 || c.LotSize <= 0:
+		return fmt.Errorf("%w: %s needs a positive tick size and lot size", ErrInvalidSymbolConfig, c.Symbol)
+	case c.MinNotional < 0 || c.PriceBandPct < 0:
+		return fmt.Errorf("%w: %s has a negative minimum notional or price band", ErrInvalidSymbolConfig, c.Symbol)
+	}
+	return nil
+}
+
+// PriceDecimals is the number of decimal places the tick size allows
+func (c SymbolConfig) PriceDecimals() int {
+	return stepDecimals(c.TickSize)
+}
+
+// RoundPrice rounds a price down to the tick size
+func (c SymbolConfig) RoundPrice(price float64) float64 {
+	return roundDown(price, c.TickSize)
+}
+
+// RoundQuantity rounds a quantity down to the lot size
+func (c SymbolConfig) RoundQuantity(quantity float64) float64 {
+	return roundDown(quantity, c.LotSize)
+}
+
+// IsPriceStep reports whether a price is a whole number of ticks
+func (c SymbolConfig) IsPriceStep(price float64) bool {
+	return isStep(price, c.TickSize)
+}
+
+// IsQuantityStep reports whether a quantity is a whole number of lots
+func (c SymbolConfig) IsQuantityStep(quantity float64) bool {
+	return isStep(quantity, c.LotSize)
+}
+
+// stepEpsilon absorbs float error when checking step multiples
+const stepEpsilon = 1e-9
+
+func isStep(value, step float64) bool {
+	steps := value / step
+	return math.Abs(steps-math.Round(steps)) <= stepEpsilon*math.Max(1, steps)
+}
+
+func roundDown(value, step float64) float64 {
+	steps := math.Floor(value/step + stepEpsilon)
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(steps*step, 'f', stepDecimals(step), 64), 64)
+	return rounded
+}
+
+func stepDecimals(step float64) int {
+	text := strconv.FormatFloat(step, 'f', -1, 64)
+	if i := strings.IndexByte(text, '.'); i >= 0 {
+		return len(text) - i - 1
+	}
+	return 0
+}
+
+// DefaultSymbolConfigs are the pairs a fresh exchange lists
+func DefaultSymbolConfigs() []SymbolConfig {
+	return []SymbolConfig{
+		{Symbol: "BTC-USD", BaseAsset: "BTC", QuoteAsset: "USD", TickSize: 0.01, LotSize: 0.0001, MinNotional: 1, MakerFeeBps: 10, TakerFeeBps: 20, PriceBandPct: 10},
+		{Symbol: "ETH-USD", BaseAsset: "ETH", QuoteAsset: "USD", TickSize: 0.01, LotSize: 0.001, MinNotional: 1, MakerFeeBps: 10, TakerFeeBps: 20, PriceBandPct: 10},
+		{Symbol: "SOL-USD", BaseAsset: "SOL", QuoteAsset: "USD", TickSize: 0.01, LotSize: 0.01, MinNotional: 1, MakerFeeBps: 10, TakerFeeBps: 20, PriceBandPct: 10},
+		{Symbol: "USDC-USD", BaseAsset: "USDC", QuoteAsset: "USD", TickSize: 0.0001, LotSize: 0.01, MinNotional: 1, MakerFeeBps: 0, TakerFeeBps: 5, PriceBandPct: 2},
+	}
+}
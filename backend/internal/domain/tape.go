@@ -0,0 +1,56 @@
+package domain
+
+import "time"
+
+// AggregatedTrade is one print of an aggregated trade tape: the consecutive
+// trades of a single taker order, such as a sweep through several levels,
+// summed into one. Price is their volume-weighted average.
+type AggregatedTrade struct {
+	Symbol          string    `json:"symbol"`
+	TakerOrderID    string    `json:"taker_order_id"`
+	TakerSide       OrderSide `json:"taker_side"`
+	Price           float64   `json:"price"`
+	Quantity        float64   `json:"quantity"`
+	Trades          int       `json:"trades"`
+	FirstTradeID    string    `json:"first_trade_id"`
+	LastTradeID     string    `json:"last_trade_id"`
+	FirstExecutedAt time.Time `json:"first_executed_at"`
+	LastExecutedAt  time.Time `json:"last_executed_at"`
+}
+
+// AppendAggregatedTrades adds trades, newest first as the tape lists them,
+// to prints. Trades carry on the last print while its taker order is
+// unchanged, so a tape read in several pieces aggregates as if read at once.
+// Trades without a taker order, from before takers were recorded, stay
+// prints of their own.
+func AppendAggregatedTrades(prints []*AggregatedTrade, trades []*Trade) []*AggregatedTrade {
+	for _, trade := range trades {
+		if n := len(prints); n > 0 && trade.TakerOrderID != "" && prints[n-1].TakerOrderID == trade.TakerOrderID {
+			last := prints[n-1]
+			notional := last.Price*last.Quantity + trade.Price*trade.Quantity
+			last.Quantity += trade.Quantity
+			last.Price = notional / last.Quantity
+			last.Trades++
+			last.FirstTradeID, last.FirstExecutedAt = trade.ID, trade.ExecutedAt
+			continue
+		}
+
+		side := OrderSideSell
+		if trade.TakerOrderID == trade.BuyOrderID {
+			side = OrderSideBuy
+		}
+		prints = append(prints, &AggregatedTrade{
+			Symbol:          trade.Symbol,
+			TakerOrderID:    trade.TakerOrderID,
+			TakerSide:       side,
+			Price:           trade.Price,
+			Quantity:        trade.Quantity,
+			Trades:          1,
+			FirstTradeID:    trade.ID,
+			LastTradeID:     trade.ID,
+			FirstExecutedAt: trade.ExecutedAt,
+			LastExecutedAt:  trade.ExecutedAt,
+		})
+	}
+	return prints
+}
@@ -29,6 +29,23 @@ const (
 	OrderStatusRejected  OrderStatus = "REJECTED"
 )
 
+// Why the exchange, rather than the order's owner, cancelled an order
+const (
+	CancelReasonAdmin    = "ADMIN"
+	CancelReasonDelisted = "DELISTED"
+	// CancelReasonStale is for GTC orders left untouched past the stale
+	// order policy's age
+	CancelReasonStale    = "STALE_CANCEL"
+	// CancelReasonPurged is for orders an operator force-removed from the book
+	CancelReasonPurged   = "PURGED"
+	// CancelReasonBudget is for the part of a market buy its locked funds
+	// couldn't pay for
+	CancelReasonBudget   = "BUDGET_EXHAUSTED"
+	// CancelReasonInterrupted is for market orders the exchange stopped
+	// part way through matching, found still open when it restarted
+	CancelReasonInterrupted = "INTERRUPTED"
+)
+
 type Order struct {
 	ID              string      `json:"id"`
 	UserID          string      `json:"user_id"`
@@ -44,6 +61,17 @@ type Order struct {
 	CreatedAt       time.Time   `json:"created_at"`
 	UpdatedAt       time.Time   `json:"updated_at"`
 	TimeInForce     string      `json:"time_in_force"` // GTC, IOC, FOK
+	// CancelReason is set on cancellations the owner didn't request
+	CancelReason    string      `json:"cancel_reason,omitempty"`
+	// Seq is the engine sequence number of the update this state is from
+	Seq             uint64      `json:"seq,omitempty"`
+	// UserSeq numbers the owner's order changes across every symbol
+	UserSeq         uint64      `json:"user_seq,omitempty"`
+	// RequestID is the ID of the HTTP request that placed the order
+	RequestID       string      `json:"request_id,omitempty"`
+	// Budget is the most a market buy may spend, in the quote asset: the
+	// funds locked for it. It stops filling once they are spent.
+	Budget          float64     `json:"budget,omitempty"`
 }
 
 type Trade struct {
@@ -58,13 +86,48 @@ type Trade struct {
 	ExecutedAt   time.Time `json:"executed_at"`
 	MakerOrderID string    `json:"maker_order_id"`
 	TakerOrderID string    `json:"taker_order_id"`
+	// RequestID is the taker's request, for tagging logs; it isn't published
+	RequestID    string    `json:"-"`
 }
 
+// UserKind tells people apart from the exchange's own accounts
+type UserKind string
+
+const (
+	// UserKindUser is a person who registered or was seeded for the demo
+	UserKindUser UserKind = "user"
+	// UserKindBot is an account a bot trades from, like the market maker
+	UserKindBot UserKind = "bot"
+	// UserKindSystem is an account the exchange itself holds funds in
+	UserKindSystem UserKind = "system"
+)
+
 type User struct {
 	ID        string    `json:"id"`
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
+	Kind      UserKind  `json:"kind"`
 	CreatedAt time.Time `json:"created_at"`
+	// DisabledAt is when an admin stopped the user placing orders
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	// VerifiedAt is when an admin verified the user
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+}
+
+// AssetAmount is a quantity of one asset
+type AssetAmount struct {
+	Asset  string
+	Amount float64
+}
+
+// StarterBalances are credited to every new account, seeded or registered
+var StarterBalances = []AssetAmount{
+	{"USD", 100000.0},
+	{"BTC", 1.0},
+	{"ETH", 10.0},
+	{"SOL", 100.0},
+	{"USDC", 50000.0},
 }
 
 type Portfolio struct {
@@ -81,6 +144,7 @@ type Position struct {
 	CurrentPrice   float64 `json:"current_price"`
 	UnrealizedPnL  float64 `json:"unrealized_pnl"`
 	RealizedPnL    float64 `json:"realized_pnl"`
+	UpdatedAt      time.Time `json:"updated_at"`
 }
 
 type Ticker struct {
@@ -98,6 +162,34 @@ type OrderBook struct {
 	Bids      []OrderBookLevel `json:"bids"`
 	Asks      []OrderBookLevel `json:"asks"`
 	Timestamp time.Time        `json:"timestamp"`
+	// Seq is the engine's order update sequence when the book was taken; it
+	// changes exactly when the book does
+	Seq uint64 `json:"seq"`
+}
+
+// OrderBookDiff is how a streamed book's top levels changed from PrevSeq to
+// Seq: each changed level with its new quantity, or quantity 0 where the
+// level went
+type OrderBookDiff struct {
+	Symbol    string           `json:"symbol"`
+	Bids      []OrderBookLevel `json:"bids"`
+	Asks      []OrderBookLevel `json:"asks"`
+	Timestamp time.Time        `json:"timestamp"`
+	PrevSeq   uint64           `json:"prev_seq"`
+	Seq       uint64           `json:"seq"`
+}
+
+// BookTicker is the best bid and ask of a book and the quantity resting at
+// each, 0 for an empty side. Seq is the book's sequence when it was taken,
+// as on OrderBook.
+type BookTicker struct {
+	Symbol    string    `json:"symbol"`
+	BidPrice  float64   `json:"bid_price"`
+	BidQty    float64   `json:"bid_qty"`
+	AskPrice  float64   `json:"ask_price"`
+	AskQty    float64   `json:"ask_qty"`
+	Timestamp time.Time `json:"timestamp"`
+	Seq       uint64    `json:"seq"`
 }
 
 type OrderBookLevel struct {
@@ -106,10 +198,17 @@ type OrderBookLevel struct {
 	Orders   int     `json:"orders"`
 }
 
+// Now and NewID supply timestamps and identifiers for new orders and trades.
+// Simulations replace them with a virtual clock and a seeded generator.
+var (
+	Now   = time.Now
+	NewID = func() string { return uuid.New().String() }
+)
+
 func NewOrder(userID, symbol string, side OrderSide, orderType OrderType, quantity, price float64) *Order {
-	now := time.Now()
+	now := Now()
 	return &Order{
-		ID:             uuid.New().String(),
+		ID:             NewID(),
 		UserID:         userID,
 		Symbol:         symbol,
 		Side:           side,
@@ -125,9 +224,11 @@ func NewOrder(userID, symbol string, side OrderSide, orderType OrderType, quanti
 	}
 }
 
+// NewTrade stamps the trade in UTC to the microsecond, the precision every
+// database keeps, so it reads back from storage exactly as it was broadcast
 func NewTrade(symbol, buyOrderID, sellOrderID, buyerID, sellerID string, price, quantity float64, makerOrderID, takerOrderID string) *Trade {
 	return &Trade{
-		ID:           uuid.New().String(),
+		ID:           NewID(),
 		Symbol:       symbol,
 		BuyOrderID:   buyOrderID,
 		SellOrderID:  sellOrderID,
@@ -135,8 +236,150 @@ func NewTrade(symbol, buyOrderID, sellOrderID, buyerID, sellerID string, price,
 		SellerID:     sellerID,
 		Price:        price,
 		Quantity:     quantity,
-		ExecutedAt:   time.Now(),
+		ExecutedAt:   Now().UTC().Truncate(time.Microsecond),
 		MakerOrderID: makerOrderID,
 		TakerOrderID: takerOrderID,
 	}
 }
+
+// positionEpsilon treats float drift around a flat position as flat
+const positionEpsilon = 1e-9
+
+// ApplyFill adds a signed fill (positive buys, negative sells) to the
+// position. Increases move the average entry price; decreases realize PnL
+// against it. A fill that crosses zero is split into the part that closes
+// the old position and the part that opens a new one at the fill price.
+func (p *Position) ApplyFill(quantity, price float64) {
+	if quantity == 0 {
+		return
+	}
+
+	if p.Quantity == 0 || (p.Quantity > 0) == (quantity > 0) {
+		size := abs(p.Quantity) + abs(quantity)
+		p.AvgEntryPrice = (abs(p.Quantity)*p.AvgEntryPrice + abs(quantity)*price) / size
+		p.Quantity += quantity
+		return
+	}
+
+	closing := abs(quantity)
+	if closing > abs(p.Quantity) {
+		closing = abs(p.Quantity)
+	}
+	direction := 1.0
+	if p.Quantity < 0 {
+		direction = -1.0
+	}
+	p.RealizedPnL += closing * (price - p.AvgEntryPrice) * direction
+
+	opening := abs(quantity) - closing
+	switch {
+	case opening > positionEpsilon:
+		p.Quantity = -direction * opening
+		p.AvgEntryPrice = price
+	case abs(p.Quantity)-closing <= positionEpsilon:
+		p.Quantity = 0
+		p.AvgEntryPrice = 0
+	default:
+		p.Quantity += quantity
+	}
+}
+
+// MarkToMarket sets the current price and the unrealized PnL it implies
+func (p *Position) MarkToMarket(price float64) {
+	p.CurrentPrice = price
+	p.UnrealizedPnL = (price - p.AvgEntryPrice) * p.Quantity
+}
+
+// RealizedPnLSince replays a user's trades, oldest first, through positions
+// opened flat and returns the PnL each symbol realized in trades executed at
+// or after from. Earlier trades only set the entry prices that later ones
+// close against, so the trades must reach back to the user's first.
+func RealizedPnLSince(userID string, trades []*Trade, from time.Time) map[string]float64 {
+	positions := make(map[string]*Position)
+	realized := make(map[string]float64)
+	for _, trade := range trades {
+		position, ok := positions[trade.Symbol]
+		if !ok {
+			position = &Position{UserID: userID, Symbol: trade.Symbol}
+			positions[trade.Symbol] = position
+		}
+
+		before := position.RealizedPnL
+		if trade.BuyerID == userID {
+			position.ApplyFill(trade.Quantity, trade.Price)
+		}
+		if trade.SellerID == userID {
+			position.ApplyFill(-trade.Quantity, trade.Price)
+		}
+		if !trade.ExecutedAt.Before(from) {
+			realized[trade.Symbol] += position.RealizedPnL - before
+		}
+	}
+	return realized
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Candle is the OHLCV summary of a symbol's trades over one bucket
+type Candle struct {
+	Symbol      string    `json:"symbol"`
+	Resolution  string    `json:"resolution"`
+	BucketStart time.Time `json:"bucket_start"`
+	Open        float64   `json:"open"`
+	High        float64   `json:"high"`
+	Low         float64   `json:"low"`
+	Close       float64   `json:"close"`
+	Volume      float64   `json:"volume"`
+	VWAP        float64   `json:"vwap"`
+	TradeCount  int       `json:"trade_count"`
+	Dirty       bool      `json:"dirty"`
+	// Closed is set on klines whose interval has ended; the last kline of a
+	// range reaching the present is still forming
+	Closed bool `json:"closed"`
+}
+
+// AddTrade folds a trade into the candle; trades must arrive in time order
+func (c *Candle) AddTrade(price, quantity float64) {
+	if c.TradeCount == 0 {
+		c.Open, c.High, c.Low = price, price, price
+	}
+	if price > c.High {
+		c.High = price
+	}
+	if price < c.Low {
+		c.Low = price
+	}
+	c.Close = price
+	if volume := c.Volume + quantity; volume > 0 {
+		c.VWAP = (c.VWAP*c.Volume + price*quantity) / volume
+	}
+	c.Volume += quantity
+	c.TradeCount++
+}
+
+// Merge folds a later, finer-grained candle into this one
+func (c *Candle) Merge(other *Candle) {
+	if other.TradeCount == 0 {
+		return
+	}
+	if c.TradeCount == 0 {
+		c.Open, c.High, c.Low = other.Open, other.High, other.Low
+	}
+	if other.High > c.High {
+		c.High = other.High
+	}
+	if other.Low < c.Low {
+		c.Low = other.Low
+	}
+	c.Close = other.Close
+	if volume := c.Volume + other.Volume; volume > 0 {
+		c.VWAP = (c.VWAP*c.Volume + other.VWAP*other.Volume) / volume
+	}
+	c.Volume += other.Volume
+	c.TradeCount += other.TradeCount
+}
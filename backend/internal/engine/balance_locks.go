@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// marketBuyLockBuffer over-reserves quote funds for market buys, whose final
+// cost is unknown until they walk the book
+const marketBuyLockBuffer = 1.05
+
+var (
+	// ErrInsufficientBalance is returned when an order's funds cannot be locked
+	ErrInsufficientBalance = errors.New("insufficient_balance")
+	// ErrNoReferencePrice is returned for market buys before any price is known
+	ErrNoReferencePrice = errors.New("no reference price available for market order")
+)
+
+// reservation tracks the funds still locked on behalf of a live order
+type reservation struct {
+	userID string
+	symbol string
+	asset  string
+	amount float64
+	// ended is set once the order can no longer fill; the reservation is
+	// kept only until its remainder is unlocked
+	ended bool
+}
+
+// pendingUnlock is an ended order whose remaining reservation failed to
+// unlock and is retried alongside pending settlements
+type pendingUnlock struct {
+	orderID       string
+	attempts      int
+	nextAttemptAt time.Time
+}
+
+// requiredLock returns the asset and amount an order must lock before it can
+// reach the engine: quote funds for buys, base quantity for sells
+func (ex *Exchange) requiredLock(order *domain.Order) (string, float64, error) {
+	baseAsset, quoteAsset, err := ex.symbolAssets(order.Symbol)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if order.Side == domain.OrderSideSell {
+		return baseAsset, order.Quantity, nil
+	}
+
+	if order.Type == domain.OrderTypeMarket {
+		price := ex.lastPrice(order.Symbol)
+		if price <= 0 {
+			return "", 0, ErrNoReferencePrice
+		}
+		return quoteAsset, order.Quantity * price * marketBuyLockBuffer, nil
+	}
+
+	return quoteAsset, order.Quantity * order.Price, nil
+}
+
+// lockFunds reserves the balance an order needs and remembers the reservation
+func (ex *Exchange) lockFunds(ctx context.Context, order *domain.Order) (reservation, error) {
+	asset, amount, err := ex.requiredLock(order)
+	if err != nil {
+		return reservation{}, err
+	}
+
+	if err := ex.balanceStore.LockBalance(ctx, order.UserID, asset, amount); err != nil {
+		if errors.Is(err, ErrInsufficientBalance) {
+			return reservation{}, fmt.Errorf("%w: need %.8f %s", ErrInsufficientBalance, amount, asset)
+		}
+		return reservation{}, err
+	}
+
+	if order.Type == domain.OrderTypeMarket && order.Side == domain.OrderSideBuy {
+		// The engine stops the buy when what was locked is spent, so a
+		// book thinner than the buffer allows can't overdraw it
+		order.Budget = amount
+	}
+	res := reservation{userID: order.UserID, symbol: order.Symbol, asset: asset, amount: amount}
+	ex.resMu.Lock()
+	ex.reservations[order.ID] = &res
+	ex.resMu.Unlock()
+
+	ex.notifyBalances(order.UserID, BalanceCauseLock, asset)
+	return res, nil
+}
+
+// consumeReservation reduces an order's reservation by funds spent on a fill
+func (ex *Exchange) consumeReservation(orderID string, amount float64) {
+	ex.resMu.Lock()
+	defer ex.resMu.Unlock()
+
+	if res, ok := ex.reservations[orderID]; ok {
+		res.amount -= amount
+		if res.amount < 0 {
+			res.amount = 0
+		}
+	}
+}
+
+// releaseReservation unlocks whatever an order still has reserved. If the
+// unlock fails, the reservation is kept and the unlock is retried until it
+// succeeds, so the funds aren't left locked.
+func (ex *Exchange) releaseReservation(orderID string) error {
+	err := ex.unlockReservation(orderID)
+	if err != nil {
+		ex.settleMu.Lock()
+		ex.pendingUnlocks = append(ex.pendingUnlocks, &pendingUnlock{
+			orderID:       orderID,
+			attempts:      1,
+			nextAttemptAt: ex.clock.Now().Add(settlementBackoff(1)),
+		})
+		ex.settleMu.Unlock()
+	}
+	return err
+}
+
+// unlockReservation returns an ended order's reservation to its owner and
+// forgets it once the balance store has unlocked it
+func (ex *Exchange) unlockReservation(orderID string) error {
+	ex.resMu.Lock()
+	res, ok := ex.reservations[orderID]
+	var held reservation
+	if ok {
+		res.ended = true
+		held = *res
+	}
+	ex.resMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if held.amount > 0 {
+		if err := ex.balanceStore.UnlockBalance(ex.background(), held.userID, held.asset, held.amount); err != nil {
+			return err
+		}
+	}
+	ex.resMu.Lock()
+	delete(ex.reservations, orderID)
+	ex.resMu.Unlock()
+
+	if held.amount > 0 {
+		ex.notifyBalances(held.userID, BalanceCauseCancelUnlock, held.asset)
+	}
+	return nil
+}
+
+// retryPendingUnlocks attempts the due unlocks, or all of them when force is
+// set, and returns how many are still pending. It must be called with
+// drainMu held, like retryPendingSettlements.
+func (ex *Exchange) retryPendingUnlocks(force bool) int {
+	now := ex.clock.Now()
+	ex.settleMu.Lock()
+	due := make([]*pendingUnlock, 0, len(ex.pendingUnlocks))
+	for _, pending := range ex.pendingUnlocks {
+		if force || !now.Before(pending.nextAttemptAt) {
+			due = append(due, pending)
+		}
+	}
+	ex.settleMu.Unlock()
+
+	for _, pending := range due {
+		err := ex.unlockReservation(pending.orderID)
+		ex.settleMu.Lock()
+		if err == nil {
+			for i, queued := range ex.pendingUnlocks {
+				if queued == pending {
+					ex.pendingUnlocks = append(ex.pendingUnlocks[:i], ex.pendingUnlocks[i+1:]...)
+					break
+				}
+			}
+		} else {
+			pending.attempts++
+			pending.nextAttemptAt = now.Add(settlementBackoff(pending.attempts))
+		}
+		ex.settleMu.Unlock()
+		if err == nil {
+			log.Printf("Released lock for order %s after %d attempts", pending.orderID, pending.attempts+1)
+		} else {
+			log.Printf("Retry %d of releasing lock for order %s failed: %v", pending.attempts, pending.orderID, err)
+		}
+	}
+
+	ex.settleMu.Lock()
+	defer ex.settleMu.Unlock()
+	return len(ex.pendingUnlocks)
+}
+
+// lastPrice returns the most recent reference price seen for a symbol
+func (ex *Exchange) lastPrice(symbol string) float64 {
+	ex.priceMu.RLock()
+	defer ex.priceMu.RUnlock()
+	return ex.lastPrices[symbol]
+}
+
+// isTerminal reports whether an order in this status can no longer fill
+func isTerminal(status domain.OrderStatus) bool {
+	switch status {
+	case domain.OrderStatusFilled, domain.OrderStatusCancelled, domain.OrderStatusRejected:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// A market buy walking a thin book stops when the funds locked for it run
+// out, rather than spending more than it reserved
+func TestMarketBuyStopsAtLockedFunds(t *testing.T) {
+	ex := newTestExchange(t)
+	ex.store.Deposit("maker", "BTC", 10)
+	ex.store.Deposit("taker", "USD", 100000)
+
+	ex.rest(t, "maker", domain.OrderSideSell, 0.1, referencePrice)
+	ex.rest(t, "maker", domain.OrderSideSell, 1, referencePrice*1.1)
+
+	// 1 BTC locks 1.05 × 45000 = 47250 USD, but filling it from this book
+	// would cost 4500 + 0.9 × 49500 = 49050
+	buy := ex.submit(t, "taker", domain.OrderSideBuy, domain.OrderTypeMarket, 1, 0)
+	final := ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusCancelled })
+	if final.CancelReason != domain.CancelReasonBudget {
+		t.Errorf("cancel reason = %q, want %q", final.CancelReason, domain.CancelReasonBudget)
+	}
+	if final.FilledQuantity <= 0.1 || final.FilledQuantity >= 1 {
+		t.Errorf("filled %g, want more than the first level and less than the order", final.FilledQuantity)
+	}
+
+	ex.eventually(t, "the buy's funds to be released", func() bool {
+		_, locked, _ := ex.store.GetBalance(context.Background(), "taker", "USD")
+		return locked == 0
+	})
+	spent := 0.0
+	for _, trade := range ex.store.Trades() {
+		if trade.BuyOrderID == buy.ID {
+			spent += trade.Price * trade.Quantity
+		}
+	}
+	if spent > 47250+1e-8 {
+		t.Errorf("spent %.8f USD, more than the 47250 locked", spent)
+	}
+	available, _, _ := ex.store.GetBalance(context.Background(), "taker", "USD")
+	if diff := available - (100000 - spent); diff > 1e-6 || diff < -1e-6 {
+		t.Errorf("available = %.8f, want %.8f", available, 100000-spent)
+	}
+}
+
+// A market buy the book can cover within its locked funds fills completely
+func TestMarketBuyWithinLockedFundsFills(t *testing.T) {
+	ex := newTestExchange(t)
+	ex.store.Deposit("maker", "BTC", 10)
+	ex.store.Deposit("taker", "USD", 100000)
+
+	ex.rest(t, "maker", domain.OrderSideSell, 1, referencePrice)
+	buy := ex.submit(t, "taker", domain.OrderSideBuy, domain.OrderTypeMarket, 0.5, 0)
+	final := ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+	if final.FilledQuantity != 0.5 {
+		t.Errorf("filled %g, want 0.5", final.FilledQuantity)
+	}
+	ex.eventually(t, "the buy's funds to be released", func() bool {
+		available, locked, _ := ex.store.GetBalance(context.Background(), "taker", "USD")
+		return locked == 0 && available == 100000-0.5*referencePrice
+	})
+}
+
+// balance is what a user holds of one asset
+type balance struct {
+	userID, asset     string
+	available, locked float64
+}
+
+// Every path that ends or shrinks an order releases exactly what it no
+// longer needs, so each user's available and locked funds add up to what
+// they deposited plus what they traded
+func TestLockedFundsAreReleased(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, ex *testExchange)
+		want []balance
+	}{
+		{
+			name: "cancelled buy",
+			run: func(t *testing.T, ex *testExchange) {
+				ex.cancel(t, ex.rest(t, "buyer", domain.OrderSideBuy, 1, referencePrice))
+			},
+			want: []balance{{"buyer", "USD", 100000, 0}},
+		},
+		{
+			name: "cancelled sell",
+			run: func(t *testing.T, ex *testExchange) {
+				ex.cancel(t, ex.rest(t, "seller", domain.OrderSideSell, 1, referencePrice))
+			},
+			want: []balance{{"seller", "BTC", 10, 0}},
+		},
+		{
+			name: "partially filled buy",
+			run: func(t *testing.T, ex *testExchange) {
+				ex.rest(t, "buyer", domain.OrderSideBuy, 1, referencePrice)
+				sell := ex.submit(t, "seller", domain.OrderSideSell, domain.OrderTypeLimit, 0.4, referencePrice)
+				ex.waitFor(t, sell.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+			},
+			want: []balance{
+				{"buyer", "USD", 100000 - referencePrice, 0.6 * referencePrice},
+				{"buyer", "BTC", 0.4, 0},
+				{"seller", "USD", 100000 + 0.4*referencePrice, 0},
+				{"seller", "BTC", 9.6, 0},
+			},
+		},
+		{
+			name: "partially filled buy then cancelled",
+			run: func(t *testing.T, ex *testExchange) {
+				buy := ex.rest(t, "buyer", domain.OrderSideBuy, 1, referencePrice)
+				sell := ex.submit(t, "seller", domain.OrderSideSell, domain.OrderTypeLimit, 0.4, referencePrice)
+				ex.waitFor(t, sell.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+				ex.cancel(t, buy)
+			},
+			want: []balance{
+				{"buyer", "USD", 100000 - 0.4*referencePrice, 0},
+				{"buyer", "BTC", 0.4, 0},
+			},
+		},
+		{
+			name: "buy filled below its limit",
+			run: func(t *testing.T, ex *testExchange) {
+				ex.rest(t, "seller", domain.OrderSideSell, 1, referencePrice-100)
+				buy := ex.submit(t, "buyer", domain.OrderSideBuy, domain.OrderTypeLimit, 1, referencePrice)
+				ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+			},
+			want: []balance{
+				{"buyer", "USD", 100000 - (referencePrice - 100), 0},
+				{"buyer", "BTC", 1, 0},
+				{"seller", "BTC", 9, 0},
+			},
+		},
+		{
+			name: "market sell remainder",
+			run: func(t *testing.T, ex *testExchange) {
+				ex.rest(t, "buyer", domain.OrderSideBuy, 0.3, referencePrice)
+				sell := ex.submit(t, "seller", domain.OrderSideSell, domain.OrderTypeMarket, 1, 0)
+				ex.waitFor(t, sell.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusCancelled })
+			},
+			want: []balance{
+				{"seller", "BTC", 9.7, 0},
+				{"seller", "USD", 100000 + 0.3*referencePrice, 0},
+				{"buyer", "BTC", 0.3, 0},
+			},
+		},
+		{
+			name: "market buy remainder",
+			run: func(t *testing.T, ex *testExchange) {
+				ex.rest(t, "seller", domain.OrderSideSell, 0.3, referencePrice)
+				buy := ex.submit(t, "buyer", domain.OrderSideBuy, domain.OrderTypeMarket, 1, 0)
+				ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusCancelled })
+			},
+			want: []balance{
+				{"buyer", "USD", 100000 - 0.3*referencePrice, 0},
+				{"buyer", "BTC", 0.3, 0},
+				{"seller", "BTC", 9.7, 0},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ex := newTestExchange(t)
+			for _, user := range []string{"buyer", "seller"} {
+				ex.store.Deposit(user, "USD", 100000)
+			}
+			ex.store.Deposit("seller", "BTC", 10)
+
+			test.run(t, ex)
+			for _, want := range test.want {
+				ex.eventually(t, fmt.Sprintf("%s's %s to settle", want.userID, want.asset), func() bool {
+					available, locked, _ := ex.store.GetBalance(context.Background(), want.userID, want.asset)
+					return math.Abs(available-want.available) < 1e-6 && math.Abs(locked-want.locked) < 1e-6
+				})
+			}
+			// Funds only change hands: the two users' totals are conserved
+			var usd, btc float64
+			for _, user := range []string{"buyer", "seller"} {
+				available, locked, _ := ex.store.GetBalance(context.Background(), user, "USD")
+				usd += available + locked
+				available, locked, _ = ex.store.GetBalance(context.Background(), user, "BTC")
+				btc += available + locked
+			}
+			if math.Abs(usd-200000) > 1e-6 || math.Abs(btc-10) > 1e-9 {
+				t.Errorf("users hold %.8f USD and %.8f BTC in all, want 200000 and 10", usd, btc)
+			}
+		})
+	}
+}
+
+// A cancelled order whose unlock fails keeps its reservation and is retried
+// until its funds are released, rather than leaving them locked
+func TestFailedUnlockIsRetried(t *testing.T) {
+	var failures atomic.Int32
+	ex := newTestExchange(t)
+	ex.store.Deposit("taker", "USD", 100000)
+	buy := ex.rest(t, "taker", domain.OrderSideBuy, 1, referencePrice-1000)
+
+	failures.Store(1)
+	ex.store.BeforeUnlock = func(userID, asset string) error {
+		if failures.Add(-1) >= 0 {
+			return errors.New("database unavailable")
+		}
+		return nil
+	}
+	if err := ex.CancelOrder(context.Background(), buy.ID, buy.Symbol, buy.UserID); err != nil {
+		t.Fatal(err)
+	}
+	ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusCancelled })
+	ex.eventually(t, "the unlock to be queued", func() bool { return ex.SettlementStats().PendingUnlocks == 1 })
+	if _, locked, _ := ex.store.GetBalance(context.Background(), "taker", "USD"); locked != 44000 {
+		t.Errorf("locked after the failed unlock = %g, want 44000", locked)
+	}
+
+	ex.eventually(t, "the unlock to be retried", func() bool { return ex.SettlementStats().PendingUnlocks == 0 })
+	available, locked, _ := ex.store.GetBalance(context.Background(), "taker", "USD")
+	if available != 100000 || locked != 0 {
+		t.Errorf("balance after the retry = %g available, %g locked, want 100000 and 0", available, locked)
+	}
+	if n := failures.Load(); n != -1 {
+		t.Errorf("%d unlocks after the failure, want 1", -1-n)
+	}
+}
@@ -0,0 +1,53 @@
+package engine
+
+import "log"
+
+// Causes reported with a balance update
+const (
+	BalanceCauseTrade        = "trade"
+	BalanceCauseLock         = "lock"
+	BalanceCauseCancelUnlock = "cancel_unlock"
+)
+
+// AssetBalance is one asset's balance after a change
+type AssetBalance struct {
+	Asset     string  `json:"asset"`
+	Available float64 `json:"available"`
+	Locked    float64 `json:"locked"`
+}
+
+// BalanceUpdate reports every asset of a user that one operation changed
+type BalanceUpdate struct {
+	UserID   string         `json:"user_id"`
+	Cause    string         `json:"cause"`
+	Balances []AssetBalance `json:"balances"`
+}
+
+// SetOnBalanceUpdateCallback sets the callback to be called after a trade
+// settles and after funds are locked for or released from an order
+func (ex *Exchange) SetOnBalanceUpdateCallback(callback func(*BalanceUpdate)) {
+	ex.onBalance = callback
+}
+
+// notifyBalances reports the current balances of a user's assets as a single
+// update
+func (ex *Exchange) notifyBalances(userID, cause string, assets ...string) {
+	if ex.onBalance == nil {
+		return
+	}
+
+	update := &BalanceUpdate{
+		UserID:   userID,
+		Cause:    cause,
+		Balances: make([]AssetBalance, 0, len(assets)),
+	}
+	for _, asset := range assets {
+		available, locked, err := ex.balanceStore.GetBalance(ex.background(), userID, asset)
+		if err != nil {
+			log.Printf("Failed to read %s balance of %s for update: %v", asset, userID, err)
+			return
+		}
+		update.Balances = append(update.Balances, AssetBalance{Asset: asset, Available: available, Locked: locked})
+	}
+	ex.onBalance(update)
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// MaxCancelBatch is how many orders one CancelOrders call may name
+const MaxCancelBatch = 100
+
+// What became of one order of a batch cancel
+const (
+	CancelCancelled     = "cancelled"
+	CancelNotFound      = "not_found"
+	CancelAlreadyFilled = "already_filled"
+	CancelNotOwner      = "not_owner"
+)
+
+// CancelTarget names an order to cancel. Symbol is optional; without it the
+// order's symbol is looked up in the open orders index.
+type CancelTarget struct {
+	OrderID string `json:"order_id"`
+	Symbol  string `json:"symbol,omitempty"`
+}
+
+// CancelResult is the outcome of cancelling one order of a batch. Error
+// explains a not_found that isn't simply a missing order, such as an unknown
+// or recovering symbol.
+type CancelResult struct {
+	OrderID string `json:"order_id"`
+	Symbol  string `json:"symbol,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// cancelOwned cancels a resting order if userID owns it, or whoever owns it
+// if userID is empty. The order and its owner are found through the heaps'
+// ID index rather than a scan.
+func (me *MatchingEngine) cancelOwned(orderID, userID string) string {
+	defer me.flush()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	for _, h := range []*OrderHeap{me.buyOrders, me.sellOrders} {
+		i := h.find(orderID)
+		if i < 0 {
+			continue
+		}
+		if userID != "" && h.orders[i].UserID != userID {
+			return CancelNotOwner
+		}
+		me.cancelFromHeap(h, orderID)
+		me.maybeSnapshot()
+		me.publishBook()
+		return CancelCancelled
+	}
+	return CancelNotFound
+}
+
+// CancelOrders cancels each of userID's targets independently and reports
+// every outcome in order; one order failing doesn't stop the rest. Each
+// cancellation emits its own order update. Orders no longer resting are
+// looked up in the order store to tell fills apart from unknown IDs. An
+// error means the exchange took no writes at all.
+func (ex *Exchange) CancelOrders(ctx context.Context, userID string, targets []CancelTarget) ([]CancelResult, error) {
+	if len(targets) > MaxCancelBatch {
+		return nil, fmt.Errorf("%w: at most %d orders per batch, got %d", ErrInvalidOrder, MaxCancelBatch, len(targets))
+	}
+	if err := ex.checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := ex.beginWrite(); err != nil {
+		return nil, err
+	}
+	defer ex.inflight.Done()
+
+	results := make([]CancelResult, len(targets))
+	for i, target := range targets {
+		results[i] = ex.cancelTarget(ctx, userID, target)
+	}
+	return results, nil
+}
+
+func (ex *Exchange) cancelTarget(ctx context.Context, userID string, target CancelTarget) CancelResult {
+	result := CancelResult{OrderID: target.OrderID, Symbol: target.Symbol, Status: CancelNotFound}
+	if result.Symbol == "" {
+		symbol, ok := ex.openOrders.symbolOf(target.OrderID)
+		if !ok {
+			return ex.resolveClosed(ctx, userID, result)
+		}
+		result.Symbol = symbol
+	}
+
+	ex.mu.RLock()
+	engine, exists := ex.engines[result.Symbol]
+	ex.mu.RUnlock()
+	if !exists {
+		result.Error = fmt.Sprintf("%v: %s", ErrUnknownSymbol, result.Symbol)
+		return result
+	}
+	if err := ex.checkReady(result.Symbol); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = engine.cancelOwned(target.OrderID, userID)
+	if result.Status == CancelNotFound {
+		return ex.resolveClosed(ctx, userID, result)
+	}
+	return result
+}
+
+// resolveClosed explains an order that isn't resting from its stored row
+func (ex *Exchange) resolveClosed(ctx context.Context, userID string, result CancelResult) CancelResult {
+	stored, err := ex.orderStore.GetOrderByID(ctx, result.OrderID)
+	if err != nil || stored == nil {
+		return result
+	}
+	result.Symbol = stored.Symbol
+	switch {
+	case stored.UserID != userID:
+		result.Status = CancelNotOwner
+	case stored.Status == domain.OrderStatusFilled:
+		result.Status = CancelAlreadyFilled
+	}
+	return result
+}
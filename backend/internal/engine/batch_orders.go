@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// MaxOrderBatch is how many orders one SubmitOrders call may place
+const MaxOrderBatch = 50
+
+// OrderResult is the outcome of submitting one order of a batch. Order is
+// the order as accepted, before any matching; Err is why it was rejected.
+type OrderResult struct {
+	Order    domain.Order
+	Warnings []RiskWarning
+	Err      error
+}
+
+// SubmitOrders accepts each order independently, in order, and then matches
+// the accepted ones in that same order, so a ladder of quotes lands on the
+// book as it was sent. One order being rejected doesn't stop the rest. An
+// error means the exchange accepted none of them.
+func (ex *Exchange) SubmitOrders(ctx context.Context, orders []*domain.Order) ([]OrderResult, error) {
+	if len(orders) > MaxOrderBatch {
+		return nil, fmt.Errorf("%w: at most %d orders per batch, got %d", ErrInvalidOrder, MaxOrderBatch, len(orders))
+	}
+	if err := ex.beginWrite(); err != nil {
+		return nil, err
+	}
+
+	type acceptedOrder struct {
+		engine *MatchingEngine
+		order  *domain.Order
+	}
+	results := make([]OrderResult, len(orders))
+	accepted := make([]acceptedOrder, 0, len(orders))
+	for i, order := range orders {
+		engine, warnings, err := ex.acceptOrder(ctx, order)
+		results[i] = OrderResult{Order: *order, Warnings: warnings, Err: err}
+		if err == nil {
+			accepted = append(accepted, acceptedOrder{engine: engine, order: order})
+		}
+	}
+
+	ex.clock.Go(func() {
+		defer ex.inflight.Done()
+		for _, a := range accepted {
+			a.engine.ProcessOrder(a.order)
+		}
+	})
+	return results, nil
+}
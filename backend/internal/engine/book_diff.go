@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// StreamedBookDepth is how many levels a side streamed books carry
+const StreamedBookDepth = 20
+
+// bookPublishInterval is the most often a symbol's book diff is published.
+// Changes in between are coalesced into the next diff.
+const bookPublishInterval = 100 * time.Millisecond
+
+// publishedBook is the book last streamed for a symbol. Diffs are taken
+// against it, and it is the snapshot clients start applying them to.
+type publishedBook struct {
+	mu   sync.Mutex
+	bids []domain.OrderBookLevel
+	asks []domain.OrderBookLevel
+	seq  uint64
+
+	// pending is the newest top of book the engine queued that hasn't been
+	// diffed yet, and at is when the last diff was published. Only the drain
+	// goroutine touches them, under ex.drainMu.
+	pending *bookLevels
+	at      time.Time
+}
+
+// bookLevels is the top StreamedBookDepth levels a side of a book, as of an
+// engine sequence
+type bookLevels struct {
+	bids []domain.OrderBookLevel
+	asks []domain.OrderBookLevel
+	seq  uint64
+}
+
+// SetOnOrderBookCallback sets the callback to be called with the levels of a
+// symbol's book that changed. The engine queues its top levels whenever they
+// change, and they are diffed when events are next drained, at most once per
+// bookPublishInterval, so a burst is coalesced into one diff but the book's
+// final state is always published.
+func (ex *Exchange) SetOnOrderBookCallback(callback func(*domain.OrderBookDiff)) {
+	ex.onOrderBook = callback
+}
+
+// drainOrderBook publishes a diff of an engine's book if it changed since
+// the last one and that was at least bookPublishInterval ago. A book too
+// recently published keeps its levels pending, so a later drain picks them
+// up. Books still being recovered keep theirs until they are ready.
+//
+// It never takes the engine's lock: the engine holds it while sending to the
+// channels this goroutine drains, so waiting on it here could deadlock a
+// sweep that fills those channels.
+func (ex *Exchange) drainOrderBook(engine *MatchingEngine) {
+	if ex.onOrderBook == nil {
+		return
+	}
+	published := &engine.published
+	select {
+	case levels := <-engine.levelUpdates:
+		published.pending = levels
+	default:
+	}
+	if published.pending == nil {
+		return
+	}
+	now := ex.clock.Now()
+	if now.Sub(published.at) < bookPublishInterval || ex.checkReady(engine.symbol) != nil {
+		return
+	}
+	diff, changed := published.publish(engine.symbol, published.pending)
+	published.pending = nil
+	if !changed {
+		return
+	}
+	published.at = now
+	ex.onOrderBook(diff)
+}
+
+// publish compares levels with those last published and returns the levels
+// that changed, recording the new ones as published. ok is false, and
+// nothing is recorded, when none changed.
+func (pb *publishedBook) publish(symbol string, levels *bookLevels) (diff *domain.OrderBookDiff, ok bool) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	diff = &domain.OrderBookDiff{
+		Symbol:    symbol,
+		Bids:      diffLevels(pb.bids, levels.bids, true),
+		Asks:      diffLevels(pb.asks, levels.asks, false),
+		Timestamp: domain.Now(),
+		PrevSeq:   pb.seq,
+		Seq:       levels.seq,
+	}
+	if len(diff.Bids) == 0 && len(diff.Asks) == 0 {
+		return nil, false
+	}
+	pb.bids, pb.asks, pb.seq = levels.bids, levels.asks, levels.seq
+	return diff, true
+}
+
+// PublishedOrderBook returns symbol's book as last published, which the next
+// diff applies to. Before the first diff it is empty at Seq 0.
+func (ex *Exchange) PublishedOrderBook(symbol string) (*domain.OrderBook, error) {
+	engine, err := ex.streamedEngine(symbol)
+	if err != nil {
+		return nil, err
+	}
+	published := &engine.published
+	published.mu.Lock()
+	defer published.mu.Unlock()
+	return &domain.OrderBook{
+		Symbol:    symbol,
+		Bids:      append([]domain.OrderBookLevel{}, published.bids...),
+		Asks:      append([]domain.OrderBookLevel{}, published.asks...),
+		Timestamp: domain.Now(),
+		Seq:       published.seq,
+	}, nil
+}
+
+func (ex *Exchange) streamedEngine(symbol string) (*MatchingEngine, error) {
+	ex.mu.RLock()
+	engine, exists := ex.engines[symbol]
+	ex.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+	}
+	return engine, nil
+}
+
+// publishBook queues the top of book and the top levels for the drain
+// goroutine. It is called with the engine lock held at the end of every
+// operation that can change the book.
+func (me *MatchingEngine) publishBook() {
+	me.publishBookTicker()
+	me.publishLevels()
+}
+
+// publishLevels queues the book's top levels if they changed since the last
+// ones queued. Like publishBookTicker it is called with the engine lock held
+// at the end of an operation, and the queue holds only the newest levels.
+func (me *MatchingEngine) publishLevels() {
+	bids, _ := me.buyOrders.bestLevels(StreamedBookDepth)
+	asks, _ := me.sellOrders.bestLevels(StreamedBookDepth)
+	if sameLevels(bids, me.levels.bids) && sameLevels(asks, me.levels.asks) {
+		return
+	}
+	me.levels = bookLevels{bids: bids, asks: asks, seq: me.seq}
+
+	select {
+	case <-me.levelUpdates:
+	default:
+	}
+	queued := me.levels
+	me.levelUpdates <- &queued
+}
+
+func sameLevels(a, b []domain.OrderBookLevel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffLevels returns the levels of next that differ from prev, and a zero
+// quantity level for each price in prev that next no longer has, best first
+func diffLevels(prev, next []domain.OrderBookLevel, isBuy bool) []domain.OrderBookLevel {
+	before := make(map[float64]domain.OrderBookLevel, len(prev))
+	for _, level := range prev {
+		before[level.Price] = level
+	}
+
+	changed := make([]domain.OrderBookLevel, 0)
+	for _, level := range next {
+		if old, ok := before[level.Price]; !ok || old != level {
+			changed = append(changed, level)
+		}
+		delete(before, level.Price)
+	}
+	for price := range before {
+		changed = append(changed, domain.OrderBookLevel{Price: price})
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		if isBuy {
+			return changed[i].Price > changed[j].Price
+		}
+		return changed[i].Price < changed[j].Price
+	})
+	return changed
+}
@@ -0,0 +1,90 @@
+package engine_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// A sweep filling far more orders than the engine's channels hold must not
+// stall the drain goroutine while it publishes book diffs
+func TestSweepWithBookDiffsDoesNotDeadlock(t *testing.T) {
+	var mu sync.Mutex
+	diffs := 0
+	ex := newTestExchange(t, func(ex *engine.Exchange) {
+		ex.SetOnOrderBookCallback(func(*domain.OrderBookDiff) {
+			mu.Lock()
+			diffs++
+			mu.Unlock()
+		})
+	})
+	ex.store.Deposit("maker", "BTC", 10)
+	ex.store.Deposit("taker", "USD", 100000)
+
+	const levels = 1500
+	for i := 0; i < levels; i++ {
+		ex.submit(t, "maker", domain.OrderSideSell, domain.OrderTypeLimit, 0.001, referencePrice+float64(i))
+	}
+	ex.eventually(t, "the asks to rest", func() bool {
+		book, err := ex.FullOrderBook("BTC-USD")
+		return err == nil && len(book.Asks) == levels
+	})
+	ex.eventually(t, "the asks to be published", func() bool {
+		book, _ := ex.PublishedOrderBook("BTC-USD")
+		return len(book.Asks) == engine.StreamedBookDepth
+	})
+	// Let bookPublishInterval pass, so a diff is due while the sweep drains
+	time.Sleep(150 * time.Millisecond)
+
+	buy := ex.submit(t, "taker", domain.OrderSideBuy, domain.OrderTypeLimit, levels*0.001, referencePrice+levels)
+	ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+	ex.eventually(t, "the emptied book to be published", func() bool {
+		book, _ := ex.PublishedOrderBook("BTC-USD")
+		return len(book.Asks) == 0
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if diffs < 2 {
+		t.Errorf("%d diffs published, want at least the resting asks and the sweep", diffs)
+	}
+}
+
+// Published levels are the best StreamedBookDepth a side, best first, with
+// orders at one price summed
+func TestPublishedLevelsAreBestFirst(t *testing.T) {
+	ex := newTestExchange(t, func(ex *engine.Exchange) {
+		ex.SetOnOrderBookCallback(func(*domain.OrderBookDiff) {})
+	})
+	ex.store.Deposit("maker", "BTC", 10)
+	ex.store.Deposit("maker", "USD", 1000000)
+
+	for i := 0; i < 30; i++ {
+		offset := float64((i * 7) % 30)
+		ex.rest(t, "maker", domain.OrderSideSell, 0.01, referencePrice+10+offset)
+		ex.rest(t, "maker", domain.OrderSideBuy, 0.01, referencePrice-10-offset)
+	}
+	ex.rest(t, "maker", domain.OrderSideSell, 0.02, referencePrice+10)
+
+	ex.eventually(t, "every order to be published", func() bool {
+		book, _ := ex.PublishedOrderBook("BTC-USD")
+		return len(book.Asks) > 0 && book.Asks[0].Orders == 2
+	})
+	book, _ := ex.PublishedOrderBook("BTC-USD")
+	if len(book.Bids) != engine.StreamedBookDepth || len(book.Asks) != engine.StreamedBookDepth {
+		t.Fatalf("%d bids and %d asks published, want %d a side", len(book.Bids), len(book.Asks), engine.StreamedBookDepth)
+	}
+	for i := 0; i < engine.StreamedBookDepth; i++ {
+		if want := referencePrice - 10 - float64(i); book.Bids[i].Price != want {
+			t.Errorf("bid %d is at %g, want %g", i, book.Bids[i].Price, want)
+		}
+		if want := referencePrice + 10 + float64(i); book.Asks[i].Price != want {
+			t.Errorf("ask %d is at %g, want %g", i, book.Asks[i].Price, want)
+		}
+	}
+	if ask := book.Asks[0]; ask.Quantity != 0.03 || ask.Orders != 2 {
+		t.Errorf("best ask is %g over %d orders, want 0.03 over 2", ask.Quantity, ask.Orders)
+	}
+}
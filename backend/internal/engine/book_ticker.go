@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// SetOnBookTickerCallback sets the callback to be called when a symbol's best
+// bid or ask changes. Changes made faster than events are drained are
+// conflated: only the latest top of book is passed on, so sequences only
+// ever increase but may skip.
+func (ex *Exchange) SetOnBookTickerCallback(callback func(*domain.BookTicker)) {
+	ex.onBookTicker = callback
+}
+
+// BookTicker returns symbol's top of book as last published
+func (ex *Exchange) BookTicker(symbol string) (*domain.BookTicker, error) {
+	engine, err := ex.streamedEngine(symbol)
+	if err != nil {
+		return nil, err
+	}
+	engine.mu.RLock()
+	defer engine.mu.RUnlock()
+	ticker := engine.bookTicker
+	ticker.Symbol = symbol
+	if ticker.Timestamp.IsZero() {
+		ticker.Timestamp = domain.Now()
+	}
+	return &ticker, nil
+}
+
+// drainBookTicker passes on an engine's latest top of book. Books still
+// being recovered keep theirs until they are ready.
+func (ex *Exchange) drainBookTicker(engine *MatchingEngine) {
+	if ex.onBookTicker == nil || ex.checkReady(engine.symbol) != nil {
+		return
+	}
+	select {
+	case ticker := <-engine.bookTickers:
+		ex.onBookTicker(ticker)
+	default:
+	}
+}
+
+// publishBookTicker queues the top of the book if its best bid or ask moved
+// since the last one queued. It is called with the engine lock held at the
+// end of an operation, when the book is consistent. The queue holds one
+// ticker, replaced by each newer one.
+func (me *MatchingEngine) publishBookTicker() {
+	ticker := domain.BookTicker{Symbol: me.symbol}
+	ticker.BidPrice, ticker.BidQty = bestLevel(me.buyOrders)
+	ticker.AskPrice, ticker.AskQty = bestLevel(me.sellOrders)
+	last := me.bookTicker
+	if ticker.BidPrice == last.BidPrice && ticker.BidQty == last.BidQty &&
+		ticker.AskPrice == last.AskPrice && ticker.AskQty == last.AskQty {
+		return
+	}
+	ticker.Timestamp = domain.Now()
+	ticker.Seq = me.seq
+	me.bookTicker = ticker
+
+	// Only the engine sends, under its lock, so once emptied the queue has
+	// room
+	select {
+	case <-me.bookTickers:
+	default:
+	}
+	published := ticker
+	me.bookTickers <- &published
+}
+
+// bestLevel is the best price of one side of the book and the quantity
+// resting at it. Only the orders tied at the top price, and their children
+// in the heap, are looked at, so it costs the same on a deep book as on a
+// shallow one.
+func bestLevel(h *OrderHeap) (price, quantity float64) {
+	levels, _ := h.bestLevels(1)
+	if len(levels) == 0 {
+		return 0, 0
+	}
+	return levels[0].Price, levels[0].Quantity
+}
@@ -0,0 +1,96 @@
+package engine_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// A trade delivered again after it was saved and settled is counted as a
+// duplicate and moves no balance a second time
+func TestRedeliveredTradeMovesBalancesOnce(t *testing.T) {
+	ex := newTestExchange(t)
+	ex.store.Deposit("maker", "BTC", 10)
+	ex.store.Deposit("taker", "USD", 100000)
+
+	ex.rest(t, "maker", domain.OrderSideSell, 1, referencePrice)
+	buy := ex.submit(t, "taker", domain.OrderSideBuy, domain.OrderTypeLimit, 1, referencePrice)
+	ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+	ex.eventually(t, "the trade to settle", func() bool { return ex.store.Position("taker", "BTC-USD") != nil })
+
+	trades := ex.store.Trades()
+	if len(trades) != 1 {
+		t.Fatalf("%d trades, want 1", len(trades))
+	}
+	settled := balances(t, ex)
+
+	ex.HandleTrade(trades[0])
+	ex.HandleTrade(trades[0])
+
+	if got := balances(t, ex); !reflect.DeepEqual(got, settled) {
+		t.Errorf("balances after redelivery = %+v, want %+v", got, settled)
+	}
+	if position := ex.store.Position("taker", "BTC-USD"); position.Quantity != 1 {
+		t.Errorf("taker position = %g, want 1", position.Quantity)
+	}
+	if n := len(ex.store.Trades()); n != 1 {
+		t.Errorf("%d trades saved, want 1", n)
+	}
+	if stats := ex.SettlementStats(); stats.Duplicates != 2 {
+		t.Errorf("%d duplicates counted, want 2", stats.Duplicates)
+	}
+}
+
+// A fill replayed under a new trade ID is caught by its taker/maker pair,
+// as the trades table's unique index does, and settles only once
+func TestFillReplayedUnderNewIDMovesBalancesOnce(t *testing.T) {
+	ex := newTestExchange(t)
+	ex.store.Deposit("maker", "BTC", 10)
+	ex.store.Deposit("taker", "USD", 100000)
+
+	ex.rest(t, "maker", domain.OrderSideSell, 1, referencePrice)
+	buy := ex.submit(t, "taker", domain.OrderSideBuy, domain.OrderTypeLimit, 1, referencePrice)
+	ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+	ex.eventually(t, "the trade to settle", func() bool { return ex.store.Position("taker", "BTC-USD") != nil })
+
+	trades := ex.store.Trades()
+	if len(trades) != 1 {
+		t.Fatalf("%d trades, want 1", len(trades))
+	}
+	settled := balances(t, ex)
+
+	replayed := *trades[0]
+	replayed.ID = "replayed-" + trades[0].ID
+	ex.HandleTrade(&replayed)
+
+	if got := balances(t, ex); !reflect.DeepEqual(got, settled) {
+		t.Errorf("balances after replay = %+v, want %+v", got, settled)
+	}
+	if position := ex.store.Position("taker", "BTC-USD"); position.Quantity != 1 {
+		t.Errorf("taker position = %g, want 1", position.Quantity)
+	}
+	if n := len(ex.store.Trades()); n != 1 {
+		t.Errorf("%d trades saved, want 1", n)
+	}
+	if stats := ex.SettlementStats(); stats.Duplicates != 1 {
+		t.Errorf("%d duplicates counted, want 1", stats.Duplicates)
+	}
+}
+
+// balances is every balance the trade touches, as [available, locked]
+func balances(t *testing.T, ex *testExchange) map[string][2]float64 {
+	t.Helper()
+	got := make(map[string][2]float64)
+	for _, user := range []string{"maker", "taker"} {
+		for _, asset := range []string{"BTC", "USD"} {
+			available, locked, err := ex.store.GetBalance(context.Background(), user, asset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[user+"/"+asset] = [2]float64{available, locked}
+		}
+	}
+	return got
+}
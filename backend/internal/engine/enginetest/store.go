@@ -0,0 +1,237 @@
+// Package enginetest provides an in-memory store for running an Exchange in
+// tests without a database
+package enginetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// ErrLockedOverdrawn is returned by SettleTrade and UnlockBalance when they
+// would take more out of a locked balance than is locked, as the balance
+// repository refuses
+var ErrLockedOverdrawn = errors.New("locked balance overdrawn")
+
+// lockedTolerance matches the balance repository's allowance for float
+// rounding
+const lockedTolerance = 1e-8
+
+// Store keeps orders, trades, balances and positions in memory. It is the
+// Exchange's trade, order and balance store at once.
+type Store struct {
+	// BeforeSettle, if set, is called at the start of every SettleTrade, and
+	// an error it returns fails the settlement. It must be set before the
+	// Exchange starts.
+	BeforeSettle func(tradeID string) error
+	// BeforeUnlock, if set, is called at the start of every UnlockBalance,
+	// and an error it returns fails the unlock. It must be set before the
+	// Exchange starts.
+	BeforeUnlock func(userID, asset string) error
+
+	mu        sync.Mutex
+	orders    map[string]*domain.Order
+	trades    map[string]*domain.Trade
+	fills     map[string]bool // taker/maker order pairs saved
+	settled   map[string]bool
+	balances  map[string]*[2]float64 // available, locked
+	positions map[string]*domain.Position
+}
+
+func NewStore() *Store {
+	return &Store{
+		orders:    make(map[string]*domain.Order),
+		trades:    make(map[string]*domain.Trade),
+		fills:     make(map[string]bool),
+		settled:   make(map[string]bool),
+		balances:  make(map[string]*[2]float64),
+		positions: make(map[string]*domain.Position),
+	}
+}
+
+func (s *Store) balance(userID, asset string) *[2]float64 {
+	key := userID + "/" + asset
+	b, ok := s.balances[key]
+	if !ok {
+		b = &[2]float64{}
+		s.balances[key] = b
+	}
+	return b
+}
+
+// Deposit credits a user's available balance
+func (s *Store) Deposit(userID, asset string, amount float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balance(userID, asset)[0] += amount
+}
+
+// Trades returns every trade saved, in no particular order
+func (s *Store) Trades() []*domain.Trade {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades := make([]*domain.Trade, 0, len(s.trades))
+	for _, trade := range s.trades {
+		copied := *trade
+		trades = append(trades, &copied)
+	}
+	return trades
+}
+
+// Position returns a user's position in a symbol, or nil if they have none
+func (s *Store) Position(userID, symbol string) *domain.Position {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	position, ok := s.positions[userID+"/"+symbol]
+	if !ok {
+		return nil
+	}
+	copied := *position
+	return &copied
+}
+
+// SaveTrade stores a trade unless one with its ID or the same taker/maker
+// fill is already stored, like the trade repository's unique index
+func (s *Store) SaveTrade(_ context.Context, trade *domain.Trade) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fill := trade.TakerOrderID + "/" + trade.MakerOrderID
+	if _, ok := s.trades[trade.ID]; ok || s.fills[fill] {
+		return false, nil
+	}
+	copied := *trade
+	s.trades[trade.ID] = &copied
+	s.fills[fill] = true
+	return true, nil
+}
+
+func (s *Store) SaveOrder(_ context.Context, order *domain.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *order
+	s.orders[order.ID] = &copied
+	return nil
+}
+
+func (s *Store) UpdateOrder(ctx context.Context, order *domain.Order) error {
+	return s.SaveOrder(ctx, order)
+}
+
+func (s *Store) GetOrderByID(_ context.Context, orderID string) (*domain.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, ok := s.orders[orderID]
+	if !ok {
+		return nil, fmt.Errorf("order not found: %s", orderID)
+	}
+	copied := *order
+	return &copied, nil
+}
+
+// StreamOrderHistory hands fn a copy of every order for symbol created in
+// [from, to], oldest first, as the order repository does
+func (s *Store) StreamOrderHistory(ctx context.Context, symbol string, from, to time.Time, fn func(*domain.Order) error) error {
+	s.mu.Lock()
+	history := make([]*domain.Order, 0)
+	for _, order := range s.orders {
+		if order.Symbol == symbol && !order.CreatedAt.Before(from) && !order.CreatedAt.After(to) {
+			copied := *order
+			history = append(history, &copied)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.SliceStable(history, func(i, j int) bool { return history[i].CreatedAt.Before(history[j].CreatedAt) })
+	for _, order := range history {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetBalance(_ context.Context, userID, asset string) (available, locked float64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.balance(userID, asset)
+	return b[0], b[1], nil
+}
+
+// SettleTrade applies the deltas only if none takes a locked balance below
+// zero, so a test sees the same refusal the database gives
+func (s *Store) SettleTrade(_ context.Context, tradeID string, deltas []engine.BalanceDelta, fills []engine.PositionFill) ([]*domain.Position, error) {
+	if s.BeforeSettle != nil {
+		if err := s.BeforeSettle(tradeID); err != nil {
+			return nil, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.settled[tradeID] {
+		return nil, engine.ErrAlreadySettled
+	}
+	for _, delta := range deltas {
+		if delta.Locked < 0 && s.balance(delta.UserID, delta.Asset)[1]+delta.Locked < -lockedTolerance {
+			return nil, fmt.Errorf("%w: %s/%s has less than %.8f locked", ErrLockedOverdrawn, delta.UserID, delta.Asset, -delta.Locked)
+		}
+	}
+	s.settled[tradeID] = true
+	for _, delta := range deltas {
+		b := s.balance(delta.UserID, delta.Asset)
+		b[0] += delta.Available
+		b[1] += delta.Locked
+	}
+
+	positions := make([]*domain.Position, 0, len(fills))
+	for _, fill := range fills {
+		key := fill.UserID + "/" + fill.Symbol
+		position, ok := s.positions[key]
+		if !ok {
+			position = &domain.Position{UserID: fill.UserID, Symbol: fill.Symbol}
+			s.positions[key] = position
+		}
+		position.ApplyFill(fill.Quantity, fill.Price)
+		position.UpdatedAt = domain.Now()
+		copied := *position
+		positions = append(positions, &copied)
+	}
+	return positions, nil
+}
+
+func (s *Store) LockBalance(_ context.Context, userID, asset string, amount float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.balance(userID, asset)
+	if b[0] < amount {
+		return engine.ErrInsufficientBalance
+	}
+	b[0] -= amount
+	b[1] += amount
+	return nil
+}
+
+func (s *Store) UnlockBalance(_ context.Context, userID, asset string, amount float64) error {
+	if s.BeforeUnlock != nil {
+		if err := s.BeforeUnlock(userID, asset); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.balance(userID, asset)
+	if b[1]-amount < -lockedTolerance {
+		return fmt.Errorf("%w: %s/%s has less than %.8f locked", ErrLockedOverdrawn, userID, asset, amount)
+	}
+	b[0] += amount
+	b[1] -= amount
+	return nil
+}
@@ -2,15 +2,22 @@ package engine
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hft-exchange/backend/internal/clock"
 	"github.com/hft-exchange/backend/internal/domain"
 )
 
 type Exchange struct {
 	engines      map[string]*MatchingEngine
+	symbols      map[string]domain.SymbolConfig
+	recovering   map[string]bool // symbols whose books are still being rebuilt
 	mu           sync.RWMutex
 	tradeStore   TradeStore
 	orderStore   OrderStore
@@ -18,85 +25,504 @@ type Exchange struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	onTrade      func(*domain.Trade)  // Callback when trade executes
+	onPosition   func(*domain.Position)
+	onOrder      func(*domain.Order)
+	onBalance    func(*BalanceUpdate)
+	onBookTicker func(*domain.BookTicker)
+	onOrderBook  func(*domain.OrderBookDiff)
+	onNotification    func(*domain.Notification)
+	notificationStore NotificationStore
+	reservations map[string]*reservation
+	resMu        sync.Mutex
+	lastPrices   map[string]float64
+	priceMu      sync.RWMutex
+	replicator   Replicator
+	writeFence   func() error
+	standby      atomic.Bool
+	replicationSeq uint64
+	clock        clock.Clock
+	riskLimits   RiskLimits
+	riskProfiles map[string]*RiskProfile
+	riskProfileStore RiskProfileStore
+	riskMu       sync.RWMutex
+	onRiskWarning func(*RiskWarning)
+	quotaMu      sync.Mutex
+	quotaDay     string
+	dailyOrders  map[string]int
+	lastWarned   map[string]time.Time
+	lifecycleMu  sync.Mutex
+	stopping     bool
+	stopOnce     sync.Once
+	inflight     sync.WaitGroup // accepted writes the engines are still processing
+	drainMu      sync.Mutex     // serializes draining engine output and settlement retries
+	settlementStore    SettlementStore
+	settleMu           sync.Mutex
+	pendingSettlements []*PendingSettlement
+	pendingUnlocks     []*pendingUnlock // guarded by settleMu
+	settlementsQueued    uint64
+	settlementsRetried   uint64
+	settlementsRecovered uint64
+	settlementsSkipped   uint64 // settlements found already applied
+	duplicateTrades      uint64 // trades found already stored
+	usageMu            sync.Mutex
+	usage              map[string]*symbolUsage
+	journalStore       JournalStore
+	journalBacklog     []*JournalRecord // records that failed to write, oldest first
+	ledgerStore        LedgerStore
+	withdrawalLimits   map[string]float64 // daily cap per asset
+	reconciliationStore ReconciliationStore
+	tradingStatusStore TradingStatusStore
+	tradingStatus      TradingStatus
+	tradingMu          sync.RWMutex
+	onTradingStatus    func(*TradingStatus)
+	statusMu           sync.Mutex
+	symbolStates       map[string]SymbolStatus // last state seen per symbol
+	onSymbolStatus     func(*SymbolStatus)
+	staleMu            sync.Mutex
+	stalePolicy        StaleOrderPolicy
+	verifiedUserStore  VerifiedUserStore
+	staleExempt        int // verified users the last sweep left alone
+	staleCancelled     map[string]uint64 // stale orders cancelled, by symbol
+	staleCursor        string            // last symbol swept
+	lastStaleSweep     time.Time
+	openOrders         *openOrderIndex
+	openOrderSource    UserOpenOrderSource
+	disabledUserStore  DisabledUserStore
+	disabledUsers      map[string]bool
+	disabledMu         sync.RWMutex
 }
 
+const (
+	// selfCheckInterval is how often every book is verified in the background
+	selfCheckInterval = 5 * time.Minute
+	// eventDrainInterval is how often engine output is collected
+	eventDrainInterval = 10 * time.Millisecond
+)
+
+var (
+	// ErrUnknownSymbol is returned for orders on a symbol with no engine
+	ErrUnknownSymbol = errors.New("unknown symbol")
+	// ErrOrderNotFound is returned when a cancel matches no resting order
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrNotOwner is returned for cancelling another user's order
+	ErrNotOwner = errors.New("order belongs to another user")
+)
+
 type TradeStore interface {
-	SaveTrade(trade *domain.Trade) error
+	// SaveTrade reports false for a trade that was already stored
+	SaveTrade(ctx context.Context, trade *domain.Trade) (bool, error)
 }
 
 type OrderStore interface {
-	SaveOrder(order *domain.Order) error
-	UpdateOrder(order *domain.Order) error
-	GetOrderByID(orderID string) (*domain.Order, error)
+	SaveOrder(ctx context.Context, order *domain.Order) error
+	UpdateOrder(ctx context.Context, order *domain.Order) error
+	GetOrderByID(ctx context.Context, orderID string) (*domain.Order, error)
+}
+
+// BalanceDelta is a signed change to a user's available and locked balance
+type BalanceDelta struct {
+	UserID    string
+	Asset     string
+	Available float64
+	Locked    float64
+}
+
+// PositionFill is a signed change to a user's position: positive for buys
+type PositionFill struct {
+	UserID   string
+	Symbol   string
+	Quantity float64
+	Price    float64
 }
 
 type BalanceStore interface {
-	GetBalance(userID, asset string) (available, locked float64, err error)
-	UpdateBalance(userID, asset string, available, locked float64) error
+	GetBalance(ctx context.Context, userID, asset string) (available, locked float64, err error)
+	// SettleTrade applies balance deltas and position fills atomically. It
+	// returns ErrAlreadySettled if the trade was settled before.
+	SettleTrade(ctx context.Context, tradeID string, deltas []BalanceDelta, fills []PositionFill) ([]*domain.Position, error)
+	LockBalance(ctx context.Context, userID, asset string, amount float64) error
+	UnlockBalance(ctx context.Context, userID, asset string, amount float64) error
 }
 
 func NewExchange(tradeStore TradeStore, orderStore OrderStore, balanceStore BalanceStore) *Exchange {
 	ctx, cancel := context.WithCancel(context.Background())
 	ex := &Exchange{
 		engines:      make(map[string]*MatchingEngine),
+		symbols:      make(map[string]domain.SymbolConfig),
+		recovering:   make(map[string]bool),
 		tradeStore:   tradeStore,
 		orderStore:   orderStore,
 		balanceStore: balanceStore,
 		ctx:          ctx,
 		cancel:       cancel,
+		reservations: make(map[string]*reservation),
+		lastPrices:   make(map[string]float64),
+		clock:        clock.Real{},
+		dailyOrders:  make(map[string]int),
+		lastWarned:   make(map[string]time.Time),
+		usage:        make(map[string]*symbolUsage),
+		riskProfiles: make(map[string]*RiskProfile),
+		openOrders:   newOpenOrderIndex(),
+		staleCancelled: make(map[string]uint64),
+		symbolStates:   make(map[string]SymbolStatus),
+		disabledUsers:  make(map[string]bool),
 	}
 	return ex
 }
 
+// background is the context for persisting what the engines emitted. It
+// carries the exchange's values but outlives Stop, which still has to drain
+// engine output into the stores after cancelling the periodic work.
+func (ex *Exchange) background() context.Context {
+	return context.WithoutCancel(ex.ctx)
+}
+
+// SetClock replaces the wall clock that drives event processing, background
+// checks and order execution. It must be called before Start.
+func (ex *Exchange) SetClock(c clock.Clock) {
+	ex.clock = c
+}
+
+// Start begins processing engine output. Symbols are listed with AddSymbol
+// beforehand.
 func (ex *Exchange) Start() {
-	symbols := []string{"BTC-USD", "ETH-USD", "SOL-USD", "USDC-USD"}
-	
-	for _, symbol := range symbols {
-		ex.AddSymbol(symbol)
+	ex.loadPendingSettlements()
+	ex.clock.Every(ex.ctx, eventDrainInterval, ex.processEvents)
+	ex.clock.Every(ex.ctx, selfCheckInterval, ex.checkAllBooks)
+	ex.clock.Every(ex.ctx, settlementRetryInterval, ex.retrySettlements)
+	ex.clock.Every(ex.ctx, tradingResumeCheckInterval, ex.resumeIfDue)
+	if ex.openOrderSource != nil {
+		ex.clock.Every(ex.ctx, openOrderCheckInterval, ex.checkOpenOrders)
+	}
+	if ex.reconciliationStore != nil {
+		ex.clock.Every(ex.ctx, reconciliationInterval, ex.reconcile)
+	}
+	if ex.stalePolicy.MaxAge > 0 {
+		ex.clock.Every(ex.ctx, staleSweepInterval, ex.sweepStaleOrders)
 	}
-
-	go ex.processAllTrades()
-	go ex.processAllOrderUpdates()
 }
 
-func (ex *Exchange) AddSymbol(symbol string) {
+// AddSymbol lists a trading pair, or updates the config of a listed one
+func (ex *Exchange) AddSymbol(config domain.SymbolConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
 	ex.mu.Lock()
 	defer ex.mu.Unlock()
 
-	if _, exists := ex.engines[symbol]; !exists {
-		engine := NewMatchingEngine(symbol)
-		ex.engines[symbol] = engine
-		log.Printf("Added trading pair: %s", symbol)
+	ex.symbols[config.Symbol] = config
+	domain.SetSymbolPrecision(config.Symbol, domain.Precision{
+		Price:    config.PriceDecimals(),
+		Quantity: domain.DefaultQuantityDecimals,
+	})
+	if engine, exists := ex.engines[config.Symbol]; exists {
+		engine.Resume()
+	} else {
+		engine := NewMatchingEngine(config.Symbol)
+		ex.replicateFrom(engine)
+		ex.engines[config.Symbol] = engine
+		log.Printf("Added trading pair: %s", config.Symbol)
+	}
+	return nil
+}
+
+// ListSymbol adds a trading pair while the exchange is running and forwards
+// it to the standby
+func (ex *Exchange) ListSymbol(config domain.SymbolConfig) error {
+	if err := ex.checkWritable(); err != nil {
+		return err
+	}
+	ex.mu.RLock()
+	_, listed := ex.symbols[config.Symbol]
+	ex.mu.RUnlock()
+	if err := ex.AddSymbol(config); err != nil {
+		return err
+	}
+
+	// A symbol first listed now has no recovery to start its journal
+	ex.mu.RLock()
+	engine := ex.engines[config.Symbol]
+	ex.mu.RUnlock()
+	if ex.journalStore != nil && !engine.Journaling() {
+		if err := ex.startJournal(config.Symbol, engine); err != nil {
+			log.Printf("Journaling off for %s: %v", config.Symbol, err)
+		}
+	}
+
+	ex.refreshSymbolStatuses(config.Symbol)
+	ex.replicate(&ReplicationEvent{Type: ReplicateList, Symbol: config.Symbol, Config: &config})
+	if !listed {
+		ex.announce(domain.CategoryListing, domain.SeverityInfo, config.Symbol, "%s is now listed for trading", config.Symbol)
+	}
+	return nil
+}
+
+// RemoveSymbol delists a trading pair: new orders on it are rejected and
+// every resting order is cancelled, releasing its funds once the
+// cancellations are processed. The halted engine is kept so orders accepted
+// just before the delisting are cancelled too. It returns how many orders
+// were cancelled.
+func (ex *Exchange) RemoveSymbol(symbol string) (int, error) {
+	ex.mu.Lock()
+	_, listed := ex.symbols[symbol]
+	engine := ex.engines[symbol]
+	delete(ex.symbols, symbol)
+	ex.mu.Unlock()
+
+	if !listed {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+	}
+
+	cancelled := engine.Halt()
+	log.Printf("Delisted trading pair: %s (%d orders cancelled)", symbol, cancelled)
+	ex.refreshSymbolStatuses(symbol)
+	return cancelled, nil
+}
+
+// DelistSymbol removes a trading pair while the exchange is running and
+// forwards the delisting to the standby
+func (ex *Exchange) DelistSymbol(symbol string) (int, error) {
+	if err := ex.checkWritable(); err != nil {
+		return 0, err
 	}
+	cancelled, err := ex.RemoveSymbol(symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	ex.replicate(&ReplicationEvent{Type: ReplicateDelist, Symbol: symbol})
+	ex.announce(domain.CategoryListing, domain.SeverityWarning, symbol, "%s has been delisted; its %d resting orders were cancelled", symbol, cancelled)
+	return cancelled, nil
+}
+
+func (ex *Exchange) SubmitOrder(ctx context.Context, order *domain.Order) error {
+	_, err := ex.SubmitOrderWithWarnings(ctx, order)
+	return err
+}
+
+// SubmitOrderWithWarnings submits an order like SubmitOrder and also returns
+// the soft risk limits its acceptance crossed
+func (ex *Exchange) SubmitOrderWithWarnings(ctx context.Context, order *domain.Order) ([]RiskWarning, error) {
+	if err := ex.beginWrite(); err != nil {
+		return nil, err
+	}
+	engine, warnings, err := ex.acceptOrder(ctx, order)
+	if err != nil {
+		ex.inflight.Done()
+		return nil, err
+	}
+
+	ex.clock.Go(func() {
+		defer ex.inflight.Done()
+		engine.ProcessOrder(order)
+	})
+	return warnings, nil
 }
 
-func (ex *Exchange) SubmitOrder(order *domain.Order) error {
+// acceptOrder runs every pre-trade check, locks the order's funds and
+// persists it, returning the engine it should be matched on and any soft
+// limit warnings
+func (ex *Exchange) acceptOrder(ctx context.Context, order *domain.Order) (*MatchingEngine, []RiskWarning, error) {
+	if err := ex.checkWritable(); err != nil {
+		return nil, nil, err
+	}
+	if err := ex.checkTradingOpen(); err != nil {
+		return nil, nil, err
+	}
+	if err := ex.checkUserEnabled(order.UserID); err != nil {
+		return nil, nil, err
+	}
+
 	ex.mu.RLock()
 	engine, exists := ex.engines[order.Symbol]
 	ex.mu.RUnlock()
 
 	if !exists {
-		return nil
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownSymbol, order.Symbol)
+	}
+	if err := ex.checkReady(order.Symbol); err != nil {
+		return nil, nil, err
 	}
 
-	if err := ex.orderStore.SaveOrder(order); err != nil {
-		return err
+	if err := ex.validateOrder(order); err != nil {
+		return nil, nil, err
 	}
 
-	go engine.ProcessOrder(order)
-	return nil
+	warnings, err := ex.checkRiskLimits(ctx, order)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := ex.lockFunds(ctx, order); err != nil {
+		return nil, nil, err
+	}
+
+	if err := ex.orderStore.SaveOrder(ctx, order); err != nil {
+		if unlockErr := ex.releaseReservation(order.ID); unlockErr != nil {
+			log.Printf("Failed to release lock for unsaved order %s: %v%s", order.ID, unlockErr, requestTag(order.RequestID))
+		}
+		return nil, nil, err
+	}
+	ex.openOrders.put(order)
+
+	ex.recordAcceptedOrder(order, warnings)
+	if order.RequestID != "" {
+		log.Printf("Accepted order %s: %s %s %.8f %s @ %.2f%s",
+			order.ID, order.Side, order.Type, order.Quantity, order.Symbol, order.Price, requestTag(order.RequestID))
+	}
+	return engine, warnings, nil
 }
 
-func (ex *Exchange) CancelOrder(orderID, symbol string) bool {
+// CancelOrder cancels a resting order on symbol. With a userID, the order
+// must be that user's or ErrNotOwner is returned; an empty userID cancels
+// anyone's order. A caller that has already given up leaves the order
+// resting.
+func (ex *Exchange) CancelOrder(ctx context.Context, orderID, symbol, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := ex.checkWritable(); err != nil {
+		return err
+	}
+	if err := ex.beginWrite(); err != nil {
+		return err
+	}
+	defer ex.inflight.Done()
+
 	ex.mu.RLock()
 	engine, exists := ex.engines[symbol]
 	ex.mu.RUnlock()
 
 	if !exists {
-		return false
+		return fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+	}
+	if err := ex.checkReady(symbol); err != nil {
+		return err
+	}
+
+	// The lock is released when the cancellation's order update is processed,
+	// after any fills the engine emitted before it have been settled
+	switch engine.cancelOwned(orderID, userID) {
+	case CancelNotFound:
+		return ErrOrderNotFound
+	case CancelNotOwner:
+		return ErrNotOwner
+	}
+
+	return nil
+}
+
+// CancelAll cancels the resting and stop orders of userID, or of every user
+// when userID is empty, on symbol, or on every symbol when symbol is empty.
+// Engines are swept one at a time, each locked only for its own sweep. Like
+// CancelOrder, locks are released as the cancellations are processed. It
+// returns how many orders were cancelled.
+func (ex *Exchange) CancelAll(userID, symbol string) (int, error) {
+	// Sweeping every user is an operator action, not the owners' request
+	reason := ""
+	if userID == "" {
+		reason = domain.CancelReasonAdmin
+	}
+	return ex.cancelAll(userID, symbol, reason)
+}
+
+// cancelAll is CancelAll with the reason the cancellations are tagged with
+func (ex *Exchange) cancelAll(userID, symbol, reason string) (int, error) {
+	if err := ex.checkWritable(); err != nil {
+		return 0, err
+	}
+	if err := ex.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer ex.inflight.Done()
+
+	symbols := ex.engineSymbols()
+	if symbol != "" {
+		ex.mu.RLock()
+		_, exists := ex.engines[symbol]
+		ex.mu.RUnlock()
+		if !exists {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+		}
+		if err := ex.checkReady(symbol); err != nil {
+			return 0, err
+		}
+		symbols = []string{symbol}
+	}
+
+	match := func(order *domain.Order) bool { return userID == "" || order.UserID == userID }
+	cancelled := 0
+	for _, sym := range symbols {
+		// A recovering book has none of its orders loaded yet
+		if ex.checkReady(sym) != nil {
+			continue
+		}
+		ex.mu.RLock()
+		engine := ex.engines[sym]
+		ex.mu.RUnlock()
+
+		cancelled += len(engine.CancelWhere(match, reason))
+	}
+
+	log.Printf("Cancelled %d orders (user %q, symbol %q)", cancelled, userID, symbol)
+	return cancelled, nil
+}
+
+// OpenOrders is a snapshot of a user's open orders. Sequences has each
+// snapshotted symbol's engine sequence; order updates with a higher seq are
+// newer than the snapshot. Source says whether it came from the engine's
+// index or, while symbols recover, the database.
+type OpenOrders struct {
+	Orders    []*domain.Order   `json:"orders"`
+	Sequences map[string]uint64 `json:"sequences"`
+	Source    string            `json:"source"`
+}
+
+// Where an OpenOrders snapshot was read from
+const (
+	OpenOrdersFromIndex    = "index"
+	OpenOrdersFromDatabase = "database"
+)
+
+// GetOpenOrders returns a user's open orders on one symbol, or on every
+// symbol when symbol is empty, oldest first within each symbol. They come
+// from the open-orders index, which reflects every order update processed so
+// far. It returns ErrExchangeStarting while a requested symbol's orders are
+// still being recovered.
+func (ex *Exchange) GetOpenOrders(userID, symbol string) (*OpenOrders, error) {
+	symbols := ex.engineSymbols()
+	if symbol != "" {
+		ex.mu.RLock()
+		_, exists := ex.engines[symbol]
+		ex.mu.RUnlock()
+		if !exists {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+		}
+		symbols = []string{symbol}
+	}
+	for _, s := range symbols {
+		if err := ex.checkReady(s); err != nil {
+			return nil, err
+		}
 	}
 
-	return engine.CancelOrder(orderID)
+	open := &OpenOrders{
+		Orders:    ex.openOrders.forUser(userID, symbol),
+		Sequences: make(map[string]uint64, len(symbols)),
+		Source:    OpenOrdersFromIndex,
+	}
+	for _, s := range symbols {
+		open.Sequences[s] = ex.openOrders.seq(s)
+	}
+	sort.Slice(open.Orders, func(i, j int) bool {
+		a, b := open.Orders[i], open.Orders[j]
+		if a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	return open, nil
 }
 
 func (ex *Exchange) GetOrderBook(symbol string, depth int) *domain.OrderBook {
@@ -109,61 +535,136 @@ func (ex *Exchange) GetOrderBook(symbol string, depth int) *domain.OrderBook {
 			Symbol:    symbol,
 			Bids:      []domain.OrderBookLevel{},
 			Asks:      []domain.OrderBookLevel{},
-			Timestamp: time.Now(),
+			Timestamp: domain.Now(),
 		}
 	}
 
 	return engine.GetOrderBook(depth)
 }
 
-func (ex *Exchange) processAllTrades() {
+// processEvents consumes every engine's trades and order updates, then its
+// top of book and the levels of its book that changed. All are handled on
+// one goroutine so that the trades an order update depends on are always
+// settled before the update itself (and any lock release it triggers).
+// Engines are drained in symbol order so simulated runs replay identically.
+func (ex *Exchange) processEvents() {
+	ex.drainMu.Lock()
+	defer ex.drainMu.Unlock()
+	for _, symbol := range ex.engineSymbols() {
+		ex.mu.RLock()
+		engine := ex.engines[symbol]
+		ex.mu.RUnlock()
+		ex.drainEngine(engine)
+		ex.drainBookTicker(engine)
+		ex.drainOrderBook(engine)
+	}
+}
+
+// drainEngine processes everything an engine has emitted so far. The engine
+// journals a change before sending its trades and order updates, and sends a
+// fill's trade before the matching order updates, so draining the journal
+// then trades after receiving an update guarantees they are handled first.
+func (ex *Exchange) drainEngine(engine *MatchingEngine) {
 	for {
+		ex.drainJournal(engine)
+		ex.drainTrades(engine)
 		select {
-		case <-ex.ctx.Done():
-			return
+		case order := <-engine.OrderUpdatesChan():
+			ex.drainJournal(engine)
+			ex.drainTrades(engine)
+			ex.handleOrderUpdate(order)
 		default:
-			ex.mu.RLock()
-			for _, engine := range ex.engines {
-				select {
-				case trade := <-engine.TradeChan():
-					if err := ex.tradeStore.SaveTrade(trade); err != nil {
-						log.Printf("Failed to save trade: %v", err)
-					}
-					// Settle balances for the trade
-					if err := ex.settleTrade(trade); err != nil {
-						log.Printf("Failed to settle trade balances: %v", err)
-					}
-					// Broadcast trade via callback
-					if ex.onTrade != nil {
-						ex.onTrade(trade)
-					}
-				default:
-				}
-			}
-			ex.mu.RUnlock()
-			time.Sleep(10 * time.Millisecond)
+			return
 		}
 	}
 }
 
-func (ex *Exchange) processAllOrderUpdates() {
+func (ex *Exchange) drainTrades(engine *MatchingEngine) {
 	for {
 		select {
-		case <-ex.ctx.Done():
-			return
+		case trade := <-engine.TradeChan():
+			ex.drainJournal(engine)
+			ex.handleTrade(trade)
 		default:
-			ex.mu.RLock()
-			for _, engine := range ex.engines {
-				select {
-				case order := <-engine.OrderUpdatesChan():
-					if err := ex.orderStore.UpdateOrder(order); err != nil {
-						log.Printf("Failed to update order: %v", err)
-					}
-				default:
-				}
-			}
-			ex.mu.RUnlock()
-			time.Sleep(10 * time.Millisecond)
+			return
+		}
+	}
+}
+
+func (ex *Exchange) handleTrade(trade *domain.Trade) {
+	// The primary already persisted and settled this trade
+	if ex.IsStandby() {
+		ex.consumeReservation(trade.BuyOrderID, trade.Price*trade.Quantity)
+		ex.consumeReservation(trade.SellOrderID, trade.Quantity)
+		return
+	}
+
+	inserted, err := ex.tradeStore.SaveTrade(ex.background(), trade)
+	if err == nil {
+		ex.recordPersistLag(trade.Symbol, domain.Now().Sub(trade.ExecutedAt))
+	}
+	switch {
+	case err != nil:
+		log.Printf("Failed to save trade %s, queued for retry: %v%s", trade.ID, err, requestTag(trade.RequestID))
+		ex.queueSettlement(trade, false, err)
+	case !inserted:
+		// Settling again would move the same funds twice
+		atomic.AddUint64(&ex.duplicateTrades, 1)
+		log.Printf("Skipping duplicate trade %s (taker %s, maker %s)%s", trade.ID, trade.TakerOrderID, trade.MakerOrderID, requestTag(trade.RequestID))
+		return
+	default:
+		if err := ex.settleTrade(trade); err != nil {
+			log.Printf("Failed to settle trade %s, queued for retry: %v%s", trade.ID, err, requestTag(trade.RequestID))
+			ex.queueSettlement(trade, true, err)
+		}
+	}
+
+	// The traded funds are spent even while settlement is pending, so they
+	// must not be released with the rest of the order's lock
+	ex.consumeReservation(trade.BuyOrderID, trade.Price*trade.Quantity)
+	ex.consumeReservation(trade.SellOrderID, trade.Quantity)
+
+	if trade.RequestID != "" {
+		log.Printf("Trade %s: %.8f %s @ %.2f (taker %s, maker %s)%s", trade.ID, trade.Quantity, trade.Symbol,
+			trade.Price, trade.TakerOrderID, trade.MakerOrderID, requestTag(trade.RequestID))
+	}
+
+	// Broadcast trade via callback
+	if ex.onTrade != nil {
+		ex.onTrade(trade)
+	}
+}
+
+func (ex *Exchange) handleOrderUpdate(order *domain.Order) {
+	ex.recordOrderEvent(order.Symbol)
+	ex.openOrders.apply(order)
+
+	// The primary already persisted this update and unlocked the funds
+	if ex.IsStandby() {
+		if isTerminal(order.Status) {
+			ex.resMu.Lock()
+			delete(ex.reservations, order.ID)
+			ex.resMu.Unlock()
+		}
+		return
+	}
+
+	if order.RequestID != "" {
+		log.Printf("Order %s %s: %.8f of %.8f filled%s",
+			order.ID, order.Status, order.FilledQuantity, order.Quantity, requestTag(order.RequestID))
+	}
+	if err := ex.orderStore.UpdateOrder(ex.background(), order); err != nil {
+		log.Printf("Failed to update order: %v%s", err, requestTag(order.RequestID))
+	} else if ex.onOrder != nil {
+		ex.onOrder(order)
+	}
+	ex.notifyOrderEnded(order)
+
+	// Once an order can no longer fill, whatever it still has locked (an
+	// unfilled remainder or a limit buy's price improvement) goes back
+	if isTerminal(order.Status) {
+		if err := ex.releaseReservation(order.ID); err != nil {
+			log.Printf("Failed to release lock for order %s: %v%s", order.ID, err, requestTag(order.RequestID))
 		}
 	}
 }
@@ -173,13 +674,22 @@ func (ex *Exchange) UpdatePrice(symbol string, price float64) {
 	engine, exists := ex.engines[symbol]
 	ex.mu.RUnlock()
 
+	ex.priceMu.Lock()
+	ex.lastPrices[symbol] = price
+	ex.priceMu.Unlock()
+
 	if exists {
 		engine.CheckStopOrders(price)
 	}
 }
 
-func (ex *Exchange) Stop() {
-	ex.cancel()
+// LastPrice returns the latest reference price the price feed has given a
+// symbol, and false if it has given none yet
+func (ex *Exchange) LastPrice(symbol string) (float64, bool) {
+	ex.priceMu.RLock()
+	defer ex.priceMu.RUnlock()
+	price, ok := ex.lastPrices[symbol]
+	return price, ok
 }
 
 // SetOnTradeCallback sets the callback to be called when a trade executes
@@ -187,73 +697,75 @@ func (ex *Exchange) SetOnTradeCallback(callback func(*domain.Trade)) {
 	ex.onTrade = callback
 }
 
-// settleTrade updates balances for buyer and seller after a trade
+// SetOnPositionUpdateCallback sets the callback to be called with each
+// position changed by a settled trade
+func (ex *Exchange) SetOnPositionUpdateCallback(callback func(*domain.Position)) {
+	ex.onPosition = callback
+}
+
+// SetOnOrderUpdateCallback sets the callback to be called with each order
+// state change once it has been persisted
+func (ex *Exchange) SetOnOrderUpdateCallback(callback func(*domain.Order)) {
+	ex.onOrder = callback
+}
+
+// settleTrade moves funds for a trade: the buyer's quote and the seller's base
+// come out of the amounts locked when their orders were placed, and what each
+// side receives lands in available. Both sides' positions move in the same
+// transaction.
 func (ex *Exchange) settleTrade(trade *domain.Trade) error {
-	// Parse symbol to get base and quote assets (e.g., "BTC-USD" -> "BTC", "USD")
-	baseAsset, quoteAsset := ex.parseSymbol(trade.Symbol)
-	
-	tradeValue := trade.Price * trade.Quantity
-	
-	// Update buyer balances: -quote asset (USD), +base asset (BTC)
-	buyerQuoteAvail, buyerQuoteLocked, err := ex.balanceStore.GetBalance(trade.BuyerID, quoteAsset)
+	baseAsset, quoteAsset, err := ex.symbolAssets(trade.Symbol)
 	if err != nil {
 		return err
 	}
-	buyerBaseAvail, buyerBaseLocked, err := ex.balanceStore.GetBalance(trade.BuyerID, baseAsset)
-	if err != nil {
-		return err
-	}
-	
-	newBuyerQuoteAvail := buyerQuoteAvail - tradeValue  // DEDUCT USD from available
-	newBuyerQuoteLocked := buyerQuoteLocked              // Keep locked as-is for now
-	if err := ex.balanceStore.UpdateBalance(trade.BuyerID, quoteAsset, newBuyerQuoteAvail, newBuyerQuoteLocked); err != nil {
-		return err
+	tradeValue := trade.Price * trade.Quantity
+
+	deltas := []BalanceDelta{
+		{UserID: trade.BuyerID, Asset: quoteAsset, Locked: -tradeValue},
+		{UserID: trade.BuyerID, Asset: baseAsset, Available: trade.Quantity},
+		{UserID: trade.SellerID, Asset: baseAsset, Locked: -trade.Quantity},
+		{UserID: trade.SellerID, Asset: quoteAsset, Available: tradeValue},
 	}
-	
-	newBuyerBaseAvail := buyerBaseAvail + trade.Quantity  // ADD BTC to available
-	newBuyerBaseLocked := buyerBaseLocked
-	if err := ex.balanceStore.UpdateBalance(trade.BuyerID, baseAsset, newBuyerBaseAvail, newBuyerBaseLocked); err != nil {
-		return err
+	fills := []PositionFill{
+		{UserID: trade.BuyerID, Symbol: trade.Symbol, Quantity: trade.Quantity, Price: trade.Price},
+		{UserID: trade.SellerID, Symbol: trade.Symbol, Quantity: -trade.Quantity, Price: trade.Price},
 	}
-	
-	// Update seller balances: +quote asset (USD), -base asset (BTC)
-	sellerQuoteAvail, sellerQuoteLocked, err := ex.balanceStore.GetBalance(trade.SellerID, quoteAsset)
-	if err != nil {
-		return err
+	positions, err := ex.balanceStore.SettleTrade(ex.background(), trade.ID, deltas, fills)
+	if errors.Is(err, ErrAlreadySettled) {
+		atomic.AddUint64(&ex.settlementsSkipped, 1)
+		log.Printf("Skipping settlement of trade %s, already settled", trade.ID)
+		return nil
 	}
-	sellerBaseAvail, sellerBaseLocked, err := ex.balanceStore.GetBalance(trade.SellerID, baseAsset)
 	if err != nil {
 		return err
 	}
-	
-	newSellerQuoteAvail := sellerQuoteAvail + tradeValue  // ADD USD to available
-	newSellerQuoteLocked := sellerQuoteLocked
-	if err := ex.balanceStore.UpdateBalance(trade.SellerID, quoteAsset, newSellerQuoteAvail, newSellerQuoteLocked); err != nil {
-		return err
-	}
-	
-	newSellerBaseAvail := sellerBaseAvail - trade.Quantity  // DEDUCT BTC from available
-	newSellerBaseLocked := sellerBaseLocked
-	if err := ex.balanceStore.UpdateBalance(trade.SellerID, baseAsset, newSellerBaseAvail, newSellerBaseLocked); err != nil {
-		return err
+	if ex.onPosition != nil {
+		for _, position := range positions {
+			ex.onPosition(position)
+		}
 	}
-	
+
+	ex.notifyBalances(trade.BuyerID, BalanceCauseTrade, quoteAsset, baseAsset)
+	ex.notifyBalances(trade.SellerID, BalanceCauseTrade, baseAsset, quoteAsset)
 	return nil
 }
 
-// parseSymbol splits a symbol like "BTC-USD" into base and quote assets
-func (ex *Exchange) parseSymbol(symbol string) (base, quote string) {
-	// Simple split on "-"
-	parts := []rune(symbol)
-	for i, r := range parts {
-		if r == '-' {
-			return string(parts[:i]), string(parts[i+1:])
-		}
+// GetAllSymbols returns the listed symbols in order
+func (ex *Exchange) GetAllSymbols() []string {
+	ex.mu.RLock()
+	defer ex.mu.RUnlock()
+
+	symbols := make([]string, 0, len(ex.symbols))
+	for symbol := range ex.symbols {
+		symbols = append(symbols, symbol)
 	}
-	return symbol, "USD" // fallback
+	sort.Strings(symbols)
+	return symbols
 }
 
-func (ex *Exchange) GetAllSymbols() []string {
+// engineSymbols returns every symbol with an engine, including delisted ones
+// whose halted engines may still emit cancellations
+func (ex *Exchange) engineSymbols() []string {
 	ex.mu.RLock()
 	defer ex.mu.RUnlock()
 
@@ -261,5 +773,15 @@ func (ex *Exchange) GetAllSymbols() []string {
 	for symbol := range ex.engines {
 		symbols = append(symbols, symbol)
 	}
+	sort.Strings(symbols)
 	return symbols
 }
+
+// requestTag suffixes a log line with the HTTP request that placed an order,
+// so an order's engine and settlement lines can be found from the request log
+func requestTag(requestID string) string {
+	if requestID == "" {
+		return ""
+	}
+	return " request_id=" + requestID
+}
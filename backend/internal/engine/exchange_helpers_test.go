@@ -0,0 +1,116 @@
+package engine_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/engine/enginetest"
+)
+
+// referencePrice is where BTC-USD is priced for every test exchange
+const referencePrice = 45000.0
+
+// testExchange is a running exchange listing BTC-USD over an in-memory
+// store, with every order update it publishes. Options passed to
+// newTestExchange are applied before it starts, which is when callbacks
+// must be set.
+type testExchange struct {
+	*engine.Exchange
+	store   *enginetest.Store
+	updates chan *domain.Order
+}
+
+func newTestExchange(t *testing.T, options ...func(*engine.Exchange)) *testExchange {
+	t.Helper()
+	store := enginetest.NewStore()
+	return startTestExchange(t, store, store, store, options...)
+}
+
+// startTestExchange is newTestExchange saving trades and orders to the
+// given stores instead of the in-memory one
+func startTestExchange(t *testing.T, store *enginetest.Store, trades engine.TradeStore, orders engine.OrderStore, options ...func(*engine.Exchange)) *testExchange {
+	t.Helper()
+	ex := &testExchange{
+		Exchange: engine.NewExchange(trades, orders, store),
+		store:    store,
+		updates:  make(chan *domain.Order, 10000),
+	}
+	// Updates past the buffer are dropped rather than stall a test that
+	// floods the exchange without waiting on any
+	ex.SetOnOrderUpdateCallback(func(order *domain.Order) {
+		copied := *order
+		select {
+		case ex.updates <- &copied:
+		default:
+		}
+	})
+	if err := ex.AddSymbol(btcConfig()); err != nil {
+		t.Fatal(err)
+	}
+	ex.UpdatePrice("BTC-USD", referencePrice)
+	for _, option := range options {
+		option(ex.Exchange)
+	}
+	ex.Start()
+	t.Cleanup(ex.Stop)
+	return ex
+}
+
+func btcConfig() domain.SymbolConfig {
+	for _, config := range domain.DefaultSymbolConfigs() {
+		if config.Symbol == "BTC-USD" {
+			return config
+		}
+	}
+	panic("BTC-USD is not a default symbol")
+}
+
+// submit places an order, failing the test if it is refused
+func (ex *testExchange) submit(t *testing.T, userID string, side domain.OrderSide, orderType domain.OrderType, quantity, price float64) *domain.Order {
+	t.Helper()
+	order := domain.NewOrder(userID, "BTC-USD", side, orderType, quantity, price)
+	if err := ex.SubmitOrder(context.Background(), order); err != nil {
+		t.Fatalf("submitting %s %s %g @ %g: %v", side, orderType, quantity, price, err)
+	}
+	return order
+}
+
+// rest places a limit order and waits until it rests on the book
+func (ex *testExchange) rest(t *testing.T, userID string, side domain.OrderSide, quantity, price float64) *domain.Order {
+	t.Helper()
+	order := ex.submit(t, userID, side, domain.OrderTypeLimit, quantity, price)
+	ex.waitFor(t, order.ID, func(update *domain.Order) bool { return update.Status == domain.OrderStatusPending })
+	return order
+}
+
+// waitFor returns the first update to orderID that done accepts
+func (ex *testExchange) waitFor(t *testing.T, orderID string, done func(*domain.Order) bool) *domain.Order {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case update := <-ex.updates:
+			if update.ID == orderID && done(update) {
+				return update
+			}
+		case <-timeout:
+			t.Fatalf("order %s never reached the expected state", orderID)
+		}
+	}
+}
+
+// eventually waits for check to hold, as settlement lands after the order
+// updates that report it
+func (ex *testExchange) eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// ErrExecutionTimeout is returned when a synchronous submission was accepted
+// but matching did not finish in time; the order is still processed
+var ErrExecutionTimeout = errors.New("order accepted but execution result not available in time")
+
+// ExecutionReport is an order's state right after initial matching
+type ExecutionReport struct {
+	Order    domain.Order    `json:"order"`
+	AvgPrice float64         `json:"avg_price"`
+	Fills    []*domain.Trade `json:"fills"`
+	Warnings []RiskWarning   `json:"warnings,omitempty"`
+}
+
+// SubmitOrderSync accepts an order like SubmitOrder but waits for the engine
+// to finish matching it, returning the resulting status and immediate fills.
+// If ctx ends first, ErrExecutionTimeout is returned and matching carries on.
+func (ex *Exchange) SubmitOrderSync(ctx context.Context, order *domain.Order) (*ExecutionReport, error) {
+	if err := ex.beginWrite(); err != nil {
+		return nil, err
+	}
+	engine, warnings, err := ex.acceptOrder(ctx, order)
+	if err != nil {
+		ex.inflight.Done()
+		return nil, err
+	}
+
+	done := make(chan *ExecutionReport, 1)
+	ex.clock.Go(func() {
+		defer ex.inflight.Done()
+		snapshot, fills := engine.ProcessOrderWithFills(order)
+		report := newExecutionReport(snapshot, fills)
+		report.Warnings = warnings
+		done <- report
+	})
+
+	select {
+	case report := <-done:
+		return report, nil
+	case <-ctx.Done():
+		return nil, ErrExecutionTimeout
+	}
+}
+
+func newExecutionReport(order domain.Order, fills []*domain.Trade) *ExecutionReport {
+	report := &ExecutionReport{Order: order, Fills: fills}
+
+	var notional, quantity float64
+	for _, fill := range fills {
+		notional += fill.Price * fill.Quantity
+		quantity += fill.Quantity
+	}
+	if quantity > 0 {
+		report.AvgPrice = notional / quantity
+	}
+	return report
+}
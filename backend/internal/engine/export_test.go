@@ -0,0 +1,20 @@
+package engine
+
+import "github.com/hft-exchange/backend/internal/domain"
+
+// HandleTrade runs a trade through the path every trade an engine emits
+// takes, as a redelivery would
+func (ex *Exchange) HandleTrade(trade *domain.Trade) {
+	ex.drainMu.Lock()
+	defer ex.drainMu.Unlock()
+	ex.handleTrade(trade)
+}
+
+// StaleSweepSymbols is how many books one stale order sweep visits
+const StaleSweepSymbols = staleSweepSymbols
+
+// SweepStaleOrders runs one pass of the stale order sweeper, as its timer
+// would
+func (ex *Exchange) SweepStaleOrders() {
+	ex.sweepStaleOrders()
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// restingQuantity is what a full book snapshot keeps of each resting order
+type restingQuantity struct {
+	price    float64
+	quantity float64
+}
+
+// restingQuantities copies the price and remaining quantity of every resting
+// order, and the sequence they are current as of, under the read lock. It
+// does nothing else there, so even a very deep book holds matching up only
+// for the copy.
+func (me *MatchingEngine) restingQuantities() (bids, asks []restingQuantity, seq uint64) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	bids = make([]restingQuantity, len(me.buyOrders.orders))
+	for i, order := range me.buyOrders.orders {
+		bids[i] = restingQuantity{order.Price, order.RemainingQty}
+	}
+	asks = make([]restingQuantity, len(me.sellOrders.orders))
+	for i, order := range me.sellOrders.orders {
+		asks[i] = restingQuantity{order.Price, order.RemainingQty}
+	}
+	return bids, asks, me.seq
+}
+
+// FullOrderBook returns every level of symbol's book, best prices first, as
+// it stood at the book's Seq. Resting orders are copied under the engine's
+// lock and aggregated after it is released.
+func (ex *Exchange) FullOrderBook(symbol string) (*domain.OrderBook, error) {
+	ex.mu.RLock()
+	engine, exists := ex.engines[symbol]
+	ex.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+	}
+	if err := ex.checkReady(symbol); err != nil {
+		return nil, err
+	}
+
+	bids, asks, seq := engine.restingQuantities()
+	return &domain.OrderBook{
+		Symbol:    symbol,
+		Bids:      aggregateLevels(bids, true),
+		Asks:      aggregateLevels(asks, false),
+		Timestamp: domain.Now(),
+		Seq:       seq,
+	}, nil
+}
+
+// aggregateLevels sums resting orders into price levels, best first. Dust
+// left by partial fills is skipped as the depth-limited book skips it.
+func aggregateLevels(resting []restingQuantity, isBuy bool) []domain.OrderBookLevel {
+	sort.Slice(resting, func(i, j int) bool {
+		if isBuy {
+			return resting[i].price > resting[j].price
+		}
+		return resting[i].price < resting[j].price
+	})
+
+	levels := make([]domain.OrderBookLevel, 0)
+	for _, r := range resting {
+		if isDust(r.quantity) {
+			continue
+		}
+		if n := len(levels); n > 0 && levels[n-1].Price == r.price {
+			levels[n-1].Quantity += r.quantity
+			levels[n-1].Orders++
+			continue
+		}
+		levels = append(levels, domain.OrderBookLevel{Price: r.price, Quantity: r.quantity, Orders: 1})
+	}
+	return levels
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrWithdrawalLimit is returned when a withdrawal would take a user past the
+// daily cap for its asset
+var ErrWithdrawalLimit = errors.New("withdrawal_limit_exceeded")
+
+// Funding movement types
+const (
+	FundingDeposit    = "DEPOSIT"
+	FundingWithdrawal = "WITHDRAWAL"
+)
+
+// Causes reported with balance updates from deposits and withdrawals
+const (
+	BalanceCauseDeposit    = "deposit"
+	BalanceCauseWithdrawal = "withdrawal"
+)
+
+// Funding records money a user moved into or out of the exchange
+type Funding struct {
+	ID     string  `json:"id"`
+	UserID string  `json:"user_id"`
+	Asset  string  `json:"asset"`
+	Type   string  `json:"type"`
+	Amount float64 `json:"amount"`
+	// Available is the balance right after the movement
+	Available float64   `json:"available"`
+	LedgerID  string    `json:"ledger_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SetWithdrawalLimits caps how much of each asset a user may withdraw per UTC
+// day. Assets without a positive cap are unlimited.
+func (ex *Exchange) SetWithdrawalLimits(limits map[string]float64) {
+	ex.withdrawalLimits = limits
+}
+
+// Deposit credits amount of an asset to a user's available balance
+func (ex *Exchange) Deposit(ctx context.Context, userID, asset string, amount float64) (*Funding, error) {
+	return ex.fund(ctx, userID, asset, FundingDeposit, amount)
+}
+
+// Withdraw debits amount of an asset from a user's available balance. Funds
+// locked by open orders can't be withdrawn.
+func (ex *Exchange) Withdraw(ctx context.Context, userID, asset string, amount float64) (*Funding, error) {
+	return ex.fund(ctx, userID, asset, FundingWithdrawal, amount)
+}
+
+func (ex *Exchange) fund(ctx context.Context, userID, asset, kind string, amount float64) (*Funding, error) {
+	if err := ex.checkLedger(asset, amount); err != nil {
+		return nil, err
+	}
+	if userID == "" {
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidTransfer)
+	}
+
+	limit := 0.0
+	if kind == FundingWithdrawal {
+		limit = ex.withdrawalLimits[asset]
+	}
+	funding, err := ex.ledgerStore.Fund(ctx, userID, asset, kind, amount, limit)
+	if errors.Is(err, ErrInsufficientBalance) {
+		return nil, fmt.Errorf("%w: %s has less than %v %s available", ErrInsufficientBalance, userID, amount, asset)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cause := BalanceCauseDeposit
+	if kind == FundingWithdrawal {
+		cause = BalanceCauseWithdrawal
+	}
+	ex.notifyBalances(userID, cause, asset)
+	return funding, nil
+}
@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// ChannelStats is how full one of an engine's event channels is
+type ChannelStats struct {
+	Len         int     `json:"len"`
+	Cap         int     `json:"cap"`
+	Utilization float64 `json:"utilization"`
+}
+
+func channelStats(length, capacity int) ChannelStats {
+	stats := ChannelStats{Len: length, Cap: capacity}
+	if capacity > 0 {
+		stats.Utilization = float64(length) / float64(capacity)
+	}
+	return stats
+}
+
+// EngineStats is a point-in-time view of a matching engine's internals. Best
+// bid and ask are the tops of the heaps, dust included, so a stuck order
+// shows up here even though snapshots hide it.
+type EngineStats struct {
+	Symbol        string       `json:"symbol"`
+	RestingBuys   int          `json:"resting_buys"`
+	RestingSells  int          `json:"resting_sells"`
+	PendingStops  int          `json:"pending_stops"`
+	BestBid       *float64     `json:"best_bid"`
+	BestAsk       *float64     `json:"best_ask"`
+	BestBidOrder  string       `json:"best_bid_order,omitempty"`
+	BestAskOrder  string       `json:"best_ask_order,omitempty"`
+	TradeChan     ChannelStats `json:"trade_chan"`
+	OrderUpdates  ChannelStats `json:"order_updates"`
+	LastTradeSeq  uint64       `json:"last_trade_seq"`
+	LastUpdateSeq uint64       `json:"last_update_seq"`
+	JournalSeq    uint64       `json:"journal_seq,omitempty"`
+	Halted        bool         `json:"halted"`
+}
+
+// Stats reports the engine's book sizes, top of book, channel backlog and
+// sequences without changing anything
+func (me *MatchingEngine) Stats() EngineStats {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	stats := EngineStats{
+		Symbol:        me.symbol,
+		RestingBuys:   me.buyOrders.Len(),
+		RestingSells:  me.sellOrders.Len(),
+		PendingStops:  len(me.stopLimitOrders),
+		TradeChan:     channelStats(len(me.tradeChan), cap(me.tradeChan)),
+		OrderUpdates:  channelStats(len(me.orderUpdates), cap(me.orderUpdates)),
+		LastTradeSeq:  me.tradeSeq,
+		LastUpdateSeq: me.seq,
+		JournalSeq:    me.journalSeq,
+		Halted:        me.halted,
+	}
+	if me.buyOrders.Len() > 0 {
+		best := me.buyOrders.orders[0]
+		price := best.Price
+		stats.BestBid = &price
+		stats.BestBidOrder = best.ID
+	}
+	if me.sellOrders.Len() > 0 {
+		best := me.sellOrders.orders[0]
+		price := best.Price
+		stats.BestAsk = &price
+		stats.BestAskOrder = best.ID
+	}
+	return stats
+}
+
+// PurgeOrder removes a resting or pending stop order whatever its state,
+// including a partial fill whose remainder is dust, and emits it as
+// cancelled. It returns the order as purged, or false if the engine doesn't
+// hold it.
+func (me *MatchingEngine) PurgeOrder(orderID string) (domain.Order, bool) {
+	defer me.flush()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	var purged domain.Order
+	found := false
+	keep := func(orders []*domain.Order) []*domain.Order {
+		kept := orders[:0]
+		for _, order := range orders {
+			if order.ID != orderID {
+				kept = append(kept, order)
+				continue
+			}
+			me.journalRecord(&JournalRecord{Kind: JournalCancelled, OrderID: order.ID, Reason: domain.CancelReasonPurged})
+			me.recordCancelled(order.ID)
+			order.Status = domain.OrderStatusCancelled
+			order.CancelReason = domain.CancelReasonPurged
+			order.UpdatedAt = domain.Now()
+			me.emitOrderUpdate(order)
+			purged = *order
+			found = true
+		}
+		return kept
+	}
+
+	for _, h := range []*OrderHeap{me.buyOrders, me.sellOrders} {
+		if h.find(orderID) >= 0 {
+			h.reset(keep(h.orders))
+		}
+	}
+	if !found {
+		me.stopLimitOrders = keep(me.stopLimitOrders)
+	}
+	if found {
+		me.maybeSnapshot()
+		me.publishBook()
+	}
+	return purged, found
+}
+
+// EngineStats reports a symbol's engine internals
+func (ex *Exchange) EngineStats(symbol string) (EngineStats, error) {
+	ex.mu.RLock()
+	engine, exists := ex.engines[symbol]
+	ex.mu.RUnlock()
+
+	if !exists {
+		return EngineStats{}, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+	}
+	return engine.Stats(), nil
+}
+
+// PurgeOrder force-removes an order from symbol's book regardless of owner or
+// state. Its lock is released and the open orders index updated when the
+// cancellation's order update is processed, as for any cancel.
+func (ex *Exchange) PurgeOrder(symbol, orderID string) (*domain.Order, error) {
+	if err := ex.checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := ex.beginWrite(); err != nil {
+		return nil, err
+	}
+	defer ex.inflight.Done()
+
+	ex.mu.RLock()
+	engine, exists := ex.engines[symbol]
+	ex.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+	}
+	if err := ex.checkReady(symbol); err != nil {
+		return nil, err
+	}
+
+	purged, ok := engine.PurgeOrder(orderID)
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	log.Printf("🧹 Purged order %s from %s book with %.8f of %.8f filled",
+		orderID, symbol, purged.FilledQuantity, purged.Quantity)
+
+	return &purged, nil
+}
@@ -0,0 +1,313 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// Journal record kinds. Every change an engine makes to its book is recorded
+// under one of these, in the order the engine applied it.
+const (
+	JournalAccepted      = "accepted"
+	JournalCancelled     = "cancelled"
+	JournalTrade         = "trade"
+	JournalStopTriggered = "stop_triggered"
+	JournalHalt          = "halt"
+	JournalResume        = "resume"
+	JournalSnapshot      = "snapshot"
+)
+
+// journalSnapshotInterval is how many records an engine journals between
+// snapshots of its book; recovery replays at most this many
+const journalSnapshotInterval = 1000
+
+// errReplayDone stops reading the journal once a replay reaches its end
+var errReplayDone = errors.New("replay done")
+
+// JournalRecord is one entry of a symbol's append-only journal. Seq increases
+// by one per record within a symbol.
+type JournalRecord struct {
+	Symbol string `json:"symbol"`
+	Seq    uint64 `json:"seq"`
+	Kind   string `json:"kind"`
+	// Order is the order as submitted, for accepted records
+	Order *domain.Order `json:"order,omitempty"`
+	// OrderID is set for cancelled and stop_triggered records, Reason for
+	// cancellations made by the exchange
+	OrderID string        `json:"order_id,omitempty"`
+	Reason  string        `json:"reason,omitempty"`
+	Trade   *domain.Trade `json:"trade,omitempty"`
+	// Orders and Halted are the whole book, for snapshot records
+	Orders     []*domain.Order `json:"orders,omitempty"`
+	Halted     bool            `json:"halted,omitempty"`
+	RecordedAt time.Time       `json:"recorded_at"`
+}
+
+// JournalStore persists journal records
+type JournalStore interface {
+	// AppendJournal stores records atomically, in order
+	AppendJournal(ctx context.Context, records []*JournalRecord) error
+	// ReadJournal calls fn with a symbol's records from fromSeq on, in
+	// sequence order, until fn returns an error
+	ReadJournal(ctx context.Context, symbol string, fromSeq uint64, fn func(*JournalRecord) error) error
+	// SnapshotSeqs lists a symbol's snapshot sequences in ascending order
+	SnapshotSeqs(ctx context.Context, symbol string) ([]uint64, error)
+	// LastJournalSeq is a symbol's highest sequence, or 0 if it has none
+	LastJournalSeq(ctx context.Context, symbol string) (uint64, error)
+}
+
+// JournalReplay is a book rebuilt from the journal
+type JournalReplay struct {
+	Symbol string
+	// Orders are the resting and untriggered stop orders
+	Orders []*domain.Order
+	Halted bool
+	// Seq is the last record applied, 0 if the journal was empty
+	Seq uint64
+	// SnapshotAt is when the snapshot the replay started from was taken
+	SnapshotAt time.Time
+	// Seen has every order the replayed records mention
+	Seen   map[string]bool
+	Trades int
+}
+
+// SetJournalStore journals every engine's changes to store. It must be
+// called before Recover, which rebuilds books from the journal and starts
+// each engine's journal once its book is back.
+func (ex *Exchange) SetJournalStore(store JournalStore) {
+	ex.journalStore = store
+}
+
+// startJournal continues a symbol's journal from the store's last record,
+// opening with a snapshot so replays never need anything before it
+func (ex *Exchange) startJournal(symbol string, engine *MatchingEngine) error {
+	seq, err := ex.journalStore.LastJournalSeq(ex.ctx, symbol)
+	if err != nil {
+		return fmt.Errorf("failed to start %s journal: %w", symbol, err)
+	}
+	engine.StartJournal(seq)
+	return nil
+}
+
+// restartJournals continues every engine's journal from the store. A
+// promoted standby calls it, since the primary wrote the records meanwhile.
+func (ex *Exchange) restartJournals() {
+	for _, symbol := range ex.engineSymbols() {
+		ex.mu.RLock()
+		engine := ex.engines[symbol]
+		ex.mu.RUnlock()
+		if err := ex.startJournal(symbol, engine); err != nil {
+			log.Printf("Journaling off for %s: %v", symbol, err)
+		}
+	}
+}
+
+// drainJournal writes everything an engine has journaled so far. It runs on
+// the event processing goroutine ahead of the trades and updates the records
+// caused, so nothing is broadcast before it is journaled. Records that fail
+// to write are kept and retried first on the next drain.
+func (ex *Exchange) drainJournal(engine *MatchingEngine) {
+	records := ex.journalBacklog
+collect:
+	for {
+		select {
+		case record := <-engine.JournalChan():
+			records = append(records, record)
+		default:
+			break collect
+		}
+	}
+	// The primary journals; a standby's records would duplicate its sequences
+	if len(records) == 0 || ex.journalStore == nil || ex.IsStandby() {
+		ex.journalBacklog = nil
+		return
+	}
+
+	if err := ex.journalStore.AppendJournal(ex.background(), records); err != nil {
+		log.Printf("Failed to journal %d records, will retry: %v", len(records), err)
+		ex.journalBacklog = records
+		return
+	}
+	ex.journalBacklog = nil
+}
+
+// journalOrders rebuilds a symbol's book from its last snapshot and the
+// records after it. Orders persisted after the snapshot that never reached
+// the journal are taken from source. A symbol with no journal yet is loaded
+// from source alone.
+func (ex *Exchange) journalOrders(source RecoverySource, symbol string) ([]*domain.Order, error) {
+	snapshots, err := ex.journalStore.SnapshotSeqs(ex.ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	var fromSeq uint64
+	if len(snapshots) > 0 {
+		fromSeq = snapshots[len(snapshots)-1]
+	}
+	replay, err := ReplayJournal(ex.ctx, ex.journalStore, symbol, fromSeq, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := source.GetOpenOrders(ex.ctx, symbol)
+	if err != nil || replay.Seq == 0 {
+		return stored, err
+	}
+	orders := replay.Orders
+	for _, order := range stored {
+		if !replay.Seen[order.ID] && order.CreatedAt.After(replay.SnapshotAt) {
+			log.Printf("Order %s on %s was accepted but never journaled, restoring it", order.ID, symbol)
+			orders = append(orders, order)
+		}
+	}
+	log.Printf("Replayed %s journal from seq %d to %d", symbol, fromSeq, replay.Seq)
+	return orders, nil
+}
+
+// ReplayJournal applies a symbol's records with sequences from fromSeq up to
+// but excluding untilSeq (0 for no limit) to a fresh engine. A snapshot at
+// fromSeq seeds the book.
+func ReplayJournal(ctx context.Context, store JournalStore, symbol string, fromSeq, untilSeq uint64) (*JournalReplay, error) {
+	me := NewMatchingEngine(symbol)
+	done := make(chan struct{})
+	defer close(done)
+	go me.discardEvents(done)
+
+	replay := &JournalReplay{Symbol: symbol, Seen: make(map[string]bool)}
+	err := store.ReadJournal(ctx, symbol, fromSeq, func(record *JournalRecord) error {
+		if untilSeq != 0 && record.Seq >= untilSeq {
+			return errReplayDone
+		}
+		if replay.Seq == 0 && record.Kind == JournalSnapshot {
+			orders := make([]*domain.Order, len(record.Orders))
+			for i, order := range record.Orders {
+				copied := *order
+				orders[i] = &copied
+				replay.Seen[order.ID] = true
+			}
+			me.RestoreOrders(orders)
+			if record.Halted {
+				me.Halt()
+			}
+			replay.SnapshotAt = record.RecordedAt
+		} else {
+			me.applyJournalRecord(record, replay)
+		}
+		replay.Seq = record.Seq
+		return nil
+	})
+	if err != nil && !errors.Is(err, errReplayDone) {
+		return nil, fmt.Errorf("failed to replay %s journal: %w", symbol, err)
+	}
+
+	me.mu.RLock()
+	replay.Orders = me.bookOrders()
+	replay.Halted = me.halted
+	me.mu.RUnlock()
+	return replay, nil
+}
+
+func (me *MatchingEngine) applyJournalRecord(record *JournalRecord, replay *JournalReplay) {
+	switch record.Kind {
+	case JournalAccepted:
+		order := *record.Order
+		replay.Seen[order.ID] = true
+		me.ProcessOrder(&order)
+	case JournalCancelled:
+		replay.Seen[record.OrderID] = true
+		me.CancelWhere(func(order *domain.Order) bool { return order.ID == record.OrderID }, record.Reason)
+	case JournalStopTriggered:
+		me.triggerStop(record.OrderID)
+	case JournalHalt:
+		me.Halt()
+	case JournalResume:
+		me.Resume()
+	case JournalTrade:
+		replay.Trades++
+	}
+}
+
+// StartJournal makes the engine journal its changes from seq on, beginning
+// with a snapshot of its book
+func (me *MatchingEngine) StartJournal(seq uint64) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	me.journaling = true
+	me.journalSeq = seq
+	me.snapshotJournal()
+}
+
+// Journaling reports whether the engine journals its changes
+func (me *MatchingEngine) Journaling() bool {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.journaling
+}
+
+func (me *MatchingEngine) JournalChan() <-chan *JournalRecord {
+	return me.journal
+}
+
+// journalRecord publishes a record with the next sequence. It must be called
+// with the engine lock held, before the record's effects are emitted.
+func (me *MatchingEngine) journalRecord(record *JournalRecord) {
+	if !me.journaling {
+		return
+	}
+	me.journalSeq++
+	record.Symbol = me.symbol
+	record.Seq = me.journalSeq
+	record.RecordedAt = domain.Now()
+	me.journal <- record
+	me.sinceSnapshot++
+}
+
+// maybeSnapshot journals a snapshot once enough records have accumulated.
+// It is called with the engine lock held at the end of an operation, when
+// the book is consistent.
+func (me *MatchingEngine) maybeSnapshot() {
+	if me.sinceSnapshot >= journalSnapshotInterval {
+		me.snapshotJournal()
+	}
+}
+
+func (me *MatchingEngine) snapshotJournal() {
+	me.journalRecord(&JournalRecord{Kind: JournalSnapshot, Orders: me.bookOrders(), Halted: me.halted})
+	me.sinceSnapshot = 0
+}
+
+// bookOrders copies every resting and stop order. It must be called with the
+// engine lock held.
+func (me *MatchingEngine) bookOrders() []*domain.Order {
+	orders := make([]*domain.Order, 0, len(me.buyOrders.orders)+len(me.sellOrders.orders)+len(me.stopLimitOrders))
+	for _, book := range [][]*domain.Order{me.buyOrders.orders, me.sellOrders.orders, me.stopLimitOrders} {
+		for _, order := range book {
+			copied := *order
+			orders = append(orders, &copied)
+		}
+	}
+	return orders
+}
+
+// triggerStop converts a pending stop order to a limit order and matches it,
+// as CheckStopOrders does when its stop price is crossed
+func (me *MatchingEngine) triggerStop(orderID string) {
+	defer me.flush()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	for i, order := range me.stopLimitOrders {
+		if order.ID == orderID {
+			me.stopLimitOrders = append(me.stopLimitOrders[:i], me.stopLimitOrders[i+1:]...)
+			order.Type = domain.OrderTypeLimit
+			me.processOrder(order)
+			return
+		}
+	}
+}
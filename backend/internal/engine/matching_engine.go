@@ -3,8 +3,9 @@ package engine
 import (
 	"container/heap"
 	"log"
+	"math"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"github.com/hft-exchange/backend/internal/domain"
 )
@@ -16,16 +17,52 @@ type MatchingEngine struct {
 	mu           sync.RWMutex
 	tradeChan    chan *domain.Trade
 	orderUpdates chan *domain.Order
+	// outbox holds the trades and order updates emitted with mu held, in
+	// order, until flush sends them once mu is released. sendMu keeps
+	// flushes from interleaving, so they go out in the order they happened.
+	outbox       []engineEvent
+	sendMu       sync.Mutex
 	stopLimitOrders []*domain.Order
+	selfChecks   uint64
+	selfRepairs  uint64
+	phantomLevels uint64
+	dustEvictions uint64
+	fills        []*domain.Trade // trades collected for a synchronous submission
+	halted       bool            // delisted: every incoming order is cancelled
+	seq          uint64          // order updates emitted so far
+	tradeSeq     uint64          // trades executed so far
+	journal      chan *JournalRecord
+	journaling   bool
+	journalSeq   uint64 // last record journaled
+	sinceSnapshot int
+	published    publishedBook // top levels last streamed, which diffs are taken against
+	bookTicker   domain.BookTicker // best bid and ask last queued
+	bookTickers  chan *domain.BookTicker
+	levels       bookLevels // top levels last queued
+	levelUpdates chan *bookLevels
+	// onAccepted and onCancelled, if set, are called with the lock held as
+	// an order is taken up for matching and as a resting order is
+	// cancelled, so the exchange replicates them in the order they applied
+	onAccepted  func(*domain.Order)
+	onCancelled func(orderID string)
+}
+
+// engineEvent is a trade or an order update waiting in the outbox
+type engineEvent struct {
+	trade *domain.Trade
+	order *domain.Order
 }
 
 func NewMatchingEngine(symbol string) *MatchingEngine {
 	me := &MatchingEngine{
 		symbol:       symbol,
-		buyOrders:    &OrderHeap{isBuy: true},
-		sellOrders:   &OrderHeap{isBuy: false},
+		buyOrders:    newOrderHeap(true),
+		sellOrders:   newOrderHeap(false),
 		tradeChan:    make(chan *domain.Trade, 1000),
 		orderUpdates: make(chan *domain.Order, 1000),
+		journal:      make(chan *JournalRecord, 1000),
+		bookTickers:  make(chan *domain.BookTicker, 1),
+		levelUpdates: make(chan *bookLevels, 1),
 		stopLimitOrders: make([]*domain.Order, 0),
 	}
 	heap.Init(me.buyOrders)
@@ -34,9 +71,74 @@ func NewMatchingEngine(symbol string) *MatchingEngine {
 }
 
 func (me *MatchingEngine) ProcessOrder(order *domain.Order) {
+	defer me.flush()
 	me.mu.Lock()
 	defer me.mu.Unlock()
 
+	me.recordAccepted(order)
+	me.processOrder(order)
+	me.maybeSnapshot()
+	me.publishBook()
+}
+
+// ProcessOrderWithFills matches an order like ProcessOrder and returns its
+// state once initial matching is done, along with the trades it executed
+func (me *MatchingEngine) ProcessOrderWithFills(order *domain.Order) (domain.Order, []*domain.Trade) {
+	defer me.flush()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	me.fills = make([]*domain.Trade, 0)
+	me.recordAccepted(order)
+	me.processOrder(order)
+	fills := me.fills
+	me.fills = nil
+	me.maybeSnapshot()
+	me.publishBook()
+
+	return *order, fills
+}
+
+// recordAccepted journals and replicates an order as matching takes it up
+func (me *MatchingEngine) recordAccepted(order *domain.Order) {
+	if me.journaling {
+		submitted := *order
+		me.journalRecord(&JournalRecord{Kind: JournalAccepted, Order: &submitted})
+	}
+	if me.onAccepted != nil {
+		me.onAccepted(order)
+	}
+}
+
+// recordCancelled replicates the cancellation of a resting order; callers
+// journal it with its reason
+func (me *MatchingEngine) recordCancelled(orderID string) {
+	if me.onCancelled != nil {
+		me.onCancelled(orderID)
+	}
+}
+
+// processOrder must be called with the engine lock held
+func (me *MatchingEngine) processOrder(order *domain.Order) {
+	// Orders accepted just before a delisting arrive after the book was
+	// cleared; cancelling them releases their funds
+	if me.halted {
+		order.Status = domain.OrderStatusCancelled
+		order.CancelReason = domain.CancelReasonDelisted
+		order.UpdatedAt = domain.Now()
+		me.emitOrderUpdate(order)
+		return
+	}
+
+	// An order with nothing left to fill must never reach the book
+	if isDust(order.RemainingQty) {
+		order.RemainingQty = 0
+		order.Status = domain.OrderStatusRejected
+		order.UpdatedAt = domain.Now()
+		me.emitOrderUpdate(order)
+		return
+	}
+
 	if order.Type == domain.OrderTypeStopLimit {
 		me.stopLimitOrders = append(me.stopLimitOrders, order)
 		return
@@ -57,6 +159,7 @@ func (me *MatchingEngine) matchLimitOrder(order *domain.Order) {
 		oppositeBook = me.buyOrders
 	}
 
+	traded := false
 	for oppositeBook.Len() > 0 && order.RemainingQty > 0 {
 		topOrder := oppositeBook.orders[0]
 
@@ -75,6 +178,7 @@ func (me *MatchingEngine) matchLimitOrder(order *domain.Order) {
 		tradePrice := topOrder.Price
 
 		me.executeTrade(order, topOrder, matchQty, tradePrice)
+		traded = true
 
 		if topOrder.RemainingQty == 0 {
 			heap.Pop(oppositeBook)
@@ -89,10 +193,14 @@ func (me *MatchingEngine) matchLimitOrder(order *domain.Order) {
 		} else {
 			heap.Push(me.sellOrders, order)
 		}
-		me.orderUpdates <- order
+		// executeTrade already published the partial fill; resting alone
+		// doesn't change the order
+		if !traded {
+			me.emitOrderUpdate(order)
+		}
 	} else if order.RemainingQty > 0 {
 		order.Status = domain.OrderStatusCancelled
-		me.orderUpdates <- order
+		me.emitOrderUpdate(order)
 	}
 }
 
@@ -104,10 +212,19 @@ func (me *MatchingEngine) matchMarketOrder(order *domain.Order) {
 		oppositeBook = me.buyOrders
 	}
 
+	spent := 0.0
 	for oppositeBook.Len() > 0 && order.RemainingQty > 0 {
 		topOrder := oppositeBook.orders[0]
 		matchQty := min(order.RemainingQty, topOrder.RemainingQty)
 		tradePrice := topOrder.Price
+		if order.Budget > 0 {
+			matchQty = min(matchQty, affordable(order.Budget-spent, tradePrice))
+			if isDust(matchQty) {
+				order.CancelReason = domain.CancelReasonBudget
+				break
+			}
+			spent += matchQty * tradePrice
+		}
 
 		me.executeTrade(order, topOrder, matchQty, tradePrice)
 
@@ -118,10 +235,13 @@ func (me *MatchingEngine) matchMarketOrder(order *domain.Order) {
 		}
 	}
 
+	// Market orders never rest: whatever the book couldn't fill is cancelled.
+	// A full fill was already published by executeTrade.
 	if order.RemainingQty > 0 {
-		order.Status = domain.OrderStatusPartial
+		order.Status = domain.OrderStatusCancelled
+		order.UpdatedAt = domain.Now()
+		me.emitOrderUpdate(order)
 	}
-	me.orderUpdates <- order
 }
 
 func (me *MatchingEngine) executeTrade(order1, order2 *domain.Order, quantity, price float64) {
@@ -130,6 +250,14 @@ func (me *MatchingEngine) executeTrade(order1, order2 *domain.Order, quantity, p
 	order2.FilledQuantity += quantity
 	order2.RemainingQty -= quantity
 
+	// Snap float residue to zero so a filled order can't linger as phantom liquidity
+	if isDust(order1.RemainingQty) {
+		order1.RemainingQty = 0
+	}
+	if isDust(order2.RemainingQty) {
+		order2.RemainingQty = 0
+	}
+
 	if order1.RemainingQty == 0 {
 		order1.Status = domain.OrderStatusFilled
 	} else {
@@ -142,8 +270,8 @@ func (me *MatchingEngine) executeTrade(order1, order2 *domain.Order, quantity, p
 		order2.Status = domain.OrderStatusPartial
 	}
 
-	order1.UpdatedAt = time.Now()
-	order2.UpdatedAt = time.Now()
+	order1.UpdatedAt = domain.Now()
+	order2.UpdatedAt = domain.Now()
 
 	var buyOrderID, sellOrderID, buyerID, sellerID string
 	if order1.Side == domain.OrderSideBuy {
@@ -161,15 +289,28 @@ func (me *MatchingEngine) executeTrade(order1, order2 *domain.Order, quantity, p
 	makerOrderID := order2.ID
 	takerOrderID := order1.ID
 
+	me.tradeSeq++
 	trade := domain.NewTrade(me.symbol, buyOrderID, sellOrderID, buyerID, sellerID, price, quantity, makerOrderID, takerOrderID)
-	me.tradeChan <- trade
-	me.orderUpdates <- order1
-	me.orderUpdates <- order2
+	trade.RequestID = order1.RequestID
+	if me.journaling {
+		journaled := *trade
+		me.journalRecord(&JournalRecord{Kind: JournalTrade, Trade: &journaled})
+	}
+	me.outbox = append(me.outbox, engineEvent{trade: trade})
+	if me.fills != nil {
+		fill := *trade
+		me.fills = append(me.fills, &fill)
+	}
+	me.emitOrderUpdate(order1)
+	me.emitOrderUpdate(order2)
 }
 
 func (me *MatchingEngine) CancelOrder(orderID string) bool {
+	defer me.flush()
 	me.mu.Lock()
 	defer me.mu.Unlock()
+	defer me.maybeSnapshot()
+	defer me.publishBook()
 
 	if me.cancelFromHeap(me.buyOrders, orderID) {
 		return true
@@ -180,79 +321,127 @@ func (me *MatchingEngine) CancelOrder(orderID string) bool {
 	return false
 }
 
-func (me *MatchingEngine) cancelFromHeap(h *OrderHeap, orderID string) bool {
-	for i, order := range h.orders {
-		if order.ID == orderID {
-			heap.Remove(h, i)
+// CancelWhere cancels every resting and pending stop order that match
+// selects, tagging them with reason, and returns their IDs
+func (me *MatchingEngine) CancelWhere(match func(*domain.Order) bool, reason string) []string {
+	defer me.flush()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	defer me.maybeSnapshot()
+	defer me.publishBook()
+
+	cancelled := make([]string, 0)
+	keep := func(orders []*domain.Order) []*domain.Order {
+		kept := orders[:0]
+		for _, order := range orders {
+			if !match(order) {
+				kept = append(kept, order)
+				continue
+			}
+			me.journalRecord(&JournalRecord{Kind: JournalCancelled, OrderID: order.ID, Reason: reason})
+			me.recordCancelled(order.ID)
 			order.Status = domain.OrderStatusCancelled
-			order.UpdatedAt = time.Now()
-			me.orderUpdates <- order
-			return true
+			order.CancelReason = reason
+			order.UpdatedAt = domain.Now()
+			me.emitOrderUpdate(order)
+			cancelled = append(cancelled, order.ID)
 		}
+		return kept
 	}
-	return false
-}
-
-func (me *MatchingEngine) GetOrderBook(depth int) *domain.OrderBook {
-	me.mu.RLock()
-	defer me.mu.RUnlock()
 
-	bids := make([]domain.OrderBookLevel, 0)
-	asks := make([]domain.OrderBookLevel, 0)
+	me.buyOrders.reset(keep(me.buyOrders.orders))
+	me.sellOrders.reset(keep(me.sellOrders.orders))
+	me.stopLimitOrders = keep(me.stopLimitOrders)
+	return cancelled
+}
 
-	bidMap := make(map[float64]*domain.OrderBookLevel)
-	for _, order := range me.buyOrders.orders {
-		if level, exists := bidMap[order.Price]; exists {
-			level.Quantity += order.RemainingQty
-			level.Orders++
-		} else {
-			bidMap[order.Price] = &domain.OrderBookLevel{
-				Price:    order.Price,
-				Quantity: order.RemainingQty,
-				Orders:   1,
-			}
+// Halt cancels every resting and pending stop order and makes the engine
+// cancel whatever it is sent until Resume. It returns how many orders were
+// cancelled.
+func (me *MatchingEngine) Halt() int {
+	defer me.flush()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	defer me.maybeSnapshot()
+	defer me.publishBook()
+
+	// Replaying the halt cancels the same orders, so they aren't journaled
+	// one by one
+	me.journalRecord(&JournalRecord{Kind: JournalHalt})
+	me.halted = true
+	cancelled := 0
+	for _, orders := range [][]*domain.Order{me.buyOrders.orders, me.sellOrders.orders, me.stopLimitOrders} {
+		for _, order := range orders {
+			order.Status = domain.OrderStatusCancelled
+			order.CancelReason = domain.CancelReasonDelisted
+			order.UpdatedAt = domain.Now()
+			me.emitOrderUpdate(order)
+			cancelled++
 		}
 	}
 
-	askMap := make(map[float64]*domain.OrderBookLevel)
-	for _, order := range me.sellOrders.orders {
-		if level, exists := askMap[order.Price]; exists {
-			level.Quantity += order.RemainingQty
-			level.Orders++
-		} else {
-			askMap[order.Price] = &domain.OrderBookLevel{
-				Price:    order.Price,
-				Quantity: order.RemainingQty,
-				Orders:   1,
-			}
-		}
-	}
+	me.buyOrders.reset(me.buyOrders.orders[:0])
+	me.sellOrders.reset(me.sellOrders.orders[:0])
+	me.stopLimitOrders = make([]*domain.Order, 0)
+	return cancelled
+}
 
-	for _, level := range bidMap {
-		bids = append(bids, *level)
-		if len(bids) >= depth {
-			break
-		}
+// Resume lets a halted engine accept orders again
+func (me *MatchingEngine) Resume() {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.halted {
+		me.journalRecord(&JournalRecord{Kind: JournalResume})
 	}
+	me.halted = false
+}
 
-	for _, level := range askMap {
-		asks = append(asks, *level)
-		if len(asks) >= depth {
-			break
-		}
+// Halted reports whether the engine was halted by a delisting
+func (me *MatchingEngine) Halted() bool {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.halted
+}
+
+func (me *MatchingEngine) cancelFromHeap(h *OrderHeap, orderID string) bool {
+	i := h.find(orderID)
+	if i < 0 {
+		return false
 	}
+	order := h.orders[i]
+	me.journalRecord(&JournalRecord{Kind: JournalCancelled, OrderID: orderID})
+	me.recordCancelled(orderID)
+	heap.Remove(h, i)
+	order.Status = domain.OrderStatusCancelled
+	order.UpdatedAt = domain.Now()
+	me.emitOrderUpdate(order)
+	return true
+}
+
+// GetOrderBook returns the best depth levels of each side, best prices first
+func (me *MatchingEngine) GetOrderBook(depth int) *domain.OrderBook {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	bids, bidDust := me.buyOrders.bestLevels(depth)
+	asks, askDust := me.sellOrders.bestLevels(depth)
+	atomic.AddUint64(&me.phantomLevels, uint64(bidDust+askDust))
 
 	return &domain.OrderBook{
 		Symbol:    me.symbol,
 		Bids:      bids,
 		Asks:      asks,
-		Timestamp: time.Now(),
+		Timestamp: domain.Now(),
+		Seq:       me.seq,
 	}
 }
 
 func (me *MatchingEngine) CheckStopOrders(currentPrice float64) {
+	defer me.flush()
 	me.mu.Lock()
 	defer me.mu.Unlock()
+	defer me.maybeSnapshot()
+	defer me.publishBook()
 
 	triggered := make([]*domain.Order, 0)
 	remaining := make([]*domain.Order, 0)
@@ -277,11 +466,42 @@ func (me *MatchingEngine) CheckStopOrders(currentPrice float64) {
 
 	me.stopLimitOrders = remaining
 
-	me.mu.Unlock()
+	// Matched in trigger order with the lock held throughout, so the journal
+	// replays them exactly
 	for _, order := range triggered {
-		me.ProcessOrder(order)
+		me.journalRecord(&JournalRecord{Kind: JournalStopTriggered, OrderID: order.ID})
+		me.processOrder(order)
 	}
+}
+
+// emitOrderUpdate publishes a copy of the order so consumers see the state as
+// of this event rather than whatever the engine mutates it to afterwards
+func (me *MatchingEngine) emitOrderUpdate(order *domain.Order) {
+	me.seq++
+	snapshot := *order
+	snapshot.Seq = me.seq
+	me.outbox = append(me.outbox, engineEvent{order: &snapshot})
+}
+
+// flush sends the outbox's trades and order updates. Every operation that
+// emits defers it ahead of taking mu, so it runs after mu is released: a
+// full channel then holds up only the caller, never readers of the book or
+// a drain that needs them.
+func (me *MatchingEngine) flush() {
+	me.sendMu.Lock()
+	defer me.sendMu.Unlock()
 	me.mu.Lock()
+	events := me.outbox
+	me.outbox = nil
+	me.mu.Unlock()
+
+	for _, event := range events {
+		if event.trade != nil {
+			me.tradeChan <- event.trade
+		} else {
+			me.orderUpdates <- event.order
+		}
+	}
 }
 
 func (me *MatchingEngine) TradeChan() <-chan *domain.Trade {
@@ -292,6 +512,18 @@ func (me *MatchingEngine) OrderUpdatesChan() <-chan *domain.Order {
 	return me.orderUpdates
 }
 
+// isDust reports whether a remaining quantity is zero for matching purposes
+func isDust(quantity float64) bool {
+	return quantity <= quantityEpsilon
+}
+
+// affordable is the most that funds buy at price, rounded down to the
+// smallest quantity serialized so the cost never exceeds them
+func affordable(funds, price float64) float64 {
+	scale := math.Pow10(domain.DefaultQuantityDecimals)
+	return math.Floor(funds/price*scale) / scale
+}
+
 func min(a, b float64) float64 {
 	if a < b {
 		return a
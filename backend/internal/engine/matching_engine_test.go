@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// A match that emits more than the channels hold waits for them to drain
+// without holding the engine lock, so the book can still be read
+func TestFullChannelsDontBlockReaders(t *testing.T) {
+	me := NewMatchingEngine("BTC-USD")
+	makers := cap(me.tradeChan) + 100
+	for i := 0; i < makers; i++ {
+		me.ProcessOrder(domain.NewOrder("maker", "BTC-USD", domain.OrderSideSell, domain.OrderTypeLimit, 0.01, 45000))
+		<-me.orderUpdates
+	}
+
+	matched := make(chan struct{})
+	go func() {
+		defer close(matched)
+		me.ProcessOrder(domain.NewOrder("taker", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, float64(makers)*0.01, 45000))
+	}()
+
+	read := make(chan *domain.OrderBook)
+	go func() {
+		// Once the taker has filled, its flush is stuck on a full channel
+		for len(me.tradeChan) < cap(me.tradeChan) && len(me.orderUpdates) < cap(me.orderUpdates) {
+			time.Sleep(time.Millisecond)
+		}
+		read <- me.GetOrderBook(5)
+	}()
+	select {
+	case book := <-read:
+		if len(book.Asks) != 0 {
+			t.Errorf("%d ask levels left after the taker swept them", len(book.Asks))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading the book blocked while the engine's channels were full")
+	}
+
+	trades, updates := 0, 0
+	var lastSeq uint64
+	for trades < makers || updates < 2*makers {
+		select {
+		case <-me.tradeChan:
+			trades++
+		case order := <-me.orderUpdates:
+			updates++
+			if order.Seq <= lastSeq {
+				t.Fatalf("update seq %d after %d", order.Seq, lastSeq)
+			}
+			lastSeq = order.Seq
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d trades and %d updates received, want %d and %d", trades, updates, makers, 2*makers)
+		}
+	}
+	<-matched
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// NotificationsKept is how many system notifications are kept for clients
+// catching up on what they missed
+const NotificationsKept = 100
+
+// NotificationStore keeps the most recent system notifications
+type NotificationStore interface {
+	// SaveNotification stores a notification and forgets all but the newest
+	// keep
+	SaveNotification(ctx context.Context, notification *domain.Notification, keep int) error
+	// GetRecentNotifications returns up to limit notifications, newest first
+	GetRecentNotifications(ctx context.Context, limit int) ([]*domain.Notification, error)
+}
+
+// SetNotificationStore keeps every system notification from now on
+func (ex *Exchange) SetNotificationStore(store NotificationStore) {
+	ex.notificationStore = store
+}
+
+// SetOnNotificationCallback sets the callback to be called with every
+// notification, system-wide or for one user
+func (ex *Exchange) SetOnNotificationCallback(callback func(*domain.Notification)) {
+	ex.onNotification = callback
+}
+
+// RecentNotifications returns up to limit of the latest system
+// notifications, newest first
+func (ex *Exchange) RecentNotifications(ctx context.Context, limit int) ([]*domain.Notification, error) {
+	if ex.notificationStore == nil {
+		return []*domain.Notification{}, nil
+	}
+	return ex.notificationStore.GetRecentNotifications(ctx, limit)
+}
+
+// Announce sends a system notification to everyone and keeps it, such as
+// an operator's notice of upcoming maintenance. Its ID and Timestamp are
+// filled in.
+func (ex *Exchange) Announce(notification *domain.Notification) {
+	notification.ID = domain.NewID()
+	notification.UserID = ""
+	notification.Timestamp = domain.Now()
+	if ex.notificationStore != nil {
+		if err := ex.notificationStore.SaveNotification(ex.background(), notification, NotificationsKept); err != nil {
+			log.Printf("Failed to save notification %s: %v", notification.ID, err)
+		}
+	}
+	if ex.onNotification != nil {
+		ex.onNotification(notification)
+	}
+}
+
+// announce sends a system notification the exchange raised itself
+func (ex *Exchange) announce(category domain.NotificationCategory, severity domain.NotificationSeverity, symbol, format string, args ...interface{}) {
+	ex.Announce(&domain.Notification{
+		Symbol:   symbol,
+		Category: category,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// announceTradingStatus tells everyone trading paused or resumed
+func (ex *Exchange) announceTradingStatus(status TradingStatus) {
+	switch {
+	case status.Paused && status.ResumeAt != nil:
+		ex.announce(domain.CategoryMaintenance, domain.SeverityWarning, "",
+			"Trading is paused until %s: %s", status.ResumeAt.UTC().Format(time.RFC3339), status.Reason)
+	case status.Paused:
+		ex.announce(domain.CategoryTrading, domain.SeverityCritical, "", "Trading is paused: %s", status.Reason)
+	default:
+		ex.announce(domain.CategoryTrading, domain.SeverityInfo, "", "Trading has resumed")
+	}
+}
+
+// orderEndings say why the exchange ended an order its owner didn't cancel
+var orderEndings = map[string]string{
+	domain.CancelReasonAdmin:       "was cancelled by an operator",
+	domain.CancelReasonDelisted:    "was cancelled because the symbol was delisted",
+	domain.CancelReasonStale:       "was cancelled after resting untouched too long",
+	domain.CancelReasonPurged:      "was removed from the book by an operator",
+	domain.CancelReasonBudget:      "ran out of locked funds before it filled; the rest was cancelled",
+	domain.CancelReasonInterrupted: "was interrupted by an exchange restart; the rest was cancelled",
+}
+
+// notifyOrderEnded tells a user the exchange ended one of their orders after
+// accepting it: rejected by the engine, or cancelled for them. The REST call
+// that placed it had already succeeded, so nothing else reports it.
+func (ex *Exchange) notifyOrderEnded(order *domain.Order) {
+	if ex.onNotification == nil {
+		return
+	}
+	var ending string
+	severity := domain.SeverityWarning
+	switch {
+	case order.Status == domain.OrderStatusRejected:
+		ending = "was rejected by the matching engine: nothing was left to fill"
+	case order.Status == domain.OrderStatusCancelled && orderEndings[order.CancelReason] != "":
+		ending = orderEndings[order.CancelReason]
+		severity = domain.SeverityInfo
+	default:
+		return
+	}
+	ex.onNotification(&domain.Notification{
+		ID:        domain.NewID(),
+		UserID:    order.UserID,
+		Symbol:    order.Symbol,
+		OrderID:   order.ID,
+		Category:  domain.CategoryOrder,
+		Severity:  severity,
+		Message:   fmt.Sprintf("Your %s %s order %s %s", order.Symbol, strings.ToLower(string(order.Side)), order.ID, ending),
+		Timestamp: domain.Now(),
+	})
+}
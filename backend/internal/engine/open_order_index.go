@@ -0,0 +1,258 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+const (
+	// openOrderCheckInterval is how often indexed open orders are compared
+	// with the database
+	openOrderCheckInterval = time.Minute
+	// openOrderCheckUsers is how many users each comparison samples
+	openOrderCheckUsers = 20
+	// openOrderCheckGrace skips orders accepted this recently, whose index
+	// entry and row may not both exist yet
+	openOrderCheckGrace = 5 * time.Second
+)
+
+// UserOpenOrderSource reads a user's open orders from the database
+type UserOpenOrderSource interface {
+	GetUserOpenOrders(ctx context.Context, userID string) ([]*domain.Order, error)
+}
+
+// OpenOrderIndexStats reports the open-orders index's size and how well it
+// agrees with the database
+type OpenOrderIndexStats struct {
+	Users  int `json:"users"`
+	Orders int `json:"orders"`
+	// UsersChecked and Mismatches count users compared with the database and
+	// those whose open orders differed
+	UsersChecked  uint64     `json:"users_checked"`
+	Mismatches    uint64     `json:"mismatches"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	LastMismatch  string     `json:"last_mismatch,omitempty"`
+}
+
+// openOrderIndex holds every open order by user, as of the last order update
+// processed for its symbol. Orders are added when accepted and removed once
+// terminal, so it only ever holds open orders.
+type openOrderIndex struct {
+	mu     sync.RWMutex
+	users  map[string]map[string]*domain.Order
+	ids    map[string]*domain.Order // the same orders by ID
+	seqs   map[string]uint64        // last order update applied per symbol
+	orders int
+
+	statsMu     sync.Mutex
+	checked     uint64
+	mismatches  uint64
+	lastChecked *time.Time
+	lastDiff    string
+	cursor      string // user the next sample starts after
+}
+
+func newOpenOrderIndex() *openOrderIndex {
+	return &openOrderIndex{
+		users: make(map[string]map[string]*domain.Order),
+		ids:   make(map[string]*domain.Order),
+		seqs:  make(map[string]uint64),
+	}
+}
+
+// put indexes a copy of an open order
+func (idx *openOrderIndex) put(order *domain.Order) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.putLocked(order)
+}
+
+func (idx *openOrderIndex) putLocked(order *domain.Order) {
+	orders, ok := idx.users[order.UserID]
+	if !ok {
+		orders = make(map[string]*domain.Order)
+		idx.users[order.UserID] = orders
+	}
+	if _, exists := orders[order.ID]; !exists {
+		idx.orders++
+	}
+	copied := *order
+	orders[order.ID] = &copied
+	idx.ids[order.ID] = &copied
+}
+
+// apply records an order update, dropping the order once it is terminal
+func (idx *openOrderIndex) apply(order *domain.Order) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if order.Seq > idx.seqs[order.Symbol] {
+		idx.seqs[order.Symbol] = order.Seq
+	}
+	if !isTerminal(order.Status) {
+		idx.putLocked(order)
+		return
+	}
+	orders := idx.users[order.UserID]
+	if _, exists := orders[order.ID]; !exists {
+		return
+	}
+	delete(orders, order.ID)
+	delete(idx.ids, order.ID)
+	idx.orders--
+	if len(orders) == 0 {
+		delete(idx.users, order.UserID)
+	}
+}
+
+// forUser copies a user's open orders on symbol, or on every symbol when
+// symbol is empty
+func (idx *openOrderIndex) forUser(userID, symbol string) []*domain.Order {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	orders := make([]*domain.Order, 0, len(idx.users[userID]))
+	for _, order := range idx.users[userID] {
+		if symbol == "" || order.Symbol == symbol {
+			copied := *order
+			orders = append(orders, &copied)
+		}
+	}
+	return orders
+}
+
+// symbolOf returns the symbol of an indexed open order
+func (idx *openOrderIndex) symbolOf(orderID string) (string, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	order, ok := idx.ids[orderID]
+	if !ok {
+		return "", false
+	}
+	return order.Symbol, true
+}
+
+func (idx *openOrderIndex) seq(symbol string) uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.seqs[symbol]
+}
+
+// sampleUsers returns up to n indexed users, continuing in user order from
+// where the last sample stopped
+func (idx *openOrderIndex) sampleUsers(n int) []string {
+	idx.mu.RLock()
+	users := make([]string, 0, len(idx.users))
+	for userID := range idx.users {
+		users = append(users, userID)
+	}
+	idx.mu.RUnlock()
+	sort.Strings(users)
+
+	idx.statsMu.Lock()
+	defer idx.statsMu.Unlock()
+	start := sort.SearchStrings(users, idx.cursor)
+	if start < len(users) && users[start] == idx.cursor {
+		start++
+	}
+	sample := make([]string, 0, n)
+	for i := 0; i < len(users) && len(sample) < n; i++ {
+		sample = append(sample, users[(start+i)%len(users)])
+	}
+	if len(sample) > 0 {
+		idx.cursor = sample[len(sample)-1]
+	}
+	return sample
+}
+
+// SetOpenOrderSource makes Start compare a sample of users' indexed open
+// orders with the database every minute
+func (ex *Exchange) SetOpenOrderSource(source UserOpenOrderSource) {
+	ex.openOrderSource = source
+}
+
+// OpenOrderIndexStats reports the index's size and its agreement with the
+// database so far
+func (ex *Exchange) OpenOrderIndexStats() OpenOrderIndexStats {
+	idx := ex.openOrders
+	idx.mu.RLock()
+	stats := OpenOrderIndexStats{Users: len(idx.users), Orders: idx.orders}
+	idx.mu.RUnlock()
+
+	idx.statsMu.Lock()
+	defer idx.statsMu.Unlock()
+	stats.UsersChecked = idx.checked
+	stats.Mismatches = idx.mismatches
+	stats.LastCheckedAt = idx.lastChecked
+	stats.LastMismatch = idx.lastDiff
+	return stats
+}
+
+// checkOpenOrders compares a sample of users' indexed open orders with the
+// database. Each user is compared with event processing paused, so no
+// update is halfway between the two.
+func (ex *Exchange) checkOpenOrders() {
+	for _, userID := range ex.openOrders.sampleUsers(openOrderCheckUsers) {
+		ex.drainMu.Lock()
+		stored, err := ex.openOrderSource.GetUserOpenOrders(ex.ctx, userID)
+		indexed := ex.openOrders.forUser(userID, "")
+		ex.drainMu.Unlock()
+		if err != nil {
+			log.Printf("Failed to check open orders of %s: %v", userID, err)
+			continue
+		}
+
+		diff := ex.diffOpenOrders(indexed, stored)
+		now := ex.clock.Now()
+		idx := ex.openOrders
+		idx.statsMu.Lock()
+		idx.checked++
+		idx.lastChecked = &now
+		if diff != "" {
+			idx.mismatches++
+			idx.lastDiff = fmt.Sprintf("%s: %s", userID, diff)
+		}
+		idx.statsMu.Unlock()
+		if diff != "" {
+			log.Printf("⚠️ Open orders index disagrees with the database for %s: %s", userID, diff)
+		}
+	}
+}
+
+// diffOpenOrders describes the first difference between indexed and stored
+// open orders, ignoring recovering symbols and just-accepted orders
+func (ex *Exchange) diffOpenOrders(indexed, stored []*domain.Order) string {
+	recent := ex.clock.Now().Add(-openOrderCheckGrace)
+	skip := func(order *domain.Order) bool {
+		return order.CreatedAt.After(recent) || ex.checkReady(order.Symbol) != nil
+	}
+
+	byID := make(map[string]*domain.Order, len(stored))
+	for _, order := range stored {
+		byID[order.ID] = order
+	}
+	for _, order := range indexed {
+		row, ok := byID[order.ID]
+		delete(byID, order.ID)
+		switch {
+		case skip(order):
+		case !ok:
+			return fmt.Sprintf("order %s is open in the index but not in the database", order.ID)
+		case math.Abs(row.RemainingQty-order.RemainingQty) > quantityEpsilon:
+			return fmt.Sprintf("order %s has %v remaining in the index, %v in the database", order.ID, order.RemainingQty, row.RemainingQty)
+		}
+	}
+	for _, row := range byID {
+		if !skip(row) {
+			return fmt.Sprintf("order %s is open in the database but not in the index", row.ID)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+package engine_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/database"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine/enginetest"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+// openOrderRows renders open orders as "id status remaining", sorted, so the
+// index and the database can be compared as text
+func openOrderRows(orders []*domain.Order) string {
+	rows := make([]string, len(orders))
+	for i, order := range orders {
+		rows[i] = fmt.Sprintf("%s %s %.8f", order.ID, order.Status, order.RemainingQty)
+	}
+	sort.Strings(rows)
+	return strings.Join(rows, "\n")
+}
+
+// The open-orders index lists the same orders, in the same state, as the
+// orders table at every step of their lifecycle: accepted, partly filled,
+// cancelled, filled and mass-cancelled
+func TestOpenOrderIndexAgreesWithDatabase(t *testing.T) {
+	db, err := database.NewDB(fmt.Sprintf("sqlite://file:engine-test-%d?mode=memory&cache=shared", databases.Add(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	orders := repository.NewOrderRepository(db.DB)
+	store := enginetest.NewStore()
+	ex := startTestExchange(t, store, store, orders)
+	store.Deposit("alice", "USD", 100000)
+	store.Deposit("alice", "BTC", 1)
+	store.Deposit("bob", "USD", 100000)
+	store.Deposit("bob", "BTC", 1)
+
+	var index, table string
+	agree := func(step string, want int) {
+		t.Helper()
+		ex.eventually(t, "the index and the database to agree after "+step, func() bool {
+			open, err := ex.GetOpenOrders("alice", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored, err := orders.GetUserOpenOrders(context.Background(), "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			index, table = openOrderRows(open.Orders), openOrderRows(stored)
+			return index == table && len(stored) == want
+		})
+		if stats := ex.OpenOrderIndexStats(); stats.Orders != want {
+			t.Errorf("after %s the index holds %d orders, want %d", step, stats.Orders, want)
+		}
+	}
+
+	bid := ex.rest(t, "alice", domain.OrderSideBuy, 0.3, 44900)
+	ask := ex.rest(t, "alice", domain.OrderSideSell, 0.2, 45100)
+	stop := domain.NewOrder("alice", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeStopLimit, 0.1, 46100)
+	stop.StopPrice = 46000
+	if err := ex.SubmitOrder(context.Background(), stop); err != nil {
+		t.Fatal(err)
+	}
+	agree("accepting a bid, an ask and a stop", 3)
+
+	ex.submit(t, "bob", domain.OrderSideSell, domain.OrderTypeLimit, 0.1, 44900)
+	ex.waitFor(t, bid.ID, func(update *domain.Order) bool { return update.Status == domain.OrderStatusPartial })
+	agree("a partial fill", 3)
+	if !strings.Contains(index, bid.ID+" PARTIAL 0.20000000") {
+		t.Errorf("partly filled bid not listed with 0.2 remaining:\n%s", index)
+	}
+
+	if err := ex.CancelOrder(context.Background(), ask.ID, ask.Symbol, ask.UserID); err != nil {
+		t.Fatal(err)
+	}
+	agree("a cancel", 2)
+
+	ex.submit(t, "bob", domain.OrderSideSell, domain.OrderTypeLimit, 0.2, 44900)
+	ex.waitFor(t, bid.ID, func(update *domain.Order) bool { return update.Status == domain.OrderStatusFilled })
+	agree("the rest of the fill", 1)
+
+	ex.rest(t, "alice", domain.OrderSideBuy, 0.1, 44000)
+	agree("another bid", 2)
+	if n, err := ex.CancelAll("alice", ""); err != nil || n != 2 {
+		t.Fatalf("CancelAll = %d, %v, want the bid and the stop", n, err)
+	}
+	agree("cancelling everything", 0)
+	if index != "" {
+		t.Errorf("index still lists orders after cancelling everything:\n%s", index)
+	}
+}
@@ -1,12 +1,39 @@
 package engine
 
 import (
+	"container/heap"
+
 	"github.com/hft-exchange/backend/internal/domain"
 )
 
 type OrderHeap struct {
 	orders []*domain.Order
 	isBuy  bool
+	// index is each order's position in orders, so orders are found by ID
+	// without a scan
+	index map[string]int
+}
+
+func newOrderHeap(isBuy bool) *OrderHeap {
+	return &OrderHeap{isBuy: isBuy, index: make(map[string]int)}
+}
+
+// reset replaces the heap's orders and restores heap order
+func (h *OrderHeap) reset(orders []*domain.Order) {
+	h.orders = orders
+	h.index = make(map[string]int, len(orders))
+	for i, order := range orders {
+		h.index[order.ID] = i
+	}
+	heap.Init(h)
+}
+
+// find returns a resting order's position, or -1
+func (h *OrderHeap) find(orderID string) int {
+	if i, ok := h.index[orderID]; ok {
+		return i
+	}
+	return -1
 }
 
 func (h *OrderHeap) Len() int { return len(h.orders) }
@@ -29,10 +56,14 @@ func (h *OrderHeap) Less(i, j int) bool {
 
 func (h *OrderHeap) Swap(i, j int) {
 	h.orders[i], h.orders[j] = h.orders[j], h.orders[i]
+	h.index[h.orders[i].ID] = i
+	h.index[h.orders[j].ID] = j
 }
 
 func (h *OrderHeap) Push(x interface{}) {
-	h.orders = append(h.orders, x.(*domain.Order))
+	order := x.(*domain.Order)
+	h.index[order.ID] = len(h.orders)
+	h.orders = append(h.orders, order)
 }
 
 func (h *OrderHeap) Pop() interface{} {
@@ -40,5 +71,63 @@ func (h *OrderHeap) Pop() interface{} {
 	n := len(old)
 	x := old[n-1]
 	h.orders = old[0 : n-1]
+	delete(h.index, x.ID)
+	return x
+}
+
+// bestLevels sums the best depth price levels of the heap, best first. It
+// visits orders best first by walking down from the root, so only the orders
+// at those prices and their children are looked at: nothing below an order
+// can be at a better price than it. Dust is skipped as in a full book, and
+// the number of dust orders skipped is returned alongside.
+func (h *OrderHeap) bestLevels(depth int) (levels []domain.OrderBookLevel, dust int) {
+	if depth <= 0 || h.Len() == 0 {
+		return []domain.OrderBookLevel{}, 0
+	}
+	if depth > h.Len() {
+		depth = h.Len()
+	}
+	levels = make([]domain.OrderBookLevel, 0, depth)
+	next := &heapWalk{h: h, positions: []int{0}}
+	for next.Len() > 0 {
+		i := heap.Pop(next).(int)
+		order := h.orders[i]
+		n := len(levels)
+		switch {
+		case n == depth && levels[n-1].Price != order.Price:
+			return levels, dust
+		case isDust(order.RemainingQty):
+			dust++
+		case n > 0 && levels[n-1].Price == order.Price:
+			levels[n-1].Quantity += order.RemainingQty
+			levels[n-1].Orders++
+		default:
+			levels = append(levels, domain.OrderBookLevel{Price: order.Price, Quantity: order.RemainingQty, Orders: 1})
+		}
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < h.Len() {
+				heap.Push(next, child)
+			}
+		}
+	}
+	return levels, dust
+}
+
+// heapWalk holds the positions of an OrderHeap to visit next, in the heap's
+// own priority order
+type heapWalk struct {
+	h         *OrderHeap
+	positions []int
+}
+
+func (w *heapWalk) Len() int           { return len(w.positions) }
+func (w *heapWalk) Less(i, j int) bool { return w.h.Less(w.positions[i], w.positions[j]) }
+func (w *heapWalk) Swap(i, j int)      { w.positions[i], w.positions[j] = w.positions[j], w.positions[i] }
+func (w *heapWalk) Push(x interface{}) { w.positions = append(w.positions, x.(int)) }
+
+func (w *heapWalk) Pop() interface{} {
+	n := len(w.positions)
+	x := w.positions[n-1]
+	w.positions = w.positions[:n-1]
 	return x
 }
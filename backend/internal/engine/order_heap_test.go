@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// randomHeap fills a side of the book with n orders over levels prices,
+// some of them dust
+func randomHeap(rng *rand.Rand, isBuy bool, n, levels int) *OrderHeap {
+	h := newOrderHeap(isBuy)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		order := domain.NewOrder("user", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 1, 45000+float64(rng.Intn(levels)))
+		order.RemainingQty = float64(1+rng.Intn(100)) * 0.001
+		if rng.Intn(10) == 0 {
+			order.RemainingQty = 1e-12
+		}
+		order.CreatedAt = start.Add(time.Duration(rng.Intn(n)) * time.Microsecond)
+		heap.Push(h, order)
+	}
+	return h
+}
+
+// bestLevels walks only the top of the heap, but must agree with sorting
+// every resting order
+func TestBestLevelsMatchFullAggregation(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, isBuy := range []bool{true, false} {
+		for _, size := range []struct{ orders, levels int }{{0, 1}, {1, 1}, {50, 3}, {500, 40}, {2000, 2000}} {
+			t.Run(fmt.Sprintf("buy=%v/%d orders/%d prices", isBuy, size.orders, size.levels), func(t *testing.T) {
+				h := randomHeap(rng, isBuy, size.orders, size.levels)
+				resting := make([]restingQuantity, len(h.orders))
+				for i, order := range h.orders {
+					resting[i] = restingQuantity{order.Price, order.RemainingQty}
+				}
+				want := aggregateLevels(resting, isBuy)
+				if len(want) > StreamedBookDepth {
+					want = want[:StreamedBookDepth]
+				}
+				got, _ := h.bestLevels(StreamedBookDepth)
+				if len(got) != len(want) {
+					t.Fatalf("%d levels, want %d", len(got), len(want))
+				}
+				for i := range want {
+					if got[i].Price != want[i].Price || got[i].Orders != want[i].Orders || !closeTo(got[i].Quantity, want[i].Quantity) {
+						t.Errorf("level %d = %+v, want %+v", i, got[i], want[i])
+					}
+				}
+
+				price, quantity := bestLevel(h)
+				if len(want) == 0 {
+					if price != 0 || quantity != 0 {
+						t.Errorf("best level of an empty side = %g × %g", price, quantity)
+					}
+					return
+				}
+				if price != want[0].Price || !closeTo(quantity, want[0].Quantity) {
+					t.Errorf("best level = %g × %g, want %g × %g", price, quantity, want[0].Price, want[0].Quantity)
+				}
+			})
+		}
+	}
+}
+
+func closeTo(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+// Publishing the top of book after each operation costs the same however
+// deep the book is
+func BenchmarkPublishBook(b *testing.B) {
+	for _, depth := range []int{100, 10000, 100000} {
+		b.Run(fmt.Sprintf("%d orders", depth), func(b *testing.B) {
+			rng := rand.New(rand.NewSource(1))
+			me := NewMatchingEngine("BTC-USD")
+			me.buyOrders = randomHeap(rng, true, depth, depth/10)
+			me.sellOrders = randomHeap(rng, false, depth, depth/10)
+			go func() {
+				for range me.bookTickers {
+				}
+			}()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Move the top so every call publishes
+				me.buyOrders.orders[0].RemainingQty += 0.001
+				me.publishBook()
+			}
+		})
+	}
+}
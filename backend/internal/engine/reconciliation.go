@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// reconciliationInterval is how often balances are reconciled in the
+// background
+const reconciliationInterval = 24 * time.Hour
+
+// AssetTotal is every user's balance of an asset summed, next to the sum of
+// the asset's ledger entries
+type AssetTotal struct {
+	Asset     string
+	Available float64
+	Locked    float64
+	// Ledger sums seeded balances, adjustments and transfers. Trades only
+	// move funds between users, so they add nothing.
+	Ledger float64
+}
+
+// ReconciliationStore reads balance totals and keeps reconciliation results
+type ReconciliationStore interface {
+	// AssetTotals sums balances and the ledger per asset in one consistent
+	// read
+	AssetTotals(ctx context.Context) ([]*AssetTotal, error)
+	SaveBalanceSnapshot(ctx context.Context, reconciliation *Reconciliation) error
+}
+
+// AssetReconciliation compares what users hold of an asset with what the
+// ledger says they should
+type AssetReconciliation struct {
+	Asset     string  `json:"asset"`
+	Available float64 `json:"available"`
+	Locked    float64 `json:"locked"`
+	Held      float64 `json:"held"`
+	Expected  float64 `json:"expected"`
+	// Drift is Held minus Expected: positive when money was created
+	Drift float64 `json:"drift"`
+	// Tolerance is half the asset's smallest unit; Drift within it is
+	// rounding
+	Tolerance float64 `json:"tolerance"`
+	OK        bool    `json:"ok"`
+}
+
+// Reconciliation is one comparison of every asset
+type Reconciliation struct {
+	TakenAt time.Time             `json:"taken_at"`
+	OK      bool                  `json:"ok"`
+	Assets  []AssetReconciliation `json:"assets"`
+}
+
+// SetReconciliationStore makes Start reconcile balances every 24 hours
+func (ex *Exchange) SetReconciliationStore(store ReconciliationStore) {
+	ex.reconciliationStore = store
+}
+
+// Reconcile sums every user's available and locked funds per asset, compares
+// them with the ledger and stores the result as a balance snapshot. Any
+// drift beyond an asset's tolerance is logged.
+func (ex *Exchange) Reconcile(ctx context.Context) (*Reconciliation, error) {
+	if ex.reconciliationStore == nil {
+		return nil, fmt.Errorf("reconciliation is not configured")
+	}
+	totals, err := ex.reconciliationStore.AssetTotals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Reconciliation{
+		TakenAt: ex.clock.Now(),
+		OK:      true,
+		Assets:  make([]AssetReconciliation, 0, len(totals)),
+	}
+	for _, total := range totals {
+		asset := AssetReconciliation{
+			Asset:     total.Asset,
+			Available: total.Available,
+			Locked:    total.Locked,
+			Held:      total.Available + total.Locked,
+			Expected:  total.Ledger,
+			Tolerance: 0.5 * math.Pow10(-domain.AssetPrecision(total.Asset)),
+		}
+		asset.Drift = asset.Held - asset.Expected
+		asset.OK = math.Abs(asset.Drift) <= asset.Tolerance
+		if !asset.OK {
+			result.OK = false
+			log.Printf("⚠️ Balance drift in %s: users hold %v, ledger expects %v (drift %+v)",
+				asset.Asset, asset.Held, asset.Expected, asset.Drift)
+		}
+		result.Assets = append(result.Assets, asset)
+	}
+	sort.Slice(result.Assets, func(i, j int) bool { return result.Assets[i].Asset < result.Assets[j].Asset })
+
+	if err := ex.reconciliationStore.SaveBalanceSnapshot(ctx, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// reconcile runs a background reconciliation
+func (ex *Exchange) reconcile() {
+	result, err := ex.Reconcile(ex.ctx)
+	if err != nil {
+		log.Printf("Balance reconciliation failed: %v", err)
+		return
+	}
+	if result.OK {
+		log.Printf("Balance reconciliation passed for %d assets", len(result.Assets))
+	}
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// DefaultReplayWindow bounds how far back a book reconstruction may reach
+const DefaultReplayWindow = 24 * time.Hour
+
+// OrderHistorySource streams persisted orders for a symbol in creation order
+type OrderHistorySource interface {
+	StreamOrderHistory(ctx context.Context, symbol string, from, to time.Time, fn func(*domain.Order) error) error
+}
+
+// pendingCancel is a cancellation that must be replayed once the replay clock
+// passes its timestamp
+type pendingCancel struct {
+	orderID string
+	at      time.Time
+}
+
+type cancelQueue []pendingCancel
+
+func (q cancelQueue) Len() int            { return len(q) }
+func (q cancelQueue) Less(i, j int) bool  { return q[i].at.Before(q[j].at) }
+func (q cancelQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *cancelQueue) Push(x interface{}) { *q = append(*q, x.(pendingCancel)) }
+func (q *cancelQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	x := old[n-1]
+	*q = old[:n-1]
+	return x
+}
+
+// ReconstructOrderBook replays the orders and cancels recorded for a symbol
+// through a throwaway MatchingEngine and returns the best depth levels a side,
+// best first, as the book stood at the requested time. Only orders created
+// within window before at are replayed, and stop-limit orders are skipped
+// since their trigger prices are not recorded.
+func ReconstructOrderBook(ctx context.Context, source OrderHistorySource, symbol string, at time.Time, window time.Duration, depth int) (*domain.OrderBook, error) {
+	if window <= 0 {
+		window = DefaultReplayWindow
+	}
+
+	me := NewMatchingEngine(symbol)
+	done := make(chan struct{})
+	defer close(done)
+	go me.discardEvents(done)
+
+	cancels := &cancelQueue{}
+	applyCancelsUntil := func(t time.Time) {
+		for cancels.Len() > 0 && !(*cancels)[0].at.After(t) {
+			pending := heap.Pop(cancels).(pendingCancel)
+			me.CancelOrder(pending.orderID)
+		}
+	}
+
+	err := source.StreamOrderHistory(ctx, symbol, at.Add(-window), at, func(order *domain.Order) error {
+		if order.Type == domain.OrderTypeStopLimit {
+			return nil
+		}
+
+		applyCancelsUntil(order.CreatedAt)
+
+		// Replay from the order's original state, not its persisted outcome
+		if order.Status == domain.OrderStatusCancelled && !order.UpdatedAt.After(at) {
+			heap.Push(cancels, pendingCancel{orderID: order.ID, at: order.UpdatedAt})
+		}
+		order.FilledQuantity = 0
+		order.RemainingQty = order.Quantity
+		order.Status = domain.OrderStatusPending
+		if order.TimeInForce == "" {
+			order.TimeInForce = "GTC"
+		}
+
+		me.ProcessOrder(order)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay %s history: %w", symbol, err)
+	}
+
+	applyCancelsUntil(at)
+
+	book := me.GetOrderBook(depth)
+	book.Timestamp = at
+	return book, nil
+}
+
+// discardEvents drains the engine's output channels so a replay engine never
+// blocks on a full buffer
+func (me *MatchingEngine) discardEvents(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-me.tradeChan:
+		case <-me.orderUpdates:
+		}
+	}
+}
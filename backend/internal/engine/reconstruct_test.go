@@ -0,0 +1,86 @@
+package engine_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// A book reconstructed for a past moment matches the live book as it stood
+// then, level for level and best first, however the book has moved since
+func TestReconstructedBookMatchesLiveBook(t *testing.T) {
+	ex := newTestExchange(t)
+	ex.store.Deposit("maker", "BTC", 1000)
+	ex.store.Deposit("maker", "USD", 100000000)
+	ex.store.Deposit("taker", "BTC", 1000)
+	ex.store.Deposit("taker", "USD", 100000000)
+
+	const depth = 8
+	rng := rand.New(rand.NewSource(1))
+	var placed []*domain.Order
+	trade := func(n int) {
+		for i := 0; i < n; i++ {
+			// Prices either side of the reference cross often, leaving
+			// partially filled orders resting behind
+			userID, side := "maker", domain.OrderSideBuy
+			if rng.Intn(2) == 0 {
+				userID, side = "taker", domain.OrderSideSell
+			}
+			price := referencePrice + float64(rng.Intn(31)-15)
+			quantity := float64(1+rng.Intn(20)) * 0.01
+			order := ex.submit(t, userID, side, domain.OrderTypeLimit, quantity, price)
+			ex.waitFor(t, order.ID, func(*domain.Order) bool { return true })
+			placed = append(placed, order)
+
+			if rng.Intn(6) == 0 {
+				ex.cancel(t, placed[rng.Intn(len(placed))])
+			}
+		}
+	}
+
+	trade(150)
+	live := ex.GetOrderBook("BTC-USD", depth)
+	if len(live.Bids) < depth || len(live.Asks) < depth {
+		t.Fatalf("live book has %d bids and %d asks, want at least %d a side", len(live.Bids), len(live.Asks), depth)
+	}
+	at := domain.Now()
+	time.Sleep(time.Millisecond)
+	trade(50)
+
+	book, err := engine.ReconstructOrderBook(context.Background(), ex.store, "BTC-USD", at, time.Hour, depth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareLevels(t, "bids", book.Bids, live.Bids)
+	compareLevels(t, "asks", book.Asks, live.Asks)
+}
+
+func compareLevels(t *testing.T, side string, got, want []domain.OrderBookLevel) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%d %s reconstructed, want %d", len(got), side, len(want))
+	}
+	for i := range want {
+		diff := got[i].Quantity - want[i].Quantity
+		if got[i].Price != want[i].Price || got[i].Orders != want[i].Orders || diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("%s[%d] = %+v, want %+v", side, i, got[i], want[i])
+		}
+	}
+}
+
+// cancel cancels an order if it is still open and waits until the
+// cancellation is stored, as reconstruction reads it from there
+func (ex *testExchange) cancel(t *testing.T, order *domain.Order) {
+	t.Helper()
+	if err := ex.CancelOrder(context.Background(), order.ID, order.Symbol, order.UserID); err != nil {
+		return
+	}
+	ex.eventually(t, "the cancellation to be stored", func() bool {
+		stored, err := ex.store.GetOrderByID(context.Background(), order.ID)
+		return err == nil && stored.Status == domain.OrderStatusCancelled
+	})
+}
@@ -0,0 +1,219 @@
+package engine
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// ErrExchangeStarting is returned for orders and cancels on a symbol whose
+// book is still being recovered
+var ErrExchangeStarting = errors.New("EXCHANGE_STARTING")
+
+// recoveryActivityWindow is how far back trades count towards a symbol's
+// recovery priority
+const recoveryActivityWindow = 24 * time.Hour
+
+// RecoverySource supplies the persisted state books are rebuilt from
+type RecoverySource interface {
+	GetOpenOrders(ctx context.Context, symbol string) ([]*domain.Order, error)
+	// GetOpenOrderFills sums the stored trades of the symbol's open orders
+	GetOpenOrderFills(ctx context.Context, symbol string) (map[string]domain.OrderFills, error)
+	CountTradesSince(ctx context.Context, symbol string, since time.Time) (int, error)
+}
+
+// Recover rebuilds every listed symbol's book from its open orders. Each
+// symbol rejects orders with ErrExchangeStarting until its own book is back,
+// so quiet symbols with huge books don't hold up busy ones. Symbols are
+// recovered most active first, at most parallelism at a time. Recover
+// returns once every symbol is queued; recovery carries on in the background.
+func (ex *Exchange) Recover(source RecoverySource, parallelism int) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	symbols := ex.GetAllSymbols()
+	ex.mu.Lock()
+	for _, symbol := range symbols {
+		ex.recovering[symbol] = true
+	}
+	ex.mu.Unlock()
+	ex.refreshSymbolStatuses(symbols...)
+
+	since := ex.clock.Now().Add(-recoveryActivityWindow)
+	activity := make(map[string]int, len(symbols))
+	for _, symbol := range symbols {
+		count, err := source.CountTradesSince(ex.ctx, symbol, since)
+		if err != nil {
+			log.Printf("Failed to rank %s for recovery: %v", symbol, err)
+		}
+		activity[symbol] = count
+	}
+	sort.SliceStable(symbols, func(i, j int) bool { return activity[symbols[i]] > activity[symbols[j]] })
+
+	queue := make(chan string, len(symbols))
+	for _, symbol := range symbols {
+		queue <- symbol
+	}
+	close(queue)
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for symbol := range queue {
+				ex.recoverSymbol(source, symbol)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		log.Printf("Recovered %d symbols", len(symbols))
+	}()
+}
+
+// recoverSymbol restores one symbol's resting orders and reservations, then
+// opens it for trading. With a journal the book is replayed from it rather
+// than read from the orders table. A symbol that fails to load stays closed rather than
+// trading on a partial book.
+func (ex *Exchange) recoverSymbol(source RecoverySource, symbol string) {
+	started := time.Now()
+	var orders []*domain.Order
+	var err error
+	if ex.journalStore != nil {
+		orders, err = ex.journalOrders(source, symbol)
+	} else {
+		orders, err = source.GetOpenOrders(ex.ctx, symbol)
+	}
+	var fills map[string]domain.OrderFills
+	if err == nil {
+		fills, err = source.GetOpenOrderFills(ex.ctx, symbol)
+	}
+	if err != nil {
+		log.Printf("❌ Failed to recover %s, it stays closed: %v", symbol, err)
+		return
+	}
+
+	ex.mu.RLock()
+	engine := ex.engines[symbol]
+	ex.mu.RUnlock()
+	if engine == nil {
+		return
+	}
+
+	resting := make([]*domain.Order, 0, len(orders))
+	interrupted := make([]*domain.Order, 0)
+	for _, order := range orders {
+		if res, err := ex.recoveredReservation(order, fills[order.ID]); err == nil {
+			ex.resMu.Lock()
+			ex.reservations[order.ID] = res
+			ex.resMu.Unlock()
+		} else {
+			log.Printf("Failed to restore lock for order %s: %v", order.ID, err)
+		}
+		ex.openOrders.put(order)
+		// A market order still open was cut off mid-match; it never rests
+		if order.Type == domain.OrderTypeMarket {
+			interrupted = append(interrupted, order)
+			continue
+		}
+		resting = append(resting, order)
+	}
+	engine.RestoreOrders(resting)
+	engine.CancelInterrupted(interrupted)
+	if ex.journalStore != nil {
+		if err := ex.startJournal(symbol, engine); err != nil {
+			log.Printf("Journaling off for %s: %v", symbol, err)
+		}
+	}
+
+	ex.mu.Lock()
+	delete(ex.recovering, symbol)
+	ex.mu.Unlock()
+	ex.refreshSymbolStatuses(symbol)
+	log.Printf("Recovered %s: %d open orders in %s", symbol, len(resting), time.Since(started))
+}
+
+// recoveredReservation rebuilds what an open order still has locked from
+// what it locked when accepted, less what its stored trades spent. Funds are
+// already locked in the database, so only the in-memory reservation is
+// rebuilt. Counting the trades' own prices keeps a limit buy's price
+// improvement reserved, so it is released with the rest of the order.
+func (ex *Exchange) recoveredReservation(order *domain.Order, fills domain.OrderFills) (*reservation, error) {
+	baseAsset, quoteAsset, err := ex.symbolAssets(order.Symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &reservation{userID: order.UserID, symbol: order.Symbol}
+	switch {
+	case order.Side == domain.OrderSideSell:
+		res.asset, res.amount = baseAsset, order.Quantity-fills.Quantity
+	case order.Type == domain.OrderTypeMarket:
+		if order.Budget <= 0 {
+			return nil, fmt.Errorf("market buy %s has no record of the funds it locked", order.ID)
+		}
+		res.asset, res.amount = quoteAsset, order.Budget-fills.Notional
+	default:
+		res.asset, res.amount = quoteAsset, order.Quantity*order.Price-fills.Notional
+	}
+	if res.amount < 0 {
+		res.amount = 0
+	}
+	return res, nil
+}
+
+// checkReady rejects writes on a symbol that is still recovering
+func (ex *Exchange) checkReady(symbol string) error {
+	ex.mu.RLock()
+	defer ex.mu.RUnlock()
+	if ex.recovering[symbol] {
+		return fmt.Errorf("%w: %s is still recovering", ErrExchangeStarting, symbol)
+	}
+	return nil
+}
+
+// RestoreOrders puts previously accepted orders back on the book as they
+// were persisted, without matching them or emitting updates
+func (me *MatchingEngine) RestoreOrders(orders []*domain.Order) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	for _, order := range orders {
+		switch {
+		case order.Type == domain.OrderTypeStopLimit && order.FilledQuantity == 0:
+			me.stopLimitOrders = append(me.stopLimitOrders, order)
+		case order.Side == domain.OrderSideBuy:
+			heap.Push(me.buyOrders, order)
+		default:
+			heap.Push(me.sellOrders, order)
+		}
+	}
+	me.publishBook()
+}
+
+// CancelInterrupted cancels market orders found open on recovery. They were
+// cut off mid-match, so the rest of them can never fill. The updates go out
+// like any other cancel, so the orders are stored as cancelled and whatever
+// they still have locked is released.
+func (me *MatchingEngine) CancelInterrupted(orders []*domain.Order) {
+	defer me.flush()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	for _, order := range orders {
+		log.Printf("Cancelling interrupted market order %s on %s", order.ID, order.Symbol)
+		order.Status = domain.OrderStatusCancelled
+		order.CancelReason = domain.CancelReasonInterrupted
+		order.UpdatedAt = domain.Now()
+		me.emitOrderUpdate(order)
+	}
+}
@@ -0,0 +1,226 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// recoverySource serves a fixed set of open orders and their fills
+type recoverySource struct {
+	orders []*domain.Order
+	fills  map[string]domain.OrderFills
+}
+
+func (s *recoverySource) GetOpenOrders(context.Context, string) ([]*domain.Order, error) {
+	orders := make([]*domain.Order, len(s.orders))
+	for i, order := range s.orders {
+		copied := *order
+		orders[i] = &copied
+	}
+	return orders, nil
+}
+
+func (s *recoverySource) GetOpenOrderFills(context.Context, string) (map[string]domain.OrderFills, error) {
+	return s.fills, nil
+}
+
+func (s *recoverySource) CountTradesSince(context.Context, string, time.Time) (int, error) {
+	return 0, nil
+}
+
+// recover rebuilds the book from source and waits until it is ready
+func (ex *testExchange) recover(t *testing.T, source *recoverySource) {
+	t.Helper()
+	for _, order := range source.orders {
+		ex.store.SaveOrder(context.Background(), order)
+	}
+	ex.Recover(source, 1)
+	ex.eventually(t, "BTC-USD to recover", func() bool {
+		status, err := ex.SymbolStatus("BTC-USD")
+		return err == nil && status.Ready
+	})
+}
+
+// lockAndSpend locks a user's USD for an order and settles a fill that spent
+// some of it, as happened before a restart
+func (ex *testExchange) lockAndSpend(t *testing.T, userID string, locked, spent float64) {
+	t.Helper()
+	if err := ex.store.LockBalance(context.Background(), userID, "USD", locked); err != nil {
+		t.Fatal(err)
+	}
+	spend := []engine.BalanceDelta{{UserID: userID, Asset: "USD", Locked: -spent}}
+	if _, err := ex.store.SettleTrade(context.Background(), domain.NewID(), spend, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openOrder is an order accepted before a restart that filled quantity at
+// price before it
+func openOrder(userID string, side domain.OrderSide, orderType domain.OrderType, quantity, price, filled float64) *domain.Order {
+	order := domain.NewOrder(userID, "BTC-USD", side, orderType, quantity, price)
+	order.FilledQuantity = filled
+	order.RemainingQty = quantity - filled
+	if filled > 0 {
+		order.Status = domain.OrderStatusPartial
+	}
+	return order
+}
+
+// A market order found open was cut off mid-match. Recovery cancels it the
+// usual way, so it is stored as cancelled and its locked funds come back.
+func TestRecoveryCancelsInterruptedMarketOrder(t *testing.T) {
+	ex := newTestExchange(t)
+	ex.store.Deposit("taker", "USD", 100000)
+
+	// 1 BTC locked 47250; 0.1 filled at 45000 and settled before the restart
+	buy := openOrder("taker", domain.OrderSideBuy, domain.OrderTypeMarket, 1, 0, 0.1)
+	buy.Budget = 47250
+	ex.lockAndSpend(t, "taker", buy.Budget, 4500)
+
+	ex.recover(t, &recoverySource{
+		orders: []*domain.Order{buy},
+		fills:  map[string]domain.OrderFills{buy.ID: {Quantity: 0.1, Notional: 4500}},
+	})
+
+	final := ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusCancelled })
+	if final.CancelReason != domain.CancelReasonInterrupted {
+		t.Errorf("cancel reason = %q, want %q", final.CancelReason, domain.CancelReasonInterrupted)
+	}
+	ex.eventually(t, "the order to be stored as cancelled", func() bool {
+		stored, err := ex.store.GetOrderByID(context.Background(), buy.ID)
+		return err == nil && stored.Status == domain.OrderStatusCancelled
+	})
+	ex.eventually(t, "the rest of its funds to be unlocked", func() bool {
+		available, locked, _ := ex.store.GetBalance(context.Background(), "taker", "USD")
+		return math.Abs(locked) < 1e-8 && math.Abs(available-95500) < 1e-8
+	})
+}
+
+// A limit buy that filled below its price has more locked than its
+// remainder at its price. Cancelling it after a restart releases all of it.
+func TestRecoveryKeepsPriceImprovementReserved(t *testing.T) {
+	ex := newTestExchange(t)
+	ex.store.Deposit("taker", "USD", 100000)
+
+	// 1 BTC at 46000 locked 46000; 0.5 filled at 45000 spent 22500
+	buy := openOrder("taker", domain.OrderSideBuy, domain.OrderTypeLimit, 1, 46000, 0.5)
+	ex.lockAndSpend(t, "taker", 46000, 22500)
+
+	ex.recover(t, &recoverySource{
+		orders: []*domain.Order{buy},
+		fills:  map[string]domain.OrderFills{buy.ID: {Quantity: 0.5, Notional: 22500}},
+	})
+	if err := ex.CancelOrder(context.Background(), buy.ID, "BTC-USD", "taker"); err != nil {
+		t.Fatal(err)
+	}
+	ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusCancelled })
+	ex.eventually(t, "the buy's funds to be released", func() bool {
+		available, locked, _ := ex.store.GetBalance(context.Background(), "taker", "USD")
+		return math.Abs(locked) < 1e-8 && math.Abs(available-77500) < 1e-8
+	})
+}
+
+// gatedSource serves open orders per symbol. A symbol with a gate doesn't
+// finish loading until the gate is closed, like a book too big to read
+// quickly.
+type gatedSource struct {
+	orders   map[string][]*domain.Order
+	gates    map[string]chan struct{}
+	activity map[string]int
+}
+
+func (s *gatedSource) GetOpenOrders(ctx context.Context, symbol string) ([]*domain.Order, error) {
+	if gate := s.gates[symbol]; gate != nil {
+		<-gate
+	}
+	return s.orders[symbol], nil
+}
+
+func (s *gatedSource) GetOpenOrderFills(context.Context, string) (map[string]domain.OrderFills, error) {
+	return nil, nil
+}
+
+func (s *gatedSource) CountTradesSince(_ context.Context, symbol string, _ time.Time) (int, error) {
+	return s.activity[symbol], nil
+}
+
+// Readiness is per symbol: a tiny book opens and trades while a huge one is
+// still loading, which keeps refusing orders until its own book is back
+func TestSmallBookTradesWhileHugeBookLoads(t *testing.T) {
+	const hugeBook = 20000
+	ex := newTestExchange(t, func(ex *engine.Exchange) {
+		for _, config := range domain.DefaultSymbolConfigs() {
+			if config.Symbol == "ETH-USD" {
+				if err := ex.AddSymbol(config); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		ex.UpdatePrice("ETH-USD", 3000)
+	})
+	ex.store.Deposit("seller", "BTC", 1)
+	ex.store.Deposit("taker", "USD", 100000)
+	if err := ex.store.LockBalance(context.Background(), "seller", "BTC", 0.5); err != nil {
+		t.Fatal(err)
+	}
+
+	maker := openOrder("seller", domain.OrderSideSell, domain.OrderTypeLimit, 0.5, referencePrice, 0)
+	whales := make([]*domain.Order, hugeBook)
+	for i := range whales {
+		whales[i] = openOrder("whale", domain.OrderSideBuy, domain.OrderTypeLimit, 0.01, 2500+float64(i%400), 0)
+	}
+	ex.store.SaveOrder(context.Background(), maker)
+	loaded := make(chan struct{})
+	// ETH-USD is the busier symbol, so it is picked up first
+	source := &gatedSource{
+		orders:   map[string][]*domain.Order{"BTC-USD": {maker}, "ETH-USD": whales},
+		gates:    map[string]chan struct{}{"ETH-USD": loaded},
+		activity: map[string]int{"ETH-USD": 1000, "BTC-USD": 1},
+	}
+	ex.Recover(source, 2)
+	defer func() {
+		select {
+		case <-loaded:
+		default:
+			close(loaded)
+		}
+	}()
+
+	ready := func(symbol string) bool {
+		status, err := ex.SymbolStatus(symbol)
+		return err == nil && status.Ready
+	}
+	ex.eventually(t, "BTC-USD to recover", func() bool { return ready("BTC-USD") })
+
+	taker := ex.submit(t, "taker", domain.OrderSideBuy, domain.OrderTypeLimit, 0.5, referencePrice)
+	ex.waitFor(t, taker.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+	ex.eventually(t, "the trade to settle", func() bool { return len(ex.store.Trades()) == 1 })
+
+	if ready("ETH-USD") {
+		t.Fatal("ETH-USD reported ready before its book loaded")
+	}
+	early := domain.NewOrder("taker", "ETH-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 0.01, 3000)
+	if err := ex.SubmitOrder(context.Background(), early); !errors.Is(err, engine.ErrExchangeStarting) {
+		t.Fatalf("order on the loading symbol: err = %v, want ErrExchangeStarting", err)
+	}
+
+	close(loaded)
+	ex.eventually(t, "ETH-USD to recover", func() bool { return ready("ETH-USD") })
+	stats, err := ex.EngineStats("ETH-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RestingBuys != hugeBook {
+		t.Errorf("ETH-USD recovered %d resting buys, want %d", stats.RestingBuys, hugeBook)
+	}
+	late := domain.NewOrder("taker", "ETH-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 0.01, 3000)
+	if err := ex.SubmitOrder(context.Background(), late); err != nil {
+		t.Fatalf("order once ETH-USD recovered: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+var (
+	// ErrFenced is returned once another instance has taken over leadership
+	ErrFenced = errors.New("this instance is no longer the leader")
+	// ErrStandby is returned for writes sent to a standby that isn't promoted
+	ErrStandby = errors.New("exchange is running as a standby")
+)
+
+type ReplicationEventType string
+
+const (
+	ReplicateOrder  ReplicationEventType = "order"
+	ReplicateCancel ReplicationEventType = "cancel"
+	ReplicateList   ReplicationEventType = "list"
+	ReplicateDelist ReplicationEventType = "delist"
+)
+
+// ReplicationEvent is an accepted order, cancel, listing or delisting
+// forwarded to a standby so it can apply the same mutation to its own engines
+type ReplicationEvent struct {
+	Seq        uint64               `json:"seq"`
+	Epoch      int64                `json:"epoch"`
+	Type       ReplicationEventType `json:"type"`
+	Symbol     string               `json:"symbol"`
+	Order      *domain.Order        `json:"order,omitempty"`
+	OrderID    string               `json:"order_id,omitempty"`
+	LockAsset  string               `json:"lock_asset,omitempty"`
+	LockAmount float64              `json:"lock_amount,omitempty"`
+	Config     *domain.SymbolConfig `json:"config,omitempty"`
+}
+
+// Replicator ships events from a primary to its standby
+type Replicator interface {
+	Replicate(event *ReplicationEvent) error
+}
+
+// SetReplicator makes the exchange forward every accepted order and cancel
+func (ex *Exchange) SetReplicator(replicator Replicator) {
+	ex.replicator = replicator
+}
+
+// SetWriteFence installs a check run before every write; it should fail once
+// this instance has lost leadership
+func (ex *Exchange) SetWriteFence(fence func() error) {
+	ex.writeFence = fence
+}
+
+// SetStandby switches passive mode on or off. A standby rejects client writes
+// and applies replicated events to its engines without persisting, settling
+// or broadcasting anything, since the primary already did.
+func (ex *Exchange) SetStandby(standby bool) {
+	wasStandby := ex.standby.Swap(standby)
+	if wasStandby && !standby && ex.journalStore != nil {
+		ex.restartJournals()
+	}
+	if wasStandby && !standby {
+		// The old primary may have paused or resumed trading, or disabled users
+		if err := ex.loadTradingStatus(); err != nil {
+			log.Printf("Failed to load trading status on promotion: %v", err)
+		}
+		if err := ex.loadDisabledUsers(); err != nil {
+			log.Printf("Failed to load disabled users on promotion: %v", err)
+		}
+	}
+}
+
+func (ex *Exchange) IsStandby() bool {
+	return ex.standby.Load()
+}
+
+// ReplicationSeq is the last sequence published (primary) or applied (standby)
+func (ex *Exchange) ReplicationSeq() uint64 {
+	return atomic.LoadUint64(&ex.replicationSeq)
+}
+
+// checkWritable rejects client writes on a standby or a fenced primary
+func (ex *Exchange) checkWritable() error {
+	if ex.IsStandby() {
+		return ErrStandby
+	}
+	if ex.writeFence != nil {
+		return ex.writeFence()
+	}
+	return nil
+}
+
+// replicateFrom has engine replicate each order as it takes it up and each
+// resting order as it cancels it. Both happen under the engine's lock, so a
+// symbol's events are numbered in the order its book applied them and a
+// standby replaying them in sequence builds the same book.
+func (ex *Exchange) replicateFrom(engine *MatchingEngine) {
+	symbol := engine.symbol
+	engine.onAccepted = ex.replicateAccepted
+	engine.onCancelled = func(orderID string) {
+		ex.replicate(&ReplicationEvent{Type: ReplicateCancel, Symbol: symbol, OrderID: orderID})
+	}
+}
+
+// replicateAccepted forwards an order with the funds locked for it
+func (ex *Exchange) replicateAccepted(order *domain.Order) {
+	if ex.replicator == nil {
+		return
+	}
+	event := &ReplicationEvent{Type: ReplicateOrder, Symbol: order.Symbol, Order: order}
+	ex.resMu.Lock()
+	if res, ok := ex.reservations[order.ID]; ok {
+		event.LockAsset, event.LockAmount = res.asset, res.amount
+	}
+	ex.resMu.Unlock()
+	ex.replicate(event)
+}
+
+func (ex *Exchange) replicate(event *ReplicationEvent) {
+	if ex.replicator == nil {
+		return
+	}
+	event.Seq = atomic.AddUint64(&ex.replicationSeq, 1)
+	if err := ex.replicator.Replicate(event); err != nil {
+		log.Printf("Failed to replicate %s event %d: %v", event.Type, event.Seq, err)
+	}
+}
+
+// ApplyReplicationEvent replays a primary's mutation on this standby. Funds
+// were locked by the primary, so only the in-memory reservation is recorded.
+func (ex *Exchange) ApplyReplicationEvent(event *ReplicationEvent) error {
+	if event.Type == ReplicateList && event.Config != nil {
+		if err := ex.AddSymbol(*event.Config); err != nil {
+			return fmt.Errorf("replication event %d: %w", event.Seq, err)
+		}
+	}
+
+	ex.mu.RLock()
+	engine, exists := ex.engines[event.Symbol]
+	ex.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("replication event %d: %w: %s", event.Seq, ErrUnknownSymbol, event.Symbol)
+	}
+
+	if last := ex.ReplicationSeq(); event.Seq != last+1 && last != 0 {
+		log.Printf("⚠️ Replication gap: expected seq %d, got %d", last+1, event.Seq)
+	}
+	atomic.StoreUint64(&ex.replicationSeq, event.Seq)
+
+	switch event.Type {
+	case ReplicateOrder:
+		if event.Order == nil {
+			return nil
+		}
+		ex.resMu.Lock()
+		ex.reservations[event.Order.ID] = &reservation{
+			userID: event.Order.UserID,
+			symbol: event.Order.Symbol,
+			asset:  event.LockAsset,
+			amount: event.LockAmount,
+		}
+		ex.resMu.Unlock()
+		ex.openOrders.put(event.Order)
+		engine.ProcessOrder(event.Order)
+	case ReplicateCancel:
+		engine.CancelOrder(event.OrderID)
+	case ReplicateDelist:
+		if _, err := ex.RemoveSymbol(event.Symbol); err != nil {
+			return fmt.Errorf("replication event %d: %w", event.Seq, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package engine_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// streamReplicator keeps every event a primary publishes, encoded as it
+// would travel to a standby
+type streamReplicator struct {
+	mu     sync.Mutex
+	events [][]byte
+}
+
+func (r *streamReplicator) Replicate(event *engine.ReplicationEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, data)
+	return nil
+}
+
+// applyTo replays every event on standby in sequence order
+func (r *streamReplicator) applyTo(t *testing.T, standby *testExchange) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, data := range r.events {
+		var event engine.ReplicationEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Seq != uint64(i+1) {
+			t.Fatalf("event %d has seq %d; events must be published in sequence", i+1, event.Seq)
+		}
+		if err := standby.ApplyReplicationEvent(&event); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Killing the primary in the middle of a burst of concurrent, crossing
+// orders and cancels leaves the standby, once it has applied everything
+// replicated, with exactly the primary's book, ready to trade on
+func TestStandbyMatchesPrimaryKilledMidLoad(t *testing.T) {
+	replicator := &streamReplicator{}
+	primary := newTestExchange(t, func(ex *engine.Exchange) { ex.SetReplicator(replicator) })
+	standby := newTestExchange(t, func(ex *engine.Exchange) { ex.SetStandby(true) })
+
+	const traders = 8
+	for i := 0; i < traders; i++ {
+		user := fmt.Sprintf("trader-%d", i)
+		primary.store.Deposit(user, "BTC", 1000)
+		primary.store.Deposit(user, "USD", 100000000)
+	}
+
+	// Each trader places up to 200 crossing limit orders around the
+	// reference price and cancels some. The primary is stopped once each
+	// has placed 50, and refuses the rest.
+	var wg sync.WaitGroup
+	stopped := make(chan struct{})
+	var placed sync.WaitGroup
+	placed.Add(traders)
+	for i := 0; i < traders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(i)))
+			user := fmt.Sprintf("trader-%d", i)
+			for n := 0; n < 200; n++ {
+				if n == 50 {
+					placed.Done()
+				}
+				side := domain.OrderSideBuy
+				if rng.Intn(2) == 0 {
+					side = domain.OrderSideSell
+				}
+				price := referencePrice + float64(rng.Intn(21)-10)
+				order := domain.NewOrder(user, "BTC-USD", side, domain.OrderTypeLimit, float64(1+rng.Intn(5))*0.001, price)
+				if err := primary.SubmitOrder(context.Background(), order); err != nil {
+					select {
+					case <-stopped:
+						if n < 50 {
+							placed.Done()
+						}
+						return
+					default:
+						t.Errorf("submitting: %v", err)
+						return
+					}
+				}
+				if rng.Intn(4) == 0 {
+					primary.CancelOrder(context.Background(), order.ID, "BTC-USD", user)
+				}
+			}
+		}(i)
+	}
+
+	placed.Wait()
+	close(stopped)
+	primary.Stop()
+	wg.Wait()
+
+	replicator.applyTo(t, standby)
+	standby.eventually(t, "the standby to apply every order", func() bool {
+		return standby.ReplicationSeq() == primary.ReplicationSeq()
+	})
+	want, err := primary.FullOrderBook("BTC-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := standby.FullOrderBook("BTC-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want.Bids)+len(want.Asks) == 0 {
+		t.Fatal("the load left nothing resting to compare")
+	}
+	if !reflect.DeepEqual(got.Bids, want.Bids) || !reflect.DeepEqual(got.Asks, want.Asks) {
+		t.Fatalf("standby book differs from the primary's\nstandby bids %v asks %v\nprimary bids %v asks %v", got.Bids, got.Asks, want.Bids, want.Asks)
+	}
+
+	// Promoted, the standby trades against the book it rebuilt
+	standby.SetStandby(false)
+	standby.store.Deposit("taker", "USD", 100000000)
+	best := want.Asks[0]
+	buy := standby.submit(t, "taker", domain.OrderSideBuy, domain.OrderTypeLimit, best.Quantity, best.Price)
+	standby.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+}
@@ -0,0 +1,309 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// ErrRiskLimit is returned when an order would breach a user's risk limits
+var ErrRiskLimit = errors.New("risk_limit_exceeded")
+
+// Names of the limits that utilization and warnings refer to
+const (
+	LimitOpenOrders    = "open_orders"
+	LimitPosition      = "position"
+	LimitDailyOrders   = "daily_orders"
+	LimitOrderNotional = "order_notional"
+	LimitOpenNotional  = "open_notional"
+)
+
+// defaultRiskWarningInterval spaces out repeated warnings for the same limit
+const defaultRiskWarningInterval = 5 * time.Minute
+
+// RiskLimits caps what a single user may have outstanding per symbol. Zero
+// leaves a limit unenforced.
+type RiskLimits struct {
+	// MaxOpenOrders is the number of live orders allowed per symbol
+	MaxOpenOrders int
+	// MaxPosition is the largest base asset holding a buy may take a user to
+	MaxPosition float64
+	// MaxDailyOrders is the number of orders a user may place per UTC day,
+	// across all symbols
+	MaxDailyOrders int
+	// MaxOrderNotional is the largest quote value of a single order
+	MaxOrderNotional float64
+	// MaxOpenNotional is the quote value a user's resting orders on one
+	// symbol may add up to, counting the new order
+	MaxOpenNotional float64
+	// SoftFraction is the share of any limit at which accepted orders start
+	// carrying warnings; zero disables warnings
+	SoftFraction float64
+	// WarningInterval is the minimum time between warning events for one
+	// user and limit; zero uses five minutes
+	WarningInterval time.Duration
+}
+
+// RiskHeadroom is what remains before a limit is hit; nil means unlimited
+type RiskHeadroom struct {
+	OpenOrders   *int     `json:"open_orders"`
+	Position     *float64 `json:"position"`
+	OpenNotional *float64 `json:"open_notional"`
+}
+
+// RiskUtilization is the fraction of each limit in use; nil means unlimited
+type RiskUtilization struct {
+	OpenOrders   *float64 `json:"open_orders"`
+	Position     *float64 `json:"position"`
+	DailyOrders  *float64 `json:"daily_orders"`
+	OpenNotional *float64 `json:"open_notional"`
+}
+
+// RiskWarning reports an accepted order that took a user past the soft
+// fraction of a limit
+type RiskWarning struct {
+	UserID      string  `json:"user_id"`
+	Symbol      string  `json:"symbol"`
+	Limit       string  `json:"limit"`
+	Used        float64 `json:"used"`
+	Max         float64 `json:"max"`
+	Utilization float64 `json:"utilization"`
+}
+
+// AccountSummary is a user's exposure on one symbol
+type AccountSummary struct {
+	Symbol      string             `json:"symbol"`
+	OpenOrders  int                `json:"open_orders"`
+	DailyOrders int                `json:"daily_orders"`
+	Locked      map[string]float64 `json:"locked"`
+	Headroom    RiskHeadroom       `json:"headroom"`
+	Utilization RiskUtilization    `json:"utilization"`
+}
+
+// SetRiskLimits replaces the default per-user limits checked on every
+// submission; users with a risk profile get its limits instead
+func (ex *Exchange) SetRiskLimits(limits RiskLimits) {
+	ex.riskMu.Lock()
+	ex.riskLimits = limits
+	ex.riskMu.Unlock()
+}
+
+// SetOnRiskWarningCallback sets the callback to be called with soft limit
+// warnings, at most once per user and limit every WarningInterval
+func (ex *Exchange) SetOnRiskWarningCallback(callback func(*RiskWarning)) {
+	ex.onRiskWarning = callback
+}
+
+// checkRiskLimits rejects an order that would take its user past a limit, and
+// otherwise returns a warning for every limit it would take past the soft
+// fraction
+func (ex *Exchange) checkRiskLimits(ctx context.Context, order *domain.Order) ([]RiskWarning, error) {
+	limits := ex.limitsFor(order.UserID)
+	var warnings []RiskWarning
+	warn := func(limit string, used, max float64) {
+		if limits.SoftFraction > 0 && used >= limits.SoftFraction*max {
+			warnings = append(warnings, RiskWarning{
+				UserID:      order.UserID,
+				Symbol:      order.Symbol,
+				Limit:       limit,
+				Used:        used,
+				Max:         max,
+				Utilization: used / max,
+			})
+		}
+	}
+
+	if limits.MaxOpenOrders > 0 {
+		open := ex.openOrderCount(order.UserID, order.Symbol)
+		if open >= limits.MaxOpenOrders {
+			return nil, riskLimitError(LimitOpenOrders, float64(open), float64(limits.MaxOpenOrders),
+				"%d open orders on %s (max %d)", open, order.Symbol, limits.MaxOpenOrders)
+		}
+		warn(LimitOpenOrders, float64(open+1), float64(limits.MaxOpenOrders))
+	}
+
+	if limits.MaxPosition > 0 && order.Side == domain.OrderSideBuy {
+		baseAsset, _, err := ex.symbolAssets(order.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		available, locked, err := ex.balanceStore.GetBalance(ctx, order.UserID, baseAsset)
+		if err != nil {
+			return nil, err
+		}
+		position := available + locked
+		if position+order.Quantity > limits.MaxPosition {
+			return nil, riskLimitError(LimitPosition, position+order.Quantity, limits.MaxPosition,
+				"position %.8f %s plus %.8f exceeds max %.8f", position, baseAsset, order.Quantity, limits.MaxPosition)
+		}
+		warn(LimitPosition, position+order.Quantity, limits.MaxPosition)
+	}
+
+	if limits.MaxDailyOrders > 0 {
+		placed := ex.dailyOrderCount(order.UserID)
+		if placed >= limits.MaxDailyOrders {
+			return nil, riskLimitError(LimitDailyOrders, float64(placed), float64(limits.MaxDailyOrders),
+				"%d orders placed today (max %d)", placed, limits.MaxDailyOrders)
+		}
+		warn(LimitDailyOrders, float64(placed+1), float64(limits.MaxDailyOrders))
+	}
+
+	if limits.MaxOrderNotional > 0 || limits.MaxOpenNotional > 0 {
+		// Market orders are valued at the last traded price
+		price := order.Price
+		if order.Type == domain.OrderTypeMarket {
+			price = ex.lastPrice(order.Symbol)
+		}
+		notional := price * order.Quantity
+
+		if limits.MaxOrderNotional > 0 {
+			if notional > limits.MaxOrderNotional {
+				return nil, riskLimitError(LimitOrderNotional, notional, limits.MaxOrderNotional,
+					"order notional %.2f exceeds max %.2f", notional, limits.MaxOrderNotional)
+			}
+			warn(LimitOrderNotional, notional, limits.MaxOrderNotional)
+		}
+
+		// Market orders never rest, so they don't add to open notional
+		if limits.MaxOpenNotional > 0 && order.Type != domain.OrderTypeMarket {
+			open := ex.openNotional(order.UserID, order.Symbol)
+			if open+notional > limits.MaxOpenNotional {
+				return nil, riskLimitError(LimitOpenNotional, open+notional, limits.MaxOpenNotional,
+					"open notional %.2f on %s plus %.2f exceeds max %.2f", open, order.Symbol, notional, limits.MaxOpenNotional)
+			}
+			warn(LimitOpenNotional, open+notional, limits.MaxOpenNotional)
+		}
+	}
+
+	return warnings, nil
+}
+
+// recordAcceptedOrder counts an accepted order against its user's daily quota
+// and publishes its warnings, skipping limits warned about too recently
+func (ex *Exchange) recordAcceptedOrder(order *domain.Order, warnings []RiskWarning) {
+	limits := ex.limitsFor(order.UserID)
+	interval := limits.WarningInterval
+	if interval <= 0 {
+		interval = defaultRiskWarningInterval
+	}
+	now := ex.clock.Now()
+
+	var publish []RiskWarning
+	ex.quotaMu.Lock()
+	ex.rollQuotaDay(now)
+	ex.dailyOrders[order.UserID]++
+	for _, warning := range warnings {
+		key := warning.UserID + "/" + warning.Limit
+		if last, ok := ex.lastWarned[key]; ok && now.Sub(last) < interval {
+			continue
+		}
+		ex.lastWarned[key] = now
+		publish = append(publish, warning)
+	}
+	ex.quotaMu.Unlock()
+
+	if ex.onRiskWarning != nil {
+		for i := range publish {
+			ex.onRiskWarning(&publish[i])
+		}
+	}
+}
+
+// dailyOrderCount returns how many orders a user has placed today
+func (ex *Exchange) dailyOrderCount(userID string) int {
+	ex.quotaMu.Lock()
+	defer ex.quotaMu.Unlock()
+	ex.rollQuotaDay(ex.clock.Now())
+	return ex.dailyOrders[userID]
+}
+
+// rollQuotaDay resets the daily order counts once the UTC day changes. It must
+// be called with quotaMu held.
+func (ex *Exchange) rollQuotaDay(now time.Time) {
+	day := now.UTC().Format("2006-01-02")
+	if day != ex.quotaDay {
+		ex.quotaDay = day
+		ex.dailyOrders = make(map[string]int)
+	}
+}
+
+// openOrderCount counts a user's accepted orders on a symbol that have not
+// reached a terminal status; every such order holds a reservation
+func (ex *Exchange) openOrderCount(userID, symbol string) int {
+	ex.resMu.Lock()
+	defer ex.resMu.Unlock()
+
+	count := 0
+	for _, res := range ex.reservations {
+		if res.userID == userID && res.symbol == symbol && !res.ended {
+			count++
+		}
+	}
+	return count
+}
+
+// AccountSummary reports a user's open orders, locked funds and remaining
+// risk headroom on a symbol
+func (ex *Exchange) AccountSummary(ctx context.Context, userID, symbol string) (*AccountSummary, error) {
+	baseAsset, quoteAsset, err := ex.symbolAssets(symbol)
+	if err != nil {
+		return nil, err
+	}
+	summary := &AccountSummary{
+		Symbol:      symbol,
+		OpenOrders:  ex.openOrderCount(userID, symbol),
+		DailyOrders: ex.dailyOrderCount(userID),
+		Locked:      make(map[string]float64, 2),
+	}
+
+	var position float64
+	for _, asset := range []string{baseAsset, quoteAsset} {
+		available, locked, err := ex.balanceStore.GetBalance(ctx, userID, asset)
+		if err != nil {
+			return nil, err
+		}
+		summary.Locked[asset] = locked
+		if asset == baseAsset {
+			position = available + locked
+		}
+	}
+
+	limits := ex.limitsFor(userID)
+	if limits.MaxOpenOrders > 0 {
+		remaining := limits.MaxOpenOrders - summary.OpenOrders
+		if remaining < 0 {
+			remaining = 0
+		}
+		summary.Headroom.OpenOrders = &remaining
+		summary.Utilization.OpenOrders = utilization(float64(summary.OpenOrders), float64(limits.MaxOpenOrders))
+	}
+	if limits.MaxPosition > 0 {
+		remaining := limits.MaxPosition - position
+		if remaining < 0 {
+			remaining = 0
+		}
+		summary.Headroom.Position = &remaining
+		summary.Utilization.Position = utilization(position, limits.MaxPosition)
+	}
+	if limits.MaxDailyOrders > 0 {
+		summary.Utilization.DailyOrders = utilization(float64(summary.DailyOrders), float64(limits.MaxDailyOrders))
+	}
+	if limits.MaxOpenNotional > 0 {
+		open := ex.openNotional(userID, symbol)
+		remaining := limits.MaxOpenNotional - open
+		if remaining < 0 {
+			remaining = 0
+		}
+		summary.Headroom.OpenNotional = &remaining
+		summary.Utilization.OpenNotional = utilization(open, limits.MaxOpenNotional)
+	}
+
+	return summary, nil
+}
+
+func utilization(used, max float64) *float64 {
+	fraction := used / max
+	return &fraction
+}
@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrInvalidRiskProfile is returned for a profile with a negative limit
+var ErrInvalidRiskProfile = errors.New("invalid risk profile")
+
+// RiskProfile overrides the default limits for one user. Zero leaves a limit
+// unenforced for that user.
+type RiskProfile struct {
+	UserID           string  `json:"user_id"`
+	MaxOpenOrders    int     `json:"max_open_orders"`
+	MaxPosition      float64 `json:"max_position"`
+	MaxDailyOrders   int     `json:"max_daily_orders"`
+	MaxOrderNotional float64 `json:"max_order_notional"`
+	MaxOpenNotional  float64 `json:"max_open_notional"`
+}
+
+// RiskProfileStore persists per-user risk profiles
+type RiskProfileStore interface {
+	GetRiskProfiles(ctx context.Context) ([]*RiskProfile, error)
+	SaveRiskProfile(ctx context.Context, profile *RiskProfile) error
+	DeleteRiskProfile(ctx context.Context, userID string) error
+}
+
+// RiskLimitError is an order rejected by one specific limit
+type RiskLimitError struct {
+	Limit string  `json:"limit"`
+	Used  float64 `json:"used"`
+	Max   float64 `json:"max"`
+	msg   string
+}
+
+func (e *RiskLimitError) Error() string { return ErrRiskLimit.Error() + ": " + e.msg }
+func (e *RiskLimitError) Unwrap() error { return ErrRiskLimit }
+
+func riskLimitError(limit string, used, max float64, format string, args ...interface{}) error {
+	return &RiskLimitError{Limit: limit, Used: used, Max: max, msg: fmt.Sprintf(format, args...)}
+}
+
+// SetRiskProfileStore loads every stored profile and persists later changes.
+// It must be called before Start.
+func (ex *Exchange) SetRiskProfileStore(store RiskProfileStore) error {
+	profiles, err := store.GetRiskProfiles(ex.ctx)
+	if err != nil {
+		return err
+	}
+
+	ex.riskMu.Lock()
+	defer ex.riskMu.Unlock()
+	ex.riskProfileStore = store
+	ex.riskProfiles = make(map[string]*RiskProfile, len(profiles))
+	for _, profile := range profiles {
+		ex.riskProfiles[profile.UserID] = profile
+	}
+	return nil
+}
+
+// SetRiskProfile stores a user's profile and applies it to their next order
+func (ex *Exchange) SetRiskProfile(ctx context.Context, profile RiskProfile) error {
+	if profile.MaxOpenOrders < 0 || profile.MaxPosition < 0 || profile.MaxDailyOrders < 0 ||
+		profile.MaxOrderNotional < 0 || profile.MaxOpenNotional < 0 {
+		return fmt.Errorf("%w: limits must not be negative", ErrInvalidRiskProfile)
+	}
+
+	ex.riskMu.Lock()
+	defer ex.riskMu.Unlock()
+	if ex.riskProfileStore != nil {
+		if err := ex.riskProfileStore.SaveRiskProfile(ctx, &profile); err != nil {
+			return err
+		}
+	}
+	ex.riskProfiles[profile.UserID] = &profile
+	return nil
+}
+
+// DeleteRiskProfile returns a user to the default limits
+func (ex *Exchange) DeleteRiskProfile(ctx context.Context, userID string) error {
+	ex.riskMu.Lock()
+	defer ex.riskMu.Unlock()
+	if ex.riskProfileStore != nil {
+		if err := ex.riskProfileStore.DeleteRiskProfile(ctx, userID); err != nil {
+			return err
+		}
+	}
+	delete(ex.riskProfiles, userID)
+	return nil
+}
+
+// RiskProfiles lists the users with their own profile, by user ID
+func (ex *Exchange) RiskProfiles() []RiskProfile {
+	ex.riskMu.RLock()
+	defer ex.riskMu.RUnlock()
+
+	profiles := make([]RiskProfile, 0, len(ex.riskProfiles))
+	for _, profile := range ex.riskProfiles {
+		profiles = append(profiles, *profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].UserID < profiles[j].UserID })
+	return profiles
+}
+
+// EffectiveRiskProfile is the limits a user's orders are checked against
+func (ex *Exchange) EffectiveRiskProfile(userID string) RiskProfile {
+	return profileFromLimits(userID, ex.limitsFor(userID))
+}
+
+// DefaultRiskProfile is the limits of users without their own profile
+func (ex *Exchange) DefaultRiskProfile() RiskProfile {
+	ex.riskMu.RLock()
+	defer ex.riskMu.RUnlock()
+	return profileFromLimits("", ex.riskLimits)
+}
+
+func profileFromLimits(userID string, limits RiskLimits) RiskProfile {
+	return RiskProfile{
+		UserID:           userID,
+		MaxOpenOrders:    limits.MaxOpenOrders,
+		MaxPosition:      limits.MaxPosition,
+		MaxDailyOrders:   limits.MaxDailyOrders,
+		MaxOrderNotional: limits.MaxOrderNotional,
+		MaxOpenNotional:  limits.MaxOpenNotional,
+	}
+}
+
+// limitsFor returns the default limits with the user's profile, if any,
+// replacing every per-user cap
+func (ex *Exchange) limitsFor(userID string) RiskLimits {
+	ex.riskMu.RLock()
+	defer ex.riskMu.RUnlock()
+
+	limits := ex.riskLimits
+	if profile, ok := ex.riskProfiles[userID]; ok {
+		limits.MaxOpenOrders = profile.MaxOpenOrders
+		limits.MaxPosition = profile.MaxPosition
+		limits.MaxDailyOrders = profile.MaxDailyOrders
+		limits.MaxOrderNotional = profile.MaxOrderNotional
+		limits.MaxOpenNotional = profile.MaxOpenNotional
+	}
+	return limits
+}
+
+// openNotional is the value of a user's open orders on a symbol at their
+// limit prices
+func (ex *Exchange) openNotional(userID, symbol string) float64 {
+	orders := ex.openOrders.forUser(userID, symbol)
+	var notional float64
+	for _, order := range orders {
+		notional += order.Price * order.RemainingQty
+	}
+	return notional
+}
@@ -0,0 +1,174 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/clock"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// Each order placed in turn takes exactly its share of headroom, which only
+// shrinks until the limit refuses the next order, and a cancel gives its
+// share back
+func TestHeadroomShrinksWithEachOrder(t *testing.T) {
+	const orders = 5
+	notional := 0.1 * referencePrice
+	ex := newTestExchange(t, func(ex *engine.Exchange) {
+		ex.SetRiskLimits(engine.RiskLimits{MaxOpenOrders: orders, MaxOpenNotional: orders * notional, MaxPosition: 10})
+	})
+	ex.store.Deposit("buyer", "USD", 100000)
+
+	summary := func() *engine.AccountSummary {
+		t.Helper()
+		summary, err := ex.AccountSummary(context.Background(), "buyer", "BTC-USD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return summary
+	}
+	before := summary()
+	if *before.Headroom.OpenOrders != orders || *before.Headroom.OpenNotional != orders*notional || *before.Headroom.Position != 10 {
+		t.Fatalf("headroom before any order = %d orders, %g notional, %g position", *before.Headroom.OpenOrders, *before.Headroom.OpenNotional, *before.Headroom.Position)
+	}
+
+	var placed []*domain.Order
+	for i := 1; i <= orders; i++ {
+		placed = append(placed, ex.rest(t, "buyer", domain.OrderSideBuy, 0.1, referencePrice))
+		after := summary()
+		if got := *after.Headroom.OpenOrders; got != *before.Headroom.OpenOrders-1 {
+			t.Errorf("order %d: open orders headroom %d after %d, want one less", i, got, *before.Headroom.OpenOrders)
+		}
+		if got, want := *after.Headroom.OpenNotional, *before.Headroom.OpenNotional-notional; got > want+1e-6 || got < want-1e-6 {
+			t.Errorf("order %d: open notional headroom %g, want %g", i, got, want)
+		}
+		if *after.Headroom.Position != *before.Headroom.Position {
+			t.Errorf("order %d: position headroom moved from %g to %g without a fill", i, *before.Headroom.Position, *after.Headroom.Position)
+		}
+		before = after
+	}
+	if *before.Headroom.OpenOrders != 0 {
+		t.Fatalf("open orders headroom %d with every order placed, want 0", *before.Headroom.OpenOrders)
+	}
+
+	over := domain.NewOrder("buyer", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 0.1, referencePrice)
+	if err := ex.SubmitOrder(context.Background(), over); !errors.Is(err, engine.ErrRiskLimit) {
+		t.Fatalf("order past the limit: err = %v, want ErrRiskLimit", err)
+	}
+	if after := summary(); *after.Headroom.OpenOrders != 0 || *after.Headroom.OpenNotional > 1e-6 {
+		t.Errorf("a refused order changed headroom to %d orders, %g notional", *after.Headroom.OpenOrders, *after.Headroom.OpenNotional)
+	}
+
+	ex.cancel(t, placed[0])
+	ex.eventually(t, "the cancelled order's headroom to return", func() bool {
+		after := summary()
+		return *after.Headroom.OpenOrders == 1 && *after.Headroom.OpenNotional > notional-1e-6
+	})
+}
+
+// steppedClock is the wall clock moved forward by hand, so the poller keeps
+// running while a test jumps past intervals
+type steppedClock struct {
+	clock.Real
+	mu     sync.Mutex
+	offset time.Duration
+}
+
+func (c *steppedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Real.Now().Add(c.offset)
+}
+
+func (c *steppedClock) step(d time.Duration) {
+	c.mu.Lock()
+	c.offset += d
+	c.mu.Unlock()
+}
+
+// Orders start warning once they reach the soft fraction of a limit. Every
+// placement past it carries the warning, but the event goes out once per user
+// and limit each WarningInterval.
+func TestSoftWarningIsRateLimited(t *testing.T) {
+	clk := &steppedClock{}
+	var mu sync.Mutex
+	var events []engine.RiskWarning
+	ex := newTestExchange(t, func(ex *engine.Exchange) {
+		ex.SetClock(clk)
+		ex.SetRiskLimits(engine.RiskLimits{MaxDailyOrders: 10, SoftFraction: 0.8, WarningInterval: time.Minute})
+		ex.SetOnRiskWarningCallback(func(warning *engine.RiskWarning) {
+			mu.Lock()
+			events = append(events, *warning)
+			mu.Unlock()
+		})
+	})
+	ex.store.Deposit("buyer", "USD", 100000)
+	ex.store.Deposit("other", "USD", 100000)
+
+	place := func(userID string) []engine.RiskWarning {
+		t.Helper()
+		order := domain.NewOrder(userID, "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 0.01, referencePrice-1000)
+		warnings, err := ex.SubmitOrderWithWarnings(context.Background(), order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return warnings
+	}
+	published := func() []engine.RiskWarning {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]engine.RiskWarning(nil), events...)
+	}
+
+	for i := 1; i < 8; i++ {
+		if warnings := place("buyer"); len(warnings) != 0 {
+			t.Fatalf("order %d of 10 warned below the soft fraction: %+v", i, warnings)
+		}
+	}
+	if got := published(); len(got) != 0 {
+		t.Fatalf("warning events below the soft fraction: %+v", got)
+	}
+
+	warnings := place("buyer")
+	if len(warnings) != 1 || warnings[0].Limit != engine.LimitDailyOrders || warnings[0].Used != 8 || warnings[0].Utilization != 0.8 {
+		t.Fatalf("order 8 of 10 warnings = %+v, want daily_orders at 0.8", warnings)
+	}
+	if got := published(); len(got) != 1 || got[0].UserID != "buyer" || got[0].Limit != engine.LimitDailyOrders {
+		t.Fatalf("events after the soft fraction = %+v, want one daily_orders warning", got)
+	}
+
+	if warnings := place("buyer"); len(warnings) != 1 || warnings[0].Used != 9 {
+		t.Fatalf("order 9 of 10 warnings = %+v, want daily_orders at 9", warnings)
+	}
+	if got := published(); len(got) != 1 {
+		t.Fatalf("a second warning within the interval was published: %+v", got[1:])
+	}
+
+	// The interval is per user, so another user's first warning goes out
+	for i := 0; i < 8; i++ {
+		place("other")
+	}
+	if got := published(); len(got) != 2 || got[1].UserID != "other" {
+		t.Fatalf("events = %+v, want other's first warning despite buyer's", got)
+	}
+
+	clk.step(time.Minute)
+	if warnings := place("buyer"); len(warnings) != 1 || warnings[0].Used != 10 {
+		t.Fatalf("order 10 of 10 warnings = %+v, want daily_orders at 10", warnings)
+	}
+	if got := published(); len(got) != 3 || got[2].UserID != "buyer" || got[2].Used != 10 {
+		t.Fatalf("events = %+v, want buyer warned again once the interval passed", got)
+	}
+
+	over := domain.NewOrder("buyer", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 0.01, referencePrice-1000)
+	if _, err := ex.SubmitOrderWithWarnings(context.Background(), over); !errors.Is(err, engine.ErrRiskLimit) {
+		t.Fatalf("order 11 of 10: err = %v, want ErrRiskLimit", err)
+	}
+	if got := published(); len(got) != 3 {
+		t.Errorf("a refused order published a warning: %+v", got[3:])
+	}
+}
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// quantityEpsilon absorbs float drift when comparing derived quantities
+const quantityEpsilon = 1e-9
+
+// SelfCheckReport describes the outcome of a single book consistency check
+type SelfCheckReport struct {
+	Symbol     string        `json:"symbol"`
+	CheckedAt  time.Time     `json:"checked_at"`
+	Duration   time.Duration `json:"duration_ns"`
+	BuyOrders  int           `json:"buy_orders"`
+	SellOrders int           `json:"sell_orders"`
+	Violations []string      `json:"violations"`
+	Repaired   bool          `json:"repaired"`
+}
+
+// Healthy reports whether the check found no violations
+func (r *SelfCheckReport) Healthy() bool {
+	return len(r.Violations) == 0
+}
+
+// SelfCheckStats counts checks and repairs performed on an engine, along with
+// zero-quantity orders filtered from snapshots or evicted from the book
+type SelfCheckStats struct {
+	Checks        uint64 `json:"checks"`
+	Repairs       uint64 `json:"repairs"`
+	PhantomLevels uint64 `json:"phantom_levels"`
+	DustEvictions uint64 `json:"dust_evictions"`
+}
+
+// SelfCheck verifies the heap ordering invariants, the index of order
+// positions and per-order quantity bookkeeping of both sides of the book. If anything is inconsistent the
+// heaps are rebuilt in place from the resting order set.
+func (me *MatchingEngine) SelfCheck() *SelfCheckReport {
+	defer me.flush()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	start := time.Now()
+	report := &SelfCheckReport{
+		Symbol:     me.symbol,
+		CheckedAt:  domain.Now(),
+		BuyOrders:  me.buyOrders.Len(),
+		SellOrders: me.sellOrders.Len(),
+		Violations: make([]string, 0),
+	}
+
+	seen := make(map[string]bool, report.BuyOrders+report.SellOrders)
+	report.Violations = append(report.Violations, me.checkHeap(me.buyOrders, domain.OrderSideBuy, seen)...)
+	report.Violations = append(report.Violations, me.checkHeap(me.sellOrders, domain.OrderSideSell, seen)...)
+
+	atomic.AddUint64(&me.selfChecks, 1)
+
+	if !report.Healthy() {
+		me.rebuildBook()
+		report.Repaired = true
+		atomic.AddUint64(&me.selfRepairs, 1)
+	}
+
+	report.Duration = time.Since(start)
+	return report
+}
+
+// checkHeap validates a single side of the book. It must be called with the
+// engine lock held.
+func (me *MatchingEngine) checkHeap(h *OrderHeap, side domain.OrderSide, seen map[string]bool) []string {
+	violations := make([]string, 0)
+
+	for i, order := range h.orders {
+		if order == nil {
+			violations = append(violations, fmt.Sprintf("%s heap: nil order at index %d", side, i))
+			continue
+		}
+		if order.Side != side {
+			violations = append(violations, fmt.Sprintf("%s heap: order %s has side %s", side, order.ID, order.Side))
+		}
+		if seen[order.ID] {
+			violations = append(violations, fmt.Sprintf("%s heap: duplicate order %s", side, order.ID))
+		}
+		seen[order.ID] = true
+		if at, ok := h.index[order.ID]; !ok || at != i {
+			violations = append(violations, fmt.Sprintf("%s heap: order %s at %d is indexed at %d", side, order.ID, i, h.find(order.ID)))
+		}
+
+		if isDust(order.RemainingQty) {
+			violations = append(violations, fmt.Sprintf("%s heap: order %s is resting with zero remaining quantity", side, order.ID))
+		}
+
+		expected := order.Quantity - order.FilledQuantity
+		if diff := expected - order.RemainingQty; diff > quantityEpsilon || diff < -quantityEpsilon {
+			violations = append(violations, fmt.Sprintf("%s heap: order %s remaining %.8f != quantity-filled %.8f",
+				side, order.ID, order.RemainingQty, expected))
+		}
+
+		if i > 0 {
+			parent := (i - 1) / 2
+			if h.orders[parent] != nil && h.Less(i, parent) {
+				violations = append(violations, fmt.Sprintf("%s heap: order %s at %d outranks parent %s at %d",
+					side, order.ID, i, h.orders[parent].ID, parent))
+			}
+		}
+	}
+	if len(h.index) != len(h.orders) {
+		violations = append(violations, fmt.Sprintf("%s heap: %d orders indexed, %d resting", side, len(h.index), len(h.orders)))
+	}
+
+	return violations
+}
+
+// rebuildBook reconstructs both heaps from the orders currently resting in
+// them, dropping nil entries and duplicates and evicting orders with nothing
+// left to fill. It must be called with the engine lock held.
+func (me *MatchingEngine) rebuildBook() {
+	all := make([]*domain.Order, 0, me.buyOrders.Len()+me.sellOrders.Len())
+	all = append(all, me.buyOrders.orders...)
+	all = append(all, me.sellOrders.orders...)
+
+	buys := make([]*domain.Order, 0, me.buyOrders.Len())
+	sells := make([]*domain.Order, 0, me.sellOrders.Len())
+	seen := make(map[string]bool, len(all))
+
+	for _, order := range all {
+		if order == nil || seen[order.ID] {
+			continue
+		}
+		seen[order.ID] = true
+		order.RemainingQty = order.Quantity - order.FilledQuantity
+
+		if isDust(order.RemainingQty) {
+			me.evictDust(order)
+			continue
+		}
+
+		if order.Side == domain.OrderSideBuy {
+			buys = append(buys, order)
+		} else {
+			sells = append(sells, order)
+		}
+	}
+
+	me.buyOrders.reset(buys)
+	me.sellOrders.reset(sells)
+}
+
+// evictDust terminates an order found resting with zero remaining quantity.
+// It must be called with the engine lock held.
+func (me *MatchingEngine) evictDust(order *domain.Order) {
+	order.RemainingQty = 0
+	if order.FilledQuantity > 0 {
+		order.Status = domain.OrderStatusFilled
+	} else {
+		order.Status = domain.OrderStatusCancelled
+	}
+	order.UpdatedAt = domain.Now()
+	atomic.AddUint64(&me.dustEvictions, 1)
+	me.emitOrderUpdate(order)
+}
+
+// SelfCheckStats returns how many checks and repairs the engine has performed
+func (me *MatchingEngine) SelfCheckStats() SelfCheckStats {
+	return SelfCheckStats{
+		Checks:        atomic.LoadUint64(&me.selfChecks),
+		Repairs:       atomic.LoadUint64(&me.selfRepairs),
+		PhantomLevels: atomic.LoadUint64(&me.phantomLevels),
+		DustEvictions: atomic.LoadUint64(&me.dustEvictions),
+	}
+}
+
+// RunSelfCheck checks a single symbol's book on demand
+func (ex *Exchange) RunSelfCheck(symbol string) (*SelfCheckReport, bool) {
+	ex.mu.RLock()
+	engine, exists := ex.engines[symbol]
+	ex.mu.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+
+	report := engine.SelfCheck()
+	if !report.Healthy() {
+		logSelfCheckIncident(report)
+	}
+	return report, true
+}
+
+// checkAllBooks verifies every engine's book; it runs on the exchange clock
+func (ex *Exchange) checkAllBooks() {
+	for _, symbol := range ex.GetAllSymbols() {
+		ex.RunSelfCheck(symbol)
+	}
+}
+
+func logSelfCheckIncident(report *SelfCheckReport) {
+	log.Printf("🚨 INCIDENT book corruption on %s: %d violation(s), repaired=%t, buys=%d sells=%d, took %s",
+		report.Symbol, len(report.Violations), report.Repaired, report.BuyOrders, report.SellOrders, report.Duration)
+	for _, violation := range report.Violations {
+		log.Printf("🚨   %s: %s", report.Symbol, violation)
+	}
+}
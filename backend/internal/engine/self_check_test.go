@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// restingBook is an engine with orders resting on both sides, from 45001 up
+// and 44999 down, and a drained event stream
+func restingBook(t testing.TB, perSide int) *MatchingEngine {
+	t.Helper()
+	me := NewMatchingEngine("BTC-USD")
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go me.discardEvents(done)
+	for i := 0; i < perSide; i++ {
+		offset := float64(1 + i%500)
+		me.ProcessOrder(domain.NewOrder("maker", "BTC-USD", domain.OrderSideSell, domain.OrderTypeLimit, 0.01, 45000+offset))
+		me.ProcessOrder(domain.NewOrder("maker", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 0.01, 45000-offset))
+	}
+	return me
+}
+
+// Each kind of corruption is reported, repaired in place, and leaves a book
+// that checks clean and still matches best price first
+func TestSelfCheckDetectsAndRepairsCorruption(t *testing.T) {
+	corruptions := []struct {
+		name      string
+		violation string
+		corrupt   func(me *MatchingEngine)
+	}{
+		{"heap order", "outranks parent", func(me *MatchingEngine) {
+			// The worst ask at the root, without going through Swap
+			h := me.sellOrders
+			last := h.Len() - 1
+			h.orders[0], h.orders[last] = h.orders[last], h.orders[0]
+			h.index[h.orders[0].ID], h.index[h.orders[last].ID] = 0, last
+		}},
+		{"stale index", "is indexed at", func(me *MatchingEngine) {
+			h := me.buyOrders
+			h.index[h.orders[3].ID] = 7
+		}},
+		{"missing index entry", "is indexed at -1", func(me *MatchingEngine) {
+			delete(me.buyOrders.index, me.buyOrders.orders[5].ID)
+		}},
+		{"index of a departed order", "orders indexed", func(me *MatchingEngine) {
+			me.sellOrders.index["gone"] = 2
+		}},
+		{"remaining quantity", "!= quantity-filled", func(me *MatchingEngine) {
+			me.sellOrders.orders[4].RemainingQty = 0.5
+		}},
+		{"dust resting", "zero remaining quantity", func(me *MatchingEngine) {
+			order := me.buyOrders.orders[6]
+			order.FilledQuantity = order.Quantity
+			order.RemainingQty = 0
+		}},
+		{"duplicate order", "duplicate order", func(me *MatchingEngine) {
+			h := me.sellOrders
+			h.orders = append(h.orders, h.orders[1])
+		}},
+		{"wrong side", "has side", func(me *MatchingEngine) {
+			h := me.buyOrders
+			h.orders = append(h.orders, me.sellOrders.orders[0])
+			h.index[me.sellOrders.orders[0].ID] = h.Len() - 1
+		}},
+		{"nil order", "nil order", func(me *MatchingEngine) {
+			me.buyOrders.orders = append(me.buyOrders.orders, nil)
+		}},
+	}
+	for _, corruption := range corruptions {
+		t.Run(corruption.name, func(t *testing.T) {
+			me := restingBook(t, 50)
+			if report := me.SelfCheck(); !report.Healthy() {
+				t.Fatalf("clean book reported %v", report.Violations)
+			}
+
+			corruption.corrupt(me)
+			report := me.SelfCheck()
+			if report.Healthy() || !report.Repaired {
+				t.Fatalf("corruption not detected: %+v", report)
+			}
+			if !strings.Contains(strings.Join(report.Violations, "\n"), corruption.violation) {
+				t.Errorf("violations %q don't mention %q", report.Violations, corruption.violation)
+			}
+			if stats := me.SelfCheckStats(); stats.Repairs != 1 {
+				t.Errorf("%d repairs counted, want 1", stats.Repairs)
+			}
+			if report := me.SelfCheck(); !report.Healthy() {
+				t.Fatalf("repaired book reported %v", report.Violations)
+			}
+			checkMatchesBestFirst(t, me)
+		})
+	}
+}
+
+// checkMatchesBestFirst takes the best ask and bid with crossing orders and
+// cancels an order by ID, all of which rely on the heap and its index
+func checkMatchesBestFirst(t *testing.T, me *MatchingEngine) {
+	t.Helper()
+	bestAsk, _ := bestLevel(me.sellOrders)
+	bestBid, _ := bestLevel(me.buyOrders)
+	if bestAsk != 45001 || bestBid != 44999 {
+		t.Fatalf("best ask %g and bid %g, want 45001 and 44999", bestAsk, bestBid)
+	}
+	buy := domain.NewOrder("taker", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 0.01, 46000)
+	if _, trades := me.ProcessOrderWithFills(buy); len(trades) != 1 || trades[0].Price != 45001 {
+		t.Errorf("buy traded %v, want once at 45001", trades)
+	}
+	resting := me.sellOrders.orders[me.sellOrders.Len()-1]
+	if !me.CancelOrder(resting.ID) {
+		t.Errorf("order %s could not be cancelled", resting.ID)
+	}
+	if i := me.sellOrders.find(resting.ID); i != -1 {
+		t.Errorf("cancelled order %s is still indexed at %d", resting.ID, i)
+	}
+}
+
+// A check of a 100k-order book is cheap enough to run every few minutes
+func BenchmarkSelfCheck(b *testing.B) {
+	for _, orders := range []int{1000, 100000} {
+		b.Run(fmt.Sprintf("%d orders", orders), func(b *testing.B) {
+			me := NewMatchingEngine("BTC-USD")
+			for i := 0; i < orders/2; i++ {
+				offset := float64(1 + i%5000)
+				heap.Push(me.sellOrders, domain.NewOrder("maker", "BTC-USD", domain.OrderSideSell, domain.OrderTypeLimit, 0.01, 45000+offset))
+				heap.Push(me.buyOrders, domain.NewOrder("maker", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 0.01, 45000-offset))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if report := me.SelfCheck(); !report.Healthy() {
+					b.Fatal(report.Violations)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// ErrAlreadySettled is returned by BalanceStore.SettleTrade for a trade whose
+// settlement was already applied
+var ErrAlreadySettled = errors.New("already settled")
+
+const (
+	// settlementRetryInterval is how often due retries are attempted
+	settlementRetryInterval = time.Second
+	// Retries back off exponentially between these bounds
+	settlementBackoffMin = time.Second
+	settlementBackoffMax = 5 * time.Minute
+)
+
+// PendingSettlement is a matched trade whose persistence or settlement failed
+// and is being retried
+type PendingSettlement struct {
+	Trade *domain.Trade `json:"trade"`
+	// Saved is set once the trade row is stored; only settlement is left
+	Saved         bool      `json:"saved"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error"`
+	FirstFailedAt time.Time `json:"first_failed_at"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+}
+
+// SettlementStore persists pending settlements so they survive a restart
+type SettlementStore interface {
+	SavePendingSettlement(ctx context.Context, pending *PendingSettlement) error
+	DeletePendingSettlement(ctx context.Context, tradeID string) error
+	GetPendingSettlements(ctx context.Context) ([]*PendingSettlement, error)
+}
+
+// SettlementStats counts the retry queue's activity since startup
+type SettlementStats struct {
+	Pending   int    `json:"pending"`
+	Queued    uint64 `json:"queued"`
+	Retried   uint64 `json:"retried"`
+	Recovered uint64 `json:"recovered"`
+	// Duplicates counts trades delivered again after being stored, which
+	// were dropped
+	Duplicates uint64 `json:"duplicates"`
+	// AlreadySettled counts settlements skipped because the trade's funds
+	// had already moved
+	AlreadySettled uint64 `json:"already_settled"`
+	// PendingUnlocks counts ended orders whose locked funds failed to
+	// unlock and are being retried
+	PendingUnlocks int `json:"pending_unlocks"`
+}
+
+// SetSettlementStore persists the retry queue. It must be called before
+// Start, which reloads whatever a previous run left pending.
+func (ex *Exchange) SetSettlementStore(store SettlementStore) {
+	ex.settlementStore = store
+}
+
+// queueSettlement schedules a failed trade for retry. The trade's effects on
+// the book and on in-memory locks already happened, so it must eventually be
+// stored and settled.
+func (ex *Exchange) queueSettlement(trade *domain.Trade, saved bool, cause error) {
+	now := ex.clock.Now()
+	pending := &PendingSettlement{
+		Trade:         trade,
+		Saved:         saved,
+		Attempts:      1,
+		LastError:     cause.Error(),
+		FirstFailedAt: now,
+		NextAttemptAt: now.Add(settlementBackoff(1)),
+	}
+
+	ex.persistPendingSettlement(pending)
+
+	ex.settleMu.Lock()
+	ex.pendingSettlements = append(ex.pendingSettlements, pending)
+	ex.settleMu.Unlock()
+	atomic.AddUint64(&ex.settlementsQueued, 1)
+}
+
+// retrySettlements attempts every pending settlement and unlock that is
+// due. It holds drainMu like the drain goroutine, so a retry is never
+// settled alongside a new trade: settling folds fills into positions by
+// reading and rewriting them, which is only safe one settlement at a time.
+func (ex *Exchange) retrySettlements() {
+	ex.drainMu.Lock()
+	defer ex.drainMu.Unlock()
+	ex.retryPendingSettlements(false)
+	ex.retryPendingUnlocks(false)
+}
+
+// retryPendingSettlements attempts the due settlements, or all of them when
+// force is set, and returns how many are still pending. It must be called
+// with drainMu held.
+func (ex *Exchange) retryPendingSettlements(force bool) int {
+	now := ex.clock.Now()
+	ex.settleMu.Lock()
+	due := make([]*PendingSettlement, 0, len(ex.pendingSettlements))
+	for _, pending := range ex.pendingSettlements {
+		if force || !now.Before(pending.NextAttemptAt) {
+			due = append(due, pending)
+		}
+	}
+	ex.settleMu.Unlock()
+
+	for _, pending := range due {
+		// Attempt on a copy so readers of the queue never see it mid-update
+		ex.settleMu.Lock()
+		attempt := *pending
+		ex.settleMu.Unlock()
+
+		atomic.AddUint64(&ex.settlementsRetried, 1)
+		err := ex.completeSettlement(&attempt)
+		if err == nil {
+			ex.removePendingSettlement(pending)
+			atomic.AddUint64(&ex.settlementsRecovered, 1)
+			log.Printf("Trade %s settled after %d attempts%s", attempt.Trade.ID, attempt.Attempts+1, requestTag(attempt.Trade.RequestID))
+			continue
+		}
+
+		attempt.Attempts++
+		attempt.LastError = err.Error()
+		attempt.NextAttemptAt = now.Add(settlementBackoff(attempt.Attempts))
+		ex.settleMu.Lock()
+		*pending = attempt
+		ex.settleMu.Unlock()
+		log.Printf("Retry %d of trade %s failed: %v%s", attempt.Attempts, attempt.Trade.ID, err, requestTag(attempt.Trade.RequestID))
+		ex.persistPendingSettlement(&attempt)
+	}
+
+	ex.settleMu.Lock()
+	defer ex.settleMu.Unlock()
+	return len(ex.pendingSettlements)
+}
+
+// completeSettlement stores and settles a trade. Both steps are idempotent,
+// so a retry after a partial success doesn't repeat either one.
+func (ex *Exchange) completeSettlement(pending *PendingSettlement) error {
+	if !pending.Saved {
+		if _, err := ex.tradeStore.SaveTrade(ex.background(), pending.Trade); err != nil {
+			return err
+		}
+		pending.Saved = true
+	}
+	return ex.settleTrade(pending.Trade)
+}
+
+func (ex *Exchange) removePendingSettlement(done *PendingSettlement) {
+	ex.settleMu.Lock()
+	for i, pending := range ex.pendingSettlements {
+		if pending == done {
+			ex.pendingSettlements = append(ex.pendingSettlements[:i], ex.pendingSettlements[i+1:]...)
+			break
+		}
+	}
+	ex.settleMu.Unlock()
+
+	if ex.settlementStore != nil {
+		if err := ex.settlementStore.DeletePendingSettlement(ex.background(), done.Trade.ID); err != nil {
+			log.Printf("Failed to clear pending settlement %s: %v", done.Trade.ID, err)
+		}
+	}
+}
+
+func (ex *Exchange) persistPendingSettlement(pending *PendingSettlement) {
+	if ex.settlementStore == nil {
+		return
+	}
+	if err := ex.settlementStore.SavePendingSettlement(ex.background(), pending); err != nil {
+		log.Printf("Failed to persist pending settlement %s: %v", pending.Trade.ID, err)
+	}
+}
+
+// loadPendingSettlements queues the settlements a previous run left behind
+func (ex *Exchange) loadPendingSettlements() {
+	if ex.settlementStore == nil {
+		return
+	}
+	stored, err := ex.settlementStore.GetPendingSettlements(ex.ctx)
+	if err != nil {
+		log.Printf("Failed to load pending settlements: %v", err)
+		return
+	}
+	if len(stored) == 0 {
+		return
+	}
+
+	ex.settleMu.Lock()
+	ex.pendingSettlements = append(ex.pendingSettlements, stored...)
+	ex.settleMu.Unlock()
+	log.Printf("Resuming %d pending settlements", len(stored))
+}
+
+// flushSettlements makes a last attempt at every pending settlement and
+// unlock on shutdown and leaves the settlements persisted for the next run
+func (ex *Exchange) flushSettlements() {
+	if locked := ex.retryPendingUnlocks(true); locked > 0 {
+		log.Printf("Warning: %d ended orders still have funds locked", locked)
+	}
+	remaining := ex.retryPendingSettlements(true)
+	if remaining == 0 {
+		return
+	}
+
+	for _, pending := range ex.PendingSettlements() {
+		ex.persistPendingSettlement(&pending)
+	}
+	if ex.settlementStore == nil {
+		log.Printf("❌ %d trades are unsettled and have no store to persist to", remaining)
+		return
+	}
+	log.Printf("Warning: %d trades are still unsettled; they resume on restart", remaining)
+}
+
+// PendingSettlements lists the trades waiting to be stored or settled,
+// oldest first
+func (ex *Exchange) PendingSettlements() []PendingSettlement {
+	ex.settleMu.Lock()
+	defer ex.settleMu.Unlock()
+
+	pending := make([]PendingSettlement, len(ex.pendingSettlements))
+	for i, p := range ex.pendingSettlements {
+		pending[i] = *p
+	}
+	return pending
+}
+
+func (ex *Exchange) SettlementStats() SettlementStats {
+	ex.settleMu.Lock()
+	pending := len(ex.pendingSettlements)
+	unlocks := len(ex.pendingUnlocks)
+	ex.settleMu.Unlock()
+
+	return SettlementStats{
+		Pending:        pending,
+		PendingUnlocks: unlocks,
+		Queued:         atomic.LoadUint64(&ex.settlementsQueued),
+		Retried:        atomic.LoadUint64(&ex.settlementsRetried),
+		Recovered:      atomic.LoadUint64(&ex.settlementsRecovered),
+		Duplicates:     atomic.LoadUint64(&ex.duplicateTrades),
+		AlreadySettled: atomic.LoadUint64(&ex.settlementsSkipped),
+	}
+}
+
+// settlementBackoff is the wait after the given number of failed attempts
+func settlementBackoff(attempts int) time.Duration {
+	backoff := settlementBackoffMin
+	for i := 1; i < attempts && backoff < settlementBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > settlementBackoffMax {
+		backoff = settlementBackoffMax
+	}
+	return backoff
+}
@@ -0,0 +1,197 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/database"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/engine/enginetest"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+// A retried settlement must never run alongside a new trade's, since both
+// rewrite the same position rows
+func TestSettlementRetriesDoNotOverlapNewTrades(t *testing.T) {
+	var settling, overlaps atomic.Int32
+	var failOnce sync.Once
+	var failedID atomic.Value
+	ex := newTestExchange(t)
+	ex.store.BeforeSettle = func(tradeID string) error {
+		failed := false
+		failOnce.Do(func() { failed = true })
+		if failed {
+			failedID.Store(tradeID)
+			return errors.New("database unavailable")
+		}
+		if settling.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		// The retry is slow, so new trades arrive while it settles
+		if failedID.Load() == tradeID {
+			time.Sleep(50 * time.Millisecond)
+		}
+		settling.Add(-1)
+		return nil
+	}
+	ex.store.Deposit("maker", "BTC", 10)
+	ex.store.Deposit("taker", "USD", 1000000)
+
+	// Keep trades coming until the failed one has been retried, at least a
+	// second later
+	trades := 0
+	deadline := time.Now().Add(5 * time.Second)
+	for trades < 10 || ex.SettlementStats().Recovered == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the failed settlement was never retried")
+		}
+		ex.rest(t, "maker", domain.OrderSideSell, 0.001, referencePrice)
+		buy := ex.submit(t, "taker", domain.OrderSideBuy, domain.OrderTypeLimit, 0.001, referencePrice)
+		ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+		trades++
+	}
+
+	if n := overlaps.Load(); n > 0 {
+		t.Errorf("%d settlements ran alongside another", n)
+	}
+	ex.eventually(t, "every trade to settle", func() bool {
+		position := ex.store.Position("taker", "BTC-USD")
+		return position != nil && math.Abs(position.Quantity-float64(trades)*0.001) < 1e-9
+	})
+}
+
+// lostAcks stores trades in the database but reports the first lose saves as
+// failed, like a connection dropped after the commit
+type lostAcks struct {
+	*repository.TradeRepository
+	lose atomic.Int32
+}
+
+func (l *lostAcks) SaveTrade(ctx context.Context, trade *domain.Trade) (bool, error) {
+	inserted, err := l.TradeRepository.SaveTrade(ctx, trade)
+	if err == nil && l.lose.Add(-1) >= 0 {
+		return false, errors.New("connection reset")
+	}
+	return inserted, err
+}
+
+// Saves retried by the settlement queue race redeliveries of the same fills,
+// under their own IDs and under new ones. Each fill is stored once, settled
+// once and counted once in volume.
+func TestConcurrentTradeSaveRetriesStoreOnce(t *testing.T) {
+	const fills, lost, quantity = 8, 3, 0.001
+	db, err := database.NewDB(fmt.Sprintf("sqlite://file:engine-test-%d?mode=memory&cache=shared", databases.Add(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewTradeRepository(db.DB)
+	trades := &lostAcks{TradeRepository: repo}
+	trades.lose.Store(lost)
+
+	var mu sync.Mutex
+	var executed []*domain.Trade
+	store := enginetest.NewStore()
+	ex := startTestExchange(t, store, trades, store, func(ex *engine.Exchange) {
+		ex.SetOnTradeCallback(func(trade *domain.Trade) {
+			mu.Lock()
+			executed = append(executed, trade)
+			mu.Unlock()
+		})
+	})
+	ex.store.Deposit("maker", "BTC", 1)
+	ex.store.Deposit("taker", "USD", 100000)
+	start := time.Now().Add(-time.Minute)
+
+	for i := 0; i < fills; i++ {
+		ex.rest(t, "maker", domain.OrderSideSell, quantity, referencePrice)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, fills)
+	for i := 0; i < fills; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buy := domain.NewOrder("taker", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, quantity, referencePrice)
+			errs <- ex.SubmitOrder(context.Background(), buy)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ex.eventually(t, "every fill to execute", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(executed) == fills
+	})
+
+	// Redeliver every fill from several writers while the lost saves are
+	// still queued for retry
+	var redelivered atomic.Int32
+	mu.Lock()
+	for _, trade := range executed {
+		for i := 0; i < 4; i++ {
+			copied := *trade
+			if i%2 == 1 {
+				copied.ID = domain.NewID()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				inserted, err := repo.SaveTrade(context.Background(), &copied)
+				if err != nil {
+					t.Errorf("redelivering trade %s: %v", copied.ID, err)
+				}
+				if inserted {
+					redelivered.Add(1)
+				}
+			}()
+		}
+	}
+	mu.Unlock()
+	wg.Wait()
+	if n := redelivered.Load(); n > 0 {
+		t.Errorf("%d redelivered fills were stored again", n)
+	}
+
+	ex.eventually(t, "the lost saves to be retried", func() bool {
+		stats := ex.SettlementStats()
+		return stats.Pending == 0 && stats.Recovered == lost
+	})
+
+	var rows int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM trades`).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != fills {
+		t.Errorf("%d trade rows, want %d", rows, fills)
+	}
+	stats, err := repo.GetTradeStats(context.Background(), "BTC-USD", start, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(stats.Volume-fills*quantity) > 1e-9 {
+		t.Errorf("volume %g, want %g", stats.Volume, fills*quantity)
+	}
+	ex.eventually(t, "every fill to settle once", func() bool {
+		position := ex.store.Position("taker", "BTC-USD")
+		return position != nil && math.Abs(position.Quantity-fills*quantity) < 1e-9
+	})
+	if _, locked, _ := ex.store.GetBalance(context.Background(), "maker", "BTC"); math.Abs(locked) > 1e-9 {
+		t.Errorf("maker has %g BTC still locked after every sell filled", locked)
+	}
+}
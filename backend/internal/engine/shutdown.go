@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrExchangeStopping is returned for orders and cancels that arrive after
+// Stop has begun
+var ErrExchangeStopping = errors.New("EXCHANGE_STOPPING")
+
+// shutdownDrainTimeout bounds how long Stop waits for in-flight matching to
+// finish before draining engine output
+const shutdownDrainTimeout = 10 * time.Second
+
+// beginWrite registers an order or cancel with the shutdown barrier. Every
+// successful call must be paired with ex.inflight.Done once the engine has
+// emitted everything the write produces.
+func (ex *Exchange) beginWrite() error {
+	ex.lifecycleMu.Lock()
+	defer ex.lifecycleMu.Unlock()
+	if ex.stopping {
+		return ErrExchangeStopping
+	}
+	ex.inflight.Add(1)
+	return nil
+}
+
+// Stop shuts the exchange down without losing executions: new orders and
+// cancels are refused, orders already accepted finish matching, and every
+// trade and order update the engines emitted is persisted and settled before
+// it returns. Trades whose settlement still fails are left persisted in the
+// retry queue. Stop is safe to call more than once.
+func (ex *Exchange) Stop() {
+	ex.stopOnce.Do(func() {
+		ex.lifecycleMu.Lock()
+		ex.stopping = true
+		ex.lifecycleMu.Unlock()
+
+		if !waitTimeout(&ex.inflight, shutdownDrainTimeout) {
+			log.Printf("Warning: orders still matching after %s, their output may be lost", shutdownDrainTimeout)
+		}
+
+		// Stop the periodic consumers, then drain what is left on this
+		// goroutine. drainMu waits out a drain already in progress.
+		ex.cancel()
+		ex.drainMu.Lock()
+		defer ex.drainMu.Unlock()
+		for _, symbol := range ex.engineSymbols() {
+			ex.mu.RLock()
+			engine := ex.engines[symbol]
+			ex.mu.RUnlock()
+			ex.drainEngine(engine)
+		}
+		ex.flushSettlements()
+		log.Println("Exchange stopped")
+	})
+}
+
+// waitTimeout waits for wg, reporting false if timeout passes first
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
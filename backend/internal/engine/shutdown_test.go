@@ -0,0 +1,74 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// Stopping straight after a burst of crossing orders persists every trade
+// the engine made: what is left on the book plus what was saved as traded
+// accounts for all that was submitted, and each saved order's fills add up
+// to its saved trades
+func TestStopPersistsEveryTrade(t *testing.T) {
+	ex := newTestExchange(t)
+	ex.store.Deposit("buyer", "USD", 10000000)
+	ex.store.Deposit("seller", "BTC", 100)
+
+	const burst = 500
+	var bought, sold float64
+	for i := 0; i < burst; i++ {
+		quantity := 0.01 * float64(1+i%3)
+		sell := ex.submit(t, "seller", domain.OrderSideSell, domain.OrderTypeLimit, quantity, referencePrice+float64(i%5))
+		buy := ex.submit(t, "buyer", domain.OrderSideBuy, domain.OrderTypeLimit, quantity, referencePrice+float64(i%7-3))
+		sold += sell.Quantity
+		bought += buy.Quantity
+	}
+	ex.Stop()
+
+	order := domain.NewOrder("buyer", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 0.01, referencePrice)
+	if err := ex.SubmitOrder(context.Background(), order); !errors.Is(err, engine.ErrExchangeStopping) {
+		t.Errorf("order after Stop: err = %v, want ErrExchangeStopping", err)
+	}
+
+	trades := ex.store.Trades()
+	if len(trades) == 0 {
+		t.Fatal("the burst made no trades")
+	}
+	traded := 0.0
+	fills := make(map[string]float64)
+	for _, trade := range trades {
+		traded += trade.Quantity
+		fills[trade.BuyOrderID] += trade.Quantity
+		fills[trade.SellOrderID] += trade.Quantity
+	}
+
+	book := ex.GetOrderBook("BTC-USD", 1000)
+	resting := func(levels []domain.OrderBookLevel) float64 {
+		total := 0.0
+		for _, level := range levels {
+			total += level.Quantity
+		}
+		return total
+	}
+	if got := traded + resting(book.Bids); math.Abs(got-bought) > 1e-6 {
+		t.Errorf("saved trades %.8f + resting bids %.8f = %.8f, but %.8f was bought", traded, resting(book.Bids), got, bought)
+	}
+	if got := traded + resting(book.Asks); math.Abs(got-sold) > 1e-6 {
+		t.Errorf("saved trades %.8f + resting asks %.8f = %.8f, but %.8f was sold", traded, resting(book.Asks), got, sold)
+	}
+
+	for id, filled := range fills {
+		saved, err := ex.store.GetOrderByID(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(saved.FilledQuantity-filled) > 1e-9 {
+			t.Errorf("order %s saved with %.8f filled, but its trades add up to %.8f", id, saved.FilledQuantity, filled)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+const (
+	// staleSweepInterval is how often the stale order sweeper runs
+	staleSweepInterval = time.Minute
+	// staleSweepSymbols bounds the books swept per run; the next run carries
+	// on from where the last one stopped
+	staleSweepSymbols = 4
+)
+
+// StaleOrderPolicy cancels GTC orders that have rested untouched for too
+// long. An order is touched when it is accepted, filled or triggered.
+// Verified users' orders are never swept.
+type StaleOrderPolicy struct {
+	// MaxAge is how long an order may go untouched; 0 disables the sweeper
+	MaxAge time.Duration
+}
+
+// VerifiedUserStore tells the stale order sweeper whose orders to leave
+// alone: verified users and the exchange's own accounts, such as the market
+// maker
+type VerifiedUserStore interface {
+	GetVerifiedUsers(ctx context.Context) ([]string, error)
+}
+
+// StaleOrderStats counts the sweeper's cancellations since startup
+type StaleOrderStats struct {
+	MaxAge string `json:"max_age"`
+	// Exempt is how many verified users the last sweep left alone
+	Exempt    int               `json:"exempt"`
+	Cancelled uint64            `json:"cancelled"`
+	BySymbol  map[string]uint64 `json:"by_symbol"`
+	LastSweep *time.Time        `json:"last_sweep,omitempty"`
+}
+
+// SetStaleOrderPolicy makes Start sweep stale orders every minute
+func (ex *Exchange) SetStaleOrderPolicy(policy StaleOrderPolicy) {
+	ex.staleMu.Lock()
+	defer ex.staleMu.Unlock()
+	ex.stalePolicy = policy
+}
+
+// SetVerifiedUserStore exempts the users it lists from the stale order
+// sweeper. It is read at the start of every sweep, so users verified later
+// are exempt from the next one. Without it, no one is exempt.
+func (ex *Exchange) SetVerifiedUserStore(store VerifiedUserStore) {
+	ex.staleMu.Lock()
+	defer ex.staleMu.Unlock()
+	ex.verifiedUserStore = store
+}
+
+// StaleOrderStats reports the stale order policy and what it has cancelled
+func (ex *Exchange) StaleOrderStats() StaleOrderStats {
+	ex.staleMu.Lock()
+	defer ex.staleMu.Unlock()
+
+	stats := StaleOrderStats{
+		MaxAge:   ex.stalePolicy.MaxAge.String(),
+		Exempt:   ex.staleExempt,
+		BySymbol: make(map[string]uint64, len(ex.staleCancelled)),
+	}
+	for symbol, count := range ex.staleCancelled {
+		stats.BySymbol[symbol] = count
+		stats.Cancelled += count
+	}
+	if !ex.lastStaleSweep.IsZero() {
+		last := ex.lastStaleSweep
+		stats.LastSweep = &last
+	}
+	return stats
+}
+
+// sweepStaleOrders cancels the stale orders of the next few books. Funds are
+// released as the cancellations are processed, and owners see them as order
+// updates with cancel reason STALE_CANCEL. If the verified users can't be
+// read, the sweep is skipped rather than risk cancelling theirs.
+func (ex *Exchange) sweepStaleOrders() {
+	// The primary sweeps; a standby gets the cancels replicated
+	if ex.checkWritable() != nil {
+		return
+	}
+	if err := ex.beginWrite(); err != nil {
+		return
+	}
+	defer ex.inflight.Done()
+
+	exempt, err := ex.verifiedUsers()
+	if err != nil {
+		log.Printf("Skipping stale order sweep, verified users unavailable: %v", err)
+		return
+	}
+
+	ex.staleMu.Lock()
+	maxAge := ex.stalePolicy.MaxAge
+	ex.staleExempt = len(exempt)
+	symbols := ex.nextStaleSymbols()
+	ex.staleMu.Unlock()
+
+	cutoff := ex.clock.Now().Add(-maxAge)
+	stale := func(order *domain.Order) bool {
+		return order.TimeInForce == "GTC" && order.UpdatedAt.Before(cutoff) && !exempt[order.UserID]
+	}
+	for _, symbol := range symbols {
+		// A recovering book has none of its orders loaded yet
+		if ex.checkReady(symbol) != nil {
+			continue
+		}
+		ex.mu.RLock()
+		engine, exists := ex.engines[symbol]
+		ex.mu.RUnlock()
+		if !exists {
+			continue
+		}
+
+		cancelled := engine.CancelWhere(stale, domain.CancelReasonStale)
+		if len(cancelled) > 0 {
+			log.Printf("Cancelled %d stale orders on %s untouched since %s", len(cancelled), symbol, cutoff.Format(time.RFC3339))
+			ex.staleMu.Lock()
+			ex.staleCancelled[symbol] += uint64(len(cancelled))
+			ex.staleMu.Unlock()
+		}
+	}
+
+	ex.staleMu.Lock()
+	ex.lastStaleSweep = ex.clock.Now()
+	ex.staleMu.Unlock()
+}
+
+// verifiedUsers reads the users whose orders the sweeper leaves alone
+func (ex *Exchange) verifiedUsers() (map[string]bool, error) {
+	ex.staleMu.Lock()
+	store := ex.verifiedUserStore
+	ex.staleMu.Unlock()
+	if store == nil {
+		return map[string]bool{}, nil
+	}
+
+	userIDs, err := store.GetVerifiedUsers(ex.ctx)
+	if err != nil {
+		return nil, err
+	}
+	verified := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		verified[userID] = true
+	}
+	return verified, nil
+}
+
+// nextStaleSymbols picks up to staleSweepSymbols books after the last one
+// swept, in symbol order. It must be called with staleMu held.
+func (ex *Exchange) nextStaleSymbols() []string {
+	symbols := ex.engineSymbols()
+	start := sort.SearchStrings(symbols, ex.staleCursor)
+	if start < len(symbols) && symbols[start] == ex.staleCursor {
+		start++
+	}
+
+	next := make([]string, 0, staleSweepSymbols)
+	for i := 0; i < len(symbols) && len(next) < staleSweepSymbols; i++ {
+		next = append(next, symbols[(start+i)%len(symbols)])
+	}
+	if len(next) > 0 {
+		ex.staleCursor = next[len(next)-1]
+	}
+	return next
+}
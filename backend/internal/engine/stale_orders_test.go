@@ -0,0 +1,177 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// noticeLog keeps every user notification the exchange sends
+type noticeLog struct {
+	mu      sync.Mutex
+	notices []*domain.Notification
+}
+
+func (l *noticeLog) add(notification *domain.Notification) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	copied := *notification
+	l.notices = append(l.notices, &copied)
+}
+
+// of returns the notices sent to userID
+func (l *noticeLog) of(userID string) []*domain.Notification {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	notices := make([]*domain.Notification, 0)
+	for _, notice := range l.notices {
+		if notice.UserID == userID {
+			notices = append(notices, notice)
+		}
+	}
+	return notices
+}
+
+// verifiedUsers is a VerifiedUserStore listing users, or failing with err
+type verifiedUsers struct {
+	mu    sync.Mutex
+	users []string
+	err   error
+}
+
+func (v *verifiedUsers) GetVerifiedUsers(context.Context) ([]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.users, v.err
+}
+
+func (v *verifiedUsers) fail(err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.err = err
+}
+
+// Once the clock moves past the policy's age, the sweeper cancels resting
+// GTC orders with STALE_CANCEL a few books at a time, releasing their funds
+// and sending each owner a notice for their activity feed, and leaves
+// verified users' orders alone. A sweep that can't tell who is verified
+// cancels nothing.
+func TestStaleOrderSweep(t *testing.T) {
+	const maxAge = 30 * 24 * time.Hour
+	clk := &steppedClock{}
+	notices := &noticeLog{}
+	verified := &verifiedUsers{users: []string{"verified"}}
+	symbols := []string{"BTC-USD", "AAA-USD", "BBB-USD", "CCC-USD", "DDD-USD", "EEE-USD"}
+	ex := newTestExchange(t, func(ex *engine.Exchange) {
+		ex.SetClock(clk)
+		ex.SetOnNotificationCallback(notices.add)
+		ex.SetStaleOrderPolicy(engine.StaleOrderPolicy{MaxAge: maxAge})
+		ex.SetVerifiedUserStore(verified)
+		for _, symbol := range symbols[1:] {
+			config := btcConfig()
+			config.Symbol, config.BaseAsset = symbol, symbol[:3]
+			if err := ex.AddSymbol(config); err != nil {
+				t.Fatal(err)
+			}
+			ex.UpdatePrice(symbol, referencePrice)
+		}
+	})
+	if len(symbols) <= engine.StaleSweepSymbols {
+		t.Fatalf("%d books don't take more than one sweep of %d", len(symbols), engine.StaleSweepSymbols)
+	}
+	ex.store.Deposit("abandoned", "USD", 100000)
+	ex.store.Deposit("verified", "USD", 100000)
+
+	abandoned := make(map[string]*domain.Order)
+	for _, symbol := range symbols {
+		order := domain.NewOrder("abandoned", symbol, domain.OrderSideBuy, domain.OrderTypeLimit, 0.01, referencePrice-1000)
+		if err := ex.SubmitOrder(context.Background(), order); err != nil {
+			t.Fatal(err)
+		}
+		ex.waitFor(t, order.ID, func(update *domain.Order) bool { return update.Status == domain.OrderStatusPending })
+		abandoned[order.ID] = order
+	}
+	quote := ex.rest(t, "verified", domain.OrderSideBuy, 0.01, referencePrice-1000)
+	locked := func(userID string) float64 {
+		t.Helper()
+		_, locked, err := ex.store.GetBalance(context.Background(), userID, "USD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return locked
+	}
+	quoteLocked := locked("verified")
+
+	// Nothing is stale yet
+	ex.SweepStaleOrders()
+	if stats := ex.StaleOrderStats(); stats.Cancelled != 0 {
+		t.Fatalf("%d orders cancelled before any aged: %+v", stats.Cancelled, stats)
+	}
+
+	clk.step(maxAge + time.Hour)
+	verified.fail(errors.New("database unavailable"))
+	ex.SweepStaleOrders()
+	if stats := ex.StaleOrderStats(); stats.Cancelled != 0 {
+		t.Fatalf("%d orders cancelled without knowing who is verified", stats.Cancelled)
+	}
+	verified.fail(nil)
+
+	ex.SweepStaleOrders()
+	if stats := ex.StaleOrderStats(); stats.Cancelled != engine.StaleSweepSymbols || len(stats.BySymbol) != engine.StaleSweepSymbols {
+		t.Fatalf("first aged sweep cancelled %d orders on %v, want one on each of %d books", stats.Cancelled, stats.BySymbol, engine.StaleSweepSymbols)
+	}
+	ex.SweepStaleOrders()
+	stats := ex.StaleOrderStats()
+	if stats.Cancelled != uint64(len(symbols)) || len(stats.BySymbol) != len(symbols) {
+		t.Fatalf("second sweep left %d orders cancelled on %v, want one on each of %d books", stats.Cancelled, stats.BySymbol, len(symbols))
+	}
+	if stats.Exempt != 1 {
+		t.Errorf("%d users exempt, want the verified one", stats.Exempt)
+	}
+	if stats.LastSweep == nil || stats.LastSweep.Before(time.Now().Add(maxAge)) {
+		t.Errorf("last sweep at %v, want by the exchange's clock", stats.LastSweep)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for cancelled := 0; cancelled < len(abandoned); {
+		select {
+		case update := <-ex.updates:
+			if abandoned[update.ID] == nil || update.Status != domain.OrderStatusCancelled {
+				continue
+			}
+			if update.CancelReason != domain.CancelReasonStale {
+				t.Errorf("order %s cancelled with reason %q, want %s", update.ID, update.CancelReason, domain.CancelReasonStale)
+			}
+			cancelled++
+		case <-timeout:
+			t.Fatalf("%d of %d abandoned orders reported cancelled", cancelled, len(abandoned))
+		}
+	}
+	ex.eventually(t, "the abandoned orders' funds to be released", func() bool { return locked("abandoned") == 0 })
+	if available, _, _ := ex.store.GetBalance(context.Background(), "abandoned", "USD"); available != 100000 {
+		t.Errorf("available USD after the sweep = %.8f, want 100000", available)
+	}
+
+	open, err := ex.GetOpenOrders("verified", "BTC-USD")
+	if err != nil || len(open.Orders) != 1 || open.Orders[0].ID != quote.ID {
+		t.Errorf("verified user's open orders = %+v, %v, want their quote still resting", open, err)
+	}
+	if got := locked("verified"); got != quoteLocked {
+		t.Errorf("verified user's locked USD = %.8f, want %.8f", got, quoteLocked)
+	}
+
+	ex.eventually(t, "a notice for each cancelled order", func() bool { return len(notices.of("abandoned")) == len(abandoned) })
+	for _, notice := range notices.of("abandoned") {
+		if abandoned[notice.OrderID] == nil || notice.Category != domain.CategoryOrder {
+			t.Errorf("notice %+v isn't for an abandoned order", notice)
+		}
+	}
+	if got := notices.of("verified"); len(got) != 0 {
+		t.Errorf("verified user was sent %+v", got)
+	}
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// SymbolState is where a symbol is in its trading lifecycle
+type SymbolState string
+
+const (
+	// SymbolRecovering symbols are rebuilding their book after a restart
+	SymbolRecovering SymbolState = "RECOVERING"
+	// SymbolTrading symbols accept orders
+	SymbolTrading SymbolState = "TRADING"
+	// SymbolPaused symbols reject new orders while the exchange is paused
+	SymbolPaused SymbolState = "PAUSED"
+	// SymbolHalted symbols were delisted; their engine only cancels
+	SymbolHalted SymbolState = "HALTED"
+)
+
+// tradingResumeCheckInterval is how often a scheduled resume is checked for
+const tradingResumeCheckInterval = time.Second
+
+// SymbolStatus is a symbol's state, why it is in it and since when. A
+// scheduled transition, like the end of a timed pause, is reported as
+// NextState at NextTransitionAt.
+type SymbolStatus struct {
+	Symbol string `json:"symbol"`
+	// Ready is whether the symbol's book has been recovered
+	Ready            bool        `json:"ready"`
+	State            SymbolState `json:"state"`
+	Reason           string      `json:"reason,omitempty"`
+	Since            time.Time   `json:"since"`
+	NextState        SymbolState `json:"next_state,omitempty"`
+	NextTransitionAt *time.Time  `json:"next_transition_at,omitempty"`
+}
+
+// SetOnSymbolStatusCallback sets the callback to be called when a symbol's
+// state changes
+func (ex *Exchange) SetOnSymbolStatusCallback(callback func(*SymbolStatus)) {
+	ex.onSymbolStatus = callback
+}
+
+// SymbolStatus reports a listed or delisted symbol's state
+func (ex *Exchange) SymbolStatus(symbol string) (SymbolStatus, error) {
+	ex.mu.RLock()
+	_, exists := ex.engines[symbol]
+	ex.mu.RUnlock()
+	if !exists {
+		return SymbolStatus{}, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+	}
+	return ex.observeSymbol(symbol), nil
+}
+
+// SymbolStatuses reports the state of every listed symbol
+func (ex *Exchange) SymbolStatuses() []SymbolStatus {
+	symbols := ex.GetAllSymbols()
+	statuses := make([]SymbolStatus, 0, len(symbols))
+	for _, symbol := range symbols {
+		statuses = append(statuses, ex.observeSymbol(symbol))
+	}
+	return statuses
+}
+
+// AllSymbolStatuses reports the state of every symbol with an engine,
+// delisted ones included
+func (ex *Exchange) AllSymbolStatuses() []SymbolStatus {
+	symbols := ex.engineSymbols()
+	statuses := make([]SymbolStatus, 0, len(symbols))
+	for _, symbol := range symbols {
+		statuses = append(statuses, ex.observeSymbol(symbol))
+	}
+	return statuses
+}
+
+// refreshSymbolStatuses records any state changes after something that can
+// move symbols between states, such as a pause or a recovery finishing
+func (ex *Exchange) refreshSymbolStatuses(symbols ...string) {
+	if len(symbols) == 0 {
+		symbols = ex.engineSymbols()
+	}
+	for _, symbol := range symbols {
+		ex.observeSymbol(symbol)
+	}
+}
+
+// observeSymbol derives a symbol's state from the exchange and its engine.
+// When it differs from the last one seen, the change is timestamped and
+// announced.
+func (ex *Exchange) observeSymbol(symbol string) SymbolStatus {
+	ex.mu.RLock()
+	_, listed := ex.symbols[symbol]
+	engine := ex.engines[symbol]
+	recovering := ex.recovering[symbol]
+	ex.mu.RUnlock()
+	trading := ex.TradingStatus()
+
+	status := SymbolStatus{Symbol: symbol, State: SymbolTrading}
+	var since time.Time
+	switch {
+	case !listed || (engine != nil && engine.Halted()):
+		status.State, status.Reason = SymbolHalted, "delisted"
+	case recovering:
+		status.State, status.Reason = SymbolRecovering, "rebuilding the order book"
+	case trading.Paused:
+		status.State, status.Reason, since = SymbolPaused, trading.Reason, trading.Since
+		if trading.ResumeAt != nil {
+			resumeAt := *trading.ResumeAt
+			status.NextState, status.NextTransitionAt = SymbolTrading, &resumeAt
+		}
+	}
+	// Ready keeps meaning the book is recovered, which readiness checks rely on
+	status.Ready = !recovering
+
+	ex.statusMu.Lock()
+	last, seen := ex.symbolStates[symbol]
+	changed := !seen || last.State != status.State || last.Reason != status.Reason
+	rescheduled := seen && !sameTime(last.NextTransitionAt, status.NextTransitionAt)
+	if changed {
+		if since.IsZero() {
+			since = ex.clock.Now()
+		}
+		status.Since = since
+	} else {
+		status.Since = last.Since
+	}
+	ex.symbolStates[symbol] = status
+	ex.statusMu.Unlock()
+
+	// The first sighting is the state the symbol started in, not a change
+	if seen && (changed || rescheduled) && ex.onSymbolStatus != nil {
+		announced := status
+		ex.onSymbolStatus(&announced)
+	}
+	return status
+}
+
+// resumeIfDue ends a timed pause once its resume time has passed. Standbys
+// leave it to the primary.
+func (ex *Exchange) resumeIfDue() {
+	status := ex.TradingStatus()
+	if !status.Paused || status.ResumeAt == nil || ex.clock.Now().Before(*status.ResumeAt) {
+		return
+	}
+	if ex.checkWritable() != nil {
+		return
+	}
+	if _, err := ex.ResumeTrading(ex.ctx); err != nil {
+		log.Printf("Scheduled resume failed: %v", err)
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// ErrInvalidOrder is returned for orders that break their symbol's trading
+// rules: tick and lot increments, minimum notional or the price band
+var ErrInvalidOrder = errors.New("invalid_order")
+
+// SymbolConfig returns the config a symbol was listed with
+func (ex *Exchange) SymbolConfig(symbol string) (domain.SymbolConfig, bool) {
+	ex.mu.RLock()
+	defer ex.mu.RUnlock()
+	config, ok := ex.symbols[symbol]
+	return config, ok
+}
+
+// SymbolConfigs returns every listed symbol's config, sorted by symbol
+func (ex *Exchange) SymbolConfigs() []domain.SymbolConfig {
+	ex.mu.RLock()
+	defer ex.mu.RUnlock()
+
+	configs := make([]domain.SymbolConfig, 0, len(ex.symbols))
+	for _, config := range ex.symbols {
+		configs = append(configs, config)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Symbol < configs[j].Symbol })
+	return configs
+}
+
+// symbolAssets returns a listed symbol's base and quote assets
+func (ex *Exchange) symbolAssets(symbol string) (base, quote string, err error) {
+	config, ok := ex.SymbolConfig(symbol)
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+	}
+	return config.BaseAsset, config.QuoteAsset, nil
+}
+
+// validateOrder checks an order against its symbol's trading rules
+func (ex *Exchange) validateOrder(order *domain.Order) error {
+	config, ok := ex.SymbolConfig(order.Symbol)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSymbol, order.Symbol)
+	}
+
+	if order.Quantity <= 0 || !config.IsQuantityStep(order.Quantity) {
+		return fmt.Errorf("%w: quantity %v is not a positive multiple of lot size %v", ErrInvalidOrder, order.Quantity, config.LotSize)
+	}
+
+	price := order.Price
+	if order.Type == domain.OrderTypeMarket {
+		price = ex.lastPrice(order.Symbol)
+	} else {
+		if price <= 0 || !config.IsPriceStep(price) {
+			return fmt.Errorf("%w: price %v is not a positive multiple of tick size %v", ErrInvalidOrder, price, config.TickSize)
+		}
+		if order.StopPrice != 0 && !config.IsPriceStep(order.StopPrice) {
+			return fmt.Errorf("%w: stop price %v is not a multiple of tick size %v", ErrInvalidOrder, order.StopPrice, config.TickSize)
+		}
+		if last := ex.lastPrice(order.Symbol); last > 0 && config.PriceBandPct > 0 {
+			if deviation := math.Abs(price-last) / last * 100; deviation > config.PriceBandPct {
+				return fmt.Errorf("%w: price %v is %.2f%% from last price %v (band %v%%)",
+					ErrInvalidOrder, price, deviation, last, config.PriceBandPct)
+			}
+		}
+	}
+
+	// A market order's notional is only known once a price has been seen
+	if price > 0 && price*order.Quantity < config.MinNotional {
+		return fmt.Errorf("%w: notional %v is below minimum %v", ErrInvalidOrder, price*order.Quantity, config.MinNotional)
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrTradingPaused is returned for new orders while the whole exchange is
+// paused for maintenance
+var ErrTradingPaused = errors.New("trading paused")
+
+// TradingStatus says whether the exchange accepts new orders
+type TradingStatus struct {
+	Paused bool   `json:"paused"`
+	Reason string `json:"reason,omitempty"`
+	// Since is when trading was last paused or resumed
+	Since time.Time `json:"since"`
+	// ResumeAt is when a timed pause ends by itself
+	ResumeAt *time.Time `json:"resume_at,omitempty"`
+}
+
+// TradingStatusStore persists the trading status so a restart during
+// maintenance stays paused
+type TradingStatusStore interface {
+	// GetTradingStatus returns nil if no status was ever saved
+	GetTradingStatus(ctx context.Context) (*TradingStatus, error)
+	SaveTradingStatus(ctx context.Context, status *TradingStatus) error
+}
+
+// SetTradingStatusStore restores the saved trading status and persists every
+// later change
+func (ex *Exchange) SetTradingStatusStore(store TradingStatusStore) error {
+	ex.tradingStatusStore = store
+	return ex.loadTradingStatus()
+}
+
+// SetOnTradingStatusCallback sets the callback to be called when trading is
+// paused or resumed
+func (ex *Exchange) SetOnTradingStatusCallback(callback func(*TradingStatus)) {
+	ex.onTradingStatus = callback
+}
+
+// TradingStatus returns whether new orders are currently accepted
+func (ex *Exchange) TradingStatus() TradingStatus {
+	ex.tradingMu.RLock()
+	defer ex.tradingMu.RUnlock()
+	return ex.tradingStatus
+}
+
+// TradingPaused reports whether new orders are currently rejected
+func (ex *Exchange) TradingPaused() bool {
+	return ex.TradingStatus().Paused
+}
+
+// PauseTrading rejects every new order with ErrTradingPaused until
+// ResumeTrading. Cancels, reads and resting orders are unaffected.
+func (ex *Exchange) PauseTrading(ctx context.Context, reason string) (TradingStatus, error) {
+	return ex.setTradingStatus(ctx, true, reason, nil)
+}
+
+// PauseTradingUntil pauses trading like PauseTrading and resumes it by itself
+// at resumeAt. A nil resumeAt pauses until ResumeTrading.
+func (ex *Exchange) PauseTradingUntil(ctx context.Context, reason string, resumeAt *time.Time) (TradingStatus, error) {
+	return ex.setTradingStatus(ctx, true, reason, resumeAt)
+}
+
+// ResumeTrading accepts new orders again after PauseTrading
+func (ex *Exchange) ResumeTrading(ctx context.Context) (TradingStatus, error) {
+	return ex.setTradingStatus(ctx, false, "", nil)
+}
+
+func (ex *Exchange) setTradingStatus(ctx context.Context, paused bool, reason string, resumeAt *time.Time) (TradingStatus, error) {
+	if err := ex.checkWritable(); err != nil {
+		return TradingStatus{}, err
+	}
+
+	ex.tradingMu.Lock()
+	if ex.tradingStatus.Paused == paused && ex.tradingStatus.Reason == reason &&
+		sameTime(ex.tradingStatus.ResumeAt, resumeAt) {
+		status := ex.tradingStatus
+		ex.tradingMu.Unlock()
+		return status, nil
+	}
+	status := TradingStatus{Paused: paused, Reason: reason, Since: ex.clock.Now(), ResumeAt: resumeAt}
+	// Saved first, so a crash can't resume trading the caller paused
+	if ex.tradingStatusStore != nil {
+		if err := ex.tradingStatusStore.SaveTradingStatus(ctx, &status); err != nil {
+			ex.tradingMu.Unlock()
+			return TradingStatus{}, fmt.Errorf("failed to save trading status: %w", err)
+		}
+	}
+	ex.tradingStatus = status
+	ex.tradingMu.Unlock()
+
+	switch {
+	case paused && resumeAt != nil:
+		log.Printf("⏸️ Trading paused until %s: %s", resumeAt.Format(time.RFC3339), reason)
+	case paused:
+		log.Printf("⏸️ Trading paused: %s", reason)
+	default:
+		log.Printf("▶️ Trading resumed")
+	}
+	ex.notifyTradingStatus(status)
+	ex.refreshSymbolStatuses()
+	ex.announceTradingStatus(status)
+	return status, nil
+}
+
+// loadTradingStatus reads the saved status, which another instance may have
+// changed while this one was a standby
+func (ex *Exchange) loadTradingStatus() error {
+	if ex.tradingStatusStore == nil {
+		return nil
+	}
+	saved, err := ex.tradingStatusStore.GetTradingStatus(ex.ctx)
+	if err != nil {
+		return err
+	}
+	if saved == nil {
+		return nil
+	}
+
+	ex.tradingMu.Lock()
+	changed := ex.tradingStatus.Paused != saved.Paused
+	ex.tradingStatus = *saved
+	ex.tradingMu.Unlock()
+
+	if saved.Paused {
+		log.Printf("⏸️ Trading is paused since %s: %s", saved.Since.Format(time.RFC3339), saved.Reason)
+	}
+	if changed {
+		ex.notifyTradingStatus(*saved)
+		ex.refreshSymbolStatuses()
+	}
+	return nil
+}
+
+// checkTradingOpen rejects new orders while trading is paused
+func (ex *Exchange) checkTradingOpen() error {
+	ex.tradingMu.RLock()
+	defer ex.tradingMu.RUnlock()
+	if ex.tradingStatus.Paused {
+		if ex.tradingStatus.Reason != "" {
+			return fmt.Errorf("%w: %s", ErrTradingPaused, ex.tradingStatus.Reason)
+		}
+		return ErrTradingPaused
+	}
+	return nil
+}
+
+func (ex *Exchange) notifyTradingStatus(status TradingStatus) {
+	if ex.onTradingStatus != nil {
+		ex.onTradingStatus(&status)
+	}
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrInvalidTransfer is returned for adjustments and transfers of an unknown
+// asset, a non-positive or non-finite amount, or between a user and
+// themselves
+var ErrInvalidTransfer = errors.New("invalid_transfer")
+
+// Causes reported with balance updates from funds moved outside trading
+const (
+	BalanceCauseAdjustment = "adjustment"
+	BalanceCauseTransfer   = "transfer"
+)
+
+// LedgerEntry records one change to a user's available balance made outside
+// trading
+type LedgerEntry struct {
+	ID     string  `json:"id"`
+	UserID string  `json:"user_id"`
+	Asset  string  `json:"asset"`
+	Delta  float64 `json:"delta"`
+	// Available is the balance right after the change
+	Available float64 `json:"available"`
+	Reason    string  `json:"reason"`
+	// Reference is shared by both legs of a transfer
+	Reference string    `json:"reference,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LedgerStore moves available funds outside trading, recording every change
+// in a ledger
+type LedgerStore interface {
+	// AdjustBalance adds delta to a user's available balance. It returns
+	// ErrInsufficientBalance rather than leave it negative.
+	AdjustBalance(ctx context.Context, userID, asset string, delta float64, reason string) (*LedgerEntry, error)
+	// Transfer debits one user and credits another atomically. It returns
+	// ErrInsufficientBalance if the sender can't cover amount.
+	Transfer(ctx context.Context, fromUser, toUser, asset string, amount float64, reason string) ([]*LedgerEntry, error)
+	// Fund deposits or withdraws amount, recording the movement. A
+	// withdrawal returns ErrInsufficientBalance if it exceeds the available
+	// balance and, with a positive dailyLimit, ErrWithdrawalLimit if it takes
+	// the day's withdrawals of the asset past it.
+	Fund(ctx context.Context, userID, asset, kind string, amount, dailyLimit float64) (*Funding, error)
+}
+
+// SetLedgerStore enables balance adjustments and transfers
+func (ex *Exchange) SetLedgerStore(store LedgerStore) {
+	ex.ledgerStore = store
+}
+
+// AdjustBalance credits (positive delta) or debits a user's available
+// balance, e.g. to top up a demo account. Locked funds are never touched, so
+// a debit can take at most the available balance.
+func (ex *Exchange) AdjustBalance(ctx context.Context, userID, asset string, delta float64, reason string) (*LedgerEntry, error) {
+	if err := ex.checkLedger(asset, math.Abs(delta)); err != nil {
+		return nil, err
+	}
+	if userID == "" {
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidTransfer)
+	}
+
+	entry, err := ex.ledgerStore.AdjustBalance(ctx, userID, asset, delta, reason)
+	if errors.Is(err, ErrInsufficientBalance) {
+		return nil, fmt.Errorf("%w: %s has less than %v %s available", ErrInsufficientBalance, userID, -delta, asset)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ex.notifyBalances(userID, BalanceCauseAdjustment, asset)
+	return entry, nil
+}
+
+// Transfer moves amount of an asset from one user's available balance to
+// another's. Either both legs land or neither does.
+func (ex *Exchange) Transfer(ctx context.Context, fromUser, toUser, asset string, amount float64, reason string) ([]*LedgerEntry, error) {
+	if err := ex.checkLedger(asset, amount); err != nil {
+		return nil, err
+	}
+	if fromUser == "" || toUser == "" {
+		return nil, fmt.Errorf("%w: from_user_id and to_user_id are required", ErrInvalidTransfer)
+	}
+	if fromUser == toUser {
+		return nil, fmt.Errorf("%w: cannot transfer from %s to themselves", ErrInvalidTransfer, fromUser)
+	}
+
+	entries, err := ex.ledgerStore.Transfer(ctx, fromUser, toUser, asset, amount, reason)
+	if errors.Is(err, ErrInsufficientBalance) {
+		return nil, fmt.Errorf("%w: %s has less than %v %s available", ErrInsufficientBalance, fromUser, amount, asset)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ex.notifyBalances(fromUser, BalanceCauseTransfer, asset)
+	ex.notifyBalances(toUser, BalanceCauseTransfer, asset)
+	return entries, nil
+}
+
+// checkLedger rejects a move of amount of asset that can't be made here
+func (ex *Exchange) checkLedger(asset string, amount float64) error {
+	if ex.ledgerStore == nil {
+		return errors.New("balance ledger is not configured")
+	}
+	if err := ex.checkWritable(); err != nil {
+		return err
+	}
+	if !ex.isListedAsset(asset) {
+		return fmt.Errorf("%w: %q is not an asset of any listed symbol", ErrInvalidTransfer, asset)
+	}
+	if amount <= 0 || math.IsInf(amount, 0) || math.IsNaN(amount) {
+		return fmt.Errorf("%w: amount must be a positive number", ErrInvalidTransfer)
+	}
+	return nil
+}
+
+// isListedAsset reports whether asset is the base or quote of a listed symbol
+func (ex *Exchange) isListedAsset(asset string) bool {
+	for _, config := range ex.SymbolConfigs() {
+		if config.BaseAsset == asset || config.QuoteAsset == asset {
+			return true
+		}
+	}
+	return false
+}
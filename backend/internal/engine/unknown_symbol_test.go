@@ -0,0 +1,70 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/apierror"
+	"github.com/hft-exchange/backend/internal/database"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/engine/enginetest"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+var databases atomic.Uint64
+
+// An order for a symbol that isn't listed is refused before anything is
+// saved, and a cancel on one is told apart from an unknown order
+func TestUnknownSymbolIsRefusedBeforeSaving(t *testing.T) {
+	db, err := database.NewDB(fmt.Sprintf("sqlite://file:engine-test-%d?mode=memory&cache=shared", databases.Add(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	store := enginetest.NewStore()
+	store.Deposit("trader", "USD", 100000)
+	ex := engine.NewExchange(store, repository.NewOrderRepository(db.DB), store)
+	if err := ex.AddSymbol(btcConfig()); err != nil {
+		t.Fatal(err)
+	}
+	ex.UpdatePrice("BTC-USD", referencePrice)
+	ex.Start()
+	t.Cleanup(ex.Stop)
+
+	order := domain.NewOrder("trader", "DOGE-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 100, 0.1)
+	err = ex.SubmitOrder(context.Background(), order)
+	if !errors.Is(err, engine.ErrUnknownSymbol) {
+		t.Fatalf("submitting to DOGE-USD: %v, want %v", err, engine.ErrUnknownSymbol)
+	}
+	if !strings.Contains(err.Error(), "DOGE-USD") {
+		t.Errorf("error %q doesn't name the symbol", err)
+	}
+	if apiErr := apierror.From(err); apiErr.Code != apierror.UnknownSymbol || apiErr.Status != 400 {
+		t.Errorf("reported as %s with status %d, want %s with 400", apiErr.Code, apiErr.Status, apierror.UnknownSymbol)
+	}
+	var rows int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM orders`).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 0 {
+		t.Errorf("%d orders saved, want none", rows)
+	}
+	if _, locked, _ := store.GetBalance(context.Background(), "trader", "USD"); locked != 0 {
+		t.Errorf("%g USD locked for a refused order", locked)
+	}
+
+	if err := ex.CancelOrder(context.Background(), order.ID, "DOGE-USD", "trader"); !errors.Is(err, engine.ErrUnknownSymbol) {
+		t.Errorf("cancelling on DOGE-USD: %v, want %v", err, engine.ErrUnknownSymbol)
+	}
+	if err := ex.CancelOrder(context.Background(), order.ID, "BTC-USD", "trader"); !errors.Is(err, engine.ErrOrderNotFound) {
+		t.Errorf("cancelling an unknown order: %v, want %v", err, engine.ErrOrderNotFound)
+	}
+}
@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"sort"
+	"time"
+	"unsafe"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// Per-order memory model. A resting order costs its struct, its identifier
+// strings, a slot in a heap and a balance reservation keyed by its ID, each
+// allocation rounded up to its size class. orderHeapOverhead covers the heap
+// slice's spare capacity and the bucket share of the heap's ID index and the
+// reservation map, and was fitted against runtime heap growth on books of
+// 10k-100k orders (within 3% of measured, checked by a test).
+const orderHeapOverhead = 90
+
+var orderFixedBytes = allocBytes(int(unsafe.Sizeof(domain.Order{}))) + allocBytes(int(unsafe.Sizeof(reservation{})))
+
+// sizeClasses are the runtime's small object size classes up to 512 bytes
+var sizeClasses = []int{8, 16, 24, 32, 48, 64, 80, 96, 112, 128, 144, 160, 176, 192, 208, 224, 240, 256, 288, 320, 352, 384, 416, 448, 480, 512}
+
+// allocBytes is the heap taken by an allocation of n bytes. Past the
+// listed classes it rounds to 128 bytes, close enough for identifiers.
+func allocBytes(n int) int64 {
+	if n == 0 {
+		return 0
+	}
+	for _, class := range sizeClasses {
+		if n <= class {
+			return int64(class)
+		}
+	}
+	return int64((n + 127) / 128 * 128)
+}
+
+// persistLagSamples is how many recent trade writes the lag percentile is
+// taken over
+const persistLagSamples = 256
+
+// EstimateOrderBytes is the modelled memory a resting order holds
+func EstimateOrderBytes(order *domain.Order) int64 {
+	// Enum fields point at constants; only the identifiers are allocated
+	strings := allocBytes(len(order.ID)) + allocBytes(len(order.UserID)) + allocBytes(len(order.Symbol))
+	return orderFixedBytes + strings + orderHeapOverhead
+}
+
+// SymbolUsage is one symbol's footprint on the engine
+type SymbolUsage struct {
+	Symbol        string `json:"symbol"`
+	RestingOrders int    `json:"resting_orders"`
+	MemoryBytes   int64  `json:"memory_bytes"`
+	// OrderEventsPerHour counts order updates emitted in the last hour
+	OrderEventsPerHour uint64 `json:"order_events_per_hour"`
+	// PersistLagP95 is the 95th percentile delay between a trade executing
+	// and its row being written, over recent trades
+	PersistLagP95 time.Duration `json:"-"`
+}
+
+// symbolUsage collects the activity counters behind SymbolUsage
+type symbolUsage struct {
+	orderEvents minuteCounter
+	persistLag  [persistLagSamples]time.Duration
+	lagCount    int
+}
+
+// minuteCounter counts events over a sliding hour in one-minute buckets
+type minuteCounter struct {
+	counts  [60]uint64
+	minutes [60]int64
+}
+
+func (c *minuteCounter) add(now time.Time) {
+	minute := now.Unix() / 60
+	slot := minute % 60
+	if c.minutes[slot] != minute {
+		c.minutes[slot] = minute
+		c.counts[slot] = 0
+	}
+	c.counts[slot]++
+}
+
+func (c *minuteCounter) lastHour(now time.Time) uint64 {
+	minute := now.Unix() / 60
+	var total uint64
+	for i, m := range c.minutes {
+		if m > minute-60 {
+			total += c.counts[i]
+		}
+	}
+	return total
+}
+
+func (ex *Exchange) symbolUsage(symbol string) *symbolUsage {
+	usage, ok := ex.usage[symbol]
+	if !ok {
+		usage = &symbolUsage{}
+		ex.usage[symbol] = usage
+	}
+	return usage
+}
+
+func (ex *Exchange) recordOrderEvent(symbol string) {
+	ex.usageMu.Lock()
+	ex.symbolUsage(symbol).orderEvents.add(ex.clock.Now())
+	ex.usageMu.Unlock()
+}
+
+func (ex *Exchange) recordPersistLag(symbol string, lag time.Duration) {
+	ex.usageMu.Lock()
+	usage := ex.symbolUsage(symbol)
+	usage.persistLag[usage.lagCount%persistLagSamples] = lag
+	usage.lagCount++
+	ex.usageMu.Unlock()
+}
+
+// RestingUsage counts the orders resting on the book, including untriggered
+// stop orders, and their modelled memory
+func (me *MatchingEngine) RestingUsage() (int, int64) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	count := 0
+	var bytes int64
+	for _, orders := range [][]*domain.Order{me.buyOrders.orders, me.sellOrders.orders, me.stopLimitOrders} {
+		for _, order := range orders {
+			count++
+			bytes += EstimateOrderBytes(order)
+		}
+	}
+	return count, bytes
+}
+
+// SymbolUsage reports every symbol's resting orders, memory and recent
+// activity, by symbol
+func (ex *Exchange) SymbolUsage() []SymbolUsage {
+	ex.mu.RLock()
+	engines := make(map[string]*MatchingEngine, len(ex.engines))
+	for symbol, engine := range ex.engines {
+		engines[symbol] = engine
+	}
+	ex.mu.RUnlock()
+
+	now := ex.clock.Now()
+	usages := make([]SymbolUsage, 0, len(engines))
+	for symbol, engine := range engines {
+		usage := SymbolUsage{Symbol: symbol}
+		usage.RestingOrders, usage.MemoryBytes = engine.RestingUsage()
+
+		ex.usageMu.Lock()
+		if counters, ok := ex.usage[symbol]; ok {
+			usage.OrderEventsPerHour = counters.orderEvents.lastHour(now)
+			usage.PersistLagP95 = counters.lagP95()
+		}
+		ex.usageMu.Unlock()
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Symbol < usages[j].Symbol })
+	return usages
+}
+
+func (u *symbolUsage) lagP95() time.Duration {
+	n := u.lagCount
+	if n > persistLagSamples {
+		n = persistLagSamples
+	}
+	if n == 0 {
+		return 0
+	}
+	lags := make([]time.Duration, n)
+	copy(lags, u.persistLag[:n])
+	sort.Slice(lags, func(i, j int) bool { return lags[i] < lags[j] })
+	return lags[(n*95-1)/100]
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// heapInUse is the live heap after a full collection
+func heapInUse() int64 {
+	runtime.GC()
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapAlloc)
+}
+
+// The memory the capacity report models for resting orders stays within 5%
+// of what restoring a book and its reservations actually adds to the heap
+func TestRestingOrderMemoryModel(t *testing.T) {
+	for _, n := range []int{10000, 50000, 100000} {
+		me := NewMatchingEngine("BTC-USD")
+		reservations := make(map[string]*reservation)
+		before := heapInUse()
+
+		// Like orders read back from the database, each owns its strings
+		orders := make([]*domain.Order, n)
+		for i := range orders {
+			side, price := domain.OrderSideBuy, 44000+float64(i%500)
+			if i%2 == 1 {
+				side, price = domain.OrderSideSell, 46000+float64(i%500)
+			}
+			order := domain.NewOrder(fmt.Sprintf("user-%d", i), strings.Clone("BTC-USD"), side, domain.OrderTypeLimit, 0.01, price)
+			orders[i] = order
+			reservations[order.ID] = &reservation{userID: order.UserID, symbol: order.Symbol, asset: "USD", amount: 450}
+		}
+		me.RestoreOrders(orders)
+		orders = nil
+
+		measured := heapInUse() - before
+		resting, modelled := me.RestingUsage()
+		runtime.KeepAlive(reservations)
+		if resting != n {
+			t.Fatalf("%d orders resting, want %d", resting, n)
+		}
+		if ratio := float64(modelled) / float64(measured); ratio < 0.95 || ratio > 1.05 {
+			t.Errorf("%d orders: modelled %d bytes, measured %d (ratio %.3f)", n, modelled, measured, ratio)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// ErrUserDisabled is returned for new orders from a user an admin disabled
+var ErrUserDisabled = errors.New("user disabled")
+
+// DisabledUserStore persists which users may not place orders, so they stay
+// disabled across restarts
+type DisabledUserStore interface {
+	GetDisabledUsers(ctx context.Context) ([]string, error)
+	// SetUserDisabled fails for users that don't exist
+	SetUserDisabled(ctx context.Context, userID string, disabled bool, reason string, at time.Time) error
+}
+
+// SetDisabledUserStore loads the disabled users and persists later changes
+func (ex *Exchange) SetDisabledUserStore(store DisabledUserStore) error {
+	ex.disabledMu.Lock()
+	ex.disabledUserStore = store
+	ex.disabledMu.Unlock()
+	return ex.loadDisabledUsers()
+}
+
+// loadDisabledUsers reads the saved set, which another instance may have
+// changed while this one was a standby
+func (ex *Exchange) loadDisabledUsers() error {
+	ex.disabledMu.RLock()
+	store := ex.disabledUserStore
+	ex.disabledMu.RUnlock()
+	if store == nil {
+		return nil
+	}
+	userIDs, err := store.GetDisabledUsers(ex.ctx)
+	if err != nil {
+		return err
+	}
+
+	disabled := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		disabled[userID] = true
+	}
+	ex.disabledMu.Lock()
+	ex.disabledUsers = disabled
+	ex.disabledMu.Unlock()
+	return nil
+}
+
+// DisableUser rejects userID's new orders with ErrUserDisabled until
+// EnableUser. With cancelOrders, their resting orders are cancelled too and
+// how many is returned; otherwise they keep trading until they fill.
+func (ex *Exchange) DisableUser(ctx context.Context, userID, reason string, cancelOrders bool) (int, error) {
+	if err := ex.setUserDisabled(ctx, userID, true, reason); err != nil {
+		return 0, err
+	}
+	log.Printf("🚫 User %s disabled: %s", userID, reason)
+	if !cancelOrders {
+		return 0, nil
+	}
+	return ex.cancelAll(userID, "", domain.CancelReasonAdmin)
+}
+
+// EnableUser lets a disabled user place orders again
+func (ex *Exchange) EnableUser(ctx context.Context, userID string) error {
+	if err := ex.setUserDisabled(ctx, userID, false, ""); err != nil {
+		return err
+	}
+	log.Printf("User %s enabled", userID)
+	return nil
+}
+
+// UserDisabled reports whether userID's new orders are rejected
+func (ex *Exchange) UserDisabled(userID string) bool {
+	ex.disabledMu.RLock()
+	defer ex.disabledMu.RUnlock()
+	return ex.disabledUsers[userID]
+}
+
+func (ex *Exchange) setUserDisabled(ctx context.Context, userID string, disabled bool, reason string) error {
+	if err := ex.checkWritable(); err != nil {
+		return err
+	}
+
+	ex.disabledMu.Lock()
+	defer ex.disabledMu.Unlock()
+	// Saved first, so a crash can't re-enable a user the caller disabled
+	if ex.disabledUserStore != nil {
+		if err := ex.disabledUserStore.SetUserDisabled(ctx, userID, disabled, reason, ex.clock.Now()); err != nil {
+			return err
+		}
+	}
+	if disabled {
+		ex.disabledUsers[userID] = true
+	} else {
+		delete(ex.disabledUsers, userID)
+	}
+	return nil
+}
+
+// checkUserEnabled rejects new orders from disabled users
+func (ex *Exchange) checkUserEnabled(userID string) error {
+	if ex.UserDisabled(userID) {
+		return fmt.Errorf("%w: %s may not place orders", ErrUserDisabled, userID)
+	}
+	return nil
+}
+
+// OpenOrderSummary counts a user's open orders, in total and per symbol
+type OpenOrderSummary struct {
+	Total    int            `json:"total"`
+	BySymbol map[string]int `json:"by_symbol,omitempty"`
+}
+
+// OpenOrderSummary counts userID's open orders as the open-orders index
+// holds them. Symbols still recovering aren't counted yet.
+func (ex *Exchange) OpenOrderSummary(userID string) OpenOrderSummary {
+	orders := ex.openOrders.forUser(userID, "")
+	summary := OpenOrderSummary{Total: len(orders)}
+	if len(orders) > 0 {
+		summary.BySymbol = make(map[string]int)
+		for _, order := range orders {
+			summary.BySymbol[order.Symbol]++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,87 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// An order filled down to float residue leaves the book entirely: cancelling
+// it finds nothing, and an order replacing it at the same price rests with
+// only its own quantity and lock. Readers polling the book meanwhile never
+// see an empty level.
+func TestFilledOrderLeavesNoPhantomQuantity(t *testing.T) {
+	ex := newTestExchange(t)
+	ex.store.Deposit("maker", "BTC", 10)
+	ex.store.Deposit("taker", "USD", 100000)
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				book := ex.GetOrderBook("BTC-USD", 10)
+				for _, level := range append(book.Bids, book.Asks...) {
+					if level.Quantity <= 0 {
+						t.Errorf("level at %g shows %g", level.Price, level.Quantity)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	// 0.1 and 0.2 don't add up to 0.3 in floating point, so the last fill
+	// leaves residue behind that must not rest
+	maker := ex.rest(t, "maker", domain.OrderSideSell, 0.3, referencePrice)
+	for _, quantity := range []float64{0.1, 0.2} {
+		buy := ex.submit(t, "taker", domain.OrderSideBuy, domain.OrderTypeLimit, quantity, referencePrice)
+		ex.waitFor(t, buy.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+	}
+	filled := ex.waitFor(t, maker.ID, func(order *domain.Order) bool { return order.Status == domain.OrderStatusFilled })
+	if filled.RemainingQty != 0 {
+		t.Errorf("maker's remaining quantity = %g, want exactly 0", filled.RemainingQty)
+	}
+
+	stats, err := ex.EngineStats("BTC-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RestingSells != 0 || stats.BestAsk != nil {
+		t.Errorf("%d sells rest with the best ask at %v after the maker filled", stats.RestingSells, stats.BestAsk)
+	}
+	err = ex.CancelOrder(context.Background(), maker.ID, maker.Symbol, maker.UserID)
+	if !errors.Is(err, engine.ErrOrderNotFound) {
+		t.Errorf("cancelling the filled maker: err = %v, want ErrOrderNotFound", err)
+	}
+
+	// Replacing it, as an amend would, adds only the new quantity
+	replacement := ex.rest(t, "maker", domain.OrderSideSell, 0.5, referencePrice)
+	book := ex.GetOrderBook("BTC-USD", 10)
+	if len(book.Asks) != 1 || book.Asks[0].Quantity != 0.5 {
+		t.Errorf("asks = %+v, want 0.5 at %g", book.Asks, referencePrice)
+	}
+	ex.eventually(t, "the maker's lock to be the replacement's", func() bool {
+		_, locked, _ := ex.store.GetBalance(context.Background(), "maker", "BTC")
+		return math.Abs(locked-0.5) < 1e-9
+	})
+	ex.cancel(t, replacement)
+	if book := ex.GetOrderBook("BTC-USD", 10); len(book.Asks) != 0 {
+		t.Errorf("asks = %+v after cancelling the replacement, want none", book.Asks)
+	}
+
+	close(stop)
+	readers.Wait()
+}
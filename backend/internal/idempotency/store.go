@@ -0,0 +1,153 @@
+// Package idempotency remembers the responses to requests sent with an
+// Idempotency-Key, so a retried request gets the first one's response
+// instead of being carried out again.
+package idempotency
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/cache"
+)
+
+// DefaultTTL is how long a key is remembered
+const DefaultTTL = 24 * time.Hour
+
+// Record is what is remembered about a key: a fingerprint of the request
+// that claimed it and, once that request has finished, its response
+type Record struct {
+	Fingerprint string `json:"fingerprint"`
+	// Pending is set while the first request is still being handled
+	Pending bool   `json:"pending"`
+	Status  int    `json:"status"`
+	Body    []byte `json:"body"`
+}
+
+// Store holds records by key
+type Store interface {
+	// Claim records a pending request under key. If the key is already
+	// held it returns the record held and false.
+	Claim(key, fingerprint string) (*Record, bool, error)
+	// Complete stores the response to the request that claimed key
+	Complete(key string, record *Record) error
+	// Release frees key, e.g. after a failure the client should retry
+	Release(key string) error
+}
+
+// RedisStore keeps records in Redis, shared by every server
+type RedisStore struct {
+	redis *cache.RedisCache
+	ttl   time.Duration
+}
+
+// NewRedisStore remembers keys in Redis for ttl
+func NewRedisStore(redis *cache.RedisCache, ttl time.Duration) *RedisStore {
+	return &RedisStore{redis: redis, ttl: ttl}
+}
+
+func (s *RedisStore) Claim(key, fingerprint string) (*Record, bool, error) {
+	data, err := json.Marshal(&Record{Fingerprint: fingerprint, Pending: true})
+	if err != nil {
+		return nil, false, err
+	}
+	held, claimed, err := s.redis.ClaimIdempotencyKey(key, data, s.ttl)
+	if err != nil || claimed {
+		return nil, claimed, err
+	}
+	record := &Record{}
+	if err := json.Unmarshal(held, record); err != nil {
+		return nil, false, fmt.Errorf("failed to decode idempotency record: %w", err)
+	}
+	return record, false, nil
+}
+
+func (s *RedisStore) Complete(key string, record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.redis.SetIdempotencyKey(key, data, s.ttl)
+}
+
+func (s *RedisStore) Release(key string) error {
+	return s.redis.DeleteIdempotencyKey(key)
+}
+
+// MemoryStore keeps records in this process, evicting the least recently
+// used once it holds capacity keys
+type MemoryStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // most recently used first
+}
+
+type memoryEntry struct {
+	key     string
+	record  Record
+	expires time.Time
+}
+
+// NewMemoryStore remembers up to capacity keys for ttl
+func NewMemoryStore(capacity int, ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:      ttl,
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (s *MemoryStore) Claim(key, fingerprint string) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		if time.Now().Before(entry.expires) {
+			s.order.MoveToFront(element)
+			record := entry.record
+			return &record, false, nil
+		}
+		s.remove(element)
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryEntry{
+		key:     key,
+		record:  Record{Fingerprint: fingerprint, Pending: true},
+		expires: time.Now().Add(s.ttl),
+	})
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+	return nil, true, nil
+}
+
+func (s *MemoryStore) Complete(key string, record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		element.Value.(*memoryEntry).record = *record
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		s.remove(element)
+	}
+	return nil
+}
+
+func (s *MemoryStore) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,444 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/clock"
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// Kinds of events a user can be notified about
+const (
+	EventFill          = "fill"
+	EventSystemCancel  = "system_cancel"
+	EventAccountFreeze = "account_freeze"
+)
+
+var eventKinds = map[string]bool{EventFill: true, EventSystemCancel: true, EventAccountFreeze: true}
+
+// ErrInvalidSettings is returned for notification settings that can't be used
+var ErrInvalidSettings = errors.New("invalid notification settings")
+
+const (
+	// tickInterval is how often due digests and retries are sent
+	tickInterval = 10 * time.Second
+	// Failed deliveries are retried with exponential backoff, then given up
+	retryBackoffMin = 30 * time.Second
+	maxAttempts     = 5
+	// logLimit is how many deliveries are kept per user
+	logLimit = 100
+	// queueSize bounds events waiting to be dispatched
+	queueSize = 1024
+	// ActivityKept is how many of a user's own notifications are kept as
+	// their activity feed
+	ActivityKept = 100
+)
+
+// Delivery statuses shown in a user's notification log
+const (
+	StatusSent     = "sent"
+	StatusRetrying = "retrying"
+	StatusFailed   = "failed"
+)
+
+// Settings are a user's notification preferences. Users without settings
+// get no notifications.
+type Settings struct {
+	UserID  string   `json:"user_id"`
+	Sink    string   `json:"sink"`
+	Address string   `json:"address,omitempty"`
+	Events  []string `json:"events"`
+	// DigestMinutes batches fills into at most one message per this many
+	// minutes; 0 sends each fill as it happens
+	DigestMinutes int `json:"digest_minutes"`
+}
+
+func (s *Settings) wants(kind string) bool {
+	for _, event := range s.Events {
+		if event == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// SettingsStore persists notification settings
+type SettingsStore interface {
+	GetSettings(ctx context.Context, userID string) (*Settings, error)
+	SaveSettings(ctx context.Context, settings *Settings) error
+}
+
+// ActivityStore keeps each user's own notifications as their activity feed
+type ActivityStore interface {
+	// SaveActivity stores a user's notification and forgets all but their
+	// newest keep
+	SaveActivity(ctx context.Context, notification *domain.Notification, keep int) error
+	// GetActivity returns up to limit of a user's notifications, newest first
+	GetActivity(ctx context.Context, userID string, limit int) ([]*domain.Notification, error)
+}
+
+// Event is something that happened to a user's account
+type Event struct {
+	UserID  string
+	Kind    string
+	Subject string
+	Body    string
+}
+
+// LogEntry is one delivery attempt series in a user's notification log
+type LogEntry struct {
+	ID          int        `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Sink        string     `json:"sink"`
+	Subject     string     `json:"subject"`
+	Events      int        `json:"events"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+}
+
+type delivery struct {
+	userID string
+	sink   string
+	msg    Message
+	entry  *LogEntry
+}
+
+type digest struct {
+	settings Settings
+	events   []Event
+	flushAt  time.Time
+}
+
+// Dispatcher delivers account events to users through their chosen sink.
+// Events are queued and sent in the background so publishers never wait on
+// a mail server.
+type Dispatcher struct {
+	sinks    map[string]Sink
+	settings SettingsStore
+	clock    clock.Clock
+	events   chan Event
+	activity ActivityStore
+	// notices are user notifications waiting to be kept in their activity
+	// feed
+	notices chan *domain.Notification
+
+	mu      sync.Mutex
+	digests map[string]*digest
+	retries []*delivery
+	logs    map[string][]*LogEntry
+	nextID  int
+
+	runMu  sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewDispatcher(settings SettingsStore) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		sinks:    make(map[string]Sink),
+		settings: settings,
+		clock:    clock.Real{},
+		events:   make(chan Event, queueSize),
+		notices:  make(chan *domain.Notification, queueSize),
+		digests:  make(map[string]*digest),
+		logs:     make(map[string][]*LogEntry),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// AddSink makes a sink available to users under name. Sinks are added
+// before Start.
+func (d *Dispatcher) AddSink(name string, sink Sink) {
+	d.sinks[name] = sink
+}
+
+// SetActivityStore keeps the notifications passed to RecordActivity as
+// their users' activity feeds. It is set before Start.
+func (d *Dispatcher) SetActivityStore(store ActivityStore) {
+	d.activity = store
+}
+
+// Sinks lists the available sink names
+func (d *Dispatcher) Sinks() []string {
+	names := make([]string, 0, len(d.sinks))
+	for name := range d.sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start begins dispatching queued events
+func (d *Dispatcher) Start() {
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	ctx := d.ctx
+	go d.run(ctx)
+	d.clock.Every(ctx, tickInterval, d.tick)
+	log.Println("Notification dispatcher started")
+}
+
+// Stop pauses dispatching; queued events wait for Start
+func (d *Dispatcher) Stop() {
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	d.cancel()
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+}
+
+// Notify queues an event. When the queue is full the event is dropped
+// rather than blocking the caller.
+func (d *Dispatcher) Notify(event Event) {
+	select {
+	case d.events <- event:
+	default:
+		log.Printf("Notification queue full, dropping %s event for %s", event.Kind, event.UserID)
+	}
+}
+
+// RecordActivity queues a user's notification to be kept in their activity
+// feed, so a slow database never holds up the caller. When the queue is full
+// the notification is dropped.
+func (d *Dispatcher) RecordActivity(notification *domain.Notification) {
+	if d.activity == nil {
+		return
+	}
+	select {
+	case d.notices <- notification:
+	default:
+		log.Printf("Activity queue full, dropping notification %s for %s", notification.ID, notification.UserID)
+	}
+}
+
+// Activity returns up to limit of a user's latest notifications, newest
+// first
+func (d *Dispatcher) Activity(ctx context.Context, userID string, limit int) ([]*domain.Notification, error) {
+	if d.activity == nil {
+		return []*domain.Notification{}, nil
+	}
+	return d.activity.GetActivity(ctx, userID, limit)
+}
+
+// NotifyOrderUpdate turns an order update into a fill or system cancel
+// event for its owner
+func (d *Dispatcher) NotifyOrderUpdate(order *domain.Order) {
+	precision := domain.SymbolPrecision(order.Symbol)
+	switch {
+	case order.Status == domain.OrderStatusFilled || order.Status == domain.OrderStatusPartial:
+		state := "filled"
+		if order.Status == domain.OrderStatusPartial {
+			state = "partially filled"
+		}
+		d.Notify(Event{
+			UserID:  order.UserID,
+			Kind:    EventFill,
+			Subject: fmt.Sprintf("%s %s order %s", order.Symbol, strings.ToLower(string(order.Side)), state),
+			Body: fmt.Sprintf("Order %s: %s of %s filled, %s remaining.",
+				order.ID,
+				formatQuantity(order.FilledQuantity, precision),
+				formatQuantity(order.Quantity, precision),
+				formatQuantity(order.RemainingQty, precision)),
+		})
+	case order.Status == domain.OrderStatusCancelled && order.CancelReason != "":
+		d.Notify(Event{
+			UserID:  order.UserID,
+			Kind:    EventSystemCancel,
+			Subject: fmt.Sprintf("%s order cancelled by the exchange", order.Symbol),
+			Body: fmt.Sprintf("Order %s was cancelled (%s) with %s unfilled.",
+				order.ID, order.CancelReason, formatQuantity(order.RemainingQty, precision)),
+		})
+	}
+}
+
+func formatQuantity(quantity float64, precision domain.Precision) string {
+	return strconv.FormatFloat(quantity, 'f', precision.Quantity, 64)
+}
+
+// UpdateSettings validates and stores a user's settings
+func (d *Dispatcher) UpdateSettings(ctx context.Context, settings *Settings) error {
+	if _, ok := d.sinks[settings.Sink]; !ok {
+		return fmt.Errorf("%w: unknown sink %q, available: %s", ErrInvalidSettings, settings.Sink, strings.Join(d.Sinks(), ", "))
+	}
+	if settings.Sink == "email" && settings.Address == "" {
+		return fmt.Errorf("%w: email requires an address", ErrInvalidSettings)
+	}
+	for _, event := range settings.Events {
+		if !eventKinds[event] {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidSettings, event)
+		}
+	}
+	if settings.DigestMinutes < 0 {
+		return fmt.Errorf("%w: digest_minutes must not be negative", ErrInvalidSettings)
+	}
+	return d.settings.SaveSettings(ctx, settings)
+}
+
+// GetSettings returns a user's settings, or nil if they have none
+func (d *Dispatcher) GetSettings(ctx context.Context, userID string) (*Settings, error) {
+	return d.settings.GetSettings(ctx, userID)
+}
+
+// Log returns a user's recent deliveries, newest first
+func (d *Dispatcher) Log(userID string) []LogEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entries := d.logs[userID]
+	out := make([]LogEntry, len(entries))
+	for i, entry := range entries {
+		out[len(entries)-1-i] = *entry
+	}
+	return out
+}
+
+func (d *Dispatcher) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-d.events:
+			d.dispatch(ctx, event)
+		case notification := <-d.notices:
+			if err := d.activity.SaveActivity(ctx, notification, ActivityKept); err != nil {
+				log.Printf("Failed to save activity %s for %s: %v", notification.ID, notification.UserID, err)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, event Event) {
+	settings, err := d.settings.GetSettings(ctx, event.UserID)
+	if err != nil {
+		log.Printf("Failed to load notification settings for %s: %v", event.UserID, err)
+		return
+	}
+	if settings == nil || !settings.wants(event.Kind) {
+		return
+	}
+
+	if event.Kind == EventFill && settings.DigestMinutes > 0 {
+		d.mu.Lock()
+		pending, ok := d.digests[event.UserID]
+		if !ok {
+			pending = &digest{flushAt: d.clock.Now().Add(time.Duration(settings.DigestMinutes) * time.Minute)}
+			d.digests[event.UserID] = pending
+		}
+		pending.settings = *settings
+		pending.events = append(pending.events, event)
+		d.mu.Unlock()
+		return
+	}
+
+	d.deliver(event.UserID, settings, Message{To: settings.Address, Subject: event.Subject, Body: event.Body}, 1)
+}
+
+// tick sends digests whose window closed and retries due deliveries
+func (d *Dispatcher) tick() {
+	now := d.clock.Now()
+
+	d.mu.Lock()
+	due := make([]*digest, 0)
+	users := make([]string, 0)
+	for userID, pending := range d.digests {
+		if !now.Before(pending.flushAt) {
+			due = append(due, pending)
+			users = append(users, userID)
+			delete(d.digests, userID)
+		}
+	}
+	retries := make([]*delivery, 0)
+	kept := d.retries[:0]
+	for _, retry := range d.retries {
+		if retry.entry.NextAttempt != nil && now.Before(*retry.entry.NextAttempt) {
+			kept = append(kept, retry)
+		} else {
+			retries = append(retries, retry)
+		}
+	}
+	d.retries = kept
+	d.mu.Unlock()
+
+	for i, pending := range due {
+		lines := make([]string, len(pending.events))
+		for j, event := range pending.events {
+			lines[j] = event.Subject + ": " + event.Body
+		}
+		msg := Message{
+			To:      pending.settings.Address,
+			Subject: fmt.Sprintf("%d fills in the last %d minutes", len(pending.events), pending.settings.DigestMinutes),
+			Body:    strings.Join(lines, "\n"),
+		}
+		d.deliver(users[i], &pending.settings, msg, len(pending.events))
+	}
+
+	for _, retry := range retries {
+		d.attempt(retry)
+	}
+}
+
+func (d *Dispatcher) deliver(userID string, settings *Settings, msg Message, events int) {
+	d.mu.Lock()
+	d.nextID++
+	entry := &LogEntry{
+		ID:        d.nextID,
+		CreatedAt: d.clock.Now(),
+		Sink:      settings.Sink,
+		Subject:   msg.Subject,
+		Events:    events,
+	}
+	entries := append(d.logs[userID], entry)
+	if len(entries) > logLimit {
+		entries = entries[len(entries)-logLimit:]
+	}
+	d.logs[userID] = entries
+	d.mu.Unlock()
+
+	d.attempt(&delivery{userID: userID, sink: settings.Sink, msg: msg, entry: entry})
+}
+
+// attempt sends a delivery once, scheduling a retry if it fails
+func (d *Dispatcher) attempt(delivery *delivery) {
+	var err error
+	if sink, ok := d.sinks[delivery.sink]; ok {
+		err = sink.Send(delivery.msg)
+	} else {
+		err = fmt.Errorf("sink %q is not configured", delivery.sink)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry := delivery.entry
+	entry.Attempts++
+	if err == nil {
+		entry.Status = StatusSent
+		entry.LastError = ""
+		entry.NextAttempt = nil
+		return
+	}
+
+	entry.LastError = err.Error()
+	if entry.Attempts >= maxAttempts {
+		entry.Status = StatusFailed
+		entry.NextAttempt = nil
+		log.Printf("Giving up on notification %d for %s: %v", entry.ID, delivery.userID, err)
+		return
+	}
+	entry.Status = StatusRetrying
+	next := d.clock.Now().Add(retryBackoffMin << (entry.Attempts - 1))
+	entry.NextAttempt = &next
+	d.retries = append(d.retries, delivery)
+}
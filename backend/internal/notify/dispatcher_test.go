@@ -0,0 +1,310 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/clock"
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// mail is a message as the fake SMTP server received it
+type mail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is a fake relay speaking just enough SMTP for net/smtp. While
+// reject is above zero it refuses that many messages after their data.
+type smtpServer struct {
+	addr     net.Addr
+	received chan mail
+	mu       sync.Mutex
+	reject   int
+}
+
+func fakeSMTP(t *testing.T) *smtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &smtpServer{addr: listener.Addr(), received: make(chan mail, 16)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 fake ESMTP")
+	var current mail
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case verb == "EHLO" || verb == "HELO":
+			reply("250 fake")
+		case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+			current = mail{from: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			reply("250 OK")
+		case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+			current.to = append(current.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case verb == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			current.data = data.String()
+
+			s.mu.Lock()
+			rejected := s.reject > 0
+			if rejected {
+				s.reject--
+			}
+			s.mu.Unlock()
+			if rejected {
+				reply("451 try again later")
+				continue
+			}
+			s.received <- current
+			reply("250 queued")
+		case verb == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// next returns the next message the relay accepted
+func (s *smtpServer) next(t *testing.T) mail {
+	t.Helper()
+	select {
+	case m := <-s.received:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message reached the SMTP server")
+		return mail{}
+	}
+}
+
+func (s *smtpServer) none(t *testing.T) {
+	t.Helper()
+	select {
+	case m := <-s.received:
+		t.Fatalf("unexpected message %+v", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// memorySettings keeps notification settings in a map
+type memorySettings struct {
+	mu       sync.Mutex
+	settings map[string]*Settings
+}
+
+func (m *memorySettings) GetSettings(_ context.Context, userID string) (*Settings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.settings[userID], nil
+}
+
+func (m *memorySettings) SaveSettings(_ context.Context, settings *Settings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *settings
+	m.settings[settings.UserID] = &copied
+	return nil
+}
+
+// Fills reach the relay as e-mail to the user's address, a refused message
+// is retried after its backoff, and a digest batches fills into one message
+func TestEmailThroughSMTPServer(t *testing.T) {
+	server := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(server.addr.String())
+	clk := clock.NewVirtual(time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC))
+	d := NewDispatcher(&memorySettings{settings: make(map[string]*Settings)})
+	d.clock = clk
+	d.AddSink("email", NewSMTPSink(SMTPConfig{Host: host, Port: port, From: "exchange@example.com"}))
+	d.Start()
+	t.Cleanup(d.Stop)
+
+	ctx := context.Background()
+	for _, settings := range []*Settings{
+		{UserID: "trader", Sink: "email", Address: "trader@example.com", Events: []string{EventFill}},
+		{UserID: "digest", Sink: "email", Address: "digest@example.com", Events: []string{EventFill}, DigestMinutes: 5},
+	} {
+		if err := d.UpdateSettings(ctx, settings); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fill := func(userID string) *domain.Order {
+		order := domain.NewOrder(userID, "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 0.5, 45000)
+		order.Status = domain.OrderStatusFilled
+		order.FilledQuantity, order.RemainingQty = 0.5, 0
+		return order
+	}
+
+	order := fill("trader")
+	d.NotifyOrderUpdate(order)
+	got := server.next(t)
+	if got.from != "exchange@example.com" || len(got.to) != 1 || got.to[0] != "trader@example.com" {
+		t.Fatalf("envelope from %q to %v, want exchange@example.com to trader@example.com", got.from, got.to)
+	}
+	for _, want := range []string{"To: trader@example.com\r\n", "Subject: BTC-USD buy order filled\r\n", "Order " + order.ID + ": 0.50000000 of 0.50000000 filled"} {
+		if !strings.Contains(got.data, want) {
+			t.Errorf("message doesn't contain %q:\n%s", want, got.data)
+		}
+	}
+
+	// Users without settings get nothing
+	d.NotifyOrderUpdate(fill("nobody"))
+	server.none(t)
+
+	server.mu.Lock()
+	server.reject = 1
+	server.mu.Unlock()
+	d.NotifyOrderUpdate(fill("trader"))
+	var entry LogEntry
+	waitUntil(t, "the refused delivery to be logged", func() bool {
+		entries := d.Log("trader")
+		if len(entries) != 2 {
+			return false
+		}
+		entry = entries[0]
+		return entry.Status == StatusRetrying
+	})
+	if !strings.Contains(entry.LastError, "451") {
+		t.Errorf("last error %q, want the relay's 451", entry.LastError)
+	}
+	clk.Advance(retryBackoffMin)
+	server.next(t)
+	if entries := d.Log("trader"); entries[0].Status != StatusSent || entries[0].Attempts != 2 {
+		t.Errorf("after the retry the delivery is %+v, want sent on attempt 2", entries[0])
+	}
+
+	d.NotifyOrderUpdate(fill("digest"))
+	d.NotifyOrderUpdate(fill("digest"))
+	waitUntil(t, "both fills to be queued for the digest", func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.digests["digest"] != nil && len(d.digests["digest"].events) == 2
+	})
+	server.none(t)
+	clk.Advance(5 * time.Minute)
+	got = server.next(t)
+	if got.to[0] != "digest@example.com" || !strings.Contains(got.data, "Subject: 2 fills in the last 5 minutes\r\n") {
+		t.Errorf("digest to %v:\n%s", got.to, got.data)
+	}
+	server.none(t)
+}
+
+func waitUntil(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// slowActivity is an ActivityStore that waits for release before saving
+type slowActivity struct {
+	release chan struct{}
+	mu      sync.Mutex
+	saved   []*domain.Notification
+}
+
+func (s *slowActivity) SaveActivity(ctx context.Context, notification *domain.Notification, _ int) error {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, notification)
+	return nil
+}
+
+func (s *slowActivity) GetActivity(_ context.Context, userID string, limit int) ([]*domain.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity := make([]*domain.Notification, 0)
+	for i := len(s.saved) - 1; i >= 0 && len(activity) < limit; i-- {
+		if s.saved[i].UserID == userID {
+			activity = append(activity, s.saved[i])
+		}
+	}
+	return activity, nil
+}
+
+// Recording activity returns at once while the store is stuck, and the
+// notices are kept once it catches up
+func TestRecordActivityDoesNotWaitOnTheStore(t *testing.T) {
+	store := &slowActivity{release: make(chan struct{})}
+	d := NewDispatcher(&memorySettings{settings: make(map[string]*Settings)})
+	d.SetActivityStore(store)
+	d.Start()
+	t.Cleanup(d.Stop)
+
+	recorded := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			d.RecordActivity(&domain.Notification{ID: strconv.Itoa(i), UserID: "user-1", Category: domain.CategoryOrder})
+		}
+		close(recorded)
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(time.Second):
+		t.Fatal("RecordActivity waited on the store")
+	}
+
+	close(store.release)
+	waitUntil(t, "the notices to be kept", func() bool {
+		activity, _ := d.Activity(context.Background(), "user-1", ActivityKept)
+		return len(activity) == 3
+	})
+	activity, _ := d.Activity(context.Background(), "user-1", ActivityKept)
+	if activity[0].ID != "2" || activity[2].ID != "0" {
+		t.Errorf("activity = %v, %v, %v, want newest first", activity[0].ID, activity[1].ID, activity[2].ID)
+	}
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is one notification addressed to a user
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sink delivers messages over one channel
+type Sink interface {
+	Send(msg Message) error
+}
+
+// ConsoleSink writes messages to the server log, for development
+type ConsoleSink struct{}
+
+func (ConsoleSink) Send(msg Message) error {
+	log.Printf("📧 To %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileSink appends messages to a file
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+func (s *FileSink) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open notification file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().UTC().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// SMTPConfig is how the SMTP sink reaches its relay
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPSink sends messages as plain-text e-mail
+type SMTPSink struct {
+	config SMTPConfig
+	// send is smtp.SendMail, replaceable so delivery can be faked
+	send func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewSMTPSink(config SMTPConfig) *SMTPSink {
+	return &SMTPSink{config: config, send: smtp.SendMail}
+}
+
+// SetSendFunc replaces the function that talks to the relay
+func (s *SMTPSink) SetSendFunc(send func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error) {
+	s.send = send
+}
+
+func (s *SMTPSink) Send(msg Message) error {
+	if msg.To == "" {
+		return fmt.Errorf("no e-mail address to send to")
+	}
+
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+	}
+
+	headers := []string{
+		"From: " + s.config.From,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	body := strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(msg.Body, "\n", "\r\n")
+	addr := s.config.Host + ":" + s.config.Port
+	if err := s.send(addr, auth, s.config.From, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("smtp delivery failed: %w", err)
+	}
+	return nil
+}
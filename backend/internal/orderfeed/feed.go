@@ -0,0 +1,150 @@
+package orderfeed
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// ErrTooManyWaiters is returned when a user already has MaxWaiters polls
+// pending
+var ErrTooManyWaiters = errors.New("too many pending polls for this user")
+
+const (
+	// historySize is how many recent changes are kept per user for cursors
+	// to resume from
+	historySize = 256
+	// MaxWaiters bounds the polls one user may have pending at once
+	MaxWaiters = 4
+)
+
+// Changes is a user's order changes after a cursor
+type Changes struct {
+	Orders []*domain.Order `json:"orders"`
+	// Cursor is the sequence to resume from on the next poll
+	Cursor uint64 `json:"cursor"`
+	// Resync is set when changes after the requested cursor are no longer
+	// held, or the cursor is from before a restart. Reload open orders and
+	// continue from Cursor.
+	Resync bool `json:"resync"`
+}
+
+type userFeed struct {
+	seq     uint64
+	history []*domain.Order
+	changed chan struct{} // closed and replaced on every change
+	waiters int
+}
+
+// Feed numbers each user's order changes with a per-user sequence and lets
+// pollers wait for changes past a cursor
+type Feed struct {
+	mu    sync.Mutex
+	users map[string]*userFeed
+}
+
+func NewFeed() *Feed {
+	return &Feed{users: make(map[string]*userFeed)}
+}
+
+func (f *Feed) user(userID string) *userFeed {
+	user, ok := f.users[userID]
+	if !ok {
+		user = &userFeed{changed: make(chan struct{})}
+		f.users[userID] = user
+	}
+	return user
+}
+
+// Publish assigns an order change the owner's next sequence, stamping it on
+// order as UserSeq, and wakes the owner's pollers. Call it before the change
+// is sent anywhere else so every transport carries the same sequence.
+func (f *Feed) Publish(order *domain.Order) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user := f.user(order.UserID)
+	user.seq++
+	order.UserSeq = user.seq
+
+	change := *order
+	user.history = append(user.history, &change)
+	if len(user.history) > historySize {
+		user.history = user.history[len(user.history)-historySize:]
+	}
+
+	close(user.changed)
+	user.changed = make(chan struct{})
+}
+
+// Wait returns a user's changes after since straight away if there are any,
+// otherwise once one happens or timeout elapses, with no orders in the
+// latter case. It returns ctx's error if ctx ends first.
+func (f *Feed) Wait(ctx context.Context, userID string, since uint64, timeout time.Duration) (*Changes, error) {
+	f.mu.Lock()
+	user := f.user(userID)
+	if changes := user.since(since); changes != nil || timeout <= 0 {
+		f.mu.Unlock()
+		return orEmpty(changes, user.seq), nil
+	}
+	if user.waiters >= MaxWaiters {
+		f.mu.Unlock()
+		return nil, ErrTooManyWaiters
+	}
+	user.waiters++
+	changed := user.changed
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		user.waiters--
+		f.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-changed:
+	case <-timer.C:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return orEmpty(user.since(since), user.seq), nil
+}
+
+// since returns the changes after a cursor, or nil if there are none yet.
+// It must be called with the feed lock held.
+func (u *userFeed) since(cursor uint64) *Changes {
+	if cursor > u.seq {
+		return &Changes{Orders: make([]*domain.Order, 0), Cursor: u.seq, Resync: true}
+	}
+	if cursor == u.seq {
+		return nil
+	}
+
+	changes := &Changes{Orders: make([]*domain.Order, 0), Cursor: u.seq}
+	// The oldest change held must directly follow the cursor
+	if len(u.history) == 0 || u.history[0].UserSeq > cursor+1 {
+		changes.Resync = true
+	}
+	for _, order := range u.history {
+		if order.UserSeq > cursor {
+			copied := *order
+			changes.Orders = append(changes.Orders, &copied)
+		}
+	}
+	return changes
+}
+
+func orEmpty(changes *Changes, cursor uint64) *Changes {
+	if changes == nil {
+		return &Changes{Orders: make([]*domain.Order, 0), Cursor: cursor}
+	}
+	return changes
+}
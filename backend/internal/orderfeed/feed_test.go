@@ -0,0 +1,143 @@
+package orderfeed
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// waitForWaiters waits until n polls of userID are blocked
+func waitForWaiters(t *testing.T, f *Feed, userID string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		waiters := f.user(userID).waiters
+		f.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d polls pending for %s, want %d", waiters, userID, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type result struct {
+	changes *Changes
+	err     error
+}
+
+func poll(f *Feed, ctx context.Context, userID string, since uint64, timeout time.Duration) <-chan result {
+	done := make(chan result, 1)
+	go func() {
+		changes, err := f.Wait(ctx, userID, since, timeout)
+		done <- result{changes, err}
+	}()
+	return done
+}
+
+func receive(t *testing.T, done <-chan result) result {
+	t.Helper()
+	select {
+	case r := <-done:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("poll never returned")
+		return result{}
+	}
+}
+
+// A blocked poll returns as soon as one of its user's orders changes, with
+// the change and the cursor to continue from
+func TestWaitWakesOnChange(t *testing.T) {
+	f := NewFeed()
+	done := poll(f, context.Background(), "alice", 0, time.Minute)
+	waitForWaiters(t, f, "alice", 1)
+
+	order := domain.NewOrder("alice", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 1, 45000)
+	f.Publish(order)
+	r := receive(t, done)
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if len(r.changes.Orders) != 1 || r.changes.Orders[0].ID != order.ID || r.changes.Orders[0].UserSeq != 1 || r.changes.Cursor != 1 {
+		t.Fatalf("changes = %+v, want the order at sequence 1", r.changes)
+	}
+	if order.UserSeq != 1 {
+		t.Errorf("published order carries user_seq %d, want 1", order.UserSeq)
+	}
+
+	// Changes already past the cursor are returned without waiting
+	f.Publish(order)
+	changes, err := f.Wait(context.Background(), "alice", 1, time.Minute)
+	if err != nil || len(changes.Orders) != 1 || changes.Cursor != 2 {
+		t.Errorf("poll behind the feed = %+v, %v, want the change at sequence 2", changes, err)
+	}
+}
+
+// A poll with nothing to report returns no orders and the same cursor once
+// its timeout elapses, and other users' changes don't wake it
+func TestWaitTimesOut(t *testing.T) {
+	f := NewFeed()
+	f.Publish(domain.NewOrder("alice", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 1, 45000))
+
+	const timeout = 100 * time.Millisecond
+	started := time.Now()
+	done := poll(f, context.Background(), "alice", 1, timeout)
+	waitForWaiters(t, f, "alice", 1)
+	f.Publish(domain.NewOrder("bob", "BTC-USD", domain.OrderSideSell, domain.OrderTypeLimit, 1, 46000))
+
+	r := receive(t, done)
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if elapsed := time.Since(started); elapsed < timeout {
+		t.Errorf("poll returned after %s, before its %s timeout", elapsed, timeout)
+	}
+	if len(r.changes.Orders) != 0 || r.changes.Cursor != 1 || r.changes.Resync {
+		t.Errorf("timed out poll = %+v, want no orders at cursor 1", r.changes)
+	}
+	waitForWaiters(t, f, "alice", 0)
+}
+
+// One change wakes every pending poll of its user. Past MaxWaiters further
+// polls are refused, and a slot frees up when a poll returns or is
+// cancelled.
+func TestMultipleWaiters(t *testing.T) {
+	f := NewFeed()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	polls := make([]<-chan result, MaxWaiters)
+	for i := range polls {
+		polls[i] = poll(f, context.Background(), "alice", 0, time.Minute)
+	}
+	waitForWaiters(t, f, "alice", MaxWaiters)
+	if _, err := f.Wait(ctx, "alice", 0, time.Minute); !errors.Is(err, ErrTooManyWaiters) {
+		t.Fatalf("poll past the limit: err = %v, want ErrTooManyWaiters", err)
+	}
+	// The limit is per user
+	other := poll(f, ctx, "bob", 0, time.Minute)
+	waitForWaiters(t, f, "bob", 1)
+
+	order := domain.NewOrder("alice", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 1, 45000)
+	f.Publish(order)
+	for i, done := range polls {
+		r := receive(t, done)
+		if r.err != nil || len(r.changes.Orders) != 1 || r.changes.Orders[0].ID != order.ID {
+			t.Errorf("poll %d = %+v, %v, want the published order", i, r.changes, r.err)
+		}
+	}
+	waitForWaiters(t, f, "alice", 0)
+
+	cancel()
+	if r := receive(t, other); !errors.Is(r.err, context.Canceled) {
+		t.Errorf("cancelled poll: err = %v, want context.Canceled", r.err)
+	}
+	waitForWaiters(t, f, "bob", 0)
+}
@@ -5,12 +5,17 @@ import (
 	"log"
 	"math"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/hft-exchange/backend/internal/clock"
 	"github.com/hft-exchange/backend/internal/domain"
 )
 
+// priceUpdateInterval is how often each symbol's price moves
+const priceUpdateInterval = 3 * time.Second // Slower updates for demo (was 100ms)
+
 type PriceUpdateHandler func(symbol string, price float64)
 
 type PriceSimulator struct {
@@ -20,92 +25,150 @@ type PriceSimulator struct {
 	tickerRepo       TickerRepository
 	ctx              context.Context
 	cancel           context.CancelFunc
+	clock            clock.Clock
+	rng              *rand.Rand
+	rngMu            sync.Mutex
+	// feeds stops each symbol's updates; nil until the simulator starts
+	feeds            map[string]context.CancelFunc
+	started          bool
 }
 
 type TickerRepository interface {
-	GetTicker(symbol string) (*domain.Ticker, error)
-	UpdateTicker(ticker *domain.Ticker) error
+	GetTicker(ctx context.Context, symbol string) (*domain.Ticker, error)
+	UpdateTicker(ctx context.Context, ticker *domain.Ticker) error
 }
 
 func NewPriceSimulator(tickerRepo TickerRepository) *PriceSimulator {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &PriceSimulator{
 		prices:         make(map[string]float64),
+		feeds:          make(map[string]context.CancelFunc),
 		updateHandlers: make([]PriceUpdateHandler, 0),
 		tickerRepo:     tickerRepo,
 		ctx:            ctx,
 		cancel:         cancel,
+		clock:          clock.Real{},
+		rng:            rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// SetClock replaces the wall clock driving price updates. It must be called
+// before Start.
+func (ps *PriceSimulator) SetClock(c clock.Clock) {
+	ps.clock = c
+}
+
+// SetSeed makes the generated price path reproducible
+func (ps *PriceSimulator) SetSeed(seed int64) {
+	ps.rngMu.Lock()
+	ps.rng = rand.New(rand.NewSource(seed))
+	ps.rngMu.Unlock()
+}
+
+// Start begins moving the price of every symbol added so far; symbols added
+// later start moving right away
 func (ps *PriceSimulator) Start() {
-	symbols := []string{"BTC-USD", "ETH-USD", "SOL-USD", "USDC-USD"}
-	
-	// Initialize prices from database
-	for _, symbol := range symbols {
-		ticker, err := ps.tickerRepo.GetTicker(symbol)
-		if err == nil {
-			ps.mu.Lock()
-			ps.prices[symbol] = ticker.Price
-			ps.mu.Unlock()
-		}
+	ps.mu.Lock()
+	ps.started = true
+	// Feeds start in symbol order so simulated runs replay identically
+	symbols := make([]string, 0, len(ps.feeds))
+	for symbol := range ps.feeds {
+		symbols = append(symbols, symbol)
 	}
-	
-	// Start price simulation for each symbol
+	sort.Strings(symbols)
 	for _, symbol := range symbols {
-		go ps.simulatePrice(symbol)
+		ps.startFeed(symbol)
 	}
+	ps.mu.Unlock()
 	
 	log.Println("Price simulator started")
 }
 
-func (ps *PriceSimulator) simulatePrice(symbol string) {
-	ticker := time.NewTicker(3 * time.Second) // Slower updates for demo (was 100ms)
-	defer ticker.Stop()
-	
+// AddSymbol adds a symbol to the feed. Its price resumes from the stored
+// ticker, or starts at initialPrice when there is none.
+func (ps *PriceSimulator) AddSymbol(symbol string, initialPrice float64) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, exists := ps.feeds[symbol]; exists {
+		return
+	}
+
+	ps.prices[symbol] = initialPrice
+	if ticker, err := ps.tickerRepo.GetTicker(ps.ctx, symbol); err == nil && ticker.Price > 0 {
+		ps.prices[symbol] = ticker.Price
+	}
+	ps.feeds[symbol] = nil
+	if ps.started {
+		ps.startFeed(symbol)
+	}
+}
+
+// RemoveSymbol stops a symbol's price updates
+func (ps *PriceSimulator) RemoveSymbol(symbol string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if stop := ps.feeds[symbol]; stop != nil {
+		stop()
+	}
+	delete(ps.feeds, symbol)
+	delete(ps.prices, symbol)
+}
+
+// startFeed must be called with ps.mu held
+func (ps *PriceSimulator) startFeed(symbol string) {
+	ctx, cancel := context.WithCancel(ps.ctx)
+	ps.feeds[symbol] = cancel
+	ps.clock.Every(ctx, priceUpdateInterval, func() { ps.simulatePrice(ctx, symbol) })
+}
+
+func (ps *PriceSimulator) simulatePrice(ctx context.Context, symbol string) {
 	// Different volatility for different assets
 	volatility := ps.getVolatility(symbol)
 	
-	for {
-		select {
-		case <-ps.ctx.Done():
-			return
-		case <-ticker.C:
-			ps.mu.Lock()
-			currentPrice := ps.prices[symbol]
-			
-			// Geometric Brownian Motion for realistic price movement
-			dt := 0.1 / 3600 // 100ms in hours
-			drift := 0.0     // No drift for stable simulation
-			
-			randomShock := rand.NormFloat64()
-			priceChange := currentPrice * (drift*dt + volatility*math.Sqrt(dt)*randomShock)
-			newPrice := currentPrice + priceChange
-			
-			// Ensure price doesn't go negative or too extreme
-			if newPrice < currentPrice*0.95 {
-				newPrice = currentPrice * 0.95
-			}
-			if newPrice > currentPrice*1.05 {
-				newPrice = currentPrice * 1.05
-			}
-			
-			// Special case for stablecoins
-			if symbol == "USDC-USD" {
-				newPrice = 1.0 + (rand.Float64()-0.5)*0.001 // Very small fluctuation
-			}
-			
-			ps.prices[symbol] = newPrice
-			ps.mu.Unlock()
-			
-			// Update database FIRST (synchronously) before notifying handlers
-			ps.updateTickerInDB(symbol, newPrice)
-			
-			// Notify handlers AFTER DB is updated
-			for _, handler := range ps.updateHandlers {
-				go handler(symbol, newPrice)
-			}
-		}
+	ps.mu.Lock()
+	currentPrice, listed := ps.prices[symbol]
+	if !listed {
+		ps.mu.Unlock()
+		return
+	}
+	
+	// Geometric Brownian Motion for realistic price movement
+	dt := 0.1 / 3600 // 100ms in hours
+	drift := 0.0     // No drift for stable simulation
+	
+	ps.rngMu.Lock()
+	randomShock := ps.rng.NormFloat64()
+	stableNoise := ps.rng.Float64()
+	ps.rngMu.Unlock()
+	
+	priceChange := currentPrice * (drift*dt + volatility*math.Sqrt(dt)*randomShock)
+	newPrice := currentPrice + priceChange
+	
+	// Ensure price doesn't go negative or too extreme
+	if newPrice < currentPrice*0.95 {
+		newPrice = currentPrice * 0.95
+	}
+	if newPrice > currentPrice*1.05 {
+		newPrice = currentPrice * 1.05
+	}
+	
+	// Special case for stablecoins
+	if symbol == "USDC-USD" {
+		newPrice = 1.0 + (stableNoise-0.5)*0.001 // Very small fluctuation
+	}
+	
+	ps.prices[symbol] = newPrice
+	ps.mu.Unlock()
+	
+	// Update database FIRST (synchronously) before notifying handlers
+	ps.updateTickerInDB(ctx, symbol, newPrice)
+	
+	// Notify handlers AFTER DB is updated
+	for _, handler := range ps.updateHandlers {
+		handler := handler
+		ps.clock.Go(func() { handler(symbol, newPrice) })
 	}
 }
 
@@ -124,39 +187,18 @@ func (ps *PriceSimulator) getVolatility(symbol string) float64 {
 	}
 }
 
-func (ps *PriceSimulator) updateTickerInDB(symbol string, price float64) {
-	ticker, err := ps.tickerRepo.GetTicker(symbol)
+func (ps *PriceSimulator) updateTickerInDB(ctx context.Context, symbol string, price float64) {
+	ticker, err := ps.tickerRepo.GetTicker(ctx, symbol)
 	if err != nil {
 		log.Printf("Failed to get ticker %s: %v", symbol, err)
 		return
 	}
 	
-	// Store old price for change calculation
-	oldPrice := ticker.Price
+	// The 24h range and change are kept by the ticker stats tracker
 	ticker.Price = price
-	ticker.UpdatedAt = time.Now()
-	
-	// Update 24h high/low
-	if price > ticker.High24h || ticker.High24h == 0 {
-		ticker.High24h = price
-	}
-	if price < ticker.Low24h || ticker.Low24h == 0 {
-		ticker.Low24h = price
-	}
-	
-	// Calculate 24h change percentage
-	// For demo: use the midpoint of 24h range as baseline
-	if ticker.High24h > 0 && ticker.Low24h > 0 {
-		baseline := (ticker.High24h + ticker.Low24h) / 2
-		if baseline > 0 {
-			ticker.Change24h = ((price - baseline) / baseline) * 100
-		}
-	} else if oldPrice > 0 {
-		// Fallback: use price change from last update
-		ticker.Change24h = ((price - oldPrice) / oldPrice) * 100
-	}
+	ticker.UpdatedAt = ps.clock.Now()
 	
-	if err := ps.tickerRepo.UpdateTicker(ticker); err != nil {
+	if err := ps.tickerRepo.UpdateTicker(ctx, ticker); err != nil {
 		log.Printf("Failed to update ticker %s: %v", symbol, err)
 	}
 }
@@ -171,6 +213,15 @@ func (ps *PriceSimulator) AddUpdateHandler(handler PriceUpdateHandler) {
 	ps.updateHandlers = append(ps.updateHandlers, handler)
 }
 
+// Stop halts every feed. Start resumes them from their last prices.
 func (ps *PriceSimulator) Stop() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
 	ps.cancel()
+	ps.ctx, ps.cancel = context.WithCancel(context.Background())
+	ps.started = false
+	for symbol := range ps.feeds {
+		ps.feeds[symbol] = nil
+	}
 }
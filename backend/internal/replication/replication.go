@@ -0,0 +1,243 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/cache"
+	"github.com/hft-exchange/backend/internal/engine"
+)
+
+// Leadership holds the epoch this instance claimed. Every write checks it
+// against the shared epoch so a demoted primary stops accepting traffic the
+// moment a standby is promoted.
+type Leadership struct {
+	cache *cache.RedisCache
+	epoch atomic.Int64
+}
+
+func NewLeadership(redisCache *cache.RedisCache) *Leadership {
+	return &Leadership{cache: redisCache}
+}
+
+// Acquire claims leadership by bumping the shared epoch
+func (l *Leadership) Acquire() (int64, error) {
+	epoch, err := l.cache.IncrLeaderEpoch()
+	if err != nil {
+		return 0, err
+	}
+	l.epoch.Store(epoch)
+	log.Printf("👑 Acquired leadership at epoch %d", epoch)
+	return epoch, nil
+}
+
+// Epoch returns the epoch this instance holds, or 0 if it never led
+func (l *Leadership) Epoch() int64 {
+	return l.epoch.Load()
+}
+
+// Check fails with engine.ErrFenced if another instance has claimed a newer epoch
+func (l *Leadership) Check() error {
+	current, err := l.cache.LeaderEpoch()
+	if err != nil {
+		return fmt.Errorf("failed to verify leadership: %w", err)
+	}
+	if current != l.epoch.Load() {
+		return engine.ErrFenced
+	}
+	return nil
+}
+
+// Publisher appends a primary's events to the replication stream
+type Publisher struct {
+	cache      *cache.RedisCache
+	leadership *Leadership
+}
+
+func NewPublisher(redisCache *cache.RedisCache, leadership *Leadership) *Publisher {
+	return &Publisher{cache: redisCache, leadership: leadership}
+}
+
+func (p *Publisher) Replicate(event *engine.ReplicationEvent) error {
+	event.Epoch = p.leadership.Epoch()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal replication event: %w", err)
+	}
+	return p.cache.AppendReplicationEvent(data)
+}
+
+// Status describes an instance's replication role and progress
+type Status struct {
+	Role       string    `json:"role"`
+	Epoch      int64     `json:"epoch"`
+	AppliedSeq uint64    `json:"applied_seq"`
+	StreamID   string    `json:"stream_id"`
+	LastEvent  time.Time `json:"last_event,omitempty"`
+	PromotedAt time.Time `json:"promoted_at,omitempty"`
+}
+
+// Standby follows the replication stream, applying each event to a passive
+// exchange until it is promoted
+type Standby struct {
+	cache      *cache.RedisCache
+	exchange   *engine.Exchange
+	leadership *Leadership
+	mu         sync.Mutex
+	lastID     string
+	lastEvent  time.Time
+	promotedAt time.Time
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func NewStandby(redisCache *cache.RedisCache, exchange *engine.Exchange, leadership *Leadership) *Standby {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Standby{
+		cache:      redisCache,
+		exchange:   exchange,
+		leadership: leadership,
+		lastID:     "0",
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+}
+
+func (s *Standby) Start() {
+	s.exchange.SetStandby(true)
+	go s.follow()
+	log.Println("Standby replication started")
+}
+
+func (s *Standby) follow() {
+	defer close(s.done)
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		default:
+		}
+
+		if err := s.poll(time.Second); err != nil && s.ctx.Err() == nil {
+			log.Printf("Standby replication read failed: %v", err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// poll reads and applies the next batch of events
+func (s *Standby) poll(block time.Duration) error {
+	s.mu.Lock()
+	lastID := s.lastID
+	s.mu.Unlock()
+
+	messages, err := s.cache.ReadReplicationEvents(s.ctx, lastID, block)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		var event engine.ReplicationEvent
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			log.Printf("Skipping malformed replication event %s: %v", msg.ID, err)
+		} else if err := s.exchange.ApplyReplicationEvent(&event); err != nil {
+			log.Printf("Failed to apply replication event %d: %v", event.Seq, err)
+		}
+
+		s.mu.Lock()
+		s.lastID = msg.ID
+		s.lastEvent = time.Now()
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// ErrAlreadyPrimary is returned when promoting an instance that already leads
+var ErrAlreadyPrimary = errors.New("instance is already primary")
+
+// Promote stops following, applies whatever the old primary managed to
+// publish, claims a new leadership epoch (fencing the old primary) and opens
+// the exchange for writes
+func (s *Standby) Promote() (int64, error) {
+	if !s.exchange.IsStandby() {
+		return 0, ErrAlreadyPrimary
+	}
+
+	s.cancel()
+	<-s.done
+
+	// Catch up on the tail of the stream without blocking
+	s.ctx = context.Background()
+	if err := s.poll(-1); err != nil {
+		return 0, fmt.Errorf("failed to catch up before promotion: %w", err)
+	}
+
+	epoch, err := s.leadership.Acquire()
+	if err != nil {
+		return 0, err
+	}
+
+	s.exchange.SetWriteFence(s.leadership.Check)
+	s.exchange.SetReplicator(NewPublisher(s.cache, s.leadership))
+	s.exchange.SetStandby(false)
+
+	s.mu.Lock()
+	s.promotedAt = time.Now()
+	s.mu.Unlock()
+
+	log.Printf("🚀 Standby promoted to primary at epoch %d (applied seq %d)", epoch, s.exchange.ReplicationSeq())
+	return epoch, nil
+}
+
+func (s *Standby) Status() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role := "standby"
+	if !s.exchange.IsStandby() {
+		role = "primary"
+	}
+	return Status{
+		Role:       role,
+		Epoch:      s.leadership.Epoch(),
+		AppliedSeq: s.exchange.ReplicationSeq(),
+		StreamID:   s.lastID,
+		LastEvent:  s.lastEvent,
+		PromotedAt: s.promotedAt,
+	}
+}
+
+// Primary reports replication status for the instance that currently leads
+type Primary struct {
+	exchange   *engine.Exchange
+	leadership *Leadership
+}
+
+func NewPrimary(exchange *engine.Exchange, leadership *Leadership) *Primary {
+	return &Primary{exchange: exchange, leadership: leadership}
+}
+
+func (p *Primary) Promote() (int64, error) {
+	return 0, ErrAlreadyPrimary
+}
+
+func (p *Primary) Status() interface{} {
+	role := "primary"
+	if p.leadership.Check() != nil {
+		role = "fenced"
+	}
+	return Status{
+		Role:       role,
+		Epoch:      p.leadership.Epoch(),
+		AppliedSeq: p.exchange.ReplicationSeq(),
+	}
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// ActivityRepository keeps each user's own notifications, such as orders the
+// exchange cancelled for them, as their activity feed
+type ActivityRepository struct {
+	db *sql.DB
+}
+
+func NewActivityRepository(db *sql.DB) *ActivityRepository {
+	return &ActivityRepository{db: db}
+}
+
+// SaveActivity stores a user's notification and deletes all but their
+// newest keep
+func (r *ActivityRepository) SaveActivity(ctx context.Context, notification *domain.Notification, keep int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_activity (id, user_id, symbol, order_id, category, severity, message, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, notification.ID, notification.UserID, notification.Symbol, notification.OrderID,
+		string(notification.Category), string(notification.Severity), notification.Message, notification.Timestamp.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save activity: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		DELETE FROM user_activity
+		WHERE user_id = $1
+		AND id NOT IN (SELECT id FROM user_activity WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2)
+	`, notification.UserID, keep)
+	if err != nil {
+		return fmt.Errorf("failed to trim activity: %w", err)
+	}
+	return nil
+}
+
+// GetActivity returns up to limit of a user's notifications, newest first
+func (r *ActivityRepository) GetActivity(ctx context.Context, userID string, limit int) ([]*domain.Notification, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, symbol, order_id, category, severity, message, created_at
+		FROM user_activity
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get activity: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := make([]*domain.Notification, 0)
+	for rows.Next() {
+		notification := &domain.Notification{}
+		var category, severity string
+		var createdAt sql.NullString
+		if err := rows.Scan(&notification.ID, &notification.UserID, &notification.Symbol, &notification.OrderID,
+			&category, &severity, &notification.Message, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan activity: %w", err)
+		}
+		notification.Category = domain.NotificationCategory(category)
+		notification.Severity = domain.NotificationSeverity(severity)
+		notification.Timestamp = parseTimestamp(createdAt)
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
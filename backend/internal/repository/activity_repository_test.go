@@ -0,0 +1,50 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+// Each user's feed keeps only their newest entries, listed newest first,
+// without trimming anyone else's
+func TestActivityTrimmedPerUser(t *testing.T) {
+	ctx := context.Background()
+	activity := repository.NewActivityRepository(newDB(t))
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	save := func(userID string, i int) {
+		t.Helper()
+		err := activity.SaveActivity(ctx, &domain.Notification{
+			ID:        fmt.Sprintf("%s-%d", userID, i),
+			UserID:    userID,
+			Symbol:    "BTC-USD",
+			OrderID:   fmt.Sprintf("order-%d", i),
+			Category:  domain.CategoryOrder,
+			Severity:  domain.SeverityInfo,
+			Message:   "cancelled",
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+		}, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("quiet", 0)
+	for i := 1; i <= 5; i++ {
+		save("busy", i)
+	}
+
+	busy, err := activity.GetActivity(ctx, "busy", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(busy) != 3 || busy[0].ID != "busy-5" || busy[2].ID != "busy-3" || busy[0].OrderID != "order-5" {
+		t.Errorf("busy's activity = %+v, want busy-5 to busy-3", busy)
+	}
+	if quiet, err := activity.GetActivity(ctx, "quiet", 10); err != nil || len(quiet) != 1 {
+		t.Errorf("quiet's activity = %+v, %v, want their one entry", quiet, err)
+	}
+}
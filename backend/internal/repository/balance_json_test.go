@@ -0,0 +1,44 @@
+package repository_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files from the current output")
+
+// Balances are written with their asset's precision; the output is pinned
+// in testdata/balances.json. Run with -update to accept a deliberate change.
+func TestBalanceJSONGolden(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	data, err := json.MarshalIndent([]repository.Balance{
+		{UserID: "user-1", Asset: "USD", Available: 100000.1 + 0.2, Locked: 45000.005, UpdatedAt: at},
+		{UserID: "user-1", Asset: "BTC", Available: 0.1 + 0.2, Locked: 1e-9, UpdatedAt: at},
+	}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, '\n')
+
+	path := filepath.Join("testdata", "balances.json")
+	if *update {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run with -update to create it", err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("%s changed; run with -update if that's intended\ngot:\n%s\nwant:\n%s", path, data, want)
+	}
+}
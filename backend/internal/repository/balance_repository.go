@@ -3,10 +3,36 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/hft-exchange/backend/internal/domain"
 )
 
+// ErrInsufficientBalance is returned when a lock exceeds the available balance
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// ErrAlreadySettled is returned when a settlement's key was already applied
+var ErrAlreadySettled = errors.New("already settled")
+
+// ErrLockedOverdrawn is returned when a settlement would take more out of a
+// locked balance than is locked, e.g. a fill outspent what its order
+// reserved, or an unlock would release more than is locked. Either is
+// refused rather than leaving the balance negative.
+var ErrLockedOverdrawn = errors.New("locked balance overdrawn")
+
+// lockedTolerance is how far below zero float rounding may leave a locked
+// balance, well under the smallest amount any asset is shown with
+const lockedTolerance = 1e-8
+
+// ErrWithdrawalLimit is returned when a withdrawal would take a user past the
+// daily cap for its asset
+var ErrWithdrawalLimit = errors.New("daily withdrawal limit exceeded")
+
 type BalanceRepository struct {
 	db *sql.DB
 }
@@ -19,11 +45,29 @@ type Balance struct {
 	UpdatedAt time.Time
 }
 
+// MarshalJSON writes amounts as decimal strings with the asset's precision
+func (b Balance) MarshalJSON() ([]byte, error) {
+	type plain Balance
+	decimals := domain.AssetPrecision(b.Asset)
+	return json.Marshal(struct {
+		plain
+		Available domain.Decimal
+		Locked    domain.Decimal
+	}{
+		plain:     plain(b),
+		Available: domain.Decimal{Value: b.Available, Places: decimals},
+		Locked:    domain.Decimal{Value: b.Locked, Places: decimals},
+	})
+}
+
 func NewBalanceRepository(db *sql.DB) *BalanceRepository {
 	return &BalanceRepository{db: db}
 }
 
-func (r *BalanceRepository) GetBalance(userID, asset string) (*Balance, error) {
+func (r *BalanceRepository) GetBalance(ctx context.Context, userID, asset string) (*Balance, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT user_id, asset, available, locked, updated_at
 		FROM balances
@@ -32,7 +76,7 @@ func (r *BalanceRepository) GetBalance(userID, asset string) (*Balance, error) {
 	
 	balance := &Balance{}
 	var updatedAt sql.NullString
-	err := r.db.QueryRow(query, userID, asset).Scan(
+	err := r.db.QueryRowContext(ctx, query, userID, asset).Scan(
 		&balance.UserID, &balance.Asset, &balance.Available, 
 		&balance.Locked, &updatedAt,
 	)
@@ -62,8 +106,8 @@ func (r *BalanceRepository) GetBalance(userID, asset string) (*Balance, error) {
 	return balance, nil
 }
 
-func (r *BalanceRepository) GetAllBalances(userID string) ([]*Balance, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *BalanceRepository) GetAllBalances(ctx context.Context, userID string) ([]*Balance, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	
 	query := `
@@ -105,7 +149,48 @@ func (r *BalanceRepository) GetAllBalances(userID string) ([]*Balance, error) {
 	return balances, nil
 }
 
-func (r *BalanceRepository) UpdateBalance(userID, asset string, available, locked float64) error {
+// GetBalancesForUsers returns the balances of several users at once, by user
+func (r *BalanceRepository) GetBalancesForUsers(ctx context.Context, userIDs []string) (map[string][]*Balance, error) {
+	balances := make(map[string][]*Balance, len(userIDs))
+	if len(userIDs) == 0 {
+		return balances, nil
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	args := make([]interface{}, len(userIDs))
+	placeholders := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		args[i] = userID
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT user_id, asset, available, locked, updated_at
+		FROM balances
+		WHERE user_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY user_id, asset
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balances: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		balance := &Balance{}
+		var updatedAt sql.NullString
+		if err := rows.Scan(&balance.UserID, &balance.Asset, &balance.Available, &balance.Locked, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		balance.UpdatedAt = parseTimestamp(updatedAt)
+		balances[balance.UserID] = append(balances[balance.UserID], balance)
+	}
+	return balances, rows.Err()
+}
+
+func (r *BalanceRepository) UpdateBalance(ctx context.Context, userID, asset string, available, locked float64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	now := time.Now()
 	query := `
 		INSERT INTO balances (user_id, asset, available, locked, updated_at)
@@ -114,59 +199,404 @@ func (r *BalanceRepository) UpdateBalance(userID, asset string, available, locke
 		DO UPDATE SET available = $3, locked = $4, updated_at = $5
 	`
 	
-	_, err := r.db.Exec(query, userID, asset, available, locked, now)
+	_, err := r.db.ExecContext(ctx, query, userID, asset, available, locked, now)
 	if err != nil {
 		return fmt.Errorf("failed to update balance for %s/%s (%.4f/%.4f): %w", userID, asset, available, locked, err)
 	}
 	return nil
 }
 
-func (r *BalanceRepository) LockBalance(userID, asset string, amount float64) error {
-	tx, err := r.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
-	
-	var available, locked float64
-	err = tx.QueryRow(`
-		SELECT available, locked FROM balances 
-		WHERE user_id = $1 AND asset = $2
-		FOR UPDATE
-	`, userID, asset).Scan(&available, &locked)
-	
-	if err != nil {
-		return fmt.Errorf("failed to get balance: %w", err)
-	}
-	
-	if available < amount {
-		return fmt.Errorf("insufficient balance")
-	}
-	
-	_, err = tx.Exec(`
+func (r *BalanceRepository) LockBalance(ctx context.Context, userID, asset string, amount float64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	// A single conditional UPDATE keeps the check-and-lock atomic on both
+	// PostgreSQL and SQLite (which has no SELECT ... FOR UPDATE)
+	result, err := r.db.ExecContext(ctx, `
 		UPDATE balances 
 		SET available = available - $1, locked = locked + $1, updated_at = $4
-		WHERE user_id = $2 AND asset = $3
+		WHERE user_id = $2 AND asset = $3 AND available >= $1
 	`, amount, userID, asset, time.Now())
 	
 	if err != nil {
 		return fmt.Errorf("failed to lock balance: %w", err)
 	}
 	
-	return tx.Commit()
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to lock balance: %w", err)
+	}
+	if affected == 0 {
+		return ErrInsufficientBalance
+	}
+	
+	return nil
 }
 
-func (r *BalanceRepository) UnlockBalance(userID, asset string, amount float64) error {
+// UnlockBalance moves amount from a user's locked balance back to available.
+// Like Settle, it returns ErrLockedOverdrawn rather than unlock more than is
+// locked, and leaves the balance as it was.
+func (r *BalanceRepository) UnlockBalance(ctx context.Context, userID, asset string, amount float64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE balances 
 		SET available = available + $1, locked = locked - $1, updated_at = $4
-		WHERE user_id = $2 AND asset = $3
+		WHERE user_id = $2 AND asset = $3 AND locked - $1 >= $5
 	`
 	
-	_, err := r.db.Exec(query, amount, userID, asset, time.Now())
+	result, err := r.db.ExecContext(ctx, query, amount, userID, asset, time.Now(), -lockedTolerance)
+	if err != nil {
+		return fmt.Errorf("failed to unlock balance: %w", err)
+	}
+	
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to unlock balance: %w", err)
 	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s/%s has less than %.8f locked", ErrLockedOverdrawn, userID, asset, amount)
+	}
 	
 	return nil
 }
+
+// BalanceDelta is a signed change to one user's available and locked amounts
+// of an asset
+type BalanceDelta struct {
+	UserID    string
+	Asset     string
+	Available float64
+	Locked    float64
+}
+
+// ApplyDeltas applies every delta in a single transaction, so a trade's legs
+// either all land or none do. Deltas are added in SQL rather than written as
+// absolute values, so concurrent updates to the same row can't be lost.
+func (r *BalanceRepository) ApplyDeltas(ctx context.Context, deltas []BalanceDelta) error {
+	_, err := r.Settle(ctx, "", deltas, nil)
+	return err
+}
+
+// Settle applies a trade's balance deltas and position fills in one
+// transaction and returns the resulting positions. A non-empty key (the trade
+// ID) is recorded in the same transaction, so settling it again returns
+// ErrAlreadySettled instead of moving the funds twice.
+func (r *BalanceRepository) Settle(ctx context.Context, key string, deltas []BalanceDelta, fills []PositionFill) ([]*domain.Position, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if key != "" {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO settlements (trade_id, settled_at) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, key, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record settlement %s: %w", key, err)
+		}
+		if recorded, err := result.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("failed to record settlement %s: %w", key, err)
+		} else if recorded == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrAlreadySettled, key)
+		}
+	}
+
+	query := `
+		INSERT INTO balances (user_id, asset, available, locked, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, asset)
+		DO UPDATE SET available = balances.available + $3, locked = balances.locked + $4, updated_at = $5
+	`
+	// Funds leaving a locked balance must have been locked, so the row
+	// exists and is only updated while enough is locked
+	spendLocked := `
+		UPDATE balances
+		SET available = available + $3, locked = locked + $4, updated_at = $5
+		WHERE user_id = $1 AND asset = $2 AND locked + $4 >= $6
+	`
+
+	for _, delta := range deltas {
+		if delta.Available == 0 && delta.Locked == 0 {
+			continue
+		}
+		if delta.Locked < 0 {
+			result, err := tx.ExecContext(ctx, spendLocked, delta.UserID, delta.Asset, delta.Available, delta.Locked, now, -lockedTolerance)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply balance delta for %s/%s (%+.8f/%+.8f): %w",
+					delta.UserID, delta.Asset, delta.Available, delta.Locked, err)
+			}
+			if updated, err := result.RowsAffected(); err != nil {
+				return nil, fmt.Errorf("failed to apply balance delta for %s/%s: %w", delta.UserID, delta.Asset, err)
+			} else if updated == 0 {
+				return nil, fmt.Errorf("%w: %s/%s has less than %.8f locked", ErrLockedOverdrawn, delta.UserID, delta.Asset, -delta.Locked)
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, query, delta.UserID, delta.Asset, delta.Available, delta.Locked, now); err != nil {
+			return nil, fmt.Errorf("failed to apply balance delta for %s/%s (%+.8f/%+.8f): %w",
+				delta.UserID, delta.Asset, delta.Available, delta.Locked, err)
+		}
+	}
+
+	positions := make([]*domain.Position, 0, len(fills))
+	for _, fill := range fills {
+		position, err := applyPositionFill(ctx, tx, fill, now)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, position)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit settlement: %w", err)
+	}
+	return positions, nil
+}
+
+// LedgerEntry records a change to a user's available balance made outside
+// trading: an admin adjustment or one leg of a transfer
+type LedgerEntry struct {
+	ID     string
+	UserID string
+	Asset  string
+	Delta  float64
+	// Available is the balance right after the change
+	Available float64
+	Reason    string
+	// Reference is shared by both legs of a transfer
+	Reference string
+	CreatedAt time.Time
+}
+
+// AdjustBalance adds delta, which may be negative, to a user's available
+// balance and records it in the ledger. It returns ErrInsufficientBalance
+// rather than leave the available balance negative.
+func (r *BalanceRepository) AdjustBalance(ctx context.Context, userID, asset string, delta float64, reason string) (*LedgerEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	entry, err := adjustBalance(ctx, tx, userID, asset, delta, reason, "", time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit balance adjustment: %w", err)
+	}
+	return entry, nil
+}
+
+// Transfer moves amount of an asset from one user's available balance to
+// another's in one transaction, recording both legs in the ledger under a
+// shared reference. It returns ErrInsufficientBalance if the sender can't
+// cover it.
+func (r *BalanceRepository) Transfer(ctx context.Context, fromUser, toUser, asset string, amount float64, reason string) ([]*LedgerEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	reference := uuid.New().String()
+	debit, err := adjustBalance(ctx, tx, fromUser, asset, -amount, reason, reference, now)
+	if err != nil {
+		return nil, err
+	}
+	credit, err := adjustBalance(ctx, tx, toUser, asset, amount, reason, reference, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transfer: %w", err)
+	}
+	return []*LedgerEntry{debit, credit}, nil
+}
+
+// Funding movement types
+const (
+	FundingDeposit    = "DEPOSIT"
+	FundingWithdrawal = "WITHDRAWAL"
+)
+
+// Funding records money moved into or out of the exchange by a user
+type Funding struct {
+	ID     string
+	UserID string
+	Asset  string
+	Type   string
+	Amount float64
+	// Available is the balance right after the movement
+	Available float64
+	LedgerID  string
+	CreatedAt time.Time
+}
+
+// Fund deposits or withdraws amount of an asset, adjusting the user's
+// available balance and recording the movement in the ledger and the
+// funding_transfers table in one transaction. A withdrawal returns
+// ErrInsufficientBalance if it exceeds the available balance, and, with a
+// positive dailyLimit, ErrWithdrawalLimit if it would take the user's
+// withdrawals of the asset since midnight UTC past it.
+func (r *BalanceRepository) Fund(ctx context.Context, userID, asset, kind string, amount, dailyLimit float64) (*Funding, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	delta := amount
+	if kind == FundingWithdrawal {
+		delta = -amount
+	}
+	// The debit locks the balance row, so concurrent withdrawals are summed
+	// one at a time below
+	entry, err := adjustBalance(ctx, tx, userID, asset, delta, strings.ToLower(kind), "", now)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == FundingWithdrawal && dailyLimit > 0 {
+		var withdrawn float64
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(amount), 0) FROM funding_transfers
+			WHERE user_id = $1 AND asset = $2 AND type = $3 AND created_at >= $4
+		`, userID, asset, FundingWithdrawal, now.Truncate(24*time.Hour)).Scan(&withdrawn); err != nil {
+			return nil, fmt.Errorf("failed to sum withdrawals: %w", err)
+		}
+		if withdrawn+amount > dailyLimit {
+			return nil, fmt.Errorf("%w: %v %s withdrawn today of a %v limit", ErrWithdrawalLimit, withdrawn, asset, dailyLimit)
+		}
+	}
+
+	funding := &Funding{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Asset:     asset,
+		Type:      kind,
+		Amount:    amount,
+		Available: entry.Available,
+		LedgerID:  entry.ID,
+		CreatedAt: now,
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO funding_transfers (id, user_id, asset, type, amount, available, ledger_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, funding.ID, userID, asset, kind, amount, funding.Available, funding.LedgerID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record %s: %w", strings.ToLower(kind), err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit %s: %w", strings.ToLower(kind), err)
+	}
+	return funding, nil
+}
+
+// adjustBalance applies one ledger entry within tx
+func adjustBalance(ctx context.Context, tx *sql.Tx, userID, asset string, delta float64, reason, reference string, now time.Time) (*LedgerEntry, error) {
+	if delta >= 0 {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO balances (user_id, asset, available, locked, updated_at)
+			VALUES ($1, $2, $3, 0, $4)
+			ON CONFLICT (user_id, asset)
+			DO UPDATE SET available = balances.available + $3, updated_at = $4
+		`, userID, asset, delta, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to adjust balance for %s/%s (%+.8f): %w", userID, asset, delta, err)
+		}
+	} else {
+		// Conditional like LockBalance, so a concurrent lock can't take the
+		// balance below zero between a check and the update
+		result, err := tx.ExecContext(ctx, `
+			UPDATE balances
+			SET available = available + $1, updated_at = $4
+			WHERE user_id = $2 AND asset = $3 AND available + $1 >= 0
+		`, delta, userID, asset, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to adjust balance for %s/%s (%+.8f): %w", userID, asset, delta, err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to adjust balance for %s/%s (%+.8f): %w", userID, asset, delta, err)
+		}
+		if affected == 0 {
+			return nil, ErrInsufficientBalance
+		}
+	}
+
+	entry := &LedgerEntry{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Asset:     asset,
+		Delta:     delta,
+		Reason:    reason,
+		Reference: reference,
+		CreatedAt: now,
+	}
+	if err := tx.QueryRowContext(ctx, `
+		SELECT available FROM balances WHERE user_id = $1 AND asset = $2
+	`, userID, asset).Scan(&entry.Available); err != nil {
+		return nil, fmt.Errorf("failed to read adjusted balance: %w", err)
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO balance_ledger (id, user_id, asset, delta, available, reason, reference, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, entry.ID, userID, asset, delta, entry.Available, reason, reference, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record ledger entry: %w", err)
+	}
+	return entry, nil
+}
+
+// GetLedger returns a user's most recent ledger entries, newest first
+func (r *BalanceRepository) GetLedger(ctx context.Context, userID string, limit int) ([]*LedgerEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, asset, delta, available, reason, reference, created_at
+		FROM balance_ledger
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]*LedgerEntry, 0)
+	for rows.Next() {
+		entry := &LedgerEntry{}
+		var createdAt sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Asset, &entry.Delta, &entry.Available,
+			&entry.Reason, &entry.Reference, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		entry.CreatedAt = parseTimestamp(createdAt)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
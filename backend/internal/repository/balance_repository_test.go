@@ -0,0 +1,103 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+// A settlement taking more out of a locked balance than is locked is refused
+// whole, leaving every balance as it was
+func TestSettleRefusesToOverdrawLocked(t *testing.T) {
+	ctx := context.Background()
+	balances := repository.NewBalanceRepository(newDB(t))
+	if err := balances.ApplyDeltas(ctx, []repository.BalanceDelta{{UserID: "buyer", Asset: "USD", Available: 1000}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := balances.LockBalance(ctx, "buyer", "USD", 500); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := balances.Settle(ctx, "trade-1", []repository.BalanceDelta{
+		{UserID: "seller", Asset: "USD", Available: 600},
+		{UserID: "buyer", Asset: "USD", Locked: -600},
+	}, nil)
+	if !errors.Is(err, repository.ErrLockedOverdrawn) {
+		t.Fatalf("err = %v, want ErrLockedOverdrawn", err)
+	}
+	assertBalance(t, balances, "buyer", 500, 500)
+	assertBalance(t, balances, "seller", 0, 0)
+
+	// Within what is locked, and the refused key is free to settle again
+	if _, err := balances.Settle(ctx, "trade-1", []repository.BalanceDelta{
+		{UserID: "seller", Asset: "USD", Available: 500},
+		{UserID: "buyer", Asset: "USD", Locked: -500},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	assertBalance(t, balances, "buyer", 500, 0)
+	assertBalance(t, balances, "seller", 500, 0)
+}
+
+// Float rounding a hair past zero is let through
+func TestSettleToleratesRounding(t *testing.T) {
+	ctx := context.Background()
+	balances := repository.NewBalanceRepository(newDB(t))
+	if err := balances.ApplyDeltas(ctx, []repository.BalanceDelta{{UserID: "buyer", Asset: "USD", Available: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := balances.LockBalance(ctx, "buyer", "USD", 0.3); err != nil {
+		t.Fatal(err)
+	}
+	// 0.1 + 0.2 is a little more than 0.3 in floating point
+	for i, amount := range []float64{0.1, 0.2} {
+		if _, err := balances.Settle(ctx, "", []repository.BalanceDelta{{UserID: "buyer", Asset: "USD", Locked: -amount}}, nil); err != nil {
+			t.Fatalf("settlement %d: %v", i, err)
+		}
+	}
+}
+
+// Unlocking more than is locked is refused and changes nothing, while
+// unlocking what is locked, give or take rounding, goes through
+func TestUnlockRefusesToOverdrawLocked(t *testing.T) {
+	ctx := context.Background()
+	balances := repository.NewBalanceRepository(newDB(t))
+	if err := balances.ApplyDeltas(ctx, []repository.BalanceDelta{{UserID: "buyer", Asset: "USD", Available: 1000}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := balances.LockBalance(ctx, "buyer", "USD", 500); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := balances.UnlockBalance(ctx, "buyer", "USD", 600); !errors.Is(err, repository.ErrLockedOverdrawn) {
+		t.Fatalf("unlocking 600 of 500: err = %v, want ErrLockedOverdrawn", err)
+	}
+	assertBalance(t, balances, "buyer", 500, 500)
+	if err := balances.UnlockBalance(ctx, "nobody", "USD", 1); !errors.Is(err, repository.ErrLockedOverdrawn) {
+		t.Fatalf("unlocking without a balance: err = %v, want ErrLockedOverdrawn", err)
+	}
+
+	if err := balances.UnlockBalance(ctx, "buyer", "USD", 200); err != nil {
+		t.Fatal(err)
+	}
+	if err := balances.UnlockBalance(ctx, "buyer", "USD", 300); err != nil {
+		t.Fatal(err)
+	}
+	assertBalance(t, balances, "buyer", 1000, 0)
+}
+
+func assertBalance(t *testing.T, balances *repository.BalanceRepository, userID string, available, locked float64) {
+	t.Helper()
+	balance, err := balances.GetBalance(context.Background(), userID, "USD")
+	if err != nil {
+		if available == 0 && locked == 0 {
+			return
+		}
+		t.Fatal(err)
+	}
+	if balance.Available != available || balance.Locked != locked {
+		t.Errorf("%s USD = %g available, %g locked; want %g, %g", userID, balance.Available, balance.Locked, available, locked)
+	}
+}
@@ -0,0 +1,392 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// Candle resolutions. Minute candles are built from trades, hour candles from
+// minute candles and daily stats from hour candles.
+const (
+	ResolutionMinute = "1m"
+	ResolutionHour   = "1h"
+)
+
+const (
+	InvalidationPending = "pending"
+	InvalidationDone    = "done"
+)
+
+// CandleInvalidation is a queued recomputation of a symbol's candles over
+// [RangeStart, RangeEnd). Cursor is the start of the next minute to rebuild,
+// so an interrupted recomputation resumes where it stopped.
+type CandleInvalidation struct {
+	ID         string
+	Symbol     string
+	RangeStart time.Time
+	RangeEnd   time.Time
+	Cursor     time.Time
+	Status     string
+	CreatedAt  time.Time
+}
+
+type CandleRepository struct {
+	db *sql.DB
+}
+
+func NewCandleRepository(db *sql.DB) *CandleRepository {
+	return &CandleRepository{db: db}
+}
+
+// Invalidate marks the candles in a range dirty and queues their
+// recomputation. Pending invalidations of the same symbol that overlap or
+// touch the range are merged into one, keeping the earliest cursor.
+func (r *CandleRepository) Invalidate(ctx context.Context, symbol string, from, to time.Time) (*CandleInvalidation, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	merged := &CandleInvalidation{
+		ID:         uuid.New().String(),
+		Symbol:     symbol,
+		RangeStart: from,
+		RangeEnd:   to,
+		Cursor:     from,
+		Status:     InvalidationPending,
+		CreatedAt:  now,
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, range_start, range_end, cursor_at, created_at
+		FROM candle_invalidations
+		WHERE symbol = $1 AND status = $2 AND range_start <= $3 AND range_end >= $4
+	`, symbol, InvalidationPending, to, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find overlapping invalidations: %w", err)
+	}
+
+	overlapping := make([]string, 0)
+	for rows.Next() {
+		var id string
+		var rangeStart, rangeEnd, cursor, createdAt sql.NullString
+		if err := rows.Scan(&id, &rangeStart, &rangeEnd, &cursor, &createdAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan invalidation: %w", err)
+		}
+		overlapping = append(overlapping, id)
+
+		if t := parseTimestamp(rangeStart).UTC(); t.Before(merged.RangeStart) {
+			merged.RangeStart = t
+		}
+		if t := parseTimestamp(rangeEnd).UTC(); t.After(merged.RangeEnd) {
+			merged.RangeEnd = t
+		}
+		if t := parseTimestamp(cursor).UTC(); t.Before(merged.Cursor) {
+			merged.Cursor = t
+		}
+		if t := parseTimestamp(createdAt).UTC(); t.Before(merged.CreatedAt) {
+			merged.CreatedAt = t
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read invalidations: %w", err)
+	}
+
+	for _, id := range overlapping {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM candle_invalidations WHERE id = $1`, id); err != nil {
+			return nil, fmt.Errorf("failed to merge invalidation %s: %w", id, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO candle_invalidations (id, symbol, range_start, range_end, cursor_at, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, merged.ID, merged.Symbol, merged.RangeStart, merged.RangeEnd, merged.Cursor, merged.Status, merged.CreatedAt, now); err != nil {
+		return nil, fmt.Errorf("failed to queue invalidation: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE candles SET dirty = $1
+		WHERE symbol = $2 AND bucket_start >= $3 AND bucket_start < $4
+	`, true, symbol, from, to); err != nil {
+		return nil, fmt.Errorf("failed to mark candles dirty: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit invalidation: %w", err)
+	}
+	return merged, nil
+}
+
+// NextInvalidation returns the oldest pending invalidation, or nil
+func (r *CandleRepository) NextInvalidation(ctx context.Context) (*CandleInvalidation, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	inv := &CandleInvalidation{}
+	var rangeStart, rangeEnd, cursor, createdAt sql.NullString
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, symbol, range_start, range_end, cursor_at, status, created_at
+		FROM candle_invalidations
+		WHERE status = $1
+		ORDER BY created_at ASC
+		LIMIT 1
+	`, InvalidationPending).Scan(&inv.ID, &inv.Symbol, &rangeStart, &rangeEnd, &cursor, &inv.Status, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next invalidation: %w", err)
+	}
+
+	inv.RangeStart = parseTimestamp(rangeStart).UTC()
+	inv.RangeEnd = parseTimestamp(rangeEnd).UTC()
+	inv.Cursor = parseTimestamp(cursor).UTC()
+	inv.CreatedAt = parseTimestamp(createdAt).UTC()
+	return inv, nil
+}
+
+// RecomputeBatch rebuilds the minute candles in [inv.Cursor, batchEnd) from
+// trades, rolls every hour they touch back up from minute candles and
+// advances the cursor, all in one transaction. Running it twice for the same
+// batch produces the same rows.
+func (r *CandleRepository) RecomputeBatch(ctx context.Context, inv *CandleInvalidation, batchEnd time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	minutes, err := aggregateTrades(ctx, tx, inv.Symbol, inv.Cursor, batchEnd)
+	if err != nil {
+		return err
+	}
+	if err := replaceCandles(ctx, tx, inv.Symbol, ResolutionMinute, inv.Cursor, batchEnd, minutes, now); err != nil {
+		return err
+	}
+
+	for hour := inv.Cursor.Truncate(time.Hour); hour.Before(batchEnd); hour = hour.Add(time.Hour) {
+		candles, err := candlesBetween(ctx, tx, inv.Symbol, ResolutionMinute, hour, hour.Add(time.Hour))
+		if err != nil {
+			return err
+		}
+		rollup := rollupCandles(inv.Symbol, ResolutionHour, hour, candles)
+		if err := replaceCandles(ctx, tx, inv.Symbol, ResolutionHour, hour, hour.Add(time.Hour), rollup, now); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE candle_invalidations SET cursor_at = $1, updated_at = $2 WHERE id = $3
+	`, batchEnd, now, inv.ID); err != nil {
+		return fmt.Errorf("failed to advance invalidation cursor: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit candle batch: %w", err)
+	}
+	inv.Cursor = batchEnd
+	return nil
+}
+
+// FinishInvalidation recomputes the daily stats of every day the
+// invalidation touched from hour candles and marks it done
+func (r *CandleRepository) FinishInvalidation(ctx context.Context, inv *CandleInvalidation) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for day := inv.RangeStart.Truncate(24 * time.Hour); day.Before(inv.RangeEnd); day = day.Add(24 * time.Hour) {
+		hours, err := candlesBetween(ctx, tx, inv.Symbol, ResolutionHour, day, day.Add(24*time.Hour))
+		if err != nil {
+			return err
+		}
+
+		key := day.Format("2006-01-02")
+		if _, err := tx.ExecContext(ctx, `DELETE FROM daily_stats WHERE symbol = $1 AND day = $2`, inv.Symbol, key); err != nil {
+			return fmt.Errorf("failed to clear daily stats %s: %w", key, err)
+		}
+		stats := rollupCandles(inv.Symbol, "1d", day, hours)
+		if len(stats) == 0 {
+			continue
+		}
+		s := stats[0]
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO daily_stats (symbol, day, open, high, low, close, volume, vwap, trade_count, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`, inv.Symbol, key, s.Open, s.High, s.Low, s.Close, s.Volume, s.VWAP, s.TradeCount, now); err != nil {
+			return fmt.Errorf("failed to write daily stats %s: %w", key, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE candle_invalidations SET status = $1, updated_at = $2 WHERE id = $3
+	`, InvalidationDone, now, inv.ID); err != nil {
+		return fmt.Errorf("failed to complete invalidation: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetCandles returns a symbol's candles of one resolution in [from, to)
+func (r *CandleRepository) GetCandles(ctx context.Context, symbol, resolution string, from, to time.Time) ([]*domain.Candle, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return candlesBetween(ctx, r.db, symbol, resolution, from, to)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// AggregateTrades builds minute candles from the trades in [from, to)
+// without storing them, e.g. for minutes not yet materialized
+func (r *CandleRepository) AggregateTrades(ctx context.Context, symbol string, from, to time.Time) ([]*domain.Candle, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if !from.Before(to) {
+		return nil, nil
+	}
+	return aggregateTrades(ctx, r.db, symbol, from, to)
+}
+
+// LastClose returns the close of a symbol's last minute candle starting
+// before before, and false if there is none
+func (r *CandleRepository) LastClose(ctx context.Context, symbol string, before time.Time) (float64, bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var price float64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT close FROM candles
+		WHERE symbol = $1 AND resolution = $2 AND bucket_start < $3
+		ORDER BY bucket_start DESC
+		LIMIT 1
+	`, symbol, ResolutionMinute, before).Scan(&price)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read last candle: %w", err)
+	}
+	return price, true, nil
+}
+
+// aggregateTrades builds minute candles from the trades in [from, to).
+// Trades are stored in server local time, candle buckets in UTC.
+func aggregateTrades(ctx context.Context, q queryer, symbol string, from, to time.Time) ([]*domain.Candle, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT price, quantity, executed_at
+		FROM trades
+		WHERE symbol = $1 AND executed_at >= $2 AND executed_at < $3
+		ORDER BY executed_at ASC
+	`, symbol, from.Local(), to.Local())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trades: %w", err)
+	}
+	defer rows.Close()
+
+	candles := make([]*domain.Candle, 0)
+	var current *domain.Candle
+	for rows.Next() {
+		var price, quantity float64
+		var executedAt sql.NullString
+		if err := rows.Scan(&price, &quantity, &executedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan trade: %w", err)
+		}
+
+		bucket := parseTimestamp(executedAt).UTC().Truncate(time.Minute)
+		if current == nil || !current.BucketStart.Equal(bucket) {
+			current = &domain.Candle{Symbol: symbol, Resolution: ResolutionMinute, BucketStart: bucket}
+			candles = append(candles, current)
+		}
+		current.AddTrade(price, quantity)
+	}
+
+	return candles, rows.Err()
+}
+
+// rollupCandles merges time-ordered candles into one candle for bucket
+func rollupCandles(symbol, resolution string, bucket time.Time, candles []*domain.Candle) []*domain.Candle {
+	rollup := &domain.Candle{Symbol: symbol, Resolution: resolution, BucketStart: bucket}
+	for _, candle := range candles {
+		rollup.Merge(candle)
+	}
+	if rollup.TradeCount == 0 {
+		return nil
+	}
+	return []*domain.Candle{rollup}
+}
+
+func candlesBetween(ctx context.Context, q queryer, symbol, resolution string, from, to time.Time) ([]*domain.Candle, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT bucket_start, open, high, low, close, volume, vwap, trade_count, dirty
+		FROM candles
+		WHERE symbol = $1 AND resolution = $2 AND bucket_start >= $3 AND bucket_start < $4
+		ORDER BY bucket_start ASC
+	`, symbol, resolution, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read candles: %w", err)
+	}
+	defer rows.Close()
+
+	candles := make([]*domain.Candle, 0)
+	for rows.Next() {
+		candle := &domain.Candle{Symbol: symbol, Resolution: resolution}
+		var bucketStart sql.NullString
+		if err := rows.Scan(&bucketStart, &candle.Open, &candle.High, &candle.Low, &candle.Close,
+			&candle.Volume, &candle.VWAP, &candle.TradeCount, &candle.Dirty); err != nil {
+			return nil, fmt.Errorf("failed to scan candle: %w", err)
+		}
+		candle.BucketStart = parseTimestamp(bucketStart).UTC()
+		candles = append(candles, candle)
+	}
+
+	return candles, rows.Err()
+}
+
+// replaceCandles swaps the candles of a resolution in [from, to) for the
+// given set, which leaves buckets outside the range untouched
+func replaceCandles(ctx context.Context, tx *sql.Tx, symbol, resolution string, from, to time.Time, candles []*domain.Candle, now time.Time) error {
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM candles
+		WHERE symbol = $1 AND resolution = $2 AND bucket_start >= $3 AND bucket_start < $4
+	`, symbol, resolution, from, to); err != nil {
+		return fmt.Errorf("failed to clear %s candles: %w", resolution, err)
+	}
+
+	for _, c := range candles {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO candles (symbol, resolution, bucket_start, open, high, low, close, volume, vwap, trade_count, dirty, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`, symbol, resolution, c.BucketStart, c.Open, c.High, c.Low, c.Close, c.Volume, c.VWAP, c.TradeCount, false, now); err != nil {
+			return fmt.Errorf("failed to write %s candle %s: %w", resolution, c.BucketStart, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+// Busting a trade mid-day rewrites its minute, its hour and its day, and
+// leaves every other candle and day's stats as they were, down to when they
+// were written
+func TestMidDayBustLeavesOtherBucketsUntouched(t *testing.T) {
+	db := newDB(t)
+	ctx := context.Background()
+	candles := repository.NewCandleRepository(db)
+	trades := repository.NewTradeRepository(db)
+
+	day := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	var busted *domain.Trade
+	for _, fill := range []struct {
+		at    time.Duration
+		price float64
+	}{
+		{-2 * time.Hour, 44000},
+		{1*time.Hour + 10*time.Minute, 45000},
+		{9*time.Hour + 30*time.Minute, 45500},
+		{12*time.Hour + 15*time.Minute + 10*time.Second, 46000},
+		{12*time.Hour + 15*time.Minute + 40*time.Second, 48000},
+		{12*time.Hour + 45*time.Minute, 46500},
+		{18*time.Hour + 5*time.Minute, 45800},
+		{23*time.Hour + 50*time.Minute, 45900},
+		{26 * time.Hour, 46100},
+	} {
+		trade := domain.NewTrade("BTC-USD", domain.NewID(), domain.NewID(), "buyer", "seller", fill.price, 0.5, domain.NewID(), domain.NewID())
+		trade.ExecutedAt = day.Add(fill.at)
+		if _, err := trades.SaveTrade(ctx, trade); err != nil {
+			t.Fatal(err)
+		}
+		if fill.price == 48000 {
+			busted = trade
+		}
+	}
+
+	recompute(t, candles, day.Add(-24*time.Hour), day.Add(48*time.Hour))
+	before := candleRows(t, db)
+
+	if _, err := db.Exec(`DELETE FROM trades WHERE id = $1`, busted.ID); err != nil {
+		t.Fatal(err)
+	}
+	minute := busted.ExecutedAt.Truncate(time.Minute)
+	recompute(t, candles, minute, minute.Add(time.Minute))
+	after := candleRows(t, db)
+
+	changed := map[string]bool{
+		"1m " + minute.Format(time.RFC3339):                     true,
+		"1h " + minute.Truncate(time.Hour).Format(time.RFC3339): true,
+		"1d 2024-03-05": true,
+	}
+	if len(after) != len(before) {
+		t.Fatalf("%d buckets after the bust, want the %d there were before", len(after), len(before))
+	}
+	for key, row := range before {
+		if changed[key] {
+			if after[key] == row {
+				t.Errorf("%s unchanged by the bust: %s", key, row)
+			}
+			continue
+		}
+		if after[key] != row {
+			t.Errorf("%s rewritten by a bust outside it:\nbefore %s\nafter  %s", key, row, after[key])
+		}
+	}
+
+	got, err := candles.GetCandles(ctx, "BTC-USD", repository.ResolutionMinute, minute, minute.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].TradeCount != 1 || got[0].High != 46000 || got[0].Close != 46000 {
+		t.Errorf("busted minute = %+v, want only the 46000 trade", got)
+	}
+}
+
+// recompute queues [from, to) and works the invalidation off an hour at a
+// time, as the candle service does
+func recompute(t *testing.T, candles *repository.CandleRepository, from, to time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := candles.Invalidate(ctx, "BTC-USD", from, to); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		inv, err := candles.NextInvalidation(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inv == nil {
+			return
+		}
+		if !inv.Cursor.Before(inv.RangeEnd) {
+			if err := candles.FinishInvalidation(ctx, inv); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		batchEnd := inv.Cursor.Add(time.Hour)
+		if batchEnd.After(inv.RangeEnd) {
+			batchEnd = inv.RangeEnd
+		}
+		if err := candles.RecomputeBatch(ctx, inv, batchEnd); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// candleRows returns every candle and daily stat row, updated_at included,
+// keyed by resolution and bucket
+func candleRows(t *testing.T, db *sql.DB) map[string]string {
+	t.Helper()
+	rows := make(map[string]string)
+
+	candles, err := db.Query(`
+		SELECT resolution, bucket_start, open, high, low, close, volume, vwap, trade_count, dirty, updated_at
+		FROM candles WHERE symbol = $1
+	`, "BTC-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer candles.Close()
+	for candles.Next() {
+		var resolution string
+		var bucket, updatedAt sql.NullString
+		var c domain.Candle
+		if err := candles.Scan(&resolution, &bucket, &c.Open, &c.High, &c.Low, &c.Close, &c.Volume, &c.VWAP, &c.TradeCount, &c.Dirty, &updatedAt); err != nil {
+			t.Fatal(err)
+		}
+		key := resolution + " " + parseBucket(t, bucket.String).Format(time.RFC3339)
+		rows[key] = fmt.Sprintf("%v %v %v %v %v %v %d %v %s", c.Open, c.High, c.Low, c.Close, c.Volume, c.VWAP, c.TradeCount, c.Dirty, updatedAt.String)
+	}
+	if err := candles.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.Query(`
+		SELECT day, open, high, low, close, volume, vwap, trade_count, updated_at
+		FROM daily_stats WHERE symbol = $1
+	`, "BTC-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.Close()
+	for stats.Next() {
+		var day string
+		var updatedAt sql.NullString
+		var c domain.Candle
+		if err := stats.Scan(&day, &c.Open, &c.High, &c.Low, &c.Close, &c.Volume, &c.VWAP, &c.TradeCount, &updatedAt); err != nil {
+			t.Fatal(err)
+		}
+		rows["1d "+day] = fmt.Sprintf("%v %v %v %v %v %v %d %s", c.Open, c.High, c.Low, c.Close, c.Volume, c.VWAP, c.TradeCount, updatedAt.String)
+	}
+	if err := stats.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+// parseBucket reads a bucket_start in any of the layouts the drivers write
+func parseBucket(t *testing.T, value string) time.Time {
+	t.Helper()
+	text, _, _ := strings.Cut(value, " m=")
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999 -0700 MST", "2006-01-02 15:04:05"} {
+		if start, err := time.Parse(layout, text); err == nil {
+			return start.UTC()
+		}
+	}
+	t.Fatalf("unreadable bucket_start %q", value)
+	return time.Time{}
+}
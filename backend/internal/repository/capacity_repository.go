@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CapacitySample is one symbol's resource usage as sampled on a day
+type CapacitySample struct {
+	Day                  string   `json:"day,omitempty"`
+	Symbol               string   `json:"symbol"`
+	RestingOrders        int      `json:"resting_orders"`
+	MemoryBytes          int64    `json:"memory_bytes"`
+	TradesPerHour        int      `json:"trades_per_hour"`
+	OrderEventsPerHour   int64    `json:"order_events_per_hour"`
+	WebsocketSubscribers int      `json:"websocket_subscribers"`
+	PersistLagP95Ms      float64  `json:"persist_lag_p95_ms"`
+	CacheHitRate         *float64 `json:"cache_hit_rate"`
+}
+
+type CapacityRepository struct {
+	db *sql.DB
+}
+
+func NewCapacityRepository(db *sql.DB) *CapacityRepository {
+	return &CapacityRepository{db: db}
+}
+
+// SaveSample stores a symbol's sample, replacing any earlier one for the
+// same day
+func (r *CapacityRepository) SaveSample(ctx context.Context, sample *CapacitySample) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var hitRate sql.NullFloat64
+	if sample.CacheHitRate != nil {
+		hitRate = sql.NullFloat64{Float64: *sample.CacheHitRate, Valid: true}
+	}
+
+	query := `
+		INSERT INTO capacity_samples (day, symbol, resting_orders, memory_bytes, trades_per_hour,
+			order_events_per_hour, websocket_subscribers, persist_lag_p95_ms, cache_hit_rate, sampled_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (day, symbol)
+		DO UPDATE SET resting_orders = $3, memory_bytes = $4, trades_per_hour = $5,
+			order_events_per_hour = $6, websocket_subscribers = $7, persist_lag_p95_ms = $8,
+			cache_hit_rate = $9, sampled_at = $10
+	`
+	_, err := r.db.ExecContext(ctx, query, sample.Day, sample.Symbol, sample.RestingOrders, sample.MemoryBytes,
+		sample.TradesPerHour, sample.OrderEventsPerHour, sample.WebsocketSubscribers,
+		sample.PersistLagP95Ms, hitRate, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save capacity sample: %w", err)
+	}
+	return nil
+}
+
+// GetSamples returns every sample from day since onwards, oldest first
+func (r *CapacityRepository) GetSamples(ctx context.Context, since string) ([]*CapacitySample, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT day, symbol, resting_orders, memory_bytes, trades_per_hour, order_events_per_hour,
+			websocket_subscribers, persist_lag_p95_ms, cache_hit_rate
+		FROM capacity_samples
+		WHERE day >= $1
+		ORDER BY day ASC, symbol ASC
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get capacity samples: %w", err)
+	}
+	defer rows.Close()
+
+	samples := make([]*CapacitySample, 0)
+	for rows.Next() {
+		sample := &CapacitySample{}
+		var hitRate sql.NullFloat64
+		if err := rows.Scan(&sample.Day, &sample.Symbol, &sample.RestingOrders, &sample.MemoryBytes,
+			&sample.TradesPerHour, &sample.OrderEventsPerHour, &sample.WebsocketSubscribers,
+			&sample.PersistLagP95Ms, &hitRate); err != nil {
+			return nil, fmt.Errorf("failed to scan capacity sample: %w", err)
+		}
+		if hitRate.Valid {
+			sample.CacheHitRate = &hitRate.Float64
+		}
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
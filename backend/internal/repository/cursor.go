@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned for cursors this server didn't issue
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks a position in a newest-first history: the timestamp and ID of
+// the last row returned. The next page holds the rows ordered after it.
+type Cursor struct {
+	At time.Time
+	ID string
+}
+
+// NewCursor returns the cursor following a row. Timestamps are truncated to
+// microseconds, the precision PostgreSQL stores, so the row itself is never
+// returned again.
+func NewCursor(at time.Time, id string) *Cursor {
+	return &Cursor{At: at.Truncate(time.Microsecond), ID: id}
+}
+
+// Encode returns the cursor in the opaque form handed to clients
+func (c *Cursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.At.Format(time.RFC3339Nano) + "|" + c.ID))
+}
+
+// ParseCursor decodes a cursor produced by Encode
+func ParseCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{At: t, ID: id}, nil
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Hedge is a paper hedge a bot recorded against the reference venue
+type Hedge struct {
+	ID             string
+	Bot            string
+	Symbol         string
+	Side           string
+	Quantity       float64
+	ReferencePrice float64
+	Price          float64
+	Slippage       float64
+	ExecutedAt     time.Time
+}
+
+type HedgeRepository struct {
+	db *sql.DB
+}
+
+func NewHedgeRepository(db *sql.DB) *HedgeRepository {
+	return &HedgeRepository{db: db}
+}
+
+// SaveHedge appends a hedge to the ledger
+func (r *HedgeRepository) SaveHedge(ctx context.Context, hedge *Hedge) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO hedges (id, bot, symbol, side, quantity, reference_price, price, slippage, executed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, hedge.ID, hedge.Bot, hedge.Symbol, hedge.Side, hedge.Quantity, hedge.ReferencePrice,
+		hedge.Price, hedge.Slippage, hedge.ExecutedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save hedge: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package repository_test
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/database"
+)
+
+var databases atomic.Uint64
+
+// newDB returns a fresh in-memory SQLite database with the schema applied
+func newDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.NewDB(fmt.Sprintf("sqlite://file:repository-test-%d?mode=memory&cache=shared", databases.Add(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	return db.DB
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// JournalRecord is one entry of a symbol's append-only event journal
+type JournalRecord struct {
+	Symbol     string          `json:"symbol"`
+	Seq        uint64          `json:"seq"`
+	Kind       string          `json:"kind"`
+	Order      *domain.Order   `json:"order,omitempty"`
+	OrderID    string          `json:"order_id,omitempty"`
+	Reason     string          `json:"reason,omitempty"`
+	Trade      *domain.Trade   `json:"trade,omitempty"`
+	Orders     []*domain.Order `json:"orders,omitempty"`
+	Halted     bool            `json:"halted,omitempty"`
+	RecordedAt time.Time       `json:"recorded_at"`
+}
+
+// storedOrder drops domain.Order's decimal-string encoding, so journaled
+// orders replay at full float precision
+type storedOrder domain.Order
+
+// journalPayload is everything in a record besides its key columns
+type journalPayload struct {
+	Order      *storedOrder   `json:"order,omitempty"`
+	OrderID    string         `json:"order_id,omitempty"`
+	Reason     string         `json:"reason,omitempty"`
+	Trade      *storedTrade   `json:"trade,omitempty"`
+	Orders     []*storedOrder `json:"orders,omitempty"`
+	Halted     bool           `json:"halted,omitempty"`
+	RecordedAt time.Time      `json:"recorded_at"`
+}
+
+type JournalRepository struct {
+	db *sql.DB
+}
+
+func NewJournalRepository(db *sql.DB) *JournalRepository {
+	return &JournalRepository{db: db}
+}
+
+// AppendJournal stores records in one transaction. A sequence that is
+// already taken fails the whole batch.
+func (r *JournalRepository) AppendJournal(ctx context.Context, records []*JournalRecord) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, record := range records {
+		payload := journalPayload{
+			OrderID:    record.OrderID,
+			Reason:     record.Reason,
+			Halted:     record.Halted,
+			RecordedAt: record.RecordedAt,
+		}
+		if record.Order != nil {
+			payload.Order = (*storedOrder)(record.Order)
+		}
+		if record.Trade != nil {
+			payload.Trade = (*storedTrade)(record.Trade)
+		}
+		for _, order := range record.Orders {
+			payload.Orders = append(payload.Orders, (*storedOrder)(order))
+		}
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode journal record %s/%d: %w", record.Symbol, record.Seq, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO journal (symbol, seq, kind, payload, recorded_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, record.Symbol, record.Seq, record.Kind, string(encoded), record.RecordedAt)
+		if err != nil {
+			return fmt.Errorf("failed to append journal record %s/%d: %w", record.Symbol, record.Seq, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ReadJournal streams a symbol's records from fromSeq on, in sequence order,
+// until fn returns an error
+func (r *JournalRepository) ReadJournal(ctx context.Context, symbol string, fromSeq uint64, fn func(*JournalRecord) error) error {
+	// A long journal can take a while to replay, so only the caller's
+	// context bounds the read
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT seq, kind, payload
+		FROM journal
+		WHERE symbol = $1 AND seq >= $2
+		ORDER BY seq ASC
+	`, symbol, fromSeq)
+	if err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record := &JournalRecord{Symbol: symbol}
+		var encoded string
+		if err := rows.Scan(&record.Seq, &record.Kind, &encoded); err != nil {
+			return fmt.Errorf("failed to scan journal record: %w", err)
+		}
+
+		var payload journalPayload
+		if err := json.Unmarshal([]byte(encoded), &payload); err != nil {
+			return fmt.Errorf("failed to decode journal record %s/%d: %w", symbol, record.Seq, err)
+		}
+		record.OrderID = payload.OrderID
+		record.Reason = payload.Reason
+		record.Halted = payload.Halted
+		record.RecordedAt = payload.RecordedAt
+		if payload.Order != nil {
+			record.Order = (*domain.Order)(payload.Order)
+		}
+		if payload.Trade != nil {
+			record.Trade = (*domain.Trade)(payload.Trade)
+		}
+		for _, order := range payload.Orders {
+			record.Orders = append(record.Orders, (*domain.Order)(order))
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// SnapshotSeqs lists the sequences of a symbol's snapshot records, oldest
+// first
+func (r *JournalRepository) SnapshotSeqs(ctx context.Context, symbol string) ([]uint64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT seq FROM journal WHERE symbol = $1 AND kind = 'snapshot' ORDER BY seq ASC
+	`, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list journal snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	seqs := make([]uint64, 0)
+	for rows.Next() {
+		var seq uint64
+		if err := rows.Scan(&seq); err != nil {
+			return nil, fmt.Errorf("failed to scan journal snapshot: %w", err)
+		}
+		seqs = append(seqs, seq)
+	}
+	return seqs, rows.Err()
+}
+
+// LastJournalSeq returns a symbol's highest sequence, or 0 if it has no
+// records
+func (r *JournalRepository) LastJournalSeq(ctx context.Context, symbol string) (uint64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var seq sql.NullInt64
+	if err := r.db.QueryRowContext(ctx, `SELECT MAX(seq) FROM journal WHERE symbol = $1`, symbol).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("failed to get last journal seq: %w", err)
+	}
+	return uint64(seq.Int64), nil
+}
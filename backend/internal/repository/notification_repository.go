@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NotificationSettings are a user's notification preferences
+type NotificationSettings struct {
+	UserID        string
+	Sink          string
+	Address       string
+	Events        []string
+	DigestMinutes int
+}
+
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// GetSettings returns a user's notification settings, or nil if they have
+// none
+func (r *NotificationRepository) GetSettings(ctx context.Context, userID string) (*NotificationSettings, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	settings := &NotificationSettings{UserID: userID}
+	var events string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT sink, address, events, digest_minutes
+		FROM notification_settings
+		WHERE user_id = $1
+	`, userID).Scan(&settings.Sink, &settings.Address, &events, &settings.DigestMinutes)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification settings: %w", err)
+	}
+
+	settings.Events = make([]string, 0)
+	if events != "" {
+		settings.Events = strings.Split(events, ",")
+	}
+	return settings, nil
+}
+
+func (r *NotificationRepository) SaveSettings(ctx context.Context, settings *NotificationSettings) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO notification_settings (user_id, sink, address, events, digest_minutes, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id)
+		DO UPDATE SET sink = $2, address = $3, events = $4, digest_minutes = $5, updated_at = $6
+	`
+	_, err := r.db.ExecContext(ctx, query, settings.UserID, settings.Sink, settings.Address,
+		strings.Join(settings.Events, ","), settings.DigestMinutes, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save notification settings: %w", err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hft-exchange/backend/internal/domain"
@@ -17,18 +18,19 @@ func NewOrderRepository(db *sql.DB) *OrderRepository {
 	return &OrderRepository{db: db}
 }
 
-func (r *OrderRepository) SaveOrder(order *domain.Order) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *OrderRepository) SaveOrder(ctx context.Context, order *domain.Order) error {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	
 	query := `
 		INSERT INTO orders (id, user_id, symbol, side, type, quantity, price, stop_price, 
-			filled_quantity, remaining_qty, status, time_in_force, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			filled_quantity, remaining_qty, status, time_in_force, created_at, updated_at, request_id, budget)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	`
 	_, err := r.db.ExecContext(ctx, query, order.ID, order.UserID, order.Symbol, string(order.Side), string(order.Type),
 		order.Quantity, order.Price, order.StopPrice, order.FilledQuantity, order.RemainingQty,
-		string(order.Status), order.TimeInForce, order.CreatedAt, order.UpdatedAt)
+		string(order.Status), order.TimeInForce, order.CreatedAt, order.UpdatedAt, sql.NullString{String: order.RequestID, Valid: order.RequestID != ""},
+		sql.NullFloat64{Float64: order.Budget, Valid: order.Budget > 0})
 	
 	if err != nil {
 		return fmt.Errorf("failed to save order: %w", err)
@@ -36,13 +38,16 @@ func (r *OrderRepository) SaveOrder(order *domain.Order) error {
 	return nil
 }
 
-func (r *OrderRepository) UpdateOrder(order *domain.Order) error {
+func (r *OrderRepository) UpdateOrder(ctx context.Context, order *domain.Order) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE orders 
 		SET filled_quantity = $1, remaining_qty = $2, status = $3, updated_at = $4
 		WHERE id = $5
 	`
-	_, err := r.db.Exec(query, order.FilledQuantity, order.RemainingQty, order.Status, 
+	_, err := r.db.ExecContext(ctx, query, order.FilledQuantity, order.RemainingQty, order.Status, 
 		order.UpdatedAt, order.ID)
 	
 	if err != nil {
@@ -51,22 +56,25 @@ func (r *OrderRepository) UpdateOrder(order *domain.Order) error {
 	return nil
 }
 
-func (r *OrderRepository) GetOrderByID(orderID string) (*domain.Order, error) {
+func (r *OrderRepository) GetOrderByID(ctx context.Context, orderID string) (*domain.Order, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT id, user_id, symbol, side, type, quantity, price, stop_price,
-			filled_quantity, remaining_qty, status, time_in_force, created_at, updated_at
+			filled_quantity, remaining_qty, status, time_in_force, created_at, updated_at, request_id, budget
 		FROM orders WHERE id = $1
 	`
 	
 	order := &domain.Order{}
-	var stopPrice sql.NullFloat64
-	var createdAt, updatedAt sql.NullString
+	var stopPrice, budget sql.NullFloat64
+	var createdAt, updatedAt, requestID sql.NullString
 	
-	err := r.db.QueryRow(query, orderID).Scan(
+	err := r.db.QueryRowContext(ctx, query, orderID).Scan(
 		&order.ID, &order.UserID, &order.Symbol, &order.Side, &order.Type,
 		&order.Quantity, &order.Price, &stopPrice, &order.FilledQuantity,
 		&order.RemainingQty, &order.Status, &order.TimeInForce,
-		&createdAt, &updatedAt,
+		&createdAt, &updatedAt, &requestID, &budget,
 	)
 	
 	if err != nil {
@@ -76,6 +84,8 @@ func (r *OrderRepository) GetOrderByID(orderID string) (*domain.Order, error) {
 	if stopPrice.Valid {
 		order.StopPrice = stopPrice.Float64
 	}
+	order.RequestID = requestID.String
+	order.Budget = budget.Float64
 	
 	// Parse timestamps
 	if createdAt.Valid {
@@ -96,19 +106,60 @@ func (r *OrderRepository) GetOrderByID(orderID string) (*domain.Order, error) {
 	return order, nil
 }
 
-func (r *OrderRepository) GetOrdersByUser(userID string, limit int) ([]*domain.Order, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// OrderFilter narrows GetOrdersByUser. Zero fields match everything.
+type OrderFilter struct {
+	Symbol   string
+	Side     string
+	Statuses []string
+	Start    time.Time // created at or after
+	End      time.Time // created before
+	Before   *Cursor   // continue after this row
+}
+
+// GetOrdersByUser returns a user's most recent orders matching filter, newest
+// first with ties broken by ID
+func (r *OrderRepository) GetOrdersByUser(ctx context.Context, userID string, limit int, filter OrderFilter) ([]*domain.Order, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	
+	args := []interface{}{userID}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{"user_id = $1"}
+	if filter.Symbol != "" {
+		where = append(where, "symbol = "+arg(filter.Symbol))
+	}
+	if filter.Side != "" {
+		where = append(where, "side = "+arg(filter.Side))
+	}
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			placeholders[i] = arg(status)
+		}
+		where = append(where, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if !filter.Start.IsZero() {
+		where = append(where, "created_at >= "+arg(filter.Start))
+	}
+	if !filter.End.IsZero() {
+		where = append(where, "created_at < "+arg(filter.End))
+	}
+	if filter.Before != nil {
+		where = append(where, "(created_at, id) < ("+arg(filter.Before.At)+", "+arg(filter.Before.ID)+")")
+	}
+
 	query := `
 		SELECT id, user_id, symbol, side, type, quantity, price, stop_price,
-			filled_quantity, remaining_qty, status, time_in_force, created_at, updated_at
-		FROM orders WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2
-	`
+			filled_quantity, remaining_qty, status, time_in_force, created_at, updated_at, request_id
+		FROM orders WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + arg(limit)
 	
-	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user orders: %w", err)
 	}
@@ -118,13 +169,13 @@ func (r *OrderRepository) GetOrdersByUser(userID string, limit int) ([]*domain.O
 	for rows.Next() {
 		order := &domain.Order{}
 		var stopPrice sql.NullFloat64
-		var createdAt, updatedAt sql.NullString
+		var createdAt, updatedAt, requestID sql.NullString
 		
 		err := rows.Scan(
 			&order.ID, &order.UserID, &order.Symbol, &order.Side, &order.Type,
 			&order.Quantity, &order.Price, &stopPrice, &order.FilledQuantity,
 			&order.RemainingQty, &order.Status, &order.TimeInForce,
-			&createdAt, &updatedAt,
+			&createdAt, &updatedAt, &requestID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan order: %w", err)
@@ -133,22 +184,10 @@ func (r *OrderRepository) GetOrdersByUser(userID string, limit int) ([]*domain.O
 		if stopPrice.Valid {
 			order.StopPrice = stopPrice.Float64
 		}
+		order.RequestID = requestID.String
 		
-		// Parse timestamps
-		if createdAt.Valid {
-			if t, err := time.Parse("2006-01-02 15:04:05", createdAt.String); err == nil {
-				order.CreatedAt = t
-			} else if t, err := time.Parse(time.RFC3339, createdAt.String); err == nil {
-				order.CreatedAt = t
-			}
-		}
-		if updatedAt.Valid {
-			if t, err := time.Parse("2006-01-02 15:04:05", updatedAt.String); err == nil {
-				order.UpdatedAt = t
-			} else if t, err := time.Parse(time.RFC3339, updatedAt.String); err == nil {
-				order.UpdatedAt = t
-			}
-		}
+		order.CreatedAt = parseTimestamp(createdAt)
+		order.UpdatedAt = parseTimestamp(updatedAt)
 		
 		orders = append(orders, order)
 	}
@@ -156,16 +195,19 @@ func (r *OrderRepository) GetOrdersByUser(userID string, limit int) ([]*domain.O
 	return orders, nil
 }
 
-func (r *OrderRepository) GetOpenOrders(symbol string) ([]*domain.Order, error) {
+func (r *OrderRepository) GetOpenOrders(ctx context.Context, symbol string) ([]*domain.Order, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT id, user_id, symbol, side, type, quantity, price, stop_price,
-			filled_quantity, remaining_qty, status, time_in_force, created_at, updated_at
+			filled_quantity, remaining_qty, status, time_in_force, created_at, updated_at, request_id, budget
 		FROM orders 
 		WHERE symbol = $1 AND status IN ('PENDING', 'PARTIAL')
 		ORDER BY created_at ASC
 	`
 	
-	rows, err := r.db.Query(query, symbol)
+	rows, err := r.db.QueryContext(ctx, query, symbol)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get open orders: %w", err)
 	}
@@ -174,14 +216,14 @@ func (r *OrderRepository) GetOpenOrders(symbol string) ([]*domain.Order, error)
 	orders := make([]*domain.Order, 0)
 	for rows.Next() {
 		order := &domain.Order{}
-		var stopPrice sql.NullFloat64
-		var createdAt, updatedAt sql.NullString
+		var stopPrice, budget sql.NullFloat64
+		var createdAt, updatedAt, requestID sql.NullString
 		
 		err := rows.Scan(
 			&order.ID, &order.UserID, &order.Symbol, &order.Side, &order.Type,
 			&order.Quantity, &order.Price, &stopPrice, &order.FilledQuantity,
 			&order.RemainingQty, &order.Status, &order.TimeInForce,
-			&createdAt, &updatedAt,
+			&createdAt, &updatedAt, &requestID, &budget,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan order: %w", err)
@@ -190,6 +232,8 @@ func (r *OrderRepository) GetOpenOrders(symbol string) ([]*domain.Order, error)
 		if stopPrice.Valid {
 			order.StopPrice = stopPrice.Float64
 		}
+		order.RequestID = requestID.String
+		order.Budget = budget.Float64
 		
 		// Parse timestamps
 		if createdAt.Valid {
@@ -212,3 +256,117 @@ func (r *OrderRepository) GetOpenOrders(symbol string) ([]*domain.Order, error)
 	
 	return orders, nil
 }
+
+// GetUserOpenOrders returns a user's pending and partially filled orders on
+// every symbol, oldest first
+func (r *OrderRepository) GetUserOpenOrders(ctx context.Context, userID string) ([]*domain.Order, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, symbol, side, type, quantity, price, stop_price,
+			filled_quantity, remaining_qty, status, time_in_force, created_at, updated_at, request_id
+		FROM orders
+		WHERE user_id = $1 AND status IN ('PENDING', 'PARTIAL')
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user open orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := make([]*domain.Order, 0)
+	for rows.Next() {
+		order := &domain.Order{}
+		var stopPrice sql.NullFloat64
+		var createdAt, updatedAt, requestID sql.NullString
+
+		err := rows.Scan(
+			&order.ID, &order.UserID, &order.Symbol, &order.Side, &order.Type,
+			&order.Quantity, &order.Price, &stopPrice, &order.FilledQuantity,
+			&order.RemainingQty, &order.Status, &order.TimeInForce,
+			&createdAt, &updatedAt, &requestID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		if stopPrice.Valid {
+			order.StopPrice = stopPrice.Float64
+		}
+		order.RequestID = requestID.String
+		order.CreatedAt = parseTimestamp(createdAt)
+		order.UpdatedAt = parseTimestamp(updatedAt)
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+// StreamOrderHistory walks every order for a symbol created in [from, to],
+// oldest first, handing each row to fn without buffering the result set.
+func (r *OrderRepository) StreamOrderHistory(ctx context.Context, symbol string, from, to time.Time, fn func(*domain.Order) error) error {
+	query := `
+		SELECT id, user_id, symbol, side, type, quantity, price, stop_price,
+			filled_quantity, remaining_qty, status, time_in_force, created_at, updated_at
+		FROM orders
+		WHERE symbol = $1 AND created_at >= $2 AND created_at <= $3
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, symbol, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to stream order history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		order := &domain.Order{}
+		var stopPrice sql.NullFloat64
+		var createdAt, updatedAt sql.NullString
+
+		err := rows.Scan(
+			&order.ID, &order.UserID, &order.Symbol, &order.Side, &order.Type,
+			&order.Quantity, &order.Price, &stopPrice, &order.FilledQuantity,
+			&order.RemainingQty, &order.Status, &order.TimeInForce,
+			&createdAt, &updatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan order: %w", err)
+		}
+
+		if stopPrice.Valid {
+			order.StopPrice = stopPrice.Float64
+		}
+		order.CreatedAt = parseTimestamp(createdAt)
+		order.UpdatedAt = parseTimestamp(updatedAt)
+
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// parseTimestamp accepts both the SQLite and PostgreSQL timestamp layouts
+func parseTimestamp(value sql.NullString) time.Time {
+	if !value.Valid {
+		return time.Time{}
+	}
+	if t, err := time.Parse("2006-01-02 15:04:05", value.String); err == nil {
+		return t
+	}
+	if t, err := time.Parse(time.RFC3339, value.String); err == nil {
+		return t
+	}
+	if t, err := time.Parse("2006-01-02 15:04:05.999999999-07:00", value.String); err == nil {
+		return t
+	}
+	// The SQLite driver writes time.Time.String(), monotonic reading and all
+	text, _, _ := strings.Cut(value.String, " m=")
+	if t, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", text); err == nil {
+		return t
+	}
+	return time.Time{}
+}
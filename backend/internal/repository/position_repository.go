@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+type PositionRepository struct {
+	db *sql.DB
+}
+
+func NewPositionRepository(db *sql.DB) *PositionRepository {
+	return &PositionRepository{db: db}
+}
+
+// PositionFill is a signed change to a user's position in a symbol at a
+// price: positive for buys, negative for sells
+type PositionFill struct {
+	UserID   string
+	Symbol   string
+	Quantity float64
+	Price    float64
+}
+
+func (r *PositionRepository) GetUserPositions(ctx context.Context, userID string) ([]*domain.Position, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT user_id, symbol, quantity, avg_entry_price, realized_pnl, updated_at
+		FROM positions
+		WHERE user_id = $1
+		ORDER BY symbol
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get positions: %w", err)
+	}
+	defer rows.Close()
+
+	positions := make([]*domain.Position, 0)
+	for rows.Next() {
+		position := &domain.Position{}
+		var updatedAt sql.NullString
+		if err := rows.Scan(
+			&position.UserID, &position.Symbol, &position.Quantity,
+			&position.AvgEntryPrice, &position.RealizedPnL, &updatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan position: %w", err)
+		}
+		position.UpdatedAt = parseTimestamp(updatedAt)
+		positions = append(positions, position)
+	}
+
+	return positions, rows.Err()
+}
+
+// applyPositionFill folds a fill into the stored position inside tx. The
+// exchange settles trades one at a time, retries included, so the
+// read-modify-write cannot race with another settlement of the same row.
+func applyPositionFill(ctx context.Context, tx *sql.Tx, fill PositionFill, now time.Time) (*domain.Position, error) {
+	position := &domain.Position{UserID: fill.UserID, Symbol: fill.Symbol}
+
+	err := tx.QueryRowContext(ctx, `
+		SELECT quantity, avg_entry_price, realized_pnl
+		FROM positions
+		WHERE user_id = $1 AND symbol = $2
+	`, fill.UserID, fill.Symbol).Scan(&position.Quantity, &position.AvgEntryPrice, &position.RealizedPnL)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to read position %s/%s: %w", fill.UserID, fill.Symbol, err)
+	}
+
+	position.ApplyFill(fill.Quantity, fill.Price)
+	position.UpdatedAt = now
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO positions (user_id, symbol, quantity, avg_entry_price, realized_pnl, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, symbol)
+		DO UPDATE SET quantity = $3, avg_entry_price = $4, realized_pnl = $5, updated_at = $6
+	`, position.UserID, position.Symbol, position.Quantity, position.AvgEntryPrice, position.RealizedPnL, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write position %s/%s: %w", fill.UserID, fill.Symbol, err)
+	}
+
+	return position, nil
+}
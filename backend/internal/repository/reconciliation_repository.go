@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AssetTotal is every user's balance of an asset summed, next to the sum of
+// the asset's ledger entries
+type AssetTotal struct {
+	Asset     string
+	Available float64
+	Locked    float64
+	Ledger    float64
+}
+
+// BalanceSnapshot is one asset's totals at one reconciliation
+type BalanceSnapshot struct {
+	TakenAt   time.Time
+	Asset     string
+	Available float64
+	Locked    float64
+	Expected  float64
+	Drift     float64
+}
+
+type ReconciliationRepository struct {
+	db *sql.DB
+}
+
+func NewReconciliationRepository(db *sql.DB) *ReconciliationRepository {
+	return &ReconciliationRepository{db: db}
+}
+
+// AssetTotals sums balances and the ledger per asset. It is a single
+// statement, so an adjustment can't land between the two sums.
+func (r *ReconciliationRepository) AssetTotals(ctx context.Context) ([]*AssetTotal, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT asset, SUM(available), SUM(locked), SUM(ledger)
+		FROM (
+			SELECT asset, available, locked, 0 AS ledger FROM balances
+			UNION ALL
+			SELECT asset, 0, 0, delta FROM balance_ledger
+		) totals
+		GROUP BY asset
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum balances: %w", err)
+	}
+	defer rows.Close()
+
+	totals := make([]*AssetTotal, 0)
+	for rows.Next() {
+		total := &AssetTotal{}
+		if err := rows.Scan(&total.Asset, &total.Available, &total.Locked, &total.Ledger); err != nil {
+			return nil, fmt.Errorf("failed to scan balance totals: %w", err)
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+// SaveBalanceSnapshot stores one reconciliation's totals, a row per asset
+func (r *ReconciliationRepository) SaveBalanceSnapshot(ctx context.Context, snapshots []*BalanceSnapshot) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, snapshot := range snapshots {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO balance_snapshots (taken_at, asset, available, locked, expected, drift)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, snapshot.TakenAt, snapshot.Asset, snapshot.Available, snapshot.Locked, snapshot.Expected, snapshot.Drift)
+		if err != nil {
+			return fmt.Errorf("failed to save balance snapshot for %s: %w", snapshot.Asset, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RiskProfile is a user's own set of risk limits
+type RiskProfile struct {
+	UserID           string
+	MaxOpenOrders    int
+	MaxPosition      float64
+	MaxDailyOrders   int
+	MaxOrderNotional float64
+	MaxOpenNotional  float64
+}
+
+type RiskProfileRepository struct {
+	db *sql.DB
+}
+
+func NewRiskProfileRepository(db *sql.DB) *RiskProfileRepository {
+	return &RiskProfileRepository{db: db}
+}
+
+func (r *RiskProfileRepository) GetRiskProfiles(ctx context.Context) ([]*RiskProfile, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT user_id, max_open_orders, max_position, max_daily_orders, max_order_notional, max_open_notional
+		FROM risk_profiles
+		ORDER BY user_id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get risk profiles: %w", err)
+	}
+	defer rows.Close()
+
+	profiles := make([]*RiskProfile, 0)
+	for rows.Next() {
+		p := &RiskProfile{}
+		if err := rows.Scan(&p.UserID, &p.MaxOpenOrders, &p.MaxPosition, &p.MaxDailyOrders,
+			&p.MaxOrderNotional, &p.MaxOpenNotional); err != nil {
+			return nil, fmt.Errorf("failed to scan risk profile: %w", err)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+func (r *RiskProfileRepository) SaveRiskProfile(ctx context.Context, p *RiskProfile) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO risk_profiles (user_id, max_open_orders, max_position, max_daily_orders,
+			max_order_notional, max_open_notional, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id)
+		DO UPDATE SET max_open_orders = $2, max_position = $3, max_daily_orders = $4,
+			max_order_notional = $5, max_open_notional = $6, updated_at = $7
+	`
+	_, err := r.db.ExecContext(ctx, query, p.UserID, p.MaxOpenOrders, p.MaxPosition, p.MaxDailyOrders,
+		p.MaxOrderNotional, p.MaxOpenNotional, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save risk profile: %w", err)
+	}
+	return nil
+}
+
+func (r *RiskProfileRepository) DeleteRiskProfile(ctx context.Context, userID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM risk_profiles WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete risk profile: %w", err)
+	}
+	return nil
+}
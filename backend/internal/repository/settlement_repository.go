@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// PendingSettlement is a trade whose persistence or settlement is being
+// retried
+type PendingSettlement struct {
+	Trade         *domain.Trade
+	Saved         bool
+	Attempts      int
+	LastError     string
+	FirstFailedAt time.Time
+}
+
+// storedTrade drops domain.Trade's decimal-string encoding, so stored
+// trades keep full float precision
+type storedTrade domain.Trade
+
+type SettlementRepository struct {
+	db *sql.DB
+}
+
+func NewSettlementRepository(db *sql.DB) *SettlementRepository {
+	return &SettlementRepository{db: db}
+}
+
+// SavePendingSettlement stores or updates a pending settlement
+func (r *SettlementRepository) SavePendingSettlement(ctx context.Context, pending *PendingSettlement) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	trade, err := json.Marshal(storedTrade(*pending.Trade))
+	if err != nil {
+		return fmt.Errorf("failed to encode pending trade: %w", err)
+	}
+
+	query := `
+		INSERT INTO pending_settlements (trade_id, trade, saved, attempts, last_error, first_failed_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (trade_id)
+		DO UPDATE SET saved = $3, attempts = $4, last_error = $5, updated_at = $7
+	`
+	_, err = r.db.ExecContext(ctx, query, pending.Trade.ID, string(trade), pending.Saved, pending.Attempts,
+		pending.LastError, pending.FirstFailedAt, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save pending settlement: %w", err)
+	}
+	return nil
+}
+
+func (r *SettlementRepository) DeletePendingSettlement(ctx context.Context, tradeID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM pending_settlements WHERE trade_id = $1`, tradeID); err != nil {
+		return fmt.Errorf("failed to delete pending settlement: %w", err)
+	}
+	return nil
+}
+
+// GetPendingSettlements returns every pending settlement, oldest first
+func (r *SettlementRepository) GetPendingSettlements(ctx context.Context) ([]*PendingSettlement, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT trade, saved, attempts, last_error, first_failed_at
+		FROM pending_settlements
+		ORDER BY first_failed_at ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending settlements: %w", err)
+	}
+	defer rows.Close()
+
+	pending := make([]*PendingSettlement, 0)
+	for rows.Next() {
+		var encoded string
+		var firstFailedAt sql.NullString
+		p := &PendingSettlement{}
+		if err := rows.Scan(&encoded, &p.Saved, &p.Attempts, &p.LastError, &firstFailedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pending settlement: %w", err)
+		}
+
+		var trade storedTrade
+		if err := json.Unmarshal([]byte(encoded), &trade); err != nil {
+			return nil, fmt.Errorf("failed to decode pending trade: %w", err)
+		}
+		p.Trade = (*domain.Trade)(&trade)
+		p.FirstFailedAt = parseTimestamp(firstFailedAt)
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+type SymbolRepository struct {
+	db *sql.DB
+}
+
+func NewSymbolRepository(db *sql.DB) *SymbolRepository {
+	return &SymbolRepository{db: db}
+}
+
+func (r *SymbolRepository) GetAllSymbols(ctx context.Context) ([]domain.SymbolConfig, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT symbol, base_asset, quote_asset, tick_size, lot_size, min_notional,
+			maker_fee_bps, taker_fee_bps, price_band_pct
+		FROM symbols
+		ORDER BY symbol
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get symbols: %w", err)
+	}
+	defer rows.Close()
+
+	configs := make([]domain.SymbolConfig, 0)
+	for rows.Next() {
+		var config domain.SymbolConfig
+		err := rows.Scan(
+			&config.Symbol, &config.BaseAsset, &config.QuoteAsset, &config.TickSize, &config.LotSize,
+			&config.MinNotional, &config.MakerFeeBps, &config.TakerFeeBps, &config.PriceBandPct,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan symbol: %w", err)
+		}
+		configs = append(configs, config)
+	}
+
+	return configs, rows.Err()
+}
+
+// SaveSymbol inserts or replaces a symbol's config
+func (r *SymbolRepository) SaveSymbol(ctx context.Context, config domain.SymbolConfig) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO symbols (symbol, base_asset, quote_asset, tick_size, lot_size, min_notional,
+			maker_fee_bps, taker_fee_bps, price_band_pct)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (symbol) DO UPDATE SET
+			base_asset = $2, quote_asset = $3, tick_size = $4, lot_size = $5, min_notional = $6,
+			maker_fee_bps = $7, taker_fee_bps = $8, price_band_pct = $9
+	`
+
+	_, err := r.db.ExecContext(ctx, query, config.Symbol, config.BaseAsset, config.QuoteAsset, config.TickSize,
+		config.LotSize, config.MinNotional, config.MakerFeeBps, config.TakerFeeBps, config.PriceBandPct)
+	if err != nil {
+		return fmt.Errorf("failed to save symbol: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SymbolRepository) DeleteSymbol(ctx context.Context, symbol string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM symbols WHERE symbol = $1`, symbol); err != nil {
+		return fmt.Errorf("failed to delete symbol: %w", err)
+	}
+	return nil
+}
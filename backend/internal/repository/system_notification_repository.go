@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// SystemNotificationRepository keeps the latest notifications sent to every
+// client, for those that connect later
+type SystemNotificationRepository struct {
+	db *sql.DB
+}
+
+func NewSystemNotificationRepository(db *sql.DB) *SystemNotificationRepository {
+	return &SystemNotificationRepository{db: db}
+}
+
+// SaveNotification stores a notification and deletes all but the newest
+// keep
+func (r *SystemNotificationRepository) SaveNotification(ctx context.Context, notification *domain.Notification, keep int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO system_notifications (id, symbol, category, severity, message, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, notification.ID, notification.Symbol, string(notification.Category), string(notification.Severity),
+		notification.Message, notification.Timestamp.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save notification: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		DELETE FROM system_notifications
+		WHERE id NOT IN (SELECT id FROM system_notifications ORDER BY created_at DESC LIMIT $1)
+	`, keep)
+	if err != nil {
+		return fmt.Errorf("failed to trim notifications: %w", err)
+	}
+	return nil
+}
+
+// GetRecentNotifications returns up to limit notifications, newest first
+func (r *SystemNotificationRepository) GetRecentNotifications(ctx context.Context, limit int) ([]*domain.Notification, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, symbol, category, severity, message, created_at
+		FROM system_notifications
+		ORDER BY created_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := make([]*domain.Notification, 0)
+	for rows.Next() {
+		notification := &domain.Notification{}
+		var category, severity string
+		var createdAt sql.NullString
+		if err := rows.Scan(&notification.ID, &notification.Symbol, &category, &severity, &notification.Message, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notification.Category = domain.NotificationCategory(category)
+		notification.Severity = domain.NotificationSeverity(severity)
+		notification.Timestamp = parseTimestamp(createdAt)
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
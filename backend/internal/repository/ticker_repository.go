@@ -17,7 +17,10 @@ func NewTickerRepository(db *sql.DB) *TickerRepository {
 	return &TickerRepository{db: db}
 }
 
-func (r *TickerRepository) GetTicker(symbol string) (*domain.Ticker, error) {
+func (r *TickerRepository) GetTicker(ctx context.Context, symbol string) (*domain.Ticker, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT symbol, price, high_24h, low_24h, volume_24h, change_24h, updated_at
 		FROM tickers
@@ -26,7 +29,7 @@ func (r *TickerRepository) GetTicker(symbol string) (*domain.Ticker, error) {
 	
 	ticker := &domain.Ticker{}
 	var updatedAt sql.NullString
-	err := r.db.QueryRow(query, symbol).Scan(
+	err := r.db.QueryRowContext(ctx, query, symbol).Scan(
 		&ticker.Symbol, &ticker.Price, &ticker.High24h, &ticker.Low24h,
 		&ticker.Volume24h, &ticker.Change24h, &updatedAt,
 	)
@@ -47,8 +50,8 @@ func (r *TickerRepository) GetTicker(symbol string) (*domain.Ticker, error) {
 	return ticker, nil
 }
 
-func (r *TickerRepository) GetAllTickers() ([]*domain.Ticker, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *TickerRepository) GetAllTickers(ctx context.Context) ([]*domain.Ticker, error) {
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	
 	query := `
@@ -89,16 +92,19 @@ func (r *TickerRepository) GetAllTickers() ([]*domain.Ticker, error) {
 	return tickers, nil
 }
 
-func (r *TickerRepository) UpdateTicker(ticker *domain.Ticker) error {
+// UpdateTicker stores a new price. The 24h statistics are left to
+// UpdateStats.
+func (r *TickerRepository) UpdateTicker(ctx context.Context, ticker *domain.Ticker) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE tickers
-		SET price = $1, high_24h = $2, low_24h = $3, volume_24h = $4, 
-		    change_24h = $5, updated_at = $6
-		WHERE symbol = $7
+		SET price = $1, updated_at = $2
+		WHERE symbol = $3
 	`
 	
-	_, err := r.db.Exec(query, ticker.Price, ticker.High24h, ticker.Low24h,
-		ticker.Volume24h, ticker.Change24h, ticker.UpdatedAt, ticker.Symbol)
+	_, err := r.db.ExecContext(ctx, query, ticker.Price, ticker.UpdatedAt, ticker.Symbol)
 	
 	if err != nil {
 		return fmt.Errorf("failed to update ticker: %w", err)
@@ -106,3 +112,41 @@ func (r *TickerRepository) UpdateTicker(ticker *domain.Ticker) error {
 	
 	return nil
 }
+
+// UpdateStats sets a ticker's rolling 24h volume, price range and change
+func (r *TickerRepository) UpdateStats(ctx context.Context, symbol string, volume, high, low, change float64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE tickers
+		SET volume_24h = $1, high_24h = $2, low_24h = $3, change_24h = $4
+		WHERE symbol = $5
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, volume, high, low, change, symbol); err != nil {
+		return fmt.Errorf("failed to update ticker stats: %w", err)
+	}
+	return nil
+}
+
+// CreateTicker inserts a ticker row for a newly listed symbol, leaving an
+// existing row untouched
+func (r *TickerRepository) CreateTicker(ctx context.Context, ticker *domain.Ticker) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO tickers (symbol, price, high_24h, low_24h, volume_24h, change_24h, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (symbol) DO NOTHING
+	`
+
+	_, err := r.db.ExecContext(ctx, query, ticker.Symbol, ticker.Price, ticker.High24h, ticker.Low24h,
+		ticker.Volume24h, ticker.Change24h, ticker.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create ticker: %w", err)
+	}
+
+	return nil
+}
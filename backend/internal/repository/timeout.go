@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// queryTimeout bounds every query whose caller set no deadline of its own
+var queryTimeout = 10 * time.Second
+
+// SetQueryTimeout changes the default query timeout. Zero or less leaves
+// queries bounded only by their caller's context.
+func SetQueryTimeout(timeout time.Duration) {
+	queryTimeout = timeout
+}
+
+// withTimeout gives ctx the default query timeout, unless the caller already
+// chose a deadline
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, queryTimeout)
+}
@@ -1,8 +1,10 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hft-exchange/backend/internal/domain"
@@ -16,33 +18,72 @@ func NewTradeRepository(db *sql.DB) *TradeRepository {
 	return &TradeRepository{db: db}
 }
 
-func (r *TradeRepository) SaveTrade(trade *domain.Trade) error {
+// SaveTrade inserts a trade unless it is already stored, under its ID or as
+// the same taker/maker fill, and reports whether it was new. Retried saves
+// are therefore harmless, and callers skip settling duplicates.
+func (r *TradeRepository) SaveTrade(ctx context.Context, trade *domain.Trade) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO trades (id, symbol, buy_order_id, sell_order_id, buyer_id, seller_id, 
 			price, quantity, maker_order_id, taker_order_id, executed_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT DO NOTHING
 	`
-	_, err := r.db.Exec(query, trade.ID, trade.Symbol, trade.BuyOrderID, trade.SellOrderID,
+	result, err := r.db.ExecContext(ctx, query, trade.ID, trade.Symbol, trade.BuyOrderID, trade.SellOrderID,
 		trade.BuyerID, trade.SellerID, trade.Price, trade.Quantity, 
 		trade.MakerOrderID, trade.TakerOrderID, trade.ExecutedAt)
 	
 	if err != nil {
-		return fmt.Errorf("failed to save trade: %w", err)
+		return false, fmt.Errorf("failed to save trade: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to save trade: %w", err)
 	}
-	return nil
+	return inserted > 0, nil
 }
 
-func (r *TradeRepository) GetRecentTrades(symbol string, limit int) ([]*domain.Trade, error) {
+// TradeFilter narrows a symbol's recent trades. Zero fields don't filter.
+type TradeFilter struct {
+	// After and Before bound when the trades executed, exclusive
+	After  time.Time
+	Before time.Time
+	// Cursor continues after the last trade of a previous page
+	Cursor *Cursor
+}
+
+// GetRecentTrades returns a symbol's trades matching filter, newest first
+func (r *TradeRepository) GetRecentTrades(ctx context.Context, symbol string, limit int, filter TradeFilter) ([]*domain.Trade, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	args := []interface{}{symbol}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{"symbol = $1"}
+	if !filter.After.IsZero() {
+		where = append(where, "executed_at > "+arg(filter.After))
+	}
+	if !filter.Before.IsZero() {
+		where = append(where, "executed_at < "+arg(filter.Before))
+	}
+	if filter.Cursor != nil {
+		where = append(where, "(executed_at, id) < ("+arg(filter.Cursor.At)+", "+arg(filter.Cursor.ID)+")")
+	}
+
 	query := `
 		SELECT id, symbol, buy_order_id, sell_order_id, buyer_id, seller_id,
 			price, quantity, maker_order_id, taker_order_id, executed_at
-		FROM trades 
-		WHERE symbol = $1
-		ORDER BY executed_at DESC
-		LIMIT $2
-	`
-	
-	rows, err := r.db.Query(query, symbol, limit)
+		FROM trades WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY executed_at DESC, id DESC
+		LIMIT ` + arg(limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recent trades: %w", err)
 	}
@@ -61,14 +102,7 @@ func (r *TradeRepository) GetRecentTrades(symbol string, limit int) ([]*domain.T
 			return nil, fmt.Errorf("failed to scan trade: %w", err)
 		}
 		
-		// Parse timestamp
-		if executedAt.Valid {
-			if t, err := time.Parse("2006-01-02 15:04:05", executedAt.String); err == nil {
-				trade.ExecutedAt = t
-			} else if t, err := time.Parse(time.RFC3339, executedAt.String); err == nil {
-				trade.ExecutedAt = t
-			}
-		}
+		trade.ExecutedAt = parseTimestamp(executedAt)
 		
 		trades = append(trades, trade)
 	}
@@ -76,17 +110,37 @@ func (r *TradeRepository) GetRecentTrades(symbol string, limit int) ([]*domain.T
 	return trades, nil
 }
 
-func (r *TradeRepository) GetUserTrades(userID string, limit int) ([]*domain.Trade, error) {
+// GetUserTrades returns a user's most recent trades on either side, optionally
+// limited to one symbol and continuing after before
+func (r *TradeRepository) GetUserTrades(ctx context.Context, userID string, limit int, symbol string, before *Cursor) ([]*domain.Trade, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT id, symbol, buy_order_id, sell_order_id, buyer_id, seller_id,
 			price, quantity, maker_order_id, taker_order_id, executed_at
 		FROM trades 
-		WHERE buyer_id = $1 OR seller_id = $1
-		ORDER BY executed_at DESC
+		WHERE (buyer_id = $1 OR seller_id = $1)
+			AND ($3 = '' OR symbol = $3)
+		ORDER BY executed_at DESC, id DESC
 		LIMIT $2
 	`
+	args := []interface{}{userID, limit, symbol}
+	if before != nil {
+		query = `
+			SELECT id, symbol, buy_order_id, sell_order_id, buyer_id, seller_id,
+				price, quantity, maker_order_id, taker_order_id, executed_at
+			FROM trades 
+			WHERE (buyer_id = $1 OR seller_id = $1)
+				AND ($3 = '' OR symbol = $3)
+				AND (executed_at, id) < ($4, $5)
+			ORDER BY executed_at DESC, id DESC
+			LIMIT $2
+		`
+		args = append(args, before.At, before.ID)
+	}
 	
-	rows, err := r.db.Query(query, userID, limit)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user trades: %w", err)
 	}
@@ -105,17 +159,172 @@ func (r *TradeRepository) GetUserTrades(userID string, limit int) ([]*domain.Tra
 			return nil, fmt.Errorf("failed to scan trade: %w", err)
 		}
 		
-		// Parse timestamp
-		if executedAt.Valid {
-			if t, err := time.Parse("2006-01-02 15:04:05", executedAt.String); err == nil {
-				trade.ExecutedAt = t
-			} else if t, err := time.Parse(time.RFC3339, executedAt.String); err == nil {
-				trade.ExecutedAt = t
-			}
-		}
+		trade.ExecutedAt = parseTimestamp(executedAt)
 		
 		trades = append(trades, trade)
 	}
 	
 	return trades, nil
 }
+
+// GetUserTradesBefore returns every trade a user made on either side before
+// a time, oldest first
+func (r *TradeRepository) GetUserTradesBefore(ctx context.Context, userID string, before time.Time) ([]*domain.Trade, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, symbol, buy_order_id, sell_order_id, buyer_id, seller_id,
+			price, quantity, maker_order_id, taker_order_id, executed_at
+		FROM trades
+		WHERE (buyer_id = $1 OR seller_id = $1) AND executed_at < $2
+		ORDER BY executed_at, id
+	`, userID, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user trades: %w", err)
+	}
+	defer rows.Close()
+
+	trades := make([]*domain.Trade, 0)
+	for rows.Next() {
+		trade := &domain.Trade{}
+		var executedAt sql.NullString
+		err := rows.Scan(
+			&trade.ID, &trade.Symbol, &trade.BuyOrderID, &trade.SellOrderID,
+			&trade.BuyerID, &trade.SellerID, &trade.Price, &trade.Quantity,
+			&trade.MakerOrderID, &trade.TakerOrderID, &executedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trade: %w", err)
+		}
+		trade.ExecutedAt = parseTimestamp(executedAt)
+		trades = append(trades, trade)
+	}
+	return trades, rows.Err()
+}
+
+// GetTradesByOrderID returns every trade an order took part in on either
+// side, oldest first
+func (r *TradeRepository) GetTradesByOrderID(ctx context.Context, orderID string) ([]*domain.Trade, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, symbol, buy_order_id, sell_order_id, buyer_id, seller_id,
+			price, quantity, maker_order_id, taker_order_id, executed_at
+		FROM trades
+		WHERE buy_order_id = $1 OR sell_order_id = $1
+		ORDER BY executed_at, id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order trades: %w", err)
+	}
+	defer rows.Close()
+
+	trades := make([]*domain.Trade, 0)
+	for rows.Next() {
+		trade := &domain.Trade{}
+		var executedAt sql.NullString
+		err := rows.Scan(
+			&trade.ID, &trade.Symbol, &trade.BuyOrderID, &trade.SellOrderID,
+			&trade.BuyerID, &trade.SellerID, &trade.Price, &trade.Quantity,
+			&trade.MakerOrderID, &trade.TakerOrderID, &executedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trade: %w", err)
+		}
+		trade.ExecutedAt = parseTimestamp(executedAt)
+		trades = append(trades, trade)
+	}
+	return trades, rows.Err()
+}
+
+// GetOpenOrderFills sums the trades of each of a symbol's pending and
+// partially filled orders that has traded, keyed by order ID
+func (r *TradeRepository) GetOpenOrderFills(ctx context.Context, symbol string) (map[string]domain.OrderFills, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT order_id, SUM(quantity), SUM(price * quantity)
+		FROM (
+			SELECT o.id AS order_id, t.quantity, t.price
+			FROM orders o JOIN trades t ON t.buy_order_id = o.id
+			WHERE t.symbol = $1 AND o.status IN ('PENDING', 'PARTIAL')
+			UNION ALL
+			SELECT o.id AS order_id, t.quantity, t.price
+			FROM orders o JOIN trades t ON t.sell_order_id = o.id
+			WHERE t.symbol = $1 AND o.status IN ('PENDING', 'PARTIAL')
+		) fills
+		GROUP BY order_id
+	`, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open order fills: %w", err)
+	}
+	defer rows.Close()
+
+	fills := make(map[string]domain.OrderFills)
+	for rows.Next() {
+		var orderID string
+		var filled domain.OrderFills
+		if err := rows.Scan(&orderID, &filled.Quantity, &filled.Notional); err != nil {
+			return nil, fmt.Errorf("failed to scan order fills: %w", err)
+		}
+		fills[orderID] = filled
+	}
+	return fills, rows.Err()
+}
+
+// CountTradesSince counts a symbol's trades executed at or after since
+func (r *TradeRepository) CountTradesSince(ctx context.Context, symbol string, since time.Time) (int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM trades WHERE symbol = $1 AND executed_at >= $2
+	`, symbol, since.Local()).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count trades: %w", err)
+	}
+	return count, nil
+}
+
+// TradeStats totals a symbol's trades over a time range
+type TradeStats struct {
+	Volume float64
+	Open   float64 // price of the first trade
+	High   float64
+	Low    float64
+	Close  float64 // price of the last trade
+}
+
+// GetTradeStats sums the quantity and finds the prices of a symbol's trades
+// executed in [from, to). All fields are 0 when there were none.
+func (r *TradeRepository) GetTradeStats(ctx context.Context, symbol string, from, to time.Time) (*TradeStats, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var volume, open, high, low, close sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT SUM(quantity), MAX(price), MIN(price),
+		       (SELECT price FROM trades
+		        WHERE symbol = $1 AND executed_at >= $2 AND executed_at < $3
+		        ORDER BY executed_at ASC, id ASC LIMIT 1),
+		       (SELECT price FROM trades
+		        WHERE symbol = $1 AND executed_at >= $2 AND executed_at < $3
+		        ORDER BY executed_at DESC, id DESC LIMIT 1)
+		FROM trades
+		WHERE symbol = $1 AND executed_at >= $2 AND executed_at < $3
+	`, symbol, from.Local(), to.Local()).Scan(&volume, &high, &low, &open, &close)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trade stats: %w", err)
+	}
+	return &TradeStats{
+		Volume: volume.Float64,
+		Open:   open.Float64,
+		High:   high.Float64,
+		Low:    low.Float64,
+		Close:  close.Float64,
+	}, nil
+}
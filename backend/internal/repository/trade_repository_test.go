@@ -0,0 +1,111 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+// Recovery rebuilds reservations from each open order's fills at their own
+// prices, and a market buy's budget round-trips through the orders table
+func TestGetOpenOrderFills(t *testing.T) {
+	db := newDB(t)
+	ctx := context.Background()
+	orders := repository.NewOrderRepository(db)
+	trades := repository.NewTradeRepository(db)
+
+	buy := domain.NewOrder("buyer", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeLimit, 1, 46000)
+	buy.Status = domain.OrderStatusPartial
+	market := domain.NewOrder("buyer", "BTC-USD", domain.OrderSideBuy, domain.OrderTypeMarket, 1, 0)
+	market.Budget = 47250
+	if err := orders.SaveOrder(ctx, buy); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.SaveOrder(ctx, market); err != nil {
+		t.Fatal(err)
+	}
+	for _, price := range []float64{45000, 45500} {
+		sell := domain.NewOrder("seller", "BTC-USD", domain.OrderSideSell, domain.OrderTypeLimit, 0.25, price)
+		sell.Status = domain.OrderStatusFilled
+		if err := orders.SaveOrder(ctx, sell); err != nil {
+			t.Fatal(err)
+		}
+		trade := domain.NewTrade("BTC-USD", buy.ID, sell.ID, "buyer", "seller", price, 0.25, sell.ID, buy.ID)
+		if _, err := trades.SaveTrade(ctx, trade); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fills, err := trades.GetOpenOrderFills(ctx, "BTC-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fills) != 1 {
+		t.Fatalf("fills for %d orders, want only the open one that traded: %v", len(fills), fills)
+	}
+	got := fills[buy.ID]
+	if got.Quantity != 0.5 || math.Abs(got.Notional-22625) > 1e-8 {
+		t.Errorf("fills = %+v, want 0.5 for 22625", got)
+	}
+
+	open, err := orders.GetOpenOrders(ctx, "BTC-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, order := range open {
+		if order.ID == market.ID && order.Budget != 47250 {
+			t.Errorf("market buy's budget = %g, want 47250", order.Budget)
+		}
+	}
+}
+
+// A trade saved and settled twice is stored once, reported as not new the
+// second time, and moves balances once
+func TestTradeSavedAndSettledTwice(t *testing.T) {
+	db := newDB(t)
+	ctx := context.Background()
+	trades := repository.NewTradeRepository(db)
+	balances := repository.NewBalanceRepository(db)
+	if err := balances.ApplyDeltas(ctx, []repository.BalanceDelta{{UserID: "buyer", Asset: "USD", Available: 1000}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := balances.LockBalance(ctx, "buyer", "USD", 900); err != nil {
+		t.Fatal(err)
+	}
+
+	trade := domain.NewTrade("BTC-USD", "buy-1", "sell-1", "buyer", "seller", 450, 1, "sell-1", "buy-1")
+	deltas := []repository.BalanceDelta{
+		{UserID: "buyer", Asset: "USD", Locked: -450},
+		{UserID: "seller", Asset: "USD", Available: 450},
+	}
+	for i, want := range []bool{true, false} {
+		inserted, err := trades.SaveTrade(ctx, trade)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inserted != want {
+			t.Errorf("save %d: inserted = %v, want %v", i+1, inserted, want)
+		}
+	}
+
+	if _, err := balances.Settle(ctx, trade.ID, deltas, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := balances.Settle(ctx, trade.ID, deltas, nil); !errors.Is(err, repository.ErrAlreadySettled) {
+		t.Errorf("second settlement: err = %v, want ErrAlreadySettled", err)
+	}
+	assertBalance(t, balances, "buyer", 100, 450)
+	assertBalance(t, balances, "seller", 450, 0)
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM trades WHERE id = $1`, trade.ID).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%d rows for the trade, want 1", count)
+	}
+}
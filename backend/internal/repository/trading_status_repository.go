@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TradingStatus is whether the exchange accepts new orders
+type TradingStatus struct {
+	Paused bool
+	Reason string
+	Since  time.Time
+	// ResumeAt is when a timed pause ends, nil for an open-ended one
+	ResumeAt *time.Time
+}
+
+type TradingStatusRepository struct {
+	db *sql.DB
+}
+
+func NewTradingStatusRepository(db *sql.DB) *TradingStatusRepository {
+	return &TradingStatusRepository{db: db}
+}
+
+// GetTradingStatus returns nil if trading was never paused or resumed
+func (r *TradingStatusRepository) GetTradingStatus(ctx context.Context) (*TradingStatus, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	status := &TradingStatus{}
+	var since, resumeAt sql.NullString
+	err := r.db.QueryRowContext(ctx, `SELECT paused, reason, since, resume_at FROM trading_status WHERE id = 1`).
+		Scan(&status.Paused, &status.Reason, &since, &resumeAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trading status: %w", err)
+	}
+	status.Since = parseTimestamp(since)
+	if resumeAt.Valid {
+		t := parseTimestamp(resumeAt)
+		status.ResumeAt = &t
+	}
+	return status, nil
+}
+
+func (r *TradingStatusRepository) SaveTradingStatus(ctx context.Context, status *TradingStatus) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO trading_status (id, paused, reason, since, resume_at)
+		VALUES (1, $1, $2, $3, $4)
+		ON CONFLICT (id)
+		DO UPDATE SET paused = $1, reason = $2, since = $3, resume_at = $4
+	`
+	resumeAt := sql.NullTime{}
+	if status.ResumeAt != nil {
+		resumeAt = sql.NullTime{Time: *status.ResumeAt, Valid: true}
+	}
+	if _, err := r.db.ExecContext(ctx, query, status.Paused, status.Reason, status.Since, resumeAt); err != nil {
+		return fmt.Errorf("failed to save trading status: %w", err)
+	}
+	return nil
+}
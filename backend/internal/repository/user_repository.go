@@ -0,0 +1,300 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+var (
+	// ErrUserExists is returned when a username or email is already taken
+	ErrUserExists = errors.New("user already exists")
+	// ErrUserNotFound is returned for a username with no account
+	ErrUserNotFound = errors.New("user not found")
+)
+
+type UserRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// CreateUser stores a new user and its password hash and credits it the
+// starter balances, all in one transaction. A taken username or email
+// returns ErrUserExists naming the field.
+func (r *UserRepository) CreateUser(ctx context.Context, user *domain.User, passwordHash string, balances []domain.AssetAmount) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if user.Kind == "" {
+		user.Kind = domain.UserKindUser
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO users (id, username, email, kind, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, user.ID, user.Username, user.Email, user.Kind, user.CreatedAt)
+	if err != nil {
+		if field := uniqueViolation(err); field != "" {
+			return fmt.Errorf("%w: %s is taken", ErrUserExists, field)
+		}
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_credentials (user_id, password_hash, updated_at)
+		VALUES ($1, $2, $3)
+	`, user.ID, passwordHash, user.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store credentials: %w", err)
+	}
+
+	for _, balance := range balances {
+		if _, err := adjustBalance(ctx, tx, user.ID, balance.Asset, balance.Amount, "starter", "", user.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit new user: %w", err)
+	}
+	return nil
+}
+
+// GetCredentials returns the user with a username and its password hash.
+// Seeded users have no password and return ErrUserNotFound.
+func (r *UserRepository) GetCredentials(ctx context.Context, username string) (*domain.User, string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	user := &domain.User{}
+	var createdAt sql.NullString
+	var passwordHash string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT u.id, u.username, u.email, COALESCE(u.kind, 'user'), u.created_at, c.password_hash
+		FROM users u
+		JOIN user_credentials c ON c.user_id = u.id
+		WHERE u.username = $1
+	`, username).Scan(&user.ID, &user.Username, &user.Email, &user.Kind, &createdAt, &passwordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrUserNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+	user.CreatedAt = parseTimestamp(createdAt)
+	return user, passwordHash, nil
+}
+
+// UserFilter narrows a ListUsers query. After continues from a cursor whose
+// ID is the last user of the previous page.
+type UserFilter struct {
+	Kind     string
+	Disabled *bool
+	After    *Cursor
+}
+
+// userColumns are the columns scanUser reads, in order
+const userColumns = `id, username, email, COALESCE(kind, 'user'), created_at, disabled_at, COALESCE(disabled_reason, ''), verified_at`
+
+// ListUsers returns up to limit users in ID order
+func (r *UserRepository) ListUsers(ctx context.Context, limit int, filter UserFilter) ([]*domain.User, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{"1 = 1"}
+	if filter.Kind != "" {
+		where = append(where, "COALESCE(kind, 'user') = "+arg(filter.Kind))
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			where = append(where, "disabled_at IS NOT NULL")
+		} else {
+			where = append(where, "disabled_at IS NULL")
+		}
+	}
+	if filter.After != nil {
+		where = append(where, "id > "+arg(filter.After.ID))
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY id
+		LIMIT `+arg(limit), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]*domain.User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// GetUser returns one user, or ErrUserNotFound
+func (r *UserRepository) GetUser(ctx context.Context, userID string) (*domain.User, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+	return user, err
+}
+
+// SetUserDisabled records that an admin disabled a user, or cleared it. It
+// returns ErrUserNotFound for an unknown user.
+func (r *UserRepository) SetUserDisabled(ctx context.Context, userID string, disabled bool, reason string, at time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var disabledAt interface{}
+	if disabled {
+		disabledAt = at
+	} else {
+		reason = ""
+	}
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE users SET disabled_at = $2, disabled_reason = $3 WHERE id = $1
+	`, userID, disabledAt, reason)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+	return nil
+}
+
+// GetDisabledUsers returns the IDs of every disabled user
+func (r *UserRepository) GetDisabledUsers(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM users WHERE disabled_at IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disabled users: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SetUserVerified records that an admin verified a user, or cleared it. It
+// returns ErrUserNotFound for an unknown user.
+func (r *UserRepository) SetUserVerified(ctx context.Context, userID string, verified bool, at time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var verifiedAt interface{}
+	if verified {
+		verifiedAt = at
+	}
+	result, err := r.db.ExecContext(ctx, `UPDATE users SET verified_at = $2 WHERE id = $1`, userID, verifiedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+	return nil
+}
+
+// GetVerifiedUsers returns the IDs of every verified user. The exchange's own
+// bot and system accounts, such as the market maker, count as verified.
+func (r *UserRepository) GetVerifiedUsers(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id FROM users
+		WHERE verified_at IS NOT NULL OR COALESCE(kind, 'user') <> 'user'
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verified users: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// scanUser reads a row of userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (*domain.User, error) {
+	user := &domain.User{}
+	var createdAt, disabledAt, verifiedAt sql.NullString
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Kind, &createdAt, &disabledAt, &user.DisabledReason, &verifiedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan user: %w", err)
+	}
+	user.CreatedAt = parseTimestamp(createdAt)
+	if disabledAt.Valid {
+		at := parseTimestamp(disabledAt)
+		user.DisabledAt = &at
+	}
+	if verifiedAt.Valid {
+		at := parseTimestamp(verifiedAt)
+		user.VerifiedAt = &at
+	}
+	return user, nil
+}
+
+// uniqueViolation returns the users column a failed insert collided on, or
+// "" if err isn't a unique constraint violation. Postgres names the
+// constraint (users_email_key) and SQLite the column (users.email).
+func uniqueViolation(err error) string {
+	message := err.Error()
+	if !strings.Contains(message, "UNIQUE constraint failed") && !strings.Contains(message, "duplicate key value") {
+		return ""
+	}
+	for _, field := range []string{"username", "email"} {
+		if strings.Contains(message, field) {
+			return field
+		}
+	}
+	return "username or email"
+}
@@ -0,0 +1,62 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+// Verified users and the exchange's own accounts are listed as verified,
+// until a user's verification is cleared
+func TestVerifiedUsers(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewUserRepository(newDB(t))
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, user := range []*domain.User{
+		{ID: "alice", Username: "alice", Email: "alice@example.com", CreatedAt: at},
+		{ID: "bob", Username: "bob", Email: "bob@example.com", CreatedAt: at},
+		{ID: "maker", Username: "maker", Email: "maker@example.com", Kind: domain.UserKindBot, CreatedAt: at},
+	} {
+		if err := users.CreateUser(ctx, user, "hash", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	verified := func() []string {
+		t.Helper()
+		ids, err := users.GetVerifiedUsers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	if got := verified(); !reflect.DeepEqual(got, []string{"maker"}) {
+		t.Errorf("verified before any were = %v, want the bot", got)
+	}
+	if err := users.SetUserVerified(ctx, "alice", true, at); err != nil {
+		t.Fatal(err)
+	}
+	if got := verified(); !reflect.DeepEqual(got, []string{"alice", "maker"}) {
+		t.Errorf("verified = %v, want alice and the bot", got)
+	}
+	if user, err := users.GetUser(ctx, "alice"); err != nil || user.VerifiedAt == nil || !user.VerifiedAt.Equal(at) {
+		t.Errorf("alice = %+v, %v, want verified at %v", user, err, at)
+	}
+
+	if err := users.SetUserVerified(ctx, "alice", false, at); err != nil {
+		t.Fatal(err)
+	}
+	if got := verified(); !reflect.DeepEqual(got, []string{"maker"}) {
+		t.Errorf("verified after clearing alice = %v, want the bot", got)
+	}
+	if err := users.SetUserVerified(ctx, "nobody", true, at); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("verifying an unknown user: %v, want %v", err, repository.ErrUserNotFound)
+	}
+}
@@ -0,0 +1,138 @@
+package subsystem
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnknownSubsystem is returned for a name nothing was registered under
+var ErrUnknownSubsystem = errors.New("unknown subsystem")
+
+// Component is anything with a restartable lifecycle. Stop must leave the
+// rest of the server working, and Start after Stop must resume the component.
+type Component interface {
+	Start()
+	Stop()
+}
+
+// StatsReporter is implemented by components with counters worth showing
+// next to their state
+type StatsReporter interface {
+	Stats() interface{}
+}
+
+// Funcs adapts a pair of functions to Component
+type Funcs struct {
+	StartFunc func()
+	StopFunc  func()
+	StatsFunc func() interface{}
+}
+
+func (f Funcs) Start() { f.StartFunc() }
+func (f Funcs) Stop()  { f.StopFunc() }
+
+func (f Funcs) Stats() interface{} {
+	if f.StatsFunc == nil {
+		return nil
+	}
+	return f.StatsFunc()
+}
+
+// Status is a registered component's state and its last change
+type Status struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Running     bool        `json:"running"`
+	ChangedAt   *time.Time  `json:"changed_at,omitempty"`
+	ChangedBy   string      `json:"changed_by,omitempty"`
+	Stats       interface{} `json:"stats,omitempty"`
+}
+
+type entry struct {
+	status    Status
+	component Component
+}
+
+// Registry tracks the components that can be controlled at runtime
+type Registry struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[string]*entry)}
+}
+
+// Register adds a component that is already running
+func (r *Registry) Register(name, description string, component Component) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[name] = &entry{
+		status:    Status{Name: name, Description: description, Running: true},
+		component: component,
+	}
+}
+
+// List returns every component's status, by name
+func (r *Registry) List() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := make([]Status, 0, len(r.entries))
+	for _, e := range r.entries {
+		statuses = append(statuses, e.snapshot())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Start starts a stopped component; starting a running one does nothing
+func (r *Registry) Start(name, actor string) (Status, error) {
+	return r.transition(name, actor, true)
+}
+
+// Stop stops a running component; stopping a stopped one does nothing
+func (r *Registry) Stop(name, actor string) (Status, error) {
+	return r.transition(name, actor, false)
+}
+
+// transition holds the lock across the component call so concurrent
+// requests can't interleave a Stop with a Start
+func (r *Registry) transition(name, actor string, running bool) (Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[name]
+	if !ok {
+		return Status{}, fmt.Errorf("%w: %s", ErrUnknownSubsystem, name)
+	}
+	if e.status.Running == running {
+		return e.snapshot(), nil
+	}
+
+	action := "stopped"
+	if running {
+		e.component.Start()
+		action = "started"
+	} else {
+		e.component.Stop()
+	}
+	e.status.Running = running
+	now := time.Now()
+	e.status.ChangedAt = &now
+	e.status.ChangedBy = actor
+	log.Printf("AUDIT: subsystem %s %s by %s", name, action, actor)
+	return e.snapshot(), nil
+}
+
+func (e *entry) snapshot() Status {
+	status := e.status
+	if reporter, ok := e.component.(StatsReporter); ok {
+		status.Stats = reporter.Stats()
+	}
+	return status
+}
@@ -0,0 +1,100 @@
+package subsystem_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/clock"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/pricefeed"
+	"github.com/hft-exchange/backend/internal/subsystem"
+)
+
+// priceTick is the price feed's update interval
+const priceTick = 3 * time.Second
+
+// tickers is an in-memory ticker table
+type tickers struct {
+	mu      sync.Mutex
+	tickers map[string]domain.Ticker
+}
+
+func (t *tickers) GetTicker(_ context.Context, symbol string) (*domain.Ticker, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ticker := t.tickers[symbol]
+	ticker.Symbol = symbol
+	return &ticker, nil
+}
+
+func (t *tickers) UpdateTicker(_ context.Context, ticker *domain.Ticker) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tickers[ticker.Symbol] = *ticker
+	return nil
+}
+
+// Stopping the price feed through the registry halts its updates, a second
+// stop changes nothing, and starting it again resumes the updates
+func TestStopStartRoundTrip(t *testing.T) {
+	clk := clock.NewVirtual(time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC))
+	feed := pricefeed.NewPriceSimulator(&tickers{tickers: make(map[string]domain.Ticker)})
+	feed.SetClock(clk)
+	feed.SetSeed(1)
+	var prices []float64
+	feed.AddUpdateHandler(func(_ string, price float64) { prices = append(prices, price) })
+	feed.AddSymbol("BTC-USD", 45000)
+	feed.Start()
+
+	registry := subsystem.NewRegistry()
+	registry.Register("price_feed", "Simulated price updates", feed)
+	if _, err := registry.Stop("ledger", "tester"); !errors.Is(err, subsystem.ErrUnknownSubsystem) {
+		t.Fatalf("stopping an unregistered subsystem: err = %v, want ErrUnknownSubsystem", err)
+	}
+
+	clk.Advance(3 * priceTick)
+	if len(prices) != 3 {
+		t.Fatalf("%d updates in 3 ticks while running, want 3", len(prices))
+	}
+
+	stopped, err := registry.Stop("price_feed", "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopped.Running || stopped.ChangedBy != "tester" || stopped.ChangedAt == nil {
+		t.Fatalf("status after stop = %+v, want stopped by tester", stopped)
+	}
+	last := feed.GetCurrentPrice("BTC-USD")
+	clk.Advance(3 * priceTick)
+	if len(prices) != 3 || feed.GetCurrentPrice("BTC-USD") != last {
+		t.Fatalf("%d updates and price %g after stopping, want 3 and %g", len(prices), feed.GetCurrentPrice("BTC-USD"), last)
+	}
+
+	again, err := registry.Stop("price_feed", "someone else")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ChangedBy != "tester" || !again.ChangedAt.Equal(*stopped.ChangedAt) {
+		t.Errorf("stopping a stopped subsystem recorded a change: %+v", again)
+	}
+
+	started, err := registry.Start("price_feed", "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !started.Running {
+		t.Fatalf("status after start = %+v, want running", started)
+	}
+	clk.Advance(3 * priceTick)
+	if len(prices) != 6 {
+		t.Fatalf("%d updates after restarting, want 6", len(prices))
+	}
+
+	statuses := registry.List()
+	if len(statuses) != 1 || !statuses[0].Running {
+		t.Errorf("listed statuses = %+v, want price_feed running", statuses)
+	}
+}
@@ -0,0 +1,241 @@
+package tickerstats
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/clock"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/repository"
+)
+
+const (
+	// window is how far back volume and the trade price range reach
+	window = 24 * time.Hour
+	// bucketWidth is the resolution trades leave the window at
+	bucketWidth = time.Minute
+	buckets     = int(window / bucketWidth)
+	// flushInterval is how often totals are written to the tickers table
+	flushInterval = 5 * time.Second
+	// loadStep is the resolution the window is refilled from the trades
+	// table at on startup
+	loadStep = time.Hour
+)
+
+// bucket totals the trades and prices of one minute
+type bucket struct {
+	minute int64 // minutes since the epoch; buckets of other minutes are stale
+	volume float64
+	open   float64
+	high   float64
+	low    float64
+	close  float64
+}
+
+// rolling is a ring of per-minute buckets covering the last 24 hours
+type rolling struct {
+	buckets [buckets]bucket
+	last    float64 // most recent price, kept after it leaves the window
+	lastAt  int64   // minute of last
+}
+
+// stats are a symbol's totals over the window
+type stats struct {
+	volume, high, low float64
+	// change is the percentage move from the window's first price to its last
+	change float64
+}
+
+// add folds trades or prices seen in the minute of at into its bucket. Within
+// a minute, the first price added is its open and the latest its close.
+func (r *rolling) add(at time.Time, volume, open, high, low, close float64) {
+	minute := at.Unix() / int64(bucketWidth/time.Second)
+	b := &r.buckets[minute%int64(buckets)]
+	if minute < b.minute {
+		// Older than the window the slot already moved on to
+		return
+	}
+	if b.minute != minute {
+		*b = bucket{minute: minute, open: open, high: high, low: low}
+	}
+	b.volume += volume
+	b.close = close
+	if high > b.high {
+		b.high = high
+	}
+	if low < b.low {
+		b.low = low
+	}
+	if minute >= r.lastAt {
+		r.last, r.lastAt = close, minute
+	}
+}
+
+// totals sums the buckets still inside the window as of now. Without any,
+// the range collapses to the last price seen, unchanged. ok is false if no
+// price was ever seen.
+func (r *rolling) totals(now time.Time) (totals stats, ok bool) {
+	current := now.Unix() / int64(bucketWidth/time.Second)
+	var first, latest *bucket
+	for i := range r.buckets {
+		b := &r.buckets[i]
+		if b.high == 0 || b.minute <= current-int64(buckets) || b.minute > current {
+			continue
+		}
+		totals.volume += b.volume
+		if b.high > totals.high {
+			totals.high = b.high
+		}
+		if totals.low == 0 || b.low < totals.low {
+			totals.low = b.low
+		}
+		if first == nil || b.minute < first.minute {
+			first = b
+		}
+		if latest == nil || b.minute > latest.minute {
+			latest = b
+		}
+	}
+	if first == nil {
+		return stats{high: r.last, low: r.last}, r.last > 0
+	}
+	if first.open > 0 {
+		totals.change = (latest.close - first.open) / first.open * 100
+	}
+	return totals, true
+}
+
+// Tracker keeps every symbol's rolling 24h traded volume, in base asset
+// quantity, and the range and change of its trade and feed prices, and
+// writes them to the tickers table every few seconds
+type Tracker struct {
+	tickers *repository.TickerRepository
+	trades  *repository.TradeRepository
+	clock   clock.Clock
+
+	mu      sync.Mutex
+	symbols map[string]*rolling
+
+	runMu  sync.Mutex // guards ctx and cancel across Stop and Start
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewTracker(tickers *repository.TickerRepository, trades *repository.TradeRepository) *Tracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Tracker{
+		tickers: tickers,
+		trades:  trades,
+		clock:   clock.Real{},
+		symbols: make(map[string]*rolling),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// SetClock replaces the wall clock driving the window and flushes. It must
+// be called before Load and Start.
+func (t *Tracker) SetClock(c clock.Clock) {
+	t.clock = c
+}
+
+// Load refills a symbol's window from the trades of the last 24 hours, an
+// hour at a time, so volume survives a restart. Each hour's trades leave the
+// window together with its last minute.
+func (t *Tracker) Load(ctx context.Context, symbol string) error {
+	now := t.clock.Now()
+	loaded := &rolling{}
+	for from := now.Add(-window); from.Before(now); from = from.Add(loadStep) {
+		to := from.Add(loadStep)
+		if to.After(now) {
+			to = now
+		}
+		traded, err := t.trades.GetTradeStats(ctx, symbol, from, to)
+		if err != nil {
+			return err
+		}
+		if traded.Volume > 0 {
+			loaded.add(to.Add(-bucketWidth), traded.Volume, traded.Open, traded.High, traded.Low, traded.Close)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.symbols[symbol] = loaded
+	return nil
+}
+
+// RecordTrade adds a trade's quantity and price to its symbol's window
+func (t *Tracker) RecordTrade(trade *domain.Trade) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	price := trade.Price
+	t.window(trade.Symbol).add(trade.ExecutedAt, trade.Quantity, price, price, price, price)
+}
+
+// RecordPrice adds a price feed update to its symbol's window, so the range
+// and change follow the market between trades too
+func (t *Tracker) RecordPrice(symbol string, price float64) {
+	now := t.clock.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.window(symbol).add(now, 0, price, price, price, price)
+}
+
+// window returns a symbol's window, creating it if needed. t.mu must be held.
+func (t *Tracker) window(symbol string) *rolling {
+	r, ok := t.symbols[symbol]
+	if !ok {
+		r = &rolling{}
+		t.symbols[symbol] = r
+	}
+	return r
+}
+
+// Start writes each symbol's totals to its ticker every few seconds
+func (t *Tracker) Start() {
+	t.runMu.Lock()
+	defer t.runMu.Unlock()
+
+	ctx := t.ctx
+	t.clock.Every(ctx, flushInterval, func() { t.flush(ctx) })
+	log.Println("Ticker stats started")
+}
+
+// Stop halts flushing; trades are still counted and written on Start
+func (t *Tracker) Stop() {
+	t.runMu.Lock()
+	defer t.runMu.Unlock()
+
+	t.cancel()
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+}
+
+// flush writes every symbol's current totals, including symbols whose
+// trades and prices have all aged out
+func (t *Tracker) flush(ctx context.Context) {
+	type pending struct {
+		symbol string
+		stats
+	}
+	now := t.clock.Now()
+
+	t.mu.Lock()
+	updates := make([]pending, 0, len(t.symbols))
+	for symbol, r := range t.symbols {
+		if totals, ok := r.totals(now); ok {
+			updates = append(updates, pending{symbol, totals})
+		}
+	}
+	t.mu.Unlock()
+
+	for _, p := range updates {
+		if err := t.tickers.UpdateStats(ctx, p.symbol, p.volume, p.high, p.low, p.change); err != nil {
+			log.Printf("Failed to update 24h stats for %s: %v", p.symbol, err)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectionLimits bound how many clients may connect and how fast, so a
+// reconnect storm after a deploy is spread out rather than landing on the
+// hub at once. Clients already connected are never affected by them.
+type ConnectionLimits struct {
+	// MaxConnections is how many clients may be connected at once, or 0 for
+	// no limit
+	MaxConnections int
+	// MaxPerAddress is how many of them may come from one address, or 0 for
+	// no limit
+	MaxPerAddress int
+	// AcceptRate is how many new connections a second are accepted, in
+	// bursts of up to AcceptBurst, or 0 for no limit
+	AcceptRate  float64
+	AcceptBurst float64
+}
+
+// DefaultConnectionLimits leave room for every client of a busy instance to
+// reconnect within a minute or so. There is no limit per address, since
+// behind a proxy every client would share the proxy's.
+var DefaultConnectionLimits = ConnectionLimits{
+	MaxConnections: 10000,
+	MaxPerAddress:  0,
+	AcceptRate:     200,
+	AcceptBurst:    400,
+}
+
+// retryJitter is the most a rejected client's Retry-After is lengthened by
+// at random, so clients turned away together don't all come back together
+const retryJitter = 5 * time.Second
+
+// Reasons a connection is rejected
+const (
+	RejectedFull    = "max_connections"
+	RejectedAddress = "max_per_address"
+	RejectedRate    = "accept_rate"
+)
+
+// RejectedError is why a connection was turned away before upgrading, and
+// how long the client should wait before trying again
+type RejectedError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *RejectedError) Error() string {
+	switch e.Reason {
+	case RejectedFull:
+		return "too many WebSocket connections, try again later"
+	case RejectedAddress:
+		return "too many WebSocket connections from this address"
+	default:
+		return "too many new WebSocket connections, try again later"
+	}
+}
+
+// admission counts the connected clients, in total and by address, and
+// spends accept tokens. It has its own lock so upgrades never wait on the
+// hub's.
+type admission struct {
+	mu          sync.Mutex
+	limits      ConnectionLimits
+	connections int
+	addresses   map[string]int
+	tokens      float64
+	last        time.Time
+	rejected    map[string]*uint64
+}
+
+func newAdmission() *admission {
+	return &admission{
+		limits:    DefaultConnectionLimits,
+		addresses: make(map[string]int),
+		rejected: map[string]*uint64{
+			RejectedFull:    new(uint64),
+			RejectedAddress: new(uint64),
+			RejectedRate:    new(uint64),
+		},
+	}
+}
+
+// SetConnectionLimits sets how many clients may connect and how fast. It
+// must be called before clients connect.
+func (h *Hub) SetConnectionLimits(limits ConnectionLimits) {
+	h.admission.limits = limits
+}
+
+// admit counts a new connection from address, or returns why it can't be
+// accepted. An admitted connection is released when the client is dropped.
+func (a *admission) admit(address string, now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	limits := a.limits
+	if limits.MaxConnections > 0 && a.connections >= limits.MaxConnections {
+		return a.reject(RejectedFull, time.Second)
+	}
+	if limits.MaxPerAddress > 0 && a.addresses[address] >= limits.MaxPerAddress {
+		return a.reject(RejectedAddress, time.Second)
+	}
+	if limits.AcceptRate > 0 {
+		burst := math.Max(limits.AcceptBurst, 1)
+		if a.last.IsZero() {
+			a.tokens = burst
+		} else {
+			a.tokens = math.Min(burst, a.tokens+now.Sub(a.last).Seconds()*limits.AcceptRate)
+		}
+		a.last = now
+		if a.tokens < 1 {
+			return a.reject(RejectedRate, time.Duration((1-a.tokens)/limits.AcceptRate*float64(time.Second)))
+		}
+		a.tokens--
+	}
+	a.connections++
+	a.addresses[address]++
+	return nil
+}
+
+// reject counts a rejection and tells the client to come back after wait,
+// spread out by up to retryJitter
+func (a *admission) reject(reason string, wait time.Duration) error {
+	atomic.AddUint64(a.rejected[reason], 1)
+	return &RejectedError{Reason: reason, RetryAfter: wait + time.Duration(rand.Int63n(int64(retryJitter)))}
+}
+
+// release forgets an admitted connection. Clients made without Upgrade
+// were never admitted and aren't counted.
+func (a *admission) release(address string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.addresses[address] == 0 {
+		return
+	}
+	a.connections--
+	if a.addresses[address]--; a.addresses[address] <= 0 {
+		delete(a.addresses, address)
+	}
+}
+
+// ConnectionStats are the admitted connections and the limits on them
+type ConnectionStats struct {
+	Open           int               `json:"open"`
+	Addresses      int               `json:"addresses"`
+	MaxConnections int               `json:"max_connections"`
+	MaxPerAddress  int               `json:"max_per_address"`
+	AcceptRate     float64           `json:"accept_rate"`
+	Rejected       map[string]uint64 `json:"rejected"`
+}
+
+func (a *admission) stats() ConnectionStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stats := ConnectionStats{
+		Open:           a.connections,
+		Addresses:      len(a.addresses),
+		MaxConnections: a.limits.MaxConnections,
+		MaxPerAddress:  a.limits.MaxPerAddress,
+		AcceptRate:     a.limits.AcceptRate,
+		Rejected:       make(map[string]uint64, len(a.rejected)),
+	}
+	for reason, count := range a.rejected {
+		stats.Rejected[reason] = atomic.LoadUint64(count)
+	}
+	return stats
+}
+
+// Connections reports the admitted connections and those turned away
+func (h *Hub) Connections() ConnectionStats {
+	return h.admission.stats()
+}
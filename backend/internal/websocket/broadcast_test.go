@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// Broadcasts hammered from several goroutines while half the clients stop
+// reading, some hang up and the hub is read concurrently leave the reading
+// clients with every trade. Run with -race, which checks the hub's maps are
+// only changed under its write lock.
+func TestBroadcastWhileClientsStall(t *testing.T) {
+	const (
+		clients      = 40
+		broadcasters = 8
+		each         = 300
+	)
+	// Long enough that a reading client's pongs, which queue behind the
+	// broadcasts it has yet to read, arrive in time under the race detector
+	hub, url := startHub(t, time.Second)
+
+	received := make([]*atomic.Int64, 0, clients/2)
+	stalled := make([]func() error, 0, clients/2)
+	for i := 0; i < clients; i++ {
+		conn := dialTrades(t, url, "BTC-USD")
+		if i%2 == 0 {
+			count := new(atomic.Int64)
+			received = append(received, count)
+			go readTrades(conn, count)
+		} else {
+			stalled = append(stalled, conn.Close)
+		}
+	}
+	if !waitUntil(5*time.Second, func() bool { return hub.GetClientCount() == clients }) {
+		t.Fatalf("%d clients connected, want %d", hub.GetClientCount(), clients)
+	}
+
+	var wg sync.WaitGroup
+	for b := 0; b < broadcasters; b++ {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				hub.BroadcastTrade("BTC-USD", &domain.Trade{ID: fmt.Sprintf("%d-%d", b, i), Symbol: "BTC-USD", Price: 45000, Quantity: 0.1})
+			}
+		}(b)
+	}
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				hub.Stats()
+				hub.GetClientCount()
+				hub.SymbolSubscribers("BTC-USD")
+			}
+		}
+	}()
+	// Some stalled clients hang up mid-broadcast rather than going silent
+	for _, hangUp := range stalled[:len(stalled)/4] {
+		hangUp()
+	}
+	wg.Wait()
+	close(done)
+	readers.Wait()
+
+	if !waitUntil(5*time.Second, func() bool { return hub.GetClientCount() == len(received) }) {
+		t.Fatalf("%d clients connected, want the %d reading; %d were too slow", hub.GetClientCount(), len(received), hub.SlowClients())
+	}
+	want := int64(broadcasters * each)
+	if !waitUntil(10*time.Second, func() bool {
+		for _, count := range received {
+			if count.Load() < want {
+				return false
+			}
+		}
+		return true
+	}) {
+		for i, count := range received {
+			if count.Load() != want {
+				t.Errorf("reading client %d received %d trades, want %d", i, count.Load(), want)
+			}
+		}
+	}
+}
@@ -1,62 +1,174 @@
 package websocket
 
 import (
+	"errors"
 	"log"
+	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/hft-exchange/backend/internal/domain"
 )
 
-const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
-)
+const writeWait = 10 * time.Second
 
 type Client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
+	hub    *Hub
+	conn   *websocket.Conn
+	outbox *outbox
+	// legacyNumbers sends prices and quantities as JSON numbers
+	legacyNumbers bool
+	// protocolVersion is the message format version the client asked for
+	protocolVersion int
+	// compressed is set when the connection negotiated permessage-deflate,
+	// and compact holds the symbols whose order books are sent as pairs
+	compressed bool
+	compactMu  sync.Mutex
+	compact    map[string]bool
+	// written counts the bytes written to the connection; bytesPerSec is how
+	// many were in the last second, measured by the hub under its mutex
+	written     *atomic.Uint64
+	lastWritten uint64
+	bytesPerSec uint64
+	// subscriptions are the channels the client receives; closed is set once
+	// the hub has dropped the client. Both are guarded by the hub's mutex.
+	subscriptions map[subscription]bool
+	closed        bool
+	// userID is who the connection authenticated as, if anyone, and
+	// expiresAt when its token runs out. A connection whose token expired
+	// keeps its user but is sent nothing private until it authenticates
+	// again. readScope is whether its caller may read private streams at
+	// all: the upgrade request's scope, raised by a session token. All four
+	// are guarded by the hub's mutex once registered.
+	userID    string
+	expiresAt time.Time
+	expired   bool
+	readScope bool
+	// connectedAt starts the window for a first auth op, and address is
+	// where the connection came from, counted against the hub's limits
+	connectedAt time.Time
+	address     string
+	// inbound and violations limit what the client sends; only readPump
+	// uses them
+	inbound    inboundBucket
+	violations int
 }
 
 func NewClient(hub *Hub, conn *websocket.Conn) *Client {
 	return &Client{
-		hub:  hub,
-		conn: conn,
-		send: make(chan []byte, 256),
+		hub:             hub,
+		conn:            conn,
+		outbox:          newOutbox(),
+		subscriptions:   make(map[subscription]bool),
+		compact:         make(map[string]bool),
+		written:         new(atomic.Uint64),
+		connectedAt:     time.Now(),
+		protocolVersion: ProtocolVersion,
 	}
 }
 
+// SetProtocolVersion sets the protocol version the client asked for, one
+// of SupportedVersions. It must be called before the client is registered.
+func (c *Client) SetProtocolVersion(version int) {
+	c.protocolVersion = version
+}
+
+// SetLegacyNumbers makes the client receive prices and quantities as JSON
+// numbers rather than decimal strings. It must be called before Start.
+func (c *Client) SetLegacyNumbers(legacy bool) {
+	c.legacyNumbers = legacy
+}
+
+// SetUser authenticates the client as userID, whose session token came with
+// the upgrade request and expires at expiresAt. It must be called before
+// the client is registered.
+func (c *Client) SetUser(userID string, expiresAt time.Time) {
+	c.userID = userID
+	c.expiresAt = expiresAt
+}
+
+// SetReadScope records whether the upgrade request's caller holds the read
+// scope the user channel needs. A session token, on the handshake or in an
+// auth op, carries it too. It must be called before the client is
+// registered.
+func (c *Client) SetReadScope(allowed bool) {
+	c.readScope = allowed
+}
+
+// format applies the client's order book and number formats to a message
+func (c *Client) format(message []byte) []byte {
+	message = c.compactBook(message)
+	if !c.legacyNumbers {
+		return message
+	}
+	rewritten, err := domain.LegacyNumbers(message)
+	if err != nil {
+		log.Printf("Failed to rewrite message numbers: %v", err)
+		return message
+	}
+	return rewritten
+}
+
+// readPump reads the client's messages until its connection fails. Every
+// way a connection ends, including the write pump giving up, surfaces here
+// as a read error, so this is the one place clients are unregistered.
 func (c *Client) readPump() {
 	defer func() {
 		c.hub.Unregister <- c
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error {
+	// Anything the client sends, pongs to our pings and its own pings
+	// included, shows it is still there
+	pongWait := c.hub.pongWait
+	alive := func() {
 		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	}
+	c.conn.SetReadLimit(c.hub.limits.MaxMessageSize)
+	alive()
+	c.conn.SetPongHandler(func(string) error {
+		alive()
+		return nil
+	})
+	c.conn.SetPingHandler(func(data string) error {
+		alive()
+		err := c.conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeWait))
+		if err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+			return err
+		}
 		return nil
 	})
 
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			var netErr net.Error
+			if errors.Is(err, websocket.ErrReadLimit) {
+				c.oversized()
+			} else if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("WebSocket client %s sent nothing for %s, disconnecting", c.conn.RemoteAddr(), pongWait)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
-		
-		// Handle incoming messages if needed (e.g., subscriptions)
-		log.Printf("Received message: %s", message)
+		alive()
+		if !c.inbound.allow(c.hub.limits, time.Now()) {
+			if !c.throttle(message) {
+				break
+			}
+			continue
+		}
+		c.hub.handleMessage(c, message)
 	}
 }
 
+// writePump sends queued messages and pings. When a write fails it only
+// closes the connection, which ends readPump and unregisters the client.
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.hub.pingInterval)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -64,27 +176,16 @@ func (c *Client) writePump() {
 
 	for {
 		select {
-		case message, ok := <-c.send:
+		case <-c.outbox.ready:
+			messages, closed := c.outbox.take()
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// Add queued messages to the current websocket message
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
+			if len(messages) > 0 {
+				if err := c.write(messages); err != nil {
+					return
+				}
 			}
-
-			if err := w.Close(); err != nil {
+			if closed {
+				c.conn.WriteMessage(websocket.CloseMessage, c.outbox.closeMessage())
 				return
 			}
 
@@ -97,6 +198,37 @@ func (c *Client) writePump() {
 	}
 }
 
+// write sends everything queued as one websocket message, compressed if
+// the connection negotiated it and the message is big enough to gain
+func (c *Client) write(messages []queued) error {
+	payloads := make([][]byte, len(messages))
+	size := len(messages) - 1
+	for i, message := range messages {
+		payloads[i] = c.format(message.payload)
+		size += len(payloads[i])
+	}
+	if c.compressed {
+		c.conn.EnableWriteCompression(size >= compressMin)
+	}
+
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	for i, payload := range payloads {
+		if i > 0 {
+			w.Write([]byte{'\n'})
+		}
+		w.Write(payload)
+	}
+	return w.Close()
+}
+
+// Close closes the connection of a client that was never started
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
 func (c *Client) Start() {
 	go c.writePump()
 	go c.readPump()
@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/hft-exchange/backend/internal/apierror"
+)
+
+// Formats an orderbook subscription can ask for. Compact sends each level
+// as a [price, quantity] pair instead of an object, for clients that can't
+// negotiate compression.
+const (
+	FormatJSON    = "json"
+	FormatCompact = "compact"
+)
+
+// bookPrefix starts every orderbook and orderbook_diff message
+var bookPrefix = []byte(`{"type":"orderbook`)
+
+// checkFormat rejects a format on anything but subscribing to an order book
+func checkFormat(message *ClientMessage) error {
+	switch {
+	case message.Format == "":
+		return nil
+	case message.Op != OpSubscribe || message.Channel != ChannelOrderBook:
+		return apierror.New(apierror.InvalidRequest, "only %s subscriptions take a format", ChannelOrderBook)
+	case message.Format != FormatJSON && message.Format != FormatCompact:
+		return apierror.New(apierror.InvalidRequest, "unsupported format %q, want %s or %s", message.Format, FormatJSON, FormatCompact)
+	}
+	return nil
+}
+
+// setCompact sets whether symbol's order book messages are sent compact
+func (c *Client) setCompact(symbol string, compact bool) {
+	c.compactMu.Lock()
+	defer c.compactMu.Unlock()
+	if compact {
+		c.compact[symbol] = true
+	} else {
+		delete(c.compact, symbol)
+	}
+}
+
+// compacting reports whether the client asked for any symbol compact
+func (c *Client) compacting() bool {
+	c.compactMu.Lock()
+	defer c.compactMu.Unlock()
+	return len(c.compact) > 0
+}
+
+// number is a level's decimal string, or for a client that wants legacy
+// numbers the number it holds, which LegacyNumbers can't find in a pair
+func (c *Client) number(decimal json.RawMessage) json.RawMessage {
+	if !c.legacyNumbers || len(decimal) < 2 || decimal[0] != '"' {
+		return decimal
+	}
+	return decimal[1 : len(decimal)-1]
+}
+
+// compactBook rewrites an order book message's levels as [price, quantity]
+// pairs if the client asked for its symbol compact
+func (c *Client) compactBook(message []byte) []byte {
+	if !bytes.HasPrefix(message, bookPrefix) {
+		return message
+	}
+	if !c.compacting() {
+		return message
+	}
+
+	var book struct {
+		Envelope
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(message, &book); err != nil {
+		return message
+	}
+	c.compactMu.Lock()
+	compact := c.compact[book.Symbol]
+	c.compactMu.Unlock()
+	if !compact {
+		return message
+	}
+	for _, side := range []string{"bids", "asks"} {
+		var levels []struct {
+			Price    json.RawMessage `json:"price"`
+			Quantity json.RawMessage `json:"quantity"`
+		}
+		if err := json.Unmarshal(book.Data[side], &levels); err != nil {
+			return message
+		}
+		pairs := make([][2]json.RawMessage, len(levels))
+		for i, level := range levels {
+			pairs[i] = [2]json.RawMessage{c.number(level.Price), c.number(level.Quantity)}
+		}
+		book.Data[side], _ = json.Marshal(pairs)
+	}
+	compacted, err := json.Marshal(book)
+	if err != nil {
+		return message
+	}
+	return compacted
+}
@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// conflatable are the message types a newer one for the same symbol
+// supersedes while still queued: a ticker or book ticker replaces the last,
+// and book diffs are merged into one covering both. A full queue may also
+// drop them, since a missed diff shows up as a gap the client recovers from
+// with a fresh snapshot. Trades, user updates, snapshots and replies are
+// never conflated or dropped.
+var conflatable = map[string]bool{
+	"ticker":         true,
+	"bookTicker":     true,
+	"orderbook_diff": true,
+}
+
+// supersede returns the message that takes the place of a queued one of the
+// same type and symbol, or false if both have to be sent
+func supersede(kind string, queued, newer []byte) ([]byte, bool) {
+	if kind != "orderbook_diff" {
+		return newer, true
+	}
+	merged, err := mergeBookDiffs(queued, newer)
+	if err != nil {
+		return nil, false
+	}
+	return merged, true
+}
+
+// bookDiffMessage is a marshalled orderbook_diff Envelope
+type bookDiffMessage struct {
+	Envelope
+	Data domain.OrderBookDiff `json:"data"`
+}
+
+// mergeBookDiffs combines two consecutive diffs of a book into one from the
+// first's prev_seq to the second's seq, with each level's latest quantity
+func mergeBookDiffs(first, second []byte) ([]byte, error) {
+	var older, newer bookDiffMessage
+	if err := json.Unmarshal(first, &older); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(second, &newer); err != nil {
+		return nil, err
+	}
+	newer.Data.PrevSeq = older.Data.PrevSeq
+	newer.Data.Bids = mergeLevels(older.Data.Bids, newer.Data.Bids, true)
+	newer.Data.Asks = mergeLevels(older.Data.Asks, newer.Data.Asks, false)
+	return json.Marshal(newer)
+}
+
+// mergeLevels overlays one side's newer changed levels on older ones, best
+// price first
+func mergeLevels(older, newer []domain.OrderBookLevel, descending bool) []domain.OrderBookLevel {
+	byPrice := make(map[float64]domain.OrderBookLevel, len(older)+len(newer))
+	for _, level := range older {
+		byPrice[level.Price] = level
+	}
+	for _, level := range newer {
+		byPrice[level.Price] = level
+	}
+	merged := make([]domain.OrderBookLevel, 0, len(byPrice))
+	for _, level := range byPrice {
+		merged = append(merged, level)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if descending {
+			return merged[i].Price > merged[j].Price
+		}
+		return merged[i].Price < merged[j].Price
+	})
+	return merged
+}
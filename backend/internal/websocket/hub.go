@@ -1,120 +1,485 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hft-exchange/backend/internal/domain"
 )
 
+// Event is one message the hub broadcasts. Seq numbers events in the order
+// they are sent, so a subscriber can resume after the last one it saw.
+type Event struct {
+	Seq     uint64
+	Type    string
+	Symbol  string // empty for events that aren't about one symbol
+	// Interval is a kline event's candle width
+	Interval string
+	UserID  string // set for events only their user's clients receive
+	Payload []byte // the message as WebSocket clients receive it
+}
+
+// replayDepth is how many recent events are kept for subscribers resuming
+// after a disconnect
+const replayDepth = 1000
+
+// Subscriber receives every event the hub sends until it unsubscribes. One
+// that falls too far behind is dropped and its channel closed.
+type Subscriber struct {
+	events chan *Event
+}
+
+// Events delivers the subscriber's events in sequence order
+func (s *Subscriber) Events() <-chan *Event {
+	return s.events
+}
+
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
-	Register   chan *Client
-	Unregister chan *Client
-	mu         sync.RWMutex
+	clients     map[*Client]bool
+	users       map[string]map[*Client]bool // authenticated clients by user
+	subscribers map[*Subscriber]bool
+	broadcast   chan *Event
+	Register    chan *Client
+	Unregister  chan *Client
+	mu          sync.RWMutex
+	paused      atomic.Bool
+	dropped     uint64   // messages discarded while paused
+	conflated   uint64   // messages clients' queues superseded with newer ones
+	conflatedBy map[string]*uint64 // the same by message type
+	overflowed  uint64   // messages full queues dropped to make room
+	broadcasts  map[string]*uint64 // messages sent by channel
+	authFailures uint64  // auth ops that failed
+	bytesWritten atomic.Uint64 // to every client, after compression
+	queueDepth  QueueDepth // sampled every second
+	admission   *admission
+	slowClients uint64   // clients disconnected for staying too far behind
+	unrouted    uint64   // user messages sent while the user had no connection here
+	limits         InboundLimits
+	violations     uint64 // messages clients sent over their limits
+	limitedClients uint64 // clients disconnected for exceeding them
+	status      []byte   // last status message, sent to clients as they subscribe to it
+	listed      func(symbol string) bool
+	klineIntervals []string
+	verify      func(token string) (string, time.Time, error)
+	snapshots   map[string]func(symbol string) (interface{}, error) // by channel
+	streams     map[streamKey]*stream // each channel and symbol's recent messages, for resuming
+	streamBase  uint64
+	relay       func(event Event)
+	seq         uint64   // events sent so far
+	recent      []*Event // the last replayDepth events, oldest first
+	// pingInterval is how often clients are pinged, and pongWait how long
+	// one may go without sending anything before it is disconnected
+	pingInterval time.Duration
+	pongWait     time.Duration
+	// compression is whether clients may negotiate permessage-deflate
+	compression bool
+	// stopping is closed when Shutdown begins, and done once Run has
+	// returned
+	stopping chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		broadcast:  make(chan []byte, 256),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
+		broadcast:   make(chan *Event, 256),
+		Register:    make(chan *Client),
+		Unregister:  make(chan *Client),
+		clients:     make(map[*Client]bool),
+		users:       make(map[string]map[*Client]bool),
+		subscribers: make(map[*Subscriber]bool),
+		snapshots:   make(map[string]func(symbol string) (interface{}, error)),
+		streams:     make(map[streamKey]*stream),
+		streamBase:  newStreamBase(),
+		conflatedBy: newConflatedCounts(),
+		broadcasts:  newBroadcastCounts(),
+		admission:   newAdmission(),
+		pingInterval: DefaultPingInterval,
+		pongWait:     DefaultPingInterval * 3 / 2,
+		limits:       DefaultInboundLimits,
+		stopping:     make(chan struct{}),
+		done:         make(chan struct{}),
 	}
 }
 
+// DefaultPingInterval is how often clients are pinged by default
+const DefaultPingInterval = 30 * time.Second
+
+// SetCompression sets whether clients that offer permessage-deflate get
+// compressed messages. It must be called before the router is built.
+func (h *Hub) SetCompression(enabled bool) {
+	h.compression = enabled
+}
+
+// Compression reports whether clients may negotiate compression
+func (h *Hub) Compression() bool {
+	return h.compression
+}
+
+// SetKeepalive sets how often clients are pinged. One that sends nothing
+// back, not even a pong, for one and a half intervals is disconnected, so a
+// connection that died without closing is cleaned up rather than lingering
+// until its queue fills. It must be called before clients connect.
+func (h *Hub) SetKeepalive(pingInterval time.Duration) {
+	h.pingInterval = pingInterval
+	h.pongWait = pingInterval * 3 / 2
+}
+
+// sessionCheckInterval is how often connections are checked for expired
+// session tokens
+const sessionCheckInterval = time.Second
+
+// Run serves registrations and broadcasts until Shutdown, returning once
+// every client has disconnected
 func (h *Hub) Run() {
+	defer close(h.done)
+	sessions := time.NewTicker(sessionCheckInterval)
+	defer sessions.Stop()
+	stopping := h.stopping
 	for {
 		select {
+		case now := <-sessions.C:
+			h.expireSessions(now)
+			h.mu.Lock()
+			h.measureThroughput()
+			h.sampleQueues()
+			h.mu.Unlock()
+
+		case <-stopping:
+			// Every client is sent what it has queued and then a close
+			// frame; Run carries on until they have all unregistered
+			stopping = nil
+			h.mu.Lock()
+			for client := range h.clients {
+				client.outbox.shutdown(shutdownFrame)
+			}
+			remaining := len(h.clients)
+			h.mu.Unlock()
+			log.Printf("Closing %d WebSocket clients", remaining)
+			if remaining == 0 {
+				h.CloseSubscribers()
+				return
+			}
+
 		case client := <-h.Register:
 			h.mu.Lock()
 			h.clients[client] = true
+			if client.userID != "" {
+				h.indexUser(client)
+			}
+			h.SendToClient(client, "welcome", Welcome{ProtocolVersion: client.protocolVersion, SupportedVersions: SupportedVersions})
+			if stopping == nil {
+				client.outbox.shutdown(shutdownFrame)
+			}
 			h.mu.Unlock()
 			log.Printf("Client connected. Total clients: %d", len(h.clients))
 
 		case client := <-h.Unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
+			h.drop(client)
+			remaining := len(h.clients)
 			h.mu.Unlock()
-			log.Printf("Client disconnected. Total clients: %d", len(h.clients))
+			log.Printf("Client disconnected. Total clients: %d", remaining)
+			if stopping == nil && remaining == 0 {
+				h.CloseSubscribers()
+				return
+			}
 
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
+		case event := <-h.broadcast:
+			h.mu.Lock()
+			h.seq++
+			event.Seq = h.seq
+			h.sequence(event)
+			h.recent = append(h.recent, event)
+			if len(h.recent) > replayDepth {
+				h.recent = h.recent[len(h.recent)-replayDepth:]
+			}
+			// Clients only receive the channels they subscribed to, and a
+			// user's events only go to that user's clients. A client that
+			// can't keep up only has its queue closed here; it is removed
+			// from the maps when it unregisters, under the write lock.
+			key := subscription{channel: eventChannels[event.Type], symbol: event.Symbol, interval: event.Interval}
+			if count := h.broadcasts[key.channel]; count != nil {
+				atomic.AddUint64(count, 1)
+			}
+			recipients := h.clients
+			if event.UserID != "" {
+				recipients = h.users[event.UserID]
+				if len(recipients) == 0 {
+					atomic.AddUint64(&h.unrouted, 1)
+				}
+			}
+			for client := range recipients {
+				if !client.subscriptions[key] {
+					continue
+				}
+				h.push(client, event.Type, event.Symbol, event.Payload)
+			}
+			for subscriber := range h.subscribers {
 				select {
-				case client.send <- message:
+				case subscriber.events <- event:
 				default:
-					close(client.send)
-					delete(h.clients, client)
+					close(subscriber.events)
+					delete(h.subscribers, subscriber)
 				}
 			}
-			h.mu.RUnlock()
+			h.mu.Unlock()
 		}
 	}
 }
 
-func (h *Hub) BroadcastOrderBook(symbol string, orderBook interface{}) {
-	data := map[string]interface{}{
-		"type":    "orderbook",
-		"symbol":  symbol,
-		"data":    orderBook,
+// shutdownFrame ends clients' connections when the server shuts down
+var shutdownFrame = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+
+// Shutdown stops the hub: new connections are turned away, and every client
+// is sent what is already queued for it and then a close frame saying the
+// server is shutting down. It returns once they have all disconnected and
+// Run has returned, or when ctx is done, after closing the connections of
+// the clients still there.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.stopOnce.Do(func() { close(h.stopping) })
+	select {
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
 	}
-	
+
+	h.mu.RLock()
+	for client := range h.clients {
+		client.conn.Close()
+	}
+	h.mu.RUnlock()
+	return ctx.Err()
+}
+
+// Connect registers a client, reporting false once the hub has stopped
+func (h *Hub) Connect(client *Client) bool {
+	select {
+	case h.Register <- client:
+		return true
+	case <-h.done:
+		h.admission.release(client.address)
+		return false
+	}
+}
+
+// drop forgets a client that unregistered, closing its queue once. The
+// caller holds h.mu.
+func (h *Hub) drop(client *Client) {
+	if client.closed {
+		return
+	}
+	client.closed = true
+	delete(h.clients, client)
+	h.admission.release(client.address)
+	if clients := h.users[client.userID]; clients != nil {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.users, client.userID)
+		}
+	}
+	client.outbox.close()
+}
+
+// push queues a message for a client. One that can't keep up is
+// disconnected by closing its queue, which ends its connection; the hub
+// forgets it when it unregisters.
+func (h *Hub) push(client *Client, kind, symbol string, message []byte) {
+	superseded, dropped, ok := client.outbox.push(kind, symbol, message)
+	if superseded != "" {
+		atomic.AddUint64(&h.conflated, 1)
+		atomic.AddUint64(h.conflatedBy[superseded], 1)
+	}
+	if dropped {
+		atomic.AddUint64(&h.overflowed, 1)
+	}
+	if !ok {
+		atomic.AddUint64(&h.slowClients, 1)
+		log.Printf("WebSocket client %s can't keep up, disconnecting", client.conn.RemoteAddr())
+		client.outbox.close()
+	}
+}
+
+// indexUser files an authenticated client under its user. The caller holds
+// h.mu.
+func (h *Hub) indexUser(client *Client) {
+	clients := h.users[client.userID]
+	if clients == nil {
+		clients = make(map[*Client]bool)
+		h.users[client.userID] = clients
+	}
+	clients[client] = true
+}
+
+// BroadcastOrderBookDiff sends the levels of a book that changed since the
+// last diff. Subscribers apply it to the snapshot they got on subscribing.
+func (h *Hub) BroadcastOrderBookDiff(diff *domain.OrderBookDiff) {
+	data := envelope("orderbook_diff", diff)
+	data.Symbol = diff.Symbol
+
 	message, err := json.Marshal(data)
 	if err != nil {
-		log.Printf("Failed to marshal orderbook: %v", err)
+		log.Printf("Failed to marshal orderbook diff: %v", err)
 		return
 	}
-	
-	h.broadcast <- message
+
+	h.send(&Event{Type: "orderbook_diff", Symbol: diff.Symbol, Payload: message})
 }
 
-func (h *Hub) BroadcastTrade(trade interface{}) {
-	data := map[string]interface{}{
-		"type": "trade",
-		"data": trade,
-	}
-	
+// BroadcastTrade sends a trade to the clients subscribed to symbol's trades.
+// Like every per-symbol message, the symbol is repeated at the top of the
+// envelope so clients can route it without reading the data.
+func (h *Hub) BroadcastTrade(symbol string, trade *domain.Trade) {
+	data := envelope("trade", trade)
+	data.Symbol = symbol
+
 	message, err := json.Marshal(data)
 	if err != nil {
 		log.Printf("Failed to marshal trade: %v", err)
 		return
 	}
 	
-	h.broadcast <- message
+	h.send(&Event{Type: "trade", Symbol: symbol, Payload: message})
+}
+
+// BroadcastKline sends a kline to the clients subscribed to its symbol's
+// klines of its interval. A closed kline sent again because a late trade
+// changed it is flagged as a correction.
+func (h *Hub) BroadcastKline(kline *domain.Candle, correction bool) {
+	data := envelope("kline", kline)
+	data.Symbol = kline.Symbol
+	data.Interval = kline.Resolution
+	data.Correction = correction
+
+	message, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to marshal kline: %v", err)
+		return
+	}
+
+	h.send(&Event{Type: "kline", Symbol: kline.Symbol, Interval: kline.Resolution, Payload: message})
 }
 
-func (h *Hub) BroadcastTicker(ticker interface{}) {
-	data := map[string]interface{}{
-		"type": "ticker",
-		"data": ticker,
+// BroadcastBookTicker sends a symbol's new best bid and ask. A slow client
+// only gets the latest one; its seq never goes backwards.
+func (h *Hub) BroadcastBookTicker(ticker *domain.BookTicker) {
+	data := envelope("bookTicker", ticker)
+	data.Symbol = ticker.Symbol
+
+	message, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to marshal book ticker: %v", err)
+		return
 	}
-	
+
+	h.send(&Event{Type: "bookTicker", Symbol: ticker.Symbol, Payload: message})
+}
+
+func (h *Hub) BroadcastTicker(ticker *domain.Ticker) {
+	data := envelope("ticker", ticker)
+	data.Symbol = ticker.Symbol
+
 	message, err := json.Marshal(data)
 	if err != nil {
 		log.Printf("Failed to marshal ticker: %v", err)
 		return
 	}
 	
-	h.broadcast <- message
+	h.send(&Event{Type: "ticker", Symbol: ticker.Symbol, Payload: message})
 }
 
-func (h *Hub) BroadcastOrderUpdate(order interface{}) {
-	data := map[string]interface{}{
-		"type": "order_update",
-		"data": order,
+// SendToUser sends a message to every connection of userID that subscribed
+// to the user channel, such as each of the user's open tabs, through the same
+// queues as broadcasts. If the user has none it is only counted as unrouted,
+// and kept for a connection that resumes the user channel.
+func (h *Hub) SendToUser(userID, kind string, payload interface{}) {
+	message, err := json.Marshal(envelope(kind, payload))
+	if err != nil {
+		log.Printf("Failed to marshal %s for user %s: %v", kind, userID, err)
+		return
 	}
-	
+	h.send(&Event{Type: kind, UserID: userID, Payload: message})
+}
+
+// SendToClient sends a message to one connection, whatever it subscribed to.
+// It is queued like a reply, so it is never conflated but counts towards the
+// client falling behind, and isn't ordered with broadcasts sent meanwhile.
+func (h *Hub) SendToClient(client *Client, kind string, payload interface{}) {
+	message, err := json.Marshal(envelope(kind, payload))
+	if err != nil {
+		log.Printf("Failed to marshal %s for client %s: %v", kind, client.conn.RemoteAddr(), err)
+		return
+	}
+	h.deliver(client, message)
+}
+
+// BroadcastSymbolStatus sends a symbol's new state to the clients following
+// it, so they learn of pauses, halts and recoveries without polling
+func (h *Hub) BroadcastSymbolStatus(symbol string, status interface{}) {
+	data := envelope("symbolStatus", status)
+	data.Symbol = symbol
+
 	message, err := json.Marshal(data)
 	if err != nil {
-		log.Printf("Failed to marshal order update: %v", err)
+		log.Printf("Failed to marshal symbol status: %v", err)
 		return
 	}
-	
-	h.broadcast <- message
+
+	h.send(&Event{Type: "symbolStatus", Symbol: symbol, Payload: message})
+}
+
+// BroadcastNotification sends a system notification to every client on the
+// notifications channel. A user's own go through SendToUser.
+func (h *Hub) BroadcastNotification(notification interface{}) {
+	message, err := json.Marshal(envelope("notification", notification))
+	if err != nil {
+		log.Printf("Failed to marshal notification: %v", err)
+		return
+	}
+	h.send(&Event{Type: "notification", Payload: message})
+}
+
+// BroadcastStatus sends the exchange's trading status, which is also
+// replayed to every client that connects later
+func (h *Hub) BroadcastStatus(status interface{}) {
+	data := envelope("status", status)
+
+	message, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to marshal status: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	h.status = message
+	h.mu.Unlock()
+	h.send(&Event{Type: "status", Payload: message})
+}
+
+// Envelope is the message format every client receives: the message's type,
+// the symbol on per-symbol channels, the stream's seq on broadcasts, and ts,
+// the server's time in epoch milliseconds when it was sent, so clients can
+// tell how stale it is when it arrives. Seq is added as the hub sends the
+// message.
+type Envelope struct {
+	Type       string      `json:"type"`
+	Symbol     string      `json:"symbol,omitempty"`
+	Interval   string      `json:"interval,omitempty"`
+	Seq        uint64      `json:"seq,omitempty"`
+	TS         int64       `json:"ts"`
+	Data       interface{} `json:"data"`
+	Correction bool        `json:"correction,omitempty"`
+}
+
+// envelope wraps a payload in the message format every client receives,
+// stamped with the time
+func envelope(kind string, payload interface{}) *Envelope {
+	return &Envelope{Type: kind, TS: time.Now().UnixMilli(), Data: payload}
 }
 
 func (h *Hub) GetClientCount() int {
@@ -122,3 +487,147 @@ func (h *Hub) GetClientCount() int {
 	defer h.mu.RUnlock()
 	return len(h.clients)
 }
+
+// send queues an event for every client, or drops it while broadcasting is
+// paused so publishers never block. With a relay, other instances get it
+// too.
+func (h *Hub) send(event *Event) {
+	if h.paused.Load() {
+		atomic.AddUint64(&h.dropped, 1)
+		return
+	}
+	h.mu.RLock()
+	relay := h.relay
+	h.mu.RUnlock()
+	if relay != nil {
+		relay(*event)
+	}
+	h.enqueue(event)
+}
+
+// enqueue hands an event to Run, dropping it once the hub has stopped
+func (h *Hub) enqueue(event *Event) {
+	select {
+	case h.broadcast <- event:
+	case <-h.done:
+		atomic.AddUint64(&h.dropped, 1)
+	}
+}
+
+// SetRelay shares every event this hub sends with the other instances
+// behind the same load balancer through publish, which must not block.
+// Their events come back through Relay.
+func (h *Hub) SetRelay(publish func(event Event)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.relay = publish
+}
+
+// Relay sends an event another instance published to this instance's
+// clients, as if it had been sent here
+func (h *Hub) Relay(event Event) {
+	if h.paused.Load() {
+		atomic.AddUint64(&h.dropped, 1)
+		return
+	}
+	if event.Type == "status" {
+		h.mu.Lock()
+		h.status = event.Payload
+		h.mu.Unlock()
+	}
+	event.Seq = 0
+	h.enqueue(&event)
+}
+
+// Subscribe registers a subscriber for every event sent from now on. With a
+// non-zero after, it also returns the kept events sent since that sequence,
+// which the subscriber should handle first.
+func (h *Hub) Subscribe(after uint64) (*Subscriber, []*Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subscriber := &Subscriber{events: make(chan *Event, 256)}
+	h.subscribers[subscriber] = true
+
+	missed := make([]*Event, 0)
+	if after > 0 {
+		for _, event := range h.recent {
+			if event.Seq > after {
+				missed = append(missed, event)
+			}
+		}
+	}
+	return subscriber, missed
+}
+
+// CloseSubscribers ends every subscription, so long-lived streams return
+// when the server shuts down
+func (h *Hub) CloseSubscribers() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for subscriber := range h.subscribers {
+		delete(h.subscribers, subscriber)
+		close(subscriber.events)
+	}
+}
+
+// Unsubscribe stops a subscriber's events and closes its channel
+func (h *Hub) Unsubscribe(subscriber *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[subscriber] {
+		delete(h.subscribers, subscriber)
+		close(subscriber.events)
+	}
+}
+
+// Pause stops broadcasting; clients stay connected but receive nothing
+func (h *Hub) Pause() {
+	h.paused.Store(true)
+}
+
+// Resume restarts broadcasting after Pause
+func (h *Hub) Resume() {
+	h.paused.Store(false)
+}
+
+// Dropped counts the messages discarded while paused or after Shutdown
+func (h *Hub) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+// Conflated counts the ticker, book ticker and book diff messages clients'
+// queues never sent because a newer one superseded them while queued
+func (h *Hub) Conflated() uint64 {
+	return atomic.LoadUint64(&h.conflated)
+}
+
+// ConflatedByType breaks Conflated down by message type
+func (h *Hub) ConflatedByType() map[string]uint64 {
+	counts := make(map[string]uint64, len(h.conflatedBy))
+	for kind, count := range h.conflatedBy {
+		counts[kind] = atomic.LoadUint64(count)
+	}
+	return counts
+}
+
+// newConflatedCounts starts a count for every conflatable message type. The
+// map is never written afterwards, so it is read without a lock.
+func newConflatedCounts() map[string]*uint64 {
+	counts := make(map[string]*uint64, len(conflatable))
+	for kind := range conflatable {
+		counts[kind] = new(uint64)
+	}
+	return counts
+}
+
+// Unrouted counts the user messages sent while the user had no connection to
+// this instance. With a relay, the user may be connected to another one.
+func (h *Hub) Unrouted() uint64 {
+	return atomic.LoadUint64(&h.unrouted)
+}
+
+// SlowClients counts the clients disconnected for staying too far behind
+func (h *Hub) SlowClients() uint64 {
+	return atomic.LoadUint64(&h.slowClients)
+}
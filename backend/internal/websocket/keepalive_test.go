@@ -0,0 +1,175 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// startHub runs a hub pinging clients every pingInterval behind a test
+// server, returning the server's WebSocket URL
+func startHub(t *testing.T, pingInterval time.Duration) (*Hub, string) {
+	t.Helper()
+	hub := NewHub()
+	hub.SetKeepalive(pingInterval)
+	go hub.Run()
+	upgrader := &websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := hub.Upgrade(upgrader, w, r, r.RemoteAddr)
+		if err != nil {
+			return
+		}
+		if !hub.Connect(client) {
+			client.Close()
+			return
+		}
+		client.Start()
+	}))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		hub.Shutdown(ctx)
+		server.Close()
+	})
+	return hub, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// dialTrades connects to the hub and subscribes to symbol's trades, reading
+// until the subscription is acknowledged
+func dialTrades(t *testing.T, url, symbol string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := conn.WriteJSON(ClientMessage{Op: OpSubscribe, Channel: ChannelTrades, Symbol: symbol}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var message struct {
+			Type string `json:"type"`
+			Data Reply  `json:"data"`
+		}
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("waiting for the subscription: %v", err)
+		}
+		if message.Type == "ack" && message.Data.Op == OpSubscribe {
+			conn.SetReadDeadline(time.Time{})
+			return conn
+		}
+	}
+}
+
+// readTrades reads conn until it fails, counting the trades it receives
+// and, while reading, answering the hub's pings
+func readTrades(conn *websocket.Conn, trades *atomic.Int64) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			var message struct {
+				Type string `json:"type"`
+			}
+			if json.Unmarshal([]byte(line), &message) == nil && message.Type == "trade" {
+				trades.Add(1)
+			}
+		}
+	}
+}
+
+// waitUntil polls cond until it holds or within has passed
+func waitUntil(within time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(within)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
+
+// A connection that stops reading stops answering pings and is dropped once
+// it has gone a pong wait without a word, while broadcasts carry on
+// reaching a client that keeps reading
+func TestStalledClientIsEvicted(t *testing.T) {
+	const pingInterval = 100 * time.Millisecond
+	pongWait := pingInterval * 3 / 2
+	hub, url := startHub(t, pingInterval)
+
+	healthy := dialTrades(t, url, "BTC-USD")
+	var received atomic.Int64
+	go readTrades(healthy, &received)
+	dialTrades(t, url, "BTC-USD") // and never read again
+	if !waitUntil(time.Second, func() bool { return hub.GetClientCount() == 2 }) {
+		t.Fatalf("%d clients connected, want 2", hub.GetClientCount())
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				hub.BroadcastTrade("BTC-USD", &domain.Trade{ID: "t", Symbol: "BTC-USD", Price: 45000, Quantity: 0.1})
+			}
+		}
+	}()
+
+	stalled := time.Now()
+	// Both pong waits run from the last thing the client sent, which was
+	// before stalled; a ping interval's grace covers scheduling
+	if !waitUntil(pongWait+pingInterval, func() bool { return hub.GetClientCount() == 1 }) {
+		t.Fatalf("the stalled client is still connected %s later", time.Since(stalled))
+	}
+	t.Logf("evicted %s after it stopped reading", time.Since(stalled).Round(time.Millisecond))
+
+	// The reading client answers pings, so it outlives several pong waits,
+	// and keeps receiving broadcasts
+	before := received.Load()
+	time.Sleep(3 * pongWait)
+	if hub.GetClientCount() != 1 {
+		t.Errorf("the reading client was disconnected")
+	}
+	if received.Load() == before {
+		t.Errorf("broadcasts stalled after the eviction")
+	}
+}
+
+// Pings a client sends are answered with a pong carrying their data
+func TestClientPingsAreAnswered(t *testing.T) {
+	_, url := startHub(t, time.Minute)
+	conn := dialTrades(t, url, "BTC-USD")
+
+	pongs := make(chan string, 1)
+	conn.SetPongHandler(func(data string) error {
+		pongs <- data
+		return nil
+	})
+	go readTrades(conn, new(atomic.Int64))
+	if err := conn.WriteControl(websocket.PingMessage, []byte("are you there"), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-pongs:
+		if data != "are you there" {
+			t.Errorf("pong carried %q, want the ping's data", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no pong")
+	}
+}
@@ -0,0 +1,111 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hft-exchange/backend/internal/apierror"
+)
+
+// InboundLimits bounds what one client may send, so a client spamming
+// subscriptions or huge frames can't burn the hub's CPU
+type InboundLimits struct {
+	// MaxMessageSize is the largest message in bytes; a larger one closes
+	// the connection with 1009 (message too big)
+	MaxMessageSize int64
+	// Rate is how many messages a second a client may send, in bursts of up
+	// to Burst, or 0 for no limit. Messages over it are answered with an
+	// error and otherwise ignored.
+	Rate  float64
+	Burst float64
+	// MaxViolations is how many messages over the rate a client may send
+	// before it is disconnected with 1008 (policy violation), or 0 to never
+	// disconnect it
+	MaxViolations int
+}
+
+// DefaultInboundLimits let a client resubscribe to everything after a
+// reconnect without tripping them
+var DefaultInboundLimits = InboundLimits{
+	MaxMessageSize: 512,
+	Rate:           10,
+	Burst:          20,
+	MaxViolations:  50,
+}
+
+// SetInboundLimits sets what each client may send. It must be called before
+// clients connect.
+func (h *Hub) SetInboundLimits(limits InboundLimits) {
+	h.limits = limits
+}
+
+// Violations counts the messages clients sent over their rate or size limit
+func (h *Hub) Violations() uint64 {
+	return atomic.LoadUint64(&h.violations)
+}
+
+// LimitedClients counts the clients disconnected for exceeding their limits
+func (h *Hub) LimitedClients() uint64 {
+	return atomic.LoadUint64(&h.limitedClients)
+}
+
+// inboundBucket is a client's token bucket for the messages it sends. Only
+// the client's read loop uses it.
+type inboundBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow spends a token, reporting false if the client has none left
+func (b *inboundBucket) allow(limits InboundLimits, now time.Time) bool {
+	if limits.Rate <= 0 {
+		return true
+	}
+	burst := math.Max(limits.Burst, 1)
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limits.Rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// throttle rejects a message over the client's rate, returning false once
+// the client has sent too many and is being disconnected. Only the first
+// violation is logged. The rejection echoes the message's op and id.
+func (c *Client) throttle(data []byte) bool {
+	limits := c.hub.limits
+	c.violations++
+	atomic.AddUint64(&c.hub.violations, 1)
+	if c.violations == 1 {
+		log.Printf("WebSocket client %s sent more than %v messages a second; messages over it are rejected", c.conn.RemoteAddr(), limits.Rate)
+	}
+	if limits.MaxViolations > 0 && c.violations >= limits.MaxViolations {
+		atomic.AddUint64(&c.hub.limitedClients, 1)
+		log.Printf("WebSocket client %s disconnected after %d messages over its rate", c.conn.RemoteAddr(), c.violations)
+		message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too many messages")
+		c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait))
+		return false
+	}
+	var message ClientMessage
+	json.Unmarshal(data, &message)
+	c.hub.reply(c, "error", Reply{Op: message.Op, ID: message.ID, Code: apierror.RateLimited, Error: "rate limit exceeded, message ignored"})
+	return true
+}
+
+// oversized records a client disconnected for sending a message over the
+// size limit; the connection already closed it with 1009
+func (c *Client) oversized() {
+	atomic.AddUint64(&c.hub.violations, 1)
+	atomic.AddUint64(&c.hub.limitedClients, 1)
+	log.Printf("WebSocket client %s sent a message over %d bytes, disconnecting", c.conn.RemoteAddr(), c.hub.limits.MaxMessageSize)
+}
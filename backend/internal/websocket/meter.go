@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// compressMin is the smallest message worth compressing; below it the
+// deflate framing costs more than it saves. Control frames, such as pings,
+// are never compressed.
+const compressMin = 256
+
+// meteredConn counts the bytes written to a client's connection, as they go
+// out after compression, for the client and for the hub
+type meteredConn struct {
+	net.Conn
+	written *atomic.Uint64
+	total   *atomic.Uint64
+}
+
+func (c meteredConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(uint64(n))
+	c.total.Add(uint64(n))
+	return n, err
+}
+
+// meteredResponse hands the upgrader a metered connection when it hijacks
+// the request's
+type meteredResponse struct {
+	http.ResponseWriter
+	written *atomic.Uint64
+	total   *atomic.Uint64
+}
+
+func (w meteredResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return meteredConn{Conn: conn, written: w.written, total: w.total}, rw, nil
+}
+
+// Upgrade upgrades a request from address to a client of the hub, counting
+// the bytes written to it. Compression is used when the upgrader enables it
+// and the client offers permessage-deflate. A connection over the hub's
+// connection limits gets a *RejectedError, with nothing written.
+func (h *Hub) Upgrade(upgrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request, address string) (*Client, error) {
+	if err := h.admission.admit(address, time.Now()); err != nil {
+		return nil, err
+	}
+	written := new(atomic.Uint64)
+	conn, err := upgrader.Upgrade(meteredResponse{ResponseWriter: w, written: written, total: &h.bytesWritten}, r, nil)
+	if err != nil {
+		h.admission.release(address)
+		return nil, err
+	}
+	client := NewClient(h, conn)
+	client.address = address
+	client.written = written
+	client.compressed = upgrader.EnableCompression && offersDeflate(r)
+	return client, nil
+}
+
+// offersDeflate reports whether a handshake offers permessage-deflate, which
+// the upgrader then accepts
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, extension := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(extension, ";")
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ModeThroughput is what the clients of one mode receive: how many there
+// are, the bytes per second written to all of them and to each on average
+// over the last second, and the most any one received
+type ModeThroughput struct {
+	Clients              int    `json:"clients"`
+	BytesPerSec          uint64 `json:"bytes_per_sec"`
+	BytesPerSecPerClient uint64 `json:"bytes_per_sec_per_client"`
+	MaxBytesPerSec       uint64 `json:"max_bytes_per_sec"`
+}
+
+// Throughput is the bytes written to clients by how they receive messages:
+// compressed, compact order books without compression, or plain
+type Throughput struct {
+	BytesPerSec uint64         `json:"bytes_per_sec"`
+	Compressed  ModeThroughput `json:"compressed"`
+	Compact     ModeThroughput `json:"compact"`
+	Plain       ModeThroughput `json:"plain"`
+}
+
+// measureThroughput works out how many bytes each client was written since
+// the last call, a second ago. The caller holds h.mu.
+func (h *Hub) measureThroughput() {
+	for client := range h.clients {
+		written := client.written.Load()
+		client.bytesPerSec = written - client.lastWritten
+		client.lastWritten = written
+	}
+}
+
+// Throughput reports the bytes per second written to clients in the last
+// second, per client, after compression
+func (h *Hub) Throughput() Throughput {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var throughput Throughput
+	for client := range h.clients {
+		mode := &throughput.Plain
+		if client.compressed {
+			mode = &throughput.Compressed
+		} else if client.compacting() {
+			mode = &throughput.Compact
+		}
+		mode.Clients++
+		mode.BytesPerSec += client.bytesPerSec
+		if client.bytesPerSec > mode.MaxBytesPerSec {
+			mode.MaxBytesPerSec = client.bytesPerSec
+		}
+		throughput.BytesPerSec += client.bytesPerSec
+	}
+	for _, mode := range []*ModeThroughput{&throughput.Compressed, &throughput.Compact, &throughput.Plain} {
+		if mode.Clients > 0 {
+			mode.BytesPerSecPerClient = mode.BytesPerSec / uint64(mode.Clients)
+		}
+	}
+	return throughput
+}
@@ -0,0 +1,173 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// queueSize is how many messages a client's queue holds before ticker
+	// and book diff messages are dropped to make room
+	queueSize = 256
+	// maxQueueSize is how long a client's queue may grow with messages that
+	// are never dropped before the client is disconnected
+	maxQueueSize = 4 * queueSize
+	// slowClientTimeout is how long a client's queue may stay over queueSize
+	// before the client is disconnected
+	slowClientTimeout = 5 * time.Second
+)
+
+// queued is a message waiting to be written to a client
+type queued struct {
+	kind    string
+	symbol  string
+	payload []byte
+}
+
+// outbox is a client's queue of messages waiting to be written. A ticker,
+// book ticker or book diff queued behind an unwritten one for the same
+// symbol is conflated with it, so a client that falls behind briefly gets
+// the latest rather than a burst of stale ones; one that stays behind is
+// disconnected.
+type outbox struct {
+	mu            sync.Mutex
+	messages      []queued
+	ready         chan struct{} // signalled when messages are queued or the outbox closes
+	closed        bool
+	flush         bool      // whether what is queued is still written once closed
+	closeFrame    []byte    // the close message the writer ends with
+	overflowSince time.Time // when the queue went over queueSize, zero while it isn't
+}
+
+func newOutbox() *outbox {
+	return &outbox{ready: make(chan struct{}, 1)}
+}
+
+// push queues a message, returning the type of the queued message a newer
+// one superseded, if any, whether a queued or the new message was dropped
+// to make room, and false once the client has been too far behind for too
+// long and should be disconnected
+func (o *outbox) push(kind, symbol string, payload []byte) (superseded string, dropped, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return "", false, true
+	}
+
+	if conflatable[kind] {
+		// The queued one moves to the back with the latest in its place
+		if i := o.superseded(kind, symbol); i >= 0 {
+			if latest, ok := supersede(kind, o.messages[i].payload, payload); ok {
+				o.messages = append(o.messages[:i], o.messages[i+1:]...)
+				o.messages = append(o.messages, queued{kind: kind, symbol: symbol, payload: latest})
+				o.signal()
+				return kind, false, true
+			}
+		}
+		if len(o.messages) >= queueSize {
+			return "", true, true
+		}
+	}
+	if len(o.messages) >= queueSize {
+		for i, message := range o.messages {
+			if conflatable[message.kind] {
+				o.messages = append(o.messages[:i], o.messages[i+1:]...)
+				dropped = true
+				break
+			}
+		}
+	}
+	o.messages = append(o.messages, queued{kind: kind, symbol: symbol, payload: payload})
+
+	if len(o.messages) > queueSize {
+		now := time.Now()
+		if o.overflowSince.IsZero() {
+			o.overflowSince = now
+		}
+		if len(o.messages) >= maxQueueSize || now.Sub(o.overflowSince) > slowClientTimeout {
+			return "", dropped, false
+		}
+	}
+	o.signal()
+	return "", dropped, true
+}
+
+// depth is how many messages are waiting to be written
+func (o *outbox) depth() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.messages)
+}
+
+// superseded returns the index of the queued message of kind for symbol, or
+// -1 if there is none. A reply or snapshot queued after it stops the search,
+// as a diff from before a snapshot doesn't apply to the book after it. The
+// caller holds o.mu.
+func (o *outbox) superseded(kind, symbol string) int {
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		message := o.messages[i]
+		if message.kind == "" {
+			break
+		}
+		if message.kind == kind && message.symbol == symbol {
+			return i
+		}
+	}
+	return -1
+}
+
+// take removes and returns everything queued, and whether the outbox has
+// been closed. Once closed it returns nothing more unless it is flushing.
+func (o *outbox) take() ([]queued, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	messages := o.messages
+	o.messages = nil
+	o.overflowSince = time.Time{}
+	if o.closed && !o.flush {
+		messages = nil
+	}
+	return messages, o.closed
+}
+
+// close stops the outbox taking messages, and the writer closes the
+// connection without sending what is still queued
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.closed {
+		o.closed = true
+		o.signal()
+	}
+}
+
+// shutdown stops the outbox taking messages, and the writer sends what is
+// still queued and then frame before closing the connection
+func (o *outbox) shutdown(frame []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.closed {
+		o.closed = true
+		o.flush = true
+		o.closeFrame = frame
+		o.signal()
+	}
+}
+
+// closeMessage is the close frame the writer ends the connection with
+func (o *outbox) closeMessage() []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closeFrame == nil {
+		return []byte{}
+	}
+	return o.closeFrame
+}
+
+// signal wakes the writer. The caller holds o.mu.
+func (o *outbox) signal() {
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,495 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/apierror"
+)
+
+// Channels a client can subscribe to. Market data channels are per symbol;
+// the others take no symbol.
+const (
+	ChannelTicker = "ticker"
+	ChannelTrades = "trades"
+	// ChannelOrderBook sends diffs of the levels that change, which apply to
+	// the snapshot sent on subscribing
+	ChannelOrderBook    = "orderbook"
+	ChannelSymbolStatus = "symbolStatus"
+	// ChannelBookTicker sends a symbol's best bid and ask whenever either
+	// price or quantity changes
+	ChannelBookTicker = "bookTicker"
+	// ChannelKline sends a symbol's forming candle of one interval on every
+	// trade, and once more flagged closed when the interval ends
+	ChannelKline = "kline"
+	// ChannelStatus carries the exchange's trading status, sent once as soon
+	// as it is subscribed to and again on every change
+	ChannelStatus = "status"
+	// ChannelUser carries the authenticated user's own order updates, fills,
+	// balance changes, positions and risk warnings
+	ChannelUser = "user"
+	// ChannelNotifications carries operational notices: system ones, such
+	// as trading halts and delistings, to everyone, and an authenticated
+	// user's own, such as an order the engine rejected, to that user
+	ChannelNotifications = "notifications"
+)
+
+// symbolChannels are the channels subscribed to one symbol at a time
+var symbolChannels = map[string]bool{
+	ChannelTicker:        true,
+	ChannelTrades:        true,
+	ChannelOrderBook:     true,
+	ChannelSymbolStatus:  true,
+	ChannelKline:         true,
+	ChannelBookTicker:    true,
+	ChannelStatus:        false,
+	ChannelUser:          false,
+	ChannelNotifications: false,
+}
+
+// eventChannels is the channel each message type is sent on
+var eventChannels = map[string]string{
+	"ticker":         ChannelTicker,
+	"trade":          ChannelTrades,
+	"trades":         ChannelTrades,
+	"orderbook":      ChannelOrderBook,
+	"orderbook_diff": ChannelOrderBook,
+	"symbolStatus":   ChannelSymbolStatus,
+	"kline":          ChannelKline,
+	"bookTicker":     ChannelBookTicker,
+	"status":         ChannelStatus,
+	"order_update":   ChannelUser,
+	"fill":           ChannelUser,
+	"balance":        ChannelUser,
+	"position":       ChannelUser,
+	"risk_warning":   ChannelUser,
+	"notification":   ChannelNotifications,
+}
+
+// EventChannel is the channel events of type kind are sent on
+func EventChannel(kind string) string {
+	return eventChannels[kind]
+}
+
+// snapshotTypes is the message type each channel's snapshot is sent as
+var snapshotTypes = map[string]string{
+	ChannelTicker:     "ticker",
+	ChannelTrades:     "trades",
+	ChannelOrderBook:  "orderbook",
+	ChannelBookTicker: "bookTicker",
+}
+
+// SnapshotTrades is how many recent trades a trades snapshot holds
+const SnapshotTrades = 20
+
+// Ops a client can send
+const (
+	OpSubscribe   = "subscribe"
+	OpUnsubscribe = "unsubscribe"
+	// OpAuth authenticates the connection with a session token, for clients
+	// that didn't pass one as ?token= when connecting. Sent again with a
+	// renewed token, it keeps the user channel going past the old one's
+	// expiry.
+	OpAuth = "auth"
+)
+
+// Error codes only the WebSocket protocol reports. Its other errors carry
+// the REST API's codes, such as unknown_symbol, invalid_request and
+// unauthorized for a token that doesn't verify.
+const (
+	CodeBadJSON        apierror.Code = "bad_json"
+	CodeUnknownOp      apierror.Code = "unknown_op"
+	CodeUnknownChannel apierror.Code = "unknown_channel"
+	CodeAuthRequired   apierror.Code = "auth_required"
+)
+
+// ProtocolVersion is the version of the message format this server speaks,
+// announced in the welcome message every connection starts with. A client
+// may ask for one of SupportedVersions with ?protocol_version= on the
+// handshake; future envelope changes will be offered as new versions.
+const ProtocolVersion = 1
+
+// SupportedVersions are the protocol versions clients may ask for
+var SupportedVersions = []int{ProtocolVersion}
+
+// Welcome is the first message on every connection
+type Welcome struct {
+	ProtocolVersion   int   `json:"protocol_version"`
+	SupportedVersions []int `json:"supported_versions"`
+}
+
+// ParseProtocolVersion checks the version a handshake asked for, defaulting
+// to ProtocolVersion
+func ParseProtocolVersion(value string) (int, error) {
+	if value == "" {
+		return ProtocolVersion, nil
+	}
+	for _, version := range SupportedVersions {
+		if value == strconv.Itoa(version) {
+			return version, nil
+		}
+	}
+	return 0, apierror.New(apierror.InvalidRequest, "unsupported protocol_version %q, want one of %v", value, SupportedVersions)
+}
+
+// AuthWindow is how long after connecting a client may first authenticate.
+// Connections that haven't by then stay public.
+const AuthWindow = 10 * time.Second
+
+// ClientMessage is a message from a client, such as
+// {"op":"subscribe","channel":"trades","symbol":"BTC-USD"}. ID, if given, is
+// echoed in the reply. Interval is the kline channel's candle width.
+// LastSequence, on a subscribe, resumes the channel after the last message
+// the client received before reconnecting. Format, on an orderbook
+// subscribe, picks FormatJSON or FormatCompact levels for the symbol.
+type ClientMessage struct {
+	Op           string          `json:"op"`
+	Channel      string          `json:"channel"`
+	Symbol       string          `json:"symbol,omitempty"`
+	Interval     string          `json:"interval,omitempty"`
+	Token        string          `json:"token,omitempty"`
+	LastSequence uint64          `json:"last_sequence,omitempty"`
+	Format       string          `json:"format,omitempty"`
+	ID           json.RawMessage `json:"id,omitempty"`
+}
+
+// Reply answers a client message, sent as the data of an "ack" with OK set
+// once it took effect or of an "error" saying why it didn't. Errors carry a
+// Code, and auth acks when the token expires.
+type Reply struct {
+	Op        string          `json:"op,omitempty"`
+	OK        bool            `json:"ok,omitempty"`
+	Channel   string          `json:"channel,omitempty"`
+	Symbol    string          `json:"symbol,omitempty"`
+	Interval  string          `json:"interval,omitempty"`
+	Format    string          `json:"format,omitempty"`
+	UserID    string          `json:"user_id,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	ID        json.RawMessage `json:"id,omitempty"`
+	Code      apierror.Code   `json:"code,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// subscription is one channel, and for market data one symbol of it; for
+// klines, of one interval
+type subscription struct {
+	channel  string
+	symbol   string
+	interval string
+}
+
+// SetSymbolValidator sets how subscriptions' symbols are checked; symbols it
+// rejects get an error reply. Without one any symbol is accepted.
+func (h *Hub) SetSymbolValidator(listed func(symbol string) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listed = listed
+}
+
+// SetKlineIntervals sets the intervals the kline channel can be subscribed
+// to; others get an error reply. Without any, the channel can't be.
+func (h *Hub) SetKlineIntervals(intervals []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.klineIntervals = intervals
+}
+
+// SetTokenVerifier sets how auth ops' session tokens are checked; it
+// returns the user a token was issued to and when it expires. Without one
+// auth ops fail.
+func (h *Hub) SetTokenVerifier(verify func(token string) (string, time.Time, error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.verify = verify
+}
+
+// SetSnapshot sets where the current state sent to clients as they
+// subscribe to channel comes from: the latest ticker, the last
+// SnapshotTrades trades newest first, the order book the next diff
+// broadcast applies to, or the top of book last broadcast. Channels without one send nothing until they change.
+func (h *Hub) SetSnapshot(channel string, snapshot func(symbol string) (interface{}, error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshots[channel] = snapshot
+}
+
+// SymbolSubscribers counts the clients subscribed to any of symbol's
+// channels
+func (h *Hub) SymbolSubscribers(symbol string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	count := 0
+	for client := range h.clients {
+		for sub := range client.subscriptions {
+			if sub.symbol == symbol {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// handleMessage applies a client's message to its subscriptions and replies
+func (h *Hub) handleMessage(client *Client, data []byte) {
+	var message ClientMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		// A message with a field of the wrong type still has its op and id
+		// decoded, to echo
+		h.reply(client, "error", Reply{Op: message.Op, ID: message.ID, Code: CodeBadJSON, Error: "invalid message: " + err.Error()})
+		return
+	}
+	answer := Reply{Op: message.Op, Channel: message.Channel, Symbol: message.Symbol, Interval: message.Interval, Format: message.Format, ID: message.ID}
+	if message.Op == OpAuth {
+		h.authenticate(client, message.Token, answer)
+		return
+	}
+
+	sub, err := h.parseSubscription(&message)
+	if err == nil {
+		err = checkFormat(&message)
+	}
+	if err != nil {
+		h.fail(client, answer, err)
+		return
+	}
+
+	h.mu.Lock()
+	if message.Op == OpSubscribe && sub.channel == ChannelUser && (client.userID == "" || client.expired) {
+		h.mu.Unlock()
+		answer.Code = CodeAuthRequired
+		answer.Error = "channel user needs an authenticated connection; send an auth op or connect with ?token="
+		h.reply(client, "error", answer)
+		return
+	}
+	if message.Op == OpSubscribe && sub.channel == ChannelUser && !client.readScope {
+		h.mu.Unlock()
+		answer.Code = apierror.Forbidden
+		answer.Error = "channel user needs the read scope"
+		h.reply(client, "error", answer)
+		return
+	}
+	if message.Op == OpSubscribe {
+		client.subscriptions[sub] = true
+	} else {
+		delete(client.subscriptions, sub)
+	}
+	if sub.channel == ChannelOrderBook {
+		client.setCompact(sub.symbol, message.Op == OpSubscribe && message.Format == FormatCompact)
+	}
+	if message.Op == OpSubscribe && message.LastSequence != 0 && h.resume(client, sub, message.LastSequence, answer) {
+		h.mu.Unlock()
+		return
+	}
+	status := h.status
+	snapshot := h.snapshots[sub.channel] != nil || (sub.channel == ChannelStatus && status != nil)
+	h.mu.Unlock()
+
+	h.reply(client, "ack", answer)
+	if message.Op != OpSubscribe {
+		return
+	}
+	if message.LastSequence != 0 {
+		h.reply(client, "resync", resyncReply(answer, message.LastSequence, snapshot))
+	}
+	switch sub.channel {
+	case ChannelStatus:
+		if status != nil {
+			h.deliver(client, status)
+		}
+	default:
+		// Taken after the subscription is in place, so nothing sent between
+		// the snapshot and the first update the client receives is missed.
+		// Subscribing again is how a client that missed a book diff gets a
+		// fresh snapshot.
+		snapshot, err := h.Snapshot(sub.channel, sub.symbol)
+		if err != nil {
+			h.fail(client, answer, err)
+		} else if snapshot != nil {
+			h.deliver(client, snapshot)
+		}
+	}
+}
+
+// Snapshot returns the message with channel's current state for symbol, or
+// nil if the channel has no snapshot source
+func (h *Hub) Snapshot(channel, symbol string) ([]byte, error) {
+	h.mu.RLock()
+	snapshot := h.snapshots[channel]
+	h.mu.RUnlock()
+	if snapshot == nil {
+		return nil, nil
+	}
+	state, err := snapshot(symbol)
+	if err != nil {
+		return nil, err
+	}
+	data := envelope(snapshotTypes[channel], state)
+	data.Symbol = symbol
+	return json.Marshal(data)
+}
+
+func (h *Hub) parseSubscription(message *ClientMessage) (subscription, error) {
+	if message.Op != OpSubscribe && message.Op != OpUnsubscribe {
+		return subscription{}, apierror.New(CodeUnknownOp, "unknown op %q, want %s, %s or %s", message.Op, OpSubscribe, OpUnsubscribe, OpAuth)
+	}
+	perSymbol, ok := symbolChannels[message.Channel]
+	if !ok {
+		return subscription{}, apierror.New(CodeUnknownChannel, "unknown channel %q", message.Channel)
+	}
+	if !perSymbol {
+		if message.Symbol != "" {
+			return subscription{}, apierror.New(apierror.InvalidRequest, "channel %s takes no symbol", message.Channel)
+		}
+		return subscription{channel: message.Channel}, nil
+	}
+
+	if message.Symbol == "" {
+		return subscription{}, apierror.New(apierror.InvalidRequest, "channel %s needs a symbol", message.Channel)
+	}
+	h.mu.RLock()
+	listed := h.listed
+	h.mu.RUnlock()
+	// Unsubscribing from a symbol delisted since is still allowed
+	if message.Op == OpSubscribe && listed != nil && !listed(message.Symbol) {
+		return subscription{}, apierror.New(apierror.UnknownSymbol, "unknown symbol %q", message.Symbol)
+	}
+	sub := subscription{channel: message.Channel, symbol: message.Symbol}
+	if message.Channel != ChannelKline {
+		if message.Interval != "" {
+			return subscription{}, apierror.New(apierror.InvalidRequest, "channel %s takes no interval", message.Channel)
+		}
+		return sub, nil
+	}
+
+	h.mu.RLock()
+	intervals := h.klineIntervals
+	h.mu.RUnlock()
+	for _, interval := range intervals {
+		if message.Interval == interval {
+			sub.interval = interval
+			return sub, nil
+		}
+	}
+	if message.Interval == "" {
+		return subscription{}, apierror.New(apierror.InvalidRequest, "channel %s needs an interval, one of %v", message.Channel, intervals)
+	}
+	return subscription{}, apierror.New(apierror.InvalidRequest, "unsupported interval %q, want one of %v", message.Interval, intervals)
+}
+
+// authenticate ties a connection to the user its token was issued to. A
+// connection stays with its first user; it may authenticate again, e.g.
+// with a renewed token, only as the same one. A first auth must come within
+// AuthWindow of connecting. Failures leave the connection as it was, public
+// channels and all.
+func (h *Hub) authenticate(client *Client, token string, answer Reply) {
+	h.mu.RLock()
+	verify := h.verify
+	current := client.userID
+	h.mu.RUnlock()
+	fail := func(code apierror.Code, format string, args ...interface{}) {
+		atomic.AddUint64(&h.authFailures, 1)
+		answer.Code = code
+		answer.Error = fmt.Sprintf(format, args...)
+		h.reply(client, "error", answer)
+	}
+	if verify == nil {
+		fail(apierror.Unavailable, "authentication is not enabled")
+		return
+	}
+	if token == "" {
+		fail(apierror.InvalidRequest, "token is required")
+		return
+	}
+	if current == "" && time.Since(client.connectedAt) > AuthWindow {
+		fail(apierror.Unauthorized, "auth must be sent within %s of connecting; reconnect to use private channels", AuthWindow)
+		return
+	}
+	userID, expiresAt, err := verify(token)
+	if err != nil {
+		fail(apierror.Unauthorized, "%s", err.Error())
+		return
+	}
+
+	h.mu.Lock()
+	current = client.userID
+	if current == "" || current == userID {
+		client.userID = userID
+		client.expiresAt = expiresAt
+		client.expired = false
+		client.readScope = true
+		if !client.closed {
+			h.indexUser(client)
+		}
+	}
+	h.mu.Unlock()
+	if current != "" && current != userID {
+		fail(apierror.Forbidden, "connection is already authenticated as %s", current)
+		return
+	}
+	answer.UserID = userID
+	answer.ExpiresAt = &expiresAt
+	h.reply(client, "ack", answer)
+}
+
+// expireSessions downgrades the connections whose token has expired: their
+// user's messages stop, and they are told so. The user channel stays
+// subscribed, and resumes once they authenticate with a new token.
+func (h *Hub) expireSessions(now time.Time) {
+	h.mu.Lock()
+	notices := make(map[*Client]Reply)
+	for userID, clients := range h.users {
+		for client := range clients {
+			if client.expiresAt.IsZero() || now.Before(client.expiresAt) {
+				continue
+			}
+			client.expired = true
+			delete(clients, client)
+			expiresAt := client.expiresAt
+			notices[client] = Reply{
+				Op:        OpAuth,
+				UserID:    userID,
+				ExpiresAt: &expiresAt,
+				Code:      apierror.Unauthorized,
+				Error:     "session token expired; send an auth op with a new token to resume the user channel",
+			}
+		}
+		if len(clients) == 0 {
+			delete(h.users, userID)
+		}
+	}
+	h.mu.Unlock()
+
+	for client, notice := range notices {
+		h.reply(client, "auth_expired", notice)
+	}
+}
+
+// fail answers a client's message with an error and its code
+func (h *Hub) fail(client *Client, answer Reply, err error) {
+	apiErr := apierror.From(err)
+	answer.Code = apiErr.Code
+	answer.Error = apiErr.Message
+	h.reply(client, "error", answer)
+}
+
+// reply sends one client an answer to its message
+func (h *Hub) reply(client *Client, kind string, answer Reply) {
+	answer.OK = kind == "ack"
+	message, err := json.Marshal(envelope(kind, answer))
+	if err != nil {
+		log.Printf("Failed to marshal reply: %v", err)
+		return
+	}
+	h.deliver(client, message)
+}
+
+// deliver queues a reply or snapshot for one client. They are never
+// conflated, but count towards the client falling behind as broadcasts do.
+func (h *Hub) deliver(client *Client, message []byte) {
+	h.push(client, "", "", message)
+}
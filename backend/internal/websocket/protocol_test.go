@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hft-exchange/backend/internal/apierror"
+)
+
+// A connection authenticated as a user may subscribe to the user channel
+// only if its caller holds the read scope
+func TestUserChannelNeedsReadScope(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	upgrader := &websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := hub.Upgrade(upgrader, w, r, r.RemoteAddr)
+		if err != nil {
+			return
+		}
+		client.SetUser("user-1", time.Now().Add(time.Hour))
+		client.SetReadScope(r.URL.Query().Get("read") == "true")
+		if !hub.Connect(client) {
+			client.Close()
+			return
+		}
+		client.Start()
+	}))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		hub.Shutdown(ctx)
+		server.Close()
+	})
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for _, test := range []struct {
+		read string
+		kind string
+		code apierror.Code
+	}{
+		{"false", "error", apierror.Forbidden},
+		{"true", "ack", ""},
+	} {
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?read="+test.read, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.WriteJSON(ClientMessage{Op: OpSubscribe, Channel: ChannelUser}); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var message struct {
+				Type string `json:"type"`
+				Data Reply  `json:"data"`
+			}
+			if err := conn.ReadJSON(&message); err != nil {
+				t.Fatalf("read=%s: waiting for the answer: %v", test.read, err)
+			}
+			if message.Type != "ack" && message.Type != "error" {
+				continue
+			}
+			if message.Type != test.kind || message.Data.Code != test.code {
+				t.Errorf("read=%s: %s %s %q, want %s %s", test.read, message.Type, message.Data.Code, message.Data.Error, test.kind, test.code)
+			}
+			break
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hft-exchange/backend/internal/domain"
+)
+
+// Shutting the hub down sends every client a going-away close frame, Run
+// returns, and neither the hub nor its clients leave a goroutine behind
+func TestShutdownLeavesNoGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	hub := NewHub()
+	ran := make(chan struct{})
+	go func() {
+		hub.Run()
+		close(ran)
+	}()
+	upgrader := &websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := hub.Upgrade(upgrader, w, r, r.RemoteAddr)
+		if err != nil {
+			return
+		}
+		if !hub.Connect(client) {
+			client.Close()
+			return
+		}
+		client.Start()
+	}))
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	const clients = 5
+	closes := make(chan int, clients)
+	for i := 0; i < clients; i++ {
+		conn := dialTrades(t, url, "BTC-USD")
+		go func() {
+			defer conn.Close()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					code := -1
+					if closeErr, ok := err.(*websocket.CloseError); ok {
+						code = closeErr.Code
+					}
+					closes <- code
+					return
+				}
+			}
+		}()
+	}
+	if !waitUntil(5*time.Second, func() bool { return hub.GetClientCount() == clients }) {
+		t.Fatalf("%d clients connected, want %d", hub.GetClientCount(), clients)
+	}
+	for i := 0; i < 100; i++ {
+		hub.BroadcastTrade("BTC-USD", &domain.Trade{ID: "trade", Symbol: "BTC-USD", Price: 45000, Quantity: 0.1})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	select {
+	case <-ran:
+	default:
+		t.Fatal("Shutdown returned before Run did")
+	}
+	for i := 0; i < clients; i++ {
+		select {
+		case code := <-closes:
+			if code != websocket.CloseGoingAway {
+				t.Errorf("client closed with %d, want %d", code, websocket.CloseGoingAway)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("a client was never closed")
+		}
+	}
+	// Sends after the hub stopped are dropped rather than block
+	hub.BroadcastTrade("BTC-USD", &domain.Trade{ID: "late", Symbol: "BTC-USD", Price: 45000, Quantity: 0.1})
+	server.Close()
+
+	if !waitUntil(5*time.Second, func() bool { return runtime.NumGoroutine() <= before }) {
+		buf := make([]byte, 1<<20)
+		t.Fatalf("%d goroutines after shutdown, %d before:\n%s", runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+	}
+}
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"sync/atomic"
+)
+
+// QueueDepth is how many messages clients had waiting to be written when
+// last sampled: the average over clients and the most any one had
+type QueueDepth struct {
+	Average float64 `json:"average"`
+	Max     int     `json:"max"`
+}
+
+// Stats is how the WebSocket layer is doing. Counters run from when the
+// server started; Clients, Subscribers and QueueDepth are as of now, or
+// the last second's sample.
+type Stats struct {
+	Clients int `json:"clients"`
+	// Connections are the connections admitted against the hub's limits,
+	// including any still upgrading, and those turned away
+	Connections ConnectionStats `json:"connections"`
+	// Subscribers counts the clients on each channel, by symbol for market
+	// data and under "" for channels without one
+	Subscribers map[string]map[string]int `json:"subscribers"`
+	// Broadcast counts the messages sent on each channel, whoever received
+	// them
+	Broadcast       map[string]uint64 `json:"broadcast"`
+	Conflated       uint64            `json:"conflated"`
+	ConflatedByType map[string]uint64 `json:"conflated_by_type"`
+	// Overflowed counts the messages full queues dropped, SlowClients the
+	// clients disconnected for staying behind, and Dropped the messages
+	// discarded while broadcasting was paused or stopped
+	Overflowed        uint64     `json:"overflowed"`
+	SlowClients       uint64     `json:"slow_clients"`
+	Dropped           uint64     `json:"dropped"`
+	Unrouted          uint64     `json:"unrouted"`
+	AuthFailures      uint64     `json:"auth_failures"`
+	InboundViolations uint64     `json:"inbound_violations"`
+	LimitedClients    uint64     `json:"limited_clients"`
+	QueueDepth        QueueDepth `json:"queue_depth"`
+	BytesWritten      uint64     `json:"bytes_written"`
+	Throughput        Throughput `json:"throughput"`
+}
+
+// Stats reports the hub's counters and the clients' current subscriptions
+func (h *Hub) Stats() Stats {
+	stats := Stats{
+		Subscribers:       make(map[string]map[string]int),
+		Broadcast:         make(map[string]uint64, len(h.broadcasts)),
+		Conflated:         h.Conflated(),
+		ConflatedByType:   h.ConflatedByType(),
+		Overflowed:        h.Overflowed(),
+		SlowClients:       h.SlowClients(),
+		Dropped:           h.Dropped(),
+		Unrouted:          h.Unrouted(),
+		AuthFailures:      h.AuthFailures(),
+		InboundViolations: h.Violations(),
+		LimitedClients:    h.LimitedClients(),
+		BytesWritten:      h.bytesWritten.Load(),
+		Throughput:        h.Throughput(),
+		Connections:       h.Connections(),
+	}
+	for channel, count := range h.broadcasts {
+		stats.Broadcast[channel] = atomic.LoadUint64(count)
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	stats.Clients = len(h.clients)
+	stats.QueueDepth = h.queueDepth
+	for client := range h.clients {
+		// A client on several intervals of a symbol's klines counts once
+		counted := make(map[subscription]bool, len(client.subscriptions))
+		for sub := range client.subscriptions {
+			sub.interval = ""
+			if counted[sub] {
+				continue
+			}
+			counted[sub] = true
+			symbols := stats.Subscribers[sub.channel]
+			if symbols == nil {
+				symbols = make(map[string]int)
+				stats.Subscribers[sub.channel] = symbols
+			}
+			symbols[sub.symbol]++
+		}
+	}
+	return stats
+}
+
+// Overflowed counts the messages full client queues dropped to make room
+func (h *Hub) Overflowed() uint64 {
+	return atomic.LoadUint64(&h.overflowed)
+}
+
+// AuthFailures counts the auth ops that were rejected
+func (h *Hub) AuthFailures() uint64 {
+	return atomic.LoadUint64(&h.authFailures)
+}
+
+// sampleQueues records how deep clients' queues are. It runs every second
+// rather than on every push, so the hot path only takes each client's own
+// lock. The caller holds h.mu.
+func (h *Hub) sampleQueues() {
+	var depth QueueDepth
+	total := 0
+	for client := range h.clients {
+		n := client.outbox.depth()
+		total += n
+		if n > depth.Max {
+			depth.Max = n
+		}
+	}
+	if len(h.clients) > 0 {
+		depth.Average = float64(total) / float64(len(h.clients))
+	}
+	h.queueDepth = depth
+}
+
+// newBroadcastCounts starts a count for every channel. The map is never
+// written afterwards, so it is read without a lock.
+func newBroadcastCounts() map[string]*uint64 {
+	counts := make(map[string]*uint64, len(symbolChannels))
+	for channel := range symbolChannels {
+		counts[channel] = new(uint64)
+	}
+	return counts
+}
@@ -0,0 +1,141 @@
+package websocket
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// streamDepth is how many recent messages each channel and symbol keeps
+	// for clients resuming after a reconnect
+	streamDepth = 1000
+	// userStreamDepth is how many each user's own messages keep
+	userStreamDepth = 100
+)
+
+// streamKey is one sequenced stream of messages: a channel, for market data
+// one symbol of it, and for the user channel one user's messages
+type streamKey struct {
+	subscription
+	userID string
+}
+
+// stream numbers its messages and keeps the most recent ones. The last
+// message sent is seq; the ring holds the ones before it, oldest at next
+// once it is full.
+type stream struct {
+	seq  uint64
+	ring [][]byte
+	next int
+}
+
+// add sequences a message and keeps it, returning it with its seq in the
+// envelope
+func (s *stream) add(payload []byte, depth int) []byte {
+	s.seq++
+	payload = withSequence(payload, s.seq)
+	if len(s.ring) < depth {
+		s.ring = append(s.ring, payload)
+	} else {
+		s.ring[s.next] = payload
+		s.next = (s.next + 1) % depth
+	}
+	return payload
+}
+
+// since returns the kept messages after sequence after, oldest first. ok is
+// false when some of them are no longer kept, or after was never sent here.
+func (s *stream) since(after uint64) (missed [][]byte, ok bool) {
+	oldest := s.seq - uint64(len(s.ring)) + 1
+	if after > s.seq || after+1 < oldest {
+		return nil, false
+	}
+	missed = make([][]byte, 0, s.seq-after)
+	for seq := after + 1; seq <= s.seq; seq++ {
+		missed = append(missed, s.ring[(s.next+int(seq-oldest))%len(s.ring)])
+	}
+	return missed, true
+}
+
+// newStreamBase is where this process's streams start numbering: the time
+// it started, in microseconds, so a sequence from before a restart or from
+// another instance never matches one of its own
+func newStreamBase() uint64 {
+	return uint64(time.Now().UnixMicro())
+}
+
+// sequence numbers an event on its stream and keeps it for resuming. The
+// caller holds h.mu.
+func (h *Hub) sequence(event *Event) {
+	channel := eventChannels[event.Type]
+	if channel == "" {
+		return
+	}
+	key := streamKey{subscription{channel: channel, symbol: event.Symbol, interval: event.Interval}, event.UserID}
+	depth := streamDepth
+	if event.UserID != "" {
+		depth = userStreamDepth
+	}
+	event.Payload = h.stream(key).add(event.Payload, depth)
+}
+
+// stream returns key's stream, starting it if nothing was sent on it yet.
+// The caller holds h.mu.
+func (h *Hub) stream(key streamKey) *stream {
+	s := h.streams[key]
+	if s == nil {
+		s = &stream{seq: h.streamBase}
+		h.streams[key] = s
+	}
+	return s
+}
+
+// resume sends a client that subscribed with a last_sequence the ack and
+// then the messages it missed since, before any live ones. It reports false,
+// sending nothing, when they are no longer all kept. The caller holds h.mu,
+// so nothing is sent on the stream meanwhile.
+func (h *Hub) resume(client *Client, sub subscription, after uint64, answer Reply) bool {
+	key := streamKey{subscription: sub}
+	if sub.channel == ChannelUser {
+		key.userID = client.userID
+	}
+	missed, ok := h.stream(key).since(after)
+	if !ok {
+		return false
+	}
+	h.reply(client, "ack", answer)
+	for _, message := range missed {
+		h.deliver(client, message)
+	}
+	return true
+}
+
+// resyncReply tells a client resuming from after that it has to start over
+func resyncReply(answer Reply, after uint64, snapshot bool) Reply {
+	if snapshot {
+		answer.Error = fmt.Sprintf("messages after sequence %d are no longer kept; a snapshot follows", after)
+	} else {
+		answer.Error = fmt.Sprintf("messages after sequence %d are no longer kept; reload through the REST API", after)
+	}
+	return answer
+}
+
+// tsField is where seq goes in a marshalled Envelope. The type, symbol and
+// interval before it are plain strings, so the first match is the field.
+var tsField = []byte(`,"ts":`)
+
+// withSequence adds a message's stream sequence to its envelope as seq,
+// just before ts
+func withSequence(payload []byte, seq uint64) []byte {
+	at := bytes.Index(payload, tsField)
+	if at < 0 {
+		return payload
+	}
+	out := make([]byte, 0, len(payload)+32)
+	out = append(out, payload[:at]...)
+	out = append(out, `,"seq":`...)
+	out = strconv.AppendUint(out, seq, 10)
+	return append(out, payload[at:]...)
+}
@@ -0,0 +1,177 @@
+package wstest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hft-exchange/backend/internal/apierror"
+	ws "github.com/hft-exchange/backend/internal/websocket"
+	"github.com/hft-exchange/backend/internal/wstest"
+)
+
+// rawConn is a plain websocket.Dialer connection, read a message at a time
+// as the protocol documents them rather than through wstest.Conn
+type rawConn struct {
+	t       *testing.T
+	conn    *websocket.Conn
+	pending [][]byte
+}
+
+type rawMessage struct {
+	Type string   `json:"type"`
+	Data ws.Reply `json:"data"`
+}
+
+func dialRaw(ctx context.Context, t *testing.T, server *wstest.Server) *rawConn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &rawConn{t: t, conn: conn}
+}
+
+func (c *rawConn) send(message string) {
+	c.t.Helper()
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// next returns the next message, of however many the server batched into
+// a frame
+func (c *rawConn) next() ([]byte, error) {
+	for len(c.pending) == 0 {
+		c.conn.SetReadDeadline(time.Now().Add(timeout))
+		_, frame, err := c.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		c.pending = bytes.Split(frame, []byte{'\n'})
+	}
+	line := c.pending[0]
+	c.pending = c.pending[1:]
+	return line, nil
+}
+
+// answer skips to the ack or error echoing id, which may be empty for an
+// error to a message without one
+func (c *rawConn) answer(id string) rawMessage {
+	c.t.Helper()
+	for {
+		line, err := c.next()
+		if err != nil {
+			c.t.Fatalf("waiting for the answer to %s: %v", id, err)
+		}
+		var message rawMessage
+		if err := json.Unmarshal(line, &message); err != nil {
+			c.t.Fatalf("invalid message %s: %v", line, err)
+		}
+		if (message.Type == "ack" || message.Type == "error") && string(message.Data.ID) == id {
+			return message
+		}
+	}
+}
+
+// The protocol over a real connection: a welcome first, acks echoing the
+// client's id for each op that took effect
+func TestProtocolConformance(t *testing.T) {
+	ctx, server := start(t)
+	_, token := user(ctx, t, server, "conformer")
+	conn := dialRaw(ctx, t, server)
+
+	first, err := conn.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var welcome struct {
+		Type string     `json:"type"`
+		Data ws.Welcome `json:"data"`
+	}
+	if err := json.Unmarshal(first, &welcome); err != nil {
+		t.Fatal(err)
+	}
+	if welcome.Type != "welcome" || welcome.Data.ProtocolVersion != ws.ProtocolVersion || len(welcome.Data.SupportedVersions) == 0 {
+		t.Fatalf("first message %s, want a welcome announcing protocol version %d", first, ws.ProtocolVersion)
+	}
+
+	for _, step := range []struct {
+		message string
+		id      string
+		check   func(ws.Reply) bool
+	}{
+		{`{"op":"subscribe","channel":"trades","symbol":"BTC-USD","id":1}`, `1`, func(r ws.Reply) bool {
+			return r.Op == ws.OpSubscribe && r.Channel == ws.ChannelTrades && r.Symbol == "BTC-USD"
+		}},
+		{`{"op":"subscribe","channel":"kline","symbol":"BTC-USD","interval":"1m","id":"k"}`, `"k"`, func(r ws.Reply) bool { return r.Interval == "1m" }},
+		{`{"op":"unsubscribe","channel":"trades","symbol":"BTC-USD","id":{"n":2}}`, `{"n":2}`, func(r ws.Reply) bool { return r.Op == ws.OpUnsubscribe }},
+		{`{"op":"auth","token":"` + token + `","id":3}`, `3`, func(r ws.Reply) bool { return r.UserID != "" && r.ExpiresAt != nil }},
+		{`{"op":"subscribe","channel":"user","id":4}`, `4`, func(r ws.Reply) bool { return r.Channel == ws.ChannelUser }},
+	} {
+		conn.send(step.message)
+		answer := conn.answer(step.id)
+		if answer.Type != "ack" || !answer.Data.OK || !step.check(answer.Data) {
+			t.Errorf("%s: got %s %+v, want an ok ack", step.message, answer.Type, answer.Data)
+		}
+	}
+}
+
+// Every message the server can't act on gets an error with a code, echoing
+// the message's id, and the connection carries on
+func TestProtocolErrors(t *testing.T) {
+	ctx, server := start(t)
+
+	for _, test := range []struct {
+		name    string
+		message string
+		id      string
+		code    apierror.Code
+	}{
+		{"not json", `subscribe me`, ``, ws.CodeBadJSON},
+		{"field of the wrong type", `{"op":"subscribe","channel":42,"id":1}`, `1`, ws.CodeBadJSON},
+		{"unknown op", `{"op":"dance","id":2}`, `2`, ws.CodeUnknownOp},
+		{"unknown channel", `{"op":"subscribe","channel":"gossip","symbol":"BTC-USD","id":3}`, `3`, ws.CodeUnknownChannel},
+		{"user channel without auth", `{"op":"subscribe","channel":"user","id":4}`, `4`, ws.CodeAuthRequired},
+		{"unlisted symbol", `{"op":"subscribe","channel":"trades","symbol":"DOGE-USD","id":5}`, `5`, apierror.UnknownSymbol},
+		{"bad token", `{"op":"auth","token":"forged","id":6}`, `6`, apierror.Unauthorized},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conn := dialRaw(ctx, t, server)
+			conn.send(test.message)
+			answer := conn.answer(test.id)
+			if answer.Type != "error" || answer.Data.OK || answer.Data.Code != test.code || answer.Data.Error == "" {
+				t.Errorf("got %s %+v, want an error coded %s", answer.Type, answer.Data, test.code)
+			}
+			conn.send(`{"op":"subscribe","channel":"trades","symbol":"BTC-USD","id":"after"}`)
+			if answer := conn.answer(`"after"`); answer.Type != "ack" {
+				t.Errorf("after the error: got %s %+v, want an ack", answer.Type, answer.Data)
+			}
+		})
+	}
+
+	t.Run("over the rate", func(t *testing.T) {
+		conn := dialRaw(ctx, t, server)
+		sent := int(ws.DefaultInboundLimits.Burst) + 5
+		for i := 1; i <= sent; i++ {
+			conn.send(fmt.Sprintf(`{"op":"subscribe","channel":"trades","symbol":"BTC-USD","id":%d}`, i))
+		}
+		answer := conn.answer(fmt.Sprint(sent))
+		if answer.Type != "error" || answer.Data.Code != apierror.RateLimited || answer.Data.Op != ws.OpSubscribe {
+			t.Errorf("message %d over the burst: got %s %+v, want an error coded %s", sent, answer.Type, answer.Data, apierror.RateLimited)
+		}
+	})
+
+	t.Run("unsupported protocol version", func(t *testing.T) {
+		_, response, err := websocket.DefaultDialer.DialContext(ctx, server.URL+"?protocol_version=99", nil)
+		if err == nil || response == nil || response.StatusCode != http.StatusBadRequest {
+			t.Errorf("handshake asking for version 99: %v, want 400", err)
+		}
+	})
+}
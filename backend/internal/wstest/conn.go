@@ -0,0 +1,253 @@
+package wstest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	ws "github.com/hft-exchange/backend/internal/websocket"
+)
+
+// Message is one message as a client receives it. Data is left raw for
+// Decode, into the domain type the message carries. Raw is the message as
+// the server wrote it.
+type Message struct {
+	Type     string          `json:"type"`
+	Symbol   string          `json:"symbol,omitempty"`
+	Interval string          `json:"interval,omitempty"`
+	Seq      uint64          `json:"seq,omitempty"`
+	TS       int64           `json:"ts"`
+	Data     json.RawMessage `json:"data"`
+	Raw      json.RawMessage `json:"-"`
+}
+
+// Decode unmarshals the message's data into v
+func (m *Message) Decode(v interface{}) error {
+	if err := json.Unmarshal(m.Data, v); err != nil {
+		return fmt.Errorf("decoding %s message: %w", m.Type, err)
+	}
+	return nil
+}
+
+// Reply decodes an ack or error's data
+func (m *Message) Reply() (ws.Reply, error) {
+	var reply ws.Reply
+	err := m.Decode(&reply)
+	return reply, err
+}
+
+// Conn is a client connection whose messages are read in the background, as
+// fast as the server sends them, and kept in the order they arrived. Next
+// and Expect consume them; Received returns all of them.
+type Conn struct {
+	conn *websocket.Conn
+
+	mu       sync.Mutex
+	received []*Message
+	next     int           // the first message Next hasn't returned
+	arrived  chan struct{} // signalled as messages are read
+	done     chan struct{} // closed once reading stops
+	err      error         // why it stopped
+	started  bool
+}
+
+// Dial connects to a Server's URL, authenticated as token's user unless it
+// is empty, and starts reading
+func Dial(ctx context.Context, serverURL, token string) (*Conn, error) {
+	c, err := dial(ctx, serverURL, token)
+	if err != nil {
+		return nil, err
+	}
+	c.Resume()
+	return c, nil
+}
+
+// DialStalled connects like Dial but reads nothing until Resume, so the
+// server's writes back up the way they do for a client that can't keep up
+func DialStalled(ctx context.Context, serverURL string) (*Conn, error) {
+	return dial(ctx, serverURL, "")
+}
+
+func dial(ctx context.Context, serverURL, token string) (*Conn, error) {
+	if token != "" {
+		u, err := url.Parse(serverURL)
+		if err != nil {
+			return nil, err
+		}
+		query := u.Query()
+		query.Set("token", token)
+		u.RawQuery = query.Encode()
+		serverURL = u.String()
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, serverURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn, arrived: make(chan struct{}, 1), done: make(chan struct{})}, nil
+}
+
+// Resume starts reading a connection made with DialStalled
+func (c *Conn) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.started {
+		c.started = true
+		go c.read()
+	}
+}
+
+// read keeps every message until the connection ends. The server may batch
+// several messages into one frame, a line each.
+func (c *Conn) read() {
+	defer close(c.done)
+	for {
+		_, frame, err := c.conn.ReadMessage()
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			return
+		}
+		for _, line := range bytes.Split(frame, []byte{'\n'}) {
+			message := &Message{Raw: append(json.RawMessage(nil), line...)}
+			if err := json.Unmarshal(line, message); err != nil {
+				c.mu.Lock()
+				c.err = fmt.Errorf("invalid message %q: %w", line, err)
+				c.mu.Unlock()
+				c.conn.Close()
+				return
+			}
+			c.mu.Lock()
+			c.received = append(c.received, message)
+			c.mu.Unlock()
+		}
+		select {
+		case c.arrived <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Send writes a message to the server
+func (c *Conn) Send(message ws.ClientMessage) error {
+	return c.conn.WriteJSON(message)
+}
+
+// Subscribe subscribes to channel, for symbol unless it takes none, and
+// waits for the server to acknowledge it. Messages before the ack are
+// skipped.
+func (c *Conn) Subscribe(channel, symbol string, timeout time.Duration) error {
+	if err := c.Send(ws.ClientMessage{Op: ws.OpSubscribe, Channel: channel, Symbol: symbol}); err != nil {
+		return err
+	}
+	message, err := c.Expect(timeout, func(m *Message) bool {
+		if m.Type != "ack" && m.Type != "error" {
+			return false
+		}
+		reply, err := m.Reply()
+		return err == nil && reply.Op == ws.OpSubscribe && reply.Channel == channel && reply.Symbol == symbol
+	})
+	if err != nil {
+		return err
+	}
+	if message.Type == "error" {
+		reply, _ := message.Reply()
+		return fmt.Errorf("subscribing to %s %s: %s: %s", channel, symbol, reply.Code, reply.Error)
+	}
+	return nil
+}
+
+// Next returns the next message, waiting up to timeout for one
+func (c *Conn) Next(timeout time.Duration) (*Message, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		c.mu.Lock()
+		if c.next < len(c.received) {
+			message := c.received[c.next]
+			c.next++
+			c.mu.Unlock()
+			return message, nil
+		}
+		err := c.err
+		c.mu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("connection ended: %w", err)
+		}
+
+		select {
+		case <-c.arrived:
+		case <-c.done:
+		case <-deadline.C:
+			return nil, fmt.Errorf("no message within %s", timeout)
+		}
+	}
+}
+
+// Expect returns the next message match accepts, skipping the others,
+// waiting up to timeout for one
+func (c *Conn) Expect(timeout time.Duration, match func(*Message) bool) (*Message, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		message, err := c.Next(time.Until(deadline))
+		if err != nil {
+			return nil, err
+		}
+		if match(message) {
+			return message, nil
+		}
+	}
+}
+
+// ExpectType returns the next message of type kind
+func (c *Conn) ExpectType(kind string, timeout time.Duration) (*Message, error) {
+	message, err := c.Expect(timeout, func(m *Message) bool { return m.Type == kind })
+	if err != nil {
+		return nil, fmt.Errorf("waiting for %s: %w", kind, err)
+	}
+	return message, nil
+}
+
+// Quiet checks that nothing match accepts arrives within wait
+func (c *Conn) Quiet(wait time.Duration, match func(*Message) bool) error {
+	message, err := c.Expect(wait, match)
+	if err != nil {
+		return nil
+	}
+	return fmt.Errorf("unexpected %s message: %s", message.Type, message.Data)
+}
+
+// Received returns every message read so far, in the order they arrived
+func (c *Conn) Received() []*Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Message(nil), c.received...)
+}
+
+// Ended waits up to timeout for the connection to end, reporting whether it
+// did; Err then says how
+func (c *Conn) Ended(timeout time.Duration) bool {
+	select {
+	case <-c.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Err is why the connection ended, or nil while it hasn't
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
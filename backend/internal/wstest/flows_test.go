@@ -0,0 +1,275 @@
+package wstest_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/websocket"
+	"github.com/hft-exchange/backend/internal/wstest"
+)
+
+// timeout is how long any one expected message may take to arrive
+const timeout = 5 * time.Second
+
+// The server logs every connection; -v shows it
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// start runs a server of the test's own, closed when the test ends
+func start(t *testing.T) (context.Context, *wstest.Server) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	server, err := wstest.Start()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return ctx, server
+}
+
+func user(ctx context.Context, t *testing.T, server *wstest.Server, username string) (userID, token string) {
+	t.Helper()
+	userID, token, err := server.User(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID, token
+}
+
+func dial(ctx context.Context, t *testing.T, server *wstest.Server, token string) *wstest.Conn {
+	t.Helper()
+	conn, err := wstest.Dial(ctx, server.URL, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func limit(ctx context.Context, t *testing.T, server *wstest.Server, userID, symbol string, side domain.OrderSide, quantity, price float64) *domain.Order {
+	t.Helper()
+	order, err := server.Limit(ctx, userID, symbol, side, quantity, price)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// A crossing order's trade is broadcast on the trades channel, and trades
+// are numbered without a gap
+func TestTradeBroadcastAfterCrossingOrder(t *testing.T) {
+	ctx, server := start(t)
+	seller, _ := user(ctx, t, server, "seller")
+	buyer, _ := user(ctx, t, server, "buyer")
+	watcher := dial(ctx, t, server, "")
+	if err := watcher.Subscribe(websocket.ChannelTrades, "BTC-USD", timeout); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, price := range []float64{45000, 45010} {
+		sell, err := server.Rest(ctx, seller, "BTC-USD", domain.OrderSideSell, 0.01, price)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buy := limit(ctx, t, server, buyer, "BTC-USD", domain.OrderSideBuy, 0.01, price+5)
+		message, err := watcher.ExpectType("trade", timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var trade domain.Trade
+		if err := message.Decode(&trade); err != nil {
+			t.Fatal(err)
+		}
+		if trade.SellOrderID != sell.ID || trade.BuyOrderID != buy.ID {
+			t.Errorf("trade %s is between orders %s and %s, want %s and %s", trade.ID, trade.BuyOrderID, trade.SellOrderID, buy.ID, sell.ID)
+		}
+		if trade.Price != price || trade.Quantity != 0.01 {
+			t.Errorf("trade %s is %g at %g, want 0.01 at the resting price %g", trade.ID, trade.Quantity, trade.Price, price)
+		}
+	}
+	if err := wstest.Contiguous(watcher.Received()); err != nil {
+		t.Error(err)
+	}
+}
+
+// Resting an order and cancelling it sends a diff that adds its level and
+// one that removes it, each following on from the book before it
+func TestOrderBookDiffAfterCancel(t *testing.T) {
+	ctx, server := start(t)
+	maker, _ := user(ctx, t, server, "maker")
+	watcher := dial(ctx, t, server, "")
+	if err := watcher.Subscribe(websocket.ChannelOrderBook, "BTC-USD", timeout); err != nil {
+		t.Fatal(err)
+	}
+	message, err := watcher.ExpectType("orderbook", timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot domain.OrderBook
+	if err := message.Decode(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each diff must apply to the book the last one left
+	seq := snapshot.Seq
+	expectLevel := func(price, quantity float64) {
+		t.Helper()
+		var gap error
+		_, err := watcher.Expect(timeout, func(m *wstest.Message) bool {
+			var diff domain.OrderBookDiff
+			if m.Type != "orderbook_diff" || m.Decode(&diff) != nil {
+				return false
+			}
+			if diff.PrevSeq != seq {
+				gap = fmt.Errorf("diff from seq %d doesn't follow on from %d", diff.PrevSeq, seq)
+				return true
+			}
+			seq = diff.Seq
+			for _, level := range diff.Bids {
+				if level.Price == price && level.Quantity == quantity {
+					return true
+				}
+			}
+			return false
+		})
+		if err != nil {
+			t.Fatalf("waiting for bid %g to be %g: %v", price, quantity, err)
+		}
+		if gap != nil {
+			t.Fatal(gap)
+		}
+	}
+
+	order := limit(ctx, t, server, maker, "BTC-USD", domain.OrderSideBuy, 0.02, 44000)
+	expectLevel(44000, 0.02)
+	if err := server.Cancel(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	expectLevel(44000, 0)
+
+	received := watcher.Received()
+	if err := wstest.Before(received, wstest.OfType("orderbook"), wstest.OfType("orderbook_diff")); err != nil {
+		t.Errorf("snapshot and diffs: %v", err)
+	}
+	if err := wstest.Increasing(received); err != nil {
+		t.Error(err)
+	}
+}
+
+// An order's updates reach its user's connection and no other, and a
+// connection that isn't authenticated can't subscribe to the user channel
+func TestOrderUpdatesOnlyToTheirUser(t *testing.T) {
+	ctx, server := start(t)
+	owner, ownerToken := user(ctx, t, server, "owner")
+	_, otherToken := user(ctx, t, server, "other")
+	mine := dial(ctx, t, server, ownerToken)
+	theirs := dial(ctx, t, server, otherToken)
+	anonymous := dial(ctx, t, server, "")
+	for _, conn := range []*wstest.Conn{mine, theirs} {
+		if err := conn.Subscribe(websocket.ChannelUser, "", timeout); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := anonymous.Subscribe(websocket.ChannelUser, "", timeout); err == nil {
+		t.Error("an unauthenticated connection subscribed to the user channel")
+	}
+
+	order := limit(ctx, t, server, owner, "ETH-USD", domain.OrderSideBuy, 0.1, 2400)
+	isUpdate := func(status domain.OrderStatus) func(*wstest.Message) bool {
+		return func(m *wstest.Message) bool {
+			var update domain.Order
+			return m.Type == "order_update" && m.Decode(&update) == nil && update.ID == order.ID && (status == "" || update.Status == status)
+		}
+	}
+	if _, err := mine.Expect(timeout, isUpdate(domain.OrderStatusPending)); err != nil {
+		t.Fatalf("waiting for the order to be accepted: %v", err)
+	}
+	if err := server.Cancel(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mine.Expect(timeout, isUpdate(domain.OrderStatusCancelled)); err != nil {
+		t.Fatalf("waiting for the order to be cancelled: %v", err)
+	}
+	if err := wstest.Contiguous(mine.Received()); err != nil {
+		t.Error(err)
+	}
+	if err := theirs.Quiet(500*time.Millisecond, isUpdate("")); err != nil {
+		t.Errorf("another user's connection: %v", err)
+	}
+}
+
+// A client that stops reading is disconnected once it falls behind, while
+// one that keeps reading gets every trade, in order, and stays connected
+func TestSlowClientEviction(t *testing.T) {
+	ctx, server := start(t)
+	healthy := dial(ctx, t, server, "")
+	if err := healthy.Subscribe(websocket.ChannelTrades, "SOL-USD", timeout); err != nil {
+		t.Fatal(err)
+	}
+	stalled, err := wstest.DialStalled(ctx, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stalled.Close() })
+	// It won't read the ack, so wait until the hub counts it instead
+	if err := stalled.Send(websocket.ClientMessage{Op: websocket.OpSubscribe, Channel: websocket.ChannelTrades, Symbol: "SOL-USD"}); err != nil {
+		t.Fatal(err)
+	}
+	for server.Hub.Stats().Subscribers[websocket.ChannelTrades]["SOL-USD"] < 2 {
+		if ctx.Err() != nil {
+			t.Fatal("the stalled client's subscription never took effect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Batches smaller than a client's queue, each read by the healthy client
+	// before the next, so only the stalled one falls behind
+	slow := server.Hub.SlowClients()
+	sent := 0
+	for server.Hub.SlowClients() == slow {
+		if ctx.Err() != nil {
+			t.Fatalf("the stalled client was still connected after %d trades", sent)
+		}
+		var last string
+		for i := 0; i < 200; i++ {
+			sent++
+			last = fmt.Sprintf("trade-%d", sent)
+			server.Hub.BroadcastTrade("SOL-USD", &domain.Trade{ID: last, Symbol: "SOL-USD", Price: 100, Quantity: 1, ExecutedAt: time.Now()})
+		}
+		if _, err := healthy.Expect(timeout, isTrade(last)); err != nil {
+			t.Fatalf("healthy client after %d trades: %v", sent, err)
+		}
+	}
+
+	stalled.Resume()
+	if !stalled.Ended(timeout) {
+		t.Fatal("the stalled client was counted slow but is still connected")
+	}
+	server.Hub.BroadcastTrade("SOL-USD", &domain.Trade{ID: "after", Symbol: "SOL-USD", Price: 100, Quantity: 1, ExecutedAt: time.Now()})
+	if _, err := healthy.Expect(timeout, isTrade("after")); err != nil {
+		t.Fatalf("healthy client after the eviction: %v", err)
+	}
+	if err := wstest.Contiguous(healthy.Received()); err != nil {
+		t.Error(err)
+	}
+}
+
+func isTrade(id string) func(*wstest.Message) bool {
+	return func(m *wstest.Message) bool {
+		var trade domain.Trade
+		return m.Type == "trade" && m.Decode(&trade) == nil && trade.ID == id
+	}
+}
@@ -0,0 +1,75 @@
+package wstest
+
+import (
+	"fmt"
+
+	ws "github.com/hft-exchange/backend/internal/websocket"
+)
+
+// Checks over the messages a connection received, for the ordering the
+// protocol promises
+
+// streamOf is the sequenced stream a message belongs to, or "" for acks,
+// errors and snapshots, which carry no seq
+func streamOf(m *Message) string {
+	channel := ws.EventChannel(m.Type)
+	if channel == "" || m.Seq == 0 {
+		return ""
+	}
+	return channel + "/" + m.Symbol + "/" + m.Interval
+}
+
+// Increasing checks that the seq of each stream's messages only goes up.
+// Channels whose queued messages are conflated, such as book diffs, may skip
+// sequences but never repeat or reorder them.
+func Increasing(messages []*Message) error {
+	last := make(map[string]uint64)
+	for i, m := range messages {
+		stream := streamOf(m)
+		if stream == "" {
+			continue
+		}
+		if previous, ok := last[stream]; ok && m.Seq <= previous {
+			return fmt.Errorf("message %d (%s) has seq %d after %d on %s", i, m.Type, m.Seq, previous, stream)
+		}
+		last[stream] = m.Seq
+	}
+	return nil
+}
+
+// Contiguous checks that each stream's messages follow one another without
+// a gap, as they must on channels nothing is conflated on, such as trades
+// and the user channel
+func Contiguous(messages []*Message) error {
+	last := make(map[string]uint64)
+	for i, m := range messages {
+		stream := streamOf(m)
+		if stream == "" {
+			continue
+		}
+		if previous, ok := last[stream]; ok && m.Seq != previous+1 {
+			return fmt.Errorf("message %d (%s) has seq %d after %d on %s", i, m.Type, m.Seq, previous, stream)
+		}
+		last[stream] = m.Seq
+	}
+	return nil
+}
+
+// Before checks that a message first accepts arrived, and ahead of any then
+// accepts
+func Before(messages []*Message, first, then func(*Message) bool) error {
+	for i, m := range messages {
+		if first(m) {
+			return nil
+		}
+		if then(m) {
+			return fmt.Errorf("message %d (%s) arrived before the one expected first", i, m.Type)
+		}
+	}
+	return fmt.Errorf("the message expected first never arrived")
+}
+
+// OfType matches messages of type kind, for Before and Expect
+func OfType(kind string) func(*Message) bool {
+	return func(m *Message) bool { return m.Type == kind }
+}
@@ -0,0 +1,326 @@
+// Package wstest runs the API end to end for integration tests: a real hub,
+// exchange and router listening on a loopback port, with balances kept in
+// memory and accounts, orders, trades and candles in an in-memory SQLite
+// database. Conn dials it like any client would.
+package wstest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hft-exchange/backend/internal/accounts"
+	"github.com/hft-exchange/backend/internal/api"
+	"github.com/hft-exchange/backend/internal/candles"
+	"github.com/hft-exchange/backend/internal/database"
+	"github.com/hft-exchange/backend/internal/domain"
+	"github.com/hft-exchange/backend/internal/engine"
+	"github.com/hft-exchange/backend/internal/engine/enginetest"
+	"github.com/hft-exchange/backend/internal/repository"
+	ws "github.com/hft-exchange/backend/internal/websocket"
+)
+
+// Prices are the reference prices each default symbol starts at, so orders
+// near them are inside the price bands
+var Prices = map[string]float64{
+	"BTC-USD":  45000.0,
+	"ETH-USD":  2500.0,
+	"SOL-USD":  100.0,
+	"USDC-USD": 1.0,
+}
+
+// TradeKey is an API key holding the trade scope without being any user's,
+// as a broker's or bot's key might
+const TradeKey = "wstest-trade-key"
+
+// databases numbers the in-memory databases, so servers running at once
+// don't share one
+var databases atomic.Uint64
+
+// Server is the exchange serving REST and WebSocket clients the way
+// cmd/server wires it, minus Redis, the price feed and the bots: trades,
+// book diffs, top of book and klines are broadcast, and order updates,
+// fills and balances go to their users.
+type Server struct {
+	// URL is the /ws endpoint to dial
+	URL string
+	// BaseURL is where the REST API is served, without a trailing slash
+	BaseURL  string
+	Hub      *ws.Hub
+	Exchange *engine.Exchange
+
+	db       *database.DB
+	store    *enginetest.Store
+	accounts *accounts.Service
+	candles  *candles.Service
+	server   *http.Server
+
+	// published holds the orders and trades the exchange has finished
+	// with: updated or saved, and sent to their users
+	mu        sync.Mutex
+	published map[string]bool
+}
+
+// Start lists the default symbols at Prices and starts serving
+func Start() (*Server, error) {
+	db, err := database.NewDB(fmt.Sprintf("sqlite://file:wstest-%d?mode=memory&cache=shared", databases.Add(1)))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.InitSchema(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	userRepo := repository.NewUserRepository(db.DB)
+	accountService, err := accounts.NewService(userRepo, "wstest")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	orders := repository.NewOrderRepository(db.DB)
+	trades := repository.NewTradeRepository(db.DB)
+	store := enginetest.NewStore()
+	tickers := repository.NewTickerRepository(db.DB)
+	exchange := engine.NewExchange(trades, orders, store)
+	for _, config := range domain.DefaultSymbolConfigs() {
+		if err := exchange.AddSymbol(config); err != nil {
+			db.Close()
+			return nil, err
+		}
+		price := Prices[config.Symbol]
+		exchange.UpdatePrice(config.Symbol, price)
+		// Listing a symbol starts its ticker at the listing price, as the
+		// server does
+		ticker := &domain.Ticker{Symbol: config.Symbol, Price: price, High24h: price, Low24h: price, UpdatedAt: time.Now()}
+		if err := tickers.CreateTicker(context.Background(), ticker); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	hub := ws.NewHub()
+	hub.SetSymbolValidator(func(symbol string) bool {
+		_, listed := exchange.SymbolConfig(symbol)
+		return listed
+	})
+	hub.SetTokenVerifier(accountService.Verify)
+	hub.SetSnapshot(ws.ChannelOrderBook, func(symbol string) (interface{}, error) {
+		return exchange.PublishedOrderBook(symbol)
+	})
+	hub.SetSnapshot(ws.ChannelBookTicker, func(symbol string) (interface{}, error) {
+		return exchange.BookTicker(symbol)
+	})
+	candleService := candles.NewService(repository.NewCandleRepository(db.DB), exchange.GetAllSymbols)
+	candleService.SetOnKlineCallback(func(update candles.KlineUpdate) {
+		hub.BroadcastKline(&update.Kline, update.Correction)
+	})
+	hub.SetKlineIntervals(candles.Intervals)
+
+	s := &Server{
+		Hub:       hub,
+		Exchange:  exchange,
+		db:        db,
+		store:     store,
+		accounts:  accountService,
+		candles:   candleService,
+		published: make(map[string]bool),
+	}
+	exchange.SetOnBookTickerCallback(hub.BroadcastBookTicker)
+	exchange.SetOnOrderBookCallback(hub.BroadcastOrderBookDiff)
+	exchange.SetOnTradeCallback(func(trade *domain.Trade) {
+		candleService.RecordTrade(trade)
+		hub.BroadcastTrade(trade.Symbol, trade)
+		hub.SendToUser(trade.BuyerID, "fill", domain.FillOf(trade, trade.BuyOrderID))
+		hub.SendToUser(trade.SellerID, "fill", domain.FillOf(trade, trade.SellOrderID))
+		s.publish(trade.ID)
+	})
+	exchange.SetOnOrderUpdateCallback(func(order *domain.Order) {
+		hub.SendToUser(order.UserID, "order_update", order)
+		s.publish(order.ID)
+	})
+	exchange.SetOnBalanceUpdateCallback(func(update *engine.BalanceUpdate) {
+		hub.SendToUser(update.UserID, "balance", update)
+	})
+	go hub.Run()
+	exchange.Start()
+	candleService.Start()
+
+	handler := api.NewHandler(
+		exchange,
+		orders,
+		trades,
+		repository.NewBalanceRepository(db.DB),
+		tickers,
+		repository.NewPositionRepository(db.DB),
+	)
+	auth := api.NewAuth([]*api.APIKey{{Name: "trader", Secret: TradeKey, Scopes: []api.Scope{api.ScopeTrade}}}, api.ScopeAdmin, 0)
+	auth.SetTokens(accountService)
+	handler.SetAuth(auth)
+	handler.SetAccounts(accountService)
+	handler.SetUsers(userRepo)
+	handler.SetCandles(candleService)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		candleService.Stop()
+		exchange.Stop()
+		db.Close()
+		return nil, err
+	}
+	s.URL = "ws://" + listener.Addr().String() + "/ws"
+	s.BaseURL = "http://" + listener.Addr().String()
+	s.server = &http.Server{Handler: api.NewRouter(handler, hub)}
+	s.server.RegisterOnShutdown(hub.CloseSubscribers)
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// Close disconnects every client and stops the server
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	if hubErr := s.Hub.Shutdown(ctx); err == nil {
+		err = hubErr
+	}
+	s.candles.Stop()
+	s.Exchange.Stop()
+	s.db.Close()
+	return err
+}
+
+func (s *Server) publish(id string) {
+	s.mu.Lock()
+	s.published[id] = true
+	s.mu.Unlock()
+}
+
+// Await waits until the exchange has finished with each order and trade in
+// ids: an order once it has been matched and its update sent, a trade once
+// it has been saved, settled and sent. Orders placed through the REST API
+// are matched in the background, and trades saved after the response.
+func (s *Server) Await(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		for {
+			s.mu.Lock()
+			done := s.published[id]
+			s.mu.Unlock()
+			if done {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%s was never published: %w", id, ctx.Err())
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}
+	return nil
+}
+
+// User registers a user with the starter balances and logs them in,
+// returning their ID and session token
+func (s *Server) User(ctx context.Context, username string) (userID, token string, err error) {
+	if _, err := s.accounts.Register(ctx, username, username+"@example.com", "wstest-password"); err != nil {
+		return "", "", err
+	}
+	session, err := s.accounts.Login(ctx, username, "wstest-password")
+	if err != nil {
+		return "", "", err
+	}
+	for _, amount := range domain.StarterBalances {
+		s.store.Deposit(session.User.ID, amount.Asset, amount.Amount)
+	}
+	return session.User.ID, session.Token, nil
+}
+
+// AwaitBook waits until symbol's streamed book has caught up with the
+// engine's. Changes are published at most every 100ms, coalesced, so a
+// subscriber's snapshot can otherwise miss the latest of them.
+func (s *Server) AwaitBook(ctx context.Context, symbol string) error {
+	for {
+		published, err := s.Exchange.PublishedOrderBook(symbol)
+		if err != nil {
+			return err
+		}
+		live := s.Exchange.GetOrderBook(symbol, engine.StreamedBookDepth)
+		if sameLevels(published.Bids, live.Bids) && sameLevels(published.Asks, live.Asks) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s book was never published: %w", symbol, ctx.Err())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func sameLevels(a, b []domain.OrderBookLevel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Login logs a user registered with User in again, with a token that
+// expires after ttl. It must not run alongside another Login or User.
+func (s *Server) Login(ctx context.Context, username string, ttl time.Duration) (token string, err error) {
+	s.accounts.SetTokenTTL(ttl)
+	defer s.accounts.SetTokenTTL(accounts.DefaultTokenTTL)
+	session, err := s.accounts.Login(ctx, username, "wstest-password")
+	if err != nil {
+		return "", err
+	}
+	return session.Token, nil
+}
+
+// Limit submits a limit order for userID
+func (s *Server) Limit(ctx context.Context, userID, symbol string, side domain.OrderSide, quantity, price float64) (*domain.Order, error) {
+	order := domain.NewOrder(userID, symbol, side, domain.OrderTypeLimit, quantity, price)
+	if err := s.Exchange.SubmitOrder(ctx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// Rest submits a limit order that shouldn't cross and waits for it to rest
+// on the book. Orders are matched in the background, so one submitted
+// straight after with Limit could otherwise be matched first.
+func (s *Server) Rest(ctx context.Context, userID, symbol string, side domain.OrderSide, quantity, price float64) (*domain.Order, error) {
+	order, err := s.Limit(ctx, userID, symbol, side, quantity, price)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		book := s.Exchange.GetOrderBook(symbol, 100)
+		levels := book.Bids
+		if side == domain.OrderSideSell {
+			levels = book.Asks
+		}
+		for _, level := range levels {
+			if level.Price == price {
+				return order, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("order %s never rested on the book: %w", order.ID, ctx.Err())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+// Cancel cancels an order submitted with Limit or Rest
+func (s *Server) Cancel(ctx context.Context, order *domain.Order) error {
+	return s.Exchange.CancelOrder(ctx, order.ID, order.Symbol, order.UserID)
+}
@@ -21,6 +21,8 @@ class ApiClient {
       ...options,
       headers: {
         'Content-Type': 'application/json',
+        // Prices and quantities as numbers until the UI handles decimal strings
+        'X-Number-Format': 'float',
         ...options?.headers,
       },
     });
@@ -43,8 +45,15 @@ class ApiClient {
     });
   }
 
-  async cancelOrder(orderId: string, symbol: string): Promise<void> {
-    return this.request<void>(`/api/v1/orders/${orderId}?symbol=${symbol}`, {
+  async cancelOrder(orderId: string, symbol: string, userId: string): Promise<void> {
+    return this.request<void>(`/api/v1/orders/${orderId}?symbol=${symbol}&user_id=${userId}`, {
+      method: 'DELETE',
+    });
+  }
+
+  async cancelAllOrders(userId: string, symbol?: string): Promise<{ cancelled: number }> {
+    const query = symbol ? `?symbol=${symbol}` : '';
+    return this.request<{ cancelled: number }>(`/api/v1/users/${userId}/orders${query}`, {
       method: 'DELETE',
     });
   }
@@ -53,6 +62,27 @@ class ApiClient {
     return this.request<Order[]>(`/api/v1/users/${userId}/orders?limit=${limit}`);
   }
 
+  async getOpenOrders(
+    userId: string,
+    symbol?: string
+  ): Promise<{ orders: Order[]; sequences: Record<string, number> }> {
+    const query = symbol ? `?symbol=${symbol}` : '';
+    return this.request<{ orders: Order[]; sequences: Record<string, number> }>(
+      `/api/v1/users/${userId}/open-orders${query}`
+    );
+  }
+
+  // Long-polls for order changes after sinceSeq, waiting up to timeout
+  async getOrderChanges(
+    userId: string,
+    sinceSeq: number,
+    timeout = '30s'
+  ): Promise<{ orders: Order[]; cursor: number; resync: boolean }> {
+    return this.request<{ orders: Order[]; cursor: number; resync: boolean }>(
+      `/api/v1/users/${userId}/orders/changes?since_seq=${sinceSeq}&timeout=${timeout}`
+    );
+  }
+
   // Trades
   async getRecentTrades(symbol: string, limit = 50): Promise<Trade[]> {
     return this.request<Trade[]>(`/api/v1/trades/${symbol}?limit=${limit}`);
@@ -72,6 +102,27 @@ class ApiClient {
     return this.request<Balance[]>(`/api/v1/users/${userId}/balances`);
   }
 
+  // Notifications
+  async getNotificationSettings(userId: string): Promise<{ settings: NotificationSettings; sinks: string[] }> {
+    return this.request<{ settings: NotificationSettings; sinks: string[] }>(
+      `/api/v1/users/${userId}/notifications/settings`
+    );
+  }
+
+  async updateNotificationSettings(
+    userId: string,
+    settings: Omit<NotificationSettings, 'user_id'>
+  ): Promise<NotificationSettings> {
+    return this.request<NotificationSettings>(`/api/v1/users/${userId}/notifications/settings`, {
+      method: 'PUT',
+      body: JSON.stringify(settings),
+    });
+  }
+
+  async getNotificationLog(userId: string): Promise<NotificationLogEntry[]> {
+    return this.request<NotificationLogEntry[]>(`/api/v1/users/${userId}/notifications/log`);
+  }
+
   // Tickers
   async getTicker(symbol: string): Promise<Ticker> {
     return this.request<Ticker>(`/api/v1/tickers/${symbol}`);
@@ -82,8 +133,13 @@ class ApiClient {
   }
 
   // Symbols
-  async getSymbols(): Promise<string[]> {
-    return this.request<string[]>('/api/v1/symbols');
+  async getSymbols(): Promise<{ symbol: string; ready: boolean }[]> {
+    return this.request<{ symbol: string; ready: boolean }[]>('/api/v1/symbols');
+  }
+
+  // Docs
+  async getDocExamples(): Promise<DocExampleFlow[]> {
+    return this.request<DocExampleFlow[]>('/api/v1/docs/examples');
   }
 
   // Health check
@@ -92,4 +148,43 @@ class ApiClient {
   }
 }
 
+export interface DocExample {
+  name: string;
+  description?: string;
+  method: string;
+  path: string;
+  headers?: Record<string, string>;
+  request?: unknown;
+  status: number;
+  response: unknown;
+}
+
+export interface DocExampleFlow {
+  flow: string;
+  description: string;
+  examples: DocExample[];
+}
+
+export type NotificationEvent = 'fill' | 'system_cancel' | 'account_freeze';
+
+export interface NotificationSettings {
+  user_id: string;
+  sink: string;
+  address?: string;
+  events: NotificationEvent[];
+  digest_minutes: number;
+}
+
+export interface NotificationLogEntry {
+  id: number;
+  created_at: string;
+  sink: string;
+  subject: string;
+  events: number;
+  status: 'sent' | 'retrying' | 'failed';
+  attempts: number;
+  last_error?: string;
+  next_attempt?: string;
+}
+
 export const apiClient = new ApiClient(API_URL);
@@ -0,0 +1,104 @@
+import { useEffect, useState } from 'react';
+import { X } from 'lucide-react';
+import clsx from 'clsx';
+import { apiClient } from '../api/client';
+import type { DocExample, DocExampleFlow } from '../api/client';
+
+interface ApiHelpPanelProps {
+  onClose: () => void;
+}
+
+// Shows the request/response examples served at /api/v1/docs/examples, which
+// are recorded from a running exchange and so always match the API
+export function ApiHelpPanel({ onClose }: ApiHelpPanelProps) {
+  const [flows, setFlows] = useState<DocExampleFlow[]>([]);
+  const [selected, setSelected] = useState(0);
+  const [error, setError] = useState<string | null>(null);
+
+  useEffect(() => {
+    apiClient.getDocExamples()
+      .then(setFlows)
+      .catch((err: Error) => setError(err.message));
+  }, []);
+
+  const flow = flows[selected];
+
+  return (
+    <div className="fixed inset-0 z-50 flex justify-end bg-black/60" onClick={onClose}>
+      <div
+        className="w-full max-w-3xl h-full bg-gray-900 border-l border-gray-800 flex flex-col"
+        onClick={(e) => e.stopPropagation()}
+      >
+        <div className="flex items-center justify-between px-6 py-4 border-b border-gray-800">
+          <h2 className="text-lg font-semibold">API Examples</h2>
+          <button onClick={onClose} className="text-gray-400 hover:text-white">
+            <X size={20} />
+          </button>
+        </div>
+
+        {error && <div className="p-6 text-red-400 text-sm">Failed to load examples: {error}</div>}
+
+        <div className="flex flex-1 overflow-hidden">
+          <nav className="w-48 shrink-0 border-r border-gray-800 overflow-y-auto py-2">
+            {flows.map((f, i) => (
+              <button
+                key={f.flow}
+                onClick={() => setSelected(i)}
+                className={clsx(
+                  'block w-full text-left px-4 py-2 text-sm',
+                  i === selected ? 'bg-gray-800 text-white' : 'text-gray-400 hover:text-white'
+                )}
+              >
+                {f.flow.replace(/_/g, ' ')}
+              </button>
+            ))}
+          </nav>
+
+          {flow && (
+            <div className="flex-1 overflow-y-auto p-6 space-y-6">
+              <p className="text-gray-400 text-sm">{flow.description}</p>
+              {flow.examples.map((example) => (
+                <ExampleView key={example.name} example={example} />
+              ))}
+            </div>
+          )}
+        </div>
+      </div>
+    </div>
+  );
+}
+
+function ExampleView({ example }: { example: DocExample }) {
+  const ok = example.status < 400;
+  return (
+    <div className="bg-gray-950 border border-gray-800 rounded-lg p-4 space-y-3">
+      <div className="flex items-center justify-between">
+        <h3 className="font-semibold">{example.name}</h3>
+        <span className={clsx('text-xs font-mono', ok ? 'text-green-400' : 'text-red-400')}>
+          {example.status}
+        </span>
+      </div>
+      {example.description && <p className="text-gray-400 text-sm">{example.description}</p>}
+      <div className="font-mono text-sm break-all">
+        <span className="text-primary-500 mr-2">{example.method}</span>
+        {example.path}
+      </div>
+      {example.headers && (
+        <pre className="text-xs text-gray-400 whitespace-pre-wrap">
+          {Object.entries(example.headers).map(([name, value]) => `${name}: ${value}`).join('\n')}
+        </pre>
+      )}
+      {example.request !== undefined && <Json label="Request" value={example.request} />}
+      <Json label="Response" value={example.response} />
+    </div>
+  );
+}
+
+function Json({ label, value }: { label: string; value: unknown }) {
+  return (
+    <div>
+      <div className="text-xs text-gray-500 mb-1">{label}</div>
+      <pre className="text-xs bg-gray-900 rounded p-3 overflow-x-auto">{JSON.stringify(value, null, 2)}</pre>
+    </div>
+  );
+}
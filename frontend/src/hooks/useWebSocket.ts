@@ -1,19 +1,30 @@
 import { useEffect, useRef, useState } from 'react';
-import type { WSMessage } from '../types';
+import type { WSMessage, WSSubscription } from '../types';
 
 // Derive WebSocket URL from API URL (http -> ws, https -> wss)
 const getWsUrl = () => {
   const apiUrl = import.meta.env.VITE_API_URL || 'http://localhost:8080';
-  const wsUrl = apiUrl.replace(/^http/, 'ws') + '/ws';
+  const wsUrl = apiUrl.replace(/^http/, 'ws') + '/ws?number_format=float';
   return wsUrl;
 };
 
 const WS_URL = getWsUrl();
 
-export function useWebSocket(onMessage: (message: WSMessage) => void) {
+const subscriptionKey = (sub: WSSubscription) => `${sub.channel}:${sub.symbol ?? ''}`;
+
+// The server sends nothing until subscribed, so the current subscriptions are
+// sent on every (re)connect and whenever they change
+export function useWebSocket(onMessage: (message: WSMessage) => void, subscriptions: WSSubscription[]) {
   const [isConnected, setIsConnected] = useState(false);
   const wsRef = useRef<WebSocket | null>(null);
   const reconnectTimeoutRef = useRef<number | undefined>(undefined);
+  const subscribedRef = useRef<WSSubscription[]>([]);
+
+  const send = (op: 'subscribe' | 'unsubscribe', subs: WSSubscription[]) => {
+    const ws = wsRef.current;
+    if (!ws || ws.readyState !== WebSocket.OPEN) return;
+    subs.forEach(sub => ws.send(JSON.stringify({ op, ...sub })));
+  };
 
   const connect = () => {
     try {
@@ -22,6 +33,7 @@ export function useWebSocket(onMessage: (message: WSMessage) => void) {
       ws.onopen = () => {
         console.log('WebSocket connected');
         setIsConnected(true);
+        send('subscribe', subscribedRef.current);
       };
 
       ws.onmessage = (event) => {
@@ -32,6 +44,9 @@ export function useWebSocket(onMessage: (message: WSMessage) => void) {
             if (msgStr.trim()) {
               try {
                 const message: WSMessage = JSON.parse(msgStr);
+                if (message.type === 'error') {
+                  console.error('WebSocket request failed:', message.data);
+                }
                 onMessage(message);
               } catch (e) {
                 console.error('Failed to parse message:', msgStr, e);
@@ -78,5 +93,19 @@ export function useWebSocket(onMessage: (message: WSMessage) => void) {
     // eslint-disable-next-line react-hooks/exhaustive-deps
   }, []);
 
-  return { isConnected };
+  // Subscribe to what was added and unsubscribe from what was dropped
+  const key = subscriptions.map(subscriptionKey).sort().join(',');
+  useEffect(() => {
+    const wanted = new Set(subscriptions.map(subscriptionKey));
+    const current = new Set(subscribedRef.current.map(subscriptionKey));
+    send('unsubscribe', subscribedRef.current.filter(sub => !wanted.has(subscriptionKey(sub))));
+    send('subscribe', subscriptions.filter(sub => !current.has(subscriptionKey(sub))));
+    subscribedRef.current = subscriptions;
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [key]);
+
+  // Subscribing again to what is already subscribed gets a fresh snapshot
+  const resubscribe = (sub: WSSubscription) => send('subscribe', [sub]);
+
+  return { isConnected, resubscribe };
 }
@@ -1,14 +1,16 @@
-import { useState, useEffect } from 'react';
+import { useState, useEffect, useMemo } from 'react';
 import { useNavigate } from 'react-router-dom';
-import { TrendingUp, TrendingDown, Activity } from 'lucide-react';
+import { TrendingUp, TrendingDown, Activity, BookOpen } from 'lucide-react';
 import clsx from 'clsx';
 import { apiClient } from '../api/client';
 import { useWebSocket } from '../hooks/useWebSocket';
-import type { Ticker, WSMessage } from '../types';
+import { ApiHelpPanel } from '../components/ApiHelpPanel';
+import type { Ticker, WSMessage, WSSubscription } from '../types';
 
 export function Dashboard() {
   const navigate = useNavigate();
   const [tickers, setTickers] = useState<Ticker[]>([]);
+  const [showHelp, setShowHelp] = useState(false);
 
   // WebSocket message handler - only update tickers
   const handleWSMessage = (message: WSMessage) => {
@@ -25,7 +27,12 @@ export function Dashboard() {
     }
   };
 
-  const { isConnected } = useWebSocket(handleWSMessage);
+  const symbols = tickers.map(t => t.symbol).join(',');
+  const subscriptions = useMemo<WSSubscription[]>(
+    () => (symbols ? symbols.split(',') : []).map(symbol => ({ channel: 'ticker' as const, symbol })),
+    [symbols],
+  );
+  const { isConnected } = useWebSocket(handleWSMessage, subscriptions);
 
   // Load tickers
   useEffect(() => {
@@ -55,11 +62,20 @@ export function Dashboard() {
               <h1 className="text-3xl font-bold">HFT Exchange</h1>
               <p className="text-gray-400 mt-1">High-Frequency Trading Platform</p>
             </div>
-            <div className="flex items-center gap-2">
-              <div className={`w-2 h-2 rounded-full ${isConnected ? 'bg-green-500' : 'bg-red-500'}`}></div>
-              <span className="text-sm text-gray-400 capitalize">
-                {isConnected ? 'connected' : 'disconnected'}
-              </span>
+            <div className="flex items-center gap-6">
+              <button
+                onClick={() => setShowHelp(true)}
+                className="flex items-center gap-2 text-sm text-gray-400 hover:text-white"
+              >
+                <BookOpen size={16} />
+                API Help
+              </button>
+              <div className="flex items-center gap-2">
+                <div className={`w-2 h-2 rounded-full ${isConnected ? 'bg-green-500' : 'bg-red-500'}`}></div>
+                <span className="text-sm text-gray-400 capitalize">
+                  {isConnected ? 'connected' : 'disconnected'}
+                </span>
+              </div>
             </div>
           </div>
         </div>
@@ -163,6 +179,8 @@ export function Dashboard() {
           </div>
         </div>
       </div>
+
+      {showHelp && <ApiHelpPanel onClose={() => setShowHelp(false)} />}
     </div>
   );
 }
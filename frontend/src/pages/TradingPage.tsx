@@ -1,4 +1,4 @@
-import { useState, useEffect, useCallback } from 'react';
+import { useState, useEffect, useCallback, useMemo, useRef } from 'react';
 import { useParams } from 'react-router-dom';
 import { OrderBook } from '../components/OrderBook';
 import { TradeHistory } from '../components/TradeHistory';
@@ -6,7 +6,31 @@ import { OrderForm } from '../components/OrderForm';
 import { Portfolio } from '../components/Portfolio';
 import { useWebSocket } from '../hooks/useWebSocket';
 import { apiClient } from '../api/client';
-import type { Order, Trade, OrderBook as OrderBookType, Ticker, Balance, WSMessage } from '../types';
+import type { Order, Trade, OrderBook as OrderBookType, OrderBookDiff, OrderBookLevel, Ticker, Balance, WSMessage, WSSubscription } from '../types';
+
+// Sets each changed level's new quantity, removing those at 0, keeping the
+// side sorted best first
+function applyLevels(levels: OrderBookLevel[], changes: OrderBookLevel[], isBuy: boolean) {
+  const byPrice = new Map(levels.map(level => [level.price, level]));
+  changes.forEach(change => {
+    if (change.quantity === 0) {
+      byPrice.delete(change.price);
+    } else {
+      byPrice.set(change.price, change);
+    }
+  });
+  return [...byPrice.values()].sort((a, b) => (isBuy ? b.price - a.price : a.price - b.price));
+}
+
+function applyBookDiff(book: OrderBookType, diff: OrderBookDiff): OrderBookType {
+  return {
+    ...book,
+    bids: applyLevels(book.bids, diff.bids, true),
+    asks: applyLevels(book.asks, diff.asks, false),
+    timestamp: diff.timestamp,
+    seq: diff.seq,
+  };
+}
 
 export function TradingPage() {
   const { symbol } = useParams<{ symbol: string }>();
@@ -20,17 +44,36 @@ export function TradingPage() {
 
   const currentPrice = ticker?.price || 0;
 
+  // The book diffs apply to, null while waiting for a snapshot
+  const bookRef = useRef<OrderBookType | null>(null);
+  const resubscribeRef = useRef<(sub: WSSubscription) => void>(() => {});
+
   // WebSocket message handler
   const handleWSMessage = useCallback((message: WSMessage) => {
     switch (message.type) {
       case 'orderbook':
         if (message.symbol === tradingSymbol) {
           console.log(`📦 [${tradingSymbol}] Received orderbook`);
+          bookRef.current = message.data;
           setOrderBook(message.data);
         }
         break;
+      case 'orderbook_diff': {
+        const book = bookRef.current;
+        if (message.symbol !== tradingSymbol || !book || message.data.seq <= book.seq) break;
+        if (message.data.prev_seq !== book.seq) {
+          // A diff was missed, so the book is rebuilt from a fresh snapshot
+          console.log(`📦 [${tradingSymbol}] Orderbook gap, resubscribing`);
+          bookRef.current = null;
+          resubscribeRef.current({ channel: 'orderbook', symbol: tradingSymbol });
+          break;
+        }
+        bookRef.current = applyBookDiff(book, message.data);
+        setOrderBook(bookRef.current);
+        break;
+      }
       case 'trade':
-        if (message.data.symbol === tradingSymbol) {
+        if (message.symbol === tradingSymbol) {
           setTrades(prev => {
             const tradeExists = prev.some(t => t.id === message.data.id);
             if (tradeExists) return prev;
@@ -39,8 +82,21 @@ export function TradingPage() {
           });
         }
         break;
+      case 'trades':
+        // The latest trades, sent on subscribing; a trade also broadcast as
+        // it happened is only kept once
+        if (message.symbol === tradingSymbol) {
+          setTrades(prev => {
+            const snapshot: Trade[] = message.data;
+            const ids = new Set(snapshot.map(t => t.id));
+            return [...prev.filter(t => !ids.has(t.id)), ...snapshot]
+              .sort((a, b) => Date.parse(b.executed_at) - Date.parse(a.executed_at))
+              .slice(0, 20);
+          });
+        }
+        break;
       case 'ticker':
-        if (message.data.symbol === tradingSymbol) {
+        if (message.symbol === tradingSymbol) {
           console.log(`💹 [${tradingSymbol}] Updating ticker: $${message.data.price.toFixed(2)}`);
           setTicker(message.data);
         }
@@ -63,7 +119,15 @@ export function TradingPage() {
     }
   }, [tradingSymbol]);
 
-  const { isConnected } = useWebSocket(handleWSMessage);
+  // The demo user has no session token for the user channel, so its orders
+  // and balances come from the polling below
+  const subscriptions = useMemo<WSSubscription[]>(() => [
+    { channel: 'orderbook', symbol: tradingSymbol },
+    { channel: 'trades', symbol: tradingSymbol },
+    { channel: 'ticker', symbol: tradingSymbol },
+  ], [tradingSymbol]);
+  const { isConnected, resubscribe } = useWebSocket(handleWSMessage, subscriptions);
+  resubscribeRef.current = resubscribe;
 
   // Load initial data for this symbol
   useEffect(() => {
@@ -71,12 +135,13 @@ export function TradingPage() {
       console.log(`🔄 [${tradingSymbol}] Loading initial data`);
       
       try {
-        const [tickerData, balancesData, ordersData, tradesData, orderBookData] = await Promise.all([
+        // The order book comes as a snapshot on subscribing, which its diffs
+        // need to apply to
+        const [tickerData, balancesData, ordersData, tradesData] = await Promise.all([
           apiClient.getTicker(tradingSymbol),
           apiClient.getUserBalances('user-1'),
           apiClient.getUserOrders('user-1', 20),
           apiClient.getRecentTrades(tradingSymbol, 20),
-          apiClient.getOrderBook(tradingSymbol, 20),
         ]);
 
         console.log(`✅ [${tradingSymbol}] Data loaded - Ticker: $${tickerData.price.toFixed(2)}`);
@@ -85,7 +150,6 @@ export function TradingPage() {
         setBalances(balancesData);
         setOrders(ordersData);
         setTrades(tradesData);
-        setOrderBook(orderBookData);
       } catch (error) {
         console.error(`❌ [${tradingSymbol}] Failed to load data:`, error);
       }
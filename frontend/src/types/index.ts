@@ -17,6 +17,9 @@ export interface Order {
   created_at: string;
   updated_at: string;
   time_in_force: string;
+  cancel_reason?: 'ADMIN' | 'DELISTED';
+  seq?: number;
+  user_seq?: number;
 }
 
 export interface Trade {
@@ -44,6 +47,17 @@ export interface OrderBook {
   bids: OrderBookLevel[];
   asks: OrderBookLevel[];
   timestamp: string;
+  seq: number;
+}
+
+// The levels that changed between two streamed books; quantity 0 removes one
+export interface OrderBookDiff {
+  symbol: string;
+  bids: OrderBookLevel[];
+  asks: OrderBookLevel[];
+  timestamp: string;
+  prev_seq: number;
+  seq: number;
 }
 
 export interface Ticker {
@@ -65,11 +79,18 @@ export interface Balance {
 }
 
 export interface WSMessage {
-  type: 'orderbook' | 'trade' | 'ticker' | 'order_update';
+  type: 'orderbook' | 'orderbook_diff' | 'trade' | 'trades' | 'ticker' | 'order_update' | 'ack' | 'error';
   symbol?: string;
   data: any;
 }
 
+export type WSChannel = 'ticker' | 'trades' | 'orderbook' | 'symbolStatus' | 'status' | 'user';
+
+export interface WSSubscription {
+  channel: WSChannel;
+  symbol?: string;
+}
+
 export interface PlaceOrderRequest {
   user_id: string;
   symbol: string;